@@ -0,0 +1,39 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"github.com/Dreamacro/clash/common/sockopt"
+
+	"go.uber.org/atomic"
+)
+
+var tcpFastOpen = atomic.NewBool(false)
+
+// SetTCPFastOpen sets whether the TCP listeners accept TCP Fast Open
+func SetTCPFastOpen(enable bool) {
+	tcpFastOpen.Store(enable)
+}
+
+// TCPFastOpen returns whether the TCP listeners accept TCP Fast Open
+func TCPFastOpen() bool {
+	return tcpFastOpen.Load()
+}
+
+// Listen announces on the TCP address, TCP Fast Open is enabled if it is set
+// and supported by the platform
+func Listen(network, address string) (net.Listener, error) {
+	lc := &net.ListenConfig{}
+	if tcpFastOpen.Load() {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			if err := sockopt.TCPFastOpenListen(c); err != nil && err != sockopt.ErrTFONotSupported {
+				return err
+			}
+			return nil
+		}
+	}
+
+	return lc.Listen(context.Background(), network, address)
+}
@@ -71,6 +71,10 @@ func parseAddr(addr string) (net.IP, string, error) {
 		return nil, "", err
 	}
 
+	// the IPv4 clients of a dual-stack listener are IPv4-mapped IPv6
 	ip := net.ParseIP(host)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
 	return ip, port, nil
 }
@@ -0,0 +1,68 @@
+package inbound
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	N "github.com/Dreamacro/clash/common/net"
+	"github.com/Dreamacro/clash/component/socks5"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type remoteConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *remoteConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type testPacket struct {
+	C.UDPPacket
+	local net.Addr
+}
+
+func (p *testPacket) LocalAddr() net.Addr {
+	return p.local
+}
+
+func TestSourceIP(t *testing.T) {
+	target := socks5.ParseAddr("1.1.1.1:443")
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+
+	for _, tt := range []struct {
+		remote string
+		srcIP  net.IP
+	}{
+		// an IPv4 client of a dual-stack listener
+		{"[::ffff:192.168.1.2]:1234", net.IP{192, 168, 1, 2}},
+		{"192.168.1.2:1234", net.IP{192, 168, 1, 2}},
+		{"[2001:db8::1]:1234", net.ParseIP("2001:db8::1")},
+	} {
+		addr, err := net.ResolveTCPAddr("tcp", tt.remote)
+		assert.NoError(t, err)
+		conn := &remoteConn{remote: addr}
+		packet := &testPacket{local: &net.UDPAddr{IP: addr.IP, Port: addr.Port}}
+
+		metadatas := map[string]*C.Metadata{
+			"http":     NewHTTP(request, conn).Metadata(),
+			"https":    NewHTTPS(request, conn).Metadata(),
+			"socks":    NewSocket(target, conn, C.SOCKS).Metadata(),
+			"redir":    NewSocket(target, conn, C.REDIR).Metadata(),
+			"tproxy":   NewSocket(target, conn, C.TPROXY).Metadata(),
+			"tun":      NewSocket(target, conn, C.TUN).Metadata(),
+			"mixed":    NewSocket(target, N.NewBufferedConn(conn), C.SOCKS).Metadata(),
+			"socks-u":  NewPacket(target, packet, C.SOCKS).Metadata(),
+			"tproxy-u": NewPacket(target, packet, C.TPROXY).Metadata(),
+			"tun-u":    NewPacket(target, packet, C.TUN).Metadata(),
+		}
+		for name, metadata := range metadatas {
+			assert.Equal(t, tt.srcIP, metadata.SrcIP, "%s %s", name, tt.remote)
+			assert.Equal(t, "1234", metadata.SrcPort, "%s %s", name, tt.remote)
+		}
+	}
+}
@@ -4,21 +4,44 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"time"
 
 	"github.com/Dreamacro/clash/common/queue"
+	"github.com/Dreamacro/clash/common/ratelimit"
+	"github.com/Dreamacro/clash/component/dialer"
+	"github.com/Dreamacro/clash/component/profile"
+	"github.com/Dreamacro/clash/component/profile/cachefile"
 	C "github.com/Dreamacro/clash/constant"
 
 	"go.uber.org/atomic"
 )
 
+// maxHealthCheckBodySize limits the response body read by URLTest
+const maxHealthCheckBodySize = 64 * 1024
+
 type Base struct {
 	name string
 	addr string
 	tp   C.AdapterType
 	udp  bool
+
+	keepAlive   time.Duration
+	idleTimeout time.Duration
+	tfo         bool
+	routingMark int
+
+	maxDatagramSize int
+
+	upload   *ratelimit.Bucket
+	download *ratelimit.Bucket
+
+	healthCheckURL      string
+	healthCheckInterval uint
 }
 
 func (b *Base) Name() string {
@@ -33,6 +56,10 @@ func (b *Base) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 	return c, errors.New("no support")
 }
 
+func (b *Base) StreamPacketConn(c net.Conn, metadata *C.Metadata) (C.PacketConn, error) {
+	return nil, errors.New("no support")
+}
+
 func (b *Base) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
 	return nil, errors.New("no support")
 }
@@ -56,7 +83,7 @@ func (b *Base) Unwrap(metadata *C.Metadata) C.Proxy {
 }
 
 func NewBase(name string, addr string, tp C.AdapterType, udp bool) *Base {
-	return &Base{name, addr, tp, udp}
+	return &Base{name: name, addr: addr, tp: tp, udp: udp}
 }
 
 type conn struct {
@@ -73,6 +100,18 @@ func (c *conn) AppendToChains(a C.ProxyAdapter) {
 }
 
 func NewConn(c net.Conn, a C.ProxyAdapter) C.Conn {
+	if b, ok := a.(interface{ connIdleTimeout() time.Duration }); ok {
+		if timeout := b.connIdleTimeout(); timeout > 0 {
+			c = newIdleConn(c, a, timeout)
+		}
+	}
+	if b, ok := a.(interface {
+		rateLimiters() (*ratelimit.Bucket, *ratelimit.Bucket)
+	}); ok {
+		if upload, download := b.rateLimiters(); upload != nil || download != nil {
+			c = &rateLimitedConn{c, upload, download}
+		}
+	}
 	return &conn{c, []string{a.Name()}}
 }
 
@@ -90,6 +129,18 @@ func (c *packetConn) AppendToChains(a C.ProxyAdapter) {
 }
 
 func newPacketConn(pc net.PacketConn, a C.ProxyAdapter) C.PacketConn {
+	if b, ok := a.(interface{ datagramLimit() int }); ok {
+		if size := b.datagramLimit(); size > 0 {
+			pc = &limitedPacketConn{pc, size}
+		}
+	}
+	if b, ok := a.(interface {
+		rateLimiters() (*ratelimit.Bucket, *ratelimit.Bucket)
+	}); ok {
+		if upload, download := b.rateLimiters(); upload != nil || download != nil {
+			pc = &rateLimitedPacketConn{pc, upload, download}
+		}
+	}
 	return &packetConn{pc, []string{a.Name()}}
 }
 
@@ -110,6 +161,7 @@ func (p *Proxy) Dial(metadata *C.Metadata) (C.Conn, error) {
 }
 
 func (p *Proxy) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	ctx = dialer.WithRoutingMark(ctx, metadata.RoutingMark)
 	conn, err := p.ProxyAdapter.DialContext(ctx, metadata)
 	if err != nil {
 		p.alive.Store(false)
@@ -144,6 +196,18 @@ func (p *Proxy) LastDelay() (delay uint16) {
 	return history.Delay
 }
 
+// RestoreDelay recovers the delay history stored in cache file, it is only
+// applied before the first health check
+func (p *Proxy) RestoreDelay(history C.DelayHistory) bool {
+	if p.history.Len() != 0 {
+		return false
+	}
+
+	p.history.Put(history)
+	p.alive.Store(history.Delay != 0)
+	return true
+}
+
 func (p *Proxy) MarshalJSON() ([]byte, error) {
 	inner, err := p.ProxyAdapter.MarshalJSON()
 	if err != nil {
@@ -154,11 +218,17 @@ func (p *Proxy) MarshalJSON() ([]byte, error) {
 	json.Unmarshal(inner, &mapping)
 	mapping["history"] = p.DelayHistory()
 	mapping["name"] = p.Name()
+	if b, ok := p.ProxyAdapter.(interface{ RateLimit() *RateLimit }); ok {
+		if limit := b.RateLimit(); limit != nil {
+			mapping["rateLimit"] = limit
+		}
+	}
 	return json.Marshal(mapping)
 }
 
-// URLTest get the delay for the specified URL
-func (p *Proxy) URLTest(ctx context.Context, url string) (t uint16, err error) {
+// URLTest get the delay for the specified URL, the proxy is marked as
+// dead if the response doesn't match expect
+func (p *Proxy) URLTest(ctx context.Context, url string, expect *C.HealthCheckExpect) (t uint16, err error) {
 	defer func() {
 		p.alive.Store(err == nil)
 		record := C.DelayHistory{Time: time.Now()}
@@ -169,6 +239,9 @@ func (p *Proxy) URLTest(ctx context.Context, url string) (t uint16, err error) {
 		if p.history.Len() > 10 {
 			p.history.Pop()
 		}
+		if profile.StoreDelay.Load() {
+			cachefile.Cache().SetDelay(p.Name(), record)
+		}
 	}()
 
 	addr, err := urlToMetadata(url)
@@ -183,7 +256,12 @@ func (p *Proxy) URLTest(ctx context.Context, url string) (t uint16, err error) {
 	}
 	defer instance.Close()
 
-	req, err := http.NewRequest(http.MethodHead, url, nil)
+	method := http.MethodHead
+	if expect.NeedBody() {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		return
 	}
@@ -210,8 +288,27 @@ func (p *Proxy) URLTest(ctx context.Context, url string) (t uint16, err error) {
 	if err != nil {
 		return
 	}
-	resp.Body.Close()
+	defer resp.Body.Close()
 	t = uint16(time.Since(start) / time.Millisecond)
+
+	if !expect.MatchStatus(resp.StatusCode) {
+		err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		return
+	}
+
+	if expect.NeedBody() {
+		var body []byte
+		body, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBodySize))
+		if err != nil {
+			return
+		}
+
+		if !expect.MatchBody(body) {
+			err = errors.New("unexpected response body")
+			return
+		}
+	}
+
 	return
 }
 
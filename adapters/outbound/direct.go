@@ -2,9 +2,11 @@ package outbound
 
 import (
 	"context"
+	"fmt"
 	"net"
 
 	"github.com/Dreamacro/clash/component/dialer"
+	"github.com/Dreamacro/clash/component/resolver"
 	C "github.com/Dreamacro/clash/constant"
 )
 
@@ -13,24 +15,54 @@ type Direct struct {
 }
 
 func (d *Direct) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	address := net.JoinHostPort(metadata.String(), metadata.DstPort)
+	host, err := directHost(metadata)
+	if err != nil {
+		return nil, err
+	}
+	address := net.JoinHostPort(host, metadata.DstPort)
 
 	c, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return nil, err
 	}
-	tcpKeepAlive(c)
+	d.tcpKeepAlive(c)
 	return NewConn(c, d), nil
 }
 
 func (d *Direct) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
-	pc, err := dialer.ListenPacket("udp", "")
+	pc, err := d.listenPacket(metadata)
 	if err != nil {
 		return nil, err
 	}
 	return newPacketConn(&directPacketConn{pc}, d), nil
 }
 
+// directHost returns the host or IP dialed by DIRECT, a fake ip is replaced by
+// the host of it, and a host is resolved by the direct nameservers if they're set
+func directHost(metadata *C.Metadata) (string, error) {
+	host := metadata.Host
+	if host == "" && resolver.IsFakeIP(metadata.DstIP) {
+		var exist bool
+		if host, exist = resolver.FindHostByIP(metadata.DstIP); !exist {
+			return "", fmt.Errorf("fake DNS record %s missing", metadata.DstIP)
+		}
+	}
+
+	if host == "" {
+		return metadata.String(), nil
+	}
+
+	if resolver.DirectResolver == nil {
+		return host, nil
+	}
+
+	ip, err := resolver.ResolveDirectIP(host)
+	if err != nil {
+		return "", fmt.Errorf("[DNS] resolve %s error: %w", host, err)
+	}
+	return ip.String(), nil
+}
+
 type directPacketConn struct {
 	net.PacketConn
 }
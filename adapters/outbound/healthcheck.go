@@ -0,0 +1,27 @@
+package outbound
+
+// HealthCheckOption overrides the health check URL and interval of the
+// groups and providers of a proxy, interval is in seconds
+type HealthCheckOption struct {
+	URL      string `proxy:"health-check-url,omitempty"`
+	Interval int    `proxy:"health-check-interval,omitempty"`
+}
+
+func (b *Base) setHealthCheckOption(option HealthCheckOption) {
+	b.healthCheckURL = option.URL
+	b.healthCheckInterval = uint(option.Interval)
+}
+
+// HealthCheck returns the overridden URL and interval, empty URL and zero
+// interval mean the default of the health check
+func (b *Base) HealthCheck() (url string, interval uint) {
+	return b.healthCheckURL, b.healthCheckInterval
+}
+
+// HealthCheck returns the health check override of the adapter
+func (p *Proxy) HealthCheck() (url string, interval uint) {
+	if b, ok := p.ProxyAdapter.(interface{ HealthCheck() (string, uint) }); ok {
+		return b.HealthCheck()
+	}
+	return "", 0
+}
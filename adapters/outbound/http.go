@@ -13,15 +13,18 @@ import (
 	"net/url"
 	"strconv"
 
-	"github.com/Dreamacro/clash/component/dialer"
+	tlsC "github.com/Dreamacro/clash/component/tls"
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
 )
 
 type Http struct {
 	*Base
-	user      string
-	pass      string
-	tlsConfig *tls.Config
+	user        string
+	pass        string
+	tlsConfig   *tls.Config
+	fingerprint *tlsC.Fingerprint
+	http2       *http2Client
 }
 
 type HttpOption struct {
@@ -33,16 +36,20 @@ type HttpOption struct {
 	TLS            bool   `proxy:"tls,omitempty"`
 	SNI            string `proxy:"sni,omitempty"`
 	SkipCertVerify bool   `proxy:"skip-cert-verify,omitempty"`
+	HTTP2          bool   `proxy:"http2,omitempty"`
+	// ClientFingerprint is chrome, firefox, safari, ios or random, it isn't
+	// applied to http2
+	ClientFingerprint string `proxy:"client-fingerprint,omitempty"`
+	TLSMinVersion     string `proxy:"tls-min-version,omitempty"`
 }
 
 func (h *Http) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 	if h.tlsConfig != nil {
-		cc := tls.Client(c, h.tlsConfig)
-		err := cc.Handshake()
-		c = cc
+		cc, err := tlsC.StreamConn(c, h.tlsConfig, h.fingerprint)
 		if err != nil {
 			return nil, fmt.Errorf("%s connect error: %w", h.addr, err)
 		}
+		c = cc
 	}
 
 	if err := h.shakeHand(metadata, c); err != nil {
@@ -52,11 +59,21 @@ func (h *Http) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 }
 
 func (h *Http) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	c, err := dialer.DialContext(ctx, "tcp", h.addr)
+	if h.http2 != nil {
+		c, err := h.http2.dial(ctx, h, metadata.RemoteAddress())
+		if err != errHTTP2NotSupported {
+			if err != nil {
+				return nil, err
+			}
+			return NewConn(c, h), nil
+		}
+	}
+
+	c, err := h.dialContext(ctx, h.addr)
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error: %w", h.addr, err)
 	}
-	tcpKeepAlive(c)
+	h.tcpKeepAlive(c)
 
 	c, err = h.StreamConn(c, metadata)
 	if err != nil {
@@ -79,10 +96,7 @@ func (h *Http) shakeHand(metadata *C.Metadata, rw io.ReadWriter) error {
 		},
 	}
 
-	if h.user != "" && h.pass != "" {
-		auth := h.user + ":" + h.pass
-		req.Header.Add("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
-	}
+	h.setAuth(req)
 
 	if err := req.Write(rw); err != nil {
 		return err
@@ -93,6 +107,18 @@ func (h *Http) shakeHand(metadata *C.Metadata, rw io.ReadWriter) error {
 		return err
 	}
 
+	return connectError(resp)
+}
+
+func (h *Http) setAuth(req *http.Request) {
+	if h.user != "" && h.pass != "" {
+		auth := h.user + ":" + h.pass
+		req.Header.Add("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
+	}
+}
+
+// connectError returns the error of a CONNECT response, nil means the tunnel is established
+func connectError(resp *http.Response) error {
 	if resp.StatusCode == http.StatusOK {
 		return nil
 	}
@@ -112,7 +138,14 @@ func (h *Http) shakeHand(metadata *C.Metadata, rw io.ReadWriter) error {
 	return fmt.Errorf("can not connect remote err code: %d", resp.StatusCode)
 }
 
-func NewHttp(option HttpOption) *Http {
+func NewHttp(option HttpOption) (*Http, error) {
+	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
+
+	fingerprint, minVersion, err := parseTLSOption(option.ClientFingerprint, option.TLSMinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("http %s %w", addr, err)
+	}
+
 	var tlsConfig *tls.Config
 	if option.TLS {
 		sni := option.Server
@@ -123,17 +156,30 @@ func NewHttp(option HttpOption) *Http {
 			InsecureSkipVerify: option.SkipCertVerify,
 			ClientSessionCache: getClientSessionCache(),
 			ServerName:         sni,
+			MinVersion:         minVersion,
+		}
+	}
+
+	// HTTP/2 is negotiated by ALPN, so it works only with TLS
+	var h2 *http2Client
+	if option.HTTP2 {
+		if tlsConfig != nil {
+			h2 = newHTTP2Client(addr, tlsConfig)
+		} else {
+			log.Warnln("[HTTP] %s http2 is ignored without tls", option.Name)
 		}
 	}
 
 	return &Http{
 		Base: &Base{
 			name: option.Name,
-			addr: net.JoinHostPort(option.Server, strconv.Itoa(option.Port)),
+			addr: addr,
 			tp:   C.Http,
 		},
-		user:      option.UserName,
-		pass:      option.Password,
-		tlsConfig: tlsConfig,
-	}
+		user:        option.UserName,
+		pass:        option.Password,
+		tlsConfig:   tlsConfig,
+		fingerprint: fingerprint,
+		http2:       h2,
+	}, nil
 }
@@ -0,0 +1,187 @@
+package outbound
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/log"
+
+	"golang.org/x/net/http2"
+)
+
+var errHTTP2NotSupported = errors.New("HTTP/2 not supported by proxy")
+
+// http2Client multiplexes the CONNECT tunnels to a HTTP proxy over one HTTP/2 connection
+type http2Client struct {
+	addr      string
+	tlsConfig *tls.Config
+	transport *http2.Transport
+
+	mux         sync.Mutex
+	conn        *http2.ClientConn
+	unsupported bool
+}
+
+func newHTTP2Client(addr string, tlsConfig *tls.Config) *http2Client {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+	return &http2Client{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+		transport: &http2.Transport{ReadIdleTimeout: 30 * time.Second},
+	}
+}
+
+// clientConn returns the HTTP/2 connection which can take a new stream, it
+// returns errHTTP2NotSupported if the proxy doesn't negotiate h2 by ALPN
+func (hc *http2Client) clientConn(ctx context.Context, h *Http) (*http2.ClientConn, error) {
+	hc.mux.Lock()
+	defer hc.mux.Unlock()
+
+	if hc.unsupported {
+		return nil, errHTTP2NotSupported
+	}
+	if hc.conn != nil && hc.conn.CanTakeNewRequest() {
+		return hc.conn, nil
+	}
+
+	c, err := h.dialContext(ctx, hc.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", hc.addr, err)
+	}
+	h.tcpKeepAlive(c)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	tc := tls.Client(c, hc.tlsConfig)
+	if err := tc.Handshake(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("%s connect error: %w", hc.addr, err)
+	}
+	c.SetDeadline(time.Time{})
+
+	if tc.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+		tc.Close()
+		hc.unsupported = true
+		log.Warnln("[HTTP] %s doesn't support HTTP/2, fall back to HTTP/1.1", hc.addr)
+		return nil, errHTTP2NotSupported
+	}
+
+	cc, err := hc.transport.NewClientConn(tc)
+	if err != nil {
+		tc.Close()
+		return nil, err
+	}
+	hc.conn = cc
+	return cc, nil
+}
+
+// dial opens a CONNECT tunnel to addr on a HTTP/2 stream
+func (hc *http2Client) dial(ctx context.Context, h *Http, addr string) (net.Conn, error) {
+	cc, err := hc.clientConn(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: http.Header{},
+		Body:   reader,
+	}
+	h.setAuth(req)
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	// the request doesn't carry ctx, or the stream would be reset after dialing
+	ch := make(chan result, 1)
+	go func() {
+		resp, err := cc.RoundTrip(req)
+		ch <- result{resp, err}
+	}()
+
+	var res result
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		writer.Close()
+		go func() {
+			if res := <-ch; res.resp != nil {
+				res.resp.Body.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+
+	if res.err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("%s connect error: %w", hc.addr, res.err)
+	}
+	if err := connectError(res.resp); err != nil {
+		writer.Close()
+		res.resp.Body.Close()
+		return nil, err
+	}
+
+	return &http2Conn{body: res.resp.Body, writer: writer}, nil
+}
+
+// http2Conn is a CONNECT tunnel on a HTTP/2 stream
+type http2Conn struct {
+	body   io.ReadCloser
+	writer *io.PipeWriter
+
+	mux      sync.Mutex
+	deadline *time.Timer
+}
+
+func (c *http2Conn) Read(b []byte) (int, error) {
+	return c.body.Read(b)
+}
+
+func (c *http2Conn) Write(b []byte) (int, error) {
+	return c.writer.Write(b)
+}
+
+func (c *http2Conn) Close() error {
+	c.writer.Close()
+	return c.body.Close()
+}
+
+func (c *http2Conn) LocalAddr() net.Addr                { return &net.TCPAddr{IP: net.IPv4zero, Port: 0} }
+func (c *http2Conn) RemoteAddr() net.Addr               { return &net.TCPAddr{IP: net.IPv4zero, Port: 0} }
+func (c *http2Conn) SetReadDeadline(t time.Time) error  { return c.SetDeadline(t) }
+func (c *http2Conn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+// SetDeadline closes the stream when t is reached, a stream can't be resumed after timeout
+func (c *http2Conn) SetDeadline(t time.Time) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.deadline != nil {
+		c.deadline.Stop()
+		c.deadline = nil
+	}
+
+	if t.IsZero() {
+		return nil
+	}
+
+	c.deadline = time.AfterFunc(time.Until(t), func() {
+		c.Close()
+	})
+	return nil
+}
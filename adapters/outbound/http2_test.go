@@ -0,0 +1,123 @@
+package outbound
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	fw.w.(http.Flusher).Flush()
+	return n, err
+}
+
+// newConnectServer is a TLS proxy which echoes the CONNECT tunnels, over
+// HTTP/2 if h2 is true
+func newConnectServer(t *testing.T, h2 bool) (*httptest.Server, *atomic.Int32, *atomic.String) {
+	conns := atomic.NewInt32(0)
+	proto := atomic.NewString("")
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto.Store(r.Proto)
+		if r.Method != http.MethodConnect || r.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.ProtoMajor == 2 {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			io.Copy(flushWriter{w}, r.Body)
+			return
+		}
+
+		c, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		rw.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+		rw.Flush()
+		io.Copy(c, rw)
+	}))
+	server.EnableHTTP2 = h2
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Inc()
+		}
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, conns, proto
+}
+
+func newTestHttp(t *testing.T, server *httptest.Server, password string) *Http {
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	portNum, _ := strconv.Atoi(port)
+	h, err := NewHttp(HttpOption{
+		Name:           "http",
+		Server:         host,
+		Port:           portNum,
+		UserName:       "user",
+		Password:       password,
+		TLS:            true,
+		SkipCertVerify: true,
+		HTTP2:          true,
+	})
+	require.NoError(t, err)
+	return h
+}
+
+func echo(t *testing.T, h *Http, msg string) {
+	c, err := h.DialContext(context.Background(), &C.Metadata{AddrType: C.AtypDomainName, Host: "example.com", DstPort: "443"})
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte(msg + "\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(c).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, msg+"\n", line)
+}
+
+func TestHttp_HTTP2Connect(t *testing.T) {
+	server, conns, proto := newConnectServer(t, true)
+	h := newTestHttp(t, server, "pass")
+
+	// the tunnels are the streams of one connection
+	echo(t, h, "first")
+	echo(t, h, "second")
+	assert.Equal(t, "HTTP/2.0", proto.Load())
+	assert.Equal(t, int32(1), conns.Load())
+
+	_, err := newTestHttp(t, server, "wrong").DialContext(context.Background(), &C.Metadata{AddrType: C.AtypDomainName, Host: "example.com", DstPort: "443"})
+	assert.EqualError(t, err, "HTTP need auth")
+}
+
+func TestHttp_HTTP2Fallback(t *testing.T) {
+	server, conns, proto := newConnectServer(t, false)
+	h := newTestHttp(t, server, "pass")
+
+	// the probing connection without h2 is dropped, then HTTP/1.1 is used for good
+	echo(t, h, "first")
+	assert.Equal(t, "HTTP/1.1", proto.Load())
+	assert.True(t, h.http2.unsupported)
+	echo(t, h, "second")
+	assert.Equal(t, int32(3), conns.Load())
+}
@@ -0,0 +1,224 @@
+package outbound
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/hysteria2"
+	"github.com/Dreamacro/clash/component/resolver"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+)
+
+type Hysteria2 struct {
+	*Base
+	server string
+	port   int
+	config *hysteria2.Config
+
+	mux    sync.Mutex
+	client *hysteria2.Client
+}
+
+type Hysteria2Option struct {
+	Name   string `proxy:"name"`
+	Server string `proxy:"server"`
+	Port   int    `proxy:"port,omitempty"`
+	// Ports are the ports of port hopping, e.g. `443,20000-30000`
+	Ports string `proxy:"ports,omitempty"`
+	// HopInterval is the seconds between two hops
+	HopInterval  int    `proxy:"hop-interval,omitempty"`
+	Password     string `proxy:"password"`
+	Obfs         string `proxy:"obfs,omitempty"`
+	ObfsPassword string `proxy:"obfs-password,omitempty"`
+	// Up and Down are the bandwidth e.g. `100 Mbps`, a number is in Mbps
+	Up             string   `proxy:"up,omitempty"`
+	Down           string   `proxy:"down,omitempty"`
+	SNI            string   `proxy:"sni,omitempty"`
+	SkipCertVerify bool     `proxy:"skip-cert-verify,omitempty"`
+	ALPN           []string `proxy:"alpn,omitempty"`
+	UDP            bool     `proxy:"udp,omitempty"`
+}
+
+func (h *Hysteria2) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	client, err := h.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := client.DialContext(ctx, metadata.RemoteAddress())
+	if err != nil {
+		return nil, fmt.Errorf("%s dial %s error: %w", h.addr, metadata.RemoteAddress(), err)
+	}
+	return NewConn(c, h), nil
+}
+
+func (h *Hysteria2) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tcpTimeout)
+	defer cancel()
+	client, err := h.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := client.ListenPacket()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", h.addr, err)
+	}
+	return newPacketConn(pc, h), nil
+}
+
+// datagramLimit is zero since the large packets are fragmented
+func (h *Hysteria2) datagramLimit() int {
+	return 0
+}
+
+// Close closes the QUIC connection, the connections on it are broken
+func (h *Hysteria2) Close() error {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.client != nil {
+		h.client.Close()
+		h.client = nil
+	}
+	return nil
+}
+
+// getClient returns the shared QUIC connection, it reconnects if the
+// connection is closed
+func (h *Hysteria2) getClient(ctx context.Context) (*hysteria2.Client, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.client != nil {
+		select {
+		case <-h.client.Done():
+			h.client = nil
+		default:
+			return h.client, nil
+		}
+	}
+
+	ip, err := resolver.ResolveIP(h.server)
+	if err != nil {
+		return nil, fmt.Errorf("%s resolve error: %w", h.addr, err)
+	}
+
+	// the connection is shared, so only the routing mark of the proxy applies
+	pc, err := h.listenPacket(&C.Metadata{})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := hysteria2.Dial(ctx, pc, &net.UDPAddr{IP: ip, Port: h.port}, h.config)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", h.addr, err)
+	}
+	h.client = client
+	return client, nil
+}
+
+// parseBandwidth parses a bandwidth in bytes per second, e.g. `100 Mbps`
+// or `100` in Mbps
+func parseBandwidth(s string) (uint64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	unit := uint64(1000 * 1000)
+	for _, u := range []struct {
+		suffix string
+		unit   uint64
+	}{
+		{"tbps", 1000 * 1000 * 1000 * 1000},
+		{"gbps", 1000 * 1000 * 1000},
+		{"mbps", 1000 * 1000},
+		{"kbps", 1000},
+		{"bps", 1},
+	} {
+		if strings.HasSuffix(s, u.suffix) {
+			unit = u.unit
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * unit / 8, nil
+}
+
+func NewHysteria2(option Hysteria2Option) (*Hysteria2, error) {
+	port := option.Port
+	config := &hysteria2.Config{
+		Password: option.Password,
+		TLSConfig: &tls.Config{
+			ServerName:         option.Server,
+			InsecureSkipVerify: option.SkipCertVerify,
+			NextProtos:         option.ALPN,
+			ClientSessionCache: getClientSessionCache(),
+		},
+		HopInterval: time.Duration(option.HopInterval) * time.Second,
+	}
+	if option.SNI != "" {
+		config.TLSConfig.ServerName = option.SNI
+	}
+
+	if option.Ports != "" {
+		ports, err := hysteria2.ParsePorts(option.Ports)
+		if err != nil {
+			return nil, fmt.Errorf("hysteria2 %s %w", option.Server, err)
+		}
+		config.Ports = ports
+		if port == 0 {
+			port = int(ports[0])
+		}
+	}
+	addr := net.JoinHostPort(option.Server, strconv.Itoa(port))
+	if port == 0 {
+		return nil, fmt.Errorf("hysteria2 %s port or ports is required", option.Server)
+	}
+
+	switch option.Obfs {
+	case "":
+	case "salamander":
+		if option.ObfsPassword == "" {
+			return nil, fmt.Errorf("hysteria2 %s obfs-password is required", addr)
+		}
+		config.Obfs = option.ObfsPassword
+	default:
+		return nil, fmt.Errorf("hysteria2 %s unsupported obfs: %s", addr, option.Obfs)
+	}
+
+	if option.Down != "" {
+		down, err := parseBandwidth(option.Down)
+		if err != nil {
+			return nil, fmt.Errorf("hysteria2 %s invalid down: %s", addr, option.Down)
+		}
+		config.Down = down
+	}
+	if option.Up != "" {
+		if _, err := parseBandwidth(option.Up); err != nil {
+			return nil, fmt.Errorf("hysteria2 %s invalid up: %s", addr, option.Up)
+		}
+		log.Warnln("[Hysteria2] %s up isn't supported, the sending rate is decided by the congestion control of QUIC", option.Name)
+	}
+
+	return &Hysteria2{
+		Base: &Base{
+			name: option.Name,
+			addr: addr,
+			tp:   C.Hysteria2,
+			udp:  option.UDP,
+		},
+		server: option.Server,
+		port:   port,
+		config: config,
+	}, nil
+}
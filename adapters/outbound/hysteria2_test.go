@@ -0,0 +1,71 @@
+package outbound
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHysteria2(t *testing.T) {
+	option := func() Hysteria2Option {
+		return Hysteria2Option{
+			Name:     "hy2",
+			Server:   "example.com",
+			Port:     443,
+			Password: "password",
+		}
+	}
+
+	h, err := NewHysteria2(option())
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:443", h.Addr())
+	assert.Equal(t, "example.com", h.config.TLSConfig.ServerName)
+
+	o := option()
+	o.Port = 0
+	o.Ports = "20000-20002"
+	o.Down = "100 Mbps"
+	h, err = NewHysteria2(o)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:20000", h.Addr())
+	assert.Equal(t, []uint16{20000, 20001, 20002}, h.config.Ports)
+	assert.Equal(t, uint64(100*1000*1000/8), h.config.Down)
+
+	o = option()
+	o.Port = 0
+	_, err = NewHysteria2(o)
+	assert.EqualError(t, err, "hysteria2 example.com port or ports is required")
+
+	o = option()
+	o.Obfs = "salamander"
+	_, err = NewHysteria2(o)
+	assert.EqualError(t, err, "hysteria2 example.com:443 obfs-password is required")
+
+	o = option()
+	o.Obfs = "xor"
+	_, err = NewHysteria2(o)
+	assert.EqualError(t, err, "hysteria2 example.com:443 unsupported obfs: xor")
+
+	o = option()
+	o.Down = "fast"
+	_, err = NewHysteria2(o)
+	assert.EqualError(t, err, "hysteria2 example.com:443 invalid down: fast")
+}
+
+func TestParseBandwidth(t *testing.T) {
+	for s, expected := range map[string]uint64{
+		"100":      100 * 1000 * 1000 / 8,
+		"100 Mbps": 100 * 1000 * 1000 / 8,
+		"1Gbps":    1000 * 1000 * 1000 / 8,
+		"800 kbps": 800 * 1000 / 8,
+		"8000 bps": 1000,
+	} {
+		n, err := parseBandwidth(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, n, s)
+	}
+
+	_, err := parseBandwidth("100 MB")
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Dreamacro/clash/component/mux"
+	"github.com/Dreamacro/clash/component/socks5"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+// MuxOption multiplexes the connections of a proxy over a few proxy
+// connections by sing-mux, idle-timeout is in seconds
+type MuxOption struct {
+	Enabled     bool   `proxy:"enabled,omitempty"`
+	Protocol    string `proxy:"protocol,omitempty"`
+	MaxStreams  int    `proxy:"max-streams,omitempty"`
+	IdleTimeout int    `proxy:"idle-timeout,omitempty"`
+}
+
+// newMuxClient returns nil if the option isn't enabled, dial returns the proxy
+// connection to metadata
+func newMuxClient(option MuxOption, dial func(ctx context.Context, metadata *C.Metadata) (net.Conn, error)) (*mux.Client, error) {
+	if !option.Enabled {
+		return nil, nil
+	}
+
+	if err := mux.ParseProtocol(option.Protocol); err != nil {
+		return nil, err
+	}
+	if option.MaxStreams < 0 || option.IdleTimeout < 0 {
+		return nil, errors.New("smux max-streams and idle-timeout should not be negative")
+	}
+
+	return mux.NewClient(mux.Config{
+		MaxStreams:  option.MaxStreams,
+		IdleTimeout: time.Duration(option.IdleTimeout) * time.Second,
+	}, func(ctx context.Context) (net.Conn, error) {
+		return dial(ctx, &C.Metadata{
+			NetWork:  C.TCP,
+			AddrType: socks5.AtypDomainName,
+			Host:     mux.DestinationHost,
+			DstPort:  strconv.Itoa(mux.DestinationPort),
+		})
+	}), nil
+}
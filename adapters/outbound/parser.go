@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Dreamacro/clash/common/structure"
+	"github.com/Dreamacro/clash/component/dialer"
 	C "github.com/Dreamacro/clash/constant"
 )
 
@@ -46,7 +47,7 @@ func ParseProxy(mapping map[string]interface{}) (C.Proxy, error) {
 		if err != nil {
 			break
 		}
-		proxy = NewHttp(*httpOption)
+		proxy, err = NewHttp(*httpOption)
 	case "vmess":
 		vmessOption := &VmessOption{
 			HTTPOpts: HTTPOptions{
@@ -59,6 +60,13 @@ func ParseProxy(mapping map[string]interface{}) (C.Proxy, error) {
 			break
 		}
 		proxy, err = NewVmess(*vmessOption)
+	case "vless":
+		vlessOption := &VlessOption{}
+		err = decoder.Decode(mapping, vlessOption)
+		if err != nil {
+			break
+		}
+		proxy, err = NewVless(*vlessOption)
 	case "snell":
 		snellOption := &SnellOption{}
 		err = decoder.Decode(mapping, snellOption)
@@ -73,6 +81,27 @@ func ParseProxy(mapping map[string]interface{}) (C.Proxy, error) {
 			break
 		}
 		proxy, err = NewTrojan(*trojanOption)
+	case "wireguard":
+		wireguardOption := &WireGuardOption{}
+		err = decoder.Decode(mapping, wireguardOption)
+		if err != nil {
+			break
+		}
+		proxy, err = NewWireGuard(*wireguardOption)
+	case "ssh":
+		sshOption := &SshOption{}
+		err = decoder.Decode(mapping, sshOption)
+		if err != nil {
+			break
+		}
+		proxy, err = NewSsh(*sshOption)
+	case "hysteria2":
+		hysteria2Option := &Hysteria2Option{}
+		err = decoder.Decode(mapping, hysteria2Option)
+		if err != nil {
+			break
+		}
+		proxy, err = NewHysteria2(*hysteria2Option)
 	default:
 		return nil, fmt.Errorf("unsupport proxy type: %s", proxyType)
 	}
@@ -81,5 +110,62 @@ func ParseProxy(mapping map[string]interface{}) (C.Proxy, error) {
 		return nil, err
 	}
 
+	tcpOption := TCPOption{}
+	if err := decoder.Decode(mapping, &tcpOption); err != nil {
+		return nil, err
+	}
+	if b, ok := proxy.(interface{ setTCPOption(TCPOption) }); ok {
+		b.setTCPOption(tcpOption)
+	}
+
+	udpOption := UDPOption{}
+	if err := decoder.Decode(mapping, &udpOption); err != nil {
+		return nil, err
+	}
+	if udpOption.MaxDatagramSize < 0 {
+		return nil, fmt.Errorf("max-datagram-size should not be negative")
+	}
+	if b, ok := proxy.(interface{ setUDPOption(UDPOption) }); ok {
+		b.setUDPOption(udpOption)
+	}
+
+	rateLimitOption := RateLimitOption{}
+	if err := decoder.Decode(mapping, &rateLimitOption); err != nil {
+		return nil, err
+	}
+	if rateLimitOption.MaxUpload < 0 || rateLimitOption.MaxDownload < 0 {
+		return nil, fmt.Errorf("max-upload and max-download should not be negative")
+	}
+	if b, ok := proxy.(interface{ setRateLimitOption(RateLimitOption) }); ok {
+		b.setRateLimitOption(rateLimitOption)
+	}
+
+	healthCheckOption := HealthCheckOption{}
+	if err := decoder.Decode(mapping, &healthCheckOption); err != nil {
+		return nil, err
+	}
+	if healthCheckOption.Interval < 0 {
+		return nil, fmt.Errorf("health-check-interval should not be negative")
+	}
+	if healthCheckOption.URL != "" {
+		if _, err := urlToMetadata(healthCheckOption.URL); err != nil {
+			return nil, fmt.Errorf("health-check-url error: %w", err)
+		}
+	}
+	if b, ok := proxy.(interface{ setHealthCheckOption(HealthCheckOption) }); ok {
+		b.setHealthCheckOption(healthCheckOption)
+	}
+
+	routingMarkOption := RoutingMarkOption{}
+	if err := decoder.Decode(mapping, &routingMarkOption); err != nil {
+		return nil, err
+	}
+	if err := dialer.CheckRoutingMark(int64(routingMarkOption.RoutingMark)); err != nil {
+		return nil, err
+	}
+	if b, ok := proxy.(interface{ setRoutingMarkOption(RoutingMarkOption) }); ok {
+		b.setRoutingMarkOption(routingMarkOption)
+	}
+
 	return NewProxy(proxy), nil
 }
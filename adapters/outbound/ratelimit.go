@@ -0,0 +1,122 @@
+package outbound
+
+import (
+	"net"
+
+	"github.com/Dreamacro/clash/common/ratelimit"
+)
+
+// RateLimitOption limits the throughput of a proxy in bytes per second, the
+// limit is shared by the TCP and UDP connections of the proxy. Zero means no
+// limit.
+type RateLimitOption struct {
+	MaxUpload   int `proxy:"max-upload,omitempty"`
+	MaxDownload int `proxy:"max-download,omitempty"`
+}
+
+// RateLimit is the rate limit of a proxy and the throughput of the last second
+type RateLimit struct {
+	MaxUpload   int64 `json:"maxUpload"`
+	MaxDownload int64 `json:"maxDownload"`
+	Upload      int64 `json:"upload"`
+	Download    int64 `json:"download"`
+}
+
+func (b *Base) setRateLimitOption(option RateLimitOption) {
+	if option.MaxUpload > 0 {
+		b.upload = ratelimit.NewBucket(int64(option.MaxUpload))
+	}
+	if option.MaxDownload > 0 {
+		b.download = ratelimit.NewBucket(int64(option.MaxDownload))
+	}
+}
+
+func (b *Base) rateLimiters() (upload, download *ratelimit.Bucket) {
+	return b.upload, b.download
+}
+
+// RateLimit returns nil if the proxy isn't limited
+func (b *Base) RateLimit() *RateLimit {
+	if b.upload == nil && b.download == nil {
+		return nil
+	}
+
+	limit := &RateLimit{}
+	if b.upload != nil {
+		limit.MaxUpload = b.upload.Rate()
+		limit.Upload = b.upload.Throughput()
+	}
+	if b.download != nil {
+		limit.MaxDownload = b.download.Rate()
+		limit.Download = b.download.Throughput()
+	}
+	return limit
+}
+
+// rateLimitedConn waits for the buckets after reading and before writing, the
+// buckets are nil if the direction isn't limited
+type rateLimitedConn struct {
+	net.Conn
+	upload   *ratelimit.Bucket
+	download *ratelimit.Bucket
+}
+
+func (c *rateLimitedConn) Read(b []byte) (int, error) {
+	if c.download == nil {
+		return c.Conn.Read(b)
+	}
+
+	if burst := c.download.Burst(); len(b) > burst {
+		b = b[:burst]
+	}
+	n, err := c.Conn.Read(b)
+	c.download.Wait(n)
+	return n, err
+}
+
+func (c *rateLimitedConn) Write(b []byte) (int, error) {
+	if c.upload == nil {
+		return c.Conn.Write(b)
+	}
+
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if burst := c.upload.Burst(); len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+		c.upload.Wait(len(chunk))
+
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// rateLimitedPacketConn drops the datagrams written over the limit, as the
+// writes are from the UDP workers shared by all proxies, and waits for the
+// bucket after reading in the goroutine of the session
+type rateLimitedPacketConn struct {
+	net.PacketConn
+	upload   *ratelimit.Bucket
+	download *ratelimit.Bucket
+}
+
+func (c *rateLimitedPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.upload != nil && !c.upload.TryTake(len(b)) {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func (c *rateLimitedPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	if c.download != nil {
+		c.download.Wait(n)
+	}
+	return n, addr, err
+}
@@ -0,0 +1,130 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	C "github.com/Dreamacro/clash/constant"
+)
+
+var errDropConnClosed = errors.New("connection closed")
+
+// RejectDrop accepts the connections but never responds, the data sent to it
+// is discarded, so that the clients stall instead of retrying on a reset
+type RejectDrop struct {
+	*Base
+}
+
+func (r *RejectDrop) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	c, discard := net.Pipe()
+	go io.Copy(ioutil.Discard, discard)
+	return NewConn(c, r), nil
+}
+
+func (r *RejectDrop) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
+	return newPacketConn(newDropPacketConn(), r), nil
+}
+
+func NewRejectDrop() *RejectDrop {
+	return &RejectDrop{
+		Base: &Base{
+			name: "REJECT-DROP",
+			tp:   C.RejectDrop,
+			udp:  true,
+		},
+	}
+}
+
+// dropPacketConn discards the packets written to it, and the reads block
+// until the connection is closed or the read deadline is reached
+type dropPacketConn struct {
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mux          sync.Mutex
+	readDeadline time.Time
+	// deadlineSet is closed when the read deadline is changed
+	deadlineSet chan struct{}
+}
+
+func newDropPacketConn() *dropPacketConn {
+	return &dropPacketConn{
+		closed:      make(chan struct{}),
+		deadlineSet: make(chan struct{}),
+	}
+}
+
+func (pc *dropPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		pc.mux.Lock()
+		deadline, deadlineSet := pc.readDeadline, pc.deadlineSet
+		pc.mux.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+
+		var err error
+		select {
+		case <-pc.closed:
+			err = errDropConnClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		case <-deadlineSet:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+}
+
+func (pc *dropPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-pc.closed:
+		return 0, errDropConnClosed
+	default:
+		return len(b), nil
+	}
+}
+
+func (pc *dropPacketConn) Close() error {
+	pc.closeOnce.Do(func() {
+		close(pc.closed)
+	})
+	return nil
+}
+
+func (pc *dropPacketConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4zero, Port: 0}
+}
+
+func (pc *dropPacketConn) SetDeadline(t time.Time) error {
+	return pc.SetReadDeadline(t)
+}
+
+func (pc *dropPacketConn) SetReadDeadline(t time.Time) error {
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+
+	pc.readDeadline = t
+	close(pc.deadlineSet)
+	pc.deadlineSet = make(chan struct{})
+	return nil
+}
+
+func (pc *dropPacketConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,31 @@
+package outbound
+
+import (
+	"context"
+	"net"
+
+	"github.com/Dreamacro/clash/component/dialer"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+// RoutingMarkOption sets the SO_MARK of the sockets of a proxy on Linux, the
+// mark of the matched rule takes precedence and zero means the global mark
+type RoutingMarkOption struct {
+	RoutingMark int `proxy:"routing-mark,omitempty"`
+}
+
+func (b *Base) setRoutingMarkOption(option RoutingMarkOption) {
+	b.routingMark = option.RoutingMark
+}
+
+// routingMarkContext returns ctx with the routing mark of the rule matching
+// metadata, or the one of the proxy
+func (b *Base) routingMarkContext(ctx context.Context, metadata *C.Metadata) context.Context {
+	ctx = dialer.WithRoutingMark(ctx, metadata.RoutingMark)
+	return dialer.WithRoutingMark(ctx, b.routingMark)
+}
+
+// listenPacket listens the UDP socket of metadata with the routing mark
+func (b *Base) listenPacket(metadata *C.Metadata) (net.PacketConn, error) {
+	return dialer.ListenPacketContext(b.routingMarkContext(context.Background(), metadata), "udp", "")
+}
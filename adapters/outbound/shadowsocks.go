@@ -9,11 +9,13 @@ import (
 	"strconv"
 
 	"github.com/Dreamacro/clash/common/structure"
-	"github.com/Dreamacro/clash/component/dialer"
+	"github.com/Dreamacro/clash/component/shadowsocks2022"
+	"github.com/Dreamacro/clash/component/shadowtls"
 	obfs "github.com/Dreamacro/clash/component/simple-obfs"
 	"github.com/Dreamacro/clash/component/socks5"
 	v2rayObfs "github.com/Dreamacro/clash/component/v2ray-plugin"
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
 
 	"github.com/Dreamacro/go-shadowsocks2/core"
 )
@@ -26,6 +28,7 @@ type ShadowSocks struct {
 	obfsMode    string
 	obfsOption  *simpleObfsOption
 	v2rayOption *v2rayObfs.Option
+	shadowTLS   *shadowtls.Option
 }
 
 type ShadowSocksOption struct {
@@ -37,6 +40,8 @@ type ShadowSocksOption struct {
 	UDP        bool                   `proxy:"udp,omitempty"`
 	Plugin     string                 `proxy:"plugin,omitempty"`
 	PluginOpts map[string]interface{} `proxy:"plugin-opts,omitempty"`
+	// ClientFingerprint is applied to the shadow-tls plugin
+	ClientFingerprint string `proxy:"client-fingerprint,omitempty"`
 }
 
 type simpleObfsOption struct {
@@ -54,6 +59,13 @@ type v2rayObfsOption struct {
 	Mux            bool              `obfs:"mux,omitempty"`
 }
 
+type shadowTLSOption struct {
+	Host           string `obfs:"host"`
+	Password       string `obfs:"password"`
+	Version        int    `obfs:"version,omitempty"`
+	SkipCertVerify bool   `obfs:"skip-cert-verify,omitempty"`
+}
+
 func (ss *ShadowSocks) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 	switch ss.obfsMode {
 	case "tls":
@@ -67,6 +79,12 @@ func (ss *ShadowSocks) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, e
 		if err != nil {
 			return nil, fmt.Errorf("%s connect error: %w", ss.addr, err)
 		}
+	case "shadow-tls":
+		var err error
+		c, err = shadowtls.StreamConn(c, ss.shadowTLS)
+		if err != nil {
+			return nil, fmt.Errorf("%s connect error: %w", ss.addr, err)
+		}
 	}
 	c = ss.cipher.StreamConn(c)
 	_, err := c.Write(serializesSocksAddr(metadata))
@@ -74,18 +92,18 @@ func (ss *ShadowSocks) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, e
 }
 
 func (ss *ShadowSocks) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	c, err := dialer.DialContext(ctx, "tcp", ss.addr)
+	c, err := ss.dialContext(ctx, ss.addr)
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error: %w", ss.addr, err)
 	}
-	tcpKeepAlive(c)
+	ss.tcpKeepAlive(c)
 
 	c, err = ss.StreamConn(c, metadata)
 	return NewConn(c, ss), err
 }
 
 func (ss *ShadowSocks) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
-	pc, err := dialer.ListenPacket("udp", "")
+	pc, err := ss.listenPacket(metadata)
 	if err != nil {
 		return nil, err
 	}
@@ -109,17 +127,28 @@ func NewShadowSocks(option ShadowSocksOption) (*ShadowSocks, error) {
 	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
 	cipher := option.Cipher
 	password := option.Password
-	ciph, err := core.PickCipher(cipher, nil, password)
+
+	var ciph core.Cipher
+	var err error
+	if shadowsocks2022.IsMethod(cipher) {
+		ciph, err = shadowsocks2022.NewCipher(cipher, password)
+	} else {
+		ciph, err = core.PickCipher(cipher, nil, password)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("ss %s initialize error: %w", addr, err)
 	}
 
 	var v2rayOption *v2rayObfs.Option
 	var obfsOption *simpleObfsOption
+	var shadowTLSOpt *shadowtls.Option
 	obfsMode := ""
 
 	decoder := structure.NewDecoder(structure.Option{TagName: "obfs", WeaklyTypedInput: true})
-	if option.Plugin == "obfs" {
+	switch option.Plugin {
+	case "":
+	case "obfs", "obfs-local":
+		// obfs-local is the name of the simple-obfs plugin in SIP003
 		opts := simpleObfsOption{Host: "bing.com"}
 		if err := decoder.Decode(option.PluginOpts, &opts); err != nil {
 			return nil, fmt.Errorf("ss %s initialize obfs error: %w", addr, err)
@@ -130,7 +159,7 @@ func NewShadowSocks(option ShadowSocksOption) (*ShadowSocks, error) {
 		}
 		obfsMode = opts.Mode
 		obfsOption = &opts
-	} else if option.Plugin == "v2ray-plugin" {
+	case "v2ray-plugin":
 		opts := v2rayObfsOption{Host: "bing.com", Mux: true}
 		if err := decoder.Decode(option.PluginOpts, &opts); err != nil {
 			return nil, fmt.Errorf("ss %s initialize v2ray-plugin error: %w", addr, err)
@@ -152,6 +181,25 @@ func NewShadowSocks(option ShadowSocksOption) (*ShadowSocks, error) {
 			v2rayOption.SkipCertVerify = opts.SkipCertVerify
 			v2rayOption.SessionCache = getClientSessionCache()
 		}
+	case "shadow-tls":
+		opts := shadowTLSOption{}
+		if err := decoder.Decode(option.PluginOpts, &opts); err != nil {
+			return nil, fmt.Errorf("ss %s initialize shadow-tls error: %w", addr, err)
+		}
+
+		shadowTLSOpt, err = parseShadowTLSOption(ShadowTLSOptions{
+			Host:           opts.Host,
+			Password:       opts.Password,
+			Version:        opts.Version,
+			SkipCertVerify: opts.SkipCertVerify,
+		}, option.ClientFingerprint)
+		if err != nil {
+			return nil, fmt.Errorf("ss %s %w", addr, err)
+		}
+		obfsMode = option.Plugin
+	default:
+		// a subscription may have a plugin of other clients
+		log.Warnln("[ShadowSocks] %s unsupported plugin %s is ignored", option.Name, option.Plugin)
 	}
 
 	return &ShadowSocks{
@@ -166,6 +214,7 @@ func NewShadowSocks(option ShadowSocksOption) (*ShadowSocks, error) {
 		obfsMode:    obfsMode,
 		v2rayOption: v2rayOption,
 		obfsOption:  obfsOption,
+		shadowTLS:   shadowTLSOpt,
 	}, nil
 }
 
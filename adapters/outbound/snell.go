@@ -7,7 +7,6 @@ import (
 	"strconv"
 
 	"github.com/Dreamacro/clash/common/structure"
-	"github.com/Dreamacro/clash/component/dialer"
 	obfs "github.com/Dreamacro/clash/component/simple-obfs"
 	"github.com/Dreamacro/clash/component/snell"
 	C "github.com/Dreamacro/clash/constant"
@@ -27,6 +26,7 @@ type SnellOption struct {
 	Port     int                    `proxy:"port"`
 	Psk      string                 `proxy:"psk"`
 	Version  int                    `proxy:"version,omitempty"`
+	UDP      bool                   `proxy:"udp,omitempty"`
 	ObfsOpts map[string]interface{} `proxy:"obfs-opts,omitempty"`
 }
 
@@ -56,7 +56,7 @@ func (s *Snell) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 }
 
 func (s *Snell) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	if s.version == snell.Version2 {
+	if s.pool != nil {
 		c, err := s.pool.Get()
 		if err != nil {
 			return nil, err
@@ -67,16 +67,41 @@ func (s *Snell) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn,
 		return NewConn(c, s), err
 	}
 
-	c, err := dialer.DialContext(ctx, "tcp", s.addr)
+	c, err := s.dialContext(ctx, s.addr)
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error: %w", s.addr, err)
 	}
-	tcpKeepAlive(c)
+	s.tcpKeepAlive(c)
 
 	c, err = s.StreamConn(c, metadata)
 	return NewConn(c, s), err
 }
 
+func (s *Snell) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(s.routingMarkContext(context.Background(), metadata), tcpTimeout)
+	defer cancel()
+	c, err := s.dialContext(ctx, s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", s.addr, err)
+	}
+	s.tcpKeepAlive(c)
+
+	pc, err := s.StreamPacketConn(c, metadata)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return pc, nil
+}
+
+func (s *Snell) StreamPacketConn(c net.Conn, metadata *C.Metadata) (C.PacketConn, error) {
+	c = streamConn(c, streamOption{s.psk, s.version, s.addr, s.obfsOption})
+	if err := snell.WriteUDPHeader(c, s.version); err != nil {
+		return nil, err
+	}
+	return newPacketConn(snell.PacketConn(c), s), nil
+}
+
 func NewSnell(option SnellOption) (*Snell, error) {
 	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
 	psk := []byte(option.Psk)
@@ -87,37 +112,50 @@ func NewSnell(option SnellOption) (*Snell, error) {
 		return nil, fmt.Errorf("snell %s initialize obfs error: %w", addr, err)
 	}
 
-	if obfsOption.Mode != "tls" && obfsOption.Mode != "http" {
+	if len(psk) == 0 {
+		return nil, fmt.Errorf("snell %s psk is empty", addr)
+	}
+
+	// an empty mode means no obfs
+	if obfsOption.Mode != "" && obfsOption.Mode != "tls" && obfsOption.Mode != "http" {
 		return nil, fmt.Errorf("snell %s obfs mode error: %s", addr, obfsOption.Mode)
 	}
+	if obfsOption.Mode != "" && obfsOption.Host == "" {
+		return nil, fmt.Errorf("snell %s obfs host is empty", addr)
+	}
 
 	// backward compatible
 	if option.Version == 0 {
 		option.Version = snell.DefaultSnellVersion
 	}
-	if option.Version != snell.Version1 && option.Version != snell.Version2 {
+	if option.Version != snell.Version1 && option.Version != snell.Version2 && option.Version != snell.Version3 {
 		return nil, fmt.Errorf("snell version error: %d", option.Version)
 	}
+	if option.UDP && option.Version < snell.Version3 {
+		return nil, fmt.Errorf("snell version %d doesn't support UDP", option.Version)
+	}
 
 	s := &Snell{
 		Base: &Base{
 			name: option.Name,
 			addr: addr,
 			tp:   C.Snell,
+			udp:  option.UDP,
 		},
 		psk:        psk,
 		obfsOption: obfsOption,
 		version:    option.Version,
 	}
 
-	if option.Version == snell.Version2 {
+	// version2 and version3 reuse the connections
+	if option.Version != snell.Version1 {
 		s.pool = snell.NewPool(func(ctx context.Context) (*snell.Snell, error) {
-			c, err := dialer.DialContext(ctx, "tcp", addr)
+			c, err := s.dialContext(ctx, addr)
 			if err != nil {
 				return nil, err
 			}
 
-			tcpKeepAlive(c)
+			s.tcpKeepAlive(c)
 			return streamConn(c, streamOption{psk, option.Version, addr, obfsOption}), nil
 		})
 	}
@@ -0,0 +1,316 @@
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/singleflight"
+)
+
+type Ssh struct {
+	*Base
+	config *ssh.ClientConfig
+
+	mux    sync.Mutex
+	client *ssh.Client
+	group  singleflight.Group
+}
+
+type SshOption struct {
+	Name     string `proxy:"name"`
+	Server   string `proxy:"server"`
+	Port     int    `proxy:"port"`
+	UserName string `proxy:"username"`
+	Password string `proxy:"password,omitempty"`
+	// PrivateKey is a PEM encoded key or the path of the key file
+	PrivateKey           string `proxy:"private-key,omitempty"`
+	PrivateKeyPassphrase string `proxy:"private-key-passphrase,omitempty"`
+	// HostKey are the accepted public keys of the server in the authorized_keys format
+	HostKey           []string `proxy:"host-key,omitempty"`
+	SkipHostKeyVerify bool     `proxy:"skip-host-key-verify,omitempty"`
+}
+
+// StreamConn does the SSH handshake on c and opens a channel to the
+// destination, the SSH connection is closed with the channel
+func (s *Ssh) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
+	client, err := s.handshake(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := client.Dial("tcp", metadata.RemoteAddress())
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return newSshConn(ch, client), nil
+}
+
+func (s *Ssh) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	client, reused, err := s.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.dialChannel(ctx, client, metadata)
+	// the connection may have been broken, retry once on a new one
+	var openErr *ssh.OpenChannelError
+	if err != nil && reused && ctx.Err() == nil && !errors.As(err, &openErr) {
+		s.dropClient(client)
+		if client, _, err = s.getClient(ctx); err != nil {
+			return nil, err
+		}
+		c, err = s.dialChannel(ctx, client, metadata)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(c, s), nil
+}
+
+// dialChannel opens a direct-tcpip channel, a channel opening in progress
+// is closed if ctx is done
+func (s *Ssh) dialChannel(ctx context.Context, client *ssh.Client, metadata *C.Metadata) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		c, err := client.Dial("tcp", metadata.RemoteAddress())
+		ch <- result{c, err}
+	}()
+
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return nil, fmt.Errorf("%s open channel error: %w", s.addr, res.err)
+		}
+		return newSshConn(res.conn, nil), nil
+	case <-ctx.Done():
+		go func() {
+			if res := <-ch; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// getClient returns the shared SSH connection, it reconnects if the
+// connection is broken. The concurrent dials share one handshake, which
+// isn't bound to the ctx of any of them.
+func (s *Ssh) getClient(ctx context.Context) (client *ssh.Client, reused bool, err error) {
+	s.mux.Lock()
+	client = s.client
+	s.mux.Unlock()
+	if client != nil {
+		return client, true, nil
+	}
+
+	ch := s.group.DoChan("client", s.connect)
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, false, res.Err
+		}
+		return res.Val.(*ssh.Client), false, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+func (s *Ssh) connect() (interface{}, error) {
+	// the connection may have been set by the previous call
+	s.mux.Lock()
+	client := s.client
+	s.mux.Unlock()
+	if client != nil {
+		return client, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tcpTimeout)
+	defer cancel()
+
+	c, err := s.dialContext(ctx, s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", s.addr, err)
+	}
+	s.tcpKeepAlive(c)
+
+	c.SetDeadline(time.Now().Add(tcpTimeout))
+	client, err = s.handshake(c)
+	if err != nil {
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+
+	s.mux.Lock()
+	s.client = client
+	s.mux.Unlock()
+	go func() {
+		client.Wait()
+		s.dropClient(client)
+	}()
+	return client, nil
+}
+
+func (s *Ssh) dropClient(client *ssh.Client) {
+	s.mux.Lock()
+	if s.client == client {
+		s.client = nil
+	}
+	s.mux.Unlock()
+	client.Close()
+}
+
+func (s *Ssh) handshake(c net.Conn) (*ssh.Client, error) {
+	conn, chans, reqs, err := ssh.NewClientConn(c, s.addr, s.config)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("%s ssh handshake error: %w", s.addr, err)
+	}
+	return ssh.NewClient(conn, chans, reqs), nil
+}
+
+// sshConn is a direct-tcpip channel, it closes client if it isn't nil
+type sshConn struct {
+	net.Conn
+	client *ssh.Client
+
+	mux      sync.Mutex
+	deadline *time.Timer
+}
+
+func newSshConn(c net.Conn, client *ssh.Client) *sshConn {
+	return &sshConn{Conn: c, client: client}
+}
+
+func (c *sshConn) Close() error {
+	err := c.Conn.Close()
+	if c.client != nil {
+		c.client.Close()
+	}
+	return err
+}
+
+func (c *sshConn) SetReadDeadline(t time.Time) error  { return c.SetDeadline(t) }
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+// SetDeadline closes the channel when t is reached, the channel doesn't
+// support deadlines
+func (c *sshConn) SetDeadline(t time.Time) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.deadline != nil {
+		c.deadline.Stop()
+		c.deadline = nil
+	}
+
+	if t.IsZero() {
+		return nil
+	}
+
+	c.deadline = time.AfterFunc(time.Until(t), func() {
+		c.Close()
+	})
+	return nil
+}
+
+func parseSshPrivateKey(key, passphrase string) (ssh.Signer, error) {
+	buf := []byte(key)
+	if !strings.Contains(key, "PRIVATE KEY") {
+		var err error
+		if buf, err = ioutil.ReadFile(C.Path.Resolve(key)); err != nil {
+			return nil, err
+		}
+	}
+
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(buf, []byte(passphrase))
+	}
+	return ssh.ParsePrivateKey(buf)
+}
+
+func sshHostKeyCallback(option SshOption) (ssh.HostKeyCallback, []string, error) {
+	if len(option.HostKey) == 0 {
+		if !option.SkipHostKeyVerify {
+			return nil, nil, errors.New("host-key is required unless skip-host-key-verify is set")
+		}
+		return ssh.InsecureIgnoreHostKey(), nil, nil
+	}
+
+	keys := []ssh.PublicKey{}
+	algorithms := []string{}
+	for _, line := range option.HostKey {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid host-key %s: %w", line, err)
+		}
+		keys = append(keys, key)
+		algorithms = append(algorithms, key.Type())
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, k := range keys {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host key %s %s mismatch", key.Type(), ssh.FingerprintSHA256(key))
+	}, algorithms, nil
+}
+
+func NewSsh(option SshOption) (*Ssh, error) {
+	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
+
+	if option.UserName == "" {
+		return nil, fmt.Errorf("ssh %s username is empty", addr)
+	}
+
+	auths := []ssh.AuthMethod{}
+	if option.PrivateKey != "" {
+		signer, err := parseSshPrivateKey(option.PrivateKey, option.PrivateKeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("ssh %s private-key error: %w", addr, err)
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if option.Password != "" {
+		auths = append(auths, ssh.Password(option.Password))
+	}
+	if len(auths) == 0 {
+		return nil, fmt.Errorf("ssh %s password or private-key is required", addr)
+	}
+
+	hostKeyCallback, algorithms, err := sshHostKeyCallback(option)
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s %w", addr, err)
+	}
+
+	return &Ssh{
+		Base: &Base{
+			name: option.Name,
+			addr: addr,
+			tp:   C.Ssh,
+		},
+		config: &ssh.ClientConfig{
+			User:              option.UserName,
+			Auth:              auths,
+			HostKeyCallback:   hostKeyCallback,
+			HostKeyAlgorithms: algorithms,
+		},
+	}, nil
+}
@@ -0,0 +1,164 @@
+package outbound
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/dialer"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+
+	"go.uber.org/atomic"
+)
+
+const defaultKeepAliveInterval = 30 * time.Second
+
+var (
+	keepAliveInterval = atomic.NewDuration(defaultKeepAliveInterval)
+	idleTimeout       = atomic.NewDuration(0)
+)
+
+// TCPOption is the per-proxy TCP options, zero means the global value
+type TCPOption struct {
+	KeepAliveInterval int `proxy:"keep-alive-interval,omitempty"`
+	IdleTimeout       int `proxy:"idle-timeout,omitempty"`
+	// TCPFastOpen sends the first write in the SYN, which is the handshake of
+	// proxy protocols whose client speaks first (Shadowsocks, ShadowsocksR,
+	// Snell, Socks5, HTTP, VMess, VLESS and Trojan) or the TLS ClientHello. It
+	// is supported on Linux only and ignored elsewhere.
+	TCPFastOpen bool `proxy:"tcp-fast-open,omitempty"`
+}
+
+// SetTCPOptions sets the global keepalive interval and idle timeout of
+// outbound connections, zero idle timeout means connections never time out
+func SetTCPOptions(keepAlive, idle time.Duration) {
+	if keepAlive <= 0 {
+		keepAlive = defaultKeepAliveInterval
+	}
+	keepAliveInterval.Store(keepAlive)
+	idleTimeout.Store(idle)
+}
+
+// KeepAliveInterval returns the global TCP keepalive interval
+func KeepAliveInterval() time.Duration {
+	return keepAliveInterval.Load()
+}
+
+func (b *Base) setTCPOption(option TCPOption) {
+	b.keepAlive = time.Duration(option.KeepAliveInterval) * time.Second
+	b.idleTimeout = time.Duration(option.IdleTimeout) * time.Second
+	b.tfo = option.TCPFastOpen
+}
+
+// dialContext dials the TCP connection to addr with the TCP options of the proxy
+func (b *Base) dialContext(ctx context.Context, addr string) (net.Conn, error) {
+	if b.tfo {
+		ctx = dialer.WithTCPFastOpen(ctx)
+	}
+	return dialer.DialContext(dialer.WithRoutingMark(ctx, b.routingMark), "tcp", addr)
+}
+
+func (b *Base) tcpKeepAlive(c net.Conn) {
+	interval := b.keepAlive
+	if interval <= 0 {
+		interval = keepAliveInterval.Load()
+	}
+
+	if tcp, ok := c.(*net.TCPConn); ok {
+		tcp.SetKeepAlive(true)
+		tcp.SetKeepAlivePeriod(interval)
+	}
+}
+
+func (b *Base) connIdleTimeout() time.Duration {
+	if b.idleTimeout > 0 {
+		return b.idleTimeout
+	}
+	return idleTimeout.Load()
+}
+
+// errIdleTimeout is returned by the reads and writes of an idleConn closed for idle
+var errIdleTimeout net.Error = idleTimeoutError{}
+
+type idleTimeoutError struct{}
+
+func (idleTimeoutError) Error() string   { return "connection idle timeout" }
+func (idleTimeoutError) Timeout() bool   { return true }
+func (idleTimeoutError) Temporary() bool { return false }
+
+// idleConn closes the connection if there is no traffic in either direction
+// for timeout, so that the client notices and reconnects
+type idleConn struct {
+	net.Conn
+	timeout    time.Duration
+	lastActive *atomic.Int64
+	idled      *atomic.Bool
+
+	// mux guards the timer against Close, so it isn't re-armed after it
+	mux    sync.Mutex
+	timer  *time.Timer
+	closed bool
+}
+
+func newIdleConn(c net.Conn, a C.ProxyAdapter, timeout time.Duration) net.Conn {
+	ic := &idleConn{
+		Conn:       c,
+		timeout:    timeout,
+		lastActive: atomic.NewInt64(time.Now().UnixNano()),
+		idled:      atomic.NewBool(false),
+	}
+
+	ic.mux.Lock()
+	defer ic.mux.Unlock()
+	ic.timer = time.AfterFunc(timeout, func() {
+		ic.mux.Lock()
+		defer ic.mux.Unlock()
+		if ic.closed {
+			return
+		}
+
+		// re-arm the timer with the rest of timeout instead of resetting it on every read and write
+		idle := time.Since(time.Unix(0, ic.lastActive.Load()))
+		if idle < timeout {
+			ic.timer.Reset(timeout - idle)
+			return
+		}
+
+		log.Debugln("[%s] close %s idle for %s", a.Name(), c.RemoteAddr(), timeout)
+		ic.idled.Store(true)
+		c.Close()
+	})
+	return ic
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.lastActive.Store(time.Now().UnixNano())
+	}
+	if err != nil && c.idled.Load() {
+		err = errIdleTimeout
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.lastActive.Store(time.Now().UnixNano())
+	}
+	if err != nil && c.idled.Load() {
+		err = errIdleTimeout
+	}
+	return n, err
+}
+
+func (c *idleConn) Close() error {
+	c.mux.Lock()
+	c.closed = true
+	c.timer.Stop()
+	c.mux.Unlock()
+	return c.Conn.Close()
+}
@@ -2,34 +2,84 @@ package outbound
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
 	"strconv"
+	"time"
 
-	"github.com/Dreamacro/clash/component/dialer"
+	"github.com/Dreamacro/clash/component/gun"
+	"github.com/Dreamacro/clash/component/mux"
+	"github.com/Dreamacro/clash/component/shadowtls"
+	"github.com/Dreamacro/clash/component/socks5"
 	"github.com/Dreamacro/clash/component/trojan"
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+
+	"golang.org/x/net/http2"
 )
 
 type Trojan struct {
 	*Base
-	instance *trojan.Trojan
+	instance  *trojan.Trojan
+	shadowTLS *shadowtls.Option
+	mux       *mux.Client
+
+	// for gun mux
+	gunTLSConfig *tls.Config
+	gunConfig    *gun.Config
+	transport    *http2.Transport
 }
 
 type TrojanOption struct {
-	Name           string   `proxy:"name"`
-	Server         string   `proxy:"server"`
-	Port           int      `proxy:"port"`
-	Password       string   `proxy:"password"`
-	ALPN           []string `proxy:"alpn,omitempty"`
-	SNI            string   `proxy:"sni,omitempty"`
-	SkipCertVerify bool     `proxy:"skip-cert-verify,omitempty"`
-	UDP            bool     `proxy:"udp,omitempty"`
+	Name             string      `proxy:"name"`
+	Server           string      `proxy:"server"`
+	Port             int         `proxy:"port"`
+	Password         string      `proxy:"password"`
+	ALPN             []string    `proxy:"alpn,omitempty"`
+	SNI              string      `proxy:"sni,omitempty"`
+	SkipCertVerify   bool        `proxy:"skip-cert-verify,omitempty"`
+	UDP              bool        `proxy:"udp,omitempty"`
+	Fragment         bool        `proxy:"fragment,omitempty"`
+	FragmentPosition int         `proxy:"fragment-position,omitempty"`
+	FragmentDelay    int         `proxy:"fragment-delay,omitempty"`
+	Network          string      `proxy:"network,omitempty"`
+	GrpcOpts         GrpcOptions `proxy:"grpc-opts,omitempty"`
+	// ClientFingerprint is chrome, firefox, safari, ios or random, it isn't
+	// applied to the grpc network
+	ClientFingerprint string `proxy:"client-fingerprint,omitempty"`
+	TLSMinVersion     string `proxy:"tls-min-version,omitempty"`
+	// ShadowTLSOpts wraps the TLS of trojan in ShadowTLS, it isn't applied
+	// to the grpc network
+	ShadowTLSOpts ShadowTLSOptions `proxy:"shadow-tls-opts,omitempty"`
+	Smux          MuxOption        `proxy:"smux,omitempty"`
+}
+
+// ShadowTLSOptions is enabled if Host, the server name of the decoy handshake,
+// isn't empty. Version is 2 or 3.
+type ShadowTLSOptions struct {
+	Host           string `proxy:"host,omitempty"`
+	Password       string `proxy:"password,omitempty"`
+	Version        int    `proxy:"version,omitempty"`
+	SkipCertVerify bool   `proxy:"skip-cert-verify,omitempty"`
+}
+
+func (t *Trojan) plainStream(c net.Conn) (net.Conn, error) {
+	if t.gunConfig != nil {
+		return gun.StreamGunWithConn(c, t.gunTLSConfig, t.gunConfig)
+	}
+	if t.shadowTLS != nil {
+		var err error
+		if c, err = shadowtls.StreamConn(c, t.shadowTLS); err != nil {
+			return nil, err
+		}
+	}
+	return t.instance.StreamConn(c)
 }
 
 func (t *Trojan) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
-	c, err := t.instance.StreamConn(c)
+	c, err := t.plainStream(c)
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error: %w", t.addr, err)
 	}
@@ -39,28 +89,96 @@ func (t *Trojan) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error)
 }
 
 func (t *Trojan) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	c, err := dialer.DialContext(ctx, "tcp", t.addr)
-	if err != nil {
-		return nil, fmt.Errorf("%s connect error: %w", t.addr, err)
+	if t.mux != nil {
+		c, err := t.mux.DialContext(ctx, socks5.Addr(serializesSocksAddr(metadata)))
+		if err != nil {
+			return nil, fmt.Errorf("%s mux connect error: %w", t.addr, err)
+		}
+		return NewConn(c, t), nil
 	}
-	tcpKeepAlive(c)
-	c, err = t.StreamConn(c, metadata)
+
+	c, err := t.dialConn(ctx, metadata)
 	if err != nil {
 		return nil, err
 	}
+	return NewConn(c, t), nil
+}
+
+// dialConn returns the trojan connection to metadata without the mux
+func (t *Trojan) dialConn(ctx context.Context, metadata *C.Metadata) (net.Conn, error) {
+	// gun transport
+	if t.transport != nil {
+		c, err := gun.StreamGunWithTransport(t.transport, t.gunConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = t.instance.WriteHeader(c, trojan.CommandTCP, serializesSocksAddr(metadata)); err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		return c, nil
+	}
+
+	c, err := t.dialContext(ctx, t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", t.addr, err)
+	}
+	t.tcpKeepAlive(c)
+	return t.StreamConn(c, metadata)
+}
 
-	return NewConn(c, t), err
+// Close closes the mux sessions, the idle sessions are closed after the
+// idle timeout too
+func (t *Trojan) Close() error {
+	if t.mux != nil {
+		return t.mux.Close()
+	}
+	return nil
 }
 
 func (t *Trojan) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), tcpTimeout)
-	defer cancel()
-	c, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if t.mux != nil {
+		ctx, cancel := context.WithTimeout(t.routingMarkContext(context.Background(), metadata), tcpTimeout)
+		defer cancel()
+		pc, err := t.mux.ListenPacket(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s mux connect error: %w", t.addr, err)
+		}
+		return newPacketConn(pc, t), nil
+	}
+
+	var c net.Conn
+	var err error
+	// gun transport
+	if t.transport != nil {
+		c, err = gun.StreamGunWithTransport(t.transport, t.gunConfig)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(t.routingMarkContext(context.Background(), metadata), tcpTimeout)
+		defer cancel()
+		c, err = t.dialContext(ctx, t.addr)
+		if err != nil {
+			return nil, fmt.Errorf("%s connect error: %w", t.addr, err)
+		}
+		t.tcpKeepAlive(c)
+		return t.StreamPacketConn(c, metadata)
+	}
+
+	err = t.instance.WriteHeader(c, trojan.CommandUDP, serializesSocksAddr(metadata))
 	if err != nil {
-		return nil, fmt.Errorf("%s connect error: %w", t.addr, err)
+		return nil, err
 	}
-	tcpKeepAlive(c)
-	c, err = t.instance.StreamConn(c)
+
+	pc := t.instance.PacketConn(c)
+	return newPacketConn(pc, t), err
+}
+
+func (t *Trojan) StreamPacketConn(c net.Conn, metadata *C.Metadata) (C.PacketConn, error) {
+	c, err := t.plainStream(c)
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error: %w", t.addr, err)
 	}
@@ -95,7 +213,24 @@ func NewTrojan(option TrojanOption) (*Trojan, error) {
 		tOption.ServerName = option.SNI
 	}
 
-	return &Trojan{
+	fingerprint, minVersion, err := parseTLSOption(option.ClientFingerprint, option.TLSMinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("trojan %s %w", addr, err)
+	}
+	tOption.Fingerprint = fingerprint
+	tOption.MinVersion = minVersion
+
+	if option.Fragment {
+		if option.FragmentPosition < 0 {
+			return nil, fmt.Errorf("trojan %s invalid fragment-position: %d", addr, option.FragmentPosition)
+		}
+		tOption.Fragment = &trojan.FragmentOption{
+			Position: option.FragmentPosition,
+			Delay:    time.Duration(option.FragmentDelay) * time.Millisecond,
+		}
+	}
+
+	t := &Trojan{
 		Base: &Base{
 			name: option.Name,
 			addr: addr,
@@ -103,5 +238,44 @@ func NewTrojan(option TrojanOption) (*Trojan, error) {
 			udp:  option.UDP,
 		},
 		instance: trojan.New(tOption),
-	}, nil
+	}
+
+	if option.ShadowTLSOpts.Host != "" {
+		t.shadowTLS, err = parseShadowTLSOption(option.ShadowTLSOpts, option.ClientFingerprint)
+		if err != nil {
+			return nil, fmt.Errorf("trojan %s %w", addr, err)
+		}
+	}
+
+	switch option.Network {
+	case "", "tcp":
+	case "grpc":
+		if fingerprint != nil {
+			log.Warnln("[Trojan] %s client-fingerprint is ignored with grpc network", option.Name)
+		}
+		t.gunConfig = &gun.Config{
+			ServiceName: option.GrpcOpts.GrpcServiceName,
+			Host:        tOption.ServerName,
+		}
+
+		if minVersion == 0 {
+			minVersion = tls.VersionTLS12
+		}
+		t.gunTLSConfig = &tls.Config{
+			NextProtos:         []string{"h2"},
+			MinVersion:         minVersion,
+			InsecureSkipVerify: tOption.SkipCertVerify,
+			ServerName:         tOption.ServerName,
+			ClientSessionCache: tOption.ClientSessionCache,
+		}
+		t.transport = newGunTransport(addr, t.gunTLSConfig, t.Base)
+	default:
+		return nil, fmt.Errorf("unsupported trojan network: %s", option.Network)
+	}
+
+	if t.mux, err = newMuxClient(option.Smux, t.dialConn); err != nil {
+		return nil, fmt.Errorf("trojan %s %w", addr, err)
+	}
+
+	return t, nil
 }
@@ -0,0 +1,25 @@
+package outbound
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTrojan_FragmentPosition(t *testing.T) {
+	option := TrojanOption{
+		Name:             "trojan",
+		Server:           "127.0.0.1",
+		Port:             443,
+		Password:         "password",
+		Fragment:         true,
+		FragmentPosition: -1,
+	}
+
+	_, err := NewTrojan(option)
+	assert.NotNil(t, err)
+
+	option.FragmentPosition = 3
+	_, err = NewTrojan(option)
+	assert.Nil(t, err)
+}
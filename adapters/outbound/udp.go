@@ -0,0 +1,37 @@
+package outbound
+
+import (
+	"fmt"
+	"net"
+)
+
+// UDPOption is the per-proxy UDP options
+type UDPOption struct {
+	// MaxDatagramSize limits the payload of the UDP packets sent by the proxy,
+	// the larger packets are dropped instead of being fragmented on the way,
+	// including the proxies relaying UDP over TCP. Zero means no limit.
+	MaxDatagramSize int `proxy:"max-datagram-size,omitempty"`
+}
+
+func (b *Base) setUDPOption(option UDPOption) {
+	b.maxDatagramSize = option.MaxDatagramSize
+}
+
+// datagramLimit is the max size of the packets written to the packet conns
+// of the proxy, zero means no limit
+func (b *Base) datagramLimit() int {
+	return b.maxDatagramSize
+}
+
+// limitedPacketConn drops the packets larger than size
+type limitedPacketConn struct {
+	net.PacketConn
+	size int
+}
+
+func (c *limitedPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if len(b) > c.size {
+		return 0, fmt.Errorf("packet of %d bytes exceeds max-datagram-size %d", len(b), c.size)
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
@@ -2,7 +2,9 @@ package outbound
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
@@ -10,9 +12,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Dreamacro/clash/component/gun"
 	"github.com/Dreamacro/clash/component/resolver"
+	"github.com/Dreamacro/clash/component/shadowtls"
 	"github.com/Dreamacro/clash/component/socks5"
+	tlsC "github.com/Dreamacro/clash/component/tls"
 	C "github.com/Dreamacro/clash/constant"
+
+	"golang.org/x/net/http2"
 )
 
 const (
@@ -52,11 +59,62 @@ func urlToMetadata(rawURL string) (addr C.Metadata, err error) {
 	return
 }
 
-func tcpKeepAlive(c net.Conn) {
-	if tcp, ok := c.(*net.TCPConn); ok {
-		tcp.SetKeepAlive(true)
-		tcp.SetKeepAlivePeriod(30 * time.Second)
+// newGunTransport returns a HTTP/2 transport to addr shared by the gRPC streams of a proxy
+func newGunTransport(addr string, tlsConfig *tls.Config, b *Base) *http2.Transport {
+	dialFn := func(network, _ string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), tcpTimeout)
+		defer cancel()
+		c, err := b.dialContext(ctx, addr)
+		if err != nil {
+			return nil, fmt.Errorf("%s connect error: %w", addr, err)
+		}
+		b.tcpKeepAlive(c)
+		return c, nil
 	}
+
+	return gun.NewHTTP2Client(dialFn, tlsConfig)
+}
+
+// parseTLSOption parses client-fingerprint and tls-min-version of a proxy
+func parseTLSOption(fingerprint, minVersion string) (*tlsC.Fingerprint, uint16, error) {
+	fp, err := tlsC.ParseFingerprint(fingerprint)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	version, err := tlsC.ParseVersion(minVersion)
+	if err != nil {
+		return nil, 0, err
+	}
+	return fp, version, nil
+}
+
+// parseShadowTLSOption validates the ShadowTLS option, version 2 is the default
+func parseShadowTLSOption(option ShadowTLSOptions, fingerprint string) (*shadowtls.Option, error) {
+	if option.Host == "" || option.Password == "" {
+		return nil, errors.New("shadow-tls host and password are required")
+	}
+
+	version := option.Version
+	if version == 0 {
+		version = 2
+	}
+	if version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported shadow-tls version: %d", version)
+	}
+
+	fp, err := tlsC.ParseFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &shadowtls.Option{
+		Host:           option.Host,
+		Password:       option.Password,
+		Version:        version,
+		SkipCertVerify: option.SkipCertVerify,
+		Fingerprint:    fp,
+	}, nil
 }
 
 func getClientSessionCache() tls.ClientSessionCache {
@@ -0,0 +1,265 @@
+package outbound
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/Dreamacro/clash/component/gun"
+	"github.com/Dreamacro/clash/component/resolver"
+	tlsC "github.com/Dreamacro/clash/component/tls"
+	"github.com/Dreamacro/clash/component/vless"
+	"github.com/Dreamacro/clash/component/vmess"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+
+	"golang.org/x/net/http2"
+)
+
+type Vless struct {
+	*Base
+	client *vless.Client
+	option *VlessOption
+
+	fingerprint   *tlsC.Fingerprint
+	tlsMinVersion uint16
+
+	// for gun mux
+	gunTLSConfig *tls.Config
+	gunConfig    *gun.Config
+	transport    *http2.Transport
+}
+
+// VlessOption is the option of a vless proxy, the flow must be empty since the
+// xtls flows such as xtls-rprx-vision aren't supported
+type VlessOption struct {
+	Name           string      `proxy:"name"`
+	Server         string      `proxy:"server"`
+	Port           int         `proxy:"port"`
+	UUID           string      `proxy:"uuid"`
+	Flow           string      `proxy:"flow,omitempty"`
+	TLS            bool        `proxy:"tls,omitempty"`
+	UDP            bool        `proxy:"udp,omitempty"`
+	Network        string      `proxy:"network,omitempty"`
+	WSOpts         WSOptions   `proxy:"ws-opts,omitempty"`
+	GrpcOpts       GrpcOptions `proxy:"grpc-opts,omitempty"`
+	SkipCertVerify bool        `proxy:"skip-cert-verify,omitempty"`
+	ServerName     string      `proxy:"servername,omitempty"`
+	// ClientFingerprint is chrome, firefox, safari, ios or random, it isn't
+	// applied to the grpc network
+	ClientFingerprint string `proxy:"client-fingerprint,omitempty"`
+	TLSMinVersion     string `proxy:"tls-min-version,omitempty"`
+}
+
+func (v *Vless) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
+	var err error
+	switch v.option.Network {
+	case "ws":
+		host, port, _ := net.SplitHostPort(v.addr)
+		wsOpts := &vmess.WebsocketConfig{
+			Host: host,
+			Port: port,
+			Path: v.option.WSOpts.Path,
+
+			MaxEarlyData:        v.option.WSOpts.MaxEarlyData,
+			EarlyDataHeaderName: v.option.WSOpts.EarlyDataHeaderName,
+		}
+
+		if len(v.option.WSOpts.Headers) != 0 {
+			header := http.Header{}
+			for key, value := range v.option.WSOpts.Headers {
+				header.Add(key, value)
+			}
+			wsOpts.Headers = header
+		}
+
+		if v.option.TLS {
+			wsOpts.TLS = true
+			wsOpts.SessionCache = getClientSessionCache()
+			wsOpts.SkipCertVerify = v.option.SkipCertVerify
+			wsOpts.ServerName = v.option.ServerName
+			wsOpts.Fingerprint = v.fingerprint
+			wsOpts.MinVersion = v.tlsMinVersion
+		}
+		c, err = vmess.StreamWebsocketConn(c, wsOpts)
+	case "grpc":
+		c, err = gun.StreamGunWithConn(c, v.gunTLSConfig, v.gunConfig)
+	default:
+		// handle TLS
+		if v.option.TLS {
+			host, _, _ := net.SplitHostPort(v.addr)
+			tlsOpts := &vmess.TLSConfig{
+				Host:           host,
+				SkipCertVerify: v.option.SkipCertVerify,
+				SessionCache:   getClientSessionCache(),
+				Fingerprint:    v.fingerprint,
+				MinVersion:     v.tlsMinVersion,
+			}
+
+			if v.option.ServerName != "" {
+				tlsOpts.Host = v.option.ServerName
+			}
+
+			c, err = vmess.StreamTLSConn(c, tlsOpts)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return v.client.StreamConn(c, parseVlessAddr(metadata))
+}
+
+func (v *Vless) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	// gun transport
+	if v.transport != nil {
+		c, err := gun.StreamGunWithTransport(v.transport, v.gunConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err = v.client.StreamConn(c, parseVlessAddr(metadata))
+		if err != nil {
+			return nil, err
+		}
+
+		return NewConn(c, v), nil
+	}
+
+	c, err := v.dialContext(ctx, v.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
+	}
+	v.tcpKeepAlive(c)
+
+	c, err = v.StreamConn(c, metadata)
+	return NewConn(c, v), err
+}
+
+func (v *Vless) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
+	// vless use stream-oriented udp with a fixed destination, so clash needs a net.UDPAddr
+	if !metadata.Resolved() {
+		ip, err := resolver.ResolveIP(metadata.Host)
+		if err != nil {
+			return nil, errors.New("can't resolve ip")
+		}
+		metadata.DstIP = ip
+	}
+
+	var c net.Conn
+	var err error
+	// gun transport
+	if v.transport != nil {
+		c, err = gun.StreamGunWithTransport(v.transport, v.gunConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err = v.client.StreamConn(c, parseVlessAddr(metadata))
+		if err != nil {
+			return nil, fmt.Errorf("new vless client error: %v", err)
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(v.routingMarkContext(context.Background(), metadata), tcpTimeout)
+		defer cancel()
+		c, err = v.dialContext(ctx, v.addr)
+		if err != nil {
+			return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
+		}
+		v.tcpKeepAlive(c)
+		return v.StreamPacketConn(c, metadata)
+	}
+	return newPacketConn(vless.NewPacketConn(c, metadata.UDPAddr()), v), nil
+}
+
+func (v *Vless) StreamPacketConn(c net.Conn, metadata *C.Metadata) (C.PacketConn, error) {
+	if !metadata.Resolved() {
+		ip, err := resolver.ResolveIP(metadata.Host)
+		if err != nil {
+			return nil, errors.New("can't resolve ip")
+		}
+		metadata.DstIP = ip
+	}
+
+	c, err := v.StreamConn(c, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("new vless client error: %v", err)
+	}
+	return newPacketConn(vless.NewPacketConn(c, metadata.UDPAddr()), v), nil
+}
+
+func NewVless(option VlessOption) (*Vless, error) {
+	if option.Flow != "" {
+		return nil, fmt.Errorf("unsupported vless flow: %s, only the plain vless is supported", option.Flow)
+	}
+
+	switch option.Network {
+	case "", "tcp", "ws":
+	case "grpc":
+		if !option.TLS {
+			return nil, fmt.Errorf("TLS must be true with grpc network")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported vless network: %s", option.Network)
+	}
+
+	client, err := vless.NewClient(option.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Vless{
+		Base: &Base{
+			name: option.Name,
+			addr: net.JoinHostPort(option.Server, strconv.Itoa(option.Port)),
+			tp:   C.Vless,
+			udp:  option.UDP,
+		},
+		client: client,
+		option: &option,
+	}
+
+	if v.fingerprint, v.tlsMinVersion, err = parseTLSOption(option.ClientFingerprint, option.TLSMinVersion); err != nil {
+		return nil, fmt.Errorf("vless %s %w", v.addr, err)
+	}
+	if v.fingerprint != nil && option.Network == "grpc" {
+		log.Warnln("[VLESS] %s client-fingerprint is ignored with grpc network", option.Name)
+	}
+
+	if option.Network == "grpc" {
+		v.gunConfig = &gun.Config{
+			ServiceName: option.GrpcOpts.GrpcServiceName,
+			Host:        option.ServerName,
+		}
+		if v.gunConfig.Host == "" {
+			v.gunConfig.Host = option.Server
+		}
+
+		v.gunTLSConfig = &tls.Config{
+			InsecureSkipVerify: option.SkipCertVerify,
+			ServerName:         v.gunConfig.Host,
+			ClientSessionCache: getClientSessionCache(),
+			NextProtos:         []string{"h2"},
+			MinVersion:         v.tlsMinVersion,
+		}
+		v.transport = newGunTransport(v.addr, v.gunTLSConfig, v.Base)
+	}
+
+	return v, nil
+}
+
+// vless shares the address format of vmess
+func parseVlessAddr(metadata *C.Metadata) *vless.DstAddr {
+	addr := parseVmessAddr(metadata)
+	return &vless.DstAddr{
+		UDP:      addr.UDP,
+		AddrType: addr.AddrType,
+		Addr:     addr.Addr,
+		Port:     addr.Port,
+	}
+}
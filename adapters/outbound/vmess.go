@@ -2,6 +2,7 @@ package outbound
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -9,34 +10,57 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/Dreamacro/clash/component/dialer"
+	"github.com/Dreamacro/clash/component/gun"
+	"github.com/Dreamacro/clash/component/mux"
 	"github.com/Dreamacro/clash/component/resolver"
+	"github.com/Dreamacro/clash/component/socks5"
+	tlsC "github.com/Dreamacro/clash/component/tls"
 	"github.com/Dreamacro/clash/component/vmess"
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+
+	"golang.org/x/net/http2"
 )
 
 type Vmess struct {
 	*Base
 	client *vmess.Client
 	option *VmessOption
+
+	fingerprint   *tlsC.Fingerprint
+	tlsMinVersion uint16
+	mux           *mux.Client
+
+	// for gun mux
+	gunTLSConfig *tls.Config
+	gunConfig    *gun.Config
+	transport    *http2.Transport
 }
 
 type VmessOption struct {
-	Name           string            `proxy:"name"`
-	Server         string            `proxy:"server"`
-	Port           int               `proxy:"port"`
-	UUID           string            `proxy:"uuid"`
-	AlterID        int               `proxy:"alterId"`
-	Cipher         string            `proxy:"cipher"`
-	TLS            bool              `proxy:"tls,omitempty"`
-	UDP            bool              `proxy:"udp,omitempty"`
-	Network        string            `proxy:"network,omitempty"`
-	HTTPOpts       HTTPOptions       `proxy:"http-opts,omitempty"`
-	HTTP2Opts      HTTP2Options      `proxy:"h2-opts,omitempty"`
-	WSPath         string            `proxy:"ws-path,omitempty"`
-	WSHeaders      map[string]string `proxy:"ws-headers,omitempty"`
-	SkipCertVerify bool              `proxy:"skip-cert-verify,omitempty"`
-	ServerName     string            `proxy:"servername,omitempty"`
+	Name                string            `proxy:"name"`
+	Server              string            `proxy:"server"`
+	Port                int               `proxy:"port"`
+	UUID                string            `proxy:"uuid"`
+	AlterID             int               `proxy:"alterId"`
+	Cipher              string            `proxy:"cipher"`
+	TLS                 bool              `proxy:"tls,omitempty"`
+	UDP                 bool              `proxy:"udp,omitempty"`
+	Network             string            `proxy:"network,omitempty"`
+	HTTPOpts            HTTPOptions       `proxy:"http-opts,omitempty"`
+	HTTP2Opts           HTTP2Options      `proxy:"h2-opts,omitempty"`
+	GrpcOpts            GrpcOptions       `proxy:"grpc-opts,omitempty"`
+	WSOpts              WSOptions         `proxy:"ws-opts,omitempty"`
+	WSPath              string            `proxy:"ws-path,omitempty"`
+	WSHeaders           map[string]string `proxy:"ws-headers,omitempty"`
+	SkipCertVerify      bool              `proxy:"skip-cert-verify,omitempty"`
+	ServerName          string            `proxy:"servername,omitempty"`
+	AuthenticatedLength bool              `proxy:"authenticated-length,omitempty"`
+	// ClientFingerprint is chrome, firefox, safari, ios or random, it isn't
+	// applied to the grpc network
+	ClientFingerprint string    `proxy:"client-fingerprint,omitempty"`
+	TLSMinVersion     string    `proxy:"tls-min-version,omitempty"`
+	Smux              MuxOption `proxy:"smux,omitempty"`
 }
 
 type HTTPOptions struct {
@@ -50,6 +74,17 @@ type HTTP2Options struct {
 	Path string   `proxy:"path,omitempty"`
 }
 
+type WSOptions struct {
+	Path                string            `proxy:"path,omitempty"`
+	Headers             map[string]string `proxy:"headers,omitempty"`
+	MaxEarlyData        int               `proxy:"max-early-data,omitempty"`
+	EarlyDataHeaderName string            `proxy:"early-data-header-name,omitempty"`
+}
+
+type GrpcOptions struct {
+	GrpcServiceName string `proxy:"grpc-service-name,omitempty"`
+}
+
 func (v *Vmess) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 	var err error
 	switch v.option.Network {
@@ -58,14 +93,25 @@ func (v *Vmess) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 		wsOpts := &vmess.WebsocketConfig{
 			Host: host,
 			Port: port,
-			Path: v.option.WSPath,
+			Path: v.option.WSOpts.Path,
+
+			MaxEarlyData:        v.option.WSOpts.MaxEarlyData,
+			EarlyDataHeaderName: v.option.WSOpts.EarlyDataHeaderName,
+		}
+
+		// ws-path and ws-headers are kept for compatibility, ws-opts takes precedence
+		if wsOpts.Path == "" {
+			wsOpts.Path = v.option.WSPath
 		}
 
-		if len(v.option.WSHeaders) != 0 {
+		if len(v.option.WSHeaders) != 0 || len(v.option.WSOpts.Headers) != 0 {
 			header := http.Header{}
 			for key, value := range v.option.WSHeaders {
 				header.Add(key, value)
 			}
+			for key, value := range v.option.WSOpts.Headers {
+				header.Set(key, value)
+			}
 			wsOpts.Headers = header
 		}
 
@@ -74,6 +120,8 @@ func (v *Vmess) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 			wsOpts.SessionCache = getClientSessionCache()
 			wsOpts.SkipCertVerify = v.option.SkipCertVerify
 			wsOpts.ServerName = v.option.ServerName
+			wsOpts.Fingerprint = v.fingerprint
+			wsOpts.MinVersion = v.tlsMinVersion
 		}
 		c, err = vmess.StreamWebsocketConn(c, wsOpts)
 	case "http":
@@ -84,6 +132,8 @@ func (v *Vmess) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 				Host:           host,
 				SkipCertVerify: v.option.SkipCertVerify,
 				SessionCache:   getClientSessionCache(),
+				Fingerprint:    v.fingerprint,
+				MinVersion:     v.tlsMinVersion,
 			}
 
 			if v.option.ServerName != "" {
@@ -112,6 +162,8 @@ func (v *Vmess) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 			SkipCertVerify: v.option.SkipCertVerify,
 			SessionCache:   getClientSessionCache(),
 			NextProtos:     []string{"h2"},
+			Fingerprint:    v.fingerprint,
+			MinVersion:     v.tlsMinVersion,
 		}
 
 		if v.option.ServerName != "" {
@@ -129,6 +181,8 @@ func (v *Vmess) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 		}
 
 		c, err = vmess.StreamH2Conn(c, h2Opts)
+	case "grpc":
+		c, err = gun.StreamGunWithConn(c, v.gunTLSConfig, v.gunConfig)
 	default:
 		// handle TLS
 		if v.option.TLS {
@@ -137,6 +191,8 @@ func (v *Vmess) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 				Host:           host,
 				SkipCertVerify: v.option.SkipCertVerify,
 				SessionCache:   getClientSessionCache(),
+				Fingerprint:    v.fingerprint,
+				MinVersion:     v.tlsMinVersion,
 			}
 
 			if v.option.ServerName != "" {
@@ -155,17 +211,59 @@ func (v *Vmess) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 }
 
 func (v *Vmess) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	c, err := dialer.DialContext(ctx, "tcp", v.addr)
+	if v.mux != nil {
+		c, err := v.mux.DialContext(ctx, socks5.Addr(serializesSocksAddr(metadata)))
+		if err != nil {
+			return nil, fmt.Errorf("%s mux connect error: %w", v.addr, err)
+		}
+		return NewConn(c, v), nil
+	}
+
+	c, err := v.dialConn(ctx, metadata)
+	return NewConn(c, v), err
+}
+
+// dialConn returns the vmess connection to metadata without the mux
+func (v *Vmess) dialConn(ctx context.Context, metadata *C.Metadata) (net.Conn, error) {
+	// gun transport
+	if v.transport != nil {
+		c, err := gun.StreamGunWithTransport(v.transport, v.gunConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return v.client.StreamConn(c, parseVmessAddr(metadata))
+	}
+
+	c, err := v.dialContext(ctx, v.addr)
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
 	}
-	tcpKeepAlive(c)
+	v.tcpKeepAlive(c)
 
-	c, err = v.StreamConn(c, metadata)
-	return NewConn(c, v), err
+	return v.StreamConn(c, metadata)
+}
+
+// Close closes the mux sessions, the idle sessions are closed after the
+// idle timeout too
+func (v *Vmess) Close() error {
+	if v.mux != nil {
+		return v.mux.Close()
+	}
+	return nil
 }
 
 func (v *Vmess) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
+	if v.mux != nil {
+		ctx, cancel := context.WithTimeout(v.routingMarkContext(context.Background(), metadata), tcpTimeout)
+		defer cancel()
+		pc, err := v.mux.ListenPacket(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s mux connect error: %w", v.addr, err)
+		}
+		return newPacketConn(pc, v), nil
+	}
+
 	// vmess use stream-oriented udp, so clash needs a net.UDPAddr
 	if !metadata.Resolved() {
 		ip, err := resolver.ResolveIP(metadata.Host)
@@ -175,14 +273,42 @@ func (v *Vmess) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
 		metadata.DstIP = ip
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), tcpTimeout)
-	defer cancel()
-	c, err := dialer.DialContext(ctx, "tcp", v.addr)
-	if err != nil {
-		return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
+	var c net.Conn
+	var err error
+	// gun transport
+	if v.transport != nil {
+		c, err = gun.StreamGunWithTransport(v.transport, v.gunConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err = v.client.StreamConn(c, parseVmessAddr(metadata))
+		if err != nil {
+			return nil, fmt.Errorf("new vmess client error: %v", err)
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(v.routingMarkContext(context.Background(), metadata), tcpTimeout)
+		defer cancel()
+		c, err = v.dialContext(ctx, v.addr)
+		if err != nil {
+			return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
+		}
+		v.tcpKeepAlive(c)
+		return v.StreamPacketConn(c, metadata)
+	}
+	return newPacketConn(&vmessPacketConn{Conn: c, rAddr: metadata.UDPAddr()}, v), nil
+}
+
+func (v *Vmess) StreamPacketConn(c net.Conn, metadata *C.Metadata) (C.PacketConn, error) {
+	if !metadata.Resolved() {
+		ip, err := resolver.ResolveIP(metadata.Host)
+		if err != nil {
+			return nil, errors.New("can't resolve ip")
+		}
+		metadata.DstIP = ip
 	}
-	tcpKeepAlive(c)
-	c, err = v.StreamConn(c, metadata)
+
+	c, err := v.StreamConn(c, metadata)
 	if err != nil {
 		return nil, fmt.Errorf("new vmess client error: %v", err)
 	}
@@ -197,15 +323,23 @@ func NewVmess(option VmessOption) (*Vmess, error) {
 		Security: security,
 		HostName: option.Server,
 		Port:     strconv.Itoa(option.Port),
+
+		AuthenticatedLength: option.AuthenticatedLength,
 	})
 	if err != nil {
 		return nil, err
 	}
-	if option.Network == "h2" && !option.TLS {
-		return nil, fmt.Errorf("TLS must be true with h2 network")
+	if option.AlterID != 0 {
+		log.Warnln("[VMess] %s uses the legacy MD5 header with alterId %d, which is deprecated, set alterId to 0 to use AEAD", option.Name, option.AlterID)
+	}
+	switch option.Network {
+	case "h2", "grpc":
+		if !option.TLS {
+			return nil, fmt.Errorf("TLS must be true with h2/grpc network")
+		}
 	}
 
-	return &Vmess{
+	v := &Vmess{
 		Base: &Base{
 			name: option.Name,
 			addr: net.JoinHostPort(option.Server, strconv.Itoa(option.Port)),
@@ -214,7 +348,39 @@ func NewVmess(option VmessOption) (*Vmess, error) {
 		},
 		client: client,
 		option: &option,
-	}, nil
+	}
+
+	if v.fingerprint, v.tlsMinVersion, err = parseTLSOption(option.ClientFingerprint, option.TLSMinVersion); err != nil {
+		return nil, fmt.Errorf("vmess %s %w", v.addr, err)
+	}
+	if v.fingerprint != nil && option.Network == "grpc" {
+		log.Warnln("[VMess] %s client-fingerprint is ignored with grpc network", option.Name)
+	}
+
+	if option.Network == "grpc" {
+		v.gunConfig = &gun.Config{
+			ServiceName: option.GrpcOpts.GrpcServiceName,
+			Host:        option.ServerName,
+		}
+		if v.gunConfig.Host == "" {
+			v.gunConfig.Host = option.Server
+		}
+
+		v.gunTLSConfig = &tls.Config{
+			InsecureSkipVerify: option.SkipCertVerify,
+			ServerName:         v.gunConfig.Host,
+			ClientSessionCache: getClientSessionCache(),
+			NextProtos:         []string{"h2"},
+			MinVersion:         v.tlsMinVersion,
+		}
+		v.transport = newGunTransport(v.addr, v.gunTLSConfig, v.Base)
+	}
+
+	if v.mux, err = newMuxClient(option.Smux, v.dialConn); err != nil {
+		return nil, fmt.Errorf("vmess %s %w", v.addr, err)
+	}
+
+	return v, nil
 }
 
 func parseVmessAddr(metadata *C.Metadata) *vmess.DstAddr {
@@ -0,0 +1,211 @@
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+
+	"github.com/Dreamacro/clash/component/resolver"
+	"github.com/Dreamacro/clash/component/wireguard"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+type WireGuard struct {
+	*Base
+	server string
+	port   int
+	config wireguard.Config
+
+	mux    sync.Mutex
+	tunnel *wireguard.Tunnel
+}
+
+type WireGuardOption struct {
+	Name   string `proxy:"name"`
+	Server string `proxy:"server"`
+	Port   int    `proxy:"port"`
+	// IP and IPv6 are the addresses of the local interface in the tunnel
+	IP           string `proxy:"ip,omitempty"`
+	IPv6         string `proxy:"ipv6,omitempty"`
+	PrivateKey   string `proxy:"private-key"`
+	PublicKey    string `proxy:"public-key"`
+	PreSharedKey string `proxy:"pre-shared-key,omitempty"`
+	// AllowedIPs are the destinations routed to the peer, all of them by default
+	AllowedIPs []string `proxy:"allowed-ips,omitempty"`
+	// DNS are the nameservers in the tunnel resolving the hosts dialed by
+	// the proxy, the hosts are resolved locally if it's empty
+	DNS                 []string `proxy:"dns,omitempty"`
+	MTU                 int      `proxy:"mtu,omitempty"`
+	PersistentKeepalive int      `proxy:"persistent-keepalive,omitempty"`
+	UDP                 bool     `proxy:"udp,omitempty"`
+}
+
+func (w *WireGuard) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	tunnel, err := w.getTunnel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	address := metadata.RemoteAddress()
+	if metadata.Host != "" && len(w.config.DNS) == 0 {
+		ip, err := resolver.ResolveIP(metadata.Host)
+		if err != nil {
+			return nil, fmt.Errorf("[DNS] resolve %s error: %w", metadata.Host, err)
+		}
+		address = net.JoinHostPort(ip.String(), metadata.DstPort)
+	}
+
+	c, err := tunnel.DialContext(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("%s dial %s error: %w", w.addr, metadata.RemoteAddress(), err)
+	}
+	return NewConn(c, w), nil
+}
+
+func (w *WireGuard) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tcpTimeout)
+	defer cancel()
+	tunnel, err := w.getTunnel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := tunnel.ListenPacket()
+	if err != nil {
+		return nil, err
+	}
+	return newPacketConn(pc, w), nil
+}
+
+// Close closes the tunnel, the connections in it are broken
+func (w *WireGuard) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.tunnel != nil {
+		w.tunnel.Close()
+		w.tunnel = nil
+	}
+	return nil
+}
+
+// getTunnel returns the tunnel, it starts a new one if the tunnel isn't
+// started or its socket is broken
+func (w *WireGuard) getTunnel(ctx context.Context) (*wireguard.Tunnel, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.tunnel != nil {
+		select {
+		case <-w.tunnel.Done():
+			w.tunnel.Close()
+			w.tunnel = nil
+		default:
+			return w.tunnel, nil
+		}
+	}
+
+	ip, err := resolver.ResolveIP(w.server)
+	if err != nil {
+		return nil, fmt.Errorf("%s resolve error: %w", w.addr, err)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	endpoint, _ := netip.AddrFromSlice(ip)
+	config := w.config
+	config.Endpoint = netip.AddrPortFrom(endpoint.Unmap(), uint16(w.port))
+	tunnel, err := wireguard.NewTunnel(config, func() (net.PacketConn, error) {
+		// the tunnel is shared, so only the routing mark of the proxy applies
+		return w.listenPacket(&C.Metadata{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s start error: %w", w.addr, err)
+	}
+	w.tunnel = tunnel
+	return tunnel, nil
+}
+
+func parseWireGuardKey(name, key string) (wireguard.Key, error) {
+	k, err := wireguard.ParseKey(key)
+	if err != nil {
+		return k, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return k, nil
+}
+
+func NewWireGuard(option WireGuardOption) (*WireGuard, error) {
+	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
+
+	config := wireguard.Config{
+		MTU:                 option.MTU,
+		PersistentKeepalive: option.PersistentKeepalive,
+	}
+
+	var err error
+	if config.PrivateKey, err = parseWireGuardKey("private-key", option.PrivateKey); err != nil {
+		return nil, fmt.Errorf("wireguard %s %w", addr, err)
+	}
+	if config.PublicKey, err = parseWireGuardKey("public-key", option.PublicKey); err != nil {
+		return nil, fmt.Errorf("wireguard %s %w", addr, err)
+	}
+	if option.PreSharedKey != "" {
+		if config.PreSharedKey, err = parseWireGuardKey("pre-shared-key", option.PreSharedKey); err != nil {
+			return nil, fmt.Errorf("wireguard %s %w", addr, err)
+		}
+	}
+
+	if option.IP != "" {
+		ip, err := netip.ParseAddr(option.IP)
+		if err != nil || !ip.Is4() {
+			return nil, fmt.Errorf("wireguard %s invalid ip: %s", addr, option.IP)
+		}
+		config.Addresses = append(config.Addresses, ip)
+	}
+	if option.IPv6 != "" {
+		ip, err := netip.ParseAddr(option.IPv6)
+		if err != nil || !ip.Is6() {
+			return nil, fmt.Errorf("wireguard %s invalid ipv6: %s", addr, option.IPv6)
+		}
+		config.Addresses = append(config.Addresses, ip)
+	}
+	if len(config.Addresses) == 0 {
+		return nil, fmt.Errorf("wireguard %s ip or ipv6 is required", addr)
+	}
+
+	allowedIPs := option.AllowedIPs
+	if len(allowedIPs) == 0 {
+		allowedIPs = []string{"0.0.0.0/0", "::/0"}
+	}
+	for _, s := range allowedIPs {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("wireguard %s invalid allowed-ips: %s", addr, s)
+		}
+		config.AllowedIPs = append(config.AllowedIPs, prefix)
+	}
+
+	for _, s := range option.DNS {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("wireguard %s invalid dns: %s", addr, s)
+		}
+		config.DNS = append(config.DNS, ip)
+	}
+
+	return &WireGuard{
+		Base: &Base{
+			name: option.Name,
+			addr: addr,
+			tp:   C.WireGuard,
+			udp:  option.UDP,
+		},
+		server: option.Server,
+		port:   option.Port,
+		config: config,
+	}, nil
+}
@@ -0,0 +1,49 @@
+package outbound
+
+import (
+	"encoding/base64"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWireGuard(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	option := func() WireGuardOption {
+		return WireGuardOption{
+			Name:       "wg",
+			Server:     "127.0.0.1",
+			Port:       51820,
+			IP:         "10.0.0.2",
+			PrivateKey: key,
+			PublicKey:  key,
+		}
+	}
+
+	w, err := NewWireGuard(option())
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.2")}, w.config.Addresses)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}, w.config.AllowedIPs)
+
+	o := option()
+	o.IP = ""
+	_, err = NewWireGuard(o)
+	assert.EqualError(t, err, "wireguard 127.0.0.1:51820 ip or ipv6 is required")
+
+	o = option()
+	o.IPv6 = "10.0.0.3"
+	_, err = NewWireGuard(o)
+	assert.EqualError(t, err, "wireguard 127.0.0.1:51820 invalid ipv6: 10.0.0.3")
+
+	o = option()
+	o.PublicKey = "short"
+	_, err = NewWireGuard(o)
+	assert.Error(t, err)
+
+	o = option()
+	o.AllowedIPs = []string{"10.0.0.0"}
+	_, err = NewWireGuard(o)
+	assert.EqualError(t, err, "wireguard 127.0.0.1:51820 invalid allowed-ips: 10.0.0.0")
+}
@@ -1,10 +1,16 @@
 package outboundgroup
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/Dreamacro/clash/adapters/provider"
+	"github.com/Dreamacro/clash/component/profile"
+	"github.com/Dreamacro/clash/component/profile/cachefile"
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+
+	"go.uber.org/atomic"
 )
 
 const (
@@ -22,3 +28,66 @@ func getProvidersProxies(providers []provider.ProxyProvider, touch bool) []C.Pro
 	}
 	return proxies
 }
+
+// expectedDelay returns the last delay of the current proxy of a group, zero
+// means the delay is unknown or the proxy is dead
+func expectedDelay(proxy C.Proxy) uint16 {
+	if delay := proxy.LastDelay(); delay != 0xffff {
+		return delay
+	}
+	return 0
+}
+
+// storedSelected returns the selected proxy of a group stored in cache file
+func storedSelected(group string) string {
+	if !profile.StoreSelected.Load() {
+		return ""
+	}
+	return cachefile.Cache().Selected(group)
+}
+
+// lastResort is the proxy of a group when all the proxies of the group are
+// dead, a nil lastResort keeps the dead proxy
+type lastResort struct {
+	proxy    C.Proxy
+	degraded *atomic.Bool
+}
+
+func parseLastResort(option *GroupCommonOption, proxyMap map[string]C.Proxy) (*lastResort, error) {
+	name := option.FallbackProxy
+	if name == "" {
+		if !option.FallbackDirect {
+			return nil, nil
+		}
+		name = "DIRECT"
+	}
+
+	if option.Type != "url-test" && option.Type != "fallback" {
+		return nil, fmt.Errorf("%s group doesn't support fallback-direct and fallback-proxy", option.Type)
+	}
+	proxy, ok := proxyMap[name]
+	if !ok {
+		return nil, fmt.Errorf("'%s' not found", name)
+	}
+	return &lastResort{proxy: proxy, degraded: atomic.NewBool(false)}, nil
+}
+
+// pick returns the last resort if proxy is dead, the degradation and the
+// recovery of group are logged once
+func (l *lastResort) pick(group string, proxy C.Proxy) C.Proxy {
+	if l == nil {
+		return proxy
+	}
+
+	if proxy.Alive() {
+		if l.degraded.CAS(true, false) {
+			log.Infoln("[Group] %s recovered, using %s", group, proxy.Name())
+		}
+		return proxy
+	}
+
+	if l.degraded.CAS(false, true) {
+		log.Warnln("[Group] all proxies of %s are down, fall back to %s", group, l.proxy.Name())
+	}
+	return l.proxy
+}
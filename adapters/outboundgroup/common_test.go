@@ -0,0 +1,68 @@
+package outboundgroup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/adapters/outbound"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLastResort(t *testing.T) {
+	direct := outbound.NewProxy(outbound.NewDirect())
+	proxy := outbound.NewProxy(outbound.NewReject())
+	proxyMap := map[string]C.Proxy{"DIRECT": direct, "PROXY": proxy}
+
+	resort, err := parseLastResort(&GroupCommonOption{Type: "url-test"}, proxyMap)
+	require.NoError(t, err)
+	assert.Nil(t, resort)
+
+	resort, err = parseLastResort(&GroupCommonOption{Type: "fallback", FallbackDirect: true}, proxyMap)
+	require.NoError(t, err)
+	assert.Equal(t, C.Proxy(direct), resort.proxy)
+
+	// fallback-proxy goes first
+	resort, err = parseLastResort(&GroupCommonOption{Type: "url-test", FallbackDirect: true, FallbackProxy: "PROXY"}, proxyMap)
+	require.NoError(t, err)
+	assert.Equal(t, C.Proxy(proxy), resort.proxy)
+
+	_, err = parseLastResort(&GroupCommonOption{Type: "select", FallbackDirect: true}, proxyMap)
+	assert.Error(t, err)
+	_, err = parseLastResort(&GroupCommonOption{Type: "fallback", FallbackProxy: "UNKNOWN"}, proxyMap)
+	assert.Error(t, err)
+}
+
+func TestLastResort_Pick(t *testing.T) {
+	direct := outbound.NewProxy(outbound.NewDirect())
+	proxy := outbound.NewProxy(outbound.NewReject())
+	resort, err := parseLastResort(&GroupCommonOption{Type: "fallback", FallbackDirect: true}, map[string]C.Proxy{"DIRECT": direct})
+	require.NoError(t, err)
+
+	assert.Equal(t, C.Proxy(proxy), resort.pick("group", proxy))
+	assert.False(t, resort.degraded.Load())
+
+	proxy.RestoreDelay(C.DelayHistory{Time: time.Now()})
+	assert.Equal(t, C.Proxy(direct), resort.pick("group", proxy))
+	assert.True(t, resort.degraded.Load())
+
+	// the group recovers when a proxy is alive again
+	alive := outbound.NewProxy(outbound.NewReject())
+	assert.Equal(t, C.Proxy(alive), resort.pick("group", alive))
+	assert.False(t, resort.degraded.Load())
+
+	// a nil last resort keeps the dead proxy
+	var none *lastResort
+	assert.Equal(t, C.Proxy(proxy), none.pick("group", proxy))
+}
+
+func TestGroupCommonOption_Dependencies(t *testing.T) {
+	option := &GroupCommonOption{Proxies: []string{"a", "b"}}
+	assert.Equal(t, []string{"a", "b"}, option.Dependencies())
+
+	option.FallbackProxy = "c"
+	assert.Equal(t, []string{"a", "b", "c"}, option.Dependencies())
+	assert.Equal(t, []string{"a", "b"}, option.Proxies)
+}
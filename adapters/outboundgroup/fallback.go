@@ -15,6 +15,7 @@ type Fallback struct {
 	disableUDP bool
 	single     *singledo.Single
 	providers  []provider.ProxyProvider
+	resort     *lastResort
 }
 
 func (f *Fallback) Now() string {
@@ -54,10 +55,12 @@ func (f *Fallback) MarshalJSON() ([]byte, error) {
 	for _, proxy := range f.proxies(false) {
 		all = append(all, proxy.Name())
 	}
+	now := f.findAliveProxy(false)
 	return json.Marshal(map[string]interface{}{
-		"type": f.Type().String(),
-		"now":  f.Now(),
-		"all":  all,
+		"type":  f.Type().String(),
+		"now":   now.Name(),
+		"all":   all,
+		"delay": expectedDelay(now),
 	})
 }
 
@@ -78,18 +81,19 @@ func (f *Fallback) findAliveProxy(touch bool) C.Proxy {
 	proxies := f.proxies(touch)
 	for _, proxy := range proxies {
 		if proxy.Alive() {
-			return proxy
+			return f.resort.pick(f.Name(), proxy)
 		}
 	}
 
-	return proxies[0]
+	return f.resort.pick(f.Name(), proxies[0])
 }
 
-func NewFallback(options *GroupCommonOption, providers []provider.ProxyProvider) *Fallback {
+func NewFallback(options *GroupCommonOption, providers []provider.ProxyProvider, resort *lastResort) *Fallback {
 	return &Fallback{
 		Base:       outbound.NewBase(options.Name, "", C.Fallback, false),
 		single:     singledo.NewSingle(defaultGetProxiesDuration),
 		providers:  providers,
 		disableUDP: options.DisableUDP,
+		resort:     resort,
 	}
 }
@@ -6,9 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/Dreamacro/clash/adapters/outbound"
 	"github.com/Dreamacro/clash/adapters/provider"
+	"github.com/Dreamacro/clash/common/cache"
 	"github.com/Dreamacro/clash/common/murmur3"
 	"github.com/Dreamacro/clash/common/singledo"
 	C "github.com/Dreamacro/clash/constant"
@@ -24,9 +27,98 @@ type LoadBalance struct {
 	single     *singledo.Single
 	providers  []provider.ProxyProvider
 	strategyFn strategyFn
+	weights    weights
 }
 
-var errStrategy = errors.New("unsupported strategy")
+var (
+	errStrategy  = errors.New("unsupported strategy")
+	errWeight    = errors.New("weight must be a positive integer")
+	errStickyKey = errors.New("unsupported sticky key")
+)
+
+const (
+	defaultStickyTTL  = 10 * time.Minute
+	stickySessionSize = 4096
+)
+
+// stickyOption is the option of sticky-sessions strategy, Key is either
+// `host` (destination host) or `src-host` (source ip and destination host)
+type stickyOption struct {
+	Key string
+	TTL time.Duration
+}
+
+func (s *stickyOption) key(metadata *C.Metadata) string {
+	if s.Key == "src-host" && metadata.SrcIP != nil {
+		return metadata.SrcIP.String() + "-" + getKey(metadata)
+	}
+	return getKey(metadata)
+}
+
+func parseStickyOption(config map[string]interface{}) (*stickyOption, error) {
+	option := &stickyOption{Key: "host", TTL: defaultStickyTTL}
+	if elm, ok := config["sticky-key"]; ok {
+		key, ok := elm.(string)
+		if !ok || (key != "host" && key != "src-host") {
+			return nil, fmt.Errorf("%w: %v", errStickyKey, elm)
+		}
+		option.Key = key
+	}
+
+	if elm, ok := config["sticky-ttl"]; ok {
+		ttl, ok := elm.(int)
+		if !ok || ttl <= 0 {
+			return nil, errFormat
+		}
+		option.TTL = time.Duration(ttl) * time.Second
+	}
+
+	return option, nil
+}
+
+// weights maps proxy name to its weight, proxies not in the map have weight 1
+type weights map[string]int
+
+func (w weights) of(proxy C.Proxy) int {
+	if weight, ok := w[proxy.Name()]; ok {
+		return weight
+	}
+	return 1
+}
+
+func parseWeights(config map[string]interface{}) (weights, error) {
+	w := weights{}
+	elm, ok := config["weights"]
+	if !ok {
+		return w, nil
+	}
+
+	// yaml decodes nested mapping with interface{} keys
+	mapping := map[string]interface{}{}
+	switch m := elm.(type) {
+	case map[string]interface{}:
+		mapping = m
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			name, ok := k.(string)
+			if !ok {
+				return nil, errFormat
+			}
+			mapping[name] = v
+		}
+	default:
+		return nil, errFormat
+	}
+
+	for name, value := range mapping {
+		weight, ok := value.(int)
+		if !ok || weight <= 0 {
+			return nil, fmt.Errorf("%w: %s", errWeight, name)
+		}
+		w[name] = weight
+	}
+	return w, nil
+}
 
 func parseStrategy(config map[string]interface{}) string {
 	if elm, ok := config["strategy"]; ok {
@@ -113,6 +205,39 @@ func strategyRoundRobin() strategyFn {
 	}
 }
 
+// strategyWeightedRoundRobin is the smooth weighted round-robin of nginx,
+// every alive proxy is picked weight times in a cycle of total weight
+func strategyWeightedRoundRobin(w weights) strategyFn {
+	mux := sync.Mutex{}
+	current := map[string]int{}
+	return func(proxies []C.Proxy, metadata *C.Metadata) C.Proxy {
+		mux.Lock()
+		defer mux.Unlock()
+
+		var best C.Proxy
+		total := 0
+		for _, proxy := range proxies {
+			if !proxy.Alive() {
+				continue
+			}
+
+			weight := w.of(proxy)
+			current[proxy.Name()] += weight
+			total += weight
+			if best == nil || current[proxy.Name()] > current[best.Name()] {
+				best = proxy
+			}
+		}
+
+		if best == nil {
+			return proxies[0]
+		}
+
+		current[best.Name()] -= total
+		return best
+	}
+}
+
 func strategyConsistentHashing() strategyFn {
 	maxRetry := 5
 	return func(proxies []C.Proxy, metadata *C.Metadata) C.Proxy {
@@ -130,6 +255,63 @@ func strategyConsistentHashing() strategyFn {
 	}
 }
 
+// strategyWeightedConsistentHashing replicates every proxy to weight virtual
+// buckets, so a proxy receives keys in proportion to its weight
+func strategyWeightedConsistentHashing(w weights) strategyFn {
+	consistentHashing := strategyConsistentHashing()
+	return func(proxies []C.Proxy, metadata *C.Metadata) C.Proxy {
+		virtual := make([]C.Proxy, 0, len(proxies))
+		for _, proxy := range proxies {
+			for i := w.of(proxy); i > 0; i-- {
+				virtual = append(virtual, proxy)
+			}
+		}
+
+		return consistentHashing(virtual, metadata)
+	}
+}
+
+// strategyStickySessions binds a key to a proxy picked by consistent hashing,
+// the binding is kept until it isn't used for TTL or the proxy is dead
+func strategyStickySessions(w weights, option *stickyOption) strategyFn {
+	maxRetry := 5
+	sessions := cache.NewLRUCache(
+		cache.WithAge(int64(option.TTL/time.Second)),
+		cache.WithSize(stickySessionSize),
+		cache.WithUpdateAgeOnGet(),
+	)
+	return func(proxies []C.Proxy, metadata *C.Metadata) C.Proxy {
+		key := option.key(metadata)
+		if elm, ok := sessions.Get(key); ok {
+			name := elm.(string)
+			for _, proxy := range proxies {
+				if proxy.Name() == name && proxy.Alive() {
+					return proxy
+				}
+			}
+		}
+
+		virtual := make([]C.Proxy, 0, len(proxies))
+		for _, proxy := range proxies {
+			for i := w.of(proxy); i > 0; i-- {
+				virtual = append(virtual, proxy)
+			}
+		}
+
+		hash := uint64(murmur3.Sum32([]byte(key)))
+		buckets := int32(len(virtual))
+		for i := 0; i < maxRetry; i, hash = i+1, hash+1 {
+			proxy := virtual[jumpHash(hash, buckets)]
+			if proxy.Alive() {
+				sessions.Set(key, proxy.Name())
+				return proxy
+			}
+		}
+
+		return proxies[0]
+	}
+}
+
 func (lb *LoadBalance) Unwrap(metadata *C.Metadata) C.Proxy {
 	proxies := lb.proxies(true)
 	return lb.strategyFn(proxies, metadata)
@@ -145,22 +327,31 @@ func (lb *LoadBalance) proxies(touch bool) []C.Proxy {
 
 func (lb *LoadBalance) MarshalJSON() ([]byte, error) {
 	var all []string
+	ws := map[string]int{}
 	for _, proxy := range lb.proxies(false) {
 		all = append(all, proxy.Name())
+		ws[proxy.Name()] = lb.weights.of(proxy)
 	}
 	return json.Marshal(map[string]interface{}{
-		"type": lb.Type().String(),
-		"all":  all,
+		"type":    lb.Type().String(),
+		"all":     all,
+		"weights": ws,
 	})
 }
 
-func NewLoadBalance(options *GroupCommonOption, providers []provider.ProxyProvider, strategy string) (lb *LoadBalance, err error) {
+func NewLoadBalance(options *GroupCommonOption, providers []provider.ProxyProvider, strategy string, w weights, sticky *stickyOption) (lb *LoadBalance, err error) {
 	var strategyFn strategyFn
-	switch strategy {
-	case "consistent-hashing":
+	switch {
+	case strategy == "consistent-hashing" && len(w) == 0:
 		strategyFn = strategyConsistentHashing()
-	case "round-robin":
+	case strategy == "consistent-hashing":
+		strategyFn = strategyWeightedConsistentHashing(w)
+	case strategy == "round-robin" && len(w) == 0:
 		strategyFn = strategyRoundRobin()
+	case strategy == "round-robin":
+		strategyFn = strategyWeightedRoundRobin(w)
+	case strategy == "sticky-sessions":
+		strategyFn = strategyStickySessions(w, sticky)
 	default:
 		return nil, fmt.Errorf("%w: %s", errStrategy, strategy)
 	}
@@ -169,6 +360,7 @@ func NewLoadBalance(options *GroupCommonOption, providers []provider.ProxyProvid
 		single:     singledo.NewSingle(defaultGetProxiesDuration),
 		providers:  providers,
 		strategyFn: strategyFn,
+		weights:    w,
 		disableUDP: options.DisableUDP,
 	}, nil
 }
@@ -0,0 +1,189 @@
+package outboundgroup
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProxy is a proxy of which the strategies only use the name and liveness
+type fakeProxy struct {
+	C.Proxy
+	name  string
+	alive bool
+}
+
+func (f *fakeProxy) Name() string {
+	return f.name
+}
+
+func (f *fakeProxy) Alive() bool {
+	return f.alive
+}
+
+func newFakeProxies(names ...string) []C.Proxy {
+	proxies := []C.Proxy{}
+	for _, name := range names {
+		proxies = append(proxies, &fakeProxy{name: name, alive: true})
+	}
+	return proxies
+}
+
+func hostMetadata(host string) *C.Metadata {
+	return &C.Metadata{Host: host, AddrType: C.AtypDomainName, DstPort: "443"}
+}
+
+func TestParseWeights(t *testing.T) {
+	w, err := parseWeights(map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Empty(t, w)
+
+	w, err = parseWeights(map[string]interface{}{
+		"weights": map[interface{}]interface{}{"a": 3, "b": 1},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, weights{"a": 3, "b": 1}, w)
+	assert.Equal(t, 3, w.of(&fakeProxy{name: "a"}))
+	assert.Equal(t, 1, w.of(&fakeProxy{name: "c"}))
+
+	for _, elm := range []interface{}{
+		map[interface{}]interface{}{"a": 0},
+		map[interface{}]interface{}{"a": -1},
+		map[interface{}]interface{}{"a": "3"},
+		map[interface{}]interface{}{1: 3},
+		[]interface{}{"a"},
+	} {
+		_, err := parseWeights(map[string]interface{}{"weights": elm})
+		assert.Error(t, err, "%v", elm)
+	}
+}
+
+func TestStrategyWeightedRoundRobin(t *testing.T) {
+	proxies := newFakeProxies("a", "b", "c")
+	strategy := strategyWeightedRoundRobin(weights{"a": 5, "b": 2})
+
+	// smooth weighted round-robin spreads the picks of a over the cycle
+	picks := []string{}
+	for i := 0; i < 8; i++ {
+		picks = append(picks, strategy(proxies, nil).Name())
+	}
+	assert.Equal(t, []string{"a", "b", "a", "a", "c", "a", "b", "a"}, picks)
+
+	counts := map[string]int{}
+	for i := 0; i < 800; i++ {
+		counts[strategy(proxies, nil).Name()]++
+	}
+	assert.Equal(t, map[string]int{"a": 500, "b": 200, "c": 100}, counts)
+
+	// the dead proxies are skipped and the first proxy is the last resort
+	proxies[0].(*fakeProxy).alive = false
+	counts = map[string]int{}
+	for i := 0; i < 300; i++ {
+		counts[strategy(proxies, nil).Name()]++
+	}
+	assert.Equal(t, map[string]int{"b": 200, "c": 100}, counts)
+
+	for _, proxy := range proxies {
+		proxy.(*fakeProxy).alive = false
+	}
+	assert.Equal(t, "a", strategy(proxies, nil).Name())
+}
+
+func TestStrategyWeightedConsistentHashing(t *testing.T) {
+	proxies := newFakeProxies("a", "b")
+	strategy := strategyWeightedConsistentHashing(weights{"a": 3})
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		metadata := hostMetadata(fmt.Sprintf("site%d.com", i))
+		name := strategy(proxies, metadata).Name()
+		counts[name]++
+
+		// the same key always goes to the same proxy
+		assert.Equal(t, name, strategy(proxies, hostMetadata("www."+metadata.Host)).Name())
+	}
+	assert.InDelta(t, 750, counts["a"], 50)
+	assert.Equal(t, 1000, counts["a"]+counts["b"])
+}
+
+func TestParseStickyOption(t *testing.T) {
+	option, err := parseStickyOption(map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, &stickyOption{Key: "host", TTL: defaultStickyTTL}, option)
+
+	option, err = parseStickyOption(map[string]interface{}{"sticky-key": "src-host", "sticky-ttl": 30})
+	require.NoError(t, err)
+	assert.Equal(t, &stickyOption{Key: "src-host", TTL: 30 * time.Second}, option)
+
+	metadata := hostMetadata("www.example.com")
+	metadata.SrcIP = net.ParseIP("192.168.1.2")
+	assert.Equal(t, "192.168.1.2-example.com", option.key(metadata))
+
+	for _, config := range []map[string]interface{}{
+		{"sticky-key": "dst-ip"},
+		{"sticky-key": 1},
+		{"sticky-ttl": 0},
+		{"sticky-ttl": "10m"},
+	} {
+		_, err := parseStickyOption(config)
+		assert.Error(t, err, "%v", config)
+	}
+}
+
+// stickyHost finds a host which consistent hashing puts on the first of proxies
+func stickyHost(t *testing.T, proxies []C.Proxy) *C.Metadata {
+	hashing := strategyConsistentHashing()
+	for i := 0; i < 100; i++ {
+		metadata := hostMetadata(fmt.Sprintf("site%d.com", i))
+		if hashing(proxies, metadata) == proxies[0] {
+			return metadata
+		}
+	}
+	require.FailNow(t, "no host hashed to the first proxy")
+	return nil
+}
+
+func TestStrategyStickySessions(t *testing.T) {
+	proxies := newFakeProxies("a", "b")
+	a, b := proxies[0], proxies[1]
+	strategy := strategyStickySessions(weights{}, &stickyOption{Key: "host", TTL: time.Minute})
+
+	// the binding is kept after the members change
+	metadata := stickyHost(t, []C.Proxy{b, a})
+	assert.Equal(t, a, strategy([]C.Proxy{a}, metadata))
+	assert.Equal(t, a, strategy(proxies, metadata))
+	assert.Equal(t, a, strategy([]C.Proxy{b, a}, metadata))
+
+	// a dead proxy loses its bindings, which don't come back with it
+	a.(*fakeProxy).alive = false
+	assert.Equal(t, b, strategy(proxies, metadata))
+	a.(*fakeProxy).alive = true
+	assert.Equal(t, b, strategy(proxies, metadata))
+
+	// the binding is dropped if the proxy is no longer a member
+	assert.Equal(t, a, strategy([]C.Proxy{a}, metadata))
+
+	// the first proxy is the last resort
+	a.(*fakeProxy).alive = false
+	b.(*fakeProxy).alive = false
+	assert.Equal(t, a, strategy(proxies, metadata))
+}
+
+func TestStrategyStickySessions_TTL(t *testing.T) {
+	a, b := &fakeProxy{name: "a", alive: true}, &fakeProxy{name: "b", alive: true}
+	strategy := strategyStickySessions(weights{}, &stickyOption{Key: "host", TTL: time.Second})
+
+	metadata := stickyHost(t, []C.Proxy{b, a})
+	assert.Equal(t, C.Proxy(a), strategy([]C.Proxy{a}, metadata))
+	assert.Equal(t, C.Proxy(a), strategy([]C.Proxy{b, a}, metadata))
+
+	// the ttl has a resolution of a second
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, C.Proxy(b), strategy([]C.Proxy{b, a}, metadata))
+}
@@ -26,6 +26,22 @@ type GroupCommonOption struct {
 	Interval   int      `group:"interval,omitempty"`
 	Lazy       bool     `group:"lazy,omitempty"`
 	DisableUDP bool     `group:"disable-udp,omitempty"`
+
+	ExpectedStatus string `group:"expected-status,omitempty"`
+	ExpectedBody   string `group:"expected-body,omitempty"`
+
+	// FallbackDirect and FallbackProxy are the last resort of url-test and
+	// fallback groups when all the proxies are down, FallbackProxy first
+	FallbackDirect bool   `group:"fallback-direct,omitempty"`
+	FallbackProxy  string `group:"fallback-proxy,omitempty"`
+}
+
+// Dependencies returns the names of the proxies and groups the group uses
+func (o *GroupCommonOption) Dependencies() []string {
+	if o.FallbackProxy == "" {
+		return o.Proxies
+	}
+	return append(append([]string{}, o.Proxies...), o.FallbackProxy)
 }
 
 func ParseProxyGroup(config map[string]interface{}, proxyMap map[string]C.Proxy, providersMap map[string]provider.ProxyProvider) (C.ProxyAdapter, error) {
@@ -56,9 +72,17 @@ func ParseProxyGroup(config map[string]interface{}, proxyMap map[string]C.Proxy,
 			return nil, err
 		}
 
+		if groupOption.Type == "relay" {
+			for _, p := range ps {
+				if p.Type() == C.Direct || p.Type() == C.Reject || p.Type() == C.RejectDrop {
+					return nil, fmt.Errorf("%s can't be relayed", p.Name())
+				}
+			}
+		}
+
 		// if Use not empty, drop health check options
 		if len(groupOption.Use) != 0 {
-			hc := provider.NewHealthCheck(ps, "", 0, true)
+			hc := provider.NewHealthCheck(ps, "", 0, true, nil)
 			pd, err := provider.NewCompatibleProvider(groupName, ps, hc)
 			if err != nil {
 				return nil, err
@@ -72,7 +96,7 @@ func ParseProxyGroup(config map[string]interface{}, proxyMap map[string]C.Proxy,
 
 			// select don't need health check
 			if groupOption.Type == "select" || groupOption.Type == "relay" {
-				hc := provider.NewHealthCheck(ps, "", 0, true)
+				hc := provider.NewHealthCheck(ps, "", 0, true, nil)
 				pd, err := provider.NewCompatibleProvider(groupName, ps, hc)
 				if err != nil {
 					return nil, err
@@ -85,7 +109,12 @@ func ParseProxyGroup(config map[string]interface{}, proxyMap map[string]C.Proxy,
 					return nil, errMissHealthCheck
 				}
 
-				hc := provider.NewHealthCheck(ps, groupOption.URL, uint(groupOption.Interval), groupOption.Lazy)
+				expect, err := C.ParseHealthCheckExpect(groupOption.ExpectedStatus, groupOption.ExpectedBody)
+				if err != nil {
+					return nil, err
+				}
+
+				hc := provider.NewHealthCheck(ps, groupOption.URL, uint(groupOption.Interval), groupOption.Lazy, expect)
 				pd, err := provider.NewCompatibleProvider(groupName, ps, hc)
 				if err != nil {
 					return nil, err
@@ -105,18 +134,31 @@ func ParseProxyGroup(config map[string]interface{}, proxyMap map[string]C.Proxy,
 		providers = append(providers, list...)
 	}
 
+	resort, err := parseLastResort(groupOption, proxyMap)
+	if err != nil {
+		return nil, err
+	}
+
 	var group C.ProxyAdapter
 	switch groupOption.Type {
 	case "url-test":
 		opts := parseURLTestOption(config)
-		group = NewURLTest(groupOption, providers, opts...)
+		group = NewURLTest(groupOption, providers, resort, opts...)
 	case "select":
 		group = NewSelector(groupOption, providers)
 	case "fallback":
-		group = NewFallback(groupOption, providers)
+		group = NewFallback(groupOption, providers, resort)
 	case "load-balance":
 		strategy := parseStrategy(config)
-		return NewLoadBalance(groupOption, providers, strategy)
+		weights, err := parseWeights(config)
+		if err != nil {
+			return nil, err
+		}
+		sticky, err := parseStickyOption(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewLoadBalance(groupOption, providers, strategy, weights, sticky)
 	case "relay":
 		group = NewRelay(groupOption, providers)
 	default:
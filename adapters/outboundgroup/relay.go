@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 
 	"github.com/Dreamacro/clash/adapters/outbound"
 	"github.com/Dreamacro/clash/adapters/provider"
@@ -15,45 +16,107 @@ import (
 
 type Relay struct {
 	*outbound.Base
-	single    *singledo.Single
-	providers []provider.ProxyProvider
+	single     *singledo.Single
+	providers  []provider.ProxyProvider
+	disableUDP bool
 }
 
 func (r *Relay) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
 	proxies := r.proxies(metadata, true)
+	c, err := r.streamChain(ctx, proxies)
+	if err != nil {
+		return nil, err
+	}
+
+	last := proxies[len(proxies)-1]
+	c, err = last.StreamConn(c, metadata)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("%s connect error: %w", last.Addr(), err)
+	}
+
+	return outbound.NewConn(c, r), nil
+}
+
+// DialUDP transports UDP over the chain, the last proxy must transport UDP over its stream
+func (r *Relay) DialUDP(metadata *C.Metadata) (C.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(dialer.WithRoutingMark(context.Background(), metadata.RoutingMark), tcpTimeout)
+	defer cancel()
+
+	proxies := r.proxies(metadata, true)
+	c, err := r.streamChain(ctx, proxies)
+	if err != nil {
+		return nil, err
+	}
+
+	last := proxies[len(proxies)-1]
+	pc, err := last.StreamPacketConn(c, metadata)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("%s connect error: %w", last.Addr(), err)
+	}
+
+	pc.AppendToChains(r)
+	return pc, nil
+}
+
+// SupportUDP reports whether the last proxy transports UDP over its stream
+func (r *Relay) SupportUDP() bool {
+	if r.disableUDP {
+		return false
+	}
+
+	proxies := r.proxies(&C.Metadata{NetWork: C.UDP}, false)
 	if len(proxies) == 0 {
-		return nil, errors.New("proxy does not exist")
+		return false
 	}
-	first := proxies[0]
+
 	last := proxies[len(proxies)-1]
+	switch last.Type() {
+	case C.Vmess, C.Vless, C.Trojan, C.Snell:
+		return last.SupportUDP()
+	default:
+		return false
+	}
+}
+
+// streamChain connects to the last proxy through the others in order
+func (r *Relay) streamChain(ctx context.Context, proxies []C.Proxy) (net.Conn, error) {
+	if len(proxies) == 0 {
+		return nil, errors.New("proxy does not exist")
+	}
+	for _, proxy := range proxies {
+		switch proxy.Type() {
+		case C.Direct, C.Reject, C.RejectDrop:
+			return nil, fmt.Errorf("%s can't be relayed", proxy.Name())
+		}
+	}
 
+	first := proxies[0]
 	c, err := dialer.DialContext(ctx, "tcp", first.Addr())
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error: %w", first.Addr(), err)
 	}
 	tcpKeepAlive(c)
 
-	var currentMeta *C.Metadata
 	for _, proxy := range proxies[1:] {
-		currentMeta, err = addrToMetadata(proxy.Addr())
+		currentMeta, err := addrToMetadata(proxy.Addr())
 		if err != nil {
+			c.Close()
 			return nil, err
 		}
 
-		c, err = first.StreamConn(c, currentMeta)
+		next, err := first.StreamConn(c, currentMeta)
 		if err != nil {
+			c.Close()
 			return nil, fmt.Errorf("%s connect error: %w", first.Addr(), err)
 		}
 
+		c = next
 		first = proxy
 	}
 
-	c, err = last.StreamConn(c, metadata)
-	if err != nil {
-		return nil, fmt.Errorf("%s connect error: %w", last.Addr(), err)
-	}
-
-	return outbound.NewConn(c, r), nil
+	return c, nil
 }
 
 func (r *Relay) MarshalJSON() ([]byte, error) {
@@ -76,7 +139,8 @@ func (r *Relay) rawProxies(touch bool) []C.Proxy {
 }
 
 func (r *Relay) proxies(metadata *C.Metadata, touch bool) []C.Proxy {
-	proxies := r.rawProxies(touch)
+	// copy the cached proxies before unwrapping the groups
+	proxies := append([]C.Proxy{}, r.rawProxies(touch)...)
 
 	for n, proxy := range proxies {
 		subproxy := proxy.Unwrap(metadata)
@@ -91,8 +155,9 @@ func (r *Relay) proxies(metadata *C.Metadata, touch bool) []C.Proxy {
 
 func NewRelay(options *GroupCommonOption, providers []provider.ProxyProvider) *Relay {
 	return &Relay{
-		Base:      outbound.NewBase(options.Name, "", C.Relay, false),
-		single:    singledo.NewSingle(defaultGetProxiesDuration),
-		providers: providers,
+		Base:       outbound.NewBase(options.Name, "", C.Relay, false),
+		single:     singledo.NewSingle(defaultGetProxiesDuration),
+		providers:  providers,
+		disableUDP: options.DisableUDP,
 	}
 }
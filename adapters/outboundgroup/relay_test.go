@@ -0,0 +1,174 @@
+package outboundgroup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/adapters/outbound"
+	"github.com/Dreamacro/clash/adapters/provider"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relayHop writes the address it connects to on the stream, so the server
+// at the first hop sees the chain
+type relayHop struct {
+	C.Proxy
+	name string
+	tp   C.AdapterType
+	addr string
+	udp  bool
+	err  error
+}
+
+func (h *relayHop) Name() string                        { return h.name }
+func (h *relayHop) Type() C.AdapterType                 { return h.tp }
+func (h *relayHop) Addr() string                        { return h.addr }
+func (h *relayHop) SupportUDP() bool                    { return h.udp }
+func (h *relayHop) Unwrap(metadata *C.Metadata) C.Proxy { return nil }
+
+func (h *relayHop) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
+	_, err := fmt.Fprintf(c, "%s>%s\n", h.name, metadata.RemoteAddress())
+	return c, err
+}
+
+func (h *relayHop) StreamPacketConn(c net.Conn, metadata *C.Metadata) (C.PacketConn, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+	if _, err := fmt.Fprintf(c, "%s>udp %s\n", h.name, metadata.RemoteAddress()); err != nil {
+		return nil, err
+	}
+	return &hopPacketConn{Conn: c}, nil
+}
+
+type hopPacketConn struct {
+	net.Conn
+	chain C.Chain
+}
+
+func (pc *hopPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := pc.Read(b)
+	return n, pc.RemoteAddr(), err
+}
+
+func (pc *hopPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return pc.Write(b)
+}
+
+func (pc *hopPacketConn) Chains() C.Chain {
+	return pc.chain
+}
+
+func (pc *hopPacketConn) AppendToChains(a C.ProxyAdapter) {
+	pc.chain = append(pc.chain, a.Name())
+}
+
+func newTestRelay(t *testing.T, disableUDP bool, proxies ...C.Proxy) *Relay {
+	hc := provider.NewHealthCheck(proxies, "", 0, true, nil)
+	pd, err := provider.NewCompatibleProvider("relay", proxies, hc)
+	require.NoError(t, err)
+	return NewRelay(&GroupCommonOption{Name: "relay", DisableUDP: disableUDP}, []provider.ProxyProvider{pd})
+}
+
+// listenRelay accepts one connection and sends its lines to the channel
+func listenRelay(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	lines := make(chan string, 8)
+	go func() {
+		defer close(lines)
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				if err == io.EOF {
+					lines <- "EOF"
+				}
+				return
+			}
+			lines <- line
+		}
+	}()
+	return l.Addr().String(), lines
+}
+
+func receive(t *testing.T, lines <-chan string) string {
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(time.Second):
+		require.FailNow(t, "no line received")
+		return ""
+	}
+}
+
+func TestRelay_SupportUDP(t *testing.T) {
+	ss := &relayHop{name: "ss", tp: C.Shadowsocks, addr: "ss.example:8388", udp: true}
+	trojan := &relayHop{name: "trojan", tp: C.Trojan, addr: "trojan.example:443", udp: true}
+	vmess := &relayHop{name: "vmess", tp: C.Vmess, addr: "vmess.example:443"}
+
+	assert.True(t, newTestRelay(t, false, ss, trojan).SupportUDP())
+	assert.False(t, newTestRelay(t, true, ss, trojan).SupportUDP())
+	// the last proxy must carry UDP over its stream, and enable it
+	assert.False(t, newTestRelay(t, false, trojan, ss).SupportUDP())
+	assert.False(t, newTestRelay(t, false, trojan, vmess).SupportUDP())
+}
+
+func TestRelay_DialUDP(t *testing.T) {
+	addr, lines := listenRelay(t)
+	first := &relayHop{name: "first", tp: C.Http, addr: addr}
+	last := &relayHop{name: "last", tp: C.Trojan, addr: "trojan.example:443", udp: true}
+	relay := newTestRelay(t, false, first, last)
+
+	metadata := &C.Metadata{NetWork: C.UDP, AddrType: C.AtypIPv4, DstIP: net.IPv4(8, 8, 8, 8), DstPort: "53"}
+	pc, err := relay.DialUDP(metadata)
+	require.NoError(t, err)
+	defer pc.Close()
+
+	assert.Equal(t, "first>trojan.example:443\n", receive(t, lines))
+	assert.Equal(t, "last>udp 8.8.8.8:53\n", receive(t, lines))
+	assert.Equal(t, C.Chain{"relay"}, pc.Chains())
+}
+
+func TestRelay_DialUDPError(t *testing.T) {
+	addr, lines := listenRelay(t)
+	first := &relayHop{name: "first", tp: C.Http, addr: addr}
+	last := &relayHop{name: "last", tp: C.Trojan, addr: "trojan.example:443", udp: true, err: errors.New("broken")}
+	relay := newTestRelay(t, false, first, last)
+
+	// the failing hop closes the chain
+	_, err := relay.DialUDP(&C.Metadata{NetWork: C.UDP, AddrType: C.AtypIPv4, DstIP: net.IPv4(8, 8, 8, 8), DstPort: "53"})
+	assert.Error(t, err)
+	assert.Equal(t, "first>trojan.example:443\n", receive(t, lines))
+	assert.Equal(t, "EOF", receive(t, lines))
+}
+
+func TestRelay_Unrelayable(t *testing.T) {
+	direct := outbound.NewProxy(outbound.NewDirect())
+	last := &relayHop{name: "last", tp: C.Trojan, addr: "trojan.example:443", udp: true}
+
+	_, err := newTestRelay(t, false, direct, last).DialUDP(&C.Metadata{NetWork: C.UDP})
+	assert.Error(t, err)
+
+	_, err = ParseProxyGroup(map[string]interface{}{
+		"name":    "relay",
+		"type":    "relay",
+		"proxies": []string{"DIRECT", "last"},
+	}, map[string]C.Proxy{"DIRECT": direct, "last": last}, map[string]provider.ProxyProvider{})
+	assert.EqualError(t, err, "DIRECT can't be relayed")
+}
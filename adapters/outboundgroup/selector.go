@@ -8,6 +8,8 @@ import (
 	"github.com/Dreamacro/clash/adapters/outbound"
 	"github.com/Dreamacro/clash/adapters/provider"
 	"github.com/Dreamacro/clash/common/singledo"
+	"github.com/Dreamacro/clash/component/profile"
+	"github.com/Dreamacro/clash/component/profile/cachefile"
 	C "github.com/Dreamacro/clash/constant"
 )
 
@@ -49,10 +51,13 @@ func (s *Selector) MarshalJSON() ([]byte, error) {
 		all = append(all, proxy.Name())
 	}
 
+	now := s.selectedProxy(false)
 	return json.Marshal(map[string]interface{}{
-		"type": s.Type().String(),
-		"now":  s.Now(),
-		"all":  all,
+		"type":   s.Type().String(),
+		"now":    now.Name(),
+		"all":    all,
+		"delay":  expectedDelay(now),
+		"stored": storedSelected(s.Name()),
 	})
 }
 
@@ -65,6 +70,9 @@ func (s *Selector) Set(name string) error {
 		if proxy.Name() == name {
 			s.selected = name
 			s.single.Reset()
+			if profile.StoreSelected.Load() {
+				cachefile.Cache().SetSelected(s.Name(), name)
+			}
 			return nil
 		}
 	}
@@ -8,6 +8,8 @@ import (
 	"github.com/Dreamacro/clash/adapters/outbound"
 	"github.com/Dreamacro/clash/adapters/provider"
 	"github.com/Dreamacro/clash/common/singledo"
+	"github.com/Dreamacro/clash/component/profile"
+	"github.com/Dreamacro/clash/component/profile/cachefile"
 	C "github.com/Dreamacro/clash/constant"
 )
 
@@ -27,6 +29,7 @@ type URLTest struct {
 	single     *singledo.Single
 	fastSingle *singledo.Single
 	providers  []provider.ProxyProvider
+	resort     *lastResort
 }
 
 func (u *URLTest) Now() string {
@@ -79,16 +82,46 @@ func (u *URLTest) fast(touch bool) C.Proxy {
 		}
 
 		// tolerance
-		if u.fastNode == nil || u.fastNode.LastDelay() > fast.LastDelay()+u.tolerance {
+		if !u.contains(proxies, u.fastNode) || int(u.fastNode.LastDelay()) > int(fast.LastDelay())+int(u.tolerance) {
+			if u.fastNode != fast && profile.StoreSelected.Load() {
+				cachefile.Cache().SetSelected(u.Name(), fast.Name())
+			}
 			u.fastNode = fast
 		}
 
-		return u.fastNode, nil
+		return u.resort.pick(u.Name(), u.fastNode), nil
 	})
 
 	return elm.(C.Proxy)
 }
 
+// contains reports whether proxy is still an alive member of the group
+func (u *URLTest) contains(proxies []C.Proxy, proxy C.Proxy) bool {
+	if proxy == nil || !proxy.Alive() {
+		return false
+	}
+
+	for _, p := range proxies {
+		if p == proxy {
+			return true
+		}
+	}
+	return false
+}
+
+// Restore makes the proxy named name the current fast node, it is used to
+// recover the node stored in cache file before the first health check
+func (u *URLTest) Restore(name string) bool {
+	for _, proxy := range u.proxies(false) {
+		if proxy.Name() == name {
+			u.fastNode = proxy
+			u.fastSingle.Reset()
+			return true
+		}
+	}
+	return false
+}
+
 func (u *URLTest) SupportUDP() bool {
 	if u.disableUDP {
 		return false
@@ -102,10 +135,13 @@ func (u *URLTest) MarshalJSON() ([]byte, error) {
 	for _, proxy := range u.proxies(false) {
 		all = append(all, proxy.Name())
 	}
+	now := u.fast(false)
 	return json.Marshal(map[string]interface{}{
-		"type": u.Type().String(),
-		"now":  u.Now(),
-		"all":  all,
+		"type":   u.Type().String(),
+		"now":    now.Name(),
+		"all":    all,
+		"delay":  expectedDelay(now),
+		"stored": storedSelected(u.Name()),
 	})
 }
 
@@ -122,13 +158,14 @@ func parseURLTestOption(config map[string]interface{}) []urlTestOption {
 	return opts
 }
 
-func NewURLTest(commonOptions *GroupCommonOption, providers []provider.ProxyProvider, options ...urlTestOption) *URLTest {
+func NewURLTest(commonOptions *GroupCommonOption, providers []provider.ProxyProvider, resort *lastResort, options ...urlTestOption) *URLTest {
 	urlTest := &URLTest{
 		Base:       outbound.NewBase(commonOptions.Name, "", C.URLTest, false),
 		single:     singledo.NewSingle(defaultGetProxiesDuration),
 		fastSingle: singledo.NewSingle(time.Second * 10),
 		providers:  providers,
 		disableUDP: commonOptions.DisableUDP,
+		resort:     resort,
 	}
 
 	for _, option := range options {
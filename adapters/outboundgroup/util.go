@@ -5,9 +5,12 @@ import (
 	"net"
 	"time"
 
+	"github.com/Dreamacro/clash/adapters/outbound"
 	C "github.com/Dreamacro/clash/constant"
 )
 
+const tcpTimeout = 5 * time.Second
+
 func addrToMetadata(rawAddress string) (addr *C.Metadata, err error) {
 	host, port, err := net.SplitHostPort(rawAddress)
 	if err != nil {
@@ -48,6 +51,6 @@ func addrToMetadata(rawAddress string) (addr *C.Metadata, err error) {
 func tcpKeepAlive(c net.Conn) {
 	if tcp, ok := c.(*net.TCPConn); ok {
 		tcp.SetKeepAlive(true)
-		tcp.SetKeepAlivePeriod(30 * time.Second)
+		tcp.SetKeepAlivePeriod(outbound.KeepAliveInterval())
 	}
 }
@@ -63,6 +63,9 @@ func (f *fetcher) Initial() (interface{}, error) {
 		}
 
 		// parse local file error, fallback to remote
+		if h, ok := f.vehicle.(*HTTPVehicle); ok {
+			h.resetValidator()
+		}
 		buf, err = f.vehicle.Read()
 		if err != nil {
 			return nil, err
@@ -79,6 +82,7 @@ func (f *fetcher) Initial() (interface{}, error) {
 			return nil, err
 		}
 	}
+	f.saveValidator()
 
 	f.hash = md5.Sum(buf)
 
@@ -91,14 +95,20 @@ func (f *fetcher) Initial() (interface{}, error) {
 }
 
 func (f *fetcher) Update() (interface{}, bool, error) {
+	now := time.Now()
 	buf, err := f.vehicle.Read()
+	if err == errNotModified {
+		f.updatedAt = &now
+		return nil, true, nil
+	}
 	if err != nil {
 		return nil, false, err
 	}
 
-	now := time.Now()
 	hash := md5.Sum(buf)
 	if bytes.Equal(f.hash[:], hash[:]) {
+		// the same as the saved file
+		f.saveValidator()
 		f.updatedAt = &now
 		return nil, true, nil
 	}
@@ -111,6 +121,7 @@ func (f *fetcher) Update() (interface{}, bool, error) {
 	if err := safeWrite(f.vehicle.Path(), buf); err != nil {
 		return nil, false, err
 	}
+	f.saveValidator()
 
 	f.updatedAt = &now
 	f.hash = hash
@@ -118,6 +129,13 @@ func (f *fetcher) Update() (interface{}, bool, error) {
 	return proxies, false, nil
 }
 
+// saveValidator makes the next Read of an HTTP vehicle a conditional request
+func (f *fetcher) saveValidator() {
+	if h, ok := f.vehicle.(*HTTPVehicle); ok {
+		h.saveValidator()
+	}
+}
+
 func (f *fetcher) Destroy() error {
 	if f.ticker != nil {
 		f.done <- struct{}{}
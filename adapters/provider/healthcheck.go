@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	C "github.com/Dreamacro/clash/constant"
@@ -20,15 +21,24 @@ type HealthCheckOption struct {
 
 type HealthCheck struct {
 	url       string
+	expect    *C.HealthCheckExpect
 	proxies   []C.Proxy
 	interval  uint
 	lazy      bool
 	lastTouch *atomic.Int64
+	checkedAt *atomic.Int64
 	done      chan struct{}
+
+	// lastChecks is the last automatic check of the proxies by name
+	lastChecks map[string]time.Time
+	mux        sync.Mutex
 }
 
+// process checks the proxies on the ticks of the shortest interval, a proxy
+// is checked if its own interval has passed since its last check
 func (hc *HealthCheck) process() {
-	ticker := time.NewTicker(time.Duration(hc.interval) * time.Second)
+	tick := hc.tick()
+	ticker := time.NewTicker(tick)
 
 	go hc.check()
 	for {
@@ -36,7 +46,11 @@ func (hc *HealthCheck) process() {
 		case <-ticker.C:
 			now := time.Now().Unix()
 			if !hc.lazy || now-hc.lastTouch.Load() < int64(hc.interval) {
-				hc.check()
+				hc.checkDue(tick)
+			}
+			if t := hc.tick(); t != tick {
+				tick = t
+				ticker.Reset(tick)
 			}
 		case <-hc.done:
 			ticker.Stop()
@@ -45,8 +59,39 @@ func (hc *HealthCheck) process() {
 	}
 }
 
+// target returns the URL and the interval of proxy, a proxy may override the
+// ones of the health check
+func (hc *HealthCheck) target(proxy C.Proxy) (url string, interval uint) {
+	url, interval = hc.url, hc.interval
+	if p, ok := proxy.(interface{ HealthCheck() (string, uint) }); ok {
+		u, i := p.HealthCheck()
+		if u != "" {
+			url = u
+		}
+		if i != 0 {
+			interval = i
+		}
+	}
+	return
+}
+
+// tick returns the shortest interval of the proxies
+func (hc *HealthCheck) tick() time.Duration {
+	tick := hc.interval
+	for _, proxy := range hc.proxies {
+		if _, interval := hc.target(proxy); interval < tick {
+			tick = interval
+		}
+	}
+	return time.Duration(tick) * time.Second
+}
+
 func (hc *HealthCheck) setProxy(proxies []C.Proxy) {
 	hc.proxies = proxies
+
+	hc.mux.Lock()
+	hc.lastChecks = map[string]time.Time{}
+	hc.mux.Unlock()
 }
 
 func (hc *HealthCheck) auto() bool {
@@ -58,26 +103,103 @@ func (hc *HealthCheck) touch() {
 }
 
 func (hc *HealthCheck) check() {
+	hc.checkProxies(hc.proxies)
+}
+
+// checkDue checks the proxies whose interval has passed, tolerating half a
+// tick of the ticker jitter
+func (hc *HealthCheck) checkDue(tick time.Duration) {
+	now := time.Now()
+	proxies := []C.Proxy{}
+
+	hc.mux.Lock()
+	for _, proxy := range hc.proxies {
+		_, interval := hc.target(proxy)
+		last, ok := hc.lastChecks[proxy.Name()]
+		if !ok || now.Add(tick/2).Sub(last) >= time.Duration(interval)*time.Second {
+			proxies = append(proxies, proxy)
+		}
+	}
+	hc.mux.Unlock()
+
+	hc.checkProxies(proxies)
+}
+
+func (hc *HealthCheck) checkProxies(proxies []C.Proxy) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultURLTestTimeout)
+	defer cancel()
+
+	now := time.Now()
+	hc.mux.Lock()
+	for _, proxy := range proxies {
+		hc.lastChecks[proxy.Name()] = now
+	}
+	hc.mux.Unlock()
+
+	wg := sync.WaitGroup{}
+	for _, proxy := range proxies {
+		url, _ := hc.target(proxy)
+		wg.Add(1)
+		go func(proxy C.Proxy) {
+			defer wg.Done()
+			proxy.URLTest(ctx, url, hc.expect)
+		}(proxy)
+	}
+
+	wg.Wait()
+	hc.checkedAt.Store(time.Now().UnixNano())
+}
+
+// status returns the health check config, the last check time and the
+// last delay of each proxy, zero delay means the proxy is unavailable
+func (hc *HealthCheck) status() map[string]interface{} {
+	delays := map[string]uint16{}
+	targets := map[string]interface{}{}
 	for _, proxy := range hc.proxies {
-		go proxy.URLTest(ctx, hc.url)
+		delay := proxy.LastDelay()
+		if delay == 0xffff {
+			delay = 0
+		}
+		delays[proxy.Name()] = delay
+
+		url, interval := hc.target(proxy)
+		targets[proxy.Name()] = map[string]interface{}{
+			"url":      url,
+			"interval": interval,
+		}
 	}
 
-	<-ctx.Done()
-	cancel()
+	var checkedAt *time.Time
+	if nano := hc.checkedAt.Load(); nano != 0 {
+		t := time.Unix(0, nano)
+		checkedAt = &t
+	}
+
+	return map[string]interface{}{
+		"url":       hc.url,
+		"interval":  hc.interval,
+		"lazy":      hc.lazy,
+		"checkedAt": checkedAt,
+		"delays":    delays,
+		"targets":   targets,
+	}
 }
 
 func (hc *HealthCheck) close() {
 	hc.done <- struct{}{}
 }
 
-func NewHealthCheck(proxies []C.Proxy, url string, interval uint, lazy bool) *HealthCheck {
+func NewHealthCheck(proxies []C.Proxy, url string, interval uint, lazy bool, expect *C.HealthCheckExpect) *HealthCheck {
 	return &HealthCheck{
 		proxies:   proxies,
 		url:       url,
+		expect:    expect,
 		interval:  interval,
 		lazy:      lazy,
 		lastTouch: atomic.NewInt64(0),
+		checkedAt: atomic.NewInt64(0),
 		done:      make(chan struct{}, 1),
+
+		lastChecks: map[string]time.Time{},
 	}
 }
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/Dreamacro/clash/adapters/outbound"
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
 
 	"gopkg.in/yaml.v2"
 )
@@ -72,13 +74,18 @@ type proxySetProvider struct {
 }
 
 func (pp *proxySetProvider) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]interface{}{
+	mapping := map[string]interface{}{
 		"name":        pp.Name(),
 		"type":        pp.Type().String(),
 		"vehicleType": pp.VehicleType().String(),
 		"proxies":     pp.Proxies(),
 		"updatedAt":   pp.updatedAt,
-	})
+		"healthCheck": pp.healthCheck.status(),
+	}
+	if h, ok := pp.vehicle.(*HTTPVehicle); ok {
+		mapping["subscriptionInfo"] = h.SubscriptionInfo()
+	}
+	return json.Marshal(mapping)
 }
 
 func (pp *proxySetProvider) Name() string {
@@ -120,10 +127,33 @@ func (pp *proxySetProvider) ProxiesWithTouch() []C.Proxy {
 	return pp.Proxies()
 }
 
+// proxiesParse parses a clash yaml file, or a base64 encoded subscription of
+// ss:// and vless:// URIs whose invalid lines are skipped
 func proxiesParse(buf []byte) (interface{}, error) {
 	schema := &ProxySchema{}
 
-	if err := yaml.Unmarshal(buf, schema); err != nil {
+	lines, subscription := decodeSubscription(buf)
+	if subscription {
+		schema.Proxies = []map[string]interface{}{}
+		for idx, line := range lines {
+			var mapping map[string]interface{}
+			var err error
+			switch {
+			case strings.HasPrefix(line, "ss://"):
+				mapping, err = parseSIP002(line)
+			case strings.HasPrefix(line, "vless://"):
+				mapping, err = parseVlessURI(line)
+			default:
+				log.Warnln("[Provider] subscription line %d isn't a ss:// or vless:// URI, skip", idx)
+				continue
+			}
+			if err != nil {
+				log.Warnln("[Provider] subscription line %d error: %s, skip", idx, err.Error())
+				continue
+			}
+			schema.Proxies = append(schema.Proxies, mapping)
+		}
+	} else if err := yaml.Unmarshal(buf, schema); err != nil {
 		return nil, err
 	}
 
@@ -134,7 +164,10 @@ func proxiesParse(buf []byte) (interface{}, error) {
 	proxies := []C.Proxy{}
 	for idx, mapping := range schema.Proxies {
 		proxy, err := outbound.ParseProxy(mapping)
-		if err != nil {
+		if err != nil && subscription {
+			log.Warnln("[Provider] subscription proxy %s error: %s, skip", mapping["name"], err.Error())
+			continue
+		} else if err != nil {
 			return nil, fmt.Errorf("proxy %d error: %w", idx, err)
 		}
 		proxies = append(proxies, proxy)
@@ -200,6 +233,7 @@ func (cp *compatibleProvider) MarshalJSON() ([]byte, error) {
 		"type":        cp.Type().String(),
 		"vehicleType": cp.VehicleType().String(),
 		"proxies":     cp.Proxies(),
+		"healthCheck": cp.healthCheck.status(),
 	})
 }
 
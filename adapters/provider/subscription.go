@@ -0,0 +1,311 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubscriptionInfo is the Subscription-Userinfo header of a subscription,
+// the traffic is in bytes and zero Expire means no expiry
+type SubscriptionInfo struct {
+	Upload   int64      `json:"upload"`
+	Download int64      `json:"download"`
+	Total    int64      `json:"total"`
+	Expire   *time.Time `json:"expire"`
+}
+
+// parseSubscriptionInfo parses a header like
+// "upload=1234; download=2234; total=1024000; expire=2218532293"
+func parseSubscriptionInfo(header string) (*SubscriptionInfo, error) {
+	info := &SubscriptionInfo{}
+	for _, field := range strings.Split(header, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid field: %s", field)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field: %s", field)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "upload":
+			info.Upload = int64(value)
+		case "download":
+			info.Download = int64(value)
+		case "total":
+			info.Total = int64(value)
+		case "expire":
+			if value > 0 {
+				expire := time.Unix(int64(value), 0)
+				info.Expire = &expire
+			}
+		}
+	}
+	return info, nil
+}
+
+// decodeBase64 decodes the padded or raw, standard or URL base64
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	encodings := []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding}
+	for _, encoding := range encodings {
+		if buf, err := encoding.DecodeString(s); err == nil {
+			return buf, nil
+		}
+	}
+	return nil, errors.New("invalid base64")
+}
+
+// decodeSubscription returns the lines of a base64 encoded subscription, or
+// false if buf isn't one
+func decodeSubscription(buf []byte) ([]string, bool) {
+	content := string(bytes.Join(bytes.Fields(buf), nil))
+	if content == "" {
+		return nil, false
+	}
+
+	decoded, err := decodeBase64(content)
+	if err != nil {
+		return nil, false
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(string(decoded), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, true
+}
+
+// parseSIP002 converts a ss:// URI of SIP002 or the legacy format to a proxy
+// mapping
+func parseSIP002(uri string) (map[string]interface{}, error) {
+	// legacy format, ss://base64(method:password@host:port)#tag, the base64
+	// may contain '/' so it's decoded before url.Parse
+	if body := strings.SplitN(strings.TrimPrefix(uri, "ss://"), "#", 2); !strings.ContainsAny(body[0], "@?") {
+		return parseLegacySS(body)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil {
+		return nil, errors.New("missing method and password")
+	}
+
+	// the userinfo is base64(method:password), or percent encoded for the
+	// 2022 ciphers
+	var cipher, password string
+	if p, ok := u.User.Password(); ok {
+		cipher, password = u.User.Username(), p
+	} else {
+		decoded, err := decodeBase64(u.User.Username())
+		if err != nil {
+			return nil, err
+		}
+		userinfo := strings.SplitN(string(decoded), ":", 2)
+		if len(userinfo) != 2 {
+			return nil, errors.New("invalid method and password")
+		}
+		cipher, password = userinfo[0], userinfo[1]
+	}
+
+	mapping, err := ssMapping(u.Fragment, u.Hostname(), u.Port(), cipher, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if plugin := u.Query().Get("plugin"); plugin != "" {
+		if err := parseSIP003Plugin(plugin, mapping); err != nil {
+			return nil, err
+		}
+	}
+	return mapping, nil
+}
+
+// parseLegacySS converts the base64 and the optional tag of a legacy ss://
+// URI, the password may contain '@' and ':'
+func parseLegacySS(body []string) (map[string]interface{}, error) {
+	decoded, err := decodeBase64(strings.TrimSuffix(body[0], "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := string(decoded)
+	at := strings.LastIndex(s, "@")
+	if at < 0 {
+		return nil, errors.New("missing method and password")
+	}
+	userinfo := strings.SplitN(s[:at], ":", 2)
+	if len(userinfo) != 2 {
+		return nil, errors.New("invalid method and password")
+	}
+	host, port, err := net.SplitHostPort(s[at+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	name := ""
+	if len(body) == 2 {
+		if name, err = url.PathUnescape(body[1]); err != nil {
+			return nil, err
+		}
+	}
+	return ssMapping(name, host, port, userinfo[0], userinfo[1])
+}
+
+// ssMapping returns the mapping of a ss proxy, the name is host:port if empty
+func ssMapping(name, host, port, cipher, password string) (map[string]interface{}, error) {
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %s", port)
+	}
+
+	if name == "" {
+		name = net.JoinHostPort(host, port)
+	}
+
+	return map[string]interface{}{
+		"name":     name,
+		"type":     "ss",
+		"server":   host,
+		"port":     int(portNum),
+		"cipher":   cipher,
+		"password": password,
+		"udp":      true,
+	}, nil
+}
+
+// parseVlessURI converts a vless:// share link like
+// vless://uuid@host:port?type=ws&security=tls&path=/ws#name to a proxy mapping,
+// the reality security isn't supported
+func parseVlessURI(uri string) (map[string]interface{}, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("missing uuid")
+	}
+
+	host, port := u.Hostname(), u.Port()
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %s", port)
+	}
+
+	name := u.Fragment
+	if name == "" {
+		name = net.JoinHostPort(host, port)
+	}
+
+	query := u.Query()
+	mapping := map[string]interface{}{
+		"name":   name,
+		"type":   "vless",
+		"server": host,
+		"port":   int(portNum),
+		"uuid":   u.User.Username(),
+		"udp":    true,
+	}
+	if flow := query.Get("flow"); flow != "" {
+		mapping["flow"] = flow
+	}
+
+	switch security := query.Get("security"); security {
+	case "", "none":
+	case "tls":
+		mapping["tls"] = true
+		if sni := query.Get("sni"); sni != "" {
+			mapping["servername"] = sni
+		}
+		if fp := query.Get("fp"); fp != "" {
+			mapping["client-fingerprint"] = fp
+		}
+		if allowInsecure := query.Get("allowInsecure"); allowInsecure == "1" || allowInsecure == "true" {
+			mapping["skip-cert-verify"] = true
+		}
+	default:
+		return nil, fmt.Errorf("unsupported security: %s", security)
+	}
+
+	switch network := query.Get("type"); network {
+	case "", "tcp":
+		if headerType := query.Get("headerType"); headerType != "" && headerType != "none" {
+			return nil, fmt.Errorf("unsupported tcp header: %s", headerType)
+		}
+	case "ws":
+		mapping["network"] = "ws"
+		opts := map[string]interface{}{}
+		if path := query.Get("path"); path != "" {
+			opts["path"] = path
+		}
+		if h := query.Get("host"); h != "" {
+			opts["headers"] = map[string]interface{}{"Host": h}
+		}
+		mapping["ws-opts"] = opts
+	case "grpc":
+		mapping["network"] = "grpc"
+		mapping["grpc-opts"] = map[string]interface{}{
+			"grpc-service-name": query.Get("serviceName"),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+	return mapping, nil
+}
+
+// parseSIP003Plugin converts a plugin like "obfs-local;obfs=http;obfs-host=a.com"
+// to the plugin and the plugin-opts of mapping
+func parseSIP003Plugin(plugin string, mapping map[string]interface{}) error {
+	fields := strings.Split(plugin, ";")
+	opts := map[string]string{}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) == 2 {
+			opts[kv[0]] = kv[1]
+		} else {
+			opts[kv[0]] = "true"
+		}
+	}
+
+	switch fields[0] {
+	case "obfs-local", "simple-obfs":
+		mapping["plugin"] = "obfs"
+		mapping["plugin-opts"] = map[string]interface{}{
+			"mode": opts["obfs"],
+			"host": opts["obfs-host"],
+		}
+	case "v2ray-plugin":
+		mode := opts["mode"]
+		if mode == "" {
+			mode = "websocket"
+		}
+		mapping["plugin"] = "v2ray-plugin"
+		mapping["plugin-opts"] = map[string]interface{}{
+			"mode": mode,
+			"host": opts["host"],
+			"path": opts["path"],
+			"tls":  opts["tls"] == "true",
+			"mux":  opts["mux"] == "true",
+		}
+	default:
+		return fmt.Errorf("unsupported plugin: %s", fields[0])
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package provider
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSIP002(t *testing.T) {
+	cases := []struct {
+		uri      string
+		name     string
+		server   string
+		port     int
+		cipher   string
+		password string
+	}{
+		{
+			uri:  "ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpwYXNz@example.com:443#Tag%20A",
+			name: "Tag A", server: "example.com", port: 443,
+			cipher: "chacha20-ietf-poly1305", password: "pass",
+		},
+		{
+			uri:  "ss://2022-blake3-aes-128-gcm:YWJj%2BZA%3D%3D@[::1]:8388",
+			name: "[::1]:8388", server: "::1", port: 8388,
+			cipher: "2022-blake3-aes-128-gcm", password: "YWJj+ZA==",
+		},
+		{
+			// legacy base64 with '/'
+			uri:  "ss://YWVzLTEyOC1nY206YWJjPz8/QDEuMi4zLjQ6ODM4OA==#legacy",
+			name: "legacy", server: "1.2.3.4", port: 8388,
+			cipher: "aes-128-gcm", password: "abc???",
+		},
+		{
+			// legacy password with '@' and ':'
+			uri:  "ss://YWVzLTI1Ni1nY206cEBzczp3Pz4+QDEuMi4zLjQ6ODM4OA==",
+			name: "1.2.3.4:8388", server: "1.2.3.4", port: 8388,
+			cipher: "aes-256-gcm", password: "p@ss:w?>>",
+		},
+	}
+
+	for _, c := range cases {
+		mapping, err := parseSIP002(c.uri)
+		if !assert.Nil(t, err, c.uri) {
+			continue
+		}
+		assert.Equal(t, c.name, mapping["name"], c.uri)
+		assert.Equal(t, c.server, mapping["server"], c.uri)
+		assert.Equal(t, c.port, mapping["port"], c.uri)
+		assert.Equal(t, c.cipher, mapping["cipher"], c.uri)
+		assert.Equal(t, c.password, mapping["password"], c.uri)
+	}
+}
+
+func TestParseSIP002_Plugin(t *testing.T) {
+	mapping, err := parseSIP002("ss://YWVzLTEyOC1nY206dGVzdA@example.com:80/?plugin=obfs-local%3Bobfs%3Dhttp%3Bobfs-host%3Da.com#obfs")
+	assert.Nil(t, err)
+	assert.Equal(t, "obfs", mapping["plugin"])
+	assert.Equal(t, map[string]interface{}{"mode": "http", "host": "a.com"}, mapping["plugin-opts"])
+
+	mapping, err = parseSIP002("ss://YWVzLTEyOC1nY206dGVzdA@example.com:443?plugin=v2ray-plugin%3Btls%3Bhost%3Da.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2ray-plugin", mapping["plugin"])
+	assert.Equal(t, map[string]interface{}{
+		"mode": "websocket", "host": "a.com", "path": "", "tls": true, "mux": false,
+	}, mapping["plugin-opts"])
+}
+
+func TestParseSIP002_Error(t *testing.T) {
+	cases := []string{
+		"ss://bad",
+		"ss://YWVzLTEyOC1nY20@example.com:443",
+		"ss://YWVzLTEyOC1nY206dGVzdA@example.com:99999",
+		"ss://YWVzLTEyOC1nY206dGVzdA@example.com:443?plugin=kcptun",
+		// legacy without the host
+		"ss://YWVzLTEyOC1nY206dGVzdA==",
+	}
+
+	for _, uri := range cases {
+		_, err := parseSIP002(uri)
+		assert.NotNil(t, err, uri)
+	}
+}
+
+func TestDecodeSubscription(t *testing.T) {
+	cases := []struct {
+		buf   string
+		lines []string
+		ok    bool
+	}{
+		{
+			buf:   "c3M6Ly9ZV1Z6TFRFeU9DMW5ZMjA2ZEdWemRBQGV4YW1wbGUuY29tOjQ0MyNhCnZtZXNzOi8vYWJjCnNzOi8vYmFkCg==",
+			lines: []string{"ss://YWVzLTEyOC1nY206dGVzdA@example.com:443#a", "vmess://abc", "ss://bad"},
+			ok:    true,
+		},
+		{
+			// wrapped and unpadded
+			buf:   "c3M6Ly9ZV1Z6TFRFeU9DMW5ZMjA2ZEdWemRB\nQGV4YW1wbGUuY29tOjQ0MyNh\n",
+			lines: []string{"ss://YWVzLTEyOC1nY206dGVzdA@example.com:443#a"},
+			ok:    true,
+		},
+		{buf: "proxies:\n  - name: a\n", ok: false},
+		{buf: " \n", ok: false},
+	}
+
+	for _, c := range cases {
+		lines, ok := decodeSubscription([]byte(c.buf))
+		assert.Equal(t, c.ok, ok, c.buf)
+		assert.Equal(t, c.lines, lines, c.buf)
+	}
+}
+
+func TestParseSubscriptionInfo(t *testing.T) {
+	info, err := parseSubscriptionInfo("upload=1234; download=2234; total=1024000; expire=2218532293")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1234), info.Upload)
+	assert.Equal(t, int64(2234), info.Download)
+	assert.Equal(t, int64(1024000), info.Total)
+	if assert.NotNil(t, info.Expire) {
+		assert.Equal(t, time.Unix(2218532293, 0), *info.Expire)
+	}
+
+	info, err = parseSubscriptionInfo("Upload=1.5e3;total=10;expire=0;")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1500), info.Upload)
+	assert.Equal(t, int64(10), info.Total)
+	assert.Nil(t, info.Expire)
+
+	for _, header := range []string{"upload", "total=abc"} {
+		_, err := parseSubscriptionInfo(header)
+		assert.NotNil(t, err, header)
+	}
+}
+
+func TestProxiesParse_Subscription(t *testing.T) {
+	proxies, err := proxiesParse([]byte("c3M6Ly9ZV1Z6TFRFeU9DMW5ZMjA2ZEdWemRBQGV4YW1wbGUuY29tOjQ0MyNhCnZtZXNzOi8vYWJjCnNzOi8vYmFkCg=="))
+	assert.Nil(t, err)
+	assert.Len(t, proxies, 1)
+}
+
+func TestParseVlessURI(t *testing.T) {
+	uuid := "b831381d-6324-4d53-ad4f-8cda48b30811"
+	mapping, err := parseVlessURI("vless://" + uuid + "@example.com:443?type=ws&security=tls&sni=a.com&fp=chrome&path=%2Fws&host=b.com#WS%20TLS")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":               "WS TLS",
+		"type":               "vless",
+		"server":             "example.com",
+		"port":               443,
+		"uuid":               uuid,
+		"udp":                true,
+		"tls":                true,
+		"servername":         "a.com",
+		"client-fingerprint": "chrome",
+		"network":            "ws",
+		"ws-opts": map[string]interface{}{
+			"path":    "/ws",
+			"headers": map[string]interface{}{"Host": "b.com"},
+		},
+	}, mapping)
+
+	mapping, err = parseVlessURI("vless://" + uuid + "@example.com:443?type=grpc&security=tls&serviceName=svc")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com:443", mapping["name"])
+	assert.Equal(t, "grpc", mapping["network"])
+	assert.Equal(t, map[string]interface{}{"grpc-service-name": "svc"}, mapping["grpc-opts"])
+
+	for _, uri := range []string{
+		"vless://example.com:443",
+		"vless://" + uuid + "@example.com:443?security=reality",
+		"vless://" + uuid + "@example.com:443?type=kcp",
+		"vless://" + uuid + "@example.com:443?headerType=http",
+	} {
+		_, err := parseVlessURI(uri)
+		assert.NotNil(t, err, uri)
+	}
+}
+
+func TestProxiesParse_Vless(t *testing.T) {
+	lines := "vless://b831381d-6324-4d53-ad4f-8cda48b30811@example.com:443?security=tls#a\n" +
+		"vless://b831381d-6324-4d53-ad4f-8cda48b30811@example.com:443?security=tls&flow=xtls-rprx-vision#b\n"
+	proxies, err := proxiesParse([]byte(base64.StdEncoding.EncodeToString([]byte(lines))))
+	assert.Nil(t, err)
+	if assert.Len(t, proxies, 1) {
+		assert.Equal(t, "a", proxies.([]C.Proxy)[0].Name())
+	}
+}
@@ -2,14 +2,26 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/Dreamacro/clash/component/dialer"
+	"github.com/Dreamacro/clash/component/profile/cachefile"
+	C "github.com/Dreamacro/clash/constant"
 )
 
+// defaultUserAgent makes the subscriptions serve the clash format
+var defaultUserAgent = "clash/" + C.Version
+
+// errNotModified means the remote file is the same as the local one
+var errNotModified = errors.New("not modified")
+
 // Vehicle Type
 const (
 	File VehicleType = iota
@@ -60,8 +72,14 @@ func NewFileVehicle(path string) *FileVehicle {
 }
 
 type HTTPVehicle struct {
-	url  string
-	path string
+	url       string
+	path      string
+	userAgent string
+
+	mux              sync.Mutex
+	validator        *cachefile.Validator
+	pending          *cachefile.Validator
+	subscriptionInfo *SubscriptionInfo
 }
 
 func (h *HTTPVehicle) Type() VehicleType {
@@ -90,6 +108,22 @@ func (h *HTTPVehicle) Read() ([]byte, error) {
 		password, _ := user.Password()
 		req.SetBasicAuth(user.Username(), password)
 	}
+	req.Header.Set("User-Agent", h.userAgent)
+
+	h.mux.Lock()
+	h.pending = nil
+	h.mux.Unlock()
+
+	// only a conditional request if the local file exists
+	validator := h.loadValidator()
+	if _, err := os.Stat(h.path); err == nil && validator != nil {
+		if validator.ETag != "" {
+			req.Header.Set("If-None-Match", validator.ETag)
+		}
+		if validator.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validator.LastModified)
+		}
+	}
 
 	req = req.WithContext(ctx)
 
@@ -107,15 +141,95 @@ func (h *HTTPVehicle) Read() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
+	if header := resp.Header.Get("Subscription-Userinfo"); header != "" {
+		if info, err := parseSubscriptionInfo(header); err == nil {
+			h.mux.Lock()
+			h.subscriptionInfo = info
+			h.mux.Unlock()
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
+	}
 
 	buf, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	// the validators are saved once the file is parsed and saved
+	h.mux.Lock()
+	h.pending = &cachefile.Validator{
+		URL:          h.url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	h.mux.Unlock()
+
 	return buf, nil
 }
 
-func NewHTTPVehicle(url string, path string) *HTTPVehicle {
-	return &HTTPVehicle{url, path}
+// SubscriptionInfo returns nil if the server doesn't send the
+// Subscription-Userinfo header
+func (h *HTTPVehicle) SubscriptionInfo() *SubscriptionInfo {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.subscriptionInfo
+}
+
+func (h *HTTPVehicle) loadValidator() *cachefile.Validator {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.validator == nil {
+		// validators of another url are stale
+		if validator, ok := cachefile.Cache().Validator(h.path); ok && validator.URL == h.url {
+			h.validator = &validator
+		} else {
+			h.validator = &cachefile.Validator{URL: h.url}
+		}
+	}
+	return h.validator
+}
+
+func (h *HTTPVehicle) storeValidator(validator *cachefile.Validator) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.validator = validator
+	cachefile.Cache().SetValidator(h.path, *validator)
+}
+
+// saveValidator stores the validators of the file downloaded by the last
+// Read, it must be called after the file is parsed and saved
+func (h *HTTPVehicle) saveValidator() {
+	h.mux.Lock()
+	validator := h.pending
+	h.pending = nil
+	h.mux.Unlock()
+
+	if validator != nil {
+		h.storeValidator(validator)
+	}
+}
+
+// resetValidator makes the next Read download the whole file, e.g. the local file is broken
+func (h *HTTPVehicle) resetValidator() {
+	h.storeValidator(&cachefile.Validator{URL: h.url})
+}
+
+// NewHTTPVehicle returns a vehicle of url, empty userAgent means the default
+// one of clash
+func NewHTTPVehicle(url string, path string, userAgent string) *HTTPVehicle {
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	return &HTTPVehicle{url: url, path: path, userAgent: userAgent}
 }
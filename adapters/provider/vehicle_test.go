@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPVehicle_Subscription(t *testing.T) {
+	C.SetHomeDir(t.TempDir())
+
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Header().Set("Subscription-Userinfo", "upload=1; download=2; total=3")
+		w.Write([]byte("proxies: []\n"))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "provider.yaml")
+	vehicle := NewHTTPVehicle(server.URL, path, "")
+	assert.Nil(t, vehicle.SubscriptionInfo())
+
+	buf, err := vehicle.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "proxies: []\n", string(buf))
+	assert.Equal(t, "clash/"+C.Version, userAgent)
+	info := vehicle.SubscriptionInfo()
+	require.NotNil(t, info)
+	assert.Equal(t, int64(1), info.Upload)
+	assert.Equal(t, int64(2), info.Download)
+	assert.Equal(t, int64(3), info.Total)
+
+	vehicle = NewHTTPVehicle(server.URL, path, "ClashForAndroid")
+	_, err = vehicle.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "ClashForAndroid", userAgent)
+}
@@ -112,6 +112,19 @@ func (c *LruCache) Exist(key interface{}) bool {
 	return ok
 }
 
+// Peek returns the value of key but not put item to the head of linked list,
+// the maxAge of element isn't checked
+func (c *LruCache) Peek(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	le, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	return le.Value.(*entry).value, true
+}
+
 // Set stores the interface{} representation of a response for a given key.
 func (c *LruCache) Set(key interface{}, value interface{}) {
 	expires := int64(0)
@@ -198,6 +211,23 @@ func (c *LruCache) Delete(key interface{}) {
 	c.mu.Unlock()
 }
 
+// DeleteFunc removes the entries for which fn returns true, and returns the number of removed entries.
+func (c *LruCache) DeleteFunc(fn func(key interface{}, value interface{}) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for le := c.lru.Front(); le != nil; {
+		next := le.Next()
+		if e := le.Value.(*entry); fn(e.key, e.value) {
+			c.deleteElement(le)
+			n++
+		}
+		le = next
+	}
+	return n
+}
+
 func (c *LruCache) maybeDeleteOldest() {
 	if !c.staleReturn && c.maxAge > 0 {
 		now := time.Now().Unix()
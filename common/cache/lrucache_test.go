@@ -124,6 +124,21 @@ func TestExist(t *testing.T) {
 	assert.False(t, c.Exist(1))
 }
 
+func TestPeek(t *testing.T) {
+	c := NewLRUCache(WithSize(2))
+	c.Set(1, 2)
+	c.Set(2, 3)
+
+	value, ok := c.Peek(1)
+	assert.True(t, ok)
+	assert.Equal(t, 2, value)
+
+	// the peeked one is still the oldest
+	c.Set(3, 4)
+	_, ok = c.Peek(1)
+	assert.False(t, ok)
+}
+
 func TestEvict(t *testing.T) {
 	temp := 0
 	evict := func(key interface{}, value interface{}) {
@@ -182,3 +197,19 @@ func TestCloneTo(t *testing.T) {
 	n.Set("5", 5)
 	assert.False(t, n.Exist("1"))
 }
+
+func TestDeleteFunc(t *testing.T) {
+	evicted := 0
+	c := NewLRUCache(WithEvict(func(key interface{}, value interface{}) { evicted++ }))
+	for i := 0; i < 10; i++ {
+		c.Set(i, i)
+	}
+
+	n := c.DeleteFunc(func(key interface{}, value interface{}) bool {
+		return value.(int)%2 == 0
+	})
+	assert.Equal(t, 5, n)
+	assert.Equal(t, 5, evicted)
+	assert.False(t, c.Exist(0))
+	assert.True(t, c.Exist(1))
+}
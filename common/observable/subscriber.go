@@ -11,8 +11,13 @@ type Subscriber struct {
 	once   sync.Once
 }
 
+// Emit sends item to the subscriber, it is dropped if the buffer is full
+// so that a slow subscriber doesn't block the source
 func (s *Subscriber) Emit(item interface{}) {
-	s.buffer <- item
+	select {
+	case s.buffer <- item:
+	default:
+	}
 }
 
 func (s *Subscriber) Out() Subscription {
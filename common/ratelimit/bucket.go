@@ -0,0 +1,135 @@
+// Package ratelimit limits the throughput of connections by token buckets
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket of bytes, the capacity is the bytes of a second.
+// It also measures the throughput of the last second.
+type Bucket struct {
+	mux    sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+
+	window      time.Time
+	windowBytes int64
+	lastRate    int64
+
+	clock clock
+}
+
+// clock is the time source of a Bucket, it's replaced in the tests
+type clock struct {
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+var systemClock = clock{now: time.Now, sleep: time.Sleep}
+
+// NewBucket returns a full bucket refilled by rate bytes per second
+func NewBucket(rate int64) *Bucket {
+	return newBucket(rate, systemClock)
+}
+
+func newBucket(rate int64, clock clock) *Bucket {
+	now := clock.now()
+	return &Bucket{
+		rate:   rate,
+		tokens: float64(rate),
+		last:   now,
+		window: now,
+		clock:  clock,
+	}
+}
+
+// Rate returns the limit in bytes per second
+func (b *Bucket) Rate() int64 {
+	return b.rate
+}
+
+// Burst returns the max bytes taken without waiting
+func (b *Bucket) Burst() int {
+	return int(b.rate)
+}
+
+// Wait takes n bytes, it blocks until the bucket is refilled if there isn't
+// enough. The debt of a n larger than the capacity is paid by the later callers.
+func (b *Bucket) Wait(n int) {
+	if n <= 0 {
+		return
+	}
+
+	b.mux.Lock()
+	now := b.clock.now()
+	b.refill(now)
+	b.account(now, int64(n))
+
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+	}
+	b.mux.Unlock()
+
+	if wait > 0 {
+		b.clock.sleep(wait)
+	}
+}
+
+// TryTake takes n bytes if there are enough tokens, it never blocks
+func (b *Bucket) TryTake(n int) bool {
+	if n <= 0 {
+		return true
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := b.clock.now()
+	b.refill(now)
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.account(now, int64(n))
+	b.tokens -= float64(n)
+	return true
+}
+
+// Throughput returns the bytes taken in the last second
+func (b *Bucket) Throughput() int64 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.account(b.clock.now(), 0)
+	return b.lastRate
+}
+
+func (b *Bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+	b.last = now
+
+	b.tokens += elapsed.Seconds() * float64(b.rate)
+	if b.tokens > float64(b.rate) {
+		b.tokens = float64(b.rate)
+	}
+}
+
+// account adds n to the bytes of the current one second window
+func (b *Bucket) account(now time.Time, n int64) {
+	if elapsed := now.Sub(b.window); elapsed >= time.Second {
+		if elapsed >= 2*time.Second {
+			b.lastRate = 0
+		} else {
+			b.lastRate = b.windowBytes
+		}
+		b.window = now
+		b.windowBytes = 0
+	}
+	b.windowBytes += n
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock advances by the sleeps instead of waiting
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) clock() clock {
+	return clock{
+		now: func() time.Time { return c.now },
+		sleep: func(d time.Duration) {
+			c.slept += d
+			c.now = c.now.Add(d)
+		},
+	}
+}
+
+func TestBucket_Wait(t *testing.T) {
+	c := &fakeClock{now: time.Unix(0, 0)}
+	b := newBucket(1000, c.clock())
+
+	b.Wait(1000)
+	assert.Equal(t, time.Duration(0), c.slept)
+
+	b.Wait(500)
+	assert.Equal(t, 500*time.Millisecond, c.slept)
+
+	c.now = c.now.Add(time.Second)
+	b.Wait(1000)
+	assert.Equal(t, 500*time.Millisecond, c.slept)
+}
+
+func TestBucket_TryTake(t *testing.T) {
+	c := &fakeClock{now: time.Unix(0, 0)}
+	b := newBucket(1000, c.clock())
+
+	assert.True(t, b.TryTake(600))
+	assert.False(t, b.TryTake(600))
+	assert.True(t, b.TryTake(400))
+
+	c.now = c.now.Add(300 * time.Millisecond)
+	assert.False(t, b.TryTake(400))
+	assert.True(t, b.TryTake(300))
+	assert.Equal(t, time.Duration(0), c.slept)
+}
+
+func TestBucket_Throughput(t *testing.T) {
+	c := &fakeClock{now: time.Unix(0, 0)}
+	b := newBucket(1<<20, c.clock())
+	b.Wait(1000)
+	assert.Equal(t, int64(0), b.Throughput())
+
+	c.now = c.now.Add(time.Second)
+	assert.Equal(t, int64(1000), b.Throughput())
+
+	c.now = c.now.Add(2 * time.Second)
+	assert.Equal(t, int64(0), b.Throughput())
+}
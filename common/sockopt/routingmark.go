@@ -0,0 +1,8 @@
+package sockopt
+
+import (
+	"errors"
+)
+
+// ErrRoutingMarkNotSupported means SO_MARK isn't supported on the platform
+var ErrRoutingMarkNotSupported = errors.New("routing mark not supported")
@@ -0,0 +1,19 @@
+package sockopt
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// RoutingMark sets the SO_MARK of a socket, which is matched by the policy
+// routing rules, it requires CAP_NET_ADMIN
+func RoutingMark(rc syscall.RawConn, mark int) (err error) {
+	cerr := rc.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, mark)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
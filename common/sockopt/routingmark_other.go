@@ -0,0 +1,12 @@
+// +build !linux
+
+package sockopt
+
+import (
+	"syscall"
+)
+
+// RoutingMark returns ErrRoutingMarkNotSupported
+func RoutingMark(rc syscall.RawConn, mark int) error {
+	return ErrRoutingMarkNotSupported
+}
@@ -0,0 +1,8 @@
+package sockopt
+
+import (
+	"errors"
+)
+
+// ErrTFONotSupported means TCP Fast Open isn't supported on the platform
+var ErrTFONotSupported = errors.New("TCP Fast Open not supported")
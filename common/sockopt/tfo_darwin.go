@@ -0,0 +1,27 @@
+package sockopt
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// TCPFastOpenListen enables TCP Fast Open on a listening socket
+func TCPFastOpenListen(rc syscall.RawConn) (err error) {
+	cerr := rc.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, 1)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	if err == unix.ENOPROTOOPT {
+		return ErrTFONotSupported
+	}
+	return
+}
+
+// TCPFastOpenConnect returns ErrTFONotSupported, the client side TFO of
+// macOS requires connectx which isn't used by the net package
+func TCPFastOpenConnect(rc syscall.RawConn) error {
+	return ErrTFONotSupported
+}
@@ -0,0 +1,41 @@
+package sockopt
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// tfoQueueLength is the max number of pending TFO connection requests of a listener
+const tfoQueueLength = 256
+
+// TCPFastOpenListen enables TCP Fast Open on a listening socket
+func TCPFastOpenListen(rc syscall.RawConn) (err error) {
+	cerr := rc.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, tfoQueueLength)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return tfoError(err)
+}
+
+// TCPFastOpenConnect enables TCP Fast Open on a socket to be connected, the
+// SYN is deferred until the first write, which carries the data
+func TCPFastOpenConnect(rc syscall.RawConn) (err error) {
+	cerr := rc.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN_CONNECT, 1)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return tfoError(err)
+}
+
+// tfoError returns ErrTFONotSupported if the kernel doesn't know the option
+func tfoError(err error) error {
+	if err == unix.ENOPROTOOPT {
+		return ErrTFONotSupported
+	}
+	return err
+}
@@ -0,0 +1,17 @@
+// +build !linux,!darwin
+
+package sockopt
+
+import (
+	"syscall"
+)
+
+// TCPFastOpenListen returns ErrTFONotSupported
+func TCPFastOpenListen(rc syscall.RawConn) error {
+	return ErrTFONotSupported
+}
+
+// TCPFastOpenConnect returns ErrTFONotSupported
+func TCPFastOpenConnect(rc syscall.RawConn) error {
+	return ErrTFONotSupported
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"sync"
 )
 
@@ -21,7 +22,7 @@ type inMemoryAuthenticator struct {
 
 func (au *inMemoryAuthenticator) Verify(user string, pass string) bool {
 	realPass, ok := au.storage.Load(user)
-	return ok && realPass == pass
+	return ok && subtle.ConstantTimeCompare([]byte(realPass.(string)), []byte(pass)) == 1
 }
 
 func (au *inMemoryAuthenticator) Users() []string { return au.usernames }
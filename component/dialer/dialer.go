@@ -4,8 +4,20 @@ import (
 	"context"
 	"errors"
 	"net"
+	"time"
 
 	"github.com/Dreamacro/clash/component/resolver"
+
+	"go.uber.org/atomic"
+)
+
+var (
+	// PreferIPv6 means IPv6 is dialed first if the host has both IPv4 and IPv6 addresses
+	PreferIPv6 = atomic.NewBool(false)
+
+	// FallbackDelay is how long to wait for the preferred address family
+	// before dialing the other one, both are dialed at once if it's zero
+	FallbackDelay = atomic.NewDuration(0)
 )
 
 func Dialer() (*net.Dialer, error) {
@@ -53,8 +65,19 @@ func DialContext(ctx context.Context, network, address string) (net.Conn, error)
 				return nil, err
 			}
 		}
+		tcpFastOpen(ctx, dialer, network)
+		dialer.Control = routingMarkControl(ctx, dialer.Control)
 		return dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
 	case "tcp", "udp":
+		// an IP has no other family to race
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			if ip := net.ParseIP(host); ip != nil {
+				if ip.To4() != nil {
+					return DialContext(ctx, network+"4", address)
+				}
+				return DialContext(ctx, network+"6", address)
+			}
+		}
 		return dualStackDialContext(ctx, network, address)
 	default:
 		return nil, errors.New("network invalid")
@@ -62,6 +85,11 @@ func DialContext(ctx context.Context, network, address string) (net.Conn, error)
 }
 
 func ListenPacket(network, address string) (net.PacketConn, error) {
+	return ListenPacketContext(context.Background(), network, address)
+}
+
+// ListenPacketContext listens with the routing mark of ctx
+func ListenPacketContext(ctx context.Context, network, address string) (net.PacketConn, error) {
 	cfg := &net.ListenConfig{}
 	if ListenPacketHook != nil {
 		var err error
@@ -71,15 +99,22 @@ func ListenPacket(network, address string) (net.PacketConn, error) {
 		}
 	}
 
-	return cfg.ListenPacket(context.Background(), network, address)
+	cfg.Control = routingMarkControl(ctx, cfg.Control)
+	return cfg.ListenPacket(ctx, network, address)
 }
 
+// dualStackDialContext dials both address families as RFC 8305 Happy Eyeballs,
+// the other family is dialed if the preferred one fails or doesn't connect in
+// FallbackDelay. Both are dialed at once if FallbackDelay is zero.
 func dualStackDialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	host, port, err := net.SplitHostPort(address)
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	returned := make(chan struct{})
 	defer close(returned)
 
@@ -88,13 +123,15 @@ func dualStackDialContext(ctx context.Context, network, address string) (net.Con
 		error
 		resolved bool
 		ipv6     bool
+		primary  bool
 		done     bool
 	}
 	results := make(chan dialResult)
+	fallbackStart := make(chan struct{})
 	var primary, fallback dialResult
 
-	startRacer := func(ctx context.Context, network, host string, ipv6 bool) {
-		result := dialResult{ipv6: ipv6, done: true}
+	startRacer := func(ctx context.Context, network, host string, ipv6, isPrimary bool) {
+		result := dialResult{ipv6: ipv6, primary: isPrimary, done: true}
 		defer func() {
 			select {
 			case results <- result:
@@ -122,38 +159,76 @@ func dualStackDialContext(ctx context.Context, network, address string) (net.Con
 		}
 		result.resolved = true
 
+		if !isPrimary {
+			select {
+			case <-fallbackStart:
+			case <-ctx.Done():
+				result.error = ctx.Err()
+				return
+			}
+		}
+
 		if DialHook != nil {
 			if result.error = DialHook(dialer, network, ip); result.error != nil {
 				return
 			}
 		}
+		// no TCP Fast Open, the connection would win the race before its
+		// SYN is sent by the first write
+		dialer.Control = routingMarkControl(ctx, dialer.Control)
 		result.Conn, result.error = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
 	}
 
-	go startRacer(ctx, network+"4", host, false)
-	go startRacer(ctx, network+"6", host, true)
+	preferIPv6 := PreferIPv6.Load()
+	go startRacer(ctx, network+"4", host, false, !preferIPv6)
+	go startRacer(ctx, network+"6", host, true, preferIPv6)
 
-	for res := range results {
-		if res.error == nil {
-			return res.Conn, nil
+	fallbackStarted := false
+	startFallback := func() {
+		if !fallbackStarted {
+			fallbackStarted = true
+			close(fallbackStart)
 		}
+	}
 
-		if !res.ipv6 {
-			primary = res
-		} else {
-			fallback = res
-		}
+	// a nil channel never fires if the fallback starts at once
+	var fallbackTimeout <-chan time.Time
+	if delay := FallbackDelay.Load(); delay > 0 {
+		fallbackTimer := time.NewTimer(delay)
+		defer fallbackTimer.Stop()
+		fallbackTimeout = fallbackTimer.C
+	} else {
+		startFallback()
+	}
 
-		if primary.done && fallback.done {
-			if primary.resolved {
-				return nil, primary.error
-			} else if fallback.resolved {
-				return nil, fallback.error
+	for {
+		select {
+		case <-fallbackTimeout:
+			startFallback()
+		case res := <-results:
+			if res.error == nil {
+				return res.Conn, nil
+			}
+
+			if res.primary {
+				primary = res
+				startFallback()
 			} else {
-				return nil, primary.error
+				fallback = res
+			}
+
+			if primary.done && fallback.done {
+				if primary.resolved {
+					return nil, primary.error
+				} else if fallback.resolved {
+					return nil, fallback.error
+				} else if primary.ipv6 {
+					// the error of IPv4 is more meaningful, IPv6 may be disabled
+					return nil, fallback.error
+				} else {
+					return nil, primary.error
+				}
 			}
 		}
 	}
-
-	return nil, errors.New("never touched")
 }
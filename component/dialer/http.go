@@ -0,0 +1,22 @@
+package dialer
+
+import (
+	"net/http"
+	"time"
+)
+
+// NewHTTPClient returns a client which dials with DialContext, the requests
+// are canceled if they don't finish in timeout
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			// from http.DefaultTransport
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			DialContext:           DialContext,
+		},
+		Timeout: timeout,
+	}
+}
@@ -0,0 +1,81 @@
+package dialer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"syscall"
+
+	"github.com/Dreamacro/clash/common/sockopt"
+	"github.com/Dreamacro/clash/log"
+
+	"go.uber.org/atomic"
+)
+
+// DefaultRoutingMark is the routing mark of the sockets whose context doesn't
+// set one, zero means no mark
+var DefaultRoutingMark = atomic.NewInt64(0)
+
+var unsupportedOnce sync.Once
+
+type routingMarkKey struct{}
+
+// WithRoutingMark returns a context which sets the routing mark of the
+// sockets dialed with it, zero mark is a no-op and a mark set by a parent
+// context takes precedence, so the mark of a rule overrides the one of a proxy
+func WithRoutingMark(ctx context.Context, mark int) context.Context {
+	if mark == 0 {
+		return ctx
+	}
+	if _, ok := ctx.Value(routingMarkKey{}).(int); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, routingMarkKey{}, mark)
+}
+
+// CheckRoutingMark returns an error if mark isn't a 32 bits unsigned integer
+func CheckRoutingMark(mark int64) error {
+	if mark < 0 || mark > math.MaxUint32 {
+		return fmt.Errorf("invalid routing mark: %d", mark)
+	}
+	return nil
+}
+
+// routingMarkControl wraps control to set the routing mark of ctx, it
+// returns control if there is no mark. The mark is ignored where the platform
+// doesn't support it.
+func routingMarkControl(ctx context.Context, control func(network, address string, c syscall.RawConn) error) func(network, address string, c syscall.RawConn) error {
+	mark := routingMark(ctx)
+	if mark == 0 {
+		return control
+	}
+
+	return func(network, address string, c syscall.RawConn) error {
+		if control != nil {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+
+		err := sockopt.RoutingMark(c, mark)
+		if err == sockopt.ErrRoutingMarkNotSupported {
+			unsupportedOnce.Do(func() {
+				log.Warnln("[Dialer] routing mark is only supported on Linux, it's ignored")
+			})
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("set routing mark %d: %w", mark, err)
+		}
+		return nil
+	}
+}
+
+// routingMark returns the routing mark of ctx, or the default one
+func routingMark(ctx context.Context) int {
+	if mark, ok := ctx.Value(routingMarkKey{}).(int); ok {
+		return mark
+	}
+	return int(DefaultRoutingMark.Load())
+}
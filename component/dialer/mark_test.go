@@ -0,0 +1,33 @@
+package dialer
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRoutingMark(t *testing.T) {
+	assert.NoError(t, CheckRoutingMark(0))
+	assert.NoError(t, CheckRoutingMark(math.MaxUint32))
+	assert.Error(t, CheckRoutingMark(-1))
+	assert.Error(t, CheckRoutingMark(math.MaxUint32+1))
+}
+
+func TestRoutingMark_Precedence(t *testing.T) {
+	DefaultRoutingMark.Store(1)
+	defer DefaultRoutingMark.Store(0)
+
+	const ruleMark, proxyMark = 3, 2
+
+	// the contexts are wrapped as an adapter does, the rule's mark first
+	ctx := WithRoutingMark(WithRoutingMark(context.Background(), ruleMark), proxyMark)
+	assert.Equal(t, ruleMark, routingMark(ctx))
+
+	ctx = WithRoutingMark(WithRoutingMark(context.Background(), 0), proxyMark)
+	assert.Equal(t, proxyMark, routingMark(ctx))
+
+	ctx = WithRoutingMark(WithRoutingMark(context.Background(), 0), 0)
+	assert.Equal(t, 1, routingMark(ctx))
+}
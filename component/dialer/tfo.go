@@ -0,0 +1,42 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/Dreamacro/clash/common/sockopt"
+)
+
+type tfoKey struct{}
+
+// WithTCPFastOpen returns a context which enables TCP Fast Open of the TCP
+// connections dialed with it, the connect errors may be returned by the first
+// write instead of the dial as the SYN is deferred. It doesn't apply to the
+// dual stack dial of a domain, which races the connections.
+func WithTCPFastOpen(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tfoKey{}, true)
+}
+
+// tcpFastOpen sets TCP Fast Open to the control of dialer if ctx enables it,
+// it is a no-op where the platform doesn't support it
+func tcpFastOpen(ctx context.Context, dialer *net.Dialer, network string) {
+	if enabled, _ := ctx.Value(tfoKey{}).(bool); !enabled || !strings.HasPrefix(network, "tcp") {
+		return
+	}
+
+	control := dialer.Control
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		if control != nil {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+
+		if err := sockopt.TCPFastOpenConnect(c); err != nil && err != sockopt.ErrTFONotSupported {
+			return err
+		}
+		return nil
+	}
+}
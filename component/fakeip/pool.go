@@ -2,13 +2,23 @@ package fakeip
 
 import (
 	"errors"
+	"math/big"
 	"net"
+	"strings"
 	"sync"
 
 	"github.com/Dreamacro/clash/common/cache"
 	"github.com/Dreamacro/clash/component/trie"
 )
 
+// Store is used to keep host --> ip bindings of Pool across restarts
+type Store interface {
+	Load(ipnet string) map[string]net.IP
+	Put(host string, ip net.IP)
+	// Delete removes the bindings of hosts in one transaction
+	Delete(hosts ...string)
+}
+
 // Pool is a implementation about fake ip generator without storage
 type Pool struct {
 	max     uint32
@@ -18,13 +28,30 @@ type Pool struct {
 	mux     sync.Mutex
 	host    *trie.DomainTrie
 	ipnet   *net.IPNet
+	ipnet6  *net.IPNet
 	cache   *cache.LruCache
+	store   Store
+
+	// evicted are the hosts evicted with mux held, they're deleted from
+	// store with the binding which evicted them
+	evicted []string
+	// pending are the writes to store in the order of the changes, one
+	// goroutine does them while writing is true
+	pending []storeWrite
+	writing bool
+}
+
+// storeWrite puts the binding of host if ip isn't nil and deletes the
+// evicted hosts
+type storeWrite struct {
+	host    string
+	ip      net.IP
+	evicted []string
 }
 
 // Lookup return a fake ip with host
 func (p *Pool) Lookup(host string) net.IP {
 	p.mux.Lock()
-	defer p.mux.Unlock()
 	if elm, exist := p.cache.Get(host); exist {
 		ip := elm.(net.IP)
 
@@ -32,20 +59,58 @@ func (p *Pool) Lookup(host string) net.IP {
 		n := ipToUint(ip.To4())
 		offset := n - p.min + 1
 		p.cache.Get(offset)
+		p.mux.Unlock()
 		return ip
 	}
 
 	ip := p.get(host)
 	p.cache.Set(host, ip)
+	p.persist(host, ip)
+	p.mux.Unlock()
 	return ip
 }
 
+// LookupIPv6 return a fake IPv6 address with host, it's bound to host with
+// the IPv4 address returned by Lookup. It returns nil if the pool has no IPv6 range.
+func (p *Pool) LookupIPv6(host string) net.IP {
+	if p.ipnet6 == nil {
+		return nil
+	}
+	return p.toIPv6(p.Lookup(host))
+}
+
+// Peek returns the fake ip bound to host without allocating one, the binding
+// isn't put to the head of linked list
+func (p *Pool) Peek(host string) (net.IP, bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	elm, exist := p.cache.Peek(host)
+	if !exist {
+		return nil, false
+	}
+	return elm.(net.IP), true
+}
+
+// PeekIPv6 is Peek of the fake IPv6 address, it returns false if the pool
+// has no IPv6 range
+func (p *Pool) PeekIPv6(host string) (net.IP, bool) {
+	if p.ipnet6 == nil {
+		return nil, false
+	}
+	ip, exist := p.Peek(host)
+	if !exist {
+		return nil, false
+	}
+	return p.toIPv6(ip), true
+}
+
 // LookBack return host with the fake ip
 func (p *Pool) LookBack(ip net.IP) (string, bool) {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 
-	if ip = ip.To4(); ip == nil {
+	if ip = p.toIPv4(ip); ip == nil {
 		return "", false
 	}
 
@@ -63,12 +128,12 @@ func (p *Pool) LookBack(ip net.IP) (string, bool) {
 	return "", false
 }
 
-// LookupHost return if domain in host
+// LookupHost return if domain in host, the domain is matched case-insensitively
 func (p *Pool) LookupHost(domain string) bool {
 	if p.host == nil {
 		return false
 	}
-	return p.host.Search(domain) != nil
+	return p.host.Search(strings.ToLower(domain)) != nil
 }
 
 // Exist returns if given ip exists in fake-ip pool
@@ -76,7 +141,7 @@ func (p *Pool) Exist(ip net.IP) bool {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 
-	if ip = ip.To4(); ip == nil {
+	if ip = p.toIPv4(ip); ip == nil {
 		return false
 	}
 
@@ -85,6 +150,29 @@ func (p *Pool) Exist(ip net.IP) bool {
 	return p.cache.Exist(offset)
 }
 
+// DeleteFunc removes the bindings of the hosts for which match returns true,
+// and returns the number of removed bindings
+func (p *Pool) DeleteFunc(match func(host string) bool) int {
+	p.mux.Lock()
+
+	n := 0
+	p.cache.DeleteFunc(func(key interface{}, value interface{}) bool {
+		switch key := key.(type) {
+		case string:
+			if match(key) {
+				n++
+				return true
+			}
+		case uint32:
+			return match(value.(string))
+		}
+		return false
+	})
+	p.persist("", nil)
+	p.mux.Unlock()
+	return n
+}
+
 // Gateway return gateway ip
 func (p *Pool) Gateway() net.IP {
 	return uintToIP(p.gateway)
@@ -95,11 +183,105 @@ func (p *Pool) IPNet() *net.IPNet {
 	return p.ipnet
 }
 
+// IPNet6 return raw IPv6 ipnet, it's nil if the pool has no IPv6 range
+func (p *Pool) IPNet6() *net.IPNet {
+	return p.ipnet6
+}
+
+// Contains reports whether ip is in the ranges of the pool and isn't a gateway
+func (p *Pool) Contains(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		return p.ipnet.Contains(ip4) && !p.Gateway().Equal(ip4)
+	}
+	return p.ipnet6 != nil && p.ipnet6.Contains(ip) && !p.toIPv6(p.Gateway()).Equal(ip)
+}
+
 // PatchFrom clone cache from old pool
 func (p *Pool) PatchFrom(o *Pool) {
 	o.cache.CloneTo(p.cache)
 }
 
+// Restore loads the bindings kept by store into the pool, and writes the
+// following bindings through to it. Bindings outside the pool range are dropped.
+func (p *Pool) Restore(store Store) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	invalid := []string{}
+	for host, ip := range store.Load(p.ipnet.String()) {
+		ip = ip.To4()
+		if ip == nil || !p.ipnet.Contains(ip) {
+			invalid = append(invalid, host)
+			continue
+		}
+
+		n := ipToUint(ip)
+		if n < p.min || n > p.max {
+			invalid = append(invalid, host)
+			continue
+		}
+
+		offset := n - p.min + 1
+		p.cache.Set(offset, host)
+		p.cache.Set(host, ip)
+		if offset > p.offset {
+			p.offset = offset
+		}
+	}
+
+	if len(invalid) > 0 {
+		store.Delete(invalid...)
+	}
+	p.store = store
+}
+
+func (p *Pool) onEvict(key interface{}, value interface{}) {
+	if host, ok := key.(string); ok && p.store != nil {
+		p.evicted = append(p.evicted, host)
+	}
+}
+
+// persist queues the write of the binding of host and the evicted hosts
+// with mux held, the writes are done by another goroutine so the lookups
+// don't wait for the disk
+func (p *Pool) persist(host string, ip net.IP) {
+	evicted := p.evicted
+	p.evicted = nil
+	if p.store == nil || (ip == nil && len(evicted) == 0) {
+		return
+	}
+
+	p.pending = append(p.pending, storeWrite{host: host, ip: ip, evicted: evicted})
+	if !p.writing {
+		p.writing = true
+		go p.writeLoop(p.store)
+	}
+}
+
+// writeLoop writes the pending changes to store until there are none left
+func (p *Pool) writeLoop(store Store) {
+	for {
+		p.mux.Lock()
+		pending := p.pending
+		p.pending = nil
+		if len(pending) == 0 {
+			p.writing = false
+			p.mux.Unlock()
+			return
+		}
+		p.mux.Unlock()
+
+		for _, w := range pending {
+			if w.ip != nil {
+				store.Put(w.host, w.ip)
+			}
+			if len(w.evicted) > 0 {
+				store.Delete(w.evicted...)
+			}
+		}
+	}
+}
+
 func (p *Pool) get(host string) net.IP {
 	current := p.offset
 	for {
@@ -118,6 +300,35 @@ func (p *Pool) get(host string) net.IP {
 	return ip
 }
 
+// toIPv6 maps an IPv4 address of the pool to the IPv6 range, both addresses
+// have the same offset from the network address
+func (p *Pool) toIPv6(ip net.IP) net.IP {
+	offset := ipToUint(ip.To4()) - ipToUint(p.ipnet.IP.To4())
+	n := new(big.Int).SetBytes(p.ipnet6.IP.To16())
+	n.Add(n, big.NewInt(int64(offset)))
+
+	ip6 := make(net.IP, net.IPv6len)
+	return n.FillBytes(ip6)
+}
+
+// toIPv4 returns the IPv4 address of ip in the pool, ip is mapped back if
+// it's in the IPv6 range. It returns nil if ip is out of the ranges.
+func (p *Pool) toIPv4(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	if p.ipnet6 == nil || !p.ipnet6.Contains(ip) {
+		return nil
+	}
+
+	n := new(big.Int).SetBytes(ip.To16())
+	n.Sub(n, new(big.Int).SetBytes(p.ipnet6.IP.To16()))
+	if !n.IsUint64() || n.Uint64() > uint64(p.max-ipToUint(p.ipnet.IP.To4())) {
+		return nil
+	}
+	return uintToIP(ipToUint(p.ipnet.IP.To4()) + uint32(n.Uint64()))
+}
+
 func ipToUint(ip net.IP) uint32 {
 	v := uint32(ip[0]) << 24
 	v += uint32(ip[1]) << 16
@@ -132,22 +343,39 @@ func uintToIP(v uint32) net.IP {
 
 // New return Pool instance
 func New(ipnet *net.IPNet, size int, host *trie.DomainTrie) (*Pool, error) {
+	return NewWithIPv6(ipnet, nil, size, host)
+}
+
+// NewWithIPv6 return Pool instance which also allocates the addresses of
+// ipnet6 if it isn't nil, the capacity is limited by the smaller range
+func NewWithIPv6(ipnet *net.IPNet, ipnet6 *net.IPNet, size int, host *trie.DomainTrie) (*Pool, error) {
 	min := ipToUint(ipnet.IP) + 2
 
 	ones, bits := ipnet.Mask.Size()
 	total := 1<<uint(bits-ones) - 2
 
+	if ipnet6 != nil {
+		if ipnet6.IP.To4() != nil {
+			return nil, errors.New("ipnet6 isn't an IPv6 range")
+		}
+		if ones, bits := ipnet6.Mask.Size(); bits-ones < 32 && 1<<uint(bits-ones)-2 < total {
+			total = 1<<uint(bits-ones) - 2
+		}
+	}
+
 	if total <= 0 {
 		return nil, errors.New("ipnet don't have valid ip")
 	}
 
 	max := min + uint32(total) - 1
-	return &Pool{
+	pool := &Pool{
 		min:     min,
 		max:     max,
 		gateway: min - 1,
 		host:    host,
 		ipnet:   ipnet,
-		cache:   cache.NewLRUCache(cache.WithSize(size * 2)),
-	}, nil
+		ipnet6:  ipnet6,
+	}
+	pool.cache = cache.NewLRUCache(cache.WithSize(size*2), cache.WithEvict(pool.onEvict))
+	return pool, nil
 }
@@ -2,7 +2,11 @@ package fakeip
 
 import (
 	"net"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/component/trie"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -21,6 +25,28 @@ func TestPool_Basic(t *testing.T) {
 	assert.Equal(t, bar, "bar.com")
 }
 
+func TestPool_Peek(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/29")
+	_, ipnet6, _ := net.ParseCIDR("fdfe:dcba:9876::/64")
+	pool, _ := NewWithIPv6(ipnet, ipnet6, 10, nil)
+
+	_, exist := pool.Peek("foo.com")
+	assert.False(t, exist)
+	_, exist = pool.PeekIPv6("foo.com")
+	assert.False(t, exist)
+
+	// peeking doesn't allocate
+	first := pool.Lookup("bar.com")
+	assert.True(t, first.Equal(net.IP{192, 168, 0, 2}))
+
+	ip, exist := pool.Peek("bar.com")
+	assert.True(t, exist)
+	assert.True(t, ip.Equal(first))
+	ip, exist = pool.PeekIPv6("bar.com")
+	assert.True(t, exist)
+	assert.True(t, ip.Equal(pool.LookupIPv6("bar.com")))
+}
+
 func TestPool_Cycle(t *testing.T) {
 	_, ipnet, _ := net.ParseCIDR("192.168.0.1/30")
 	pool, _ := New(ipnet, 10, nil)
@@ -76,3 +102,181 @@ func TestPool_Error(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestPool_LookupHost(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/24")
+	tree := trie.New()
+	tree.Insert("+.example.com", true)
+	tree.Insert("*.lan", true)
+	tree.Insert("time.windows.com", true)
+	pool, _ := New(ipnet, 10, tree)
+
+	assert.True(t, pool.LookupHost("example.com"))
+	assert.True(t, pool.LookupHost("a.b.Example.COM"))
+	assert.True(t, pool.LookupHost("router.lan"))
+	assert.False(t, pool.LookupHost("a.router.lan"))
+	assert.True(t, pool.LookupHost("Time.Windows.com"))
+	assert.False(t, pool.LookupHost("windows.com"))
+}
+
+type memoryStore map[string]net.IP
+
+// waitStore waits until the pending writes of pool are done
+func waitStore(pool *Pool) {
+	for {
+		pool.mux.Lock()
+		writing := pool.writing
+		pool.mux.Unlock()
+		if !writing {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (m memoryStore) Load(ipnet string) map[string]net.IP { return m }
+func (m memoryStore) Put(host string, ip net.IP)          { m[host] = ip }
+
+func (m memoryStore) Delete(hosts ...string) {
+	for _, host := range hosts {
+		delete(m, host)
+	}
+}
+
+func TestPool_Restore(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/24")
+	pool, _ := New(ipnet, 10, nil)
+	store := memoryStore{
+		"foo.com": net.IP{192, 168, 0, 5},
+		"bar.com": net.IP{10, 0, 0, 1},
+	}
+	pool.Restore(store)
+
+	foo, exist := pool.LookBack(net.IP{192, 168, 0, 5})
+	assert.True(t, exist)
+	assert.Equal(t, "foo.com", foo)
+	assert.True(t, pool.Lookup("foo.com").Equal(net.IP{192, 168, 0, 5}))
+	assert.NotContains(t, store, "bar.com")
+
+	baz := pool.Lookup("baz.com")
+	assert.True(t, baz.Equal(net.IP{192, 168, 0, 6}))
+	waitStore(pool)
+	assert.True(t, store["baz.com"].Equal(baz))
+}
+
+func TestPool_DeleteFunc(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/24")
+	pool, _ := New(ipnet, 10, nil)
+
+	foo := pool.Lookup("foo.com")
+	bar := pool.Lookup("bar.com")
+
+	n := pool.DeleteFunc(func(host string) bool { return host == "foo.com" })
+	assert.Equal(t, 1, n)
+	assert.False(t, pool.Exist(foo))
+	assert.True(t, pool.Exist(bar))
+
+	_, exist := pool.LookBack(foo)
+	assert.False(t, exist)
+}
+
+// batchStore counts the calls of Delete
+type batchStore struct {
+	memoryStore
+	deletes int
+}
+
+func (b *batchStore) Delete(hosts ...string) {
+	b.deletes++
+	b.memoryStore.Delete(hosts...)
+}
+
+func TestPool_DeleteFuncStore(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/24")
+	pool, _ := New(ipnet, 10, nil)
+	store := &batchStore{memoryStore: memoryStore{}}
+	pool.Restore(store)
+
+	for _, host := range []string{"a.foo.com", "b.foo.com", "bar.com"} {
+		pool.Lookup(host)
+	}
+
+	n := pool.DeleteFunc(func(host string) bool { return strings.HasSuffix(host, ".foo.com") })
+	assert.Equal(t, 2, n)
+	waitStore(pool)
+	assert.Equal(t, 1, store.deletes)
+	assert.NotContains(t, store.memoryStore, "a.foo.com")
+	assert.NotContains(t, store.memoryStore, "b.foo.com")
+	assert.Contains(t, store.memoryStore, "bar.com")
+}
+
+func TestPool_IPv6(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/24")
+	_, ipnet6, _ := net.ParseCIDR("fdfe::/120")
+	pool, _ := NewWithIPv6(ipnet, ipnet6, 10, nil)
+
+	foo6 := pool.LookupIPv6("foo.com")
+	foo := pool.Lookup("foo.com")
+	assert.True(t, foo.Equal(net.IP{192, 168, 0, 2}))
+	assert.True(t, foo6.Equal(net.ParseIP("fdfe::2")))
+
+	host, exist := pool.LookBack(foo6)
+	assert.True(t, exist)
+	assert.Equal(t, "foo.com", host)
+	assert.True(t, pool.Exist(foo6))
+	assert.True(t, pool.Contains(net.ParseIP("fdfe::ff")))
+	assert.False(t, pool.Contains(net.ParseIP("fdfe::1")))
+	assert.False(t, pool.Contains(net.ParseIP("fdfe::100")))
+}
+
+func TestPool_IPv6Capacity(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/24")
+	_, ipnet6, _ := net.ParseCIDR("fdfe::/126")
+	pool, _ := NewWithIPv6(ipnet, ipnet6, 10, nil)
+
+	first := pool.Lookup("foo.com")
+	same := pool.Lookup("baz.com")
+	assert.True(t, first.Equal(same))
+}
+
+// blockingStore blocks Put until release is closed
+type blockingStore struct {
+	memoryStore
+	put     chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStore) Put(host string, ip net.IP) {
+	select {
+	case b.put <- struct{}{}:
+	default:
+	}
+	<-b.release
+}
+
+func TestPool_LookupNotBlockedByStore(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/24")
+	pool, _ := New(ipnet, 10, nil)
+	foo := pool.Lookup("foo.com")
+
+	store := &blockingStore{memoryStore: memoryStore{}, put: make(chan struct{}), release: make(chan struct{})}
+	pool.Restore(store)
+	defer close(store.release)
+
+	go pool.Lookup("bar.com")
+	<-store.put
+
+	// neither a cached host nor a new one waits for the store
+	for _, host := range []string{"foo.com", "baz.com"} {
+		done := make(chan net.IP)
+		go func() { done <- pool.Lookup(host) }()
+		select {
+		case ip := <-done:
+			if host == "foo.com" {
+				assert.True(t, ip.Equal(foo))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("lookup of %s is blocked by the store", host)
+		}
+	}
+}
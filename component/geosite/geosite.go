@@ -0,0 +1,301 @@
+// Package geosite reads the geosite database of v2ray (e.g. dlc.dat of
+// domain-list-community) and matches domains against its categories.
+package geosite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// domain types of v2ray routing config
+const (
+	typePlain  = 0 // keyword
+	typeRegex  = 1
+	typeDomain = 2 // the domain and its subdomains
+	typeFull   = 3
+)
+
+var (
+	errInvalidData = errors.New("invalid geosite data")
+
+	// ErrCodeNotFound means the category isn't in the geosite database
+	ErrCodeNotFound = errors.New("geosite code not found")
+)
+
+type domain struct {
+	tp         uint64
+	value      string
+	attributes []string
+}
+
+// GeoSite is a parsed geosite database, the domains of a category are only
+// decoded when the category is requested
+type GeoSite struct {
+	entries map[string][]byte
+
+	mux      sync.RWMutex
+	matchers map[string]*Matcher
+}
+
+// Parse indexes the categories of a geosite database
+func Parse(data []byte) (*GeoSite, error) {
+	entries := map[string][]byte{}
+	err := walk(data, func(field int, value []byte) error {
+		// GeoSiteList.entry
+		if field != 1 {
+			return nil
+		}
+
+		code := ""
+		err := walk(value, func(field int, v []byte) error {
+			// GeoSite.country_code
+			if field == 1 {
+				code = strings.ToUpper(string(v))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		entries[code] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &GeoSite{
+		entries:  entries,
+		matchers: map[string]*Matcher{},
+	}, nil
+}
+
+// Len returns the number of categories
+func (g *GeoSite) Len() int {
+	return len(g.entries)
+}
+
+// Matcher returns the matcher of code, code is case insensitive and can be
+// filtered by attribute, e.g. `google@cn`
+func (g *GeoSite) Matcher(code string) (*Matcher, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	g.mux.RLock()
+	m, ok := g.matchers[code]
+	g.mux.RUnlock()
+	if ok {
+		return m, nil
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	name, attribute := code, ""
+	if idx := strings.IndexByte(code, '@'); idx != -1 {
+		name, attribute = code[:idx], strings.ToLower(code[idx+1:])
+	}
+
+	entry, ok := g.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCodeNotFound, name)
+	}
+
+	domains, err := decodeDomains(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	m = newMatcher()
+	for _, d := range domains {
+		if attribute != "" && !d.hasAttribute(attribute) {
+			continue
+		}
+
+		if err := m.add(d); err != nil {
+			return nil, err
+		}
+	}
+
+	g.matchers[code] = m
+	return m, nil
+}
+
+// codes returns the categories that have been requested
+func (g *GeoSite) codes() []string {
+	g.mux.RLock()
+	defer g.mux.RUnlock()
+
+	codes := make([]string, 0, len(g.matchers))
+	for code := range g.matchers {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+func (d *domain) hasAttribute(attribute string) bool {
+	for _, attr := range d.attributes {
+		if attr == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeDomains(entry []byte) ([]domain, error) {
+	domains := []domain{}
+	err := walk(entry, func(field int, value []byte) error {
+		// GeoSite.domain
+		if field != 2 {
+			return nil
+		}
+
+		d := domain{}
+		err := walk(value, func(field int, v []byte) error {
+			switch field {
+			case 1:
+				tp, n := binary.Uvarint(v)
+				if n <= 0 {
+					return errInvalidData
+				}
+				d.tp = tp
+			case 2:
+				d.value = string(v)
+			case 3:
+				// Domain.Attribute.key
+				return walk(v, func(field int, key []byte) error {
+					if field == 1 {
+						d.attributes = append(d.attributes, strings.ToLower(string(key)))
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		domains = append(domains, d)
+		return nil
+	})
+
+	return domains, err
+}
+
+// walk calls fn with every field of a protobuf message, varint fields are
+// passed as the raw varint bytes
+func walk(data []byte, fn func(field int, value []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errInvalidData
+		}
+		data = data[n:]
+
+		var value []byte
+		switch key & 7 {
+		case 0: // varint
+			_, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errInvalidData
+			}
+			value, data = data[:n], data[n:]
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return errInvalidData
+			}
+			value, data = data[:8], data[8:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errInvalidData
+			}
+			value, data = data[n:n+int(length)], data[n+int(length):]
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return errInvalidData
+			}
+			value, data = data[:4], data[4:]
+		default:
+			return errInvalidData
+		}
+
+		if err := fn(int(key>>3), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Matcher matches domains of a geosite category
+type Matcher struct {
+	full     map[string]struct{}
+	suffix   map[string]struct{}
+	keywords []string
+	regexps  []*regexp.Regexp
+}
+
+func newMatcher() *Matcher {
+	return &Matcher{
+		full:   map[string]struct{}{},
+		suffix: map[string]struct{}{},
+	}
+}
+
+func (m *Matcher) add(d domain) error {
+	switch d.tp {
+	case typePlain:
+		m.keywords = append(m.keywords, strings.ToLower(d.value))
+	case typeRegex:
+		r, err := regexp.Compile(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid geosite regexp %s: %w", d.value, err)
+		}
+		m.regexps = append(m.regexps, r)
+	case typeDomain:
+		m.suffix[strings.ToLower(d.value)] = struct{}{}
+	case typeFull:
+		m.full[strings.ToLower(d.value)] = struct{}{}
+	}
+	return nil
+}
+
+// Match reports whether domain belongs to the category
+func (m *Matcher) Match(domain string) bool {
+	domain = strings.ToLower(domain)
+	if _, ok := m.full[domain]; ok {
+		return true
+	}
+
+	for d := domain; ; {
+		if _, ok := m.suffix[d]; ok {
+			return true
+		}
+
+		idx := strings.IndexByte(d, '.')
+		if idx == -1 {
+			break
+		}
+		d = d[idx+1:]
+	}
+
+	for _, keyword := range m.keywords {
+		if strings.Contains(domain, keyword) {
+			return true
+		}
+	}
+
+	for _, r := range m.regexps {
+		if r.MatchString(domain) {
+			return true
+		}
+	}
+
+	return false
+}
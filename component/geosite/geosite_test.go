@@ -0,0 +1,86 @@
+package geosite
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func uvarint(x uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, x)]
+}
+
+func field(num int, value []byte) []byte {
+	buf := uvarint(uint64(num<<3 | 2))
+	buf = append(buf, uvarint(uint64(len(value)))...)
+	return append(buf, value...)
+}
+
+func encodeDomain(tp int, value string, attributes ...string) []byte {
+	buf := append([]byte{1 << 3}, uvarint(uint64(tp))...)
+	buf = append(buf, field(2, []byte(value))...)
+	for _, attr := range attributes {
+		buf = append(buf, field(3, field(1, []byte(attr)))...)
+	}
+	return buf
+}
+
+func encodeSite(code string, domains ...[]byte) []byte {
+	buf := field(1, []byte(code))
+	for _, d := range domains {
+		buf = append(buf, field(2, d)...)
+	}
+	return field(1, buf)
+}
+
+func testGeoSite(t *testing.T) *GeoSite {
+	data := encodeSite("GOOGLE",
+		encodeDomain(typeDomain, "google.com"),
+		encodeDomain(typeFull, "full.example.com", "cn"),
+		encodeDomain(typePlain, "gstatic"),
+		encodeDomain(typeRegex, `^ggpht\d+\.com$`),
+	)
+	data = append(data, encodeSite("CN", encodeDomain(typeDomain, "baidu.com"))...)
+
+	site, err := Parse(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, site.Len())
+	return site
+}
+
+func TestGeoSite_Match(t *testing.T) {
+	site := testGeoSite(t)
+
+	m, err := site.Matcher("google")
+	assert.Nil(t, err)
+	assert.True(t, m.Match("google.com"))
+	assert.True(t, m.Match("www.Google.com"))
+	assert.False(t, m.Match("xgoogle.com"))
+	assert.True(t, m.Match("full.example.com"))
+	assert.False(t, m.Match("a.full.example.com"))
+	assert.True(t, m.Match("x.gstatic.cn"))
+	assert.True(t, m.Match("ggpht12.com"))
+	assert.False(t, m.Match("baidu.com"))
+}
+
+func TestGeoSite_Attribute(t *testing.T) {
+	site := testGeoSite(t)
+
+	m, err := site.Matcher("GOOGLE@cn")
+	assert.Nil(t, err)
+	assert.True(t, m.Match("full.example.com"))
+	assert.False(t, m.Match("google.com"))
+}
+
+func TestGeoSite_NotFound(t *testing.T) {
+	site := testGeoSite(t)
+
+	_, err := site.Matcher("netflix")
+	assert.True(t, errors.Is(err, ErrCodeNotFound))
+
+	_, err = Parse([]byte{0x0a, 0x10})
+	assert.NotNil(t, err)
+}
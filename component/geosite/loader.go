@@ -0,0 +1,253 @@
+package geosite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/dialer"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultURL      = "https://github.com/v2fly/domain-list-community/releases/latest/download/dlc.dat"
+	downloadTimeout = time.Minute
+)
+
+var (
+	mux      sync.Mutex
+	instance *GeoSite
+	path     string
+	url      = defaultURL
+
+	// loaded is the database last returned by Load, it becomes the
+	// instance if its source is set
+	loaded *source
+
+	// generation is increased when the instance is replaced
+	generation = atomic.NewUint64(0)
+
+	updaterMux sync.Mutex
+	updater    chan struct{}
+)
+
+type source struct {
+	path string
+	url  string
+	site *GeoSite
+}
+
+// SetSource sets the path and download url of geosite database, empty
+// value means the default one
+func SetSource(p string, u string) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if u == "" {
+		u = defaultURL
+	}
+
+	if p != path || u != url {
+		instance = nil
+		if loaded != nil && loaded.path == p && loaded.url == u {
+			instance = loaded.site
+		}
+		generation.Inc()
+	}
+	path, url = p, u
+	loaded = nil
+}
+
+func getPath() string {
+	return resolvePath(path)
+}
+
+func resolvePath(p string) string {
+	if p == "" {
+		return C.Path.GeoSite()
+	}
+	return p
+}
+
+// Instance returns the loaded geosite database, it is downloaded if the file doesn't exist
+func Instance() (*GeoSite, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if instance != nil {
+		return instance, nil
+	}
+
+	site, err := load(getPath(), url)
+	if err != nil {
+		return nil, err
+	}
+
+	instance = site
+	generation.Inc()
+	return instance, nil
+}
+
+// Generation returns a number which is changed when the loaded database is
+// replaced, so the cached match results can be invalidated
+func Generation() uint64 {
+	return generation.Load()
+}
+
+// Load returns the geosite database of the path and download url without
+// replacing the loaded one, so the database of a config can be verified
+// before the config is applied. Empty value means the default one.
+func Load(p string, u string) (*GeoSite, error) {
+	if u == "" {
+		u = defaultURL
+	}
+
+	mux.Lock()
+	if p == path && u == url && instance != nil {
+		defer mux.Unlock()
+		return instance, nil
+	}
+	if loaded != nil && loaded.path == p && loaded.url == u {
+		defer mux.Unlock()
+		return loaded.site, nil
+	}
+	mux.Unlock()
+
+	site, err := load(resolvePath(p), u)
+	if err != nil {
+		return nil, err
+	}
+
+	mux.Lock()
+	loaded = &source{path: p, url: u, site: site}
+	mux.Unlock()
+	return site, nil
+}
+
+func load(path string, url string) (*GeoSite, error) {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Infoln("[GeoSite] can't find %s, start download", path)
+		buf, err = download(url, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't load geosite: %w", err)
+	}
+
+	site, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("can't load geosite: %w", err)
+	}
+	return site, nil
+}
+
+// Match reports whether domain belongs to the geosite category code
+func Match(code string, domain string) bool {
+	site, err := Instance()
+	if err != nil {
+		return false
+	}
+
+	m, err := site.Matcher(code)
+	if err != nil {
+		return false
+	}
+	return m.Match(domain)
+}
+
+// Update downloads the geosite database and replaces the loaded one,
+// the old one is kept if the new file can't be parsed
+func Update() error {
+	mux.Lock()
+	p, u, old := getPath(), url, instance
+	mux.Unlock()
+
+	buf, err := download(u, p+".download")
+	if err != nil {
+		return err
+	}
+
+	site, err := Parse(buf)
+	if err != nil {
+		os.Remove(p + ".download")
+		return err
+	}
+
+	// warm up the categories in use
+	if old != nil {
+		for _, code := range old.codes() {
+			if _, err := site.Matcher(code); err != nil {
+				log.Warnln("[GeoSite] %s is unavailable after update: %s", code, err.Error())
+			}
+		}
+	}
+
+	if err := os.Rename(p+".download", p); err != nil {
+		return err
+	}
+
+	mux.Lock()
+	instance = site
+	generation.Inc()
+	mux.Unlock()
+	return nil
+}
+
+// SetAutoUpdate updates the geosite database every interval, zero interval stops updating
+func SetAutoUpdate(interval time.Duration) {
+	updaterMux.Lock()
+	defer updaterMux.Unlock()
+
+	if updater != nil {
+		close(updater)
+		updater = nil
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	updater = done
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := Update(); err != nil {
+					log.Warnln("[GeoSite] update failed: %s", err.Error())
+					continue
+				}
+				log.Infoln("[GeoSite] updated")
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func download(url string, path string) ([]byte, error) {
+	resp, err := dialer.NewHTTPClient(downloadTimeout).Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: %s", url, resp.Status)
+	}
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, ioutil.WriteFile(path, buf, 0644)
+}
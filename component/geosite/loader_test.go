@@ -0,0 +1,51 @@
+package geosite
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_Source(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.dat")
+	newPath := filepath.Join(dir, "new.dat")
+	assert.Nil(t, ioutil.WriteFile(oldPath, encodeSite("OLD", encodeDomain(typeDomain, "old.com")), 0644))
+	assert.Nil(t, ioutil.WriteFile(newPath, encodeSite("NEW", encodeDomain(typeDomain, "new.com")), 0644))
+
+	SetSource(oldPath, "")
+	defer SetSource("", "")
+	assert.True(t, Match("old", "old.com"))
+
+	// loading the database of another source doesn't replace the loaded one
+	site, err := Load(newPath, "")
+	assert.Nil(t, err)
+	_, err = site.Matcher("new")
+	assert.Nil(t, err)
+	assert.True(t, Match("old", "old.com"))
+	assert.False(t, Match("new", "new.com"))
+
+	current, err := Load(oldPath, "")
+	assert.Nil(t, err)
+	_, err = current.Matcher("old")
+	assert.Nil(t, err)
+
+	// the loaded database of the source is used once the source is set
+	SetSource(newPath, "")
+	instance, err := Instance()
+	assert.Nil(t, err)
+	assert.Same(t, site, instance)
+	assert.False(t, Match("old", "old.com"))
+	assert.True(t, Match("new", "new.com"))
+}
+
+func TestLoad_Error(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.dat")
+	assert.Nil(t, ioutil.WriteFile(path, []byte{0x0a, 0x10}, 0644))
+
+	_, err := Load(path, "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,109 @@
+package gun
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEchoServer starts a gun server which echoes the frames back
+func newEchoServer(t *testing.T) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Body.Read(buf)
+			if n > 0 {
+				if _, err := w.Write(buf[:n]); err != nil {
+					return
+				}
+				w.(http.Flusher).Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dialEcho(t *testing.T, server *httptest.Server) net.Conn {
+	addr := server.Listener.Addr().String()
+	transport := NewHTTP2Client(func(network, _ string) (net.Conn, error) {
+		return net.Dial(network, addr)
+	}, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	t.Cleanup(transport.CloseIdleConnections)
+
+	conn, err := StreamGunWithTransport(transport, &Config{Host: addr})
+	require.NoError(t, err)
+	return conn
+}
+
+func TestConn_Echo(t *testing.T) {
+	conn := dialEcho(t, newEchoServer(t))
+	defer conn.Close()
+
+	_, err := conn.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestConn_ConcurrentClose(t *testing.T) {
+	server := newEchoServer(t)
+
+	for i := 0; i < 10; i++ {
+		conn := dialEcho(t, server)
+
+		wg := sync.WaitGroup{}
+		wg.Add(5)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 64)
+			for {
+				if _, err := conn.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := conn.Write([]byte("ping")); err != nil {
+					return
+				}
+			}
+		}()
+		for k := 0; k < 2; k++ {
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					conn.SetDeadline(time.Now().Add(time.Millisecond * time.Duration(j%5)))
+				}
+			}()
+		}
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond * 10)
+			conn.Close()
+		}()
+		wg.Wait()
+	}
+}
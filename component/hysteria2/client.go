@@ -0,0 +1,257 @@
+package hysteria2
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+const (
+	// packetOverhead is the type byte, the longest connection ID, the longest
+	// packet number, the AEAD tag and the DATAGRAM frame header
+	packetOverhead = 1 + 20 + 4 + 16 + 3
+
+	// minDatagramSize fits in the smallest packet QUIC allows
+	minDatagramSize = 1200 - packetOverhead
+)
+
+var (
+	errUDPDisabled     = errors.New("hysteria2 server doesn't enable UDP")
+	errMessageTooLarge = errors.New("hysteria2 UDP message too large")
+
+	// datagramProbe is larger than any datagram, sending it only returns the limit
+	datagramProbe = make([]byte, 64*1024)
+)
+
+// Config is the client config of a hysteria2 server
+type Config struct {
+	Password string
+	// Down is the receive rate in bytes per second told to the server, zero
+	// lets the server pick one
+	Down uint64
+	// Obfs is the password of the Salamander obfuscation, empty disables it
+	Obfs      string
+	TLSConfig *tls.Config
+	// Ports are the ports of port hopping, the port of the dialed address
+	// is used if it's empty
+	Ports       []uint16
+	HopInterval time.Duration
+}
+
+// Client is a QUIC connection to a hysteria2 server, the TCP connections
+// are its streams and the UDP packets are its datagrams
+type Client struct {
+	conn *quic.Conn
+	udp  bool
+
+	mux      sync.Mutex
+	sessions map[uint32]*packetConn
+	nextID   uint32
+}
+
+// Dial connects and authenticates to addr over pc, pc is closed with the client
+func Dial(ctx context.Context, pc net.PacketConn, addr *net.UDPAddr, config *Config) (*Client, error) {
+	if config.Obfs != "" {
+		pc = newSalamander(pc, config.Obfs)
+	}
+	if len(config.Ports) > 1 {
+		interval := config.HopInterval
+		if interval == 0 {
+			interval = DefaultHopInterval
+		}
+		pc = newHopPacketConn(pc, addr, config.Ports, interval)
+	}
+
+	tlsConfig := config.TLSConfig.Clone()
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{http3.NextProtoH3}
+	}
+
+	conn, err := quic.DialEarly(ctx, pc, addr, tlsConfig, &quic.Config{
+		EnableDatagrams: true,
+		KeepAlivePeriod: 10 * time.Second,
+		MaxIdleTimeout:  30 * time.Second,
+	})
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	// quic-go doesn't own a packet conn it was handed, release it with the connection
+	go func() {
+		<-conn.Context().Done()
+		pc.Close()
+	}()
+
+	udp, err := auth(ctx, conn, config)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, err
+	}
+
+	c := &Client{conn: conn, udp: udp, sessions: map[uint32]*packetConn{}}
+	if udp {
+		go c.receiveDatagrams()
+	}
+	return c, nil
+}
+
+// auth authenticates by HTTP/3 and returns whether the server enables UDP
+func auth(ctx context.Context, conn *quic.Conn, config *Config) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://hysteria/auth", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Hysteria-Auth", config.Password)
+	req.Header.Set("Hysteria-CC-RX", strconv.FormatUint(config.Down, 10))
+	req.Header.Set("Hysteria-Padding", padding(64, 512))
+
+	resp, err := (&http3.Transport{}).NewClientConn(conn).RoundTrip(req)
+	if err != nil {
+		return false, fmt.Errorf("hysteria2 auth error: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != statusAuthOK {
+		return false, fmt.Errorf("hysteria2 auth failed: %s", resp.Status)
+	}
+	return resp.Header.Get("Hysteria-UDP") == "true", nil
+}
+
+// DialContext opens a TCP stream to addr
+func (c *Client) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	stream, err := c.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+	if err := writeTCPRequest(stream, addr); err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+	if err := readTCPResponse(stream); err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+	stream.SetDeadline(time.Time{})
+
+	return &streamConn{Stream: stream, local: c.conn.LocalAddr(), remote: c.conn.RemoteAddr()}, nil
+}
+
+// ListenPacket returns a UDP session
+func (c *Client) ListenPacket() (net.PacketConn, error) {
+	if !c.udp {
+		return nil, errUDPDisabled
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.nextID++
+	pc := newPacketConn(c, c.nextID)
+	c.sessions[pc.id] = pc
+	return pc, nil
+}
+
+// Done is closed when the connection is closed
+func (c *Client) Done() <-chan struct{} {
+	return c.conn.Context().Done()
+}
+
+func (c *Client) Close() error {
+	return c.conn.CloseWithError(0, "")
+}
+
+func (c *Client) receiveDatagrams() {
+	for {
+		b, err := c.conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			c.mux.Lock()
+			for _, pc := range c.sessions {
+				pc.Close()
+			}
+			c.mux.Unlock()
+			return
+		}
+
+		m, err := parseUDPMessage(b)
+		if err != nil {
+			continue
+		}
+
+		c.mux.Lock()
+		pc := c.sessions[m.sessionID]
+		c.mux.Unlock()
+		if pc != nil {
+			pc.feed(m)
+		}
+	}
+}
+
+func (c *Client) removeSession(id uint32) {
+	c.mux.Lock()
+	delete(c.sessions, id)
+	c.mux.Unlock()
+}
+
+// sendMessage sends m as a datagram, it's fragmented if it's too large
+func (c *Client) sendMessage(m *udpMessage) error {
+	b := m.marshal()
+	size := c.maxDatagramSize()
+	if len(b) <= size {
+		return c.conn.SendDatagram(b)
+	}
+
+	frags := fragment(m, size)
+	if len(frags) == 0 {
+		return errMessageTooLarge
+	}
+	for _, frag := range frags {
+		if err := c.conn.SendDatagram(frag.marshal()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxDatagramSize returns the largest datagram fitting in a packet. quic-go
+// reports its MTU estimate as the limit once the MTU discovery raises it, so
+// the larger datagrams are dropped silently unless the packet overhead is
+// left out here.
+func (c *Client) maxDatagramSize() int {
+	var tooLarge *quic.DatagramTooLargeError
+	if errors.As(c.conn.SendDatagram(datagramProbe), &tooLarge) {
+		return int(tooLarge.MaxDatagramPayloadSize) - packetOverhead
+	}
+	return minDatagramSize
+}
+
+// streamConn is a TCP connection of a QUIC stream
+type streamConn struct {
+	*quic.Stream
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *streamConn) LocalAddr() net.Addr  { return c.local }
+func (c *streamConn) RemoteAddr() net.Addr { return c.remote }
+
+// Close closes both directions, the Close of a QUIC stream only closes the
+// write direction
+func (c *streamConn) Close() error {
+	c.Stream.CancelRead(0)
+	return c.Stream.Close()
+}
@@ -0,0 +1,221 @@
+package hysteria2
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// newTestServer serves a minimal hysteria2 server echoing the TCP streams
+// and the UDP messages, the TCP requests to "refused:80" are refused
+func newTestServer(t *testing.T, password, obfs string) (*net.UDPAddr, *x509.CertPool) {
+	cert, pool := newTestCert(t)
+
+	var pc net.PacketConn
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := pc.LocalAddr().(*net.UDPAddr)
+	if obfs != "" {
+		pc = newSalamander(pc, obfs)
+	}
+
+	server := &http3.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/auth" || req.Header.Get("Hysteria-Auth") != password {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Hysteria-UDP", "true")
+			w.WriteHeader(statusAuthOK)
+		}),
+		StreamHijacker: func(ft http3.FrameType, _ quic.ConnectionTracingID, stream *quic.Stream, err error) (bool, error) {
+			if err != nil || ft != tcpRequestID {
+				return false, nil
+			}
+			go func() {
+				defer stream.Close()
+				r := quicvarint.NewReader(stream)
+				target, err := readVarintString(r, maxAddressLength)
+				if err != nil {
+					return
+				}
+				if _, err := readVarintString(r, maxPaddingLength); err != nil {
+					return
+				}
+				if target == "refused:80" {
+					stream.Write([]byte{0x01, 4, 'd', 'e', 'n', 'y', 0})
+					return
+				}
+				stream.Write([]byte{tcpStatusOK, 0, 0})
+				io.Copy(stream, stream)
+			}()
+			return true, nil
+		},
+	}
+
+	ln, err := quic.ListenEarly(pc, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{http3.NextProtoH3},
+	}, &quic.Config{EnableDatagrams: true})
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go server.ServeQUICConn(conn)
+			go func() {
+				for {
+					b, err := conn.ReceiveDatagram(context.Background())
+					if err != nil {
+						return
+					}
+					conn.SendDatagram(b)
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		pc.Close()
+	})
+
+	return addr, pool
+}
+
+func dialTestClient(t *testing.T, addr *net.UDPAddr, config *Config) (*Client, error) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return Dial(ctx, pc, addr, config)
+}
+
+func TestClient(t *testing.T) {
+	for _, obfs := range []string{"", "obfs"} {
+		t.Run("obfs="+obfs, func(t *testing.T) {
+			addr, pool := newTestServer(t, "password", obfs)
+
+			client, err := dialTestClient(t, addr, &Config{
+				Password:  "password",
+				Obfs:      obfs,
+				TLSConfig: &tls.Config{RootCAs: pool},
+			})
+			require.NoError(t, err)
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			conn, err := client.DialContext(ctx, "example.com:80")
+			require.NoError(t, err)
+			_, err = conn.Write([]byte("ping"))
+			require.NoError(t, err)
+			buf := make([]byte, 4)
+			_, err = io.ReadFull(conn, buf)
+			require.NoError(t, err)
+			assert.Equal(t, "ping", string(buf))
+			conn.Close()
+
+			_, err = client.DialContext(ctx, "refused:80")
+			assert.EqualError(t, err, "hysteria2 server refused: deny")
+
+			pc, err := client.ListenPacket()
+			require.NoError(t, err)
+			defer pc.Close()
+			pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			target := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 53}
+			// the large packet is fragmented
+			for _, payload := range [][]byte{[]byte("pong"), bytes.Repeat([]byte("x"), 4000)} {
+				_, err = pc.WriteTo(payload, target)
+				require.NoError(t, err)
+
+				buf := make([]byte, 8192)
+				n, from, err := pc.ReadFrom(buf)
+				require.NoError(t, err)
+				assert.Equal(t, payload, buf[:n])
+				assert.Equal(t, target.String(), from.String())
+			}
+		})
+	}
+}
+
+func TestClient_AuthFailed(t *testing.T) {
+	addr, pool := newTestServer(t, "password", "")
+
+	_, err := dialTestClient(t, addr, &Config{
+		Password:  "wrong",
+		TLSConfig: &tls.Config{RootCAs: pool},
+	})
+	assert.Error(t, err)
+}
+
+func TestPacketConn_ReadDeadline(t *testing.T) {
+	addr, pool := newTestServer(t, "password", "")
+
+	client, err := dialTestClient(t, addr, &Config{
+		Password:  "password",
+		TLSConfig: &tls.Config{RootCAs: pool},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	pc, err := client.ListenPacket()
+	require.NoError(t, err)
+
+	pc.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, _, err = pc.ReadFrom(make([]byte, 16))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pc.Close()
+	}()
+	pc.SetReadDeadline(time.Time{})
+	_, _, err = pc.ReadFrom(make([]byte, 16))
+	assert.Equal(t, errSessionClosed, err)
+}
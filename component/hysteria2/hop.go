@@ -0,0 +1,106 @@
+package hysteria2
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHopInterval is the interval of the port hopping if it isn't set
+const DefaultHopInterval = 30 * time.Second
+
+// ParsePorts parses the ports of port hopping, e.g. `443`, `20000-30000`
+// or `443,20000-30000`
+func ParsePorts(s string) ([]uint16, error) {
+	ports := []uint16{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		start, end := part, part
+		if idx := strings.IndexByte(part, '-'); idx != -1 {
+			start, end = part[:idx], part[idx+1:]
+		}
+
+		first, err := strconv.ParseUint(start, 10, 16)
+		if err != nil || first == 0 {
+			return nil, fmt.Errorf("invalid port: %s", part)
+		}
+		last, err := strconv.ParseUint(end, 10, 16)
+		if err != nil || last < first {
+			return nil, fmt.Errorf("invalid port range: %s", part)
+		}
+		for p := first; p <= last; p++ {
+			ports = append(ports, uint16(p))
+		}
+	}
+
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("invalid ports: %s", s)
+	}
+	return ports, nil
+}
+
+// hopPacketConn sends the packets to a port of ports chosen at random, and
+// the port is changed every interval. The packets from any port are
+// reported from addr so QUIC sees one server.
+type hopPacketConn struct {
+	net.PacketConn
+	addr  *net.UDPAddr
+	ports []uint16
+
+	mux    sync.Mutex
+	remote *net.UDPAddr
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newHopPacketConn(pc net.PacketConn, addr *net.UDPAddr, ports []uint16, interval time.Duration) *hopPacketConn {
+	h := &hopPacketConn{PacketConn: pc, addr: addr, ports: ports, done: make(chan struct{})}
+	h.hop()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.hop()
+			case <-h.done:
+				return
+			}
+		}
+	}()
+	return h
+}
+
+func (h *hopPacketConn) hop() {
+	port := h.ports[rand.Intn(len(h.ports))]
+	h.mux.Lock()
+	h.remote = &net.UDPAddr{IP: h.addr.IP, Port: int(port), Zone: h.addr.Zone}
+	h.mux.Unlock()
+}
+
+func (h *hopPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	h.mux.Lock()
+	remote := h.remote
+	h.mux.Unlock()
+	return h.PacketConn.WriteTo(b, remote)
+}
+
+func (h *hopPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, _, err := h.PacketConn.ReadFrom(b)
+	return n, h.addr, err
+}
+
+func (h *hopPacketConn) Close() error {
+	h.once.Do(func() { close(h.done) })
+	return h.PacketConn.Close()
+}
@@ -0,0 +1,175 @@
+package hysteria2
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/resolver"
+)
+
+var errSessionClosed = errors.New("hysteria2 UDP session closed")
+
+type packet struct {
+	data []byte
+	addr string
+}
+
+// packetConn is a UDP session of a client
+type packetConn struct {
+	client *Client
+	id     uint32
+
+	defragger defragger
+	packets   chan packet
+
+	mux          sync.Mutex
+	packetID     uint16
+	readDeadline time.Time
+	deadlineSet  chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newPacketConn(c *Client, id uint32) *packetConn {
+	return &packetConn{
+		client:      c,
+		id:          id,
+		packets:     make(chan packet, 64),
+		deadlineSet: make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+// feed is called by the receiving loop of the client only, so the
+// defragger needs no lock
+func (pc *packetConn) feed(m *udpMessage) {
+	m = pc.defragger.feed(m)
+	if m == nil {
+		return
+	}
+
+	select {
+	case pc.packets <- packet{data: append([]byte(nil), m.data...), addr: m.addr}:
+	case <-pc.closed:
+	default:
+		// the reader is too slow, drop the packet like a full socket buffer
+	}
+}
+
+func (pc *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		pc.mux.Lock()
+		deadline, deadlineSet := pc.readDeadline, pc.deadlineSet
+		pc.mux.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+
+		var p packet
+		var err error
+		received := false
+		select {
+		case p = <-pc.packets:
+			received = true
+		case <-pc.closed:
+			err = errSessionClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		case <-deadlineSet:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if !received {
+			continue
+		}
+
+		addr, err := resolveUDPAddr(p.addr)
+		if err != nil {
+			continue
+		}
+		return copy(b, p.data), addr, nil
+	}
+}
+
+func (pc *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-pc.closed:
+		return 0, errSessionClosed
+	default:
+	}
+
+	pc.mux.Lock()
+	pc.packetID++
+	packetID := pc.packetID
+	pc.mux.Unlock()
+
+	m := &udpMessage{
+		sessionID: pc.id,
+		packetID:  packetID,
+		fragCount: 1,
+		addr:      addr.String(),
+		data:      b,
+	}
+	if err := pc.client.sendMessage(m); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (pc *packetConn) Close() error {
+	pc.closeOnce.Do(func() {
+		close(pc.closed)
+		go pc.client.removeSession(pc.id)
+	})
+	return nil
+}
+
+func (pc *packetConn) LocalAddr() net.Addr {
+	return pc.client.conn.LocalAddr()
+}
+
+func (pc *packetConn) SetDeadline(t time.Time) error {
+	return pc.SetReadDeadline(t)
+}
+
+func (pc *packetConn) SetReadDeadline(t time.Time) error {
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+
+	pc.readDeadline = t
+	close(pc.deadlineSet)
+	pc.deadlineSet = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline is a no-op, the datagrams are sent without blocking
+func (pc *packetConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// resolveUDPAddr resolves the source of a packet, the server reports it as
+// host:port and the host is an IP in practice
+func resolveUDPAddr(addr string) (*net.UDPAddr, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := resolver.ResolveIP(host)
+	if err != nil {
+		return nil, err
+	}
+	return net.ResolveUDPAddr("udp", net.JoinHostPort(ip.String(), port))
+}
@@ -0,0 +1,218 @@
+package hysteria2
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+const (
+	// tcpRequestID is the frame type opening a TCP stream
+	tcpRequestID = 0x401
+
+	// statusAuthOK is the HTTP status of a successful authentication
+	statusAuthOK = 233
+
+	tcpStatusOK = 0x00
+
+	maxAddressLength = 2048
+	maxMessageLength = 2048
+	maxPaddingLength = 4096
+
+	// udpHeaderSize is the size of the UDP message header without the address
+	udpHeaderSize = 4 + 2 + 1 + 1
+)
+
+var errInvalidMessage = errors.New("invalid hysteria2 message")
+
+// padding returns a random string of printable characters, its length is in [min, max)
+func padding(min, max int) string {
+	n, _ := rand.Int(rand.Reader, big.NewInt(int64(max-min)))
+	b := make([]byte, min+int(n.Int64()))
+	rand.Read(b)
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	for i := range b {
+		b[i] = letters[int(b[i])%len(letters)]
+	}
+	return string(b)
+}
+
+// writeTCPRequest writes the request opening a TCP stream to addr
+func writeTCPRequest(w io.Writer, addr string) error {
+	p := padding(64, 512)
+	buf := quicvarint.Append(nil, tcpRequestID)
+	buf = quicvarint.Append(buf, uint64(len(addr)))
+	buf = append(buf, addr...)
+	buf = quicvarint.Append(buf, uint64(len(p)))
+	buf = append(buf, p...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readTCPResponse reads the response of a TCP request, the error has the
+// message of the server if the request is refused
+func readTCPResponse(r io.Reader) error {
+	br := quicvarint.NewReader(r)
+	status, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	msg, err := readVarintString(br, maxMessageLength)
+	if err != nil {
+		return err
+	}
+	if _, err := readVarintString(br, maxPaddingLength); err != nil {
+		return err
+	}
+
+	if status != tcpStatusOK {
+		return fmt.Errorf("hysteria2 server refused: %s", msg)
+	}
+	return nil
+}
+
+func readVarintString(r quicvarint.Reader, max uint64) (string, error) {
+	n, err := quicvarint.Read(r)
+	if err != nil {
+		return "", err
+	}
+	if n > max {
+		return "", errInvalidMessage
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// udpMessage is a UDP packet or a fragment of it in a QUIC datagram
+type udpMessage struct {
+	sessionID uint32
+	packetID  uint16
+	fragID    uint8
+	fragCount uint8
+	addr      string
+	data      []byte
+}
+
+func (m *udpMessage) headerSize() int {
+	return udpHeaderSize + quicvarint.Len(uint64(len(m.addr))) + len(m.addr)
+}
+
+func (m *udpMessage) marshal() []byte {
+	buf := make([]byte, udpHeaderSize, m.headerSize()+len(m.data))
+	binary.BigEndian.PutUint32(buf, m.sessionID)
+	binary.BigEndian.PutUint16(buf[4:], m.packetID)
+	buf[6] = m.fragID
+	buf[7] = m.fragCount
+	buf = quicvarint.Append(buf, uint64(len(m.addr)))
+	buf = append(buf, m.addr...)
+	return append(buf, m.data...)
+}
+
+func parseUDPMessage(b []byte) (*udpMessage, error) {
+	if len(b) < udpHeaderSize {
+		return nil, errInvalidMessage
+	}
+	m := &udpMessage{
+		sessionID: binary.BigEndian.Uint32(b),
+		packetID:  binary.BigEndian.Uint16(b[4:]),
+		fragID:    b[6],
+		fragCount: b[7],
+	}
+	b = b[udpHeaderSize:]
+
+	n, l, err := quicvarint.Parse(b)
+	if err != nil || n > maxAddressLength || uint64(len(b)-l) < n {
+		return nil, errInvalidMessage
+	}
+	m.addr = string(b[l : l+int(n)])
+	m.data = b[l+int(n):]
+
+	if m.fragCount == 0 || m.fragID >= m.fragCount {
+		return nil, errInvalidMessage
+	}
+	return m, nil
+}
+
+// fragment splits m into messages of at most size bytes, m itself is
+// returned if it fits
+func fragment(m *udpMessage, size int) []*udpMessage {
+	if m.headerSize()+len(m.data) <= size {
+		return []*udpMessage{m}
+	}
+
+	chunk := size - m.headerSize()
+	if chunk <= 0 {
+		return nil
+	}
+	count := (len(m.data) + chunk - 1) / chunk
+	if count > 255 {
+		return nil
+	}
+
+	frags := make([]*udpMessage, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunk
+		if end > len(m.data) {
+			end = len(m.data)
+		}
+		frag := *m
+		frag.fragID = uint8(i)
+		frag.fragCount = uint8(count)
+		frag.data = m.data[i*chunk : end]
+		frags = append(frags, &frag)
+	}
+	return frags
+}
+
+// defragger reassembles the fragments of the latest packet, the fragments
+// of an older packet are dropped when a new packet arrives
+type defragger struct {
+	packetID uint16
+	frags    []*udpMessage
+	count    int
+	size     int
+}
+
+// feed returns the whole packet once all its fragments are fed
+func (d *defragger) feed(m *udpMessage) *udpMessage {
+	if m.fragCount == 1 {
+		return m
+	}
+
+	if d.frags == nil || m.packetID != d.packetID || int(m.fragCount) != len(d.frags) {
+		d.packetID = m.packetID
+		d.frags = make([]*udpMessage, m.fragCount)
+		d.count = 0
+		d.size = 0
+	}
+	if d.frags[m.fragID] != nil {
+		return nil
+	}
+
+	frag := *m
+	frag.data = append([]byte(nil), m.data...)
+	d.frags[m.fragID] = &frag
+	d.count++
+	d.size += len(m.data)
+	if d.count != len(d.frags) {
+		return nil
+	}
+
+	data := make([]byte, 0, d.size)
+	for _, frag := range d.frags {
+		data = append(data, frag.data...)
+	}
+	whole := *d.frags[0]
+	whole.fragID, whole.fragCount, whole.data = 0, 1, data
+	d.frags = nil
+	return &whole
+}
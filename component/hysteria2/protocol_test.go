@@ -0,0 +1,112 @@
+package hysteria2
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTCPRequest(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeTCPRequest(buf, "example.com:443"))
+
+	b := buf.Bytes()
+	// 0x401 is a two bytes varint
+	assert.Equal(t, []byte{0x44, 0x01, 15}, b[:3])
+	assert.Equal(t, "example.com:443", string(b[3:18]))
+
+	assert.NoError(t, readTCPResponse(bytes.NewReader([]byte{tcpStatusOK, 0, 1, 'x'})))
+
+	err := readTCPResponse(bytes.NewReader([]byte{0x01, 6, 'b', 'l', 'o', 'c', 'k', 'd', 0}))
+	assert.EqualError(t, err, "hysteria2 server refused: blockd")
+}
+
+func TestUDPMessage(t *testing.T) {
+	m := &udpMessage{sessionID: 7, packetID: 9, fragCount: 1, addr: "1.2.3.4:53", data: []byte("hello")}
+	b := m.marshal()
+	assert.Len(t, b, m.headerSize()+len(m.data))
+
+	parsed, err := parseUDPMessage(b)
+	require.NoError(t, err)
+	assert.Equal(t, m, parsed)
+
+	_, err = parseUDPMessage(b[:5])
+	assert.Error(t, err)
+	_, err = parseUDPMessage(b[:udpHeaderSize+3])
+	assert.Error(t, err)
+}
+
+func TestFragment(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	m := &udpMessage{sessionID: 1, packetID: 2, fragCount: 1, addr: "1.2.3.4:53", data: data}
+
+	assert.Equal(t, []*udpMessage{m}, fragment(m, 2048))
+	assert.Nil(t, fragment(m, m.headerSize()))
+
+	frags := fragment(m, 300)
+	require.Len(t, frags, 4)
+
+	d := &defragger{}
+	// reversed to check the reassembling doesn't depend on the order
+	for i := len(frags) - 1; i > 0; i-- {
+		assert.LessOrEqual(t, len(frags[i].marshal()), 300)
+		parsed, err := parseUDPMessage(frags[i].marshal())
+		require.NoError(t, err)
+		assert.Nil(t, d.feed(parsed))
+	}
+
+	// a fragment of a newer packet drops the partial one
+	newer := *frags[0]
+	newer.packetID = 3
+	assert.Nil(t, d.feed(&newer))
+	assert.Nil(t, d.feed(frags[0]))
+
+	d = &defragger{}
+	for _, frag := range frags[:3] {
+		assert.Nil(t, d.feed(frag))
+	}
+	whole := d.feed(frags[3])
+	require.NotNil(t, whole)
+	assert.Equal(t, data, whole.data)
+	assert.Equal(t, uint8(1), whole.fragCount)
+}
+
+func TestSalamander(t *testing.T) {
+	a, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer b.Close()
+
+	sa, sb := newSalamander(a, "secret"), newSalamander(b, "secret")
+	_, err = sa.WriteTo([]byte("hello"), b.LocalAddr())
+	require.NoError(t, err)
+
+	buf := make([]byte, 64)
+	n, _, err := sb.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+
+	// the payload on the wire isn't the plaintext
+	_, err = sa.WriteTo([]byte("hello"), b.LocalAddr())
+	require.NoError(t, err)
+	n, _, err = b.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, salamanderSaltSize+5, n)
+	assert.NotContains(t, string(buf[:n]), "hello")
+}
+
+func TestParsePorts(t *testing.T) {
+	ports, err := ParsePorts("443, 1000-1002")
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{443, 1000, 1001, 1002}, ports)
+
+	for _, s := range []string{"", "0", "70000", "10-5", "a-b", ","} {
+		_, err := ParsePorts(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,72 @@
+package hysteria2
+
+import (
+	"crypto/rand"
+	"net"
+
+	"github.com/Dreamacro/clash/common/pool"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const salamanderSaltSize = 8
+
+// salamander is the Salamander obfuscation of the QUIC packets, each packet
+// is prefixed by a random salt and XORed with BLAKE2b-256(key || salt)
+type salamander struct {
+	net.PacketConn
+	key []byte
+}
+
+func newSalamander(pc net.PacketConn, password string) *salamander {
+	return &salamander{PacketConn: pc, key: []byte(password)}
+}
+
+func (s *salamander) hash(salt []byte) [32]byte {
+	return blake2b.Sum256(append(append([]byte{}, s.key...), salt...))
+}
+
+func (s *salamander) WriteTo(b []byte, addr net.Addr) (int, error) {
+	buf := pool.Get(salamanderSaltSize + len(b))
+	defer pool.Put(buf)
+
+	rand.Read(buf[:salamanderSaltSize])
+	hash := s.hash(buf[:salamanderSaltSize])
+	for i, c := range b {
+		buf[salamanderSaltSize+i] = c ^ hash[i%len(hash)]
+	}
+
+	if _, err := s.PacketConn.WriteTo(buf, addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (s *salamander) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := pool.Get(pool.RelayBufferSize)
+	defer pool.Put(buf)
+
+	for {
+		n, addr, err := s.PacketConn.ReadFrom(buf)
+		if err != nil {
+			return 0, addr, err
+		}
+		// packets without payload are dropped
+		if n <= salamanderSaltSize {
+			continue
+		}
+
+		hash := s.hash(buf[:salamanderSaltSize])
+		data := buf[salamanderSaltSize:n]
+		for i, c := range data {
+			if i >= len(b) {
+				break
+			}
+			b[i] = c ^ hash[i%len(hash)]
+		}
+		if len(data) > len(b) {
+			return len(b), addr, nil
+		}
+		return len(data), addr, nil
+	}
+}
@@ -0,0 +1,74 @@
+package mmdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+var (
+	asnMux  sync.Mutex
+	asnDB   *geoip2.Reader
+	asnPath string
+)
+
+// SetASNPath sets the path of the ASN database, empty path means the default
+// one. The database of the new path is loaded on the next call of ASNInstance.
+func SetASNPath(path string) {
+	asnMux.Lock()
+	defer asnMux.Unlock()
+
+	if path == asnPath {
+		return
+	}
+
+	asnDB = nil
+	asnPath = path
+}
+
+// ASNInstance returns the ASN database, it is loaded on the first call
+func ASNInstance() (*geoip2.Reader, error) {
+	asnMux.Lock()
+	defer asnMux.Unlock()
+
+	if asnDB != nil {
+		return asnDB, nil
+	}
+
+	db, err := loadASN(asnPath)
+	if err != nil {
+		return nil, err
+	}
+
+	asnDB = db
+	return asnDB, nil
+}
+
+// VerifyASN returns the error of loading the ASN database of path, empty
+// path means the default one. The loaded database isn't changed.
+func VerifyASN(path string) error {
+	_, err := loadASN(path)
+	return err
+}
+
+// loadASN reads the database into memory instead of mmap, so that the
+// replaced one doesn't need to be closed while it may be in use
+func loadASN(path string) (*geoip2.Reader, error) {
+	if path == "" {
+		path = C.Path.ASN()
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't load ASN database %s: %w", path, err)
+	}
+	db, err := geoip2.FromBytes(buf)
+	if err != nil {
+		return nil, fmt.Errorf("can't load ASN database %s: %w", path, err)
+	}
+	return db, nil
+}
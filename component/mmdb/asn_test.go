@@ -0,0 +1,29 @@
+package mmdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyASN(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmdb")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "asn.mmdb")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("invalid"), 0644))
+	assert.NotNil(t, VerifyASN(path))
+	assert.NotNil(t, VerifyASN(filepath.Join(dir, "missing.mmdb")))
+
+	// verifying doesn't change the path of the loaded database
+	assert.Equal(t, "", asnPath)
+
+	SetASNPath(path)
+	defer SetASNPath("")
+	_, err = ASNInstance()
+	assert.NotNil(t, err)
+}
@@ -1,43 +1,238 @@
 package mmdb
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/Dreamacro/clash/component/dialer"
 	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/log"
 
-	"github.com/oschwald/geoip2-golang"
+	"go.uber.org/atomic"
 )
 
-var mmdb *geoip2.Reader
-var once sync.Once
+// DefaultURL is the download url of the Country database
+const DefaultURL = "https://github.com/Dreamacro/maxmind-geoip/releases/latest/download/Country.mmdb"
+
+const downloadTimeout = time.Minute
+
+var (
+	mux         sync.RWMutex
+	mmdb        *Reader
+	url         = DefaultURL
+	checksum    string
+	checksumURL string
+
+	// generation is increased when the Country database is replaced
+	generation = atomic.NewUint64(0)
+
+	updaterMux sync.Mutex
+	updater    chan struct{}
+)
 
 func LoadFromBytes(buffer []byte) {
-	once.Do(func() {
-		var err error
-		mmdb, err = geoip2.FromBytes(buffer)
-		if err != nil {
-			log.Fatalln("Can't load mmdb: %s", err.Error())
-		}
-	})
+	mux.Lock()
+	defer mux.Unlock()
+
+	if mmdb != nil {
+		return
+	}
+
+	var err error
+	mmdb, err = Parse(buffer)
+	if err != nil {
+		log.Fatalln("Can't load mmdb: %s", err.Error())
+	}
 }
 
 func Verify() bool {
-	instance, err := geoip2.Open(C.Path.MMDB())
-	if err == nil {
-		instance.Close()
+	buf, err := ioutil.ReadFile(C.Path.MMDB())
+	if err != nil {
+		return false
 	}
+	_, err = Parse(buf)
 	return err == nil
 }
 
-func Instance() *geoip2.Reader {
-	once.Do(func() {
-		var err error
-		mmdb, err = geoip2.Open(C.Path.MMDB())
+// Instance returns the Country database, it is loaded on the first call
+func Instance() *Reader {
+	mux.RLock()
+	db := mmdb
+	mux.RUnlock()
+	if db != nil {
+		return db
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if mmdb == nil {
+		// the database is read into memory instead of mmap, so that the
+		// replaced one doesn't need to be closed while it may be in use
+		buf, err := ioutil.ReadFile(C.Path.MMDB())
+		if err == nil {
+			mmdb, err = Parse(buf)
+		}
 		if err != nil {
 			log.Fatalln("Can't load mmdb: %s", err.Error())
 		}
-	})
+	}
 
 	return mmdb
 }
+
+// SetSource sets the download url of the Country database, empty url means
+// the default one. The downloaded database must match sha256 if it isn't
+// empty, or the checksum read from sha256URL if it isn't empty.
+func SetSource(u, sha256, sha256URL string) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if u == "" {
+		u = DefaultURL
+	}
+	url, checksum, checksumURL = u, strings.ToLower(sha256), sha256URL
+}
+
+// Update downloads the Country database and replaces the loaded one, the
+// old one is kept if the new one can't be verified
+func Update() error {
+	mux.RLock()
+	u, sum, sumURL := url, checksum, checksumURL
+	mux.RUnlock()
+
+	buf, err := download(u)
+	if err != nil {
+		return err
+	}
+
+	if sum == "" && sumURL != "" {
+		if sum, err = downloadChecksum(sumURL); err != nil {
+			return err
+		}
+	}
+	if sum != "" {
+		if actual := sha256Hex(buf); actual != sum {
+			return fmt.Errorf("checksum mismatch: expect %s, got %s", sum, actual)
+		}
+	}
+
+	db, err := Parse(buf)
+	if err != nil {
+		return fmt.Errorf("invalid Country database: %w", err)
+	}
+
+	path := C.Path.MMDB()
+	if err := ioutil.WriteFile(path+".download", buf, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".download", path); err != nil {
+		return err
+	}
+
+	mux.Lock()
+	mmdb = db
+	generation.Inc()
+	mux.Unlock()
+	return nil
+}
+
+// Generation returns a number which is changed when the Country database is
+// replaced, so the cached match results can be invalidated
+func Generation() uint64 {
+	return generation.Load()
+}
+
+// UpdatePinned updates the Country database if the local one doesn't match
+// the sha256 set by SetSource
+func UpdatePinned() error {
+	mux.RLock()
+	sum := checksum
+	mux.RUnlock()
+
+	if sum == "" {
+		return nil
+	}
+
+	buf, err := ioutil.ReadFile(C.Path.MMDB())
+	if err == nil && sha256Hex(buf) == sum {
+		return nil
+	}
+	return Update()
+}
+
+// SetAutoUpdate updates the Country database every interval, zero interval stops updating
+func SetAutoUpdate(interval time.Duration) {
+	updaterMux.Lock()
+	defer updaterMux.Unlock()
+
+	if updater != nil {
+		close(updater)
+		updater = nil
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	updater = done
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := Update(); err != nil {
+					log.Warnln("[MMDB] update failed: %s", err.Error())
+					continue
+				}
+				log.Infoln("[MMDB] updated")
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func sha256Hex(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// downloadChecksum returns the checksum of a sha256sum file, which is the
+// first field of the first line
+func downloadChecksum(url string) (string, error) {
+	buf, err := download(url)
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(buf))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", errors.New("invalid checksum file")
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := dialer.NewHTTPClient(downloadTimeout).Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: %s", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,301 @@
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type databaseType int
+
+const (
+	typeMaxMind databaseType = iota
+	// typeSing is the mmdb of sing-geoip, the data is a country code
+	typeSing
+	// typeMetaV0 is the metadb of Clash.Meta, the data is a country code or a list of them
+	typeMetaV0
+	// typeDat is the geoip.dat of v2ray
+	typeDat
+)
+
+// metadataStartMarker begins the metadata section at the end of a MaxMind DB file
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+var errInvalidDat = errors.New("invalid geoip.dat")
+
+// Reader looks up the country codes of IP addresses in a MaxMind Country
+// database, a sing-geoip or Meta-geoip0 database, or a geoip.dat of v2ray
+type Reader struct {
+	tp  databaseType
+	db  *maxminddb.Reader
+	dat map[string]*ipSet
+}
+
+// Parse detects the format of the database by its magic bytes and loads it
+func Parse(buf []byte) (*Reader, error) {
+	if !bytes.Contains(buf, metadataStartMarker) {
+		dat, err := parseDat(buf)
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{tp: typeDat, dat: dat}, nil
+	}
+
+	db, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{tp: typeMaxMind, db: db}
+	switch db.Metadata.DatabaseType {
+	case "sing-geoip":
+		r.tp = typeSing
+	case "Meta-geoip0":
+		r.tp = typeMetaV0
+	}
+	return r, nil
+}
+
+// Codes returns the upper case country codes of ip
+func (r *Reader) Codes(ip net.IP) []string {
+	switch r.tp {
+	case typeMaxMind:
+		var record struct {
+			Country struct {
+				IsoCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+		}
+		if err := r.db.Lookup(ip, &record); err != nil || record.Country.IsoCode == "" {
+			return nil
+		}
+		return []string{record.Country.IsoCode}
+	case typeSing:
+		var code string
+		if err := r.db.Lookup(ip, &code); err != nil || code == "" {
+			return nil
+		}
+		return []string{strings.ToUpper(code)}
+	case typeMetaV0:
+		var record interface{}
+		if err := r.db.Lookup(ip, &record); err != nil {
+			return nil
+		}
+		switch record := record.(type) {
+		case string:
+			return []string{strings.ToUpper(record)}
+		case []interface{}:
+			codes := []string{}
+			for _, code := range record {
+				if code, ok := code.(string); ok {
+					codes = append(codes, strings.ToUpper(code))
+				}
+			}
+			return codes
+		}
+		return nil
+	default:
+		codes := []string{}
+		for code, set := range r.dat {
+			if set.contains(ip) {
+				codes = append(codes, code)
+			}
+		}
+		return codes
+	}
+}
+
+// Match reports whether ip belongs to the country code
+func (r *Reader) Match(ip net.IP, code string) bool {
+	code = strings.ToUpper(code)
+	if r.tp == typeDat {
+		set, ok := r.dat[code]
+		return ok && set.contains(ip)
+	}
+
+	for _, c := range r.Codes(ip) {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ipRange is a range of IPv6 or IPv4-mapped IPv6 addresses as 128 bits integers
+type ipRange struct {
+	start [2]uint64
+	end   [2]uint64
+}
+
+// ipSet is the sorted and merged ranges of a country of geoip.dat
+type ipSet struct {
+	ranges  []ipRange
+	reverse bool
+}
+
+func ipToUint128(ip net.IP) [2]uint64 {
+	ip = ip.To16()
+	return [2]uint64{binary.BigEndian.Uint64(ip[:8]), binary.BigEndian.Uint64(ip[8:])}
+}
+
+func less(a, b [2]uint64) bool {
+	return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+}
+
+func (s *ipSet) contains(ip net.IP) bool {
+	if ip.To16() == nil {
+		return false
+	}
+	n := ipToUint128(ip)
+	idx := sort.Search(len(s.ranges), func(i int) bool {
+		return !less(s.ranges[i].end, n)
+	})
+	found := idx < len(s.ranges) && !less(n, s.ranges[idx].start)
+	return found != s.reverse
+}
+
+func (s *ipSet) add(ip []byte, prefix uint64) error {
+	var start net.IP
+	switch len(ip) {
+	case net.IPv4len:
+		if prefix > 32 {
+			return errInvalidDat
+		}
+		start, prefix = net.IP(ip).To16(), prefix+96
+	case net.IPv6len:
+		if prefix > 128 {
+			return errInvalidDat
+		}
+		start = net.IP(ip)
+	default:
+		return errInvalidDat
+	}
+
+	mask := net.CIDRMask(int(prefix), 128)
+	first, last := make(net.IP, net.IPv6len), make(net.IP, net.IPv6len)
+	for i := range start {
+		first[i] = start[i] & mask[i]
+		last[i] = start[i] | ^mask[i]
+	}
+	s.ranges = append(s.ranges, ipRange{start: ipToUint128(first), end: ipToUint128(last)})
+	return nil
+}
+
+func (s *ipSet) merge() {
+	sort.Slice(s.ranges, func(i, j int) bool { return less(s.ranges[i].start, s.ranges[j].start) })
+	if len(s.ranges) == 0 {
+		return
+	}
+
+	merged := s.ranges[:1]
+	for _, r := range s.ranges[1:] {
+		last := &merged[len(merged)-1]
+		if !less(last.end, r.start) {
+			if less(last.end, r.end) {
+				last.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	s.ranges = merged
+}
+
+// parseDat parses GeoIPList of v2ray, see app/router/config.proto of v2ray-core
+func parseDat(data []byte) (map[string]*ipSet, error) {
+	sets := map[string]*ipSet{}
+	err := walk(data, func(field int, value []byte) error {
+		// GeoIPList.entry
+		if field != 1 {
+			return nil
+		}
+
+		code, set := "", &ipSet{}
+		err := walk(value, func(field int, v []byte) error {
+			switch field {
+			case 1: // GeoIP.country_code
+				code = strings.ToUpper(string(v))
+			case 2: // GeoIP.cidr
+				var ip []byte
+				var prefix uint64
+				err := walk(v, func(field int, v []byte) error {
+					switch field {
+					case 1:
+						ip = v
+					case 2:
+						var n int
+						if prefix, n = binary.Uvarint(v); n <= 0 {
+							return errInvalidDat
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				return set.add(ip, prefix)
+			case 3: // GeoIP.reverse_match
+				set.reverse = len(v) > 0 && v[0] != 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if code == "" {
+			return errInvalidDat
+		}
+
+		set.merge()
+		sets[code] = set
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 {
+		return nil, errInvalidDat
+	}
+
+	return sets, nil
+}
+
+// walk calls fn with every field of a protobuf message, varint fields are
+// passed as the raw varint bytes
+func walk(data []byte, fn func(field int, value []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errInvalidDat
+		}
+		data = data[n:]
+
+		var value []byte
+		switch key & 7 {
+		case 0: // varint
+			_, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errInvalidDat
+			}
+			value, data = data[:n], data[n:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errInvalidDat
+			}
+			value, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			return errInvalidDat
+		}
+
+		if err := fn(int(key>>3), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
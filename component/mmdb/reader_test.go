@@ -0,0 +1,61 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func uvarint(x uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, x)]
+}
+
+func field(num int, value []byte) []byte {
+	buf := uvarint(uint64(num<<3 | 2))
+	buf = append(buf, uvarint(uint64(len(value)))...)
+	return append(buf, value...)
+}
+
+func encodeCIDR(cidr string) []byte {
+	ip, ipnet, _ := net.ParseCIDR(cidr)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	prefix, _ := ipnet.Mask.Size()
+	buf := field(1, ip)
+	buf = append(buf, 2<<3)
+	return append(buf, uvarint(uint64(prefix))...)
+}
+
+func encodeGeoIP(code string, cidrs ...string) []byte {
+	buf := field(1, []byte(code))
+	for _, cidr := range cidrs {
+		buf = append(buf, field(2, encodeCIDR(cidr))...)
+	}
+	return field(1, buf)
+}
+
+func TestReader_Dat(t *testing.T) {
+	data := encodeGeoIP("cn", "1.0.1.0/24", "1.0.2.0/23", "240e::/20")
+	data = append(data, encodeGeoIP("PRIVATE", "10.0.0.0/8", "1.0.1.0/25")...)
+
+	r, err := Parse(data)
+	assert.Nil(t, err)
+	assert.Equal(t, typeDat, r.tp)
+
+	assert.True(t, r.Match(net.ParseIP("1.0.1.200"), "CN"))
+	assert.True(t, r.Match(net.ParseIP("1.0.3.255").To4(), "cn"))
+	assert.True(t, r.Match(net.ParseIP("240e:1::1"), "CN"))
+	assert.False(t, r.Match(net.ParseIP("1.0.4.0"), "CN"))
+	assert.False(t, r.Match(net.ParseIP("10.1.1.1"), "CN"))
+	assert.ElementsMatch(t, []string{"CN", "PRIVATE"}, r.Codes(net.ParseIP("1.0.1.1")))
+	assert.Empty(t, r.Codes(net.ParseIP("8.8.8.8")))
+}
+
+func TestReader_Invalid(t *testing.T) {
+	_, err := Parse([]byte("invalid"))
+	assert.NotNil(t, err)
+}
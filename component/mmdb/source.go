@@ -0,0 +1,105 @@
+package mmdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// database is a geoip database set by path, it's loaded on the first call
+type database struct {
+	mux  sync.Mutex
+	db   *Reader
+	path string
+}
+
+var (
+	sourceDB      database
+	destinationDB database
+)
+
+func (d *database) setPath(path string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if path == d.path {
+		return
+	}
+
+	d.db = nil
+	d.path = path
+}
+
+// load returns nil if the path isn't set
+func (d *database) load() (*Reader, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.path == "" || d.db != nil {
+		return d.db, nil
+	}
+
+	db, err := loadGeoIP(d.path)
+	if err != nil {
+		return nil, err
+	}
+
+	d.db = db
+	return d.db, nil
+}
+
+// SetSourcePath sets the path of the database of the source IPs, empty path
+// means the database of the destination IPs
+func SetSourcePath(path string) {
+	sourceDB.setPath(path)
+}
+
+// SetDestinationPath sets the path of the database of the destination IPs,
+// empty path means the database of the source IPs
+func SetDestinationPath(path string) {
+	destinationDB.setPath(path)
+}
+
+// SourceInstance returns the database of the source IPs, it falls back to
+// the database of the destination IPs, then the Country database
+func SourceInstance() (*Reader, error) {
+	return instance(&sourceDB, &destinationDB)
+}
+
+// DestinationInstance returns the database of the destination IPs, it falls
+// back to the database of the source IPs, then the Country database
+func DestinationInstance() (*Reader, error) {
+	return instance(&destinationDB, &sourceDB)
+}
+
+func instance(primary, fallback *database) (*Reader, error) {
+	for _, d := range []*database{primary, fallback} {
+		db, err := d.load()
+		if err != nil {
+			return nil, err
+		}
+		if db != nil {
+			return db, nil
+		}
+	}
+	return Instance(), nil
+}
+
+// VerifyGeoIP returns the error of loading the geoip database of path, the
+// loaded databases aren't changed
+func VerifyGeoIP(path string) error {
+	_, err := loadGeoIP(path)
+	return err
+}
+
+func loadGeoIP(path string) (*Reader, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't load geoip database %s: %w", path, err)
+	}
+	db, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("can't load geoip database %s: %w", path, err)
+	}
+	return db, nil
+}
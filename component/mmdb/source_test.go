@@ -0,0 +1,55 @@
+package mmdb
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceInstance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmdb")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source.dat")
+	assert.Nil(t, ioutil.WriteFile(source, encodeGeoIP("LAN", "192.168.0.0/16"), 0644))
+	destination := filepath.Join(dir, "destination.dat")
+	assert.Nil(t, ioutil.WriteFile(destination, encodeGeoIP("CN", "1.0.1.0/24"), 0644))
+
+	defer SetSourcePath("")
+	defer SetDestinationPath("")
+
+	SetSourcePath(source)
+	SetDestinationPath(destination)
+
+	db, err := SourceInstance()
+	assert.Nil(t, err)
+	assert.True(t, db.Match(net.ParseIP("192.168.1.1"), "lan"))
+
+	db, err = DestinationInstance()
+	assert.Nil(t, err)
+	assert.True(t, db.Match(net.ParseIP("1.0.1.1"), "cn"))
+
+	// each one falls back to the other
+	SetDestinationPath("")
+	db, err = DestinationInstance()
+	assert.Nil(t, err)
+	assert.True(t, db.Match(net.ParseIP("192.168.1.1"), "lan"))
+
+	SetSourcePath("")
+	SetDestinationPath(destination)
+	db, err = SourceInstance()
+	assert.Nil(t, err)
+	assert.True(t, db.Match(net.ParseIP("1.0.1.1"), "cn"))
+
+	assert.Nil(t, VerifyGeoIP(source))
+	assert.NotNil(t, VerifyGeoIP(filepath.Join(dir, "missing.dat")))
+
+	SetSourcePath(filepath.Join(dir, "missing.dat"))
+	_, err = SourceInstance()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,237 @@
+// Package mux multiplexes the connections of a proxy over a few proxy
+// connections. It's the client of sing-mux, the multiplexed streams of a
+// session are carried by the connection to Destination.
+package mux
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/socks5"
+
+	"github.com/hashicorp/yamux"
+)
+
+const (
+	// DestinationHost and DestinationPort are the target of the proxy
+	// connections that carry the sessions
+	DestinationHost = "sp.mux.sing-box.arpa"
+	DestinationPort = 444
+
+	version0      byte = 0
+	protocolYAMux byte = 1
+
+	DefaultMaxStreams  = 8
+	DefaultIdleTimeout = time.Minute
+
+	streamTimeout = 5 * time.Second
+)
+
+// Config of a Client, a session carries at most MaxStreams streams and is
+// closed if it has no stream for IdleTimeout
+type Config struct {
+	MaxStreams  int
+	IdleTimeout time.Duration
+}
+
+// ParseProtocol returns the error of an unsupported protocol, only yamux is
+// supported
+func ParseProtocol(protocol string) error {
+	switch strings.ToLower(protocol) {
+	case "", "yamux":
+		return nil
+	default:
+		return fmt.Errorf("unsupported mux protocol: %s", protocol)
+	}
+}
+
+// Client opens the streams on the sessions, dial returns a proxy connection
+// to Destination
+type Client struct {
+	config Config
+	dial   func(ctx context.Context) (net.Conn, error)
+
+	mux      sync.Mutex
+	sessions []*session
+}
+
+// session counts the streams being opened, which are guarded by Client.mux,
+// so closeIdle doesn't close it and MaxStreams isn't exceeded meanwhile
+type session struct {
+	*yamux.Session
+	opening int
+}
+
+// NewClient returns a Client of config, zero values are the defaults
+func NewClient(config Config, dial func(ctx context.Context) (net.Conn, error)) *Client {
+	if config.MaxStreams <= 0 {
+		config.MaxStreams = DefaultMaxStreams
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = DefaultIdleTimeout
+	}
+
+	return &Client{config: config, dial: dial}
+}
+
+// DialContext opens a TCP stream to target
+func (c *Client) DialContext(ctx context.Context, target socks5.Addr) (net.Conn, error) {
+	stream, err := c.openStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeStreamRequest(stream, 0, target); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return &streamConn{Conn: stream}, nil
+}
+
+// ListenPacket opens an UDP stream whose packets carry the addresses
+func (c *Client) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	stream, err := c.openStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	destination := socks5.ParseAddr(net.JoinHostPort(DestinationHost, fmt.Sprint(DestinationPort)))
+	if err := writeStreamRequest(stream, flagUDP|flagAddr, destination); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return &packetConn{Conn: stream}, nil
+}
+
+// Close closes the sessions and their streams
+func (c *Client) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, s := range c.sessions {
+		s.Close()
+	}
+	c.sessions = nil
+	return nil
+}
+
+func (c *Client) openStream(ctx context.Context) (net.Conn, error) {
+	if stream := c.openExisting(); stream != nil {
+		return stream, nil
+	}
+
+	s, err := c.newSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.open(s)
+}
+
+// openExisting opens a stream on a session with less than MaxStreams streams,
+// a session which fails to open a stream is closed and the next one is tried
+func (c *Client) openExisting() net.Conn {
+	for {
+		s := c.reserve()
+		if s == nil {
+			return nil
+		}
+
+		if stream, err := c.open(s); err == nil {
+			return stream
+		}
+		s.Close()
+	}
+}
+
+// open opens a stream on the session reserved by reserve or newSession
+func (c *Client) open(s *session) (net.Conn, error) {
+	stream, err := s.Open()
+	c.mux.Lock()
+	s.opening--
+	c.mux.Unlock()
+	return stream, err
+}
+
+// reserve returns a session with less than MaxStreams streams and counts the
+// stream being opened on it, the closed sessions are removed
+func (c *Client) reserve() *session {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	sessions := c.sessions[:0]
+	for _, s := range c.sessions {
+		if !s.IsClosed() {
+			sessions = append(sessions, s)
+		}
+	}
+	c.sessions = sessions
+
+	for _, s := range c.sessions {
+		if s.NumStreams()+s.opening < c.config.MaxStreams {
+			s.opening++
+			return s
+		}
+	}
+	return nil
+}
+
+// newSession dials a session with a stream reserved on it
+func (c *Client) newSession(ctx context.Context) (*session, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write([]byte{version0, protocolYAMux}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	config := yamux.DefaultConfig()
+	config.LogOutput = ioutil.Discard
+	config.StreamOpenTimeout = streamTimeout
+	config.StreamCloseTimeout = streamTimeout
+	ys, err := yamux.Client(conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &session{Session: ys, opening: 1}
+	c.mux.Lock()
+	c.sessions = append(c.sessions, s)
+	c.mux.Unlock()
+
+	go c.closeIdle(s)
+	return s, nil
+}
+
+// closeIdle closes session if it has no stream in two checks, so an idle
+// session lasts IdleTimeout at least
+func (c *Client) closeIdle(s *session) {
+	ticker := time.NewTicker(c.config.IdleTimeout)
+	defer ticker.Stop()
+
+	idle := false
+	for {
+		select {
+		case <-ticker.C:
+			c.mux.Lock()
+			if s.NumStreams() != 0 || s.opening != 0 {
+				idle = false
+			} else if idle {
+				s.Close()
+			} else {
+				idle = true
+			}
+			c.mux.Unlock()
+		case <-s.CloseChan():
+			return
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package mux
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/component/socks5"
+
+	"github.com/hashicorp/yamux"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve is a sing-mux server which echoes the streams
+func serve(conn net.Conn) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil || header[1] != protocolYAMux {
+		conn.Close()
+		return
+	}
+
+	session, err := yamux.Server(conn, nil)
+	if err != nil {
+		return
+	}
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer stream.Close()
+			flags := make([]byte, 2)
+			io.ReadFull(stream, flags)
+			socks5.ReadAddr(stream, make([]byte, socks5.MaxAddrLen))
+			stream.Write([]byte{statusSuccess})
+			io.Copy(stream, stream)
+		}()
+	}
+}
+
+func newTestClient(config Config) (*Client, *int32) {
+	dials := int32(0)
+	return NewClient(config, func(ctx context.Context) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		client, server := net.Pipe()
+		go serve(server)
+		return client, nil
+	}), &dials
+}
+
+func TestClient_DialContext(t *testing.T) {
+	client, dials := newTestClient(Config{MaxStreams: 2})
+	defer client.Close()
+
+	conns := []net.Conn{}
+	for i := 0; i < 3; i++ {
+		c, err := client.DialContext(context.Background(), socks5.ParseAddr("example.com:80"))
+		assert.Nil(t, err)
+		conns = append(conns, c)
+
+		_, err = c.Write([]byte("hello"))
+		assert.Nil(t, err)
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(c, buf)
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", string(buf))
+	}
+	assert.Equal(t, int32(2), *dials)
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+func TestClient_Concurrent(t *testing.T) {
+	client, _ := newTestClient(Config{MaxStreams: 2})
+	defer client.Close()
+
+	conns := make(chan net.Conn, 10)
+	wg := sync.WaitGroup{}
+	for i := 0; i < cap(conns); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := client.DialContext(context.Background(), socks5.ParseAddr("example.com:80"))
+			if assert.Nil(t, err) {
+				conns <- c
+			}
+		}()
+	}
+	wg.Wait()
+	close(conns)
+
+	client.mux.Lock()
+	for _, s := range client.sessions {
+		assert.LessOrEqual(t, s.NumStreams(), 2)
+		assert.Equal(t, 0, s.opening)
+	}
+	client.mux.Unlock()
+
+	for c := range conns {
+		c.Close()
+	}
+}
+
+func TestClient_ListenPacket(t *testing.T) {
+	client, _ := newTestClient(Config{})
+	defer client.Close()
+
+	pc, err := client.ListenPacket(context.Background())
+	assert.Nil(t, err)
+	defer pc.Close()
+
+	addr := &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 53}
+	_, err = pc.WriteTo([]byte("hello"), addr)
+	assert.Nil(t, err)
+
+	buf := make([]byte, 16)
+	n, from, err := pc.ReadFrom(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	assert.Equal(t, addr.String(), from.String())
+}
+
+func TestClient_ListenPacket_Large(t *testing.T) {
+	client, _ := newTestClient(Config{})
+	defer client.Close()
+
+	pc, err := client.ListenPacket(context.Background())
+	assert.Nil(t, err)
+	defer pc.Close()
+
+	addr := &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 53}
+	for _, size := range []int{0xffff - 2, 0xffff} {
+		payload := make([]byte, size)
+		_, err = pc.WriteTo(payload, addr)
+		assert.Nil(t, err)
+
+		buf := make([]byte, 0xffff)
+		n, _, err := pc.ReadFrom(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, size, n)
+	}
+
+	_, err = pc.WriteTo(make([]byte, 0xffff+1), addr)
+	assert.NotNil(t, err)
+}
+
+func TestClient_CloseIdle(t *testing.T) {
+	client, dials := newTestClient(Config{IdleTimeout: 50 * time.Millisecond})
+	defer client.Close()
+
+	c, err := client.DialContext(context.Background(), socks5.ParseAddr("example.com:80"))
+	assert.Nil(t, err)
+	c.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	c, err = client.DialContext(context.Background(), socks5.ParseAddr("example.com:80"))
+	assert.Nil(t, err)
+	c.Close()
+	assert.Equal(t, int32(2), *dials)
+}
+
+func TestReadStreamResponse(t *testing.T) {
+	message := "connection refused"
+	buf := []byte{statusError}
+	buf = append(buf, make([]byte, binary.MaxVarintLen64)...)
+	n := binary.PutUvarint(buf[1:], uint64(len(message)))
+	buf = append(buf[:1+n], message...)
+
+	r, w := net.Pipe()
+	go w.Write(buf)
+	err := readStreamResponse(r)
+	assert.EqualError(t, err, "mux stream error: connection refused")
+}
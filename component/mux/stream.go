@@ -0,0 +1,156 @@
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+
+	"github.com/Dreamacro/clash/common/pool"
+	"github.com/Dreamacro/clash/component/socks5"
+)
+
+const (
+	flagUDP  uint16 = 1
+	flagAddr uint16 = 2
+
+	statusSuccess byte = 0
+	statusError   byte = 1
+)
+
+// writeStreamRequest writes the flags and the target of a stream
+func writeStreamRequest(w io.Writer, flags uint16, target socks5.Addr) error {
+	buf := make([]byte, 2+len(target))
+	binary.BigEndian.PutUint16(buf, flags)
+	copy(buf[2:], target)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readStreamResponse returns the error message of the server if the stream
+// isn't opened
+func readStreamResponse(r io.Reader) error {
+	var status [1]byte
+	if _, err := io.ReadFull(r, status[:]); err != nil {
+		return err
+	}
+
+	switch status[0] {
+	case statusSuccess:
+		return nil
+	case statusError:
+		length, err := binary.ReadUvarint(&byteReader{r})
+		if err != nil {
+			return err
+		}
+		message := make([]byte, length)
+		if _, err := io.ReadFull(r, message); err != nil {
+			return err
+		}
+		return fmt.Errorf("mux stream error: %s", message)
+	default:
+		return fmt.Errorf("unexpected mux stream status: %d", status[0])
+	}
+}
+
+type byteReader struct {
+	io.Reader
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
+
+// streamConn reads the response of the server before the data
+type streamConn struct {
+	net.Conn
+	responseRead bool
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	if !c.responseRead {
+		if err := readStreamResponse(c.Conn); err != nil {
+			return 0, err
+		}
+		c.responseRead = true
+	}
+	return c.Conn.Read(b)
+}
+
+// packetConn sends a packet with the address and the length
+type packetConn struct {
+	net.Conn
+	responseRead bool
+}
+
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	target := socks5.ParseAddrToSocksAddr(addr)
+	if target == nil {
+		return 0, errors.New("invalid packet address")
+	}
+	if len(b) > 0xffff {
+		return 0, errors.New("packet is too large")
+	}
+
+	// the pool holds buffers up to 64 KiB, which is short of a full packet
+	// with the address
+	size := len(target) + 2 + len(b)
+	buf := pool.Get(size)
+	if buf == nil {
+		buf = make([]byte, size)
+	} else {
+		defer pool.Put(buf)
+	}
+
+	n := copy(buf, target)
+	binary.BigEndian.PutUint16(buf[n:], uint16(len(b)))
+	copy(buf[n+2:], b)
+	if _, err := c.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if !c.responseRead {
+		if err := readStreamResponse(c.Conn); err != nil {
+			return 0, nil, err
+		}
+		c.responseRead = true
+	}
+
+	addrBuf := make([]byte, socks5.MaxAddrLen)
+	target, err := socks5.ReadAddr(c.Conn, addrBuf)
+	if err != nil {
+		return 0, nil, err
+	}
+	addr := target.UDPAddr()
+	if addr == nil {
+		return 0, nil, errors.New("invalid packet address")
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(c.Conn, length[:]); err != nil {
+		return 0, nil, err
+	}
+	size := int(binary.BigEndian.Uint16(length[:]))
+
+	if size > len(b) {
+		if _, err := io.ReadFull(c.Conn, b); err != nil {
+			return 0, nil, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, c.Conn, int64(size-len(b))); err != nil {
+			return 0, nil, err
+		}
+		return len(b), addr, nil
+	}
+
+	if _, err := io.ReadFull(c.Conn, b[:size]); err != nil {
+		return 0, nil, err
+	}
+	return size, addr, nil
+}
@@ -31,6 +31,18 @@ func (t *Table) Delete(key string) {
 	t.mapping.Delete(key)
 }
 
+// Count returns the number of the PacketConn, the locks are not counted
+func (t *Table) Count() int {
+	count := 0
+	t.mapping.Range(func(key, value interface{}) bool {
+		if _, ok := value.(C.PacketConn); ok {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
 // New return *Cache
 func New() *Table {
 	return &Table{}
@@ -0,0 +1,35 @@
+package nat
+
+import (
+	"net"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type packetConn struct {
+	net.PacketConn
+	C.Connection
+}
+
+func TestTable(t *testing.T) {
+	table := New()
+	pc := &packetConn{}
+
+	table.Set("key", pc)
+	assert.Equal(t, C.PacketConn(pc), table.Get("key"))
+	assert.Nil(t, table.Get("other"))
+
+	// the locks aren't sessions
+	_, loaded := table.GetOrCreateLock("key-lock")
+	assert.False(t, loaded)
+	_, loaded = table.GetOrCreateLock("key-lock")
+	assert.True(t, loaded)
+	assert.Equal(t, 1, table.Count())
+
+	table.Delete("key")
+	assert.Nil(t, table.Get("key"))
+	assert.Equal(t, 0, table.Count())
+}
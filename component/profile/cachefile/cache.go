@@ -0,0 +1,330 @@
+package cachefile
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	initOnce     sync.Once
+	fileMode     os.FileMode = 0666
+	defaultCache *CacheFile
+
+	bucketFakeIP     = []byte("fakeip")
+	bucketFakeIPMeta = []byte("fakeip-meta")
+	keyFakeIPRange   = []byte("range")
+	bucketSelected   = []byte("selected")
+	bucketDelay      = []byte("delay")
+	bucketValidator  = []byte("http-validator")
+)
+
+// CacheFile store and update the cache file
+type CacheFile struct {
+	db *bbolt.DB
+}
+
+// FakeIPStore returns the persistent storage of fake ip mapping
+func (c *CacheFile) FakeIPStore() *FakeIPStore {
+	return &FakeIPStore{c}
+}
+
+// FakeIPStore keeps host --> fake ip bindings in the cache file
+type FakeIPStore struct {
+	*CacheFile
+}
+
+// Load returns all bindings stored for the given fake ip range.
+// If the stored range is different, the stale bindings are dropped.
+func (s *FakeIPStore) Load(ipnet string) map[string]net.IP {
+	bindings := map[string]net.IP{}
+	if s.db == nil {
+		return bindings
+	}
+
+	err := s.db.Update(func(t *bbolt.Tx) error {
+		meta, err := t.CreateBucketIfNotExists(bucketFakeIPMeta)
+		if err != nil {
+			return err
+		}
+
+		if string(meta.Get(keyFakeIPRange)) != ipnet {
+			if t.Bucket(bucketFakeIP) != nil {
+				if err := t.DeleteBucket(bucketFakeIP); err != nil {
+					return err
+				}
+			}
+
+			if err := meta.Put(keyFakeIPRange, []byte(ipnet)); err != nil {
+				return err
+			}
+		}
+
+		bucket, err := t.CreateBucketIfNotExists(bucketFakeIP)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			if ip := net.IP(v); len(ip) == net.IPv4len || len(ip) == net.IPv6len {
+				bindings[string(k)] = append(net.IP{}, ip...)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] read fake ip bindings failed: %s", err.Error())
+	}
+
+	return bindings
+}
+
+// Put stores a host --> fake ip binding, the pool calls it from one
+// goroutine so the batching of db.Batch would only delay the writes
+func (s *FakeIPStore) Put(host string, ip net.IP) {
+	if s.db == nil {
+		return
+	}
+
+	err := s.db.Update(func(t *bbolt.Tx) error {
+		bucket, err := t.CreateBucketIfNotExists(bucketFakeIP)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(host), ip)
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] write fake ip binding failed: %s", err.Error())
+	}
+}
+
+// Delete removes the bindings of hosts in one transaction
+func (s *FakeIPStore) Delete(hosts ...string) {
+	if s.db == nil || len(hosts) == 0 {
+		return
+	}
+
+	err := s.db.Update(func(t *bbolt.Tx) error {
+		bucket := t.Bucket(bucketFakeIP)
+		if bucket == nil {
+			return nil
+		}
+
+		for _, host := range hosts {
+			if err := bucket.Delete([]byte(host)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] delete fake ip binding failed: %s", err.Error())
+	}
+}
+
+// SetSelected stores the selected proxy of a proxy group, the cache file
+// isn't written if the selection is unchanged
+func (c *CacheFile) SetSelected(group, selected string) {
+	if c.db == nil || c.Selected(group) == selected {
+		return
+	}
+
+	err := c.db.Batch(func(t *bbolt.Tx) error {
+		bucket, err := t.CreateBucketIfNotExists(bucketSelected)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(group), []byte(selected))
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] write selected of %s failed: %s", group, err.Error())
+	}
+}
+
+// SelectedMap returns group --> selected proxy of all stored groups
+func (c *CacheFile) SelectedMap() map[string]string {
+	mapping := map[string]string{}
+	if c.db == nil {
+		return mapping
+	}
+
+	err := c.db.View(func(t *bbolt.Tx) error {
+		bucket := t.Bucket(bucketSelected)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			mapping[string(k)] = string(v)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] read selected failed: %s", err.Error())
+	}
+
+	return mapping
+}
+
+// Selected returns the stored selected proxy of a proxy group
+func (c *CacheFile) Selected(group string) (selected string) {
+	if c.db == nil {
+		return
+	}
+
+	c.db.View(func(t *bbolt.Tx) error {
+		if bucket := t.Bucket(bucketSelected); bucket != nil {
+			selected = string(bucket.Get([]byte(group)))
+		}
+		return nil
+	})
+	return
+}
+
+// SetDelay stores the last delay history of a proxy
+func (c *CacheFile) SetDelay(proxy string, history C.DelayHistory) {
+	if c.db == nil {
+		return
+	}
+
+	buf, err := json.Marshal(history)
+	if err != nil {
+		return
+	}
+
+	err = c.db.Batch(func(t *bbolt.Tx) error {
+		bucket, err := t.CreateBucketIfNotExists(bucketDelay)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(proxy), buf)
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] write delay of %s failed: %s", proxy, err.Error())
+	}
+}
+
+// DelayMap returns proxy --> last delay history of all stored proxies
+func (c *CacheFile) DelayMap() map[string]C.DelayHistory {
+	mapping := map[string]C.DelayHistory{}
+	if c.db == nil {
+		return mapping
+	}
+
+	err := c.db.View(func(t *bbolt.Tx) error {
+		bucket := t.Bucket(bucketDelay)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			history := C.DelayHistory{}
+			if json.Unmarshal(v, &history) == nil {
+				mapping[string(k)] = history
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] read delay failed: %s", err.Error())
+	}
+
+	return mapping
+}
+
+// Validator is the cache validators of a file downloaded by HTTP
+type Validator struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last-modified,omitempty"`
+}
+
+// SetValidator stores the validators of the file at path
+func (c *CacheFile) SetValidator(path string, validator Validator) {
+	if c.db == nil {
+		return
+	}
+
+	buf, err := json.Marshal(validator)
+	if err != nil {
+		return
+	}
+
+	err = c.db.Batch(func(t *bbolt.Tx) error {
+		bucket, err := t.CreateBucketIfNotExists(bucketValidator)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(path), buf)
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] write validator of %s failed: %s", path, err.Error())
+	}
+}
+
+// Validator returns the stored validators of the file at path
+func (c *CacheFile) Validator(path string) (validator Validator, ok bool) {
+	if c.db == nil {
+		return
+	}
+
+	c.db.View(func(t *bbolt.Tx) error {
+		bucket := t.Bucket(bucketValidator)
+		if bucket == nil {
+			return nil
+		}
+
+		if buf := bucket.Get([]byte(path)); buf != nil {
+			ok = json.Unmarshal(buf, &validator) == nil
+		}
+		return nil
+	})
+	return
+}
+
+func initCache() {
+	options := bbolt.Options{Timeout: time.Second}
+	db, err := bbolt.Open(C.Path.Cache(), fileMode, &options)
+	switch err {
+	case bbolt.ErrInvalid, bbolt.ErrChecksum, bbolt.ErrVersionMismatch:
+		if err = os.Remove(C.Path.Cache()); err != nil {
+			log.Warnln("[CacheFile] remove invalid cache file error: %s", err.Error())
+			break
+		}
+		log.Infoln("[CacheFile] remove invalid cache file and create new one")
+		db, err = bbolt.Open(C.Path.Cache(), fileMode, &options)
+	}
+	if err != nil {
+		log.Warnln("[CacheFile] can't open cache file: %s", err.Error())
+	}
+
+	defaultCache = &CacheFile{
+		db: db,
+	}
+}
+
+// Close flushes and closes the cache file, it can't be written after closing
+func (c *CacheFile) Close() error {
+	if c.db == nil {
+		return nil
+	}
+	return c.db.Close()
+}
+
+// Cache return singleton of CacheFile
+func Cache() *CacheFile {
+	initOnce.Do(initCache)
+
+	return defaultCache
+}
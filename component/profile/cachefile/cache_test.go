@@ -0,0 +1,29 @@
+package cachefile
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+func TestCacheFile_SetSelected(t *testing.T) {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "cache.db"), fileMode, nil)
+	require.NoError(t, err)
+	c := &CacheFile{db: db}
+	defer c.Close()
+
+	c.SetSelected("group", "a")
+	assert.Equal(t, "a", c.Selected("group"))
+	writes := db.Stats().TxStats.Write
+
+	// an unchanged selection isn't written again
+	c.SetSelected("group", "a")
+	assert.Equal(t, writes, db.Stats().TxStats.Write)
+
+	c.SetSelected("group", "b")
+	assert.Equal(t, "b", c.Selected("group"))
+	assert.Greater(t, db.Stats().TxStats.Write, writes)
+}
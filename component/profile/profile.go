@@ -0,0 +1,16 @@
+package profile
+
+import (
+	"go.uber.org/atomic"
+)
+
+var (
+	// StoreFakeIP is a global switch for storing fake ip mapping to cache file
+	StoreFakeIP = atomic.NewBool(false)
+
+	// StoreSelected is a global switch for storing selected proxy of groups to cache file
+	StoreSelected = atomic.NewBool(false)
+
+	// StoreDelay is a global switch for storing the last delay of proxies to cache file
+	StoreDelay = atomic.NewBool(false)
+)
@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Dreamacro/clash/component/trie"
+)
+
+// maxHostsAliases limits the aliases followed by a hosts lookup, it breaks
+// the alias loops
+const maxHostsAliases = 8
+
+// HostValue is a record of the hosts, it's a list of IPs or an alias of
+// another domain
+type HostValue struct {
+	IPs    []net.IP
+	Domain string
+}
+
+// NewHostValue parses a list of IPs, or a single domain as an alias
+func NewHostValue(values []string) (*HostValue, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty host value")
+	}
+
+	if len(values) == 1 && net.ParseIP(values[0]) == nil {
+		domain := strings.TrimRight(values[0], ".")
+		if domain == "" || strings.ContainsAny(domain, "*+ ") {
+			return nil, fmt.Errorf("%s is not a valid IP or domain", values[0])
+		}
+		return &HostValue{Domain: domain}, nil
+	}
+
+	ips := make([]net.IP, 0, len(values))
+	for _, value := range values {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("%s is not a valid IP", value)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		ips = append(ips, ip)
+	}
+	return &HostValue{IPs: ips}, nil
+}
+
+// LookupHosts searches host in tree and follows the aliases, it returns the
+// aliases in order and the IPs of the last domain. The IPs are empty if the
+// last domain isn't in tree, found is false if host isn't in tree or the
+// aliases are too deep.
+func LookupHosts(tree *trie.DomainTrie, host string) (aliases []string, ips []net.IP, found bool) {
+	domain := host
+	for i := 0; i <= maxHostsAliases; i++ {
+		node := tree.Search(domain)
+		if node == nil {
+			return aliases, nil, i > 0
+		}
+
+		value := node.Data.(*HostValue)
+		if value.Domain == "" {
+			return aliases, value.IPs, true
+		}
+		domain = value.Domain
+		aliases = append(aliases, domain)
+	}
+	return nil, nil, false
+}
+
+// lookupHosts searches host in DefaultHosts, it returns the IPs of host or
+// the domain to resolve instead of host
+func lookupHosts(host string) ([]net.IP, string) {
+	aliases, ips, found := LookupHosts(DefaultHosts, host)
+	if !found || len(ips) != 0 {
+		return ips, host
+	}
+	return nil, aliases[len(aliases)-1]
+}
+
+// HostsIP returns an IP of host in DefaultHosts, the IPv4 addresses are
+// preferred, it returns nil if host isn't mapped to IPs
+func HostsIP(host string) net.IP {
+	ips, _ := lookupHosts(host)
+	return pickIP(ips, true)
+}
+
+// pickIP returns the first IPv4 address of ips, or the first IPv6 address if
+// there isn't one and allowIPv6 is true
+func pickIP(ips []net.IP, allowIPv6 bool) net.IP {
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4
+		}
+	}
+	if allowIPv6 {
+		for _, ip := range ips {
+			if ip.To4() == nil {
+				return ip
+			}
+		}
+	}
+	return nil
+}
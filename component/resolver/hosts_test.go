@@ -0,0 +1,97 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Dreamacro/clash/component/trie"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHosts(t *testing.T, hosts map[string][]string) *trie.DomainTrie {
+	tree := trie.New()
+	for domain, values := range hosts {
+		value, err := NewHostValue(values)
+		require.NoError(t, err, domain)
+		require.NoError(t, tree.Insert(domain, value), domain)
+	}
+	return tree
+}
+
+func TestNewHostValue(t *testing.T) {
+	value, err := NewHostValue([]string{"1.1.1.1", "::ffff:2.2.2.2", "2001:db8::1"})
+	require.NoError(t, err)
+	assert.Equal(t, []net.IP{{1, 1, 1, 1}, {2, 2, 2, 2}, net.ParseIP("2001:db8::1")}, value.IPs)
+	assert.Empty(t, value.Domain)
+
+	value, err = NewHostValue([]string{"example.com."})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", value.Domain)
+	assert.Empty(t, value.IPs)
+
+	for _, values := range [][]string{{}, {""}, {"."}, {"*.example.com"}, {"1.1.1.1", "example.com"}, {"example.com", "example.org"}} {
+		_, err := NewHostValue(values)
+		assert.Error(t, err, "%v", values)
+	}
+}
+
+func TestLookupHosts(t *testing.T) {
+	tree := newTestHosts(t, map[string][]string{
+		"multi.example":  {"1.1.1.1", "2001:db8::1", "2.2.2.2"},
+		"alias.example":  {"middle.example"},
+		"middle.example": {"multi.example"},
+		"cname.example":  {"upstream.example"},
+		"*.wild.example": {"wild.alias"},
+		"wild.alias":     {"3.3.3.3"},
+		"loop1.example":  {"loop2.example"},
+		"loop2.example":  {"loop1.example"},
+	})
+
+	aliases, ips, found := LookupHosts(tree, "multi.example")
+	assert.True(t, found)
+	assert.Empty(t, aliases)
+	assert.Len(t, ips, 3)
+
+	aliases, ips, found = LookupHosts(tree, "alias.example")
+	assert.True(t, found)
+	assert.Equal(t, []string{"middle.example", "multi.example"}, aliases)
+	assert.Len(t, ips, 3)
+
+	// the last alias isn't in hosts
+	aliases, ips, found = LookupHosts(tree, "cname.example")
+	assert.True(t, found)
+	assert.Equal(t, []string{"upstream.example"}, aliases)
+	assert.Empty(t, ips)
+
+	aliases, ips, found = LookupHosts(tree, "a.wild.example")
+	assert.True(t, found)
+	assert.Equal(t, []string{"wild.alias"}, aliases)
+	assert.Equal(t, []net.IP{{3, 3, 3, 3}}, ips)
+
+	_, _, found = LookupHosts(tree, "loop1.example")
+	assert.False(t, found)
+
+	_, _, found = LookupHosts(tree, "unknown.example")
+	assert.False(t, found)
+}
+
+func TestHostsIP(t *testing.T) {
+	defer func(hosts *trie.DomainTrie) { DefaultHosts = hosts }(DefaultHosts)
+	DefaultHosts = newTestHosts(t, map[string][]string{
+		"dual.example":  {"2001:db8::1", "1.1.1.1"},
+		"v6.example":    {"2001:db8::2"},
+		"alias.example": {"dual.example"},
+	})
+
+	// IPv4 is preferred over the order of the IPs
+	assert.Equal(t, net.IP{1, 1, 1, 1}, HostsIP("dual.example"))
+	assert.Equal(t, net.IP{1, 1, 1, 1}, HostsIP("alias.example"))
+	assert.Equal(t, net.ParseIP("2001:db8::2"), HostsIP("v6.example"))
+	assert.Nil(t, HostsIP("unknown.example"))
+
+	ip, err := ResolveIPv4("alias.example")
+	require.NoError(t, err)
+	assert.Equal(t, net.IP{1, 1, 1, 1}, ip)
+}
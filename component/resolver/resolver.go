@@ -12,6 +12,10 @@ var (
 	// DefaultResolver aim to resolve ip
 	DefaultResolver Resolver
 
+	// DirectResolver resolves the hosts dialed by DIRECT, DefaultResolver is
+	// used if it's nil
+	DirectResolver Resolver
+
 	// DisableIPv6 means don't resolve ipv6 host
 	// default value is true
 	DisableIPv6 = true
@@ -34,10 +38,9 @@ type Resolver interface {
 
 // ResolveIPv4 with a host, return ipv4
 func ResolveIPv4(host string) (net.IP, error) {
-	if node := DefaultHosts.Search(host); node != nil {
-		if ip := node.Data.(net.IP).To4(); ip != nil {
-			return ip, nil
-		}
+	ips, host := lookupHosts(host)
+	if ip := pickIP(ips, false); ip != nil {
+		return ip, nil
 	}
 
 	ip := net.ParseIP(host)
@@ -72,8 +75,9 @@ func ResolveIPv6(host string) (net.IP, error) {
 		return nil, ErrIPv6Disabled
 	}
 
-	if node := DefaultHosts.Search(host); node != nil {
-		if ip := node.Data.(net.IP).To16(); ip != nil {
+	ips, host := lookupHosts(host)
+	for _, ip := range ips {
+		if ip.To4() == nil {
 			return ip, nil
 		}
 	}
@@ -106,8 +110,9 @@ func ResolveIPv6(host string) (net.IP, error) {
 
 // ResolveIP with a host, return ip
 func ResolveIP(host string) (net.IP, error) {
-	if node := DefaultHosts.Search(host); node != nil {
-		return node.Data.(net.IP), nil
+	ips, host := lookupHosts(host)
+	if ip := pickIP(ips, true); ip != nil {
+		return ip, nil
 	}
 
 	if DefaultResolver != nil {
@@ -131,3 +136,25 @@ func ResolveIP(host string) (net.IP, error) {
 
 	return ipAddr.IP, nil
 }
+
+// ResolveDirectIP with a host, return ip resolved by DirectResolver
+func ResolveDirectIP(host string) (net.IP, error) {
+	r := DirectResolver
+	if r == nil {
+		return ResolveIP(host)
+	}
+
+	ips, host := lookupHosts(host)
+	if ip := pickIP(ips, true); ip != nil {
+		return ip, nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+
+	if DisableIPv6 {
+		return r.ResolveIPv4(host)
+	}
+	return r.ResolveIP(host)
+}
@@ -0,0 +1,126 @@
+package script
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenInt
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of script"
+	case tokenString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// punctuations sorted by length, so that the longest one is matched first
+var punctuations = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"(", ")", "[", "]", ",", "?", ":", "!", "<", ">",
+}
+
+// lex splits src into tokens, comments start with # and end at the end of line
+func lex(src string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case isLetter(c):
+			start := i
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[start:i], pos: start})
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenInt, text: src[start:i], pos: start})
+		case c == '"':
+			start := i
+			i++
+			for i < len(src) && src[i] != '"' && src[i] != '\n' {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(src) || src[i] != '"' {
+				return nil, errorAt(src, start, "unterminated string")
+			}
+			i++
+
+			value, err := strconv.Unquote(src[start:i])
+			if err != nil {
+				return nil, errorAt(src, start, "invalid string %s", src[start:i])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value, pos: start})
+		case c == '\'':
+			// single quoted strings are raw strings without escapes
+			start := i
+			end := strings.IndexAny(src[i+1:], "'\n")
+			if end < 0 || src[i+1+end] != '\'' {
+				return nil, errorAt(src, start, "unterminated string")
+			}
+			tokens = append(tokens, token{kind: tokenString, text: src[i+1 : i+1+end], pos: start})
+			i += end + 2
+		default:
+			matched := ""
+			for _, p := range punctuations {
+				if strings.HasPrefix(src[i:], p) {
+					matched = p
+					break
+				}
+			}
+			if matched == "" {
+				return nil, errorAt(src, i, "unexpected character %q", c)
+			}
+			tokens = append(tokens, token{kind: tokenPunct, text: matched, pos: i})
+			i += len(matched)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// errorAt returns an error at the line and column of the offset pos of src
+func errorAt(src string, pos int, format string, args ...interface{}) error {
+	line := strings.Count(src[:pos], "\n") + 1
+	col := pos - strings.LastIndex(src[:pos], "\n")
+	return fmt.Errorf("line %d col %d: %s", line, col, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,406 @@
+package script
+
+import (
+	"strconv"
+)
+
+type node interface {
+	typ() Type
+	eval(ctx *context) interface{}
+}
+
+type literal struct {
+	t     Type
+	value interface{}
+}
+
+func (n *literal) typ() Type                 { return n.t }
+func (n *literal) eval(*context) interface{} { return n.value }
+
+type variable struct {
+	t    Type
+	name string
+}
+
+func (n *variable) typ() Type                     { return n.t }
+func (n *variable) eval(ctx *context) interface{} { return ctx.get(n.name) }
+
+type list struct {
+	elem  Type
+	items []interface{}
+}
+
+func (n *list) typ() Type                 { return List }
+func (n *list) eval(*context) interface{} { return n.items }
+
+type call struct {
+	fn   *Func
+	args []node
+}
+
+func (n *call) typ() Type { return n.fn.Result }
+
+func (n *call) eval(ctx *context) interface{} {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.eval(ctx)
+	}
+	return n.fn.Call(args)
+}
+
+type not struct {
+	x node
+}
+
+func (n *not) typ() Type                     { return Bool }
+func (n *not) eval(ctx *context) interface{} { return !n.x.eval(ctx).(bool) }
+
+type binary struct {
+	op   string
+	x, y node
+}
+
+func (n *binary) typ() Type { return Bool }
+
+func (n *binary) eval(ctx *context) interface{} {
+	switch n.op {
+	case "&&":
+		return n.x.eval(ctx).(bool) && n.y.eval(ctx).(bool)
+	case "||":
+		return n.x.eval(ctx).(bool) || n.y.eval(ctx).(bool)
+	case "in":
+		x := n.x.eval(ctx)
+		for _, item := range n.y.eval(ctx).([]interface{}) {
+			if item == x {
+				return true
+			}
+		}
+		return false
+	}
+
+	x, y := n.x.eval(ctx), n.y.eval(ctx)
+	switch n.op {
+	case "==":
+		return x == y
+	case "!=":
+		return x != y
+	case "<":
+		return x.(int64) < y.(int64)
+	case "<=":
+		return x.(int64) <= y.(int64)
+	case ">":
+		return x.(int64) > y.(int64)
+	default:
+		return x.(int64) >= y.(int64)
+	}
+}
+
+type ternary struct {
+	cond, then, otherwise node
+}
+
+func (n *ternary) typ() Type { return n.then.typ() }
+
+func (n *ternary) eval(ctx *context) interface{} {
+	if n.cond.eval(ctx).(bool) {
+		return n.then.eval(ctx)
+	}
+	return n.otherwise.eval(ctx)
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+	env    *Env
+	vars   map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the punctuation or keyword s
+func (p *parser) accept(s string) bool {
+	if t := p.peek(); (t.kind == tokenPunct || t.kind == tokenIdent) && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf(p.peek(), "expect %q, got %s", s, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return errorAt(p.src, t.pos, format, args...)
+}
+
+func (p *parser) parse() (node, error) {
+	if p.peek().kind == tokenEOF {
+		return nil, p.errorf(p.peek(), "empty script")
+	}
+
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	if n.typ() == List {
+		return nil, p.errorf(p.tokens[0], "result can't be a list")
+	}
+	return n, nil
+}
+
+func (p *parser) expr() (node, error) {
+	start := p.peek()
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	if cond.typ() != Bool {
+		return nil, p.errorf(start, "condition is %s, not bool", cond.typ())
+	}
+
+	thenTok := p.peek()
+	then, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if then.typ() != otherwise.typ() || then.typ() == List {
+		return nil, p.errorf(thenTok, "mismatched types %s and %s of ?:", then.typ(), otherwise.typ())
+	}
+	return &ternary{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+func (p *parser) or() (node, error) {
+	return p.logic("||", p.and)
+}
+
+func (p *parser) and() (node, error) {
+	return p.logic("&&", p.comparison)
+}
+
+func (p *parser) logic(op string, operand func() (node, error)) (node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		opTok := p.peek()
+		if !p.accept(op) {
+			return x, nil
+		}
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if x.typ() != Bool || y.typ() != Bool {
+			return nil, p.errorf(opTok, "invalid operation %s on %s and %s", op, x.typ(), y.typ())
+		}
+		x = &binary{op: op, x: x, y: y}
+	}
+}
+
+func (p *parser) comparison() (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	opTok := p.peek()
+	op := opTok.text
+	switch {
+	case opTok.kind == tokenPunct && (op == "==" || op == "!=" || op == "<" || op == "<=" || op == ">" || op == ">="):
+	case opTok.kind == tokenIdent && op == "in":
+	default:
+		return x, nil
+	}
+	p.next()
+
+	y, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "in":
+		l, ok := y.(*list)
+		if !ok {
+			return nil, p.errorf(opTok, "the right operand of in must be a list")
+		}
+		if len(l.items) > 0 && l.elem != x.typ() {
+			return nil, p.errorf(opTok, "invalid operation in on %s and list of %s", x.typ(), l.elem)
+		}
+	case "==", "!=":
+		if x.typ() != y.typ() || x.typ() == List {
+			return nil, p.errorf(opTok, "invalid operation %s on %s and %s", op, x.typ(), y.typ())
+		}
+	default:
+		if x.typ() != Int || y.typ() != Int {
+			return nil, p.errorf(opTok, "invalid operation %s on %s and %s", op, x.typ(), y.typ())
+		}
+	}
+	return &binary{op: op, x: x, y: y}, nil
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.peek()
+	if !p.accept("!") {
+		return p.primary()
+	}
+
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	if x.typ() != Bool {
+		return nil, p.errorf(t, "invalid operation ! on %s", x.typ())
+	}
+	return &not{x: x}, nil
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return &literal{t: String, value: t.text}, nil
+	case tokenInt:
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid integer %s", t.text)
+		}
+		return &literal{t: Int, value: n}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return &literal{t: Bool, value: t.text == "true"}, nil
+		case "in":
+			return nil, p.errorf(t, "unexpected %s", t)
+		}
+		if p.peek().text == "(" && p.peek().kind == tokenPunct {
+			return p.call(t)
+		}
+		tp, ok := p.env.Vars[t.text]
+		if !ok {
+			return nil, p.errorf(t, "undefined variable %s", t.text)
+		}
+		p.vars[t.text] = true
+		return &variable{t: tp, name: t.text}, nil
+	case tokenPunct:
+		switch t.text {
+		case "(":
+			n, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "[":
+			return p.list()
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", t)
+}
+
+// list parses a list of constants, the [ has been consumed
+func (p *parser) list() (node, error) {
+	l := &list{items: []interface{}{}}
+	for !p.accept("]") {
+		if len(l.items) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			// trailing comma
+			if p.accept("]") {
+				break
+			}
+		}
+
+		t := p.peek()
+		item, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := item.(*literal)
+		if !ok {
+			return nil, p.errorf(t, "list items must be constants")
+		}
+		if len(l.items) > 0 && lit.t != l.elem {
+			return nil, p.errorf(t, "mismatched list items of %s and %s", l.elem, lit.t)
+		}
+		l.elem = lit.t
+		l.items = append(l.items, lit.value)
+	}
+	return l, nil
+}
+
+// call parses a function call, the function name has been consumed
+func (p *parser) call(name token) (node, error) {
+	fn, ok := p.env.Funcs[name.text]
+	if !ok {
+		return nil, p.errorf(name, "undefined function %s", name.text)
+	}
+	p.next()
+
+	args := []node{}
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	if len(args) != len(fn.Args) {
+		return nil, p.errorf(name, "%s expects %d arguments, got %d", name.text, len(fn.Args), len(args))
+	}
+
+	constants := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.typ() != fn.Args[i] {
+			return nil, p.errorf(name, "argument %d of %s is %s, not %s", i+1, name.text, arg.typ(), fn.Args[i])
+		}
+		if lit, ok := arg.(*literal); ok {
+			constants[i] = lit.value
+		}
+	}
+	if fn.Check != nil {
+		if err := fn.Check(constants); err != nil {
+			return nil, p.errorf(name, "%s: %s", name.text, err.Error())
+		}
+	}
+
+	return &call{fn: fn, args: args}, nil
+}
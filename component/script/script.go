@@ -0,0 +1,166 @@
+// Package script implements a small expression language, a script is an
+// expression of strings, integers and booleans, e.g.
+//
+//	geoip(dst_ip, "CN") ? "DIRECT" : dst_port in [80, 443] ? "Proxy" : ""
+//
+// The types are checked when compiling, so that a compiled script never fails.
+package script
+
+import (
+	"sort"
+)
+
+// Type is the type of a value
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Bool
+	List
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int:
+		return "int"
+	case Bool:
+		return "bool"
+	default:
+		return "list"
+	}
+}
+
+// Func is a function which can be called in a script, the values of String,
+// Int and Bool are string, int64 and bool
+type Func struct {
+	Args   []Type
+	Result Type
+	Call   func(args []interface{}) interface{}
+	// Check validates the constant arguments when compiling, the
+	// non-constant ones are nil
+	Check func(args []interface{}) error
+}
+
+// Env is the variables and functions of scripts
+type Env struct {
+	Vars  map[string]Type
+	Funcs map[string]*Func
+}
+
+// Program is a compiled script
+type Program struct {
+	root node
+	vars []string
+}
+
+// Compile parses and checks src in env
+func Compile(src string, env *Env) (*Program, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{src: src, tokens: tokens, env: env, vars: map[string]bool{}}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make([]string, 0, len(p.vars))
+	for name := range p.vars {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+
+	return &Program{root: root, vars: vars}, nil
+}
+
+// Type returns the type of the result
+func (p *Program) Type() Type {
+	return p.root.typ()
+}
+
+// Vars returns the sorted names of the variables used by the program
+func (p *Program) Vars() []string {
+	return p.vars
+}
+
+// Uses reports whether the program uses the variable name
+func (p *Program) Uses(name string) bool {
+	idx := sort.SearchStrings(p.vars, name)
+	return idx < len(p.vars) && p.vars[idx] == name
+}
+
+// Results returns the constant strings which may be the result, the
+// result may be other values if the result isn't always a constant
+func (p *Program) Results() []string {
+	results := []string{}
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case *literal:
+			if s, ok := n.value.(string); ok {
+				results = append(results, s)
+			}
+		case *ternary:
+			walk(n.then)
+			walk(n.otherwise)
+		}
+	}
+	walk(p.root)
+	return results
+}
+
+// Constants returns the constant values of the argument idx of the calls of
+// fn, the non-constant ones are skipped
+func (p *Program) Constants(fn *Func, idx int) []interface{} {
+	constants := []interface{}{}
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case *call:
+			if n.fn == fn && idx < len(n.args) {
+				if lit, ok := n.args[idx].(*literal); ok {
+					constants = append(constants, lit.value)
+				}
+			}
+			for _, arg := range n.args {
+				walk(arg)
+			}
+		case *not:
+			walk(n.x)
+		case *binary:
+			walk(n.x)
+			walk(n.y)
+		case *ternary:
+			walk(n.cond)
+			walk(n.then)
+			walk(n.otherwise)
+		}
+	}
+	walk(p.root)
+	return constants
+}
+
+// Run evaluates the program, vars returns the value of a variable, it is
+// called at most once for each variable
+func (p *Program) Run(vars func(name string) interface{}) interface{} {
+	return p.root.eval(&context{lookup: vars, values: map[string]interface{}{}})
+}
+
+type context struct {
+	lookup func(name string) interface{}
+	values map[string]interface{}
+}
+
+func (c *context) get(name string) interface{} {
+	if v, ok := c.values[name]; ok {
+		return v
+	}
+	v := c.lookup(name)
+	c.values[name] = v
+	return v
+}
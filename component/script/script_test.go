@@ -0,0 +1,103 @@
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testEnv = &Env{
+	Vars: map[string]Type{
+		"host": String,
+		"port": Int,
+	},
+	Funcs: map[string]*Func{
+		"suffix": {
+			Args:   []Type{String, String},
+			Result: Bool,
+			Call: func(args []interface{}) interface{} {
+				return strings.HasSuffix(args[0].(string), args[1].(string))
+			},
+			Check: func(args []interface{}) error {
+				if args[1] == "" {
+					return errors.New("empty suffix")
+				}
+				return nil
+			},
+		},
+	},
+}
+
+func run(p *Program, host string, port int64) interface{} {
+	return p.Run(func(name string) interface{} {
+		if name == "host" {
+			return host
+		}
+		return port
+	})
+}
+
+func TestScript_Run(t *testing.T) {
+	p, err := Compile(`
+		# comment
+		suffix(host, ".cn") ? "DIRECT" :
+		port in [80, 443] && !(host == 'example.com') ? "Proxy" :
+		port >= 8000 || host != "" ? host : ""`, testEnv)
+	assert.Nil(t, err)
+	assert.Equal(t, String, p.Type())
+	assert.Equal(t, []string{"host", "port"}, p.Vars())
+	assert.True(t, p.Uses("port"))
+	assert.False(t, p.Uses("process"))
+	assert.Equal(t, []string{"DIRECT", "Proxy", ""}, p.Results())
+
+	assert.Equal(t, "DIRECT", run(p, "baidu.cn", 443))
+	assert.Equal(t, "Proxy", run(p, "google.com", 443))
+	assert.Equal(t, "example.com", run(p, "example.com", 443))
+	assert.Equal(t, "", run(p, "", 22))
+}
+
+func TestScript_Error(t *testing.T) {
+	cases := map[string]string{
+		``:                       "empty script",
+		`"DIRECT`:                "unterminated string",
+		`host == 1`:              "invalid operation == on string and int",
+		`port ? "A" : "B"`:       "condition is int, not bool",
+		`true ? "A" : 1`:         "mismatched types",
+		`process == "curl"`:      "undefined variable process",
+		`geoip(host)`:            "undefined function geoip",
+		`suffix(host)`:           "expects 2 arguments",
+		`suffix(host, "")`:       "empty suffix",
+		`port in ["80"]`:         "list of string",
+		`[1, 2]`:                 "can't be a list",
+		"true &&\n  @":           "line 2 col 3",
+		`host == "a" "b"`:        "unexpected",
+		`suffix(host, port)`:     "argument 2 of suffix is int",
+		`port in [1, port]`:      "constants",
+		`(host == "a"`:           `expect ")"`,
+		`!host`:                  "invalid operation !",
+		`port < "1"`:             "invalid operation <",
+		`host == "a" || port`:    "invalid operation ||",
+		`true ? [1] : [2]`:       "mismatched types",
+		`port in [1, "2"]`:       "mismatched list items",
+		`suffix(host, "a") == 1`: "invalid operation ==",
+	}
+
+	for src, msg := range cases {
+		_, err := Compile(src, testEnv)
+		if assert.NotNil(t, err, src) {
+			assert.Contains(t, err.Error(), msg, src)
+		}
+	}
+}
+
+func TestScript_Constants(t *testing.T) {
+	p, err := Compile(`
+		!suffix(host, ".cn") && port == 443 ? "A" :
+		suffix(host, ".com") ? suffix(host, "a.com") ? "B" : "C" :
+		suffix(host, host) ? "D" : ""`, testEnv)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{".cn", ".com", "a.com"}, p.Constants(testEnv.Funcs["suffix"], 1))
+	assert.Equal(t, []interface{}{}, p.Constants(testEnv.Funcs["suffix"], 0))
+}
@@ -0,0 +1,131 @@
+package shadowsocks2022
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"lukechampine.com/blake3"
+)
+
+const (
+	MethodBlake3AES128GCM        = "2022-blake3-aes-128-gcm"
+	MethodBlake3AES256GCM        = "2022-blake3-aes-256-gcm"
+	MethodBlake3ChaCha20Poly1305 = "2022-blake3-chacha20-poly1305"
+
+	subkeyContext = "shadowsocks 2022 session subkey"
+
+	// max time difference between client and server
+	maxTimeDiff = 30 * time.Second
+
+	maxPaddingLength = 900
+	maxPayloadLength = 0xffff
+
+	headerTypeClient byte = 0
+	headerTypeServer byte = 1
+)
+
+// IsMethod reports whether method is one of the 2022 edition ciphers
+func IsMethod(method string) bool {
+	return strings.HasPrefix(strings.ToLower(method), "2022-")
+}
+
+type Cipher struct {
+	method  string
+	psk     []byte
+	keySize int
+
+	// block encrypts the separate header of udp packets, only used by aes methods
+	block cipher.Block
+}
+
+// NewCipher returns the cipher of method, password is the base64 encoded PSK
+func NewCipher(method, password string) (*Cipher, error) {
+	var keySize int
+	method = strings.ToLower(method)
+	switch method {
+	case MethodBlake3AES128GCM:
+		keySize = 16
+	case MethodBlake3AES256GCM, MethodBlake3ChaCha20Poly1305:
+		keySize = 32
+	default:
+		return nil, fmt.Errorf("unsupported method: %s", method)
+	}
+
+	if strings.Contains(password, ":") {
+		return nil, fmt.Errorf("%s: identity header is not supported", method)
+	}
+
+	psk, err := base64.StdEncoding.DecodeString(password)
+	if err != nil {
+		return nil, fmt.Errorf("%s: password should be a base64 encoded PSK: %w", method, err)
+	}
+
+	if len(psk) != keySize {
+		return nil, fmt.Errorf("%s: PSK should be %d bytes, got %d", method, keySize, len(psk))
+	}
+
+	c := &Cipher{
+		method:  method,
+		psk:     psk,
+		keySize: keySize,
+	}
+
+	if method != MethodBlake3ChaCha20Poly1305 {
+		if c.block, err = aes.NewCipher(psk); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Cipher) StreamConn(conn net.Conn) net.Conn {
+	return newStreamConn(conn, c)
+}
+
+func (c *Cipher) PacketConn(pc net.PacketConn) net.PacketConn {
+	return newPacketConn(pc, c)
+}
+
+// aead returns the AEAD of the session identified by salt (tcp) or session id (udp)
+func (c *Cipher) aead(salt []byte) (cipher.AEAD, error) {
+	material := make([]byte, 0, len(c.psk)+len(salt))
+	material = append(material, c.psk...)
+	material = append(material, salt...)
+
+	key := make([]byte, c.keySize)
+	blake3.DeriveKey(key, subkeyContext, material)
+
+	if c.method == MethodBlake3ChaCha20Poly1305 {
+		return chacha20poly1305.New(key)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func checkTimestamp(ts uint64) error {
+	diff := time.Since(time.Unix(int64(ts), 0))
+	if diff > maxTimeDiff || diff < -maxTimeDiff {
+		return fmt.Errorf("timestamp is off by %s", diff)
+	}
+	return nil
+}
+
+func increaseNonce(nonce []byte) {
+	for i := range nonce {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
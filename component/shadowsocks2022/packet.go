@@ -0,0 +1,268 @@
+package shadowsocks2022
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/common/pool"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	sessionIDLength       = 8
+	separateHeaderLength  = sessionIDLength + 8
+	replayWindowSize      = 64
+	serverMainHeaderFixed = 1 + 8 + sessionIDLength + 2
+	clientMainHeaderFixed = 1 + 8 + 2
+	maxPacketSize         = 0xffff
+)
+
+var (
+	errShortPacket    = errors.New("short packet")
+	errReplayedPacket = errors.New("replayed packet")
+	errSessionID      = errors.New("client session id mismatch")
+)
+
+// serverSession is the state of the server side session of an udp association
+type serverSession struct {
+	id     []byte
+	aead   cipher.AEAD
+	window replayWindow
+}
+
+type packetConn struct {
+	net.PacketConn
+	cipher *Cipher
+
+	sessionID []byte
+	// aead of the client session, nil for chacha20-poly1305 which uses the PSK
+	aead cipher.AEAD
+
+	mux      sync.Mutex
+	packetID uint64
+	server   *serverSession
+}
+
+func newPacketConn(pc net.PacketConn, c *Cipher) *packetConn {
+	sessionID := make([]byte, sessionIDLength)
+	rand.Read(sessionID)
+
+	conn := &packetConn{PacketConn: pc, cipher: c, sessionID: sessionID}
+	if c.block != nil {
+		// the key derivation never fails with a valid key size
+		conn.aead, _ = c.aead(sessionID)
+	}
+
+	return conn
+}
+
+// WriteTo encrypts b, which should start with the socks5 address of the target
+func (pc *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	pc.mux.Lock()
+	packetID := pc.packetID
+	pc.packetID++
+	pc.mux.Unlock()
+
+	header := make([]byte, separateHeaderLength, separateHeaderLength+clientMainHeaderFixed+len(b))
+	copy(header, pc.sessionID)
+	binary.BigEndian.PutUint64(header[sessionIDLength:], packetID)
+
+	// main header without padding
+	plaintext := append(header, headerTypeClient)
+	plaintext = append(plaintext, make([]byte, 8+2)...)
+	binary.BigEndian.PutUint64(plaintext[separateHeaderLength+1:], uint64(time.Now().Unix()))
+	plaintext = append(plaintext, b...)
+
+	buf := pool.Get(maxPacketSize)
+	defer pool.Put(buf)
+
+	var packet []byte
+	if pc.aead == nil {
+		aead, err := chacha20poly1305.NewX(pc.cipher.psk)
+		if err != nil {
+			return 0, err
+		}
+
+		nonce := buf[:aead.NonceSize()]
+		rand.Read(nonce)
+		packet = aead.Seal(nonce, nonce, plaintext, nil)
+	} else {
+		packet = buf[:separateHeaderLength]
+		pc.cipher.block.Encrypt(packet, plaintext[:separateHeaderLength])
+		packet = pc.aead.Seal(packet, plaintext[4:separateHeaderLength], plaintext[separateHeaderLength:], nil)
+	}
+
+	if _, err := pc.PacketConn.WriteTo(packet, addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// ReadFrom decrypts a packet from server, b receives the socks5 address and the payload
+func (pc *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := pool.Get(maxPacketSize)
+	defer pool.Put(buf)
+
+	n, addr, err := pc.PacketConn.ReadFrom(buf)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	header, body, err := pc.open(buf[:n])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(body) < serverMainHeaderFixed {
+		return 0, nil, errShortPacket
+	}
+
+	if body[0] != headerTypeServer {
+		return 0, nil, errHeaderType
+	}
+
+	if err := checkTimestamp(binary.BigEndian.Uint64(body[1:])); err != nil {
+		return 0, nil, err
+	}
+
+	if !bytes.Equal(body[9:9+sessionIDLength], pc.sessionID) {
+		return 0, nil, errSessionID
+	}
+
+	paddingLen := int(binary.BigEndian.Uint16(body[9+sessionIDLength:]))
+	body = body[serverMainHeaderFixed:]
+	if len(body) < paddingLen {
+		return 0, nil, errShortPacket
+	}
+
+	if err := pc.checkReplay(header); err != nil {
+		return 0, nil, err
+	}
+
+	return copy(b, body[paddingLen:]), addr, nil
+}
+
+// open returns the separate header and the main body of packet
+func (pc *packetConn) open(packet []byte) ([]byte, []byte, error) {
+	if pc.aead == nil {
+		aead, err := chacha20poly1305.NewX(pc.cipher.psk)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(packet) < aead.NonceSize()+separateHeaderLength+aead.Overhead() {
+			return nil, nil, errShortPacket
+		}
+
+		nonce := packet[:aead.NonceSize()]
+		plaintext, err := aead.Open(packet[aead.NonceSize():aead.NonceSize()], nonce, packet[aead.NonceSize():], nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(plaintext) < separateHeaderLength {
+			return nil, nil, errShortPacket
+		}
+
+		return plaintext[:separateHeaderLength], plaintext[separateHeaderLength:], nil
+	}
+
+	if len(packet) < separateHeaderLength+pc.aead.Overhead() {
+		return nil, nil, errShortPacket
+	}
+
+	header := packet[:separateHeaderLength]
+	pc.cipher.block.Decrypt(header, header)
+
+	aead, err := pc.serverAEAD(header[:sessionIDLength])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := aead.Open(packet[separateHeaderLength:separateHeaderLength], header[4:], packet[separateHeaderLength:], nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return header, body, nil
+}
+
+func (pc *packetConn) serverAEAD(sessionID []byte) (cipher.AEAD, error) {
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+
+	if pc.server != nil && bytes.Equal(pc.server.id, sessionID) {
+		return pc.server.aead, nil
+	}
+
+	return pc.cipher.aead(sessionID)
+}
+
+// checkReplay must only be called with an authenticated header
+func (pc *packetConn) checkReplay(header []byte) error {
+	sessionID := header[:sessionIDLength]
+	packetID := binary.BigEndian.Uint64(header[sessionIDLength:])
+
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+
+	// a new server session replaces the old one
+	if pc.server == nil || !bytes.Equal(pc.server.id, sessionID) {
+		session := &serverSession{id: append([]byte{}, sessionID...)}
+		if pc.aead != nil {
+			session.aead, _ = pc.cipher.aead(session.id)
+		}
+		pc.server = session
+	}
+
+	if !pc.server.window.check(packetID) {
+		return errReplayedPacket
+	}
+	return nil
+}
+
+// replayWindow is a sliding window filter of packet ids
+type replayWindow struct {
+	last   uint64
+	bitmap uint64
+	init   bool
+}
+
+func (w *replayWindow) check(id uint64) bool {
+	if !w.init {
+		w.init = true
+		w.last = id
+		w.bitmap = 1
+		return true
+	}
+
+	if id > w.last {
+		shift := id - w.last
+		if shift >= replayWindowSize {
+			w.bitmap = 1
+		} else {
+			w.bitmap = w.bitmap<<shift | 1
+		}
+		w.last = id
+		return true
+	}
+
+	offset := w.last - id
+	if offset >= replayWindowSize {
+		return false
+	}
+
+	mask := uint64(1) << offset
+	if w.bitmap&mask != 0 {
+		return false
+	}
+	w.bitmap |= mask
+	return true
+}
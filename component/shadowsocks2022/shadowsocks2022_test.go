@@ -0,0 +1,180 @@
+package shadowsocks2022
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/component/socks5"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var methods = []string{MethodBlake3AES128GCM, MethodBlake3AES256GCM, MethodBlake3ChaCha20Poly1305}
+
+func newTestCipher(t *testing.T, method string) *Cipher {
+	size := 32
+	if method == MethodBlake3AES128GCM {
+		size = 16
+	}
+
+	c, err := NewCipher(method, base64.StdEncoding.EncodeToString(make([]byte, size)))
+	assert.Nil(t, err)
+	return c
+}
+
+func TestNewCipher_PSK(t *testing.T) {
+	_, err := NewCipher(MethodBlake3AES256GCM, base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	assert.NotNil(t, err)
+
+	_, err = NewCipher(MethodBlake3AES128GCM, "not base64")
+	assert.NotNil(t, err)
+
+	_, err = NewCipher("2022-blake3-unknown", "")
+	assert.NotNil(t, err)
+}
+
+func TestStreamConn(t *testing.T) {
+	for _, method := range methods {
+		c := newTestCipher(t, method)
+		client, server := net.Pipe()
+
+		go func() {
+			conn := c.StreamConn(client)
+			conn.Write(socks5.ParseAddr("example.com:443"))
+			conn.Write([]byte("ping"))
+		}()
+
+		// server side
+		salt := make([]byte, c.keySize)
+		_, err := io.ReadFull(server, salt)
+		assert.Nil(t, err)
+
+		reader := &streamConn{Conn: server, cipher: c}
+		reader.reader, _ = c.aead(salt)
+		reader.rNonce = make([]byte, reader.reader.NonceSize())
+
+		fixed, err := reader.open(1 + 8 + 2)
+		assert.Nil(t, err)
+		assert.Equal(t, headerTypeClient, fixed[0])
+
+		variable, err := reader.open(int(binary.BigEndian.Uint16(fixed[9:])))
+		assert.Nil(t, err)
+		addr := socks5.SplitAddr(variable)
+		assert.Equal(t, "example.com:443", addr.String())
+
+		payload, err := reader.readChunk()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("ping"), payload)
+
+		// response
+		go func() {
+			writer := &streamConn{Conn: server, cipher: c}
+			respSalt := make([]byte, c.keySize)
+			writer.writer, _ = c.aead(respSalt)
+			writer.wNonce = make([]byte, writer.writer.NonceSize())
+
+			header := []byte{headerTypeServer}
+			header = append(header, make([]byte, 8)...)
+			binary.BigEndian.PutUint64(header[1:], uint64(time.Now().Unix()))
+			header = append(header, salt...)
+			header = append(header, 0, 4)
+
+			buf := append([]byte{}, respSalt...)
+			buf = writer.seal(buf, header)
+			buf = writer.seal(buf, []byte("pong"))
+			server.Write(buf)
+		}()
+
+		conn := &streamConn{Conn: client, cipher: c, requestSalt: salt}
+		resp := make([]byte, 4)
+		_, err = io.ReadFull(conn, resp)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("pong"), resp)
+	}
+}
+
+func TestPacketConn(t *testing.T) {
+	for _, method := range methods {
+		c := newTestCipher(t, method)
+		client, _ := net.ListenPacket("udp", "127.0.0.1:0")
+		server, _ := net.ListenPacket("udp", "127.0.0.1:0")
+
+		pc := newPacketConn(client, c)
+		target := socks5.ParseAddr("1.1.1.1:53")
+		_, err := pc.WriteTo(append(append([]byte{}, target...), []byte("query")...), server.LocalAddr())
+		assert.Nil(t, err)
+
+		buf := make([]byte, maxPacketSize)
+		n, _, err := server.ReadFrom(buf)
+		assert.Nil(t, err)
+
+		// decode the client packet and echo it back with the server header
+		var header, body []byte
+		if c.block == nil {
+			aead, _ := chacha20poly1305.NewX(c.psk)
+			plaintext, err := aead.Open(nil, buf[:aead.NonceSize()], buf[aead.NonceSize():n], nil)
+			assert.Nil(t, err)
+			header, body = plaintext[:separateHeaderLength], plaintext[separateHeaderLength:]
+		} else {
+			header = make([]byte, separateHeaderLength)
+			c.block.Decrypt(header, buf[:separateHeaderLength])
+			aead, _ := c.aead(header[:sessionIDLength])
+			body, err = aead.Open(nil, header[4:], buf[separateHeaderLength:n], nil)
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, pc.sessionID, header[:sessionIDLength])
+		assert.Equal(t, headerTypeClient, body[0])
+		assert.Equal(t, target, socks5.SplitAddr(body[clientMainHeaderFixed:]))
+
+		serverSessionID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+		respHeader := append(append([]byte{}, serverSessionID...), 0, 0, 0, 0, 0, 0, 0, 0)
+		respBody := []byte{headerTypeServer}
+		respBody = append(respBody, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(respBody[1:], uint64(time.Now().Unix()))
+		respBody = append(respBody, pc.sessionID...)
+		respBody = append(respBody, 0, 0)
+		respBody = append(respBody, body[clientMainHeaderFixed:]...)
+
+		var packet []byte
+		if c.block == nil {
+			aead, _ := chacha20poly1305.NewX(c.psk)
+			nonce := make([]byte, aead.NonceSize())
+			packet = aead.Seal(nonce, nonce, append(respHeader, respBody...), nil)
+		} else {
+			packet = make([]byte, separateHeaderLength)
+			c.block.Encrypt(packet, respHeader)
+			aead, _ := c.aead(serverSessionID)
+			packet = aead.Seal(packet, respHeader[4:], respBody, nil)
+		}
+
+		for i := 0; i < 2; i++ {
+			server.WriteTo(packet, client.LocalAddr())
+		}
+
+		n, _, err = pc.ReadFrom(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, append(append([]byte{}, target...), []byte("query")...), buf[:n])
+
+		// same packet id again
+		_, _, err = pc.ReadFrom(buf)
+		assert.Equal(t, errReplayedPacket, err)
+
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	w := replayWindow{}
+	assert.True(t, w.check(10))
+	assert.False(t, w.check(10))
+	assert.True(t, w.check(8))
+	assert.True(t, w.check(100))
+	assert.False(t, w.check(20))
+	assert.True(t, w.check(99))
+}
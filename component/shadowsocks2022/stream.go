@@ -0,0 +1,227 @@
+package shadowsocks2022
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	mathRand "math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/socks5"
+)
+
+var (
+	errNoRequest   = errors.New("read before request is sent")
+	errHeaderType  = errors.New("invalid response header type")
+	errRequestSalt = errors.New("request salt mismatch")
+)
+
+type streamConn struct {
+	net.Conn
+	cipher *Cipher
+
+	// requestSalt is written once by the first Write and read by the response header
+	mux         sync.Mutex
+	requestSalt []byte
+
+	writer cipher.AEAD
+	wNonce []byte
+
+	reader   cipher.AEAD
+	rNonce   []byte
+	leftover []byte
+}
+
+func newStreamConn(conn net.Conn, c *Cipher) *streamConn {
+	return &streamConn{Conn: conn, cipher: c}
+}
+
+// Write sends the request header along with b on first call,
+// b should start with the socks5 address of the target.
+func (sc *streamConn) Write(b []byte) (int, error) {
+	if sc.writer == nil {
+		if err := sc.writeRequest(b); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	total := len(b)
+	for len(b) > 0 {
+		n := len(b)
+		if n > maxPayloadLength {
+			n = maxPayloadLength
+		}
+
+		if err := sc.writeChunk(b[:n]); err != nil {
+			return total - len(b), err
+		}
+		b = b[n:]
+	}
+
+	return total, nil
+}
+
+func (sc *streamConn) writeRequest(b []byte) error {
+	addr := socks5.SplitAddr(b)
+	if addr == nil {
+		return errors.New("request should start with a socks5 address")
+	}
+	payload := b[len(addr):]
+
+	var rest []byte
+	if limit := maxPayloadLength - len(addr) - 2; len(payload) > limit {
+		payload, rest = payload[:limit], payload[limit:]
+	}
+
+	salt := make([]byte, sc.cipher.keySize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	aead, err := sc.cipher.aead(salt)
+	if err != nil {
+		return err
+	}
+	sc.writer = aead
+	sc.wNonce = make([]byte, aead.NonceSize())
+
+	// padding is required if there is no initial payload
+	paddingLen := 0
+	if len(payload) == 0 {
+		paddingLen = mathRand.Intn(maxPaddingLength) + 1
+	}
+
+	variable := make([]byte, 0, len(addr)+2+paddingLen+len(payload))
+	variable = append(variable, addr...)
+	variable = append(variable, byte(paddingLen>>8), byte(paddingLen))
+	variable = append(variable, make([]byte, paddingLen)...)
+	variable = append(variable, payload...)
+
+	fixed := make([]byte, 1+8+2)
+	fixed[0] = headerTypeClient
+	binary.BigEndian.PutUint64(fixed[1:], uint64(time.Now().Unix()))
+	binary.BigEndian.PutUint16(fixed[9:], uint16(len(variable)))
+
+	buf := make([]byte, 0, len(salt)+len(fixed)+len(variable)+2*aead.Overhead())
+	buf = append(buf, salt...)
+	buf = sc.seal(buf, fixed)
+	buf = sc.seal(buf, variable)
+
+	sc.mux.Lock()
+	sc.requestSalt = salt
+	sc.mux.Unlock()
+
+	if _, err = sc.Conn.Write(buf); err != nil {
+		return err
+	}
+
+	if len(rest) != 0 {
+		_, err = sc.Write(rest)
+	}
+	return err
+}
+
+func (sc *streamConn) writeChunk(b []byte) error {
+	buf := make([]byte, 0, 2+len(b)+2*sc.writer.Overhead())
+	buf = sc.seal(buf, []byte{byte(len(b) >> 8), byte(len(b))})
+	buf = sc.seal(buf, b)
+
+	_, err := sc.Conn.Write(buf)
+	return err
+}
+
+func (sc *streamConn) seal(dst, plaintext []byte) []byte {
+	dst = sc.writer.Seal(dst, sc.wNonce, plaintext, nil)
+	increaseNonce(sc.wNonce)
+	return dst
+}
+
+func (sc *streamConn) Read(b []byte) (int, error) {
+	// the first payload of the response may be empty
+	for len(sc.leftover) == 0 {
+		var err error
+		if sc.reader == nil {
+			sc.leftover, err = sc.readResponse()
+		} else {
+			sc.leftover, err = sc.readChunk()
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, sc.leftover)
+	sc.leftover = sc.leftover[n:]
+	return n, nil
+}
+
+func (sc *streamConn) readResponse() ([]byte, error) {
+	sc.mux.Lock()
+	requestSalt := sc.requestSalt
+	sc.mux.Unlock()
+	if requestSalt == nil {
+		return nil, errNoRequest
+	}
+
+	salt := make([]byte, sc.cipher.keySize)
+	if _, err := io.ReadFull(sc.Conn, salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := sc.cipher.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	sc.reader = aead
+	sc.rNonce = make([]byte, aead.NonceSize())
+
+	fixed, err := sc.open(1 + 8 + len(requestSalt) + 2)
+	if err != nil {
+		return nil, err
+	}
+
+	if fixed[0] != headerTypeServer {
+		return nil, errHeaderType
+	}
+
+	if err := checkTimestamp(binary.BigEndian.Uint64(fixed[1:])); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(fixed[9:9+len(requestSalt)], requestSalt) {
+		return nil, errRequestSalt
+	}
+
+	return sc.open(int(binary.BigEndian.Uint16(fixed[9+len(requestSalt):])))
+}
+
+func (sc *streamConn) readChunk() ([]byte, error) {
+	length, err := sc.open(2)
+	if err != nil {
+		return nil, err
+	}
+
+	return sc.open(int(binary.BigEndian.Uint16(length)))
+}
+
+// open reads and decrypts a sealed chunk of size plaintext bytes
+func (sc *streamConn) open(size int) ([]byte, error) {
+	buf := make([]byte, size+sc.reader.Overhead())
+	if _, err := io.ReadFull(sc.Conn, buf); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := sc.reader.Open(buf[:0], sc.rNonce, buf, nil)
+	if err != nil {
+		return nil, err
+	}
+	increaseNonce(sc.rNonce)
+
+	return plaintext, nil
+}
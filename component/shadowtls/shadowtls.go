@@ -0,0 +1,167 @@
+// Package shadowtls is the client of the ShadowTLS transport. The client does
+// a real TLS handshake with a decoy server relayed by the ShadowTLS server,
+// then the data is sent in TLS application data records authenticated by
+// HMAC with the password.
+package shadowtls
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+
+	"github.com/Dreamacro/clash/common/pool"
+	tlsC "github.com/Dreamacro/clash/component/tls"
+)
+
+const (
+	tlsHeaderLen = 5
+	// maxPayload is the max plaintext of a TLS record
+	maxPayload = 1 << 14
+
+	typeAlert           = 21
+	typeHandshake       = 22
+	typeApplicationData = 23
+
+	// v2HashLen is the length of the HMAC prefix of the first record of v2
+	v2HashLen = 8
+)
+
+var defaultALPN = []string{"h2", "http/1.1"}
+
+// Option of a ShadowTLS client, Host is the server name of the decoy
+// handshake and Version is 2 or 3
+type Option struct {
+	Host           string
+	Password       string
+	Version        int
+	SkipCertVerify bool
+	// Fingerprint is the ClientHello of the handshake, v3 mimics Chrome if
+	// it's nil since the session ID is generated by uTLS
+	Fingerprint *tlsC.Fingerprint
+}
+
+// StreamConn does the handshake of option on conn and returns the conn of the
+// authenticated records
+func StreamConn(conn net.Conn, option *Option) (net.Conn, error) {
+	config := &tls.Config{
+		ServerName:         option.Host,
+		InsecureSkipVerify: option.SkipCertVerify,
+		NextProtos:         defaultALPN,
+	}
+
+	switch option.Version {
+	case 2:
+		hc := &hashedConn{Conn: conn, hasher: hmac.New(sha1.New, []byte(option.Password))}
+		if _, err := tlsC.StreamConn(hc, config, option.Fingerprint); err != nil {
+			return nil, fmt.Errorf("shadow-tls handshake error: %w", err)
+		}
+		return &v2Conn{Conn: conn, hash: hc.hasher.Sum(nil)[:v2HashLen]}, nil
+	case 3:
+		return streamConnV3(conn, config, option)
+	default:
+		return nil, fmt.Errorf("unsupported shadow-tls version: %d", option.Version)
+	}
+}
+
+// hashedConn computes the HMAC of the handshake data from the server
+type hashedConn struct {
+	net.Conn
+	hasher hash.Hash
+}
+
+func (hc *hashedConn) Read(b []byte) (int, error) {
+	n, err := hc.Conn.Read(b)
+	hc.hasher.Write(b[:n])
+	return n, err
+}
+
+// readRecord reads a TLS record, the header is returned with the payload
+func readRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, tlsHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(binary.BigEndian.Uint16(header[3:]))
+	record := make([]byte, tlsHeaderLen+length)
+	copy(record, header)
+	if _, err := io.ReadFull(r, record[tlsHeaderLen:]); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// writeRecord writes the application data record of the parts
+func writeRecord(w io.Writer, parts ...[]byte) error {
+	length := 0
+	for _, part := range parts {
+		length += len(part)
+	}
+
+	buf := pool.Get(tlsHeaderLen + length)
+	defer pool.Put(buf)
+
+	buf[0], buf[1], buf[2] = typeApplicationData, 3, 3
+	binary.BigEndian.PutUint16(buf[3:], uint16(length))
+	offset := tlsHeaderLen
+	for _, part := range parts {
+		offset += copy(buf[offset:], part)
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// v2Conn sends the data in application data records, the first record is
+// prefixed with the HMAC of the handshake data from the server
+type v2Conn struct {
+	net.Conn
+	hash   []byte
+	remain []byte
+}
+
+func (c *v2Conn) Read(b []byte) (int, error) {
+	for len(c.remain) == 0 {
+		record, err := readRecord(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+
+		switch record[0] {
+		case typeApplicationData:
+			c.remain = record[tlsHeaderLen:]
+		case typeAlert:
+			return 0, errors.New("shadow-tls remote alert")
+		default:
+			return 0, fmt.Errorf("unexpected TLS record type: %d", record[0])
+		}
+	}
+
+	n := copy(b, c.remain)
+	c.remain = c.remain[n:]
+	return n, nil
+}
+
+func (c *v2Conn) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxPayload-len(c.hash) {
+			chunk = chunk[:maxPayload-len(c.hash)]
+		}
+
+		if err := writeRecord(c.Conn, c.hash, chunk); err != nil {
+			return written, err
+		}
+		c.hash = nil
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,49 @@
+package shadowtls
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"hash"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSessionID(t *testing.T) {
+	password := []byte("password")
+	hello := make([]byte, sessionIDStart+sessionIDLen+16)
+	sessionID := make([]byte, sessionIDLen)
+	assert.Nil(t, generateSessionID(password)(hello, sessionID))
+
+	h := hmac.New(sha1.New, password)
+	h.Write(hello[:sessionIDStart])
+	h.Write(sessionID[:sessionIDLen-hmacLen])
+	h.Write(make([]byte, hmacLen))
+	h.Write(hello[sessionIDStart+sessionIDLen:])
+	assert.Equal(t, h.Sum(nil)[:hmacLen], sessionID[sessionIDLen-hmacLen:])
+
+	assert.NotNil(t, generateSessionID(password)(hello[:sessionIDStart], sessionID))
+}
+
+func TestV3Conn(t *testing.T) {
+	newHMAC := func() hash.Hash {
+		h := hmac.New(sha1.New, []byte("password"))
+		h.Write([]byte("C"))
+		return h
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	payload := bytes.Repeat([]byte{1}, 2*maxPayload)
+	go (&v3Conn{Conn: client, write: newHMAC()}).Write(payload)
+
+	buf := make([]byte, len(payload))
+	_, err := io.ReadFull(&v3Conn{Conn: server, verify: newHMAC()}, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, buf)
+}
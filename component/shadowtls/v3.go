@@ -0,0 +1,217 @@
+package shadowtls
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+
+	tlsC "github.com/Dreamacro/clash/component/tls"
+)
+
+const (
+	hmacLen   = 4
+	randomLen = 32
+
+	typeServerHello = 2
+
+	// sessionIDStart is the offset of the session ID in the ClientHello
+	// message: type, length, version, random and the length of session ID
+	sessionIDStart = 1 + 3 + 2 + randomLen + 1
+	sessionIDLen   = 32
+	// serverRandomStart is the offset of the random in the ServerHello record
+	serverRandomStart = tlsHeaderLen + 1 + 3 + 2
+)
+
+// generateSessionID returns the session ID generator of v3, the last bytes of
+// the session ID are the HMAC of the ClientHello
+func generateSessionID(password []byte) func(hello, sessionID []byte) error {
+	return func(hello, sessionID []byte) error {
+		if len(hello) < sessionIDStart+sessionIDLen {
+			return errors.New("unexpected ClientHello length")
+		}
+		if _, err := rand.Read(sessionID[:sessionIDLen-hmacLen]); err != nil {
+			return err
+		}
+
+		h := hmac.New(sha1.New, password)
+		h.Write(hello[:sessionIDStart])
+		h.Write(sessionID)
+		h.Write(hello[sessionIDStart+sessionIDLen:])
+		copy(sessionID[sessionIDLen-hmacLen:], h.Sum(nil)[:hmacLen])
+		return nil
+	}
+}
+
+func streamConnV3(conn net.Conn, config *tls.Config, option *Option) (net.Conn, error) {
+	password := []byte(option.Password)
+	hc := &handshakeConn{Conn: conn, password: password}
+	config.MinVersion = tls.VersionTLS13
+	if _, err := tlsC.StreamConnWithSessionID(hc, config, option.Fingerprint, generateSessionID(password)); err != nil {
+		return nil, fmt.Errorf("shadow-tls handshake error: %w", err)
+	}
+	if !hc.authorized {
+		return nil, errors.New("shadow-tls handshake isn't authorized, the traffic is hijacked or the server doesn't support TLS 1.3")
+	}
+
+	write := hmac.New(sha1.New, password)
+	write.Write(hc.serverRandom)
+	write.Write([]byte("C"))
+	verify := hmac.New(sha1.New, password)
+	verify.Write(hc.serverRandom)
+	verify.Write([]byte("S"))
+
+	return &v3Conn{
+		Conn:   conn,
+		write:  write,
+		verify: verify,
+		ignore: hc.readHMAC,
+	}, nil
+}
+
+// handshakeConn restores the handshake records of the server for the TLS
+// client. The server XORs the application data records of the decoy by a key
+// of the ServerRandom and prefixes the HMAC of the records.
+type handshakeConn struct {
+	net.Conn
+	password []byte
+
+	serverRandom []byte
+	readHMAC     hash.Hash
+	key          []byte
+	// authorized is true if the last application data is from the server
+	authorized bool
+
+	remain []byte
+}
+
+func (hc *handshakeConn) Read(b []byte) (int, error) {
+	if len(hc.remain) == 0 {
+		record, err := readRecord(hc.Conn)
+		if err != nil {
+			return 0, err
+		}
+
+		switch record[0] {
+		case typeHandshake:
+			if len(record) > serverRandomStart+randomLen && record[tlsHeaderLen] == typeServerHello {
+				hc.serverRandom = append([]byte{}, record[serverRandomStart:serverRandomStart+randomLen]...)
+				hc.readHMAC = hmac.New(sha1.New, hc.password)
+				hc.readHMAC.Write(hc.serverRandom)
+
+				key := sha256.New()
+				key.Write(hc.password)
+				key.Write(hc.serverRandom)
+				hc.key = key.Sum(nil)
+			}
+		case typeApplicationData:
+			hc.authorized = false
+			if len(record) > tlsHeaderLen+hmacLen && hc.readHMAC != nil {
+				data := record[tlsHeaderLen+hmacLen:]
+				hc.readHMAC.Write(data)
+				if hmac.Equal(hc.readHMAC.Sum(nil)[:hmacLen], record[tlsHeaderLen:tlsHeaderLen+hmacLen]) {
+					for i := range data {
+						data[i] ^= hc.key[i%len(hc.key)]
+					}
+
+					// drop the HMAC
+					copy(record[hmacLen:], record[:tlsHeaderLen])
+					record = record[hmacLen:]
+					binary.BigEndian.PutUint16(record[3:], uint16(len(data)))
+					hc.authorized = true
+				}
+			}
+		}
+		hc.remain = record
+	}
+
+	n := copy(b, hc.remain)
+	hc.remain = hc.remain[n:]
+	return n, nil
+}
+
+// v3Conn sends the data in application data records prefixed with the
+// chained HMAC of the records
+type v3Conn struct {
+	net.Conn
+	write  hash.Hash
+	verify hash.Hash
+	// ignore verifies the remaining records of the decoy, e.g. the session
+	// tickets, which are dropped
+	ignore hash.Hash
+
+	remain []byte
+}
+
+// verifyRecord returns whether the HMAC of record is h, the HMAC is written
+// into h for the next record if chain
+func verifyRecord(record []byte, h hash.Hash, chain bool) bool {
+	if len(record) < tlsHeaderLen+hmacLen || record[1] != 3 || record[2] != 3 {
+		return false
+	}
+
+	h.Write(record[tlsHeaderLen+hmacLen:])
+	sum := h.Sum(nil)[:hmacLen]
+	if chain {
+		h.Write(sum)
+	}
+	return hmac.Equal(record[tlsHeaderLen:tlsHeaderLen+hmacLen], sum)
+}
+
+func (c *v3Conn) Read(b []byte) (int, error) {
+	for len(c.remain) == 0 {
+		record, err := readRecord(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+
+		switch record[0] {
+		case typeApplicationData:
+			if c.ignore != nil {
+				if verifyRecord(record, c.ignore, false) {
+					continue
+				}
+				c.ignore = nil
+			}
+
+			if !verifyRecord(record, c.verify, true) {
+				return 0, errors.New("shadow-tls application data verification failed")
+			}
+			c.remain = record[tlsHeaderLen+hmacLen:]
+		case typeAlert:
+			return 0, errors.New("shadow-tls remote alert")
+		default:
+			return 0, fmt.Errorf("unexpected TLS record type: %d", record[0])
+		}
+	}
+
+	n := copy(b, c.remain)
+	c.remain = c.remain[n:]
+	return n, nil
+}
+
+func (c *v3Conn) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxPayload-hmacLen {
+			chunk = chunk[:maxPayload-hmacLen]
+		}
+
+		c.write.Write(chunk)
+		sum := c.write.Sum(nil)[:hmacLen]
+		c.write.Write(sum)
+		if err := writeRecord(c.Conn, sum, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
@@ -9,19 +9,29 @@ import (
 	"net"
 	"sync"
 
+	"github.com/Dreamacro/clash/common/pool"
+	"github.com/Dreamacro/clash/component/socks5"
+
 	"github.com/Dreamacro/go-shadowsocks2/shadowaead"
 )
 
 const (
 	Version1            = 1
 	Version2            = 2
+	Version3            = 3
 	DefaultSnellVersion = Version1
+
+	// maxLength is the max payload length of a chunk, a UDP packet is sent in one chunk
+	maxLength = 0x3FFF
 )
 
 const (
 	CommandPing      byte = 0
 	CommandConnect   byte = 1
 	CommandConnectV2 byte = 5
+	CommandUDP       byte = 6
+
+	CommandUDPForward byte = 1
 
 	CommandTunnel byte = 0
 	CommandPong   byte = 1
@@ -83,7 +93,7 @@ func WriteHeader(conn net.Conn, host string, port uint, version int) error {
 	buf.Reset()
 	defer bufferPool.Put(buf)
 	buf.WriteByte(Version)
-	if version == Version2 {
+	if version != Version1 {
 		buf.WriteByte(CommandConnectV2)
 	} else {
 		buf.WriteByte(CommandConnect)
@@ -104,7 +114,18 @@ func WriteHeader(conn net.Conn, host string, port uint, version int) error {
 	return nil
 }
 
-// HalfClose works only on version2
+// WriteUDPHeader starts a UDP session, it works only on version3
+func WriteUDPHeader(conn net.Conn, version int) error {
+	if version < Version3 {
+		return errors.New("unsupported UDP version")
+	}
+
+	// version, command, clientID length
+	_, err := conn.Write([]byte{Version, CommandUDP, 0x00})
+	return err
+}
+
+// HalfClose works only on version2 and version3
 func HalfClose(conn net.Conn) error {
 	if _, err := conn.Write(endSignal); err != nil {
 		return err
@@ -118,10 +139,118 @@ func HalfClose(conn net.Conn) error {
 
 func StreamConn(conn net.Conn, psk []byte, version int) *Snell {
 	var cipher shadowaead.Cipher
-	if version == Version2 {
+	if version != Version1 {
 		cipher = NewAES128GCM(psk)
 	} else {
 		cipher = NewChacha20Poly1305(psk)
 	}
 	return &Snell{Conn: shadowaead.NewConn(conn, cipher)}
 }
+
+// packetConn transports UDP packets of a snell v3 UDP session, each packet is a chunk
+type packetConn struct {
+	net.Conn
+	rMux sync.Mutex
+	wMux sync.Mutex
+}
+
+func (pc *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	pc.wMux.Lock()
+	defer pc.wMux.Unlock()
+
+	socksAddr := socks5.ParseAddrToSocksAddr(addr)
+	if socksAddr == nil {
+		return 0, errors.New("parse addr error")
+	}
+	return WritePacket(pc.Conn, socksAddr, b)
+}
+
+func (pc *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	pc.rMux.Lock()
+	defer pc.rMux.Unlock()
+
+	addr, n, err := ReadPacket(pc.Conn, b)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, addr, nil
+}
+
+// WritePacket writes payload to socks5Addr in one chunk, the server sends each
+// chunk as a datagram, so a packet larger than a chunk is rejected instead of
+// being split
+func WritePacket(w io.Writer, socks5Addr socks5.Addr, payload []byte) (int, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+
+	// the address of snell is: command(1) host length(1) host or
+	// command(1) 0x00(1) ip version(1) ip, then port(2)
+	buf.WriteByte(CommandUDPForward)
+	switch socks5Addr[0] {
+	case socks5.AtypDomainName:
+		hostLen := socks5Addr[1]
+		buf.Write(socks5Addr[1 : 1+1+hostLen+2])
+	case socks5.AtypIPv4:
+		buf.Write([]byte{0x00, 0x04})
+		buf.Write(socks5Addr[1 : 1+net.IPv4len+2])
+	case socks5.AtypIPv6:
+		buf.Write([]byte{0x00, 0x06})
+		buf.Write(socks5Addr[1 : 1+net.IPv6len+2])
+	default:
+		return 0, errors.New("address type invalid")
+	}
+
+	if buf.Len()+len(payload) > maxLength {
+		return 0, fmt.Errorf("packet of %d bytes exceeds the chunk size %d", len(payload), maxLength-buf.Len())
+	}
+
+	buf.Write(payload)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// ReadPacket reads a packet into payload, the address of reply is always an ip
+func ReadPacket(r io.Reader, payload []byte) (net.Addr, int, error) {
+	buf := pool.Get(pool.RelayBufferSize)
+	defer pool.Put(buf)
+
+	n, err := r.Read(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// reply: ip version(1) ip port(2) payload
+	headLen := 1
+	if n < headLen {
+		return nil, 0, errors.New("insufficient UDP length")
+	}
+	switch buf[0] {
+	case 0x04:
+		headLen += net.IPv4len + 2
+		buf[0] = socks5.AtypIPv4
+	case 0x06:
+		headLen += net.IPv6len + 2
+		buf[0] = socks5.AtypIPv6
+	default:
+		return nil, 0, errors.New("ip version invalid")
+	}
+	if n < headLen {
+		return nil, 0, errors.New("insufficient UDP length")
+	}
+
+	addr := socks5.SplitAddr(buf[:headLen])
+	if addr == nil {
+		return nil, 0, errors.New("remote address invalid")
+	}
+
+	length := copy(payload, buf[headLen:n])
+	return addr.UDPAddr(), length, nil
+}
+
+// PacketConn returns a net.PacketConn of a snell v3 UDP session
+func PacketConn(conn net.Conn) net.PacketConn {
+	return &packetConn{Conn: conn}
+}
@@ -0,0 +1,76 @@
+package snell
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/Dreamacro/clash/component/socks5"
+
+	"github.com/Dreamacro/go-shadowsocks2/shadowaead"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePacket(t *testing.T) {
+	addr := socks5.ParseAddr("1.1.1.1:53")
+
+	buf := &bytes.Buffer{}
+	n, err := WritePacket(buf, addr, make([]byte, 1000))
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, n)
+	assert.Equal(t, 1+2+4+2+1000, buf.Len())
+
+	buf.Reset()
+	_, err = WritePacket(buf, addr, make([]byte, maxLength))
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestPacket_RoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	psk := []byte("psk")
+	pc := PacketConn(StreamConn(client, psk, Version3))
+	// the server side reads the chunks without the snell response
+	sc := shadowaead.NewConn(server, NewAES128GCM(psk))
+
+	addr := socks5.ParseAddr("1.1.1.1:53")
+	// the largest packet still fits in one chunk
+	payload := bytes.Repeat([]byte{0xff}, maxLength-1-2-4-2)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := pc.WriteTo(payload, addr.UDPAddr())
+		errCh <- err
+	}()
+
+	buf := make([]byte, maxLength)
+	n, err := sc.Read(buf)
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	assert.Equal(t, []byte{CommandUDPForward, 0x00, 0x04, 1, 1, 1, 1, 0, 53}, buf[:9])
+	assert.Equal(t, payload, buf[9:n])
+
+	// the server accepts the session, then replies ip version(1) ip port(2) payload
+	go func() {
+		if _, err := sc.Write([]byte{CommandTunnel}); err != nil {
+			errCh <- err
+			return
+		}
+		_, err := sc.Write(append([]byte{0x04, 8, 8, 8, 8, 0, 53}, payload...))
+		errCh <- err
+	}()
+
+	n, from, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	assert.Equal(t, "8.8.8.8:53", from.String())
+	assert.Equal(t, payload, buf[:n])
+
+	_, err = pc.WriteTo(append(payload, 0), addr.UDPAddr())
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package sniffer
+
+import (
+	"bytes"
+	"net"
+	"strings"
+)
+
+var methods = []string{"GET", "POST", "HEAD", "PUT", "DELETE", "OPTIONS", "PATCH", "TRACE", "CONNECT"}
+
+// SniffHTTP returns the host of a HTTP/1.x request
+func SniffHTTP(b []byte) (string, error) {
+	if !hasMethod(b) {
+		return "", ErrNotMatched
+	}
+
+	headerEnd := bytes.Index(b, []byte("\r\n\r\n"))
+	lines := strings.Split(string(b), "\r\n")
+	if headerEnd != -1 {
+		lines = strings.Split(string(b[:headerEnd]), "\r\n")
+	} else {
+		// the last line may be truncated
+		lines = lines[:len(lines)-1]
+		if len(lines) == 0 {
+			return "", ErrNeedMore
+		}
+	}
+
+	for _, line := range lines[1:] {
+		idx := strings.IndexByte(line, ':')
+		if idx == -1 || !strings.EqualFold(strings.TrimSpace(line[:idx]), "host") {
+			continue
+		}
+
+		host := strings.TrimSpace(line[idx+1:])
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		return normalize(host)
+	}
+
+	if headerEnd != -1 {
+		return "", ErrNotMatched
+	}
+	return "", ErrNeedMore
+}
+
+// hasMethod reports whether b starts with a HTTP method, a prefix of
+// a method is treated as matched
+func hasMethod(b []byte) bool {
+	for _, method := range methods {
+		prefix := method + " "
+		n := len(prefix)
+		if len(b) < n {
+			n = len(b)
+		}
+		if n > 0 && string(b[:n]) == prefix[:n] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package sniffer
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"sort"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// quicVersion is the parameters of a QUIC version to protect Initial packets
+type quicVersion struct {
+	salt []byte
+	// initialType is the long header packet type of Initial
+	initialType                byte
+	keyLabel, ivLabel, hpLabel string
+}
+
+var quicVersions = map[uint32]quicVersion{
+	// RFC 9001
+	0x00000001: {
+		salt:     []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a},
+		keyLabel: "quic key", ivLabel: "quic iv", hpLabel: "quic hp",
+	},
+	// draft-29
+	0xff00001d: {
+		salt:     []byte{0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c, 0x9e, 0x97, 0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0, 0x43, 0x90, 0xa8, 0x99},
+		keyLabel: "quic key", ivLabel: "quic iv", hpLabel: "quic hp",
+	},
+	// RFC 9369
+	0x6b3343cf: {
+		salt:        []byte{0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93, 0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9},
+		initialType: 1,
+		keyLabel:    "quicv2 key", ivLabel: "quicv2 iv", hpLabel: "quicv2 hp",
+	},
+}
+
+// cryptoFragment is the data of a CRYPTO frame at offset
+type cryptoFragment struct {
+	offset int
+	data   []byte
+}
+
+// SniffQUIC returns the server name of the ClientHello in a QUIC Initial
+// packet, ErrNeedMore means the ClientHello continues in the next packets
+func SniffQUIC(b []byte) (string, error) {
+	return SniffQUICPackets([][]byte{b})
+}
+
+// SniffQUICPackets returns the server name of the ClientHello in the CRYPTO
+// frames of the Initial packets of a QUIC connection. The first packet must be
+// an Initial one, the others of another type or connection are skipped.
+// ErrNeedMore means the ClientHello continues in the next packets.
+func SniffQUICPackets(packets [][]byte) (string, error) {
+	var dcid []byte
+	fragments := []cryptoFragment{}
+	for i, b := range packets {
+		id, frames, err := quicInitialFrames(b)
+		if err == nil && dcid != nil && string(id) != string(dcid) {
+			err = ErrNotMatched
+		}
+		if err != nil {
+			if i == 0 {
+				return "", err
+			}
+			continue
+		}
+
+		dcid = id
+		fragments = append(fragments, frames...)
+	}
+
+	data := assembleCrypto(fragments)
+	if len(data) == 0 {
+		return "", ErrNotMatched
+	}
+	return sniffClientHello(data)
+}
+
+// quicInitialFrames returns the destination connection id and the CRYPTO
+// frames of a QUIC Initial packet
+func quicInitialFrames(b []byte) ([]byte, []cryptoFragment, error) {
+	r := &reader{b: b}
+	first := r.uint8()
+	version := r.bytes(4)
+	if r.needMore || first&0x80 == 0 {
+		return nil, nil, ErrNotMatched
+	}
+
+	v, ok := quicVersions[binary.BigEndian.Uint32(version)]
+	if !ok || (first>>4)&0x03 != int(v.initialType) {
+		return nil, nil, ErrNotMatched
+	}
+
+	dcid := r.bytes(r.uint8())
+	// source connection id
+	r.skip(r.uint8())
+	// token
+	r.skip(int(r.varint()))
+	length := int(r.varint())
+	pnOffset := r.offset
+	if r.needMore || length < 20 || pnOffset+length > len(b) {
+		return nil, nil, ErrNotMatched
+	}
+
+	key, iv, hp := quicInitialKeys(v, dcid)
+
+	// remove header protection
+	block, err := aes.NewCipher(hp)
+	if err != nil {
+		return nil, nil, err
+	}
+	mask := make([]byte, aes.BlockSize)
+	block.Encrypt(mask, b[pnOffset+4:pnOffset+4+aes.BlockSize])
+
+	header := make([]byte, pnOffset+4)
+	copy(header, b)
+	header[0] ^= mask[0] & 0x0f
+	pnLength := int(header[0]&0x03) + 1
+	header = header[:pnOffset+pnLength]
+	for i := 0; i < pnLength; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+	}
+
+	nonce := append([]byte{}, iv...)
+	for i := 0; i < pnLength; i++ {
+		nonce[len(nonce)-pnLength+i] ^= header[pnOffset+i]
+	}
+
+	block, err = aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err := aead.Open(nil, nonce, b[pnOffset+pnLength:pnOffset+length], header)
+	if err != nil {
+		return nil, nil, ErrNotMatched
+	}
+
+	return append([]byte{}, dcid...), quicCryptoFrames(payload), nil
+}
+
+func quicInitialKeys(v quicVersion, dcid []byte) (key, iv, hp []byte) {
+	initialSecret := hkdf.Extract(crypto.SHA256.New, dcid, v.salt)
+	clientSecret := hkdfExpandLabel(initialSecret, "client in", 32)
+	return hkdfExpandLabel(clientSecret, v.keyLabel, 16),
+		hkdfExpandLabel(clientSecret, v.ivLabel, 12),
+		hkdfExpandLabel(clientSecret, v.hpLabel, 16)
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label of TLS 1.3 with empty context
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := make([]byte, 0, 4+len(label))
+	info = append(info, byte(length>>8), byte(length), byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+
+	out := make([]byte, length)
+	hkdf.Expand(crypto.SHA256.New, secret, info).Read(out)
+	return out
+}
+
+// quicCryptoFrames returns the CRYPTO frames of the payload of a packet
+func quicCryptoFrames(payload []byte) []cryptoFragment {
+	fragments := []cryptoFragment{}
+	r := &reader{b: payload}
+loop:
+	for r.offset < len(payload) && !r.needMore {
+		switch tp := r.varint(); tp {
+		case 0x00, 0x01: // PADDING, PING
+		case 0x02, 0x03: // ACK
+			r.varint() // largest acknowledged
+			r.varint() // ack delay
+			count := r.varint()
+			r.varint() // first ack range
+			for i := uint64(0); i < count && !r.needMore; i++ {
+				r.varint() // gap
+				r.varint() // ack range length
+			}
+			if tp == 0x03 {
+				r.varint()
+				r.varint()
+				r.varint()
+			}
+		case 0x06: // CRYPTO
+			offset := int(r.varint())
+			data := r.bytes(int(r.varint()))
+			if r.needMore {
+				break loop
+			}
+			fragments = append(fragments, cryptoFragment{offset: offset, data: data})
+		default:
+			break loop
+		}
+	}
+	return fragments
+}
+
+// assembleCrypto returns the contiguous data of CRYPTO frames from offset zero
+func assembleCrypto(fragments []cryptoFragment) []byte {
+	sort.Slice(fragments, func(i, j int) bool { return fragments[i].offset < fragments[j].offset })
+	data := []byte{}
+	for _, f := range fragments {
+		if f.offset > len(data) {
+			break
+		}
+		if end := f.offset + len(f.data); end > len(data) {
+			data = append(data, f.data[len(data)-f.offset:]...)
+		}
+	}
+
+	return data
+}
+
+// varint reads a variable-length integer of QUIC
+func (r *reader) varint() uint64 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+
+	length := 1 << (b[0] >> 6)
+	value := uint64(b[0] & 0x3f)
+	rest := r.bytes(length - 1)
+	for _, c := range rest {
+		value = value<<8 | uint64(c)
+	}
+	return value
+}
@@ -0,0 +1,188 @@
+// Package sniffer finds the domain of a connection from its first bytes,
+// e.g. the server name of TLS ClientHello and the host of HTTP request.
+package sniffer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	N "github.com/Dreamacro/clash/common/net"
+	"github.com/Dreamacro/clash/component/trie"
+)
+
+const (
+	sniffTimeout = 300 * time.Millisecond
+	maxSniffSize = 4096
+)
+
+var (
+	// ErrNotMatched means the data isn't of the protocol
+	ErrNotMatched = errors.New("protocol not matched")
+	// ErrNeedMore means the data is incomplete
+	ErrNeedMore = errors.New("need more data")
+)
+
+// sniffers is the supported protocols of TCP
+var sniffers = map[string]func([]byte) (string, error){
+	"tls":  SniffTLS,
+	"http": SniffHTTP,
+}
+
+// packetSniffers is the supported protocols of UDP, they sniff the first
+// packets of a session
+var packetSniffers = map[string]func([][]byte) (string, error){
+	"quic": SniffQUICPackets,
+}
+
+type portRange struct {
+	min uint16
+	max uint16
+}
+
+// protocolSniffer is the sniff function of a protocol
+type protocolSniffer struct {
+	protocol string
+	sniff    func([]byte) (string, error)
+}
+
+// packetSniffer is the sniff function of a protocol of UDP
+type packetSniffer struct {
+	protocol string
+	sniff    func([][]byte) (string, error)
+}
+
+// Sniffer sniffs the domain of connections to the specified ports
+type Sniffer struct {
+	sniffers       []protocolSniffer
+	packetSniffers []packetSniffer
+	ports          []portRange
+	// Override means the sniffed domain replaces the destination, otherwise
+	// the domain is only used to match rules
+	Override bool
+	// BlockQUIC is the domains whose QUIC packets are dropped, so that
+	// clients fall back to TCP
+	BlockQUIC *trie.DomainTrie
+}
+
+// New returns a Sniffer of protocols, ports are port numbers or ranges like `8000-9000`
+func New(protocols []string, ports []string, override bool) (*Sniffer, error) {
+	s := &Sniffer{Override: override}
+	for _, protocol := range protocols {
+		protocol = strings.ToLower(protocol)
+		if sniff, ok := sniffers[protocol]; ok {
+			s.sniffers = append(s.sniffers, protocolSniffer{protocol, sniff})
+		} else if sniff, ok := packetSniffers[protocol]; ok {
+			s.packetSniffers = append(s.packetSniffers, packetSniffer{protocol, sniff})
+		} else {
+			return nil, fmt.Errorf("unsupported sniff protocol: %s", protocol)
+		}
+	}
+
+	for _, port := range ports {
+		r, err := parsePortRange(port)
+		if err != nil {
+			return nil, err
+		}
+		s.ports = append(s.ports, r)
+	}
+
+	return s, nil
+}
+
+func parsePortRange(s string) (portRange, error) {
+	minStr, maxStr := s, s
+	if idx := strings.IndexByte(s, '-'); idx != -1 {
+		minStr, maxStr = s[:idx], s[idx+1:]
+	}
+
+	min, err := strconv.ParseUint(strings.TrimSpace(minStr), 10, 16)
+	if err != nil {
+		return portRange{}, fmt.Errorf("invalid sniff port: %s", s)
+	}
+	max, err := strconv.ParseUint(strings.TrimSpace(maxStr), 10, 16)
+	if err != nil || max < min {
+		return portRange{}, fmt.Errorf("invalid sniff port: %s", s)
+	}
+
+	return portRange{min: uint16(min), max: uint16(max)}, nil
+}
+
+// ShouldSniff reports whether connections to port should be sniffed
+func (s *Sniffer) ShouldSniff(port string) bool {
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return false
+	}
+
+	for _, r := range s.ports {
+		if uint16(p) >= r.min && uint16(p) <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// Sniff peeks the first bytes of conn and returns the domain and the protocol,
+// the bytes are kept in conn. It waits sniffTimeout at most for the client to
+// send.
+func (s *Sniffer) Sniff(conn *N.BufferedConn) (host string, protocol string) {
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	size := 1
+	for {
+		if _, err := conn.Peek(size); err != nil {
+			return "", ""
+		}
+		buf, _ := conn.Peek(conn.Buffered())
+
+		needMore := false
+		for _, sniffer := range s.sniffers {
+			host, err := sniffer.sniff(buf)
+			if err == nil {
+				return host, sniffer.protocol
+			}
+			if err == ErrNeedMore {
+				needMore = true
+			}
+		}
+
+		if !needMore || len(buf) >= maxSniffSize || len(buf) >= conn.Reader().Size() {
+			return "", ""
+		}
+		size = len(buf) + 1
+	}
+}
+
+// SniffPackets returns the domain and the protocol of the first packets of a
+// UDP session, needMore means the domain may be in the next packets
+func (s *Sniffer) SniffPackets(packets [][]byte) (host string, protocol string, needMore bool) {
+	for _, sniffer := range s.packetSniffers {
+		host, err := sniffer.sniff(packets)
+		if err == nil {
+			return host, sniffer.protocol, false
+		}
+		if err == ErrNeedMore {
+			needMore = true
+		}
+	}
+	return "", "", needMore
+}
+
+// ShouldBlockQUIC reports whether the QUIC packets to host should be dropped
+func (s *Sniffer) ShouldBlockQUIC(host string) bool {
+	return s.BlockQUIC != nil && s.BlockQUIC.Search(host) != nil
+}
+
+// normalize returns the lower case domain, IP address isn't a domain
+func normalize(host string) (string, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || net.ParseIP(host) != nil {
+		return "", ErrNotMatched
+	}
+	return host, nil
+}
@@ -0,0 +1,194 @@
+package sniffer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+
+	N "github.com/Dreamacro/clash/common/net"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func clientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		tls.Client(client, &tls.Config{ServerName: serverName}).Handshake()
+		client.Close()
+	}()
+
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	assert.Nil(t, err)
+	return buf[:n]
+}
+
+func TestSniffTLS(t *testing.T) {
+	hello := clientHello(t, "Example.com")
+
+	host, err := SniffTLS(hello)
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", host)
+
+	_, err = SniffTLS(hello[:40])
+	assert.Equal(t, ErrNeedMore, err)
+
+	_, err = SniffTLS([]byte("GET / HTTP/1.1\r\n"))
+	assert.Equal(t, ErrNotMatched, err)
+}
+
+func TestSniffHTTP(t *testing.T) {
+	host, err := SniffHTTP([]byte("GET / HTTP/1.1\r\nUser-Agent: curl\r\nhost: Example.com:8080\r\n\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", host)
+
+	_, err = SniffHTTP([]byte("GET / HTTP/1.1\r\nUser-Agent: cu"))
+	assert.Equal(t, ErrNeedMore, err)
+
+	_, err = SniffHTTP([]byte("GET / HTTP/1.1\r\nHost: 1.1.1.1\r\n\r\n"))
+	assert.Equal(t, ErrNotMatched, err)
+
+	_, err = SniffHTTP([]byte("SSH-2.0-OpenSSH\r\n"))
+	assert.Equal(t, ErrNotMatched, err)
+}
+
+func TestSniffer_ShouldSniff(t *testing.T) {
+	s, err := New([]string{"tls", "quic"}, []string{"443", "8000-9000"}, false)
+	assert.Nil(t, err)
+	assert.True(t, s.ShouldSniff("443"))
+	assert.True(t, s.ShouldSniff("8080"))
+	assert.False(t, s.ShouldSniff("80"))
+
+	_, err = New([]string{"ftp"}, nil, false)
+	assert.NotNil(t, err)
+	_, err = New([]string{"tls"}, []string{"9000-8000"}, false)
+	assert.NotNil(t, err)
+}
+
+func TestSniffer_Sniff(t *testing.T) {
+	hello := clientHello(t, "example.com")
+	s, _ := New([]string{"http", "tls"}, []string{"443"}, false)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		// split the ClientHello to test incomplete data
+		client.Write(hello[:10])
+		client.Write(hello[10:])
+	}()
+
+	conn := N.NewBufferedConn(server)
+	host, protocol := s.Sniff(conn)
+	assert.Equal(t, "example.com", host)
+	assert.Equal(t, "tls", protocol)
+
+	buf := make([]byte, len(hello))
+	_, err := io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, hello, buf)
+}
+
+// quicInitial protects the CRYPTO frames of data as a QUIC v1 Initial packet,
+// the frames are in the reverse order
+func quicInitial(t *testing.T, data []byte) []byte {
+	return quicInitialAt(t, 0, data)
+}
+
+// quicInitialAt is quicInitial of the data at offset of the CRYPTO stream
+func quicInitialAt(t *testing.T, offset int, data []byte) []byte {
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	key, iv, hp := quicInitialKeys(quicVersions[1], dcid)
+
+	half := len(data) / 2
+	payload := []byte{0x06}
+	payload = appendVarint(payload, uint64(offset+half))
+	payload = appendVarint(payload, uint64(len(data)-half))
+	payload = append(payload, data[half:]...)
+	payload = append(payload, 0x06)
+	payload = appendVarint(payload, uint64(offset))
+	payload = appendVarint(payload, uint64(half))
+	payload = append(payload, data[:half]...)
+	if len(payload) < 1162 {
+		payload = append(payload, make([]byte, 1162-len(payload))...)
+	}
+
+	pn := []byte{0x00, 0x02}
+	header := []byte{0xc1, 0x00, 0x00, 0x00, 0x01, byte(len(dcid))}
+	header = append(header, dcid...)
+	header = append(header, 0x00, 0x00) // scid, token
+	header = appendVarint(header, uint64(len(pn)+len(payload)+16))
+	pnOffset := len(header)
+	header = append(header, pn...)
+
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	nonce := append([]byte{}, iv...)
+	nonce[len(nonce)-2] ^= pn[0]
+	nonce[len(nonce)-1] ^= pn[1]
+	packet := aead.Seal(append([]byte{}, header...), nonce, payload, header)
+
+	block, _ = aes.NewCipher(hp)
+	mask := make([]byte, aes.BlockSize)
+	block.Encrypt(mask, packet[pnOffset+4:pnOffset+4+aes.BlockSize])
+	packet[0] ^= mask[0] & 0x0f
+	packet[pnOffset] ^= mask[1]
+	packet[pnOffset+1] ^= mask[2]
+	return packet
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	if v < 1<<6 {
+		return append(b, byte(v))
+	}
+	return append(b, byte(v>>8)|0x40, byte(v))
+}
+
+func TestSniffQUIC(t *testing.T) {
+	// ClientHello without the record header
+	hello := clientHello(t, "example.com")[5:]
+
+	host, err := SniffQUIC(quicInitial(t, hello))
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", host)
+
+	// only the first half of ClientHello
+	_, err = SniffQUIC(quicInitial(t, hello[:40]))
+	assert.Equal(t, ErrNeedMore, err)
+
+	_, err = SniffQUIC([]byte("GET / HTTP/1.1\r\n"))
+	assert.Equal(t, ErrNotMatched, err)
+}
+
+func TestSniffQUICPackets(t *testing.T) {
+	hello := clientHello(t, "example.com")[5:]
+	first := quicInitialAt(t, 0, hello[:40])
+	second := quicInitialAt(t, 40, hello[40:])
+
+	// the packets may be received in any order
+	for _, packets := range [][][]byte{
+		{first, second},
+		{first, []byte("not quic"), second},
+		{second, first},
+	} {
+		host, err := SniffQUICPackets(packets)
+		assert.Nil(t, err)
+		assert.Equal(t, "example.com", host)
+	}
+
+	_, err := SniffQUICPackets([][]byte{[]byte("not quic"), first, second})
+	assert.Equal(t, ErrNotMatched, err)
+
+	s, err := New([]string{"quic"}, []string{"443"}, false)
+	assert.Nil(t, err)
+	_, _, needMore := s.SniffPackets([][]byte{first})
+	assert.True(t, needMore)
+	host, protocol, _ := s.SniffPackets([][]byte{first, second})
+	assert.Equal(t, "example.com", host)
+	assert.Equal(t, "quic", protocol)
+}
@@ -0,0 +1,122 @@
+package sniffer
+
+import (
+	"encoding/binary"
+)
+
+const (
+	recordTypeHandshake      = 0x16
+	handshakeTypeClientHello = 0x01
+	extensionServerName      = 0x00
+)
+
+// SniffTLS returns the server name of a TLS ClientHello
+func SniffTLS(b []byte) (string, error) {
+	// record header: type(1) version(2) length(2)
+	if len(b) < 5 {
+		if len(b) > 0 && b[0] != recordTypeHandshake {
+			return "", ErrNotMatched
+		}
+		return "", ErrNeedMore
+	}
+	if b[0] != recordTypeHandshake || b[1] != 3 {
+		return "", ErrNotMatched
+	}
+
+	return sniffClientHello(b[5:])
+}
+
+// sniffClientHello returns the server name of a ClientHello handshake message
+func sniffClientHello(b []byte) (string, error) {
+	// handshake header: type(1) length(3)
+	if len(b) < 4 {
+		return "", ErrNeedMore
+	}
+	if b[0] != handshakeTypeClientHello {
+		return "", ErrNotMatched
+	}
+	b = b[4:]
+
+	r := &reader{b: b}
+	// version(2) random(32)
+	r.skip(34)
+	// session id
+	r.skip(r.uint8())
+	// cipher suites
+	r.skip(r.uint16())
+	// compression methods
+	r.skip(r.uint8())
+
+	extensionsLength := r.uint16()
+	if r.needMore {
+		return "", ErrNeedMore
+	}
+
+	end := r.offset + extensionsLength
+	for r.offset+4 <= end {
+		tp, length := r.uint16(), r.uint16()
+		if r.needMore {
+			return "", ErrNeedMore
+		}
+		if tp != extensionServerName {
+			r.skip(length)
+			continue
+		}
+
+		// server name list: length(2) { type(1) length(2) name }
+		r.skip(2)
+		for r.offset < end && !r.needMore {
+			nameType, nameLength := r.uint8(), r.uint16()
+			name := r.bytes(nameLength)
+			if r.needMore {
+				break
+			}
+			if nameType == 0 {
+				return normalize(string(name))
+			}
+		}
+		break
+	}
+
+	if r.needMore {
+		return "", ErrNeedMore
+	}
+	return "", ErrNotMatched
+}
+
+// reader reads a truncated message, needMore is set if it reads out of range
+type reader struct {
+	b        []byte
+	offset   int
+	needMore bool
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.needMore || n < 0 || n > len(r.b)-r.offset {
+		r.needMore = true
+		return nil
+	}
+	b := r.b[r.offset : r.offset+n]
+	r.offset += n
+	return b
+}
+
+func (r *reader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *reader) uint8() int {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])
+}
+
+func (r *reader) uint16() int {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
@@ -0,0 +1,112 @@
+package socks4
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/Dreamacro/clash/component/auth"
+	"github.com/Dreamacro/clash/component/socks5"
+)
+
+const Version = 4
+
+// Command is request commands as defined in SOCKS4 protocol.
+type Command = uint8
+
+// SOCKS4 request commands
+const (
+	CmdConnect Command = 1
+	CmdBind    Command = 2
+)
+
+// SOCKS4 reply codes
+const (
+	RequestGranted  = 0x5a
+	RequestRejected = 0x5b
+)
+
+// maxFieldLen limits the length of USERID and the hostname of SOCKS4a
+const maxFieldLen = 255
+
+var (
+	ErrVersion            = errors.New("version error")
+	ErrCommandNotSupport  = errors.New("command not supported")
+	ErrFieldTooLong       = errors.New("field too long")
+	ErrAuthNotSupport     = errors.New("authentication is not supported by SOCKS4")
+	errHostnameNotPresent = errors.New("hostname not present")
+)
+
+// ServerHandshake reads the CONNECT request of SOCKS4 and SOCKS4a, userID is
+// only for identification. SOCKS4 can't authenticate, so the request is
+// rejected if authenticator isn't nil.
+func ServerHandshake(rw io.ReadWriter, authenticator auth.Authenticator) (addr socks5.Addr, command Command, userID string, err error) {
+	// read VN CD DSTPORT DSTIP
+	header := make([]byte, 8)
+	if _, err = io.ReadFull(rw, header); err != nil {
+		return
+	}
+	if header[0] != Version {
+		err = ErrVersion
+		return
+	}
+	command = header[1]
+	port, ip := header[2:4], header[4:8]
+
+	if userID, err = readField(rw); err != nil {
+		return
+	}
+
+	// SOCKS4a uses 0.0.0.x as DSTIP and the hostname follows USERID
+	if ip[0] == 0 && ip[1] == 0 && ip[2] == 0 && ip[3] != 0 {
+		var host string
+		if host, err = readField(rw); err != nil {
+			return
+		}
+		if host == "" {
+			err = errHostnameNotPresent
+			return
+		}
+		addr = bytes.Join([][]byte{{socks5.AtypDomainName, byte(len(host))}, []byte(host), port}, []byte{})
+	} else {
+		addr = bytes.Join([][]byte{{socks5.AtypIPv4}, ip, port}, []byte{})
+	}
+
+	if command != CmdConnect {
+		err = ErrCommandNotSupport
+	} else if authenticator != nil {
+		err = ErrAuthNotSupport
+	}
+
+	code := byte(RequestGranted)
+	if err != nil {
+		code = RequestRejected
+	}
+
+	// write VN CD DSTPORT DSTIP
+	reply := make([]byte, 8)
+	reply[1] = code
+	if _, werr := rw.Write(reply); werr != nil && err == nil {
+		err = werr
+	}
+	return
+}
+
+// readField reads a null-terminated string byte by byte, so that the data
+// after the request is left in r
+func readField(r io.Reader) (string, error) {
+	buf := make([]byte, 0, 16)
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		if b[0] == 0 {
+			return string(buf), nil
+		}
+		if len(buf) >= maxFieldLen {
+			return "", ErrFieldTooLong
+		}
+		buf = append(buf, b[0])
+	}
+}
@@ -104,8 +104,9 @@ type User struct {
 	Password string
 }
 
-// ServerHandshake fast-tracks SOCKS initialization to get target address to connect on server side.
-func ServerHandshake(rw net.Conn, authenticator auth.Authenticator) (addr Addr, command Command, err error) {
+// ServerHandshake fast-tracks SOCKS initialization to get target address to connect on server side,
+// user is the authenticated username if authenticator isn't nil.
+func ServerHandshake(rw net.Conn, authenticator auth.Authenticator) (addr Addr, command Command, user string, err error) {
 	// Read RFC 1928 for request and reply structure and sizes.
 	buf := make([]byte, MaxAddrLen)
 	// read VER, NMETHODS, METHODS
@@ -140,7 +141,7 @@ func ServerHandshake(rw net.Conn, authenticator auth.Authenticator) (addr Addr,
 		if _, err = io.ReadFull(rw, authBuf[:userLen]); err != nil {
 			return
 		}
-		user := string(authBuf[:userLen])
+		username := string(authBuf[:userLen])
 
 		// Get password
 		if _, err = rw.Read(header[:1]); err != nil {
@@ -158,11 +159,12 @@ func ServerHandshake(rw net.Conn, authenticator auth.Authenticator) (addr Addr,
 		pass := string(authBuf[:passLen])
 
 		// Verify
-		if ok := authenticator.Verify(string(user), string(pass)); !ok {
+		if ok := authenticator.Verify(username, pass); !ok {
 			rw.Write([]byte{1, 1})
 			err = ErrAuth
 			return
 		}
+		user = username
 
 		// Response auth state
 		if _, err = rw.Write([]byte{1, 0}); err != nil {
@@ -0,0 +1,176 @@
+package tls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// Fingerprint is a browser ClientHello mimicked by uTLS
+type Fingerprint struct {
+	id utls.ClientHelloID
+}
+
+// fingerprints are the names of client-fingerprint
+var fingerprints = map[string]utls.ClientHelloID{
+	"chrome":  utls.HelloChrome_Auto,
+	"firefox": utls.HelloFirefox_Auto,
+	"safari":  utls.HelloSafari_Auto,
+	"ios":     utls.HelloIOS_Auto,
+}
+
+// randomFingerprints are chosen by the random fingerprint, the randomized
+// ClientHello of uTLS is rejected by some servers
+var randomFingerprints = []utls.ClientHelloID{utls.HelloChrome_Auto, utls.HelloFirefox_Auto, utls.HelloSafari_Auto}
+
+// sessionCache is shared by the fingerprinted connections, the session
+// cache of crypto/tls can't be used by uTLS
+var sessionCache = utls.NewLRUClientSessionCache(128)
+
+// ParseFingerprint returns the Fingerprint of client-fingerprint, it returns
+// nil for an empty name. random chooses a browser once, so the connections of
+// a proxy share the fingerprint.
+func ParseFingerprint(name string) (*Fingerprint, error) {
+	switch name = strings.ToLower(name); name {
+	case "":
+		return nil, nil
+	case "random":
+		return &Fingerprint{id: randomFingerprints[rand.Intn(len(randomFingerprints))]}, nil
+	}
+
+	id, ok := fingerprints[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported client-fingerprint: %s", name)
+	}
+	return &Fingerprint{id: id}, nil
+}
+
+// ParseVersion returns the version of tls-min-version, e.g. `1.2`, it returns 0 for an empty version
+func ParseVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(version), "tls") {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported tls-min-version: %s", version)
+	}
+}
+
+// StreamConn does the TLS handshake on conn with config, the ClientHello
+// mimics fingerprint if it isn't nil. The ALPN of the fingerprint is replaced
+// by config.NextProtos, and config.MinVersion is checked after the handshake
+// since the fingerprint decides the offered versions.
+func StreamConn(conn net.Conn, config *tls.Config, fingerprint *Fingerprint) (net.Conn, error) {
+	if fingerprint == nil {
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+
+	uConn, err := uClient(conn, config, fingerprint.id, sessionCache)
+	if err != nil {
+		return nil, err
+	}
+	return handshake(uConn, config.MinVersion)
+}
+
+// StreamConnWithSessionID is StreamConn mimicking fingerprint, or Chrome if
+// it's nil, whose session ID is filled by generate. generate is given the
+// ClientHello with a zero session ID. There is no session cache, the session
+// ID of a resumption can't be replaced.
+func StreamConnWithSessionID(conn net.Conn, config *tls.Config, fingerprint *Fingerprint, generate func(hello, sessionID []byte) error) (net.Conn, error) {
+	id := utls.HelloChrome_Auto
+	if fingerprint != nil {
+		id = fingerprint.id
+	}
+
+	uConn, err := uClient(conn, config, id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	hello := uConn.HandshakeState.Hello
+	hello.SessionId = make([]byte, 32)
+	if err := uConn.MarshalClientHello(); err != nil {
+		return nil, err
+	}
+	sessionID := make([]byte, 32)
+	if err := generate(hello.Raw, sessionID); err != nil {
+		return nil, err
+	}
+	hello.SessionId = sessionID
+	if err := uConn.MarshalClientHello(); err != nil {
+		return nil, err
+	}
+
+	return handshake(uConn, config.MinVersion)
+}
+
+// uClient returns the UConn of id whose handshake state is built from config
+func uClient(conn net.Conn, config *tls.Config, id utls.ClientHelloID, cache utls.ClientSessionCache) (*utls.UConn, error) {
+	uConn := utls.UClient(conn, &utls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		RootCAs:            config.RootCAs,
+		NextProtos:         config.NextProtos,
+		ClientSessionCache: cache,
+	}, id)
+
+	// an empty SNI extension is malformed, there is no SNI for the IP addresses
+	if config.ServerName == "" || net.ParseIP(config.ServerName) != nil {
+		uConn.RemoveSNIExtension()
+	}
+
+	if err := uConn.BuildHandshakeState(); err != nil {
+		return nil, err
+	}
+	setALPN(uConn, config.NextProtos)
+	if err := uConn.BuildHandshakeState(); err != nil {
+		return nil, err
+	}
+	return uConn, nil
+}
+
+func handshake(uConn *utls.UConn, minVersion uint16) (net.Conn, error) {
+	if err := uConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	if version := uConn.ConnectionState().Version; version < minVersion {
+		uConn.Close()
+		return nil, fmt.Errorf("tls version 0x%x is lower than the min version 0x%x", version, minVersion)
+	}
+	return uConn, nil
+}
+
+// setALPN replaces the protocols of the ALPN extension, the extension is
+// removed if protocols is empty
+func setALPN(uConn *utls.UConn, protocols []string) {
+	for i, ext := range uConn.Extensions {
+		alpn, ok := ext.(*utls.ALPNExtension)
+		if !ok {
+			continue
+		}
+
+		if len(protocols) == 0 {
+			uConn.Extensions = append(uConn.Extensions[:i], uConn.Extensions[i+1:]...)
+			uConn.HandshakeState.Hello.AlpnProtocols = nil
+		} else {
+			alpn.AlpnProtocols = protocols
+		}
+		return
+	}
+}
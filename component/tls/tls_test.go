@@ -0,0 +1,66 @@
+package tls
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(maxVersion uint16) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{MaxVersion: maxVersion}
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	return server
+}
+
+func TestStreamConn_Fingerprint(t *testing.T) {
+	server := newTestServer(tls.VersionTLS13)
+	defer server.Close()
+
+	for _, name := range []string{"", "chrome", "firefox", "safari", "random"} {
+		fingerprint, err := ParseFingerprint(name)
+		assert.Nil(t, err)
+
+		c, err := net.Dial("tcp", server.Listener.Addr().String())
+		assert.Nil(t, err)
+
+		tc, err := StreamConn(c, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}}, fingerprint)
+		assert.Nil(t, err, name)
+		if tc != nil {
+			tc.Close()
+		}
+	}
+}
+
+func TestStreamConn_MinVersion(t *testing.T) {
+	server := newTestServer(tls.VersionTLS12)
+	defer server.Close()
+
+	fingerprint, _ := ParseFingerprint("chrome")
+	for _, fp := range []*Fingerprint{nil, fingerprint} {
+		c, err := net.Dial("tcp", server.Listener.Addr().String())
+		assert.Nil(t, err)
+
+		_, err = StreamConn(c, &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS13}, fp)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	_, err := ParseFingerprint("edge")
+	assert.NotNil(t, err)
+
+	version, err := ParseVersion("1.3")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = ParseVersion("1.4")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,49 @@
+package trojan
+
+import (
+	"bytes"
+	"net"
+	"time"
+)
+
+// fragmentConn splits the first write, which is the TLS ClientHello,
+// into two TCP segments so that keyword based DPI can't match the SNI.
+type fragmentConn struct {
+	net.Conn
+	serverName string
+	position   int
+	delay      time.Duration
+	done       bool
+}
+
+func (fc *fragmentConn) Write(b []byte) (int, error) {
+	if fc.done {
+		return fc.Conn.Write(b)
+	}
+	fc.done = true
+
+	pos := fc.position
+	if pos == 0 {
+		// split in the middle of the server name by default
+		pos = 1
+		if idx := bytes.Index(b, []byte(fc.serverName)); idx != -1 && fc.serverName != "" {
+			pos = idx + len(fc.serverName)/2
+		}
+	}
+
+	if pos <= 0 || pos >= len(b) {
+		return fc.Conn.Write(b)
+	}
+
+	n, err := fc.Conn.Write(b[:pos])
+	if err != nil {
+		return n, err
+	}
+
+	if fc.delay != 0 {
+		time.Sleep(fc.delay)
+	}
+
+	m, err := fc.Conn.Write(b[pos:])
+	return n + m, err
+}
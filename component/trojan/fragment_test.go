@@ -0,0 +1,60 @@
+package trojan
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// segmentConn records every write as a segment
+type segmentConn struct {
+	net.Conn
+	segments [][]byte
+}
+
+func (sc *segmentConn) Write(b []byte) (int, error) {
+	sc.segments = append(sc.segments, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestFragmentConn_Write(t *testing.T) {
+	hello := []byte("\x16\x03\x01client hello example.com extensions")
+	idx := bytes.Index(hello, []byte("example.com"))
+
+	cases := []struct {
+		name     string
+		position int
+		want     []int
+	}{
+		{"server name", 0, []int{idx + len("example.com")/2}},
+		{"position", 3, []int{3}},
+		{"out of range", len(hello), nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sc := &segmentConn{}
+			fc := &fragmentConn{Conn: sc, serverName: "example.com", position: c.position}
+
+			n, err := fc.Write(hello)
+			assert.Nil(t, err)
+			assert.Equal(t, len(hello), n)
+
+			// the later writes are not split
+			n, err = fc.Write(hello)
+			assert.Nil(t, err)
+			assert.Equal(t, len(hello), n)
+
+			var expected [][]byte
+			prev := 0
+			for _, pos := range c.want {
+				expected = append(expected, hello[prev:pos])
+				prev = pos
+			}
+			expected = append(expected, hello[prev:], hello)
+			assert.Equal(t, expected, sc.segments)
+		})
+	}
+}
@@ -7,16 +7,20 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/Dreamacro/clash/component/socks5"
+	tlsC "github.com/Dreamacro/clash/component/tls"
 )
 
 const (
-	// max packet length
-	maxLength = 8192
+	// maxLength is the max payload of a packet frame, which has a 16 bits length
+	maxLength = 0xffff
 )
 
 var (
@@ -39,6 +43,16 @@ type Option struct {
 	ServerName         string
 	SkipCertVerify     bool
 	ClientSessionCache tls.ClientSessionCache
+	Fragment           *FragmentOption
+	Fingerprint        *tlsC.Fingerprint
+	// MinVersion is TLS 1.2 if it's zero
+	MinVersion uint16
+}
+
+// FragmentOption splits the ClientHello at Position, zero means inside the server name
+type FragmentOption struct {
+	Position int
+	Delay    time.Duration
 }
 
 type Trojan struct {
@@ -52,20 +66,29 @@ func (t *Trojan) StreamConn(conn net.Conn) (net.Conn, error) {
 		alpn = t.option.ALPN
 	}
 
+	minVersion := uint16(tls.VersionTLS12)
+	if t.option.MinVersion != 0 {
+		minVersion = t.option.MinVersion
+	}
+
 	tlsConfig := &tls.Config{
 		NextProtos:         alpn,
-		MinVersion:         tls.VersionTLS12,
+		MinVersion:         minVersion,
 		InsecureSkipVerify: t.option.SkipCertVerify,
 		ServerName:         t.option.ServerName,
 		ClientSessionCache: t.option.ClientSessionCache,
 	}
 
-	tlsConn := tls.Client(conn, tlsConfig)
-	if err := tlsConn.Handshake(); err != nil {
-		return nil, err
+	if t.option.Fragment != nil {
+		conn = &fragmentConn{
+			Conn:       conn,
+			serverName: t.option.ServerName,
+			position:   t.option.Fragment.Position,
+			delay:      t.option.Fragment.Delay,
+		}
 	}
 
-	return tlsConn, nil
+	return tlsC.StreamConn(conn, tlsConfig, t.option.Fingerprint)
 }
 
 func (t *Trojan) WriteHeader(w io.Writer, command Command, socks5Addr []byte) error {
@@ -84,6 +107,7 @@ func (t *Trojan) WriteHeader(w io.Writer, command Command, socks5Addr []byte) er
 	return err
 }
 
+// PacketConn sends the packets over conn, a packet is sent in one frame
 func (t *Trojan) PacketConn(conn net.Conn) net.PacketConn {
 	return &PacketConn{
 		Conn: conn,
@@ -103,31 +127,16 @@ func writePacket(w io.Writer, socks5Addr, payload []byte) (int, error) {
 	return w.Write(buf.Bytes())
 }
 
+// WritePacket writes payload in one frame, the server sends each frame as a
+// datagram, so a payload longer than a frame is rejected instead of being split
 func WritePacket(w io.Writer, socks5Addr, payload []byte) (int, error) {
-	if len(payload) <= maxLength {
-		return writePacket(w, socks5Addr, payload)
+	if len(payload) > maxLength {
+		return 0, fmt.Errorf("packet of %d bytes exceeds the frame size %d", len(payload), maxLength)
 	}
-
-	offset := 0
-	total := len(payload)
-	for {
-		cursor := offset + maxLength
-		if cursor > total {
-			cursor = total
-		}
-
-		n, err := writePacket(w, socks5Addr, payload[offset:cursor])
-		if err != nil {
-			return offset + n, err
-		}
-
-		offset = cursor
-		if offset == total {
-			break
-		}
+	if _, err := writePacket(w, socks5Addr, payload); err != nil {
+		return 0, err
 	}
-
-	return total, nil
+	return len(payload), nil
 }
 
 func ReadPacket(r io.Reader, payload []byte) (net.Addr, int, int, error) {
@@ -142,9 +151,6 @@ func ReadPacket(r io.Reader, payload []byte) (net.Addr, int, int, error) {
 	}
 
 	total := int(binary.BigEndian.Uint16(payload[:2]))
-	if total > maxLength {
-		return nil, 0, 0, errors.New("packet invalid")
-	}
 
 	// read crlf
 	if _, err = io.ReadFull(r, payload[:2]); err != nil {
@@ -169,37 +175,18 @@ func New(option *Option) *Trojan {
 
 type PacketConn struct {
 	net.Conn
-	remain int
-	rAddr  net.Addr
-	mux    sync.Mutex
+	mux sync.Mutex
 }
 
 func (pc *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
 	return WritePacket(pc, socks5.ParseAddr(addr.String()), b)
 }
 
+// ReadFrom reads a frame as a packet, the frame larger than b is truncated
+// like a UDP socket does instead of being returned as several packets
 func (pc *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
 	pc.mux.Lock()
 	defer pc.mux.Unlock()
-	if pc.remain != 0 {
-		length := len(b)
-		if pc.remain < length {
-			length = pc.remain
-		}
-
-		n, err := pc.Conn.Read(b[:length])
-		if err != nil {
-			return 0, nil, err
-		}
-
-		pc.remain -= n
-		addr := pc.rAddr
-		if pc.remain == 0 {
-			pc.rAddr = nil
-		}
-
-		return n, addr, nil
-	}
 
 	addr, n, remain, err := ReadPacket(pc.Conn, b)
 	if err != nil {
@@ -207,8 +194,9 @@ func (pc *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
 	}
 
 	if remain != 0 {
-		pc.remain = remain
-		pc.rAddr = addr
+		if _, err := io.CopyN(ioutil.Discard, pc.Conn, int64(remain)); err != nil {
+			return 0, nil, err
+		}
 	}
 
 	return n, addr, nil
@@ -0,0 +1,35 @@
+package trojan
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Dreamacro/clash/component/socks5"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePacket(t *testing.T) {
+	addr := socks5.ParseAddr("1.1.1.1:53")
+	payload := bytes.Repeat([]byte{1}, 20000)
+
+	buf := &bytes.Buffer{}
+	n, err := WritePacket(buf, addr, payload)
+	assert.Nil(t, err)
+	assert.Equal(t, len(payload), n)
+
+	b := make([]byte, 65535)
+	from, n, remain, err := ReadPacket(buf, b)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.1.1:53", from.String())
+	assert.Equal(t, payload, b[:n])
+	assert.Equal(t, 0, remain)
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestWritePacket_Oversize(t *testing.T) {
+	buf := &bytes.Buffer{}
+	_, err := WritePacket(buf, socks5.ParseAddr("1.1.1.1:53"), make([]byte, maxLength+1))
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, buf.Len())
+}
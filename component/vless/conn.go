@@ -0,0 +1,85 @@
+package vless
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+)
+
+// Conn wrapper a net.Conn with vless protocol
+type Conn struct {
+	net.Conn
+	dst *DstAddr
+
+	received bool
+}
+
+func (vc *Conn) Read(b []byte) (int, error) {
+	if vc.received {
+		return vc.Conn.Read(b)
+	}
+
+	if err := vc.recvResponse(); err != nil {
+		return 0, err
+	}
+	vc.received = true
+	return vc.Conn.Read(b)
+}
+
+func (vc *Conn) sendRequest(c *Client) error {
+	buf := &bytes.Buffer{}
+
+	// Ver UUID Addons(none)
+	buf.WriteByte(Version)
+	buf.Write(c.uuid.Bytes())
+	buf.WriteByte(0)
+
+	if vc.dst.UDP {
+		buf.WriteByte(CommandUDP)
+	} else {
+		buf.WriteByte(CommandTCP)
+	}
+
+	// Port AddrType Addr
+	binary.Write(buf, binary.BigEndian, uint16(vc.dst.Port))
+	buf.WriteByte(vc.dst.AddrType)
+	buf.Write(vc.dst.Addr)
+
+	_, err := vc.Conn.Write(buf.Bytes())
+	return err
+}
+
+func (vc *Conn) recvResponse() error {
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(vc.Conn, buf); err != nil {
+		return err
+	}
+
+	if buf[0] != Version {
+		return errors.New("unexpected response version")
+	}
+
+	// addons
+	if length := int(buf[1]); length != 0 {
+		if _, err := io.CopyN(ioutil.Discard, vc.Conn, int64(length)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newConn return a Conn instance
+func newConn(conn net.Conn, client *Client, dst *DstAddr) (*Conn, error) {
+	c := &Conn{
+		Conn: conn,
+		dst:  dst,
+	}
+	if err := c.sendRequest(client); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
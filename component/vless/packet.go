@@ -0,0 +1,81 @@
+package vless
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"github.com/Dreamacro/clash/common/pool"
+)
+
+const maxPacketLength = 0xffff
+
+// PacketConn sends length prefixed udp packets over a vless Conn
+type PacketConn struct {
+	net.Conn
+	rAddr net.Addr
+
+	rMux sync.Mutex
+	wMux sync.Mutex
+}
+
+// NewPacketConn return a PacketConn, all packets are sent to the destination of conn
+func NewPacketConn(conn net.Conn, rAddr net.Addr) *PacketConn {
+	return &PacketConn{Conn: conn, rAddr: rAddr}
+}
+
+func (pc *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if len(b) > maxPacketLength {
+		return 0, errors.New("packet is too large")
+	}
+
+	// the pool holds buffers up to 64 KiB, which is short of a full packet
+	buf := pool.Get(2 + len(b))
+	if buf == nil {
+		buf = make([]byte, 2+len(b))
+	} else {
+		defer pool.Put(buf)
+	}
+
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+
+	pc.wMux.Lock()
+	defer pc.wMux.Unlock()
+	if _, err := pc.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (pc *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	pc.rMux.Lock()
+	defer pc.rMux.Unlock()
+
+	lenBuf := make([]byte, 2)
+	if _, err := io.ReadFull(pc.Conn, lenBuf); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(binary.BigEndian.Uint16(lenBuf))
+	n := length
+	if n > len(b) {
+		n = len(b)
+	}
+
+	if _, err := io.ReadFull(pc.Conn, b[:n]); err != nil {
+		return 0, nil, err
+	}
+
+	// drop the part which doesn't fit in b
+	if n < length {
+		if _, err := io.CopyN(ioutil.Discard, pc.Conn, int64(length-n)); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return n, pc.rAddr, nil
+}
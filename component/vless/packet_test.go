@@ -0,0 +1,40 @@
+package vless
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketConn_WriteTo(t *testing.T) {
+	rAddr := &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 53}
+
+	for _, size := range []int{1, 1024, maxPacketLength - 1, maxPacketLength} {
+		client, server := net.Pipe()
+		cpc := NewPacketConn(client, rAddr)
+		spc := NewPacketConn(server, rAddr)
+
+		payload := bytes.Repeat([]byte{1}, size)
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := cpc.WriteTo(payload, rAddr)
+			errCh <- err
+		}()
+
+		buf := make([]byte, maxPacketLength)
+		n, addr, err := spc.ReadFrom(buf)
+		require.NoError(t, err, size)
+		require.NoError(t, <-errCh, size)
+		assert.Equal(t, payload, buf[:n], size)
+		assert.Equal(t, rAddr, addr, size)
+
+		client.Close()
+		server.Close()
+	}
+
+	_, err := NewPacketConn(nil, rAddr).WriteTo(make([]byte, maxPacketLength+1), rAddr)
+	assert.Error(t, err)
+}
@@ -9,22 +9,46 @@ import (
 	"github.com/Dreamacro/clash/common/pool"
 )
 
+// sizeCipher encrypts the chunk length when authenticated length is enabled
+type sizeCipher struct {
+	cipher.AEAD
+	nonce [32]byte
+	count uint16
+	iv    []byte
+}
+
+func newSizeCipher(aead cipher.AEAD, iv []byte) *sizeCipher {
+	return &sizeCipher{AEAD: aead, iv: iv}
+}
+
+func (s *sizeCipher) nextNonce() []byte {
+	binary.BigEndian.PutUint16(s.nonce[:2], s.count)
+	copy(s.nonce[2:], s.iv[2:12])
+	s.count++
+	return s.nonce[:s.NonceSize()]
+}
+
 type aeadWriter struct {
 	io.Writer
 	cipher.AEAD
 	nonce [32]byte
 	count uint16
 	iv    []byte
+	size  *sizeCipher
 }
 
-func newAEADWriter(w io.Writer, aead cipher.AEAD, iv []byte) *aeadWriter {
-	return &aeadWriter{Writer: w, AEAD: aead, iv: iv}
+func newAEADWriter(w io.Writer, aead cipher.AEAD, iv []byte, size *sizeCipher) *aeadWriter {
+	return &aeadWriter{Writer: w, AEAD: aead, iv: iv, size: size}
 }
 
 func (w *aeadWriter) Write(b []byte) (n int, err error) {
 	buf := pool.Get(pool.RelayBufferSize)
 	defer pool.Put(buf)
 	length := len(b)
+	sizeLen := lenSize
+	if w.size != nil {
+		sizeLen += w.size.Overhead()
+	}
 	for {
 		if length == 0 {
 			break
@@ -33,17 +57,24 @@ func (w *aeadWriter) Write(b []byte) (n int, err error) {
 		if length < readLen {
 			readLen = length
 		}
-		payloadBuf := buf[lenSize : lenSize+chunkSize-w.Overhead()]
+		payloadBuf := buf[sizeLen : sizeLen+chunkSize-w.Overhead()]
 		copy(payloadBuf, b[n:n+readLen])
 
-		binary.BigEndian.PutUint16(buf[:lenSize], uint16(readLen+w.Overhead()))
 		binary.BigEndian.PutUint16(w.nonce[:2], w.count)
 		copy(w.nonce[2:], w.iv[2:12])
 
 		w.Seal(payloadBuf[:0], w.nonce[:w.NonceSize()], payloadBuf[:readLen], nil)
 		w.count++
 
-		_, err = w.Writer.Write(buf[:lenSize+readLen+w.Overhead()])
+		if w.size != nil {
+			// the length is the size of sealed payload minus the overhead of size cipher
+			binary.BigEndian.PutUint16(buf[:lenSize], uint16(readLen+w.Overhead()-w.size.Overhead()))
+			w.size.Seal(buf[:0], w.size.nextNonce(), buf[:lenSize], nil)
+		} else {
+			binary.BigEndian.PutUint16(buf[:lenSize], uint16(readLen+w.Overhead()))
+		}
+
+		_, err = w.Writer.Write(buf[:sizeLen+readLen+w.Overhead()])
 		if err != nil {
 			break
 		}
@@ -62,10 +93,15 @@ type aeadReader struct {
 	iv      []byte
 	sizeBuf []byte
 	count   uint16
+	size    *sizeCipher
 }
 
-func newAEADReader(r io.Reader, aead cipher.AEAD, iv []byte) *aeadReader {
-	return &aeadReader{Reader: r, AEAD: aead, iv: iv, sizeBuf: make([]byte, lenSize)}
+func newAEADReader(r io.Reader, aead cipher.AEAD, iv []byte, size *sizeCipher) *aeadReader {
+	sizeLen := lenSize
+	if size != nil {
+		sizeLen += size.Overhead()
+	}
+	return &aeadReader{Reader: r, AEAD: aead, iv: iv, sizeBuf: make([]byte, sizeLen), size: size}
 }
 
 func (r *aeadReader) Read(b []byte) (int, error) {
@@ -84,7 +120,17 @@ func (r *aeadReader) Read(b []byte) (int, error) {
 		return 0, err
 	}
 
-	size := int(binary.BigEndian.Uint16(r.sizeBuf))
+	var size int
+	if r.size != nil {
+		sizeBuf, err := r.size.Open(r.sizeBuf[:0], r.size.nextNonce(), r.sizeBuf, nil)
+		if err != nil {
+			return 0, err
+		}
+		size = int(binary.BigEndian.Uint16(sizeBuf)) + r.size.Overhead()
+	} else {
+		size = int(binary.BigEndian.Uint16(r.sizeBuf))
+	}
+
 	if size > maxSize {
 		return 0, errors.New("buffer is larger than standard")
 	}
@@ -6,6 +6,7 @@ import (
 	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"hash/fnv"
@@ -34,6 +35,8 @@ type Conn struct {
 	respBodyKey []byte
 	respV       byte
 	security    byte
+	isAead      bool
+	option      byte
 
 	received bool
 }
@@ -57,11 +60,13 @@ func (vc *Conn) Read(b []byte) (int, error) {
 func (vc *Conn) sendRequest() error {
 	timestamp := time.Now()
 
-	h := hmac.New(md5.New, vc.id.UUID.Bytes())
-	binary.Write(h, binary.BigEndian, uint64(timestamp.Unix()))
-	_, err := vc.Conn.Write(h.Sum(nil))
-	if err != nil {
-		return err
+	if !vc.isAead {
+		h := hmac.New(md5.New, vc.id.UUID.Bytes())
+		binary.Write(h, binary.BigEndian, uint64(timestamp.Unix()))
+		_, err := vc.Conn.Write(h.Sum(nil))
+		if err != nil {
+			return err
+		}
 	}
 
 	buf := &bytes.Buffer{}
@@ -71,7 +76,7 @@ func (vc *Conn) sendRequest() error {
 	buf.Write(vc.reqBodyIV[:])
 	buf.Write(vc.reqBodyKey[:])
 	buf.WriteByte(vc.respV)
-	buf.WriteByte(OptionChunkStream)
+	buf.WriteByte(vc.option)
 
 	p := rand.Intn(16)
 	// P Sec Reserve Cmd
@@ -99,6 +104,11 @@ func (vc *Conn) sendRequest() error {
 	fnv1a.Write(buf.Bytes())
 	buf.Write(fnv1a.Sum(nil))
 
+	if vc.isAead {
+		_, err := vc.Conn.Write(sealAEADHeader(vc.id.CmdKey, buf.Bytes(), timestamp))
+		return err
+	}
+
 	block, err := aes.NewCipher(vc.id.CmdKey)
 	if err != nil {
 		return err
@@ -111,18 +121,31 @@ func (vc *Conn) sendRequest() error {
 }
 
 func (vc *Conn) recvResponse() error {
-	block, err := aes.NewCipher(vc.respBodyKey[:])
-	if err != nil {
-		return err
-	}
+	var buf []byte
+	if vc.isAead {
+		var err error
+		buf, err = openAEADResponseHeader(vc.Conn, vc.respBodyKey, vc.respBodyIV)
+		if err != nil {
+			return err
+		}
 
-	stream := cipher.NewCFBDecrypter(block, vc.respBodyIV[:])
-	buf := make([]byte, 4)
-	_, err = io.ReadFull(vc.Conn, buf)
-	if err != nil {
-		return err
+		if len(buf) < 4 {
+			return errors.New("unexpected response header")
+		}
+	} else {
+		block, err := aes.NewCipher(vc.respBodyKey[:])
+		if err != nil {
+			return err
+		}
+
+		stream := cipher.NewCFBDecrypter(block, vc.respBodyIV[:])
+		buf = make([]byte, 4)
+		_, err = io.ReadFull(vc.Conn, buf)
+		if err != nil {
+			return err
+		}
+		stream.XORKeyStream(buf, buf)
 	}
-	stream.XORKeyStream(buf, buf)
 
 	if buf[0] != vc.respV {
 		return errors.New("unexpected response header")
@@ -146,8 +169,29 @@ func hashTimestamp(t time.Time) []byte {
 	return md5hash.Sum(nil)
 }
 
+// chacha20Poly1305Key expands a 16 bytes key to the 32 bytes key of chacha20-poly1305
+func chacha20Poly1305Key(b []byte) []byte {
+	key := make([]byte, 32)
+	t := md5.Sum(b)
+	copy(key, t[:])
+	t = md5.Sum(key[:16])
+	copy(key[16:], t[:])
+	return key
+}
+
+func newAEAD(security Security, key []byte) cipher.AEAD {
+	if security == SecurityCHACHA20POLY1305 {
+		aead, _ := chacha20poly1305.New(chacha20Poly1305Key(key))
+		return aead
+	}
+
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	return aead
+}
+
 // newConn return a Conn instance
-func newConn(conn net.Conn, id *ID, dst *DstAddr, security Security) (*Conn, error) {
+func newConn(conn net.Conn, id *ID, dst *DstAddr, security Security, isAead bool, authenticatedLength bool) (*Conn, error) {
 	randBytes := make([]byte, 33)
 	rand.Read(randBytes)
 	reqBodyIV := make([]byte, 16)
@@ -156,8 +200,24 @@ func newConn(conn net.Conn, id *ID, dst *DstAddr, security Security) (*Conn, err
 	copy(reqBodyKey[:], randBytes[16:32])
 	respV := randBytes[32]
 
-	respBodyKey := md5.Sum(reqBodyKey[:])
-	respBodyIV := md5.Sum(reqBodyIV[:])
+	var respBodyKey, respBodyIV []byte
+	if isAead {
+		key := sha256.Sum256(reqBodyKey)
+		iv := sha256.Sum256(reqBodyIV)
+		respBodyKey, respBodyIV = key[:16], iv[:16]
+	} else {
+		key := md5.Sum(reqBodyKey)
+		iv := md5.Sum(reqBodyIV)
+		respBodyKey, respBodyIV = key[:], iv[:]
+	}
+
+	option := OptionChunkStream
+	if security == SecurityNone {
+		authenticatedLength = false
+	}
+	if authenticatedLength {
+		option |= OptionAuthenticatedLength
+	}
 
 	var writer io.Writer
 	var reader io.Reader
@@ -165,29 +225,17 @@ func newConn(conn net.Conn, id *ID, dst *DstAddr, security Security) (*Conn, err
 	case SecurityNone:
 		reader = newChunkReader(conn)
 		writer = newChunkWriter(conn)
-	case SecurityAES128GCM:
-		block, _ := aes.NewCipher(reqBodyKey[:])
-		aead, _ := cipher.NewGCM(block)
-		writer = newAEADWriter(conn, aead, reqBodyIV[:])
-
-		block, _ = aes.NewCipher(respBodyKey[:])
-		aead, _ = cipher.NewGCM(block)
-		reader = newAEADReader(conn, aead, respBodyIV[:])
-	case SecurityCHACHA20POLY1305:
-		key := make([]byte, 32)
-		t := md5.Sum(reqBodyKey[:])
-		copy(key, t[:])
-		t = md5.Sum(key[:16])
-		copy(key[16:], t[:])
-		aead, _ := chacha20poly1305.New(key)
-		writer = newAEADWriter(conn, aead, reqBodyIV[:])
-
-		t = md5.Sum(respBodyKey[:])
-		copy(key, t[:])
-		t = md5.Sum(key[:16])
-		copy(key[16:], t[:])
-		aead, _ = chacha20poly1305.New(key)
-		reader = newAEADReader(conn, aead, respBodyIV[:])
+	case SecurityAES128GCM, SecurityCHACHA20POLY1305:
+		var writerSize, readerSize *sizeCipher
+		if authenticatedLength {
+			// both directions derive the size cipher from the request body key and iv
+			sizeKey := kdf(reqBodyKey, kdfSaltConstAuthenticatedLength)[:16]
+			writerSize = newSizeCipher(newAEAD(security, sizeKey), reqBodyIV)
+			readerSize = newSizeCipher(newAEAD(security, sizeKey), reqBodyIV)
+		}
+
+		writer = newAEADWriter(conn, newAEAD(security, reqBodyKey), reqBodyIV, writerSize)
+		reader = newAEADReader(conn, newAEAD(security, respBodyKey), respBodyIV, readerSize)
 	}
 
 	c := &Conn{
@@ -197,11 +245,13 @@ func newConn(conn net.Conn, id *ID, dst *DstAddr, security Security) (*Conn, err
 		reqBodyIV:   reqBodyIV,
 		reqBodyKey:  reqBodyKey,
 		respV:       respV,
-		respBodyIV:  respBodyIV[:],
-		respBodyKey: respBodyKey[:],
+		respBodyIV:  respBodyIV,
+		respBodyKey: respBodyKey,
 		reader:      reader,
 		writer:      writer,
 		security:    security,
+		isAead:      isAead,
+		option:      option,
 	}
 	if err := c.sendRequest(); err != nil {
 		return nil, err
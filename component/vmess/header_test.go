@@ -0,0 +1,179 @@
+package vmess
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The vectors are generated by v2ray-core v5.4.1 for the uuid below, with
+// crypto/rand replaced by a counter from 0x00. The response header and the
+// body chunks are sealed with the keys of a fixed request body key and iv.
+
+const testUUID = "b831381d-6324-4d53-ad4f-8cda48b30811"
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func testCmdKey(t *testing.T) []byte {
+	id := uuid.FromStringOrNil(testUUID)
+	cmdKey := newID(&id).CmdKey
+	require.Equal(t, "b50d916ac0cec067981af8e5f38a758f", hex.EncodeToString(cmdKey))
+	return cmdKey
+}
+
+// openAEADHeader is the server side of sealAEADHeader, as OpenVMessAEADHeader of v2ray
+func openAEADHeader(cmdKey []byte, data []byte) ([]byte, error) {
+	if len(data) < 16+18+8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	authID, encryptedLength, nonce := data[:16], data[16:34], data[34:42]
+
+	lengthKey := kdf(cmdKey, kdfSaltConstVMessHeaderPayloadLengthAEADKey, string(authID), string(nonce))[:16]
+	lengthIV := kdf(cmdKey, kdfSaltConstVMessHeaderPayloadLengthAEADIV, string(authID), string(nonce))[:12]
+	length, err := newAESGCM(lengthKey).Open(nil, lengthIV, encryptedLength, authID)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedHeader := data[42:]
+	if len(encryptedHeader) != int(binary.BigEndian.Uint16(length))+16 {
+		return nil, errors.New("unexpected header length")
+	}
+
+	headerKey := kdf(cmdKey, kdfSaltConstVMessHeaderPayloadAEADKey, string(authID), string(nonce))[:16]
+	headerIV := kdf(cmdKey, kdfSaltConstVMessHeaderPayloadAEADIV, string(authID), string(nonce))[:12]
+	return newAESGCM(headerKey).Open(nil, headerIV, encryptedHeader, authID)
+}
+
+func decodeAuthID(t *testing.T, cmdKey, authID []byte) (int64, []byte) {
+	block, err := aes.NewCipher(kdf(cmdKey, kdfSaltConstAuthIDEncryptionKey)[:16])
+	require.NoError(t, err)
+	plain := make([]byte, 16)
+	block.Decrypt(plain, authID)
+	require.Equal(t, crc32.ChecksumIEEE(plain[:12]), binary.BigEndian.Uint32(plain[12:]), "authID checksum")
+	return int64(binary.BigEndian.Uint64(plain[:8])), plain[8:12]
+}
+
+func TestKDF(t *testing.T) {
+	// TestKDFValue of v2ray
+	key := kdf([]byte("Demo Key for KDF Value Test"), "Demo Path for KDF Value Test", "Demo Path for KDF Value Test2", "Demo Path for KDF Value Test3")
+	assert.Equal(t, "53e9d7e1bd7bd25022b71ead07d8a596efc8a845c7888652fd684b4903dc8892", hex.EncodeToString(key))
+
+	cmdKey := testCmdKey(t)
+	assert.Equal(t, "1415ba74ca8b3d041a8f583fb4116315", hex.EncodeToString(kdf(cmdKey, kdfSaltConstAuthIDEncryptionKey)[:16]))
+}
+
+func TestAuthID(t *testing.T) {
+	cmdKey := testCmdKey(t)
+
+	timestamp, random := decodeAuthID(t, cmdKey, mustDecodeHex(t, "d9c0ed55b9e8a475049f4f675a131a85"))
+	assert.Equal(t, int64(1700000000), timestamp)
+	assert.Equal(t, []byte{0, 1, 2, 3}, random)
+
+	now := time.Now().Unix()
+	timestamp, _ = decodeAuthID(t, cmdKey, createAuthID(cmdKey, now))
+	assert.Equal(t, now, timestamp)
+}
+
+func TestSealAEADHeader(t *testing.T) {
+	cmdKey := testCmdKey(t)
+
+	sealed := mustDecodeHex(t, "daab06087931888fcf22871b97e6de5541f8259e81baee747c828240d3ed3334"+
+		"86b808090a0b0c0d0e0f27cf73341aef8642ea8cf8120c07e0911e13784b2982"+
+		"4d13abc049d437d9f709b71bedfc90f651fc52")
+	header, err := openAEADHeader(cmdKey, sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "vmess aead request header", string(header))
+	_, random := decodeAuthID(t, cmdKey, sealed[:16])
+	assert.Equal(t, []byte{4, 5, 6, 7}, random)
+
+	now := time.Now()
+	sealed = sealAEADHeader(cmdKey, []byte("clash request header"), now)
+	header, err = openAEADHeader(cmdKey, sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "clash request header", string(header))
+	timestamp, _ := decodeAuthID(t, cmdKey, sealed[:16])
+	assert.Equal(t, now.Unix(), timestamp)
+
+	for _, i := range []int{0, 16, 33, 34, 41, 42, len(sealed) - 1} {
+		tampered := append([]byte{}, sealed...)
+		tampered[i] ^= 0xff
+		_, err := openAEADHeader(cmdKey, tampered)
+		assert.Error(t, err, "byte %d", i)
+	}
+}
+
+func TestOpenAEADResponseHeader(t *testing.T) {
+	reqBodyKey := md5.Sum([]byte("request body key"))
+	reqBodyIV := md5.Sum([]byte("request body iv"))
+	key := sha256.Sum256(reqBodyKey[:])
+	iv := sha256.Sum256(reqBodyIV[:])
+
+	resp := mustDecodeHex(t, "66d933ffd154b4acaaa1a0cf83ac083fc2e800ebc377841360d9c250f57014dbd8e58b1d1bdc")
+	header, err := openAEADResponseHeader(bytes.NewReader(resp), key[:16], iv[:16])
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x2a, 0, 0, 0}, header)
+
+	for _, i := range []int{0, 17, 18, len(resp) - 1} {
+		tampered := append([]byte{}, resp...)
+		tampered[i] ^= 0xff
+		_, err := openAEADResponseHeader(bytes.NewReader(tampered), key[:16], iv[:16])
+		assert.Error(t, err, "byte %d", i)
+	}
+
+	_, err = openAEADResponseHeader(bytes.NewReader(resp[:20]), key[:16], iv[:16])
+	assert.Error(t, err)
+}
+
+func TestAEADAuthenticatedLength(t *testing.T) {
+	reqBodyKey := md5.Sum([]byte("request body key"))
+	reqBodyIV := md5.Sum([]byte("request body iv"))
+
+	tests := []struct {
+		security Security
+		body     string
+	}{
+		{
+			SecurityAES128GCM,
+			"574f5e5b7e0205706b5424714f58a41cb8d8a87a901efb30f7f004810369a161046c2e93bbed5f9ee2b7a7c1620bda5507aadba74989015396c171deebaeccd7211fa3cd0476d4060e24a360175b",
+		},
+		{
+			SecurityCHACHA20POLY1305,
+			"e449b2711139502768a9d79bbdc034a647615d7bf4f99b11649019d1202093e967548d6b9212c5cdd04aa59a4e8432c49d18d47afdb22652fe1fb9e4861695a3f8d9e647a5e1ea71ee4a8d5fd4a7",
+		},
+	}
+
+	for _, tt := range tests {
+		sizeKey := kdf(reqBodyKey[:], kdfSaltConstAuthenticatedLength)[:16]
+
+		buf := &bytes.Buffer{}
+		w := newAEADWriter(buf, newAEAD(tt.security, reqBodyKey[:]), reqBodyIV[:], newSizeCipher(newAEAD(tt.security, sizeKey), reqBodyIV[:]))
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+		_, err = w.Write([]byte("vmess"))
+		require.NoError(t, err)
+		assert.Equal(t, tt.body, hex.EncodeToString(buf.Bytes()), "security %d", tt.security)
+
+		r := newAEADReader(bytes.NewReader(mustDecodeHex(t, tt.body)), newAEAD(tt.security, reqBodyKey[:]), reqBodyIV[:], newSizeCipher(newAEAD(tt.security, sizeKey), reqBodyIV[:]))
+		body, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "hellovmess", string(body))
+	}
+}
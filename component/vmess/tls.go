@@ -3,6 +3,8 @@ package vmess
 import (
 	"crypto/tls"
 	"net"
+
+	tlsC "github.com/Dreamacro/clash/component/tls"
 )
 
 type TLSConfig struct {
@@ -10,6 +12,8 @@ type TLSConfig struct {
 	SkipCertVerify bool
 	SessionCache   tls.ClientSessionCache
 	NextProtos     []string
+	Fingerprint    *tlsC.Fingerprint
+	MinVersion     uint16
 }
 
 func StreamTLSConn(conn net.Conn, cfg *TLSConfig) (net.Conn, error) {
@@ -18,9 +22,8 @@ func StreamTLSConn(conn net.Conn, cfg *TLSConfig) (net.Conn, error) {
 		InsecureSkipVerify: cfg.SkipCertVerify,
 		ClientSessionCache: cfg.SessionCache,
 		NextProtos:         cfg.NextProtos,
+		MinVersion:         cfg.MinVersion,
 	}
 
-	tlsConn := tls.Client(conn, tlsConfig)
-	err := tlsConn.Handshake()
-	return tlsConn, err
+	return tlsC.StreamConn(conn, tlsConfig, cfg.Fingerprint)
 }
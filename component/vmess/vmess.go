@@ -14,8 +14,9 @@ const Version byte = 1
 
 // Request Options
 const (
-	OptionChunkStream  byte = 1
-	OptionChunkMasking byte = 4
+	OptionChunkStream         byte = 1
+	OptionChunkMasking        byte = 4
+	OptionAuthenticatedLength byte = 16
 )
 
 // Security type vmess
@@ -58,9 +59,11 @@ type DstAddr struct {
 
 // Client is vmess connection generator
 type Client struct {
-	user     []*ID
-	uuid     *uuid.UUID
-	security Security
+	user                []*ID
+	uuid                *uuid.UUID
+	security            Security
+	isAead              bool
+	authenticatedLength bool
 }
 
 // Config of vmess
@@ -70,12 +73,14 @@ type Config struct {
 	Security string
 	Port     string
 	HostName string
+	// AuthenticatedLength encrypts the length of chunks, only works with AEAD ciphers
+	AuthenticatedLength bool
 }
 
 // StreamConn return a Conn with net.Conn and DstAddr
 func (c *Client) StreamConn(conn net.Conn, dst *DstAddr) (net.Conn, error) {
 	r := rand.Intn(len(c.user))
-	return newConn(conn, c.user[r], dst, c.security)
+	return newConn(conn, c.user[r], dst, c.security, c.isAead, c.authenticatedLength)
 }
 
 // NewClient return Client instance
@@ -106,5 +111,8 @@ func NewClient(config Config) (*Client, error) {
 		user:     newAlterIDs(newID(&uid), config.AlterID),
 		uuid:     &uid,
 		security: security,
+		// servers use AEAD header when alterId is 0
+		isAead:              config.AlterID == 0,
+		authenticatedLength: config.AuthenticatedLength,
 	}, nil
 }
@@ -1,7 +1,10 @@
 package vmess
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net"
@@ -11,6 +14,8 @@ import (
 	"sync"
 	"time"
 
+	tlsC "github.com/Dreamacro/clash/component/tls"
+
 	"github.com/gorilla/websocket"
 )
 
@@ -24,15 +29,41 @@ type websocketConn struct {
 	wMux sync.Mutex
 }
 
+// websocketWithEarlyDataConn dials the websocket with the first write, which
+// is sent as the early data of the upgrade request
+type websocketWithEarlyDataConn struct {
+	underlay net.Conn
+	config   *WebsocketConfig
+	// dialed is closed once conn is set
+	dialed chan struct{}
+	cancel context.CancelFunc
+	ctx    context.Context
+
+	// wMux serializes the writes, the first one dials
+	wMux sync.Mutex
+
+	// mux guards conn, closed and the deadlines set before the dial, which
+	// are applied to conn since the handshake resets the deadlines of underlay
+	mux           sync.Mutex
+	conn          net.Conn
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
 type WebsocketConfig struct {
-	Host           string
-	Port           string
-	Path           string
-	Headers        http.Header
-	TLS            bool
-	SkipCertVerify bool
-	ServerName     string
-	SessionCache   tls.ClientSessionCache
+	Host                string
+	Port                string
+	Path                string
+	Headers             http.Header
+	TLS                 bool
+	SkipCertVerify      bool
+	ServerName          string
+	SessionCache        tls.ClientSessionCache
+	Fingerprint         *tlsC.Fingerprint
+	MinVersion          uint16
+	MaxEarlyData        int
+	EarlyDataHeaderName string
 }
 
 // Read implements net.Conn.Read()
@@ -114,7 +145,159 @@ func (wsc *websocketConn) SetWriteDeadline(t time.Time) error {
 	return wsc.conn.SetWriteDeadline(t)
 }
 
-func StreamWebsocketConn(conn net.Conn, c *WebsocketConfig) (net.Conn, error) {
+// dial sends earlyData with the upgrade request, the part beyond
+// MaxEarlyData is written after the upgrade
+func (wsedc *websocketWithEarlyDataConn) dial(earlyData []byte) error {
+	base64DataBuf := &bytes.Buffer{}
+	base64EarlyDataEncoder := base64.NewEncoder(base64.RawURLEncoding, base64DataBuf)
+
+	earlyDataBuf := bytes.NewBuffer(earlyData)
+	if _, err := base64EarlyDataEncoder.Write(earlyDataBuf.Next(wsedc.config.MaxEarlyData)); err != nil {
+		return fmt.Errorf("failed to encode early data: %w", err)
+	}
+
+	if errc := base64EarlyDataEncoder.Close(); errc != nil {
+		return fmt.Errorf("failed to encode early data tail: %w", errc)
+	}
+
+	conn, err := streamWebsocketConn(wsedc.underlay, wsedc.config, base64DataBuf)
+	if err != nil {
+		wsedc.Close()
+		return fmt.Errorf("failed to dial WebSocket: %w", err)
+	}
+
+	wsedc.mux.Lock()
+	if wsedc.closed {
+		wsedc.mux.Unlock()
+		conn.Close()
+		return io.ErrClosedPipe
+	}
+	if !wsedc.readDeadline.IsZero() {
+		conn.SetReadDeadline(wsedc.readDeadline)
+	}
+	if !wsedc.writeDeadline.IsZero() {
+		conn.SetWriteDeadline(wsedc.writeDeadline)
+	}
+	wsedc.conn = conn
+	wsedc.mux.Unlock()
+	close(wsedc.dialed)
+
+	if earlyDataBuf.Len() != 0 {
+		_, err = conn.Write(earlyDataBuf.Bytes())
+	}
+	return err
+}
+
+// loadConn returns the websocket conn, it's nil before the dial
+func (wsedc *websocketWithEarlyDataConn) loadConn() (net.Conn, bool) {
+	wsedc.mux.Lock()
+	defer wsedc.mux.Unlock()
+	return wsedc.conn, wsedc.closed
+}
+
+func (wsedc *websocketWithEarlyDataConn) Write(b []byte) (int, error) {
+	wsedc.wMux.Lock()
+	defer wsedc.wMux.Unlock()
+
+	conn, closed := wsedc.loadConn()
+	if closed {
+		return 0, io.ErrClosedPipe
+	}
+	if conn == nil {
+		if err := wsedc.dial(b); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	return conn.Write(b)
+}
+
+func (wsedc *websocketWithEarlyDataConn) Read(b []byte) (int, error) {
+	conn, closed := wsedc.loadConn()
+	if closed {
+		return 0, io.ErrClosedPipe
+	}
+	if conn == nil {
+		select {
+		case <-wsedc.ctx.Done():
+			return 0, io.ErrUnexpectedEOF
+		case <-wsedc.dialed:
+		}
+		conn, _ = wsedc.loadConn()
+	}
+	return conn.Read(b)
+}
+
+func (wsedc *websocketWithEarlyDataConn) Close() error {
+	wsedc.mux.Lock()
+	wsedc.closed = true
+	conn := wsedc.conn
+	wsedc.mux.Unlock()
+
+	wsedc.cancel()
+	if conn == nil {
+		return wsedc.underlay.Close()
+	}
+	return conn.Close()
+}
+
+func (wsedc *websocketWithEarlyDataConn) LocalAddr() net.Addr {
+	if conn, _ := wsedc.loadConn(); conn != nil {
+		return conn.LocalAddr()
+	}
+	return wsedc.underlay.LocalAddr()
+}
+
+func (wsedc *websocketWithEarlyDataConn) RemoteAddr() net.Addr {
+	if conn, _ := wsedc.loadConn(); conn != nil {
+		return conn.RemoteAddr()
+	}
+	return wsedc.underlay.RemoteAddr()
+}
+
+func (wsedc *websocketWithEarlyDataConn) SetDeadline(t time.Time) error {
+	if err := wsedc.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return wsedc.SetWriteDeadline(t)
+}
+
+func (wsedc *websocketWithEarlyDataConn) SetReadDeadline(t time.Time) error {
+	wsedc.mux.Lock()
+	defer wsedc.mux.Unlock()
+
+	if wsedc.conn == nil {
+		wsedc.readDeadline = t
+		return wsedc.underlay.SetReadDeadline(t)
+	}
+	return wsedc.conn.SetReadDeadline(t)
+}
+
+func (wsedc *websocketWithEarlyDataConn) SetWriteDeadline(t time.Time) error {
+	wsedc.mux.Lock()
+	defer wsedc.mux.Unlock()
+
+	if wsedc.conn == nil {
+		wsedc.writeDeadline = t
+		return wsedc.underlay.SetWriteDeadline(t)
+	}
+	return wsedc.conn.SetWriteDeadline(t)
+}
+
+func streamWebsocketWithEarlyDataConn(conn net.Conn, c *WebsocketConfig) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn = &websocketWithEarlyDataConn{
+		dialed:   make(chan struct{}),
+		cancel:   cancel,
+		ctx:      ctx,
+		underlay: conn,
+		config:   c,
+	}
+	return conn, nil
+}
+
+func streamWebsocketConn(conn net.Conn, c *WebsocketConfig, earlyData *bytes.Buffer) (net.Conn, error) {
 	dialer := &websocket.Dialer{
 		NetDial: func(network, addr string) (net.Conn, error) {
 			return conn, nil
@@ -124,24 +307,35 @@ func StreamWebsocketConn(conn net.Conn, c *WebsocketConfig) (net.Conn, error) {
 		HandshakeTimeout: time.Second * 8,
 	}
 
-	scheme := "ws"
+	// the TLS handshake is done on conn rather than by the dialer, so that
+	// the ClientHello can be fingerprinted, and the scheme is always ws
 	if c.TLS {
-		scheme = "wss"
-		dialer.TLSClientConfig = &tls.Config{
+		tlsConfig := &tls.Config{
 			ServerName:         c.Host,
 			InsecureSkipVerify: c.SkipCertVerify,
 			ClientSessionCache: c.SessionCache,
+			MinVersion:         c.MinVersion,
+			NextProtos:         []string{"http/1.1"},
 		}
 
 		if c.ServerName != "" {
-			dialer.TLSClientConfig.ServerName = c.ServerName
+			tlsConfig.ServerName = c.ServerName
 		} else if host := c.Headers.Get("Host"); host != "" {
-			dialer.TLSClientConfig.ServerName = host
+			tlsConfig.ServerName = host
+		}
+
+		// the handshake is out of the HandshakeTimeout of the dialer
+		conn.SetDeadline(time.Now().Add(dialer.HandshakeTimeout))
+		tlsConn, err := tlsC.StreamConn(conn, tlsConfig, c.Fingerprint)
+		if err != nil {
+			return nil, err
 		}
+		conn.SetDeadline(time.Time{})
+		conn = tlsConn
 	}
 
 	uri := url.URL{
-		Scheme: scheme,
+		Scheme: "ws",
 		Host:   net.JoinHostPort(c.Host, c.Port),
 		Path:   c.Path,
 	}
@@ -153,6 +347,14 @@ func StreamWebsocketConn(conn net.Conn, c *WebsocketConfig) (net.Conn, error) {
 		}
 	}
 
+	if earlyData != nil {
+		if c.EarlyDataHeaderName == "" {
+			uri.Path += earlyData.String()
+		} else {
+			headers.Set(c.EarlyDataHeaderName, earlyData.String())
+		}
+	}
+
 	wsConn, resp, err := dialer.Dial(uri.String(), headers)
 	if err != nil {
 		reason := err.Error()
@@ -167,3 +369,11 @@ func StreamWebsocketConn(conn net.Conn, c *WebsocketConfig) (net.Conn, error) {
 		remoteAddr: conn.RemoteAddr(),
 	}, nil
 }
+
+func StreamWebsocketConn(conn net.Conn, c *WebsocketConfig) (net.Conn, error) {
+	if c.MaxEarlyData > 0 {
+		return streamWebsocketWithEarlyDataConn(conn, c)
+	}
+
+	return streamWebsocketConn(conn, c, nil)
+}
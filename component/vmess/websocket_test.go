@@ -0,0 +1,134 @@
+package vmess
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const earlyDataHeader = "Sec-WebSocket-Protocol"
+
+// newWebsocketEchoServer echoes the early data in earlyDataHeader and then
+// the messages back
+func newWebsocketEchoServer(t *testing.T) string {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		earlyData, err := base64.RawURLEncoding.DecodeString(r.Header.Get(earlyDataHeader))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, http.Header{earlyDataHeader: []string{r.Header.Get(earlyDataHeader)}})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if len(earlyData) != 0 {
+			if err := conn.WriteMessage(websocket.BinaryMessage, earlyData); err != nil {
+				return
+			}
+		}
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+func dialWebsocketWithEarlyData(t *testing.T, addr string) net.Conn {
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	raw, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+
+	conn, err := StreamWebsocketConn(raw, &WebsocketConfig{
+		Host:                host,
+		Port:                port,
+		Path:                "/",
+		MaxEarlyData:        4,
+		EarlyDataHeaderName: earlyDataHeader,
+	})
+	require.NoError(t, err)
+	return conn
+}
+
+func TestWebsocketWithEarlyData_Echo(t *testing.T) {
+	conn := dialWebsocketWithEarlyData(t, newWebsocketEchoServer(t))
+	defer conn.Close()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second*5)))
+
+	_, err := conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = conn.Write([]byte(" world"))
+	require.NoError(t, err)
+
+	buf := make([]byte, len("hello world"))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(buf))
+}
+
+func TestWebsocketWithEarlyData_ConcurrentClose(t *testing.T) {
+	addr := newWebsocketEchoServer(t)
+
+	for i := 0; i < 10; i++ {
+		conn := dialWebsocketWithEarlyData(t, addr)
+
+		wg := sync.WaitGroup{}
+		wg.Add(5)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 64)
+			for {
+				if _, err := conn.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+		for k := 0; k < 2; k++ {
+			go func() {
+				defer wg.Done()
+				for {
+					if _, err := conn.Write([]byte(strings.Repeat("ping", 4))); err != nil {
+						return
+					}
+				}
+			}()
+		}
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				conn.SetDeadline(time.Now().Add(time.Second))
+				conn.LocalAddr()
+				conn.RemoteAddr()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond * 10)
+			conn.Close()
+		}()
+		wg.Wait()
+	}
+}
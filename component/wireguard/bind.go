@@ -0,0 +1,134 @@
+package wireguard
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// Endpoint is the UDP address of the peer
+type Endpoint netip.AddrPort
+
+func (e Endpoint) ClearSrc() {}
+
+func (e Endpoint) SrcToString() string { return "" }
+
+func (e Endpoint) DstToString() string { return netip.AddrPort(e).String() }
+
+func (e Endpoint) DstToBytes() []byte {
+	b, _ := netip.AddrPort(e).MarshalBinary()
+	return b
+}
+
+func (e Endpoint) DstIP() netip.Addr { return netip.AddrPort(e).Addr() }
+
+func (e Endpoint) SrcIP() netip.Addr { return netip.Addr{} }
+
+// bind is a conn.Bind on the net.PacketConn of listen, so the packets of the
+// tunnel go through the clash dialer instead of a socket of wireguard-go
+type bind struct {
+	listen func() (net.PacketConn, error)
+
+	mux sync.Mutex
+	pc  net.PacketConn
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newBind(listen func() (net.PacketConn, error)) *bind {
+	return &bind{listen: listen, done: make(chan struct{})}
+}
+
+func (b *bind) Open(port uint16) ([]conn.ReceiveFunc, uint16, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.pc != nil {
+		return nil, 0, conn.ErrBindAlreadyOpen
+	}
+
+	pc, err := b.listen()
+	if err != nil {
+		return nil, 0, err
+	}
+	b.pc = pc
+
+	return []conn.ReceiveFunc{b.receive(pc)}, 0, nil
+}
+
+func (b *bind) receive(pc net.PacketConn) conn.ReceiveFunc {
+	return func(packets [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
+		n, addr, err := pc.ReadFrom(packets[0])
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				b.once.Do(func() { close(b.done) })
+			}
+			return 0, err
+		}
+
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			return 0, nil
+		}
+
+		ap := udpAddr.AddrPort()
+		sizes[0] = n
+		eps[0] = Endpoint(netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()))
+		return 1, nil
+	}
+}
+
+func (b *bind) Close() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.pc == nil {
+		return nil
+	}
+	err := b.pc.Close()
+	b.pc = nil
+	return err
+}
+
+// SetMark is a no-op, the socket is marked by the dialer
+func (b *bind) SetMark(mark uint32) error {
+	return nil
+}
+
+func (b *bind) Send(bufs [][]byte, ep conn.Endpoint) error {
+	e, ok := ep.(Endpoint)
+	if !ok {
+		return conn.ErrWrongEndpointType
+	}
+
+	b.mux.Lock()
+	pc := b.pc
+	b.mux.Unlock()
+	if pc == nil {
+		return net.ErrClosed
+	}
+
+	addr := net.UDPAddrFromAddrPort(netip.AddrPort(e))
+	for _, buf := range bufs {
+		if _, err := pc.WriteTo(buf, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	addr, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return nil, err
+	}
+	return Endpoint(addr), nil
+}
+
+func (b *bind) BatchSize() int {
+	return 1
+}
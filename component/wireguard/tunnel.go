@@ -0,0 +1,178 @@
+package wireguard
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/Dreamacro/clash/log"
+
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+// DefaultMTU is the MTU of the tunnel if it isn't set
+const DefaultMTU = 1408
+
+// Key is a Curve25519 key in the base64 form of wg(8)
+type Key [32]byte
+
+// ParseKey parses a base64 key
+func ParseKey(s string) (Key, error) {
+	var k Key
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return k, err
+	}
+	if len(b) != len(k) {
+		return k, fmt.Errorf("key length %d, want %d", len(b), len(k))
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+// Config is a WireGuard interface with a single peer
+type Config struct {
+	PrivateKey   Key
+	PublicKey    Key
+	PreSharedKey Key
+	Endpoint     netip.AddrPort
+	AllowedIPs   []netip.Prefix
+	// PersistentKeepalive is in seconds, zero disables it
+	PersistentKeepalive int
+	MTU                 int
+	// Addresses are the local addresses in the tunnel
+	Addresses []netip.Addr
+	// DNS are the nameservers in the tunnel resolving the dialed hosts
+	DNS []netip.Addr
+}
+
+// uapi returns the config in the cross-platform userspace API of wireguard-go
+func (c *Config) uapi() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "private_key=%s\n", hex.EncodeToString(c.PrivateKey[:]))
+	fmt.Fprintf(b, "public_key=%s\n", hex.EncodeToString(c.PublicKey[:]))
+	if c.PreSharedKey != (Key{}) {
+		fmt.Fprintf(b, "preshared_key=%s\n", hex.EncodeToString(c.PreSharedKey[:]))
+	}
+	if c.Endpoint.IsValid() {
+		fmt.Fprintf(b, "endpoint=%s\n", c.Endpoint.String())
+	}
+	if c.PersistentKeepalive != 0 {
+		fmt.Fprintf(b, "persistent_keepalive_interval=%d\n", c.PersistentKeepalive)
+	}
+	for _, prefix := range c.AllowedIPs {
+		fmt.Fprintf(b, "allowed_ip=%s\n", prefix.String())
+	}
+	return b.String()
+}
+
+// Tunnel is a userspace WireGuard device whose TCP/IP stack is the gVisor
+// netstack of wireguard-go
+type Tunnel struct {
+	device *device.Device
+	net    *netstack.Net
+	bind   *bind
+}
+
+// NewTunnel starts a tunnel, the packets to the peer are sent by the packet
+// conn of listen
+func NewTunnel(c Config, listen func() (net.PacketConn, error)) (*Tunnel, error) {
+	if len(c.Addresses) == 0 {
+		return nil, errors.New("no local address")
+	}
+
+	mtu := c.MTU
+	if mtu == 0 {
+		mtu = DefaultMTU
+	}
+
+	tunDevice, tnet, err := netstack.CreateNetTUN(c.Addresses, c.DNS, mtu)
+	if err != nil {
+		return nil, err
+	}
+
+	b := newBind(listen)
+	dev := device.NewDevice(tunDevice, b, &device.Logger{
+		Verbosef: func(format string, args ...interface{}) {
+			log.Debugln("[WireGuard] "+format, args...)
+		},
+		Errorf: func(format string, args ...interface{}) {
+			log.Warnln("[WireGuard] "+format, args...)
+		},
+	})
+	if err := dev.IpcSet(c.uapi()); err != nil {
+		dev.Close()
+		return nil, err
+	}
+	if err := dev.Up(); err != nil {
+		dev.Close()
+		return nil, err
+	}
+
+	return &Tunnel{device: dev, net: tnet, bind: b}, nil
+}
+
+// DialContext dials a TCP address in the tunnel, a host is resolved by the
+// nameservers of the config
+func (t *Tunnel) DialContext(ctx context.Context, address string) (net.Conn, error) {
+	return t.net.DialContext(ctx, "tcp", address)
+}
+
+// ListenPacket returns a dual-stack UDP packet conn in the tunnel
+func (t *Tunnel) ListenPacket() (net.PacketConn, error) {
+	// netstack binds the unspecified address only with a port, so a port of
+	// the ephemeral range is picked until one is free
+	var err error
+	for i := 0; i < 16; i++ {
+		port := uint16(49152 + rand.Intn(16384))
+		pc, e := t.net.ListenUDPAddrPort(netip.AddrPortFrom(netip.Addr{}, port))
+		if e == nil {
+			return &dualStackPacketConn{PacketConn: pc}, nil
+		}
+		err = e
+	}
+	return nil, err
+}
+
+// Done is closed when the socket to the peer is broken, the tunnel should
+// be started again
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.bind.done
+}
+
+// Close closes the device and its socket, the connections in the tunnel are broken
+func (t *Tunnel) Close() error {
+	t.device.Close()
+	return nil
+}
+
+// dualStackPacketConn sends IPv4 destinations as IPv4-mapped addresses of
+// the IPv6 socket, and returns the IPv4 sources in the 4-byte form
+type dualStackPacketConn struct {
+	net.PacketConn
+}
+
+func (pc *dualStackPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, errors.New("invalid udp address")
+	}
+	return pc.PacketConn.WriteTo(b, &net.UDPAddr{IP: udpAddr.IP.To16(), Port: udpAddr.Port})
+}
+
+func (pc *dualStackPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := pc.PacketConn.ReadFrom(b)
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		if ip := udpAddr.IP.To4(); ip != nil {
+			addr = &net.UDPAddr{IP: ip, Port: udpAddr.Port}
+		}
+	}
+	return n, addr, err
+}
@@ -0,0 +1,174 @@
+package wireguard
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/curve25519"
+)
+
+func newTestKeys(t *testing.T) (Key, Key) {
+	var private, public Key
+	_, err := rand.Read(private[:])
+	require.NoError(t, err)
+	private[0] &= 248
+	private[31] = (private[31] & 127) | 64
+
+	b, err := curve25519.X25519(private[:], curve25519.Basepoint)
+	require.NoError(t, err)
+	copy(public[:], b)
+	return private, public
+}
+
+// newTestPeer starts a peer whose address in the tunnel is 10.0.0.1, it
+// echoes TCP on port 80 and UDP on port 53
+func newTestPeer(t *testing.T, private Key, client Key) netip.AddrPort {
+	var pc net.PacketConn
+	listen := func() (net.PacketConn, error) {
+		var err error
+		pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+		return pc, err
+	}
+
+	peer, err := NewTunnel(Config{
+		PrivateKey: private,
+		PublicKey:  client,
+		AllowedIPs: []netip.Prefix{netip.MustParsePrefix("10.0.0.2/32")},
+		Addresses:  []netip.Addr{netip.MustParseAddr("10.0.0.1")},
+	}, listen)
+	require.NoError(t, err)
+	t.Cleanup(func() { peer.Close() })
+
+	l, err := peer.net.ListenTCPAddrPort(netip.MustParseAddrPort("10.0.0.1:80"))
+	require.NoError(t, err)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+
+	u, err := peer.net.ListenUDPAddrPort(netip.MustParseAddrPort("10.0.0.1:53"))
+	require.NoError(t, err)
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := u.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			u.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	return pc.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+
+func newTestTunnel(t *testing.T, addresses ...netip.Addr) *Tunnel {
+	serverPrivate, serverPublic := newTestKeys(t)
+	clientPrivate, clientPublic := newTestKeys(t)
+	endpoint := newTestPeer(t, serverPrivate, clientPublic)
+
+	tunnel, err := NewTunnel(Config{
+		PrivateKey: clientPrivate,
+		PublicKey:  serverPublic,
+		Endpoint:   endpoint,
+		AllowedIPs: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")},
+		Addresses:  addresses,
+	}, func() (net.PacketConn, error) {
+		return net.ListenPacket("udp", "127.0.0.1:0")
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { tunnel.Close() })
+	return tunnel
+}
+
+func TestTunnel_TCP(t *testing.T) {
+	tunnel := newTestTunnel(t, netip.MustParseAddr("10.0.0.2"))
+
+	c, err := tunnel.DialContext(context.Background(), "10.0.0.1:80")
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	select {
+	case <-tunnel.Done():
+		t.Fatal("tunnel is done")
+	default:
+	}
+}
+
+func TestTunnel_UDP(t *testing.T) {
+	t.Run("IPv4", func(t *testing.T) {
+		testTunnelUDP(t, newTestTunnel(t, netip.MustParseAddr("10.0.0.2")))
+	})
+	t.Run("DualStack", func(t *testing.T) {
+		testTunnelUDP(t, newTestTunnel(t, netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("fd00::2")))
+	})
+}
+
+// testTunnelUDP echoes by the IPv4 peer, the source is returned in the 4-byte form
+func testTunnelUDP(t *testing.T, tunnel *Tunnel) {
+	pc, err := tunnel.ListenPacket()
+	require.NoError(t, err)
+	defer pc.Close()
+
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 53}
+	_, err = pc.WriteTo([]byte("hello"), addr)
+	require.NoError(t, err)
+
+	buf := make([]byte, 16)
+	n, from, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	assert.Equal(t, addr.String(), from.String())
+}
+
+func TestParseKey(t *testing.T) {
+	private, _ := newTestKeys(t)
+	k, err := ParseKey(base64.StdEncoding.EncodeToString(private[:]))
+	require.NoError(t, err)
+	assert.Equal(t, private, k)
+
+	_, err = ParseKey(base64.StdEncoding.EncodeToString(private[:16]))
+	assert.Error(t, err)
+	_, err = ParseKey("not base64")
+	assert.Error(t, err)
+}
+
+func TestConfig_UAPI(t *testing.T) {
+	c := Config{
+		Endpoint:            netip.MustParseAddrPort("1.2.3.4:51820"),
+		AllowedIPs:          []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")},
+		PersistentKeepalive: 25,
+	}
+	c.PrivateKey[0] = 1
+	c.PublicKey[0] = 2
+
+	zero := "00000000000000000000000000000000000000000000000000000000000000"
+	assert.Equal(t, "private_key=01"+zero+"\n"+
+		"public_key=02"+zero+"\n"+
+		"endpoint=1.2.3.4:51820\n"+
+		"persistent_keepalive_interval=25\n"+
+		"allowed_ip=0.0.0.0/0\n"+
+		"allowed_ip=::/0\n", c.uapi())
+}
@@ -1,22 +1,34 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Dreamacro/clash/adapters/outbound"
 	"github.com/Dreamacro/clash/adapters/outboundgroup"
 	"github.com/Dreamacro/clash/adapters/provider"
 	"github.com/Dreamacro/clash/component/auth"
+	"github.com/Dreamacro/clash/component/dialer"
 	"github.com/Dreamacro/clash/component/fakeip"
+	"github.com/Dreamacro/clash/component/geosite"
+	"github.com/Dreamacro/clash/component/mmdb"
+	"github.com/Dreamacro/clash/component/resolver"
+	"github.com/Dreamacro/clash/component/sniffer"
+	tlsC "github.com/Dreamacro/clash/component/tls"
 	"github.com/Dreamacro/clash/component/trie"
 	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/dns"
 	"github.com/Dreamacro/clash/log"
+	P "github.com/Dreamacro/clash/proxy"
+	"github.com/Dreamacro/clash/proxy/tun"
 	R "github.com/Dreamacro/clash/rules"
 	T "github.com/Dreamacro/clash/tunnel"
 
@@ -31,6 +43,17 @@ type General struct {
 	LogLevel  log.LogLevel `json:"log-level"`
 	IPv6      bool         `json:"ipv6"`
 	Interface string       `json:"interface-name"`
+	// RoutingMark is the SO_MARK of the outbound sockets on Linux, it can be
+	// overridden by each proxy and rule
+	RoutingMark int `json:"routing-mark"`
+	// KeepAliveInterval and IdleTimeout are in seconds, they can be
+	// overridden by each proxy
+	KeepAliveInterval int `json:"keep-alive-interval"`
+	IdleTimeout       int `json:"idle-timeout"`
+	// ShutdownTimeout is the seconds to wait for the alive connections when shutting down
+	ShutdownTimeout int `json:"shutdown-timeout"`
+	// UDPTimeout is the idle timeout of the UDP sessions in seconds
+	UDPTimeout int `json:"udp-timeout"`
 }
 
 // Inbound
@@ -42,7 +65,11 @@ type Inbound struct {
 	MixedPort      int      `json:"mixed-port"`
 	Authentication []string `json:"authentication"`
 	AllowLan       bool     `json:"allow-lan"`
-	BindAddress    string   `json:"bind-address"`
+	BindAddress    []string `json:"bind-address"`
+	// InboundBindAddress overrides BindAddress by the inbound names
+	InboundBindAddress map[string][]string `json:"inbound-bind-address"`
+	// TCPFastOpen enables TCP Fast Open of the TCP listeners on Linux and macOS
+	TCPFastOpen bool `json:"tcp-fast-open"`
 }
 
 // Controller
@@ -50,12 +77,14 @@ type Controller struct {
 	ExternalController string `json:"-"`
 	ExternalUI         string `json:"-"`
 	Secret             string `json:"-"`
+	// ExternalMetrics is the address serving only /metrics without the secret
+	ExternalMetrics string `json:"-"`
 }
 
 // DNS config
 type DNS struct {
 	Enable            bool             `yaml:"enable"`
-	IPv6              bool             `yaml:"ipv6"`
+	IPv6              dns.IPv6Mode     `yaml:"ipv6"`
 	NameServer        []dns.NameServer `yaml:"nameserver"`
 	Fallback          []dns.NameServer `yaml:"fallback"`
 	FallbackFilter    FallbackFilter   `yaml:"fallback-filter"`
@@ -64,73 +93,288 @@ type DNS struct {
 	DefaultNameserver []dns.NameServer `yaml:"default-nameserver"`
 	FakeIPRange       *fakeip.Pool
 	Hosts             *trie.DomainTrie
+	CacheTTL          dns.CacheTTL
+	ECS               *dns.ECS
+	Strategy          dns.Strategy
+	UpstreamTimeout   time.Duration
+	NameServerPolicy  map[string]string
+	NameServerGroup   map[string]dns.NameServerGroup
+	Prefetch          dns.Prefetch
+	QueryLog          dns.QueryLog
+	DoTPool           dns.DoTPool
+	// DirectNameServer resolves the hosts dialed by DIRECT, the main
+	// nameservers are used if it's empty
+	DirectNameServer []dns.NameServer
+	Rewrites         []dns.RewriteRule
 }
 
 // FallbackFilter config
 type FallbackFilter struct {
-	GeoIP  bool         `yaml:"geoip"`
-	IPCIDR []*net.IPNet `yaml:"ipcidr"`
-	Domain []string     `yaml:"domain"`
+	GeoIP   bool           `yaml:"geoip"`
+	IPCIDR  []*net.IPNet   `yaml:"ipcidr"`
+	Domain  []string       `yaml:"domain"`
+	GeoSite []string       `yaml:"geosite"`
+	Mode    dns.FilterMode `yaml:"mode"`
 }
 
 // Experimental config
 type Experimental struct{}
 
+// HappyEyeballs config, fallback-delay is in milliseconds. Both address
+// families are dialed at once unless fallback-delay is set.
+type HappyEyeballs struct {
+	PreferIPv6    bool `yaml:"prefer-ipv6"`
+	FallbackDelay int  `yaml:"fallback-delay"`
+}
+
+// Profile config, nothing is stored in the cache file unless it's enabled
+type Profile struct {
+	StoreFakeIP   bool `yaml:"store-fake-ip"`
+	StoreSelected bool `yaml:"store-selected"`
+	// StoreDelay stores the last delay of proxies, which are restored on startup
+	StoreDelay bool `yaml:"store-delay"`
+}
+
+// GeoSite config
+type GeoSite struct {
+	Path           string `yaml:"path"`
+	URL            string `yaml:"url"`
+	AutoUpdate     bool   `yaml:"auto-update"`
+	UpdateInterval int    `yaml:"update-interval"`
+}
+
+// GeoIP config of the Country database, the downloads are verified by sha256
+// or the checksum file at sha256-url. sha256 pins the database, so it can't
+// be used with auto-update.
+type GeoIP struct {
+	URL            string `yaml:"url"`
+	SHA256         string `yaml:"sha256"`
+	SHA256URL      string `yaml:"sha256-url"`
+	AutoUpdate     bool   `yaml:"auto-update"`
+	UpdateInterval int    `yaml:"update-interval"`
+}
+
+// Tun config, the tun inbound is supported on Linux only. auto-detect-interface
+// binds the outbound connections to the interface of the default route unless
+// interface-name is set, so that they aren't routed back to the device. IPv6
+// is enabled by inet6-address. stack is system or gvisor.
+type Tun struct {
+	Enable              bool   `yaml:"enable"`
+	Device              string `yaml:"device"`
+	Inet4Address        string `yaml:"inet4-address"`
+	Inet6Address        string `yaml:"inet6-address"`
+	MTU                 int    `yaml:"mtu"`
+	AutoRoute           bool   `yaml:"auto-route"`
+	AutoDetectInterface bool   `yaml:"auto-detect-interface"`
+	Stack               string `yaml:"stack"`
+}
+
+// RawSniffer sniffs the domain of TCP connections to IP, the ports are port
+// numbers or ranges
+type RawSniffer struct {
+	Enable              bool     `yaml:"enable"`
+	Sniff               []string `yaml:"sniff"`
+	Ports               []string `yaml:"ports"`
+	OverrideDestination bool     `yaml:"override-destination"`
+	BlockQUIC           []string `yaml:"block-quic"`
+}
+
 // Config is clash config manager
 type Config struct {
-	General      *General
-	DNS          *DNS
-	Experimental *Experimental
-	Hosts        *trie.DomainTrie
-	Rules        []C.Rule
-	Users        []auth.AuthUser
-	Proxies      map[string]C.Proxy
-	Providers    map[string]provider.ProxyProvider
+	General       *General
+	DNS           *DNS
+	Experimental  *Experimental
+	HappyEyeballs *HappyEyeballs
+	Profile       *Profile
+	GeoSite       *GeoSite
+	GeoIP         *GeoIP
+	Database      *Database
+	Tun           *Tun
+	Sniffer       *sniffer.Sniffer
+	Hosts         *trie.DomainTrie
+	Rules         []C.Rule
+	Users         []auth.AuthUser
+	Proxies       map[string]C.Proxy
+	Providers     map[string]provider.ProxyProvider
+
+	raw *RawConfig
 }
 
 type RawDNS struct {
-	Enable            bool              `yaml:"enable"`
-	IPv6              bool              `yaml:"ipv6"`
-	UseHosts          bool              `yaml:"use-hosts"`
-	NameServer        []string          `yaml:"nameserver"`
-	Fallback          []string          `yaml:"fallback"`
-	FallbackFilter    RawFallbackFilter `yaml:"fallback-filter"`
-	Listen            string            `yaml:"listen"`
-	EnhancedMode      dns.EnhancedMode  `yaml:"enhanced-mode"`
-	FakeIPRange       string            `yaml:"fake-ip-range"`
-	FakeIPFilter      []string          `yaml:"fake-ip-filter"`
-	DefaultNameserver []string          `yaml:"default-nameserver"`
+	Enable            bool                          `yaml:"enable"`
+	IPv6              dns.IPv6Mode                  `yaml:"ipv6"`
+	UseHosts          bool                          `yaml:"use-hosts"`
+	NameServer        []RawNameServer               `yaml:"nameserver"`
+	Fallback          []RawNameServer               `yaml:"fallback"`
+	FallbackFilter    RawFallbackFilter             `yaml:"fallback-filter"`
+	Listen            string                        `yaml:"listen"`
+	EnhancedMode      dns.EnhancedMode              `yaml:"enhanced-mode"`
+	FakeIPRange       string                        `yaml:"fake-ip-range"`
+	FakeIPRange6      string                        `yaml:"fake-ip-range6"`
+	FakeIPFilter      []string                      `yaml:"fake-ip-filter"`
+	DefaultNameserver []RawNameServer               `yaml:"default-nameserver"`
+	CacheMinTTL       uint32                        `yaml:"cache-min-ttl"`
+	CacheMaxTTL       uint32                        `yaml:"cache-max-ttl"`
+	NegativeCacheTTL  uint32                        `yaml:"negative-cache-ttl"`
+	ECS               string                        `yaml:"ecs"`
+	Strategy          dns.Strategy                  `yaml:"strategy"`
+	UpstreamTimeout   int                           `yaml:"upstream-timeout"`
+	NameServerPolicy  map[string]string             `yaml:"nameserver-policy"`
+	NameServerGroup   map[string]RawNameServerGroup `yaml:"nameserver-group"`
+	Prefetch          RawPrefetch                   `yaml:"prefetch"`
+	QueryLog          RawQueryLog                   `yaml:"query-log"`
+	DoTPool           RawDoTPool                    `yaml:"dot-pool"`
+	DirectNameServer  []RawNameServer               `yaml:"direct-nameserver"`
+	Rewrite           []RawRewriteRule              `yaml:"rewrite"`
+}
+
+// RawRewriteRule overrides the answer of name, a domain of the hosts syntax,
+// before the nameservers. One of answer, cname and rcode is required, ttl is
+// in seconds.
+type RawRewriteRule struct {
+	Name   string   `yaml:"name"`
+	Type   string   `yaml:"type"`
+	Answer []string `yaml:"answer"`
+	CNAME  string   `yaml:"cname"`
+	Rcode  string   `yaml:"rcode"`
+	TTL    uint32   `yaml:"ttl"`
+}
+
+// RawDoTPool keeps at most size connections to each DoT server, a connection
+// is closed if it's idle for idle-timeout seconds
+type RawDoTPool struct {
+	Size        int `yaml:"size"`
+	IdleTimeout int `yaml:"idle-timeout"`
+}
+
+// RawNameServerGroup is a named group of nameservers for nameserver-policy,
+// strategy is failover or parallel, timeout is in milliseconds
+type RawNameServerGroup struct {
+	NameServer []RawNameServer `yaml:"nameserver"`
+	Strategy   string          `yaml:"strategy"`
+	Timeout    int             `yaml:"timeout"`
+}
+
+// BindAddress is an address, or a list of addresses
+type BindAddress []string
+
+// UnmarshalYAML unserialize BindAddress from an address or a list
+func (b *BindAddress) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var addr string
+	if err := unmarshal(&addr); err == nil {
+		*b = BindAddress{addr}
+		return nil
+	}
+
+	return unmarshal((*[]string)(b))
 }
 
+// RawHost is an IP, a list of IPs, or a domain which the host is aliased to
+type RawHost []string
+
+// UnmarshalYAML unserialize RawHost from a value or a list
+func (h *RawHost) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		*h = RawHost{value}
+		return nil
+	}
+
+	return unmarshal((*[]string)(h))
+}
+
+// RawNameServer is a nameserver URL, or a mapping of the URL and the DoH
+// options, e.g. `{url: https://doh.example/dns-query, method: GET, headers: {...}}`.
+// client-fingerprint and tls-min-version are the TLS options of DoH and DoT.
+// padding pads the DoH and DoT queries to a multiple of the block size, e.g. 128.
+type RawNameServer struct {
+	URL               string            `yaml:"url"`
+	Method            string            `yaml:"method"`
+	Headers           map[string]string `yaml:"headers"`
+	ClientFingerprint string            `yaml:"client-fingerprint"`
+	TLSMinVersion     string            `yaml:"tls-min-version"`
+	Padding           int               `yaml:"padding"`
+}
+
+// UnmarshalYAML unserialize RawNameServer from a URL or a mapping
+func (ns *RawNameServer) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var url string
+	if err := unmarshal(&url); err == nil {
+		ns.URL = url
+		return nil
+	}
+
+	type rawNameServer RawNameServer
+	return unmarshal((*rawNameServer)(ns))
+}
+
+// RawQueryLog logs the queries to the DNS server, as JSON lines if file is set
+type RawQueryLog struct {
+	Enable bool   `yaml:"enable"`
+	File   string `yaml:"file"`
+}
+
+// RawPrefetch refreshes the cache entries hit at least min-hits times
+// when their ttl is less than threshold seconds
+type RawPrefetch struct {
+	Enable      bool `yaml:"enable"`
+	Threshold   int  `yaml:"threshold"`
+	MinHits     int  `yaml:"min-hits"`
+	Concurrency int  `yaml:"concurrency"`
+}
+
+// RawFallbackFilter mode is or (default) or and, the geosite categories are
+// matched like domain
 type RawFallbackFilter struct {
-	GeoIP  bool     `yaml:"geoip"`
-	IPCIDR []string `yaml:"ipcidr"`
-	Domain []string `yaml:"domain"`
+	GeoIP   bool           `yaml:"geoip"`
+	IPCIDR  []string       `yaml:"ipcidr"`
+	Domain  []string       `yaml:"domain"`
+	GeoSite []string       `yaml:"geosite"`
+	Mode    dns.FilterMode `yaml:"mode"`
 }
 
 type RawConfig struct {
-	Port               int          `yaml:"port"`
-	SocksPort          int          `yaml:"socks-port"`
-	RedirPort          int          `yaml:"redir-port"`
-	TProxyPort         int          `yaml:"tproxy-port"`
-	MixedPort          int          `yaml:"mixed-port"`
-	Authentication     []string     `yaml:"authentication"`
-	AllowLan           bool         `yaml:"allow-lan"`
-	BindAddress        string       `yaml:"bind-address"`
-	Mode               T.TunnelMode `yaml:"mode"`
-	LogLevel           log.LogLevel `yaml:"log-level"`
-	IPv6               bool         `yaml:"ipv6"`
-	ExternalController string       `yaml:"external-controller"`
-	ExternalUI         string       `yaml:"external-ui"`
-	Secret             string       `yaml:"secret"`
-	Interface          string       `yaml:"interface-name"`
+	Port           int          `yaml:"port"`
+	SocksPort      int          `yaml:"socks-port"`
+	RedirPort      int          `yaml:"redir-port"`
+	TProxyPort     int          `yaml:"tproxy-port"`
+	MixedPort      int          `yaml:"mixed-port"`
+	Authentication []string     `yaml:"authentication"`
+	AllowLan       bool         `yaml:"allow-lan"`
+	BindAddress    BindAddress  `yaml:"bind-address"`
+	TCPFastOpen    bool         `yaml:"tcp-fast-open"`
+	Mode           T.TunnelMode `yaml:"mode"`
+	LogLevel       log.LogLevel `yaml:"log-level"`
+	// InboundBindAddress are the bind addresses of http, socks, redir, tproxy and mixed
+	InboundBindAddress map[string]BindAddress `yaml:"inbound-bind-address"`
+	IPv6               bool                   `yaml:"ipv6"`
+	ExternalController string                 `yaml:"external-controller"`
+	ExternalUI         string                 `yaml:"external-ui"`
+	ExternalMetrics    string                 `yaml:"external-metrics"`
+	Secret             string                 `yaml:"secret"`
+	Interface          string                 `yaml:"interface-name"`
+	RoutingMark        int                    `yaml:"routing-mark"`
+	KeepAliveInterval  int                    `yaml:"keep-alive-interval"`
+	IdleTimeout        int                    `yaml:"idle-timeout"`
+	ShutdownTimeout    int                    `yaml:"shutdown-timeout"`
+	UDPTimeout         int                    `yaml:"udp-timeout"`
+	ASNDatabase        string                 `yaml:"asn-database"`
+	GeoIPDatabase      string                 `yaml:"geoip-database"`
+	SrcGeoIPDatabase   string                 `yaml:"src-geoip-database"`
 
 	ProxyProvider map[string]map[string]interface{} `yaml:"proxy-providers"`
-	Hosts         map[string]string                 `yaml:"hosts"`
+	Hosts         map[string]RawHost                `yaml:"hosts"`
 	DNS           RawDNS                            `yaml:"dns"`
 	Experimental  Experimental                      `yaml:"experimental"`
+	HappyEyeballs HappyEyeballs                     `yaml:"happy-eyeballs"`
+	Profile       Profile                           `yaml:"profile"`
+	GeoSite       GeoSite                           `yaml:"geosite"`
+	GeoIP         GeoIP                             `yaml:"geoip"`
+	Tun           Tun                               `yaml:"tun"`
+	Sniffer       RawSniffer                        `yaml:"sniffer"`
 	Proxy         []map[string]interface{}          `yaml:"proxies"`
 	ProxyGroup    []map[string]interface{}          `yaml:"proxy-groups"`
+	Script        map[string]string                 `yaml:"scripts"`
 	Rule          []string                          `yaml:"rules"`
 }
 
@@ -144,15 +388,27 @@ func Parse(buf []byte) (*Config, error) {
 	return ParseRawConfig(rawCfg)
 }
 
+// ParseWithBase parses config like Parse, the proxies, proxy groups and
+// providers of base whose configuration is unchanged are reused, so they keep
+// their states (e.g. selected proxy, health check results)
+func ParseWithBase(buf []byte, base *Config) (*Config, error) {
+	rawCfg, err := UnmarshalRawConfig(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRawConfig(rawCfg, base)
+}
+
 func UnmarshalRawConfig(buf []byte) (*RawConfig, error) {
 	// config with some default value
 	rawCfg := &RawConfig{
 		AllowLan:       false,
-		BindAddress:    "*",
+		BindAddress:    BindAddress{"*"},
 		Mode:           T.Rule,
 		Authentication: []string{},
 		LogLevel:       log.INFO,
-		Hosts:          map[string]string{},
+		Hosts:          map[string]RawHost{},
 		Rule:           []string{},
 		Proxy:          []map[string]interface{}{},
 		ProxyGroup:     []map[string]interface{}{},
@@ -164,11 +420,40 @@ func UnmarshalRawConfig(buf []byte) (*RawConfig, error) {
 				GeoIP:  true,
 				IPCIDR: []string{},
 			},
-			DefaultNameserver: []string{
-				"114.114.114.114",
-				"8.8.8.8",
+			DefaultNameserver: []RawNameServer{
+				{URL: "114.114.114.114"},
+				{URL: "8.8.8.8"},
 			},
+			NegativeCacheTTL: 300,
+			Prefetch: RawPrefetch{
+				Threshold:   10,
+				MinHits:     3,
+				Concurrency: 8,
+			},
+			DoTPool: RawDoTPool{
+				Size:        1,
+				IdleTimeout: 30,
+			},
+		},
+		GeoSite: GeoSite{
+			UpdateInterval: 24,
+		},
+		GeoIP: GeoIP{
+			UpdateInterval: 24,
+		},
+		Tun: Tun{
+			Device:       tun.DefaultDevice,
+			Inet4Address: tun.DefaultInet4Address,
+			MTU:          tun.DefaultMTU,
+			Stack:        tun.StackSystem,
+		},
+		Sniffer: RawSniffer{
+			Sniff: []string{"tls", "http"},
+			Ports: []string{"80", "443"},
 		},
+		KeepAliveInterval: 30,
+		ShutdownTimeout:   10,
+		UDPTimeout:        60,
 	}
 
 	if err := yaml.Unmarshal(buf, &rawCfg); err != nil {
@@ -179,9 +464,31 @@ func UnmarshalRawConfig(buf []byte) (*RawConfig, error) {
 }
 
 func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
-	config := &Config{}
+	return parseRawConfig(rawCfg, nil)
+}
+
+func parseRawConfig(rawCfg *RawConfig, base *Config) (*Config, error) {
+	config := &Config{raw: rawCfg}
 
 	config.Experimental = &rawCfg.Experimental
+	config.Profile = &rawCfg.Profile
+
+	if rawCfg.HappyEyeballs.FallbackDelay < 0 {
+		return nil, fmt.Errorf("happy-eyeballs fallback-delay should not be negative")
+	}
+	config.HappyEyeballs = &rawCfg.HappyEyeballs
+
+	geoSite, err := parseGeoSite(rawCfg.GeoSite)
+	if err != nil {
+		return nil, err
+	}
+	config.GeoSite = geoSite
+
+	geoIP, err := parseGeoIP(rawCfg.GeoIP)
+	if err != nil {
+		return nil, err
+	}
+	config.GeoIP = geoIP
 
 	general, err := parseGeneral(rawCfg)
 	if err != nil {
@@ -189,7 +496,19 @@ func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
 	}
 	config.General = general
 
-	proxies, providers, err := parseProxies(rawCfg)
+	tunCfg, err := parseTun(rawCfg.Tun)
+	if err != nil {
+		return nil, err
+	}
+	config.Tun = tunCfg
+
+	snifferCfg, err := parseSniffer(rawCfg.Sniffer)
+	if err != nil {
+		return nil, err
+	}
+	config.Sniffer = snifferCfg
+
+	proxies, providers, err := parseProxies(rawCfg, newReuser(base))
 	if err != nil {
 		return nil, err
 	}
@@ -202,6 +521,12 @@ func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
 	}
 	config.Rules = rules
 
+	database, err := parseDatabase(rawCfg, rules)
+	if err != nil {
+		return nil, err
+	}
+	config.Database = database
+
 	hosts, err := parseHosts(rawCfg)
 	if err != nil {
 		return nil, err
@@ -214,14 +539,230 @@ func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
 	}
 	config.DNS = dnsCfg
 
+	if err := verifyGeoSite(geoSite, rules, dnsCfg); err != nil {
+		return nil, err
+	}
+
 	config.Users = parseAuthentication(rawCfg.Authentication)
 
 	return config, nil
 }
 
+// Database is the resolved paths of the local databases, they're applied
+// with the config. Empty path means the default one.
+type Database struct {
+	ASN      string
+	GeoIP    string
+	SrcGeoIP string
+}
+
+// parseDatabase verifies the databases used by the rules, the loaded
+// databases aren't changed until the config is applied
+func parseDatabase(cfg *RawConfig, rules []C.Rule) (*Database, error) {
+	db := &Database{}
+	if cfg.ASNDatabase != "" {
+		db.ASN = C.Path.Resolve(cfg.ASNDatabase)
+	}
+
+	if cfg.ASNDatabase != "" || hasRuleType(rules, C.IPASN) {
+		if err := mmdb.VerifyASN(db.ASN); err != nil {
+			return nil, fmt.Errorf("asn-database: %w", err)
+		}
+	}
+
+	// GEOIP and SRC-GEOIP rules fall back to each other's database, then
+	// the Country database
+	if cfg.GeoIPDatabase != "" {
+		db.GeoIP = C.Path.Resolve(cfg.GeoIPDatabase)
+		if err := mmdb.VerifyGeoIP(db.GeoIP); err != nil {
+			return nil, fmt.Errorf("geoip-database: %w", err)
+		}
+	}
+	if cfg.SrcGeoIPDatabase != "" {
+		db.SrcGeoIP = C.Path.Resolve(cfg.SrcGeoIPDatabase)
+		if err := mmdb.VerifyGeoIP(db.SrcGeoIP); err != nil {
+			return nil, fmt.Errorf("src-geoip-database: %w", err)
+		}
+	}
+	return db, nil
+}
+
+func hasRuleType(rules []C.Rule, tp C.RuleType) bool {
+	for _, rule := range rules {
+		if R.HasRuleType(rule, tp) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseGeoSite(cfg GeoSite) (*GeoSite, error) {
+	if cfg.Path != "" {
+		cfg.Path = C.Path.Resolve(cfg.Path)
+	}
+
+	if cfg.AutoUpdate && cfg.UpdateInterval <= 0 {
+		return nil, fmt.Errorf("geosite update-interval must be positive")
+	}
+
+	return &cfg, nil
+}
+
+// verifyGeoSite verifies the geosite categories used by the rules, the DNS
+// fallback filter and the nameserver policy against the database of cfg, the
+// loaded database is kept until the config is applied
+func verifyGeoSite(cfg *GeoSite, rules []C.Rule, dnsCfg *DNS) error {
+	codes := []string{}
+	for _, rule := range rules {
+		codes = append(codes, R.GeoSiteCodes(rule)...)
+	}
+	fallbackCodes := dnsCfg.FallbackFilter.GeoSite
+	policyCodes := []string{}
+	for domain := range dnsCfg.NameServerPolicy {
+		if code := strings.TrimPrefix(domain, dns.GeoSitePolicyPrefix); code != domain {
+			policyCodes = append(policyCodes, code)
+		}
+	}
+	if len(codes) == 0 && len(fallbackCodes) == 0 && len(policyCodes) == 0 {
+		return nil
+	}
+
+	site, err := geosite.Load(cfg.Path, cfg.URL)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		if _, err := site.Matcher(code); err != nil {
+			return fmt.Errorf("GEOSITE %s error: %w", code, err)
+		}
+	}
+	for idx, code := range fallbackCodes {
+		if _, err := site.Matcher(code); err != nil {
+			return fmt.Errorf("DNS FallbackGeoSite[%d] %s error: %w", idx, code, err)
+		}
+	}
+	for _, code := range policyCodes {
+		if _, err := site.Matcher(code); err != nil {
+			return fmt.Errorf("DNS NameServerPolicy %s%s error: %w", dns.GeoSitePolicyPrefix, code, err)
+		}
+	}
+	return nil
+}
+
+func parseGeoIP(cfg GeoIP) (*GeoIP, error) {
+	if cfg.AutoUpdate && cfg.UpdateInterval <= 0 {
+		return nil, fmt.Errorf("geoip update-interval must be positive")
+	}
+
+	if cfg.SHA256 != "" {
+		if buf, err := hex.DecodeString(cfg.SHA256); err != nil || len(buf) != sha256.Size {
+			return nil, fmt.Errorf("geoip sha256 format error: %s", cfg.SHA256)
+		}
+		if cfg.AutoUpdate {
+			return nil, fmt.Errorf("geoip sha256 pins the database, auto-update should be disabled")
+		}
+	}
+
+	return &cfg, nil
+}
+
+func parseTun(cfg Tun) (*Tun, error) {
+	if !cfg.Enable {
+		return &cfg, nil
+	}
+
+	if len(cfg.Device) >= 16 {
+		return nil, fmt.Errorf("tun device %s is too long", cfg.Device)
+	}
+
+	ip, _, err := net.ParseCIDR(cfg.Inet4Address)
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("tun inet4-address format error: %s", cfg.Inet4Address)
+	}
+
+	if cfg.Inet6Address != "" {
+		ip, _, err := net.ParseCIDR(cfg.Inet6Address)
+		if err != nil || ip.To4() != nil {
+			return nil, fmt.Errorf("tun inet6-address format error: %s", cfg.Inet6Address)
+		}
+	}
+
+	if cfg.MTU < 576 || cfg.MTU > 65535 {
+		return nil, fmt.Errorf("tun mtu should be between 576 and 65535")
+	}
+
+	switch cfg.Stack {
+	case tun.StackSystem, tun.StackGVisor:
+	default:
+		return nil, fmt.Errorf("tun stack %s is unsupported", cfg.Stack)
+	}
+
+	return &cfg, nil
+}
+
+func parseSniffer(cfg RawSniffer) (*sniffer.Sniffer, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+
+	s, err := sniffer.New(cfg.Sniff, cfg.Ports, cfg.OverrideDestination)
+	if err != nil {
+		return nil, fmt.Errorf("sniffer: %w", err)
+	}
+
+	if len(cfg.BlockQUIC) != 0 {
+		s.BlockQUIC = trie.New()
+		for idx, domain := range cfg.BlockQUIC {
+			normalized, err := normalizeDomain(domain)
+			if err != nil {
+				return nil, fmt.Errorf("sniffer block-quic[%d] format error: %s", idx, err.Error())
+			}
+
+			if err := s.BlockQUIC.Insert(normalized, true); err != nil {
+				return nil, fmt.Errorf("sniffer block-quic[%d] format error: %s", idx, err.Error())
+			}
+		}
+	}
+	return s, nil
+}
+
 func parseGeneral(cfg *RawConfig) (*General, error) {
 	externalUI := cfg.ExternalUI
 
+	if cfg.KeepAliveInterval < 0 || cfg.IdleTimeout < 0 {
+		return nil, fmt.Errorf("keep-alive-interval and idle-timeout should not be negative")
+	}
+	if cfg.ShutdownTimeout < 0 {
+		return nil, fmt.Errorf("shutdown-timeout should not be negative")
+	}
+	if cfg.UDPTimeout <= 0 {
+		return nil, fmt.Errorf("udp-timeout should be positive")
+	}
+	if err := dialer.CheckRoutingMark(int64(cfg.RoutingMark)); err != nil {
+		return nil, fmt.Errorf("routing-mark: %w", err)
+	}
+
+	bindAddress, err := P.ParseBindAddress(cfg.BindAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	inboundBindAddress := map[string][]string{}
+	for inbound, hosts := range cfg.InboundBindAddress {
+		switch inbound {
+		case P.InboundHTTP, P.InboundSocks, P.InboundRedir, P.InboundTProxy, P.InboundMixed:
+		default:
+			return nil, fmt.Errorf("inbound-bind-address: unknown inbound %s", inbound)
+		}
+
+		addrs, err := P.ParseBindAddress(hosts)
+		if err != nil {
+			return nil, fmt.Errorf("inbound-bind-address %s: %w", inbound, err)
+		}
+		inboundBindAddress[inbound] = addrs
+	}
+
 	// checkout externalUI exist
 	if externalUI != "" {
 		externalUI = C.Path.Resolve(externalUI)
@@ -233,27 +774,36 @@ func parseGeneral(cfg *RawConfig) (*General, error) {
 
 	return &General{
 		Inbound: Inbound{
-			Port:        cfg.Port,
-			SocksPort:   cfg.SocksPort,
-			RedirPort:   cfg.RedirPort,
-			TProxyPort:  cfg.TProxyPort,
-			MixedPort:   cfg.MixedPort,
-			AllowLan:    cfg.AllowLan,
-			BindAddress: cfg.BindAddress,
+			Port:               cfg.Port,
+			SocksPort:          cfg.SocksPort,
+			RedirPort:          cfg.RedirPort,
+			TProxyPort:         cfg.TProxyPort,
+			MixedPort:          cfg.MixedPort,
+			AllowLan:           cfg.AllowLan,
+			BindAddress:        bindAddress,
+			InboundBindAddress: inboundBindAddress,
+			TCPFastOpen:        cfg.TCPFastOpen,
 		},
 		Controller: Controller{
 			ExternalController: cfg.ExternalController,
 			ExternalUI:         cfg.ExternalUI,
 			Secret:             cfg.Secret,
+			ExternalMetrics:    cfg.ExternalMetrics,
 		},
-		Mode:      cfg.Mode,
-		LogLevel:  cfg.LogLevel,
-		IPv6:      cfg.IPv6,
-		Interface: cfg.Interface,
+		Mode:        cfg.Mode,
+		LogLevel:    cfg.LogLevel,
+		IPv6:        cfg.IPv6,
+		Interface:   cfg.Interface,
+		RoutingMark: cfg.RoutingMark,
+
+		KeepAliveInterval: cfg.KeepAliveInterval,
+		IdleTimeout:       cfg.IdleTimeout,
+		ShutdownTimeout:   cfg.ShutdownTimeout,
+		UDPTimeout:        cfg.UDPTimeout,
 	}, nil
 }
 
-func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[string]provider.ProxyProvider, err error) {
+func parseProxies(cfg *RawConfig, reuse *reuser) (proxies map[string]C.Proxy, providersMap map[string]provider.ProxyProvider, err error) {
 	proxies = make(map[string]C.Proxy)
 	providersMap = make(map[string]provider.ProxyProvider)
 	proxyList := []string{}
@@ -263,13 +813,18 @@ func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[
 
 	proxies["DIRECT"] = outbound.NewProxy(outbound.NewDirect())
 	proxies["REJECT"] = outbound.NewProxy(outbound.NewReject())
-	proxyList = append(proxyList, "DIRECT", "REJECT")
+	proxies["REJECT-DROP"] = outbound.NewProxy(outbound.NewRejectDrop())
+	proxyList = append(proxyList, "DIRECT", "REJECT", "REJECT-DROP")
+	reuse.builtin(proxies, "DIRECT", "REJECT", "REJECT-DROP")
 
 	// parse proxy
 	for idx, mapping := range proxiesConfig {
-		proxy, err := outbound.ParseProxy(mapping)
-		if err != nil {
-			return nil, nil, fmt.Errorf("proxy %d: %w", idx, err)
+		proxy, reused := reuse.proxy(mapping)
+		if !reused {
+			var err error
+			if proxy, err = outbound.ParseProxy(mapping); err != nil {
+				return nil, nil, fmt.Errorf("proxy %d: %w", idx, err)
+			}
 		}
 
 		if _, exist := proxies[proxy.Name()]; exist {
@@ -293,12 +848,19 @@ func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[
 		return nil, nil, err
 	}
 
-	// parse and initial providers
+	// parse and initial providers, the reused ones are initialized already
+	reusedProviders := map[string]bool{}
 	for name, mapping := range providersConfig {
 		if name == provider.ReservedName {
 			return nil, nil, fmt.Errorf("can not defined a provider called `%s`", provider.ReservedName)
 		}
 
+		if pd, reused := reuse.provider(name, mapping); reused {
+			providersMap[name] = pd
+			reusedProviders[name] = true
+			continue
+		}
+
 		pd, err := provider.ParseProxyProvider(name, mapping)
 		if err != nil {
 			return nil, nil, fmt.Errorf("parse proxy provider %s error: %w", name, err)
@@ -308,6 +870,10 @@ func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[
 	}
 
 	for _, provider := range providersMap {
+		if reusedProviders[provider.Name()] {
+			continue
+		}
+
 		log.Infoln("Start initial provider %s", provider.Name())
 		if err := provider.Initial(); err != nil {
 			return nil, nil, fmt.Errorf("initial proxy provider %s error: %w", provider.Name(), err)
@@ -316,6 +882,19 @@ func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[
 
 	// parse proxy group
 	for idx, mapping := range groupsConfig {
+		if group, pd, reused := reuse.group(mapping); reused {
+			if _, exist := proxies[group.Name()]; exist {
+				return nil, nil, fmt.Errorf("proxy group %s: the duplicate name", group.Name())
+			}
+
+			proxies[group.Name()] = group
+			if pd != nil {
+				providersMap[pd.Name()] = pd
+				reusedProviders[pd.Name()] = true
+			}
+			continue
+		}
+
 		group, err := outboundgroup.ParseProxyGroup(mapping, proxies, providersMap)
 		if err != nil {
 			return nil, nil, fmt.Errorf("proxy group[%d]: %w", idx, err)
@@ -331,7 +910,7 @@ func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[
 
 	// initial compatible provider
 	for _, pd := range providersMap {
-		if pd.VehicleType() != provider.Compatible {
+		if pd.VehicleType() != provider.Compatible || reusedProviders[pd.Name()] {
 			continue
 		}
 
@@ -345,7 +924,7 @@ func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[
 	for _, v := range proxyList {
 		ps = append(ps, proxies[v])
 	}
-	hc := provider.NewHealthCheck(ps, "", 0, true)
+	hc := provider.NewHealthCheck(ps, "", 0, true, nil)
 	pd, _ := provider.NewCompatibleProvider(provider.ReservedName, ps, hc)
 	providersMap[provider.ReservedName] = pd
 
@@ -363,66 +942,196 @@ func parseRules(cfg *RawConfig, proxies map[string]C.Proxy) ([]C.Rule, error) {
 	rules := []C.Rule{}
 	rulesConfig := cfg.Rule
 
+	scripts, err := parseScripts(cfg, proxies)
+	if err != nil {
+		return nil, err
+	}
+
 	// parse rules
 	for idx, line := range rulesConfig {
-		rule := trimArr(strings.Split(line, ","))
-		var (
-			payload string
-			target  string
-			params  = []string{}
-		)
-
-		switch l := len(rule); {
-		case l == 2:
-			target = rule[1]
-		case l == 3:
-			payload = rule[1]
-			target = rule[2]
-		case l >= 4:
-			payload = rule[1]
-			target = rule[2]
-			params = rule[3:]
-		default:
-			return nil, fmt.Errorf("rules[%d] [%s] error: format invalid", idx, line)
+		parsed, err := parseRule(line, proxies, scripts)
+		if err != nil {
+			if err == R.ErrPlatformNotSupport {
+				log.Warnln("Rules[%d] [%s] don't support current OS, skip", idx, line)
+				continue
+			}
+			return nil, fmt.Errorf("rules[%d] [%s] error: %s", idx, line, err.Error())
 		}
 
-		if _, ok := proxies[target]; !ok {
-			return nil, fmt.Errorf("rules[%d] [%s] error: proxy [%s] not found", idx, line, target)
+		rules = append(rules, parsed)
+	}
+
+	return rules, nil
+}
+
+// ParseRule parses a rule line at runtime, the target should be one of
+// proxies. SCRIPT rules aren't supported, the scripts are compiled with the
+// config.
+func ParseRule(line string, proxies map[string]C.Proxy) (C.Rule, error) {
+	if tp := strings.TrimSpace(strings.SplitN(line, ",", 2)[0]); tp == "SCRIPT" {
+		return nil, errors.New("SCRIPT rule can't be added at runtime")
+	}
+	rule, err := parseRule(line, proxies, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rule uses the loaded databases
+	if R.HasRuleType(rule, C.IPASN) {
+		if _, err := mmdb.ASNInstance(); err != nil {
+			return nil, err
+		}
+	}
+	if codes := R.GeoSiteCodes(rule); len(codes) > 0 {
+		site, err := geosite.Instance()
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range codes {
+			if _, err := site.Matcher(code); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rule, nil
+}
+
+// parseRule returns R.ErrPlatformNotSupport if the rule isn't supported on
+// this platform
+func parseRule(line string, proxies map[string]C.Proxy, scripts map[string]*R.Script) (C.Rule, error) {
+	var rule []string
+	if tp := strings.SplitN(line, ",", 2)[0]; R.IsLogic(strings.TrimSpace(tp)) {
+		fields, err := R.SplitLogic(line)
+		if err != nil {
+			return nil, err
 		}
+		rule = trimArr(fields)
+	} else {
+		rule = trimArr(strings.Split(line, ","))
+	}
 
-		rule = trimArr(rule)
-		params = trimArr(params)
+	// the ports of port rules and the CIDRs of CIDR rules may be separated by
+	// comma too
+	var isListItem func(string) bool
+	if len(rule) > 0 {
+		switch rule[0] {
+		case "SRC-PORT", "DST-PORT":
+			isListItem = R.IsPortPayload
+		case "IP-CIDR", "IP-CIDR6", "SRC-IP-CIDR":
+			isListItem = R.IsIPCIDRPayload
+		}
+	}
+	if isListItem != nil {
+		for len(rule) > 3 && isListItem(rule[2]) {
+			if _, ok := proxies[rule[2]]; ok {
+				break
+			}
+			rule = append([]string{rule[0], rule[1] + "," + rule[2]}, rule[3:]...)
+		}
+	}
 
-		parsed, parseErr := R.ParseRule(rule[0], payload, target, params)
-		if parseErr != nil {
-			if parseErr == R.ErrPlatformNotSupport {
-				log.Warnln("Rules[%d] [%s] don't support current OS, skip", idx, line)
+	// the policy of SCRIPT is returned by the script, e.g. SCRIPT,name,no-resolve
+	if len(rule) > 0 && rule[0] == "SCRIPT" {
+		if len(rule) < 2 {
+			return nil, errors.New("format invalid")
+		}
+		script, ok := scripts[rule[1]]
+		if !ok {
+			return nil, fmt.Errorf("script [%s] not found", rule[1])
+		}
+		if script == nil {
+			return nil, R.ErrPlatformNotSupport
+		}
+		if R.HasNoResolve(rule[2:]) {
+			script = script.WithNoResolve()
+		}
+		mark, err := R.ParseRoutingMark(rule[2:])
+		if err != nil {
+			return nil, err
+		}
+		return R.WithRoutingMark(script, mark), nil
+	}
+
+	var (
+		payload string
+		target  string
+		params  = []string{}
+	)
+
+	switch l := len(rule); {
+	case l == 2:
+		target = rule[1]
+	case l == 3:
+		payload = rule[1]
+		target = rule[2]
+	case l >= 4:
+		payload = rule[1]
+		target = rule[2]
+		params = rule[3:]
+	default:
+		return nil, errors.New("format invalid")
+	}
+
+	if _, ok := proxies[target]; !ok {
+		return nil, fmt.Errorf("proxy [%s] not found", target)
+	}
+
+	rule = trimArr(rule)
+	params = trimArr(params)
+
+	return R.ParseRule(rule[0], payload, target, params)
+}
+
+// parseScripts compiles the scripts of SCRIPT rules, the script is nil if
+// it isn't supported on this platform
+func parseScripts(cfg *RawConfig, proxies map[string]C.Proxy) (map[string]*R.Script, error) {
+	scripts := map[string]*R.Script{}
+	for name, src := range cfg.Script {
+		script, err := R.NewScript(name, src)
+		if err != nil {
+			if err == R.ErrPlatformNotSupport {
+				scripts[name] = nil
 				continue
 			}
-			return nil, fmt.Errorf("rules[%d] [%s] error: %s", idx, line, parseErr.Error())
+			return nil, fmt.Errorf("scripts[%s] error: %s", name, err.Error())
 		}
 
-		rules = append(rules, parsed)
+		for _, policy := range script.Policies() {
+			if _, ok := proxies[policy]; !ok {
+				return nil, fmt.Errorf("scripts[%s] error: proxy [%s] not found", name, policy)
+			}
+		}
+		scripts[name] = script
 	}
 
-	return rules, nil
+	return scripts, nil
 }
 
 func parseHosts(cfg *RawConfig) (*trie.DomainTrie, error) {
 	tree := trie.New()
 
 	// add default hosts
-	if err := tree.Insert("localhost", net.IP{127, 0, 0, 1}); err != nil {
+	if err := tree.Insert("localhost", &resolver.HostValue{IPs: []net.IP{{127, 0, 0, 1}}}); err != nil {
 		log.Errorln("insert localhost to host error: %s", err.Error())
 	}
 
-	if len(cfg.Hosts) != 0 {
-		for domain, ipStr := range cfg.Hosts {
-			ip := net.ParseIP(ipStr)
-			if ip == nil {
-				return nil, fmt.Errorf("%s is not a valid IP", ipStr)
-			}
-			tree.Insert(domain, ip)
+	for domain, raw := range cfg.Hosts {
+		value, err := resolver.NewHostValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("hosts[%s] error: %w", domain, err)
+		}
+		if err := tree.Insert(domain, value); err != nil {
+			return nil, fmt.Errorf("hosts[%s] error: %w", domain, err)
+		}
+	}
+
+	// the wildcard domains are checked by lookup only
+	for domain := range cfg.Hosts {
+		if strings.ContainsAny(domain, "*+") || strings.HasPrefix(domain, ".") {
+			continue
+		}
+		if _, _, found := resolver.LookupHosts(tree, domain); !found {
+			return nil, fmt.Errorf("hosts[%s] error: aliases loop or are too deep", domain)
 		}
 	}
 
@@ -446,10 +1155,11 @@ func hostWithDefaultPort(host string, defPort string) (string, error) {
 	return net.JoinHostPort(hostname, port), nil
 }
 
-func parseNameServer(servers []string) ([]dns.NameServer, error) {
+func parseNameServer(servers []RawNameServer) ([]dns.NameServer, error) {
 	nameservers := []dns.NameServer{}
 
-	for idx, server := range servers {
+	for idx, raw := range servers {
+		server := raw.URL
 		// parse without scheme .e.g 8.8.8.8:53
 		if !strings.Contains(server, "://") {
 			server = "udp://" + server
@@ -474,6 +1184,10 @@ func parseNameServer(servers []string) ([]dns.NameServer, error) {
 			clearURL := url.URL{Scheme: "https", Host: u.Host, Path: u.Path}
 			addr = clearURL.String()
 			dnsNetType = "https" // DNS over HTTPS
+		case "h3":
+			clearURL := url.URL{Scheme: "https", Host: u.Host, Path: u.Path}
+			addr = clearURL.String()
+			dnsNetType = "h3" // DNS over HTTPS over HTTP/3
 		default:
 			return nil, fmt.Errorf("DNS NameServer[%d] unsupport scheme: %s", idx, u.Scheme)
 		}
@@ -482,13 +1196,55 @@ func parseNameServer(servers []string) ([]dns.NameServer, error) {
 			return nil, fmt.Errorf("DNS NameServer[%d] format error: %s", idx, err.Error())
 		}
 
-		nameservers = append(
-			nameservers,
-			dns.NameServer{
-				Net:  dnsNetType,
-				Addr: addr,
-			},
-		)
+		nameserver := dns.NameServer{
+			Net:  dnsNetType,
+			Addr: addr,
+		}
+
+		if raw.Method != "" || len(raw.Headers) != 0 {
+			if dnsNetType != "https" && dnsNetType != "h3" {
+				return nil, fmt.Errorf("DNS NameServer[%d] method and headers are only for DoH", idx)
+			}
+
+			switch method := strings.ToUpper(raw.Method); method {
+			case "", http.MethodPost, http.MethodGet:
+				nameserver.Method = method
+			default:
+				return nil, fmt.Errorf("DNS NameServer[%d] unsupported method: %s", idx, raw.Method)
+			}
+
+			if len(raw.Headers) != 0 {
+				nameserver.Headers = http.Header{}
+				for key, value := range raw.Headers {
+					nameserver.Headers.Set(key, value)
+				}
+			}
+		}
+
+		if raw.ClientFingerprint != "" || raw.TLSMinVersion != "" {
+			if dnsNetType != "https" && dnsNetType != "tcp-tls" {
+				return nil, fmt.Errorf("DNS NameServer[%d] client-fingerprint and tls-min-version are only for DoH and DoT", idx)
+			}
+
+			if nameserver.Fingerprint, err = tlsC.ParseFingerprint(raw.ClientFingerprint); err != nil {
+				return nil, fmt.Errorf("DNS NameServer[%d] %w", idx, err)
+			}
+			if nameserver.MinVersion, err = tlsC.ParseVersion(raw.TLSMinVersion); err != nil {
+				return nil, fmt.Errorf("DNS NameServer[%d] %w", idx, err)
+			}
+		}
+
+		if raw.Padding != 0 {
+			if dnsNetType != "https" && dnsNetType != "h3" && dnsNetType != "tcp-tls" {
+				return nil, fmt.Errorf("DNS NameServer[%d] padding is only for DoH and DoT", idx)
+			}
+			if raw.Padding < 0 || raw.Padding > 0xffff {
+				return nil, fmt.Errorf("DNS NameServer[%d] invalid padding: %d", idx, raw.Padding)
+			}
+			nameserver.Padding = raw.Padding
+		}
+
+		nameservers = append(nameservers, nameserver)
 	}
 	return nameservers, nil
 }
@@ -520,6 +1276,40 @@ func parseDNS(cfg RawDNS, hosts *trie.DomainTrie) (*DNS, error) {
 		FallbackFilter: FallbackFilter{
 			IPCIDR: []*net.IPNet{},
 		},
+		CacheTTL: dns.CacheTTL{
+			Min:         cfg.CacheMinTTL,
+			Max:         cfg.CacheMaxTTL,
+			NegativeMax: cfg.NegativeCacheTTL,
+		},
+		Strategy:        cfg.Strategy,
+		UpstreamTimeout: time.Duration(cfg.UpstreamTimeout) * time.Millisecond,
+		Prefetch: dns.Prefetch{
+			Enable:      cfg.Prefetch.Enable,
+			Threshold:   time.Duration(cfg.Prefetch.Threshold) * time.Second,
+			MinHits:     cfg.Prefetch.MinHits,
+			Concurrency: cfg.Prefetch.Concurrency,
+		},
+		QueryLog: dns.QueryLog{
+			Enable: cfg.QueryLog.Enable,
+		},
+		DoTPool: dns.DoTPool{
+			Size:        cfg.DoTPool.Size,
+			IdleTimeout: time.Duration(cfg.DoTPool.IdleTimeout) * time.Second,
+		},
+	}
+
+	if cfg.QueryLog.File != "" {
+		dnsCfg.QueryLog.File = C.Path.Resolve(cfg.QueryLog.File)
+	}
+
+	if dnsCfg.CacheTTL.Max != 0 && dnsCfg.CacheTTL.Min > dnsCfg.CacheTTL.Max {
+		return nil, errors.New("DNS cache-min-ttl should not be greater than cache-max-ttl")
+	}
+	if cfg.Prefetch.Enable && (cfg.Prefetch.Threshold <= 0 || cfg.Prefetch.Concurrency <= 0) {
+		return nil, errors.New("DNS prefetch threshold and concurrency should be positive")
+	}
+	if cfg.DoTPool.Size <= 0 || cfg.DoTPool.IdleTimeout <= 0 {
+		return nil, errors.New("DNS dot-pool size and idle-timeout should be positive")
 	}
 	var err error
 	if dnsCfg.NameServer, err = parseNameServer(cfg.NameServer); err != nil {
@@ -530,6 +1320,22 @@ func parseDNS(cfg RawDNS, hosts *trie.DomainTrie) (*DNS, error) {
 		return nil, err
 	}
 
+	if dnsCfg.DirectNameServer, err = parseNameServer(cfg.DirectNameServer); err != nil {
+		return nil, err
+	}
+
+	if dnsCfg.NameServerGroup, err = parseNameServerGroup(cfg.NameServerGroup); err != nil {
+		return nil, err
+	}
+
+	if dnsCfg.NameServerPolicy, err = parseNameServerPolicy(cfg.NameServerPolicy, dnsCfg.NameServerGroup); err != nil {
+		return nil, err
+	}
+
+	if dnsCfg.Rewrites, err = parseRewrite(cfg.Rewrite); err != nil {
+		return nil, err
+	}
+
 	if len(cfg.DefaultNameserver) == 0 {
 		return nil, errors.New("default nameserver should have at least one nameserver")
 	}
@@ -554,12 +1360,26 @@ func parseDNS(cfg RawDNS, hosts *trie.DomainTrie) (*DNS, error) {
 		// fake ip skip host filter
 		if len(cfg.FakeIPFilter) != 0 {
 			host = trie.New()
-			for _, domain := range cfg.FakeIPFilter {
-				host.Insert(domain, true)
+			for idx, domain := range cfg.FakeIPFilter {
+				normalized, err := normalizeDomain(domain)
+				if err != nil {
+					return nil, fmt.Errorf("DNS FakeIPFilter[%d] format error: %s", idx, err.Error())
+				}
+
+				if err := host.Insert(normalized, true); err != nil {
+					return nil, fmt.Errorf("DNS FakeIPFilter[%d] format error: %s", idx, err.Error())
+				}
+			}
+		}
+
+		var ipnet6 *net.IPNet
+		if cfg.FakeIPRange6 != "" {
+			if _, ipnet6, err = net.ParseCIDR(cfg.FakeIPRange6); err != nil {
+				return nil, err
 			}
 		}
 
-		pool, err := fakeip.New(ipnet, 1000, host)
+		pool, err := fakeip.NewWithIPv6(ipnet, ipnet6, 1000, host)
 		if err != nil {
 			return nil, err
 		}
@@ -567,11 +1387,17 @@ func parseDNS(cfg RawDNS, hosts *trie.DomainTrie) (*DNS, error) {
 		dnsCfg.FakeIPRange = pool
 	}
 
+	if dnsCfg.ECS, err = parseECS(cfg.ECS); err != nil {
+		return nil, err
+	}
+
 	dnsCfg.FallbackFilter.GeoIP = cfg.FallbackFilter.GeoIP
 	if fallbackip, err := parseFallbackIPCIDR(cfg.FallbackFilter.IPCIDR); err == nil {
 		dnsCfg.FallbackFilter.IPCIDR = fallbackip
 	}
 	dnsCfg.FallbackFilter.Domain = cfg.FallbackFilter.Domain
+	dnsCfg.FallbackFilter.GeoSite = cfg.FallbackFilter.GeoSite
+	dnsCfg.FallbackFilter.Mode = cfg.FallbackFilter.Mode
 
 	if cfg.UseHosts {
 		dnsCfg.Hosts = hosts
@@ -580,6 +1406,128 @@ func parseDNS(cfg RawDNS, hosts *trie.DomainTrie) (*DNS, error) {
 	return dnsCfg, nil
 }
 
+func parseRewrite(rawRules []RawRewriteRule) ([]dns.RewriteRule, error) {
+	rules := []dns.RewriteRule{}
+	// only used to validate the domain patterns
+	tree := trie.New()
+
+	for idx, raw := range rawRules {
+		normalized, err := normalizeDomain(raw.Name)
+		if err != nil {
+			return nil, fmt.Errorf("DNS Rewrite[%d] format error: %s", idx, err.Error())
+		}
+		if err := tree.Insert(normalized, struct{}{}); err != nil {
+			return nil, fmt.Errorf("DNS Rewrite[%d] format error: %s", idx, err.Error())
+		}
+
+		rule := dns.RewriteRule{
+			Name:   normalized,
+			Type:   raw.Type,
+			Answer: raw.Answer,
+			CNAME:  raw.CNAME,
+			Rcode:  raw.Rcode,
+			TTL:    raw.TTL,
+		}
+		if err := dns.VerifyRewriteRule(rule); err != nil {
+			return nil, fmt.Errorf("DNS Rewrite[%d] %s: %w", idx, raw.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func parseNameServerGroup(rawGroups map[string]RawNameServerGroup) (map[string]dns.NameServerGroup, error) {
+	groups := map[string]dns.NameServerGroup{}
+
+	for name, raw := range rawGroups {
+		if len(raw.NameServer) == 0 {
+			return nil, fmt.Errorf("DNS NameServerGroup %s should have at least one nameserver", name)
+		}
+
+		nameservers, err := parseNameServer(raw.NameServer)
+		if err != nil {
+			return nil, fmt.Errorf("DNS NameServerGroup %s: %w", name, err)
+		}
+
+		group := dns.NameServerGroup{
+			NameServer: nameservers,
+			Timeout:    time.Duration(raw.Timeout) * time.Millisecond,
+		}
+
+		switch raw.Strategy {
+		case "", "parallel":
+		case "failover":
+			group.Failover = true
+		default:
+			return nil, fmt.Errorf("DNS NameServerGroup %s unsupported strategy: %s", name, raw.Strategy)
+		}
+
+		if raw.Timeout < 0 {
+			return nil, fmt.Errorf("DNS NameServerGroup %s timeout should not be negative", name)
+		}
+
+		groups[name] = group
+	}
+
+	return groups, nil
+}
+
+// parseNameServerPolicy returns domain --> group name, a policy to a
+// nameserver instead of a group adds a group of the nameserver to groups. A
+// geosite:code key is kept, its category is verified by verifyGeoSite.
+func parseNameServerPolicy(nsPolicy map[string]string, groups map[string]dns.NameServerGroup) (map[string]string, error) {
+	policy := map[string]string{}
+	// only used to validate the domain patterns
+	tree := trie.New()
+
+	for domain, server := range nsPolicy {
+		normalized := domain
+		if code := strings.TrimPrefix(domain, dns.GeoSitePolicyPrefix); code != domain {
+			if code == "" {
+				return nil, fmt.Errorf("DNS NameServerPolicy %s format error: empty geosite category", domain)
+			}
+		} else {
+			var err error
+			if normalized, err = normalizeDomain(domain); err != nil {
+				return nil, fmt.Errorf("DNS NameServerPolicy %s format error: %s", domain, err.Error())
+			}
+
+			if err := tree.Insert(normalized, struct{}{}); err != nil {
+				return nil, fmt.Errorf("DNS NameServerPolicy %s format error: %s", domain, err.Error())
+			}
+		}
+
+		if _, ok := groups[server]; !ok {
+			nameservers, err := parseNameServer([]RawNameServer{{URL: server}})
+			if err != nil {
+				return nil, fmt.Errorf("DNS NameServerPolicy %s: %w", domain, err)
+			}
+			groups[server] = dns.NameServerGroup{NameServer: nameservers}
+		}
+
+		policy[normalized] = server
+	}
+
+	return policy, nil
+}
+
+func parseECS(ecs string) (*dns.ECS, error) {
+	switch ecs {
+	case "":
+		return nil, nil
+	case "auto":
+		return &dns.ECS{Auto: true}, nil
+	}
+
+	_, ipnet, err := net.ParseCIDR(ecs)
+	if err != nil {
+		return nil, fmt.Errorf("DNS ECS format error: %w", err)
+	}
+
+	return &dns.ECS{Subnet: ipnet}, nil
+}
+
 func parseAuthentication(rawRecords []string) []auth.AuthUser {
 	users := make([]auth.AuthUser, 0)
 	for _, line := range rawRecords {
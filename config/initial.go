@@ -3,16 +3,17 @@ package config
 import (
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"time"
 
+	"github.com/Dreamacro/clash/component/dialer"
 	"github.com/Dreamacro/clash/component/mmdb"
 	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/log"
 )
 
 func downloadMMDB(path string) (err error) {
-	resp, err := http.Get("https://github.com/Dreamacro/maxmind-geoip/releases/latest/download/Country.mmdb")
+	resp, err := dialer.NewHTTPClient(time.Minute).Get(mmdb.DefaultURL)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"reflect"
+
+	"github.com/Dreamacro/clash/adapters/outboundgroup"
+	"github.com/Dreamacro/clash/adapters/provider"
+	"github.com/Dreamacro/clash/common/structure"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+// reuser looks up the proxies, groups and providers of the base config whose
+// configuration is unchanged, a nil reuser reuses nothing
+type reuser struct {
+	base      *Config
+	proxies   map[string]map[string]interface{}
+	groups    map[string]map[string]interface{}
+	providers map[string]map[string]interface{}
+
+	// names of the reused proxies (including groups) and providers
+	reusedProxies   map[string]bool
+	reusedProviders map[string]bool
+}
+
+func newReuser(base *Config) *reuser {
+	if base == nil || base.raw == nil {
+		return nil
+	}
+
+	r := &reuser{
+		base:            base,
+		proxies:         map[string]map[string]interface{}{},
+		groups:          map[string]map[string]interface{}{},
+		providers:       base.raw.ProxyProvider,
+		reusedProxies:   map[string]bool{},
+		reusedProviders: map[string]bool{},
+	}
+	for _, mapping := range base.raw.Proxy {
+		if name, ok := mapping["name"].(string); ok {
+			r.proxies[name] = mapping
+		}
+	}
+	for _, mapping := range base.raw.ProxyGroup {
+		if name, ok := mapping["name"].(string); ok {
+			r.groups[name] = mapping
+		}
+	}
+	return r
+}
+
+// builtin replaces the built-in proxies with the ones of base
+func (r *reuser) builtin(proxies map[string]C.Proxy, names ...string) {
+	if r == nil {
+		return
+	}
+
+	for _, name := range names {
+		if old, ok := r.base.Proxies[name]; ok {
+			proxies[name] = old
+			r.reusedProxies[name] = true
+		}
+	}
+}
+
+func (r *reuser) proxy(mapping map[string]interface{}) (C.Proxy, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	name, _ := mapping["name"].(string)
+	old, ok := r.base.Proxies[name]
+	if !ok || !reflect.DeepEqual(r.proxies[name], mapping) {
+		return nil, false
+	}
+
+	r.reusedProxies[name] = true
+	return old, true
+}
+
+func (r *reuser) provider(name string, mapping map[string]interface{}) (provider.ProxyProvider, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	old, ok := r.base.Providers[name]
+	if !ok || !reflect.DeepEqual(r.providers[name], mapping) {
+		return nil, false
+	}
+
+	r.reusedProviders[name] = true
+	return old, true
+}
+
+// group returns the group of base if its configuration is unchanged and all
+// of its proxies and providers are reused, the provider of its proxies is
+// returned as well if it has one
+func (r *reuser) group(mapping map[string]interface{}) (C.Proxy, provider.ProxyProvider, bool) {
+	if r == nil {
+		return nil, nil, false
+	}
+
+	name, _ := mapping["name"].(string)
+	old, ok := r.base.Proxies[name]
+	if !ok || !reflect.DeepEqual(r.groups[name], mapping) {
+		return nil, nil, false
+	}
+
+	decoder := structure.NewDecoder(structure.Option{TagName: "group", WeaklyTypedInput: true})
+	option := &outboundgroup.GroupCommonOption{}
+	if err := decoder.Decode(mapping, option); err != nil {
+		return nil, nil, false
+	}
+	for _, proxy := range option.Proxies {
+		if !r.reusedProxies[proxy] {
+			return nil, nil, false
+		}
+	}
+	for _, pd := range option.Use {
+		if !r.reusedProviders[pd] {
+			return nil, nil, false
+		}
+	}
+
+	r.reusedProxies[name] = true
+
+	// only the group with proxies and without providers has its own provider
+	if len(option.Proxies) == 0 || len(option.Use) != 0 {
+		return old, nil, true
+	}
+	return old, r.base.Providers[name], true
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapters/outbound"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule_CIDRList(t *testing.T) {
+	proxies := map[string]C.Proxy{"PROXY": outbound.NewProxy(outbound.NewDirect())}
+
+	tests := []struct {
+		line      string
+		payload   string
+		resolve   bool
+		match     []string
+		mismatch  []string
+		isSrcRule bool
+	}{
+		{
+			line:      "SRC-IP-CIDR,192.168.0.0/16,10.0.0.0/8,PROXY",
+			payload:   "192.168.0.0/16,10.0.0.0/8",
+			match:     []string{"192.168.1.1", "10.1.2.3"},
+			mismatch:  []string{"172.16.0.1"},
+			isSrcRule: true,
+		},
+		{
+			line:      "SRC-IP-CIDR, 192.168.0.0/16, 10.0.0.0/8, PROXY, no-resolve",
+			payload:   "192.168.0.0/16,10.0.0.0/8",
+			match:     []string{"10.1.2.3"},
+			mismatch:  []string{"11.0.0.1"},
+			isSrcRule: true,
+		},
+		{
+			line:     "IP-CIDR,1.0.0.0/8,2.0.0.0/8,PROXY,no-resolve",
+			payload:  "1.0.0.0/8,2.0.0.0/8",
+			match:    []string{"1.1.1.1", "2.2.2.2"},
+			mismatch: []string{"3.3.3.3"},
+		},
+		{
+			line:     "IP-CIDR6,2001:db8::/32,2001:db9::/32,PROXY",
+			payload:  "2001:db8::/32,2001:db9::/32",
+			resolve:  true,
+			match:    []string{"2001:db9::1"},
+			mismatch: []string{"2001:dba::1"},
+		},
+		{
+			line:    "IP-CIDR,1.0.0.0/8,PROXY",
+			payload: "1.0.0.0/8",
+			resolve: true,
+			match:   []string{"1.1.1.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		rule, err := parseRule(tt.line, proxies, nil)
+		require.NoError(t, err, tt.line)
+		assert.Equal(t, tt.payload, rule.Payload(), tt.line)
+		assert.Equal(t, "PROXY", rule.Adapter(), tt.line)
+		assert.Equal(t, tt.resolve, rule.ShouldResolveIP(), tt.line)
+
+		metadata := func(ip string) *C.Metadata {
+			if tt.isSrcRule {
+				return &C.Metadata{SrcIP: net.ParseIP(ip)}
+			}
+			return &C.Metadata{DstIP: net.ParseIP(ip)}
+		}
+		for _, ip := range tt.match {
+			assert.True(t, rule.Match(metadata(ip)), "%s %s", tt.line, ip)
+		}
+		for _, ip := range tt.mismatch {
+			assert.False(t, rule.Match(metadata(ip)), "%s %s", tt.line, ip)
+		}
+	}
+
+	_, err := parseRule("SRC-IP-CIDR,192.168.0.0/16,bad,PROXY", proxies, nil)
+	assert.Error(t, err)
+}
+
+func TestParseRule_SrcGEOIP(t *testing.T) {
+	proxies := map[string]C.Proxy{"PROXY": outbound.NewProxy(outbound.NewDirect())}
+
+	rule, err := parseRule("SRC-GEOIP,CN,PROXY", proxies, nil)
+	require.NoError(t, err)
+	assert.Equal(t, C.SrcGEOIP, rule.RuleType())
+	assert.Equal(t, "CN", rule.Payload())
+	assert.False(t, rule.ShouldResolveIP())
+	assert.False(t, rule.Match(&C.Metadata{DstIP: net.ParseIP("1.1.1.1")}))
+}
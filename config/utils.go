@@ -6,6 +6,8 @@ import (
 
 	"github.com/Dreamacro/clash/adapters/outboundgroup"
 	"github.com/Dreamacro/clash/common/structure"
+
+	"golang.org/x/net/idna"
 )
 
 func trimArr(arr []string) (r []string) {
@@ -15,6 +17,12 @@ func trimArr(arr []string) (r []string) {
 	return
 }
 
+// normalizeDomain lowercases the domain and converts unicode labels to punycode,
+// so that it can be matched against the names carried in DNS queries
+func normalizeDomain(domain string) (string, error) {
+	return idna.ToASCII(strings.ToLower(strings.TrimSpace(domain)))
+}
+
 // Check if ProxyGroups form DAG(Directed Acyclic Graph), and sort all ProxyGroups by dependency order.
 // Meanwhile, record the original index in the config file.
 // If loop is detected, return an error with location of loop.
@@ -52,7 +60,7 @@ func proxyGroupsDagSort(groupsConfig []map[string]interface{}) error {
 			graph[groupName] = &graphNode{0, -1, mapping, 0, option, nil}
 		}
 
-		for _, proxy := range option.Proxies {
+		for _, proxy := range option.Dependencies() {
 			if node, ex := graph[proxy]; ex {
 				node.indegree++
 			} else {
@@ -77,12 +85,12 @@ func proxyGroupsDagSort(groupsConfig []map[string]interface{}) error {
 		if node.option != nil {
 			index++
 			groupsConfig[len(groupsConfig)-index] = node.data
-			if len(node.option.Proxies) == 0 {
+			if len(node.option.Dependencies()) == 0 {
 				delete(graph, name)
 				continue
 			}
 
-			for _, proxy := range node.option.Proxies {
+			for _, proxy := range node.option.Dependencies() {
 				child := graph[proxy]
 				child.indegree--
 				if child.indegree == 0 {
@@ -105,11 +113,11 @@ func proxyGroupsDagSort(groupsConfig []map[string]interface{}) error {
 			continue
 		}
 
-		if len(node.option.Proxies) == 0 {
+		if len(node.option.Dependencies()) == 0 {
 			continue
 		}
 
-		for _, proxy := range node.option.Proxies {
+		for _, proxy := range node.option.Dependencies() {
 			node.outdegree++
 			child := graph[proxy]
 			if child.from == nil {
@@ -11,6 +11,7 @@ import (
 const (
 	Direct AdapterType = iota
 	Reject
+	RejectDrop
 
 	Shadowsocks
 	ShadowsocksR
@@ -19,6 +20,10 @@ const (
 	Http
 	Vmess
 	Trojan
+	Vless
+	WireGuard
+	Ssh
+	Hysteria2
 
 	Relay
 	Selector
@@ -66,6 +71,8 @@ type ProxyAdapter interface {
 	Name() string
 	Type() AdapterType
 	StreamConn(c net.Conn, metadata *Metadata) (net.Conn, error)
+	// StreamPacketConn transports UDP to metadata over c, which is the stream to the proxy server
+	StreamPacketConn(c net.Conn, metadata *Metadata) (PacketConn, error)
 	DialContext(ctx context.Context, metadata *Metadata) (Conn, error)
 	DialUDP(metadata *Metadata) (PacketConn, error)
 	SupportUDP() bool
@@ -86,7 +93,7 @@ type Proxy interface {
 	DelayHistory() []DelayHistory
 	Dial(metadata *Metadata) (Conn, error)
 	LastDelay() uint16
-	URLTest(ctx context.Context, url string) (uint16, error)
+	URLTest(ctx context.Context, url string, expect *HealthCheckExpect) (uint16, error)
 }
 
 // AdapterType is enum of adapter type
@@ -98,6 +105,8 @@ func (at AdapterType) String() string {
 		return "Direct"
 	case Reject:
 		return "Reject"
+	case RejectDrop:
+		return "RejectDrop"
 
 	case Shadowsocks:
 		return "Shadowsocks"
@@ -113,6 +122,14 @@ func (at AdapterType) String() string {
 		return "Vmess"
 	case Trojan:
 		return "Trojan"
+	case Vless:
+		return "Vless"
+	case WireGuard:
+		return "WireGuard"
+	case Ssh:
+		return "Ssh"
+	case Hysteria2:
+		return "Hysteria2"
 
 	case Relay:
 		return "Relay"
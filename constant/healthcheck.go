@@ -0,0 +1,84 @@
+package constant
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusRange is an inclusive range of http status code
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// HealthCheckExpect describes a healthy response of the health check url,
+// a nil HealthCheckExpect accepts any response
+type HealthCheckExpect struct {
+	Status []StatusRange
+	Body   string
+}
+
+// ParseHealthCheckExpect parses status like `204` or `200-299/304` and the
+// expected body substring, it returns nil if both are empty
+func ParseHealthCheckExpect(status string, body string) (*HealthCheckExpect, error) {
+	if status == "" && body == "" {
+		return nil, nil
+	}
+
+	expect := &HealthCheckExpect{Body: body}
+	for _, s := range strings.Split(status, "/") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		minStr, maxStr := s, s
+		if idx := strings.IndexByte(s, '-'); idx != -1 {
+			minStr, maxStr = s[:idx], s[idx+1:]
+		}
+
+		min, err := strconv.Atoi(strings.TrimSpace(minStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected status %s", s)
+		}
+
+		max, err := strconv.Atoi(strings.TrimSpace(maxStr))
+		if err != nil || min > max || min < 100 || max > 599 {
+			return nil, fmt.Errorf("invalid expected status %s", s)
+		}
+
+		expect.Status = append(expect.Status, StatusRange{Min: min, Max: max})
+	}
+
+	return expect, nil
+}
+
+// MatchStatus reports whether the status code is expected
+func (e *HealthCheckExpect) MatchStatus(status int) bool {
+	if e == nil || len(e.Status) == 0 {
+		return true
+	}
+
+	for _, r := range e.Status {
+		if status >= r.Min && status <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchBody reports whether the response body contains the expected substring
+func (e *HealthCheckExpect) MatchBody(body []byte) bool {
+	if e == nil || e.Body == "" {
+		return true
+	}
+
+	return bytes.Contains(body, []byte(e.Body))
+}
+
+// NeedBody reports whether the health check must read the response body
+func (e *HealthCheckExpect) NeedBody() bool {
+	return e != nil && e.Body != ""
+}
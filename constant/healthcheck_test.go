@@ -0,0 +1,62 @@
+package constant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHealthCheckExpect(t *testing.T) {
+	tests := []struct {
+		status string
+		ranges []StatusRange
+	}{
+		{"204", []StatusRange{{204, 204}}},
+		{"200-299", []StatusRange{{200, 299}}},
+		{"200-299/304", []StatusRange{{200, 299}, {304, 304}}},
+		{" 200 - 204 / 301 ", []StatusRange{{200, 204}, {301, 301}}},
+		{"204/", []StatusRange{{204, 204}}},
+		{"100-599", []StatusRange{{100, 599}}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		expect, err := ParseHealthCheckExpect(tt.status, "ok")
+		require.NoError(t, err, tt.status)
+		assert.Equal(t, tt.ranges, expect.Status, tt.status)
+		assert.Equal(t, "ok", expect.Body)
+	}
+
+	for _, status := range []string{"abc", "20x", "-204", "204-", "299-200", "99", "600", "200-600", "200-299-304", "200,204"} {
+		_, err := ParseHealthCheckExpect(status, "")
+		assert.Error(t, err, status)
+	}
+
+	expect, err := ParseHealthCheckExpect("", "")
+	require.NoError(t, err)
+	assert.Nil(t, expect)
+}
+
+func TestHealthCheckExpect_Match(t *testing.T) {
+	expect, err := ParseHealthCheckExpect("200-299/304", "")
+	require.NoError(t, err)
+	for status, match := range map[int]bool{200: true, 250: true, 299: true, 304: true, 199: false, 300: false, 404: false} {
+		assert.Equal(t, match, expect.MatchStatus(status), status)
+	}
+	assert.True(t, expect.MatchBody(nil))
+	assert.False(t, expect.NeedBody())
+
+	expect, err = ParseHealthCheckExpect("", "success")
+	require.NoError(t, err)
+	assert.True(t, expect.MatchStatus(500))
+	assert.True(t, expect.NeedBody())
+	assert.True(t, expect.MatchBody([]byte(`{"result":"success"}`)))
+	assert.False(t, expect.MatchBody([]byte(`{"result":"failure"}`)))
+
+	// a nil expect accepts any response
+	var none *HealthCheckExpect
+	assert.True(t, none.MatchStatus(500))
+	assert.True(t, none.MatchBody(nil))
+	assert.False(t, none.NeedBody())
+}
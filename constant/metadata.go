@@ -2,6 +2,7 @@ package constant
 
 import (
 	"encoding/json"
+	"fmt"
 	"net"
 	"strconv"
 )
@@ -20,6 +21,8 @@ const (
 	SOCKS
 	REDIR
 	TPROXY
+	SOCKS4
+	TUN
 )
 
 type NetWork int
@@ -49,6 +52,10 @@ func (t Type) String() string {
 		return "Redir"
 	case TPROXY:
 		return "TProxy"
+	case SOCKS4:
+		return "Socks4"
+	case TUN:
+		return "Tun"
 	default:
 		return "Unknown"
 	}
@@ -68,6 +75,16 @@ type Metadata struct {
 	DstPort  string  `json:"destinationPort"`
 	AddrType int     `json:"-"`
 	Host     string  `json:"host"`
+	InUser   string  `json:"inboundUser"`
+	// SniffHost is the domain sniffed from the connection, it's the Host
+	// only if the sniffer overrides the destination
+	SniffHost string `json:"sniffHost,omitempty"`
+	// HostSource is how the domain of the connection is found, e.g. dns,
+	// fake-ip-reverse and sniff-tls, empty means the domain of the request
+	HostSource string `json:"hostSource,omitempty"`
+	// RoutingMark is the SO_MARK of the outbound sockets set by the matched
+	// rule, zero means the mark of the proxy or the global one
+	RoutingMark int `json:"routingMark,omitempty"`
 }
 
 func (m *Metadata) RemoteAddress() string {
@@ -78,6 +95,14 @@ func (m *Metadata) SourceAddress() string {
 	return net.JoinHostPort(m.SrcIP.String(), m.SrcPort)
 }
 
+// SourceDetail returns the source address with the authenticated user of inbound
+func (m *Metadata) SourceDetail() string {
+	if m.InUser != "" {
+		return fmt.Sprintf("%s(%s)", m.SourceAddress(), m.InUser)
+	}
+	return m.SourceAddress()
+}
+
 func (m *Metadata) Resolved() bool {
 	return m.DstIP != nil
 }
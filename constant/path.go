@@ -56,3 +56,15 @@ func (p *path) Resolve(path string) string {
 func (p *path) MMDB() string {
 	return P.Join(p.homeDir, "Country.mmdb")
 }
+
+func (p *path) ASN() string {
+	return P.Join(p.homeDir, "GeoLite2-ASN.mmdb")
+}
+
+func (p *path) GeoSite() string {
+	return P.Join(p.homeDir, "GeoSite.dat")
+}
+
+func (p *path) Cache() string {
+	return P.Join(p.homeDir, "cache.db")
+}
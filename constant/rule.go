@@ -5,12 +5,23 @@ const (
 	Domain RuleType = iota
 	DomainSuffix
 	DomainKeyword
+	GEOSITE
 	GEOIP
+	SrcGEOIP
+	IPASN
 	IPCIDR
 	SrcIPCIDR
 	SrcPort
 	DstPort
 	Process
+	ProcessPath
+	InType
+	InUser
+	Network
+	Script
+	AND
+	OR
+	NOT
 	MATCH
 )
 
@@ -24,8 +35,14 @@ func (rt RuleType) String() string {
 		return "DomainSuffix"
 	case DomainKeyword:
 		return "DomainKeyword"
+	case GEOSITE:
+		return "GeoSite"
 	case GEOIP:
 		return "GeoIP"
+	case SrcGEOIP:
+		return "SrcGeoIP"
+	case IPASN:
+		return "IPASN"
 	case IPCIDR:
 		return "IPCIDR"
 	case SrcIPCIDR:
@@ -36,6 +53,22 @@ func (rt RuleType) String() string {
 		return "DstPort"
 	case Process:
 		return "Process"
+	case ProcessPath:
+		return "ProcessPath"
+	case InType:
+		return "InType"
+	case InUser:
+		return "InUser"
+	case Network:
+		return "Network"
+	case Script:
+		return "Script"
+	case AND:
+		return "AND"
+	case OR:
+		return "OR"
+	case NOT:
+		return "NOT"
 	case MATCH:
 		return "Match"
 	default:
@@ -50,3 +83,17 @@ type Rule interface {
 	Payload() string
 	ShouldResolveIP() bool
 }
+
+// PolicyRule is a rule whose policy depends on the metadata, e.g. SCRIPT
+type PolicyRule interface {
+	Rule
+	// MatchPolicy returns the policy name if metadata matches
+	MatchPolicy(metadata *Metadata) (string, bool)
+}
+
+// RoutingMarkRule is a rule which sets the routing mark of the connections it
+// matches, e.g. the rules with the routing-mark param
+type RoutingMarkRule interface {
+	Rule
+	RoutingMark() int
+}
@@ -18,6 +18,14 @@ type client struct {
 	host string
 }
 
+func (c *client) Address() string {
+	scheme := c.Client.Net
+	if scheme == "" {
+		scheme = "udp"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(c.host, c.port))
+}
+
 func (c *client) Exchange(m *D.Msg) (msg *D.Msg, err error) {
 	return c.ExchangeContext(context.Background(), m)
 }
@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	D "github.com/miekg/dns"
+)
+
+// QueryResult is how a query is answered by Query, Latency is in milliseconds
+type QueryResult struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Source  string   `json:"source"`
+	Cache   string   `json:"cache,omitempty"`
+	Server  string   `json:"server,omitempty"`
+	Rcode   string   `json:"rcode,omitempty"`
+	Answers []string `json:"answers"`
+	Latency int64    `json:"latency"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Query answers the query of name and qtype like the DNS server does, through
+// the hosts, the fake ip and the cache of resolver. mapper may be nil. It
+// doesn't allocate the fake ips, a host without one has an empty answer.
+func Query(resolver *Resolver, mapper *ResolverEnhancer, name string, qtype uint16) *QueryResult {
+	m := &D.Msg{}
+	m.SetQuestion(D.Fqdn(name), qtype)
+	m.RecursionDesired = true
+
+	if mapper == nil {
+		mapper = NewEnhancer(Config{})
+	}
+
+	trace := &queryTrace{start: time.Now()}
+	msg, err := newHandler(resolver, mapper, true)(trace, m)
+
+	result := &QueryResult{
+		Name:    strings.TrimRight(m.Question[0].Name, "."),
+		Type:    D.TypeToString[qtype],
+		Source:  trace.source,
+		Cache:   trace.cache,
+		Server:  trace.server,
+		Answers: []string{},
+		Latency: time.Since(trace.start).Milliseconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if msg != nil {
+		result.Rcode = D.RcodeToString[msg.Rcode]
+		result.Answers = msgToAnswers(msg)
+	}
+	return result
+}
+
+// UpstreamResult is the result of probing a nameserver, Group is main,
+// fallback or the name of a nameserver-group, RTT is in milliseconds
+type UpstreamResult struct {
+	Server  string `json:"server"`
+	Group   string `json:"group"`
+	Success bool   `json:"success"`
+	RTT     int64  `json:"rtt"`
+	Rcode   string `json:"rcode,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Benchmark sends the A query of name to each nameserver of r bypassing the
+// cache, the nameservers are probed concurrently and each is limited by timeout
+func (r *Resolver) Benchmark(name string, timeout time.Duration) []UpstreamResult {
+	type upstream struct {
+		group  string
+		client dnsClient
+	}
+
+	upstreams := []upstream{}
+	for _, c := range r.main {
+		upstreams = append(upstreams, upstream{"main", c})
+	}
+	for _, c := range r.fallback {
+		upstreams = append(upstreams, upstream{"fallback", c})
+	}
+	groupNames := make([]string, 0, len(r.groups))
+	for groupName := range r.groups {
+		groupNames = append(groupNames, groupName)
+	}
+	sort.Strings(groupNames)
+	for _, groupName := range groupNames {
+		for _, c := range r.groups[groupName].clients {
+			upstreams = append(upstreams, upstream{groupName, c})
+		}
+	}
+
+	m := &D.Msg{}
+	m.SetQuestion(D.Fqdn(name), D.TypeA)
+	m.RecursionDesired = true
+
+	results := make([]UpstreamResult, len(upstreams))
+	wg := sync.WaitGroup{}
+	for i, u := range upstreams {
+		wg.Add(1)
+		go func(i int, u upstream) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			start := time.Now()
+			msg, err := u.client.ExchangeContext(ctx, m.Copy())
+			result := UpstreamResult{
+				Server: u.client.Address(),
+				Group:  u.group,
+				RTT:    time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Rcode = D.RcodeToString[msg.Rcode]
+				result.Success = msg.Rcode != D.RcodeServerFailure && msg.Rcode != D.RcodeRefused
+			}
+			results[i] = result
+		}(i, u)
+	}
+	wg.Wait()
+
+	return results
+}
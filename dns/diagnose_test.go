@@ -0,0 +1,35 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Dreamacro/clash/component/fakeip"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery_FakeIP(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("198.18.0.1/16")
+	pool, _ := fakeip.New(ipnet, 1000, nil)
+	mapper := NewEnhancer(Config{EnhancedMode: FAKEIP, Pool: pool})
+	resolver := &Resolver{}
+
+	// a host without a fake ip doesn't get one
+	result := Query(resolver, mapper, "example.com", D.TypeA)
+	assert.Equal(t, sourceFakeIP, result.Source)
+	assert.Empty(t, result.Answers)
+	assert.Empty(t, result.Error)
+	_, exist := pool.Peek("example.com")
+	assert.False(t, exist)
+
+	ip := pool.Lookup("example.com")
+	result = Query(resolver, mapper, "example.com", D.TypeA)
+	assert.Equal(t, sourceFakeIP, result.Source)
+	assert.Equal(t, []string{ip.String()}, result.Answers)
+	assert.Equal(t, "NOERROR", result.Rcode)
+
+	// the next host gets the next ip, nothing was allocated by Query
+	assert.True(t, pool.Lookup("example.org").Equal(net.IP{198, 18, 0, 3}))
+}
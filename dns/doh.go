@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/Dreamacro/clash/component/dialer"
+	tlsC "github.com/Dreamacro/clash/component/tls"
 
 	D "github.com/miekg/dns"
 )
@@ -20,7 +25,14 @@ const (
 
 type dohClient struct {
 	url       string
-	transport *http.Transport
+	method    string
+	headers   http.Header
+	transport http.RoundTripper
+	padding   int
+}
+
+func (dc *dohClient) Address() string {
+	return dc.url
 }
 
 func (dc *dohClient) Exchange(m *D.Msg) (msg *D.Msg, err error) {
@@ -28,28 +40,54 @@ func (dc *dohClient) Exchange(m *D.Msg) (msg *D.Msg, err error) {
 }
 
 func (dc *dohClient) ExchangeContext(ctx context.Context, m *D.Msg) (msg *D.Msg, err error) {
-	req, err := dc.newRequest(m)
+	req, err := dc.newRequest(padMsg(m, dc.padding))
 	if err != nil {
 		return nil, err
 	}
 
 	req = req.WithContext(ctx)
-	return dc.doRequest(req)
+	msg, err = dc.doRequest(req)
+	if err == nil {
+		msg.Id = m.Id
+		unpadMsg(msg)
+	}
+	return
 }
 
 // newRequest returns a new DoH request given a dns.Msg.
 func (dc *dohClient) newRequest(m *D.Msg) (*http.Request, error) {
-	buf, err := m.Pack()
+	// id 0 makes the GET requests cacheable by HTTP caches, see RFC 8484 4.1
+	query := m.Copy()
+	query.Id = 0
+	buf, err := query.Pack()
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, dc.url, bytes.NewReader(buf))
+	var req *http.Request
+	if dc.method == http.MethodGet {
+		// the url may carry a query already
+		var u *url.URL
+		if u, err = url.Parse(dc.url); err != nil {
+			return nil, err
+		}
+		query := u.Query()
+		query.Set("dns", base64.RawURLEncoding.EncodeToString(buf))
+		u.RawQuery = query.Encode()
+		req, err = http.NewRequest(http.MethodGet, u.String(), nil)
+	} else {
+		req, err = http.NewRequest(http.MethodPost, dc.url, bytes.NewReader(buf))
+	}
 	if err != nil {
 		return req, err
 	}
 
-	req.Header.Set("content-type", dotMimeType)
+	for key, values := range dc.headers {
+		req.Header[key] = values
+	}
+	if dc.method != http.MethodGet {
+		req.Header.Set("content-type", dotMimeType)
+	}
 	req.Header.Set("accept", dotMimeType)
 	return req, nil
 }
@@ -62,6 +100,10 @@ func (dc *dohClient) doRequest(req *http.Request) (msg *D.Msg, err error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server response: %s", resp.Status)
+	}
+
 	buf, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -71,25 +113,58 @@ func (dc *dohClient) doRequest(req *http.Request) (msg *D.Msg, err error) {
 	return msg, err
 }
 
-func newDoHClient(url string, r *Resolver) *dohClient {
+func newDoHClient(s NameServer, r *Resolver) *dohClient {
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ip, err := r.ResolveIPv4(host)
+		if err != nil {
+			return nil, err
+		}
+
+		return dialer.DialContext(ctx, "tcp4", net.JoinHostPort(ip.String(), port))
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{ClientSessionCache: globalSessionCache, MinVersion: s.MinVersion},
+		ForceAttemptHTTP2: true,
+		DialContext:       dial,
+	}
+
+	// HTTP/2 isn't negotiated on the fingerprinted connections, the requests are sent in HTTP/1.1
+	if s.Fingerprint != nil {
+		transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+
+			host, _, _ := net.SplitHostPort(addr)
+			if deadline, ok := ctx.Deadline(); ok {
+				c.SetDeadline(deadline)
+			}
+			tc, err := tlsC.StreamConn(c, &tls.Config{
+				ServerName: host,
+				NextProtos: []string{"http/1.1"},
+				MinVersion: s.MinVersion,
+			}, s.Fingerprint)
+			if err != nil {
+				c.Close()
+				return nil, err
+			}
+			c.SetDeadline(time.Time{})
+			return tc, nil
+		}
+	}
+
 	return &dohClient{
-		url: url,
-		transport: &http.Transport{
-			TLSClientConfig:   &tls.Config{ClientSessionCache: globalSessionCache},
-			ForceAttemptHTTP2: true,
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				host, port, err := net.SplitHostPort(addr)
-				if err != nil {
-					return nil, err
-				}
-
-				ip, err := r.ResolveIPv4(host)
-				if err != nil {
-					return nil, err
-				}
-
-				return dialer.DialContext(ctx, "tcp4", net.JoinHostPort(ip.String(), port))
-			},
-		},
+		url:       s.Addr,
+		method:    s.Method,
+		headers:   s.Headers,
+		transport: transport,
+		padding:   s.Padding,
 	}
 }
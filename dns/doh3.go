@@ -0,0 +1,61 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/Dreamacro/clash/component/dialer"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newDoH3Client returns a DoH client that speaks HTTP/3 (RFC 9114) to the
+// upstream, reusing the DoH request and response handling of dohClient.
+func newDoH3Client(s NameServer, r *Resolver) *dohClient {
+	return &dohClient{
+		url:     s.Addr,
+		method:  s.Method,
+		headers: s.Headers,
+		padding: s.Padding,
+		transport: &http3.Transport{
+			TLSClientConfig: &tls.Config{ClientSessionCache: globalSessionCache},
+			Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+				host, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+
+				ip, err := r.ResolveIPv4(host)
+				if err != nil {
+					return nil, err
+				}
+
+				udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(ip.String(), port))
+				if err != nil {
+					return nil, err
+				}
+
+				pc, err := dialer.ListenPacket("udp", "")
+				if err != nil {
+					return nil, err
+				}
+
+				conn, err := quic.DialEarly(ctx, pc, udpAddr, tlsCfg, cfg)
+				if err != nil {
+					pc.Close()
+					return nil, err
+				}
+
+				// quic-go doesn't own a packet conn it was handed, release it with the connection
+				go func() {
+					<-conn.Context().Done()
+					pc.Close()
+				}()
+
+				return conn, nil
+			},
+		},
+	}
+}
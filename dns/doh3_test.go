@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	D "github.com/miekg/dns"
+)
+
+func newTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestDoH3Client_Exchange(t *testing.T) {
+	cert, pool := newTestCert(t)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var proto string
+	server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			proto = req.Proto
+			buf, _ := ioutil.ReadAll(req.Body)
+			m := &D.Msg{}
+			if req.Header.Get("content-type") != dotMimeType || m.Unpack(buf) != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			r := &D.Msg{}
+			r.SetReply(m)
+			r.Answer = []D.RR{&D.A{
+				Hdr: D.RR_Header{Name: m.Question[0].Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: 60},
+				A:   net.IPv4(1, 2, 3, 4),
+			}}
+			out, _ := r.Pack()
+			w.Header().Set("content-type", dotMimeType)
+			w.Write(out)
+		}),
+	}
+	go server.Serve(pc)
+	defer server.Close()
+
+	c := newDoH3Client(NameServer{Net: "h3", Addr: "https://" + pc.LocalAddr().String() + "/dns-query"}, &Resolver{})
+	c.transport.(*http3.Transport).TLSClientConfig.RootCAs = pool
+	defer c.transport.(*http3.Transport).Close()
+
+	m := &D.Msg{}
+	m.SetQuestion("example.com.", D.TypeA)
+	msg, err := c.Exchange(m)
+	require.NoError(t, err)
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, "1.2.3.4", msg.Answer[0].(*D.A).A.String())
+	assert.Equal(t, "HTTP/3.0", proto)
+}
@@ -0,0 +1,33 @@
+package dns
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoHClient_GetRequest(t *testing.T) {
+	m := &D.Msg{}
+	m.SetQuestion("example.com.", D.TypeA)
+
+	for _, addr := range []string{"https://dns.example/dns-query", "https://dns.example/dns-query?ct=1"} {
+		dc := &dohClient{url: addr, method: http.MethodGet}
+		req, err := dc.newRequest(m)
+		require.NoError(t, err)
+		assert.Equal(t, "/dns-query", req.URL.Path)
+		if addr != "https://dns.example/dns-query" {
+			assert.Equal(t, "1", req.URL.Query().Get("ct"))
+		}
+
+		buf, err := base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+		require.NoError(t, err)
+		query := &D.Msg{}
+		require.NoError(t, query.Unpack(buf))
+		assert.Equal(t, uint16(0), query.Id)
+		assert.Equal(t, m.Question, query.Question)
+	}
+}
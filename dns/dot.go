@@ -0,0 +1,351 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/dialer"
+	tlsC "github.com/Dreamacro/clash/component/tls"
+
+	D "github.com/miekg/dns"
+)
+
+const (
+	dotTimeout = 5 * time.Second
+
+	defaultDoTPoolSize    = 1
+	defaultDoTIdleTimeout = 30 * time.Second
+)
+
+var (
+	errDoTConnClosed = errors.New("DoT connection closed")
+	errDoTConnIdle   = errors.New("DoT connection idle")
+)
+
+// DoTPool config, each DoT server keeps at most Size connections, a connection
+// is closed if there is no query on it for IdleTimeout
+type DoTPool struct {
+	Size        int
+	IdleTimeout time.Duration
+}
+
+// dotClient keeps persistent TLS connections to a DoT server, the queries are
+// pipelined on the connections and the responses are demuxed by message id
+type dotClient struct {
+	host        string
+	port        string
+	r           *Resolver
+	tlsConfig   *tls.Config
+	fingerprint *tlsC.Fingerprint
+	pool        DoTPool
+	padding     int
+
+	mux     sync.Mutex
+	conns   []*dotConn
+	dialing int
+	dialed  chan struct{}
+	next    int
+}
+
+func (dc *dotClient) Address() string {
+	return fmt.Sprintf("tls://%s", net.JoinHostPort(dc.host, dc.port))
+}
+
+func (dc *dotClient) Exchange(m *D.Msg) (msg *D.Msg, err error) {
+	return dc.ExchangeContext(context.Background(), m)
+}
+
+func (dc *dotClient) ExchangeContext(ctx context.Context, m *D.Msg) (msg *D.Msg, err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dotTimeout)
+		defer cancel()
+	}
+
+	conn, reused, err := dc.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m = padMsg(m, dc.padding)
+	defer func() {
+		if err == nil {
+			unpadMsg(msg)
+		}
+	}()
+
+	msg, err = conn.exchange(ctx, m)
+	// the server may close an idle connection at any time, retry once on
+	// another connection of the pool, the closed one is dropped from it
+	if err != nil && reused && ctx.Err() == nil && conn.isClosed() {
+		if conn, _, err = dc.getConn(ctx); err != nil {
+			return nil, err
+		}
+		msg, err = conn.exchange(ctx, m)
+	}
+	return
+}
+
+// getConn returns a connection of the pool, it dials a new one if the pool
+// isn't full, or waits for the connection being dialed
+func (dc *dotClient) getConn(ctx context.Context) (conn *dotConn, reused bool, err error) {
+	for {
+		dc.mux.Lock()
+		alive := dc.conns[:0]
+		for _, c := range dc.conns {
+			if !c.isClosed() {
+				alive = append(alive, c)
+			}
+		}
+		dc.conns = alive
+
+		if len(dc.conns)+dc.dialing < dc.pool.Size {
+			dc.dialing++
+			dc.mux.Unlock()
+			conn, err = dc.dialConn(ctx)
+			return conn, false, err
+		}
+
+		if len(dc.conns) > 0 {
+			dc.next = (dc.next + 1) % len(dc.conns)
+			conn = dc.conns[dc.next]
+			dc.mux.Unlock()
+			return conn, true, nil
+		}
+
+		dialed := dc.dialed
+		dc.mux.Unlock()
+
+		select {
+		case <-dialed:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// dialConn dials a connection and puts it into the pool, dialing is increased by the caller
+func (dc *dotClient) dialConn(ctx context.Context) (*dotConn, error) {
+	conn, err := dc.dial(ctx)
+
+	dc.mux.Lock()
+	defer dc.mux.Unlock()
+
+	dc.dialing--
+	close(dc.dialed)
+	dc.dialed = make(chan struct{})
+	if err != nil {
+		return nil, err
+	}
+	dc.conns = append(dc.conns, conn)
+	return conn, nil
+}
+
+func (dc *dotClient) dial(ctx context.Context) (*dotConn, error) {
+	var ip net.IP
+	if dc.r == nil {
+		// a default ip dns
+		ip = net.ParseIP(dc.host)
+	} else {
+		var err error
+		if ip, err = dc.r.ResolveIP(dc.host); err != nil {
+			return nil, fmt.Errorf("use default dns resolve failed: %w", err)
+		}
+	}
+
+	c, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), dc.port))
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	tc, err := tlsC.StreamConn(c, dc.tlsConfig, dc.fingerprint)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+
+	return newDoTConn(tc, dc.pool.IdleTimeout), nil
+}
+
+// dotConn is a TLS connection which carries the queries concurrently
+type dotConn struct {
+	conn        *D.Conn
+	idleTimeout time.Duration
+
+	writeMux sync.Mutex
+
+	mux     sync.Mutex
+	pending map[uint16]chan *D.Msg
+	closed  bool
+	err     error
+	idle    *time.Timer
+}
+
+func newDoTConn(c net.Conn, idleTimeout time.Duration) *dotConn {
+	conn := &dotConn{
+		conn:        &D.Conn{Conn: c},
+		idleTimeout: idleTimeout,
+		pending:     map[uint16]chan *D.Msg{},
+	}
+	conn.idle = time.AfterFunc(idleTimeout, conn.closeIfIdle)
+	go conn.readLoop()
+	return conn
+}
+
+func (c *dotConn) exchange(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	ch := make(chan *D.Msg, 1)
+	id, err := c.register(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer c.unregister(id)
+
+	// the id of m is replaced by a unique one on this connection
+	req := m.Copy()
+	req.Id = id
+
+	c.writeMux.Lock()
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetWriteDeadline(deadline)
+	}
+	err = c.conn.WriteMsg(req)
+	c.writeMux.Unlock()
+	if err != nil {
+		c.close(err)
+		return nil, err
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, c.error()
+		}
+		msg.Id = m.Id
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *dotConn) readLoop() {
+	for {
+		msg, err := c.conn.ReadMsg()
+		if err != nil {
+			c.close(err)
+			return
+		}
+
+		// send under the lock, so that the channel isn't closed meanwhile
+		c.mux.Lock()
+		if ch, ok := c.pending[msg.Id]; ok {
+			delete(c.pending, msg.Id)
+			ch <- msg
+		}
+		c.mux.Unlock()
+	}
+}
+
+func (c *dotConn) register(ch chan *D.Msg) (uint16, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed {
+		return 0, errDoTConnClosed
+	}
+
+	id := D.Id()
+	for _, ok := c.pending[id]; ok; _, ok = c.pending[id] {
+		id = D.Id()
+	}
+	c.pending[id] = ch
+	c.idle.Stop()
+	return id, nil
+}
+
+func (c *dotConn) unregister(id uint16) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	delete(c.pending, id)
+	if len(c.pending) == 0 && !c.closed {
+		c.idle.Reset(c.idleTimeout)
+	}
+}
+
+func (c *dotConn) closeIfIdle() {
+	c.mux.Lock()
+	idle := len(c.pending) == 0
+	c.mux.Unlock()
+
+	if idle {
+		c.close(errDoTConnIdle)
+	}
+}
+
+func (c *dotConn) close(err error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.err = err
+	c.idle.Stop()
+	for id, ch := range c.pending {
+		delete(c.pending, id)
+		close(ch)
+	}
+	c.conn.Close()
+}
+
+func (c *dotConn) isClosed() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.closed
+}
+
+func (c *dotConn) error() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.err == nil || c.err == errDoTConnIdle {
+		return errDoTConnClosed
+	}
+	return fmt.Errorf("%w: %s", errDoTConnClosed, c.err.Error())
+}
+
+func newDoTClient(host, port string, s NameServer, r *Resolver, pool DoTPool) *dotClient {
+	if pool.Size <= 0 {
+		pool.Size = defaultDoTPoolSize
+	}
+	if pool.IdleTimeout <= 0 {
+		pool.IdleTimeout = defaultDoTIdleTimeout
+	}
+
+	return &dotClient{
+		host: host,
+		port: port,
+		r:    r,
+		tlsConfig: &tls.Config{
+			ClientSessionCache: globalSessionCache,
+			// alpn identifier, see https://tools.ietf.org/html/draft-hoffman-dprive-dns-tls-alpn-00#page-6
+			NextProtos: []string{"dns"},
+			ServerName: host,
+			MinVersion: s.MinVersion,
+		},
+		fingerprint: s.Fingerprint,
+		pool:        pool,
+		padding:     s.Padding,
+		dialed:      make(chan struct{}),
+	}
+}
@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dotServer is a local DoT server which answers every A query with 127.0.0.1
+type dotServer struct {
+	net.Listener
+	server *D.Server
+	pool   *x509.CertPool
+
+	mux   sync.Mutex
+	conns []net.Conn
+}
+
+func (s *dotServer) Accept() (net.Conn, error) {
+	c, err := s.Listener.Accept()
+	if err == nil {
+		s.mux.Lock()
+		s.conns = append(s.conns, c)
+		s.mux.Unlock()
+	}
+	return c, err
+}
+
+func (s *dotServer) accepted() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.conns)
+}
+
+// closeConns closes the accepted connections from the server side
+func (s *dotServer) closeConns() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+func newDoTServer(t *testing.T) *dotServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &dotServer{Listener: l, pool: x509.NewCertPool()}
+	s.pool.AddCert(cert)
+	s.server = &D.Server{
+		Listener: tls.NewListener(s, &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		}),
+		Handler: D.HandlerFunc(func(w D.ResponseWriter, r *D.Msg) {
+			m := &D.Msg{}
+			m.SetReply(r)
+			rr, _ := D.NewRR(r.Question[0].Name + " 60 IN A 127.0.0.1")
+			m.Answer = []D.RR{rr}
+			w.WriteMsg(m)
+		}),
+	}
+	go s.server.ActivateAndServe()
+	t.Cleanup(func() { s.server.Shutdown() })
+	return s
+}
+
+func newTestDoTClient(s *dotServer, pool DoTPool) *dotClient {
+	_, port, _ := net.SplitHostPort(s.Addr().String())
+	dc := newDoTClient("127.0.0.1", port, NameServer{}, nil, pool)
+	dc.tlsConfig.RootCAs = s.pool
+	dc.tlsConfig.ClientSessionCache = nil
+	return dc
+}
+
+func exchangeA(t *testing.T, dc *dotClient, name string) {
+	m := &D.Msg{}
+	m.SetQuestion(name, D.TypeA)
+	msg, err := dc.ExchangeContext(context.Background(), m)
+	require.NoError(t, err, name)
+	assert.Equal(t, m.Id, msg.Id)
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, name, msg.Answer[0].Header().Name)
+}
+
+func TestDoTClient_Reuse(t *testing.T) {
+	s := newDoTServer(t)
+	dc := newTestDoTClient(s, DoTPool{Size: 1})
+
+	exchangeA(t, dc, "a.example.")
+	exchangeA(t, dc, "b.example.")
+
+	// the concurrent queries are pipelined on the connection
+	wg := sync.WaitGroup{}
+	for _, name := range []string{"c.example.", "d.example.", "e.example.", "f.example."} {
+		name := name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exchangeA(t, dc, name)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, s.accepted())
+
+	dc = newTestDoTClient(s, DoTPool{Size: 2})
+	exchangeA(t, dc, "a.example.")
+	exchangeA(t, dc, "b.example.")
+	exchangeA(t, dc, "c.example.")
+	assert.Equal(t, 3, s.accepted())
+}
+
+func TestDoTClient_Broken(t *testing.T) {
+	s := newDoTServer(t)
+	dc := newTestDoTClient(s, DoTPool{Size: 1})
+
+	exchangeA(t, dc, "a.example.")
+	dc.mux.Lock()
+	conn := dc.conns[0]
+	dc.mux.Unlock()
+
+	// the query on the connection closed by the server is retried on a new one
+	s.closeConns()
+	exchangeA(t, dc, "b.example.")
+	assert.True(t, conn.isClosed())
+	assert.Equal(t, 2, s.accepted())
+
+	dc.mux.Lock()
+	assert.Len(t, dc.conns, 1)
+	assert.NotSame(t, conn, dc.conns[0])
+	dc.mux.Unlock()
+}
+
+func TestDoTClient_IdleTimeout(t *testing.T) {
+	s := newDoTServer(t)
+	dc := newTestDoTClient(s, DoTPool{Size: 1, IdleTimeout: 50 * time.Millisecond})
+
+	exchangeA(t, dc, "a.example.")
+	dc.mux.Lock()
+	conn := dc.conns[0]
+	dc.mux.Unlock()
+
+	time.Sleep(200 * time.Millisecond)
+	assert.True(t, conn.isClosed())
+
+	exchangeA(t, dc, "b.example.")
+	assert.Equal(t, 2, s.accepted())
+}
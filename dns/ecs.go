@@ -0,0 +1,157 @@
+package dns
+
+import (
+	"net"
+
+	D "github.com/miekg/dns"
+)
+
+const (
+	ecsAutoIPv4Mask = 24
+	ecsAutoIPv6Mask = 56
+)
+
+// sharedAddressSpace is 100.64.0.0/10 of RFC 6598, the carrier-grade NAT
+var sharedAddressSpace = &net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
+
+// ECS is the EDNS Client Subnet (RFC 7871) attached to outgoing queries
+type ECS struct {
+	// Subnet is sent for every query without ECS
+	Subnet *net.IPNet
+	// Auto derives the subnet from the source ip of the client
+	Auto bool
+}
+
+// apply attaches the ECS option to m if m doesn't carry one yet
+func (e *ECS) apply(m *D.Msg, client net.IP) {
+	if getECS(m) != nil {
+		return
+	}
+
+	if e.Auto {
+		if client == nil || !isPublicIP(client) {
+			return
+		}
+
+		if ip := client.To4(); ip != nil {
+			setECS(m, ip, ecsAutoIPv4Mask)
+		} else {
+			setECS(m, client, ecsAutoIPv6Mask)
+		}
+		return
+	}
+
+	if e.Subnet != nil {
+		ones, _ := e.Subnet.Mask.Size()
+		setECS(m, e.Subnet.IP, ones)
+	}
+}
+
+// isPublicIP reports whether the subnet of ip may be sent to the nameservers,
+// the private, ULA and shared addresses are useless to them
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// stripEDNS returns msg without the EDNS the client didn't send: the OPT
+// if the query had none, or the ECS option if the query had no ECS
+func stripEDNS(msg *D.Msg, hadOPT, hadECS bool) *D.Msg {
+	if hadOPT && hadECS || msg.IsEdns0() == nil {
+		return msg
+	}
+
+	msg = msg.Copy()
+	extra := make([]D.RR, 0, len(msg.Extra))
+	for _, rr := range msg.Extra {
+		opt, ok := rr.(*D.OPT)
+		if !ok {
+			extra = append(extra, rr)
+			continue
+		}
+		if !hadOPT {
+			continue
+		}
+
+		options := make([]D.EDNS0, 0, len(opt.Option))
+		for _, o := range opt.Option {
+			if _, ok := o.(*D.EDNS0_SUBNET); !ok {
+				options = append(options, o)
+			}
+		}
+		opt.Option = options
+		extra = append(extra, opt)
+	}
+	msg.Extra = extra
+	return msg
+}
+
+func getECS(m *D.Msg) *D.EDNS0_SUBNET {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*D.EDNS0_SUBNET); ok {
+			return subnet
+		}
+	}
+
+	return nil
+}
+
+func setECS(m *D.Msg, ip net.IP, mask int) {
+	subnet := &D.EDNS0_SUBNET{
+		Code:          D.EDNS0SUBNET,
+		SourceNetmask: uint8(mask),
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		subnet.Family = 1
+		subnet.Address = ip4.Mask(net.CIDRMask(mask, 32))
+	} else {
+		subnet.Family = 2
+		subnet.Address = ip.Mask(net.CIDRMask(mask, 128))
+	}
+
+	opt := m.IsEdns0()
+	if opt == nil {
+		m.SetEdns0(D.DefaultMsgSize, false)
+		opt = m.IsEdns0()
+	}
+	opt.Option = append(opt.Option, subnet)
+}
+
+// ecsCacheable reports whether the answer covers the whole subnet of the query,
+// a scope prefix longer than the source prefix means it only fits a part of it
+func ecsCacheable(query, answer *D.Msg) bool {
+	q := getECS(query)
+	if q == nil {
+		return true
+	}
+
+	a := getECS(answer)
+	if a == nil {
+		return true
+	}
+
+	return a.SourceScope <= q.SourceNetmask
+}
+
+// cacheKey returns the key of m in cache, queries with different subnet don't share answers
+func cacheKey(m *D.Msg) string {
+	key := m.Question[0].String()
+	if subnet := getECS(m); subnet != nil {
+		bits := 128
+		if subnet.Family == 1 {
+			bits = 32
+		}
+
+		key += " " + (&net.IPNet{
+			IP:   subnet.Address,
+			Mask: net.CIDRMask(int(subnet.SourceNetmask), bits),
+		}).String()
+	}
+
+	return key
+}
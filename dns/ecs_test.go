@@ -0,0 +1,64 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestECS_AutoPublicOnly(t *testing.T) {
+	ecs := &ECS{Auto: true}
+	for _, tt := range []struct {
+		client string
+		subnet string
+	}{
+		{"1.2.3.4", "1.2.3.0"},
+		{"2001:db8:1234:5678::1", "2001:db8:1234:5600::"},
+		{"10.0.0.1", ""},
+		{"172.16.0.1", ""},
+		{"192.168.1.1", ""},
+		{"100.64.0.1", ""},
+		{"127.0.0.1", ""},
+		{"fd00::1", ""},
+		{"fe80::1", ""},
+	} {
+		m := &D.Msg{}
+		m.SetQuestion("example.com.", D.TypeA)
+		ecs.apply(m, net.ParseIP(tt.client))
+
+		subnet := getECS(m)
+		if tt.subnet == "" {
+			assert.Nil(t, subnet, tt.client)
+			continue
+		}
+		if assert.NotNil(t, subnet, tt.client) {
+			assert.Equal(t, tt.subnet, subnet.Address.String())
+		}
+	}
+}
+
+func TestStripEDNS(t *testing.T) {
+	answer := &D.Msg{}
+	answer.SetQuestion("example.com.", D.TypeA)
+	setECS(answer, net.ParseIP("1.2.3.4"), 24)
+	opt := answer.IsEdns0()
+	opt.Option = append(opt.Option, &D.EDNS0_COOKIE{Code: D.EDNS0COOKIE, Cookie: "0102030405060708"})
+
+	// the client sent no EDNS
+	msg := stripEDNS(answer, false, false)
+	assert.Nil(t, msg.IsEdns0())
+
+	// the client sent EDNS without ECS
+	msg = stripEDNS(answer, true, false)
+	assert.Nil(t, getECS(msg))
+	if assert.NotNil(t, msg.IsEdns0()) {
+		assert.Len(t, msg.IsEdns0().Option, 1)
+	}
+
+	// the answer is untouched
+	assert.NotNil(t, getECS(answer))
+	assert.Len(t, answer.IsEdns0().Option, 2)
+	assert.Equal(t, answer, stripEDNS(answer, true, true))
+}
@@ -39,7 +39,7 @@ func (h *ResolverEnhancer) IsFakeIP(ip net.IP) bool {
 	}
 
 	if pool := h.fakePool; pool != nil {
-		return pool.IPNet().Contains(ip) && !pool.Gateway().Equal(ip)
+		return pool.Contains(ip)
 	}
 
 	return false
@@ -61,6 +61,25 @@ func (h *ResolverEnhancer) FindHostByIP(ip net.IP) (string, bool) {
 	return "", false
 }
 
+// FlushFakeIP removes the fake ip and mapping of the hosts matching name, see
+// Resolver.FlushCache for the syntax of name, and returns the number of removed hosts
+func (h *ResolverEnhancer) FlushFakeIP(name string) int {
+	match := newNameMatcher(name)
+
+	n := 0
+	if pool := h.fakePool; pool != nil {
+		n += pool.DeleteFunc(match)
+	}
+
+	if mapping := h.mapping; mapping != nil {
+		n += mapping.DeleteFunc(func(key interface{}, value interface{}) bool {
+			return match(value.(string))
+		})
+	}
+
+	return n
+}
+
 func (h *ResolverEnhancer) PatchFrom(o *ResolverEnhancer) {
 	if h.mapping != nil && o.mapping != nil {
 		o.mapping.CloneTo(h.mapping)
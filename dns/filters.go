@@ -3,6 +3,7 @@ package dns
 import (
 	"net"
 
+	"github.com/Dreamacro/clash/component/geosite"
 	"github.com/Dreamacro/clash/component/mmdb"
 	"github.com/Dreamacro/clash/component/trie"
 )
@@ -14,8 +15,13 @@ type fallbackIPFilter interface {
 type geoipFilter struct{}
 
 func (gf *geoipFilter) Match(ip net.IP) bool {
-	record, _ := mmdb.Instance().Country(ip)
-	return record.Country.IsoCode != "CN" && record.Country.IsoCode != ""
+	codes := mmdb.Instance().Codes(ip)
+	for _, code := range codes {
+		if code == "CN" {
+			return false
+		}
+	}
+	return len(codes) != 0
 }
 
 type ipnetFilter struct {
@@ -44,3 +50,17 @@ func NewDomainFilter(domains []string) *domainFilter {
 func (df *domainFilter) Match(domain string) bool {
 	return df.tree.Search(domain) != nil
 }
+
+// geositeFilter matches the domains in the geosite categories
+type geositeFilter struct {
+	codes []string
+}
+
+func (gf *geositeFilter) Match(domain string) bool {
+	for _, code := range gf.codes {
+		if geosite.Match(code, domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"time"
+
+	D "github.com/miekg/dns"
+)
+
+// NameServerGroup is a named group of nameservers which nameserver-policy
+// can target. The nameservers are tried one by one in order if Failover,
+// otherwise they are raced. Zero Timeout means the upstream-timeout applies.
+type NameServerGroup struct {
+	NameServer []NameServer
+	Failover   bool
+	Timeout    time.Duration
+}
+
+type upstreamGroup struct {
+	clients  []dnsClient
+	failover bool
+	timeout  time.Duration
+}
+
+func newUpstreamGroup(group NameServerGroup, resolver *Resolver, pool DoTPool) *upstreamGroup {
+	return &upstreamGroup{
+		clients:  transform(group.NameServer, resolver, pool),
+		failover: group.Failover,
+		timeout:  group.Timeout,
+	}
+}
+
+func (r *Resolver) groupExchange(g *upstreamGroup, m *D.Msg) (msg *D.Msg, server string, err error) {
+	timeout := g.timeout
+	if timeout == 0 {
+		timeout = r.upstreamTimeout
+	}
+
+	if !g.failover {
+		return r.batchExchange(g.clients, m, timeout)
+	}
+
+	for _, client := range g.clients {
+		if msg, server, err = r.batchExchange([]dnsClient{client}, m, timeout); err == nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// fakeClient answers after delay, with rcode or err
+type fakeClient struct {
+	addr  string
+	delay time.Duration
+	rcode int
+	err   error
+	calls *atomic.Int32
+}
+
+func newFakeClient(addr string, delay time.Duration) *fakeClient {
+	return &fakeClient{addr: addr, delay: delay, calls: atomic.NewInt32(0)}
+}
+
+func (c *fakeClient) Exchange(m *D.Msg) (*D.Msg, error) {
+	return c.ExchangeContext(context.Background(), m)
+}
+
+func (c *fakeClient) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	c.calls.Inc()
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	msg := &D.Msg{}
+	msg.SetRcode(m, c.rcode)
+	return msg, nil
+}
+
+func (c *fakeClient) Address() string {
+	return c.addr
+}
+
+func newTestQuery() *D.Msg {
+	m := &D.Msg{}
+	m.SetQuestion("example.com.", D.TypeA)
+	return m
+}
+
+func TestGroupExchange_Parallel(t *testing.T) {
+	r := &Resolver{upstreamTimeout: time.Second}
+	slow := newFakeClient("slow", 200*time.Millisecond)
+	fast := newFakeClient("fast", 0)
+	g := &upstreamGroup{clients: []dnsClient{slow, fast}}
+
+	start := time.Now()
+	_, server, err := r.groupExchange(g, newTestQuery())
+	require.NoError(t, err)
+	assert.Equal(t, "fast", server)
+	assert.Less(t, int64(time.Since(start)), int64(150*time.Millisecond))
+	assert.Equal(t, int32(1), slow.calls.Load())
+	assert.Equal(t, int32(1), fast.calls.Load())
+}
+
+func TestGroupExchange_Failover(t *testing.T) {
+	r := &Resolver{upstreamTimeout: time.Second}
+	broken := newFakeClient("broken", 0)
+	broken.err = errors.New("connection refused")
+	refused := newFakeClient("refused", 0)
+	refused.rcode = D.RcodeRefused
+	first := newFakeClient("first", 20*time.Millisecond)
+	second := newFakeClient("second", 0)
+	g := &upstreamGroup{clients: []dnsClient{broken, refused, first, second}, failover: true}
+
+	// the nameservers are tried in order until one answers
+	_, server, err := r.groupExchange(g, newTestQuery())
+	require.NoError(t, err)
+	assert.Equal(t, "first", server)
+	assert.Equal(t, int32(1), broken.calls.Load())
+	assert.Equal(t, int32(1), refused.calls.Load())
+	assert.Equal(t, int32(0), second.calls.Load())
+
+	g = &upstreamGroup{clients: []dnsClient{broken, refused}, failover: true}
+	_, _, err = r.groupExchange(g, newTestQuery())
+	assert.Error(t, err)
+}
+
+func TestGroupExchange_Timeout(t *testing.T) {
+	r := &Resolver{upstreamTimeout: time.Second}
+	hang := newFakeClient("hang", time.Minute)
+	backup := newFakeClient("backup", 0)
+
+	// the timeout of the group moves on to the next nameserver
+	g := &upstreamGroup{clients: []dnsClient{hang, backup}, failover: true, timeout: 50 * time.Millisecond}
+	start := time.Now()
+	_, server, err := r.groupExchange(g, newTestQuery())
+	require.NoError(t, err)
+	assert.Equal(t, "backup", server)
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+
+	// zero timeout falls back to the upstream-timeout
+	r.upstreamTimeout = 50 * time.Millisecond
+	g = &upstreamGroup{clients: []dnsClient{hang}}
+	start = time.Now()
+	_, _, err = r.groupExchange(g, newTestQuery())
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+}
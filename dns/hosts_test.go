@@ -0,0 +1,76 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Dreamacro/clash/component/resolver"
+	"github.com/Dreamacro/clash/component/trie"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithHosts(t *testing.T) {
+	tree := trie.New()
+	for domain, values := range map[string][]string{
+		"multi.example": {"1.1.1.1", "2001:db8::1", "2.2.2.2"},
+		"v4.example":    {"3.3.3.3"},
+		"alias.example": {"multi.example"},
+		"cname.example": {"upstream.example"},
+	} {
+		value, err := resolver.NewHostValue(values)
+		require.NoError(t, err)
+		require.NoError(t, tree.Insert(domain, value))
+	}
+
+	// upstream answers every question with 9.9.9.9
+	upstream := func(trace *queryTrace, r *D.Msg) (*D.Msg, error) {
+		msg := &D.Msg{}
+		msg.SetReply(r)
+		rr, _ := D.NewRR(r.Question[0].Name + " 60 IN A 9.9.9.9")
+		msg.Answer = []D.RR{rr}
+		return msg, nil
+	}
+	handler := withHosts(tree)(upstream)
+
+	exchange := func(name string, qtype uint16) *D.Msg {
+		m := &D.Msg{}
+		m.SetQuestion(name, qtype)
+		msg, err := handler(nil, m)
+		require.NoError(t, err, name)
+		assert.Equal(t, m.Id, msg.Id)
+		assert.Equal(t, m.Question, msg.Question)
+		return msg
+	}
+
+	// all the IPs of the queried type are answered
+	msg := exchange("multi.example.", D.TypeA)
+	require.Len(t, msg.Answer, 2)
+	assert.Equal(t, net.IP{1, 1, 1, 1}, msg.Answer[0].(*D.A).A.To4())
+	assert.Equal(t, net.IP{2, 2, 2, 2}, msg.Answer[1].(*D.A).A.To4())
+
+	msg = exchange("multi.example.", D.TypeAAAA)
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, net.ParseIP("2001:db8::1"), msg.Answer[0].(*D.AAAA).AAAA)
+
+	// the type without IPs in hosts goes upstream
+	msg = exchange("v4.example.", D.TypeAAAA)
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, net.IP{9, 9, 9, 9}, msg.Answer[0].(*D.A).A.To4())
+
+	msg = exchange("alias.example.", D.TypeA)
+	require.Len(t, msg.Answer, 3)
+	cname := msg.Answer[0].(*D.CNAME)
+	assert.Equal(t, "alias.example.", cname.Hdr.Name)
+	assert.Equal(t, "multi.example.", cname.Target)
+	assert.Equal(t, "multi.example.", msg.Answer[1].Header().Name)
+
+	// the last alias is resolved upstream
+	msg = exchange("cname.example.", D.TypeA)
+	require.Len(t, msg.Answer, 2)
+	assert.Equal(t, "upstream.example.", msg.Answer[0].(*D.CNAME).Target)
+	assert.Equal(t, "upstream.example.", msg.Answer[1].Header().Name)
+	assert.Equal(t, net.IP{9, 9, 9, 9}, msg.Answer[1].(*D.A).A.To4())
+}
@@ -0,0 +1,112 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/dialer"
+	"github.com/Dreamacro/clash/log"
+)
+
+const (
+	ipv6ProbeTTL = 5 * time.Minute
+	// ipv6UnreachableTTL is shorter, so a network gaining IPv6 is noticed soon
+	ipv6UnreachableTTL = 30 * time.Second
+	ipv6ProbeTimeout   = 2 * time.Second
+)
+
+// ipv6ProbeTargets are public DNS servers which accept TCP connections
+var ipv6ProbeTargets = []string{
+	"[2001:4860:4860::8888]:53",
+	"[2606:4700:4700::1111]:53",
+}
+
+var defaultIPv6Prober = &ipv6Prober{check: probeIPv6}
+
+// ipv6Prober checks whether IPv6 is reachable, the result is cached until
+// it expires or is invalidated, and refreshed in background
+type ipv6Prober struct {
+	check func() bool
+
+	mux sync.Mutex
+	// done is closed when the first probe finishes
+	done    chan struct{}
+	result  bool
+	expire  time.Time
+	probing bool
+}
+
+// Reachable returns the last probe result, it only blocks until the first probe finishes
+func (p *ipv6Prober) Reachable() bool {
+	p.mux.Lock()
+	if p.done == nil {
+		p.done = make(chan struct{})
+	}
+	done := p.done
+	if !p.probing && time.Now().After(p.expire) {
+		p.probing = true
+		go p.probe()
+	}
+	p.mux.Unlock()
+
+	<-done
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.result
+}
+
+// invalidate expires the result, the next Reachable probes again, e.g.
+// after the network may have changed
+func (p *ipv6Prober) invalidate() {
+	p.mux.Lock()
+	p.expire = time.Time{}
+	p.mux.Unlock()
+}
+
+func (p *ipv6Prober) probe() {
+	reachable := p.check()
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if reachable != p.result {
+		log.Infoln("[DNS] IPv6 reachable: %t", reachable)
+	}
+	p.result = reachable
+	if reachable {
+		p.expire = time.Now().Add(ipv6ProbeTTL)
+	} else {
+		p.expire = time.Now().Add(ipv6UnreachableTTL)
+	}
+	p.probing = false
+
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+}
+
+func probeIPv6() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), ipv6ProbeTimeout)
+	defer cancel()
+
+	ch := make(chan bool, len(ipv6ProbeTargets))
+	for _, target := range ipv6ProbeTargets {
+		go func(target string) {
+			conn, err := dialer.DialContext(ctx, "tcp6", target)
+			if err == nil {
+				conn.Close()
+			}
+			ch <- err == nil
+		}(target)
+	}
+
+	for range ipv6ProbeTargets {
+		if <-ch {
+			return true
+		}
+	}
+	return false
+}
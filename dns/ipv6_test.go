@@ -0,0 +1,98 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestIPv6Prober_Reprobe(t *testing.T) {
+	probes := atomic.NewInt32(0)
+	reachable := atomic.NewBool(false)
+	p := &ipv6Prober{check: func() bool {
+		probes.Inc()
+		return reachable.Load()
+	}}
+
+	assert.False(t, p.Reachable())
+	assert.Equal(t, int32(1), probes.Load())
+
+	// the result is cached until it expires
+	assert.False(t, p.Reachable())
+	assert.Equal(t, int32(1), probes.Load())
+	p.mux.Lock()
+	assert.WithinDuration(t, time.Now().Add(ipv6UnreachableTTL), p.expire, time.Second)
+	p.mux.Unlock()
+
+	// an invalidated result is probed again in background
+	reachable.Store(true)
+	p.invalidate()
+	p.Reachable()
+	assert.Eventually(t, p.Reachable, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), probes.Load())
+	p.mux.Lock()
+	assert.WithinDuration(t, time.Now().Add(ipv6ProbeTTL), p.expire, time.Second)
+	p.mux.Unlock()
+}
+
+// answerClient answers A questions with 1.1.1.1 and AAAA questions with 2001:db8::1
+type answerClient struct{}
+
+func (answerClient) Exchange(m *D.Msg) (*D.Msg, error) {
+	return answerClient{}.ExchangeContext(context.Background(), m)
+}
+
+func (answerClient) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	msg := &D.Msg{}
+	msg.SetReply(m)
+	q := m.Question[0]
+	if q.Qtype == D.TypeA {
+		rr, _ := D.NewRR(q.Name + " 60 IN A 1.1.1.1")
+		msg.Answer = []D.RR{rr}
+	} else if q.Qtype == D.TypeAAAA {
+		rr, _ := D.NewRR(q.Name + " 60 IN AAAA 2001:db8::1")
+		msg.Answer = []D.RR{rr}
+	}
+	return msg, nil
+}
+
+func (answerClient) Address() string {
+	return "answer"
+}
+
+func TestResolver_IPv6Mode(t *testing.T) {
+	prober := defaultIPv6Prober
+	defer func() { defaultIPv6Prober = prober }()
+
+	tests := []struct {
+		mode      IPv6Mode
+		reachable bool
+		answer    bool
+		ip        string
+	}{
+		{IPv6Disable, true, false, "1.1.1.1"},
+		{IPv6Enable, false, true, "1.1.1.1"},
+		{IPv6Auto, false, false, "1.1.1.1"},
+		{IPv6Auto, true, true, "1.1.1.1"},
+		{IPv6Prefer, false, false, "1.1.1.1"},
+		{IPv6Prefer, true, true, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		reachable := tt.reachable
+		defaultIPv6Prober = &ipv6Prober{check: func() bool { return reachable }}
+
+		r := NewResolver(Config{IPv6: tt.mode})
+		r.main = []dnsClient{answerClient{}}
+		assert.Equal(t, tt.answer, r.answerIPv6(), "mode %d reachable %t", tt.mode, tt.reachable)
+
+		ip, err := r.ResolveIP("example.com")
+		require.NoError(t, err)
+		assert.Equal(t, tt.ip, ip.String(), "mode %d reachable %t", tt.mode, tt.reachable)
+	}
+}
@@ -7,52 +7,81 @@ import (
 
 	"github.com/Dreamacro/clash/common/cache"
 	"github.com/Dreamacro/clash/component/fakeip"
+	"github.com/Dreamacro/clash/component/resolver"
 	"github.com/Dreamacro/clash/component/trie"
 	"github.com/Dreamacro/clash/log"
 
 	D "github.com/miekg/dns"
 )
 
-type handler func(r *D.Msg) (*D.Msg, error)
+type handler func(trace *queryTrace, r *D.Msg) (*D.Msg, error)
 type middleware func(next handler) handler
 
 func withHosts(hosts *trie.DomainTrie) middleware {
 	return func(next handler) handler {
-		return func(r *D.Msg) (*D.Msg, error) {
+		return func(trace *queryTrace, r *D.Msg) (*D.Msg, error) {
 			q := r.Question[0]
 
 			if !isIPRequest(q) {
-				return next(r)
+				return next(trace, r)
 			}
 
-			record := hosts.Search(strings.TrimRight(q.Name, "."))
-			if record == nil {
-				return next(r)
+			aliases, ips, found := resolver.LookupHosts(hosts, strings.TrimRight(q.Name, "."))
+			if !found {
+				return next(trace, r)
 			}
 
-			ip := record.Data.(net.IP)
-			msg := r.Copy()
+			answer := []D.RR{}
+			name := q.Name
+			for _, alias := range aliases {
+				rr := &D.CNAME{}
+				rr.Hdr = D.RR_Header{Name: name, Rrtype: D.TypeCNAME, Class: D.ClassINET, Ttl: dnsDefaultTTL}
+				rr.Target = D.Fqdn(alias)
+				answer = append(answer, rr)
+				name = rr.Target
+			}
 
-			if v4 := ip.To4(); v4 != nil && q.Qtype == D.TypeA {
-				rr := &D.A{}
-				rr.Hdr = D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: dnsDefaultTTL}
-				rr.A = v4
+			if len(ips) == 0 {
+				// the last alias isn't in the hosts, resolve it instead
+				m := r.Copy()
+				m.Question[0].Name = name
+				msg, err := next(trace, m)
+				if err != nil {
+					return nil, err
+				}
+				msg = msg.Copy()
+				msg.Question = r.Question
+				msg.Answer = append(answer, msg.Answer...)
+				msg.Id = r.Id
+				return msg, nil
+			}
 
-				msg.Answer = []D.RR{rr}
-			} else if v6 := ip.To16(); v6 != nil && q.Qtype == D.TypeAAAA {
-				rr := &D.AAAA{}
-				rr.Hdr = D.RR_Header{Name: q.Name, Rrtype: D.TypeAAAA, Class: D.ClassINET, Ttl: dnsDefaultTTL}
-				rr.AAAA = v6
+			for _, ip := range ips {
+				if v4 := ip.To4(); v4 != nil && q.Qtype == D.TypeA {
+					rr := &D.A{}
+					rr.Hdr = D.RR_Header{Name: name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: dnsDefaultTTL}
+					rr.A = v4
+					answer = append(answer, rr)
+				} else if v4 == nil && q.Qtype == D.TypeAAAA {
+					rr := &D.AAAA{}
+					rr.Hdr = D.RR_Header{Name: name, Rrtype: D.TypeAAAA, Class: D.ClassINET, Ttl: dnsDefaultTTL}
+					rr.AAAA = ip
+					answer = append(answer, rr)
+				}
+			}
 
-				msg.Answer = []D.RR{rr}
-			} else {
-				return next(r)
+			// the domain has only the IPs of the other type
+			if len(answer) == 0 {
+				return next(trace, r)
 			}
 
+			msg := r.Copy()
+			msg.Answer = answer
 			msg.SetRcode(r, D.RcodeSuccess)
 			msg.Authoritative = true
 			msg.RecursionAvailable = true
 
+			trace.setSource(sourceHosts)
 			return msg, nil
 		}
 	}
@@ -60,14 +89,14 @@ func withHosts(hosts *trie.DomainTrie) middleware {
 
 func withMapping(mapping *cache.LruCache) middleware {
 	return func(next handler) handler {
-		return func(r *D.Msg) (*D.Msg, error) {
+		return func(trace *queryTrace, r *D.Msg) (*D.Msg, error) {
 			q := r.Question[0]
 
 			if !isIPRequest(q) {
-				return next(r)
+				return next(trace, r)
 			}
 
-			msg, err := next(r)
+			msg, err := next(trace, r)
 			if err != nil {
 				return nil, err
 			}
@@ -97,29 +126,59 @@ func withMapping(mapping *cache.LruCache) middleware {
 	}
 }
 
-func withFakeIP(fakePool *fakeip.Pool) middleware {
+// withFakeIP answers the A and AAAA queries by the fake ips, peek answers by
+// the allocated ones only and doesn't allocate any
+func withFakeIP(fakePool *fakeip.Pool, peek bool) middleware {
+	lookup, lookupIPv6 := fakePool.Lookup, fakePool.LookupIPv6
+	if peek {
+		lookup = func(host string) net.IP {
+			ip, _ := fakePool.Peek(host)
+			return ip
+		}
+		lookupIPv6 = func(host string) net.IP {
+			ip, _ := fakePool.PeekIPv6(host)
+			return ip
+		}
+	}
+
 	return func(next handler) handler {
-		return func(r *D.Msg) (*D.Msg, error) {
+		return func(trace *queryTrace, r *D.Msg) (*D.Msg, error) {
 			q := r.Question[0]
 
 			host := strings.TrimRight(q.Name, ".")
 			if fakePool.LookupHost(host) {
-				return next(r)
+				return next(trace, r)
 			}
 
+			var rr D.RR
 			switch q.Qtype {
-			case D.TypeAAAA, D.TypeSVCB, D.TypeHTTPS:
+			case D.TypeA:
+				ip := lookup(host)
+				if ip == nil {
+					trace.setSource(sourceFakeIP)
+					return handleMsgWithEmptyAnswer(r), nil
+				}
+				rr = &D.A{
+					Hdr: D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: dnsDefaultTTL},
+					A:   ip,
+				}
+			case D.TypeAAAA:
+				ip := lookupIPv6(host)
+				if ip == nil {
+					trace.setSource(sourceFakeIP)
+					return handleMsgWithEmptyAnswer(r), nil
+				}
+				rr = &D.AAAA{
+					Hdr:  D.RR_Header{Name: q.Name, Rrtype: D.TypeAAAA, Class: D.ClassINET, Ttl: dnsDefaultTTL},
+					AAAA: ip,
+				}
+			case D.TypeSVCB, D.TypeHTTPS:
+				trace.setSource(sourceFakeIP)
 				return handleMsgWithEmptyAnswer(r), nil
+			default:
+				return next(trace, r)
 			}
 
-			if q.Qtype != D.TypeA {
-				return next(r)
-			}
-
-			rr := &D.A{}
-			rr.Hdr = D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: dnsDefaultTTL}
-			ip := fakePool.Lookup(host)
-			rr.A = ip
 			msg := r.Copy()
 			msg.Answer = []D.RR{rr}
 
@@ -128,21 +187,23 @@ func withFakeIP(fakePool *fakeip.Pool) middleware {
 			msg.Authoritative = true
 			msg.RecursionAvailable = true
 
+			trace.setSource(sourceFakeIP)
 			return msg, nil
 		}
 	}
 }
 
 func withResolver(resolver *Resolver) handler {
-	return func(r *D.Msg) (*D.Msg, error) {
+	return func(trace *queryTrace, r *D.Msg) (*D.Msg, error) {
 		q := r.Question[0]
 
-		// return a empty AAAA msg when ipv6 disabled
-		if !resolver.ipv6 && q.Qtype == D.TypeAAAA {
+		// return a empty AAAA msg when ipv6 disabled or unreachable
+		if q.Qtype == D.TypeAAAA && !resolver.answerIPv6() {
+			trace.setSource(sourceEmpty)
 			return handleMsgWithEmptyAnswer(r), nil
 		}
 
-		msg, err := resolver.Exchange(r)
+		msg, err := resolver.exchange(r, trace)
 		if err != nil {
 			log.Debugln("[DNS Server] Exchange %s failed: %v", q.String(), err)
 			return msg, err
@@ -165,18 +226,24 @@ func compose(middlewares []middleware, endpoint handler) handler {
 	return h
 }
 
-func newHandler(resolver *Resolver, mapper *ResolverEnhancer) handler {
+// newHandler returns the handler of the DNS server, readOnly doesn't allocate
+// the fake ips or record the mappings of the answers
+func newHandler(resolver *Resolver, mapper *ResolverEnhancer, readOnly bool) handler {
 	middlewares := []middleware{}
 
+	if resolver.rewrites != nil {
+		middlewares = append(middlewares, withRewrite(resolver.rewrites))
+	}
+
 	if resolver.hosts != nil {
 		middlewares = append(middlewares, withHosts(resolver.hosts))
 	}
 
 	if mapper.mode == FAKEIP {
-		middlewares = append(middlewares, withFakeIP(mapper.fakePool))
+		middlewares = append(middlewares, withFakeIP(mapper.fakePool, readOnly))
 	}
 
-	if mapper.mode != NORMAL {
+	if mapper.mode != NORMAL && !readOnly {
 		middlewares = append(middlewares, withMapping(mapper.mapping))
 	}
 
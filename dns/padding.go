@@ -0,0 +1,45 @@
+package dns
+
+import (
+	D "github.com/miekg/dns"
+)
+
+// padMsg returns a copy of m padded to a multiple of blockSize by the EDNS0
+// padding option (RFC 7830), m is returned if blockSize is zero
+func padMsg(m *D.Msg, blockSize int) *D.Msg {
+	if blockSize <= 0 {
+		return m
+	}
+
+	m = m.Copy()
+	opt := m.IsEdns0()
+	if opt == nil {
+		m.SetEdns0(D.DefaultMsgSize, false)
+		opt = m.IsEdns0()
+	}
+	removePadding(opt)
+
+	// the option code and the option length are 4 bytes
+	length := m.Len() + 4
+	padding := (blockSize - length%blockSize) % blockSize
+	opt.Option = append(opt.Option, &D.EDNS0_PADDING{Padding: make([]byte, padding)})
+	return m
+}
+
+// unpadMsg removes the padding of a response, it's meaningless to the
+// clients and the cache
+func unpadMsg(msg *D.Msg) {
+	if opt := msg.IsEdns0(); opt != nil {
+		removePadding(opt)
+	}
+}
+
+func removePadding(opt *D.OPT) {
+	options := opt.Option[:0]
+	for _, option := range opt.Option {
+		if option.Option() != D.EDNS0PADDING {
+			options = append(options, option)
+		}
+	}
+	opt.Option = options
+}
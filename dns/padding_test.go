@@ -0,0 +1,59 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPadMsg_BlockSize(t *testing.T) {
+	for _, name := range []string{"a.com.", "example.com.", "a-much-longer-subdomain.of.example.com."} {
+		for _, blockSize := range []int{128, 468} {
+			m := &D.Msg{}
+			m.SetQuestion(name, D.TypeA)
+
+			padded := padMsg(m, blockSize)
+			buf, err := padded.Pack()
+			require.NoError(t, err)
+			assert.Zero(t, len(buf)%blockSize, "%s %d", name, blockSize)
+
+			// the query itself isn't changed
+			assert.Nil(t, m.IsEdns0())
+		}
+	}
+
+	m := &D.Msg{}
+	m.SetQuestion("example.com.", D.TypeA)
+	assert.Same(t, m, padMsg(m, 0))
+}
+
+func TestPadMsg_KeepOptions(t *testing.T) {
+	m := &D.Msg{}
+	m.SetQuestion("example.com.", D.TypeA)
+	setECS(m, net.ParseIP("1.2.3.4"), 24)
+
+	padded := padMsg(padMsg(m, 128), 128)
+	opt := padded.IsEdns0()
+	require.NotNil(t, opt)
+	require.Len(t, opt.Option, 2)
+	assert.Equal(t, getECS(m), getECS(padded))
+	assert.Equal(t, uint16(D.EDNS0PADDING), opt.Option[1].Option())
+
+	unpadMsg(padded)
+	assert.Equal(t, []D.EDNS0{getECS(m)}, padded.IsEdns0().Option)
+}
+
+func TestUnpadMsg_StripOPT(t *testing.T) {
+	query := &D.Msg{}
+	query.SetQuestion("example.com.", D.TypeA)
+
+	// the OPT added by the padding is removed from the answer to a query
+	// without EDNS
+	answer := padMsg(query, 128)
+	answer.Response = true
+	unpadMsg(answer)
+	assert.Nil(t, stripEDNS(answer, false, false).IsEdns0())
+}
@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"time"
+
+	"github.com/Dreamacro/clash/common/cache"
+
+	D "github.com/miekg/dns"
+	"go.uber.org/atomic"
+)
+
+// Prefetch refreshes the popular cache entries before they expire
+type Prefetch struct {
+	Enable bool
+	// Threshold is the remaining ttl that triggers a prefetch
+	Threshold time.Duration
+	// MinHits is the hits of an entry within its ttl required to be prefetched
+	MinHits int
+	// Concurrency bounds the prefetches in flight
+	Concurrency int
+}
+
+type prefetcher struct {
+	threshold time.Duration
+	minHits   int64
+	hits      *cache.LruCache
+	sem       chan struct{}
+}
+
+func newPrefetcher(p Prefetch) *prefetcher {
+	if !p.Enable {
+		return nil
+	}
+
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &prefetcher{
+		threshold: p.Threshold,
+		minHits:   int64(p.MinHits),
+		hits:      cache.NewLRUCache(cache.WithSize(4096)),
+		sem:       make(chan struct{}, concurrency),
+	}
+}
+
+// hitCounter is the hits of a cache entry within its ttl
+type hitCounter struct {
+	expireTime time.Time
+	count      *atomic.Int64
+}
+
+// hit records a cache hit of key, it returns true if the entry should be
+// prefetched. The hits are counted again for each cache entry of key, so the
+// hits of the previous ttl don't count.
+func (p *prefetcher) hit(key string, expireTime time.Time) bool {
+	var counter *hitCounter
+	if c, ok := p.hits.Get(key); ok && c.(*hitCounter).expireTime.Equal(expireTime) {
+		counter = c.(*hitCounter)
+	} else {
+		counter = &hitCounter{expireTime: expireTime, count: atomic.NewInt64(0)}
+		p.hits.Set(key, counter)
+	}
+
+	return counter.count.Inc() >= p.minHits && time.Until(expireTime) <= p.threshold
+}
+
+// prefetch refreshes the cache of m in background, it is skipped if too many
+// prefetches are in flight
+func (r *Resolver) prefetch(m *D.Msg, key string, expireTime time.Time) {
+	p := r.prefetcher
+	if p == nil || !p.hit(key, expireTime) {
+		return
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		return
+	}
+
+	// count the hits again within the ttl of the new entry
+	p.hits.Delete(key)
+
+	m = m.Copy()
+	go func() {
+		defer func() { <-p.sem }()
+		r.exchangeWithoutCache(m)
+	}()
+}
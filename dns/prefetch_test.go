@@ -0,0 +1,95 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// countingClient answers A questions with 1.1.1.1 and counts the queries
+type countingClient struct {
+	calls *atomic.Int32
+}
+
+func (c countingClient) Exchange(m *D.Msg) (*D.Msg, error) {
+	return c.ExchangeContext(context.Background(), m)
+}
+
+func (c countingClient) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	c.calls.Inc()
+	msg := &D.Msg{}
+	msg.SetReply(m)
+	rr, _ := D.NewRR(m.Question[0].Name + " 60 IN A 1.1.1.1")
+	msg.Answer = []D.RR{rr}
+	return msg, nil
+}
+
+func (c countingClient) Address() string {
+	return "counting"
+}
+
+func TestPrefetcher_HitsPerTTL(t *testing.T) {
+	p := newPrefetcher(Prefetch{Enable: true, Threshold: 2 * time.Minute, MinHits: 3})
+
+	// the hits of an entry aren't carried over to the next entry of the key
+	first := time.Now().Add(30 * time.Second)
+	assert.False(t, p.hit("key", first))
+	assert.False(t, p.hit("key", first))
+
+	second := first.Add(time.Minute)
+	assert.False(t, p.hit("key", second))
+	assert.False(t, p.hit("key", second))
+	assert.True(t, p.hit("key", second))
+
+	// an entry far from expiring isn't prefetched
+	later := time.Now().Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.False(t, p.hit("other", later))
+	}
+}
+
+func TestResolver_Prefetch(t *testing.T) {
+	calls := atomic.NewInt32(0)
+	exchange := func(r *Resolver) {
+		m := &D.Msg{}
+		m.SetQuestion("example.com.", D.TypeA)
+		msg, err := r.Exchange(m)
+		require.NoError(t, err)
+		require.Len(t, msg.Answer, 1)
+	}
+
+	// the answer of 60s is always within the threshold
+	r := NewResolver(Config{Prefetch: Prefetch{Enable: true, Threshold: time.Hour, MinHits: 2, Concurrency: 1}})
+	r.main = []dnsClient{countingClient{calls: calls}}
+
+	exchange(r)
+	assert.Equal(t, int32(1), calls.Load())
+	exchange(r)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// the second hit refreshes the entry in background
+	exchange(r)
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	// and the hits are counted again
+	exchange(r)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), calls.Load())
+	exchange(r)
+	assert.Eventually(t, func() bool { return calls.Load() == 3 }, time.Second, 10*time.Millisecond)
+
+	// no prefetch without enable
+	calls.Store(0)
+	r = NewResolver(Config{})
+	r.main = []dnsClient{countingClient{calls: calls}}
+	for i := 0; i < 5; i++ {
+		exchange(r)
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+}
@@ -0,0 +1,154 @@
+package dns
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/log"
+
+	D "github.com/miekg/dns"
+)
+
+const (
+	cacheHit     = "hit"
+	cacheExpired = "expired"
+	cacheMiss    = "miss"
+
+	sourceHosts    = "hosts"
+	sourceRewrite  = "rewrite"
+	sourceFakeIP   = "fakeip"
+	sourceResolver = "resolver"
+	sourceEmpty    = "empty"
+)
+
+// QueryLog config, the queries handled by the DNS server are logged if Enable,
+// they are appended to File as JSON lines, or written to the log if File is empty
+type QueryLog struct {
+	Enable bool
+	File   string
+}
+
+// queryTrace collects how a query is answered, a nil queryTrace records nothing
+type queryTrace struct {
+	start  time.Time
+	source string
+	cache  string
+	server string
+}
+
+func (t *queryTrace) setSource(source string) {
+	if t != nil {
+		t.source = source
+	}
+}
+
+func (t *queryTrace) setCache(cache, server string) {
+	if t != nil {
+		t.source = sourceResolver
+		t.cache = cache
+		t.server = server
+	}
+}
+
+type queryRecord struct {
+	Time    time.Time `json:"time"`
+	Client  string    `json:"client"`
+	Host    string    `json:"host"`
+	Type    string    `json:"type"`
+	Source  string    `json:"source"`
+	Cache   string    `json:"cache,omitempty"`
+	Server  string    `json:"server,omitempty"`
+	Rcode   string    `json:"rcode,omitempty"`
+	Answers []string  `json:"answers"`
+	Latency string    `json:"latency"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type queryLogger struct {
+	path string
+}
+
+func newQueryLogger(config QueryLog) *queryLogger {
+	if !config.Enable {
+		return nil
+	}
+	return &queryLogger{path: config.File}
+}
+
+// queryLogFile is shared by the loggers, so that the file is kept open across reloads
+var queryLogFile struct {
+	sync.Mutex
+	path string
+	file *os.File
+}
+
+func (l *queryLogger) trace() *queryTrace {
+	if l == nil {
+		return nil
+	}
+	return &queryTrace{start: time.Now()}
+}
+
+func (l *queryLogger) log(trace *queryTrace, client string, r *D.Msg, msg *D.Msg, err error) {
+	if l == nil || trace == nil {
+		return
+	}
+
+	q := r.Question[0]
+	record := &queryRecord{
+		Time:    trace.start,
+		Client:  client,
+		Host:    strings.TrimRight(q.Name, "."),
+		Type:    D.TypeToString[q.Qtype],
+		Source:  trace.source,
+		Cache:   trace.cache,
+		Server:  trace.server,
+		Answers: []string{},
+		Latency: time.Since(trace.start).String(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if msg != nil {
+		record.Rcode = D.RcodeToString[msg.Rcode]
+		record.Answers = msgToAnswers(msg)
+	}
+
+	if l.path == "" {
+		log.Infoln("[DNS] %s %s %s from %s(%s) --> [%s] in %s", record.Client, record.Type, record.Host,
+			record.Source, record.Cache, strings.Join(record.Answers, ", "), record.Latency)
+		return
+	}
+
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	l.write(append(buf, '\n'))
+}
+
+func (l *queryLogger) write(buf []byte) {
+	queryLogFile.Lock()
+	defer queryLogFile.Unlock()
+
+	if queryLogFile.path != l.path {
+		if queryLogFile.file != nil {
+			queryLogFile.file.Close()
+		}
+
+		file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			// don't retry until the path is changed
+			log.Warnln("[DNS] open query log %s failed: %s", l.path, err.Error())
+			file = nil
+		}
+		queryLogFile.path, queryLogFile.file = l.path, file
+	}
+
+	if queryLogFile.file != nil {
+		queryLogFile.file.Write(buf)
+	}
+}
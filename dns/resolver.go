@@ -7,13 +7,17 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/Dreamacro/clash/common/cache"
 	"github.com/Dreamacro/clash/common/picker"
 	"github.com/Dreamacro/clash/component/fakeip"
+	"github.com/Dreamacro/clash/component/geosite"
 	"github.com/Dreamacro/clash/component/resolver"
+	tlsC "github.com/Dreamacro/clash/component/tls"
 	"github.com/Dreamacro/clash/component/trie"
 
 	D "github.com/miekg/dns"
@@ -27,37 +31,66 @@ var (
 type dnsClient interface {
 	Exchange(m *D.Msg) (msg *D.Msg, err error)
 	ExchangeContext(ctx context.Context, m *D.Msg) (msg *D.Msg, err error)
+	// Address is the nameserver address in the form of config
+	Address() string
 }
 
 type result struct {
-	Msg   *D.Msg
-	Error error
+	Msg    *D.Msg
+	Server string
+	Error  error
 }
 
 type Resolver struct {
-	ipv6                  bool
+	ipv6                  IPv6Mode
 	hosts                 *trie.DomainTrie
+	rewrites              *trie.DomainTrie
 	main                  []dnsClient
 	fallback              []dnsClient
 	fallbackDomainFilters []fallbackDomainFilter
 	fallbackIPFilters     []fallbackIPFilter
+	fallbackMode          FilterMode
 	group                 singleflight.Group
 	lruCache              *cache.LruCache
+	cachePolicy           cachePolicy
+	ecs                   *ECS
+	strategy              Strategy
+	upstreamTimeout       time.Duration
+	policy                *trie.DomainTrie
+	geositePolicy         []geositePolicy
+	groups                map[string]*upstreamGroup
+	prefetcher            *prefetcher
+	queryLog              *queryLogger
 }
 
-// ResolveIP request with TypeA and TypeAAAA, priority return TypeA
+// ResolveIP request with TypeA and TypeAAAA, priority return TypeA, or TypeAAAA
+// if ipv6 is prefer and reachable
 func (r *Resolver) ResolveIP(host string) (ip net.IP, err error) {
+	first, second := D.TypeA, D.TypeAAAA
+	switch r.ipv6 {
+	case IPv6Auto:
+		if !defaultIPv6Prober.Reachable() {
+			return r.resolveIP(host, D.TypeA)
+		}
+	case IPv6Prefer:
+		if defaultIPv6Prober.Reachable() {
+			first, second = D.TypeAAAA, D.TypeA
+		} else {
+			return r.resolveIP(host, D.TypeA)
+		}
+	}
+
 	ch := make(chan net.IP, 1)
 	go func() {
 		defer close(ch)
-		ip, err := r.resolveIP(host, D.TypeAAAA)
+		ip, err := r.resolveIP(host, second)
 		if err != nil {
 			return
 		}
 		ch <- ip
 	}()
 
-	ip, err = r.resolveIP(host, D.TypeA)
+	ip, err = r.resolveIP(host, first)
 	if err == nil {
 		return
 	}
@@ -80,7 +113,28 @@ func (r *Resolver) ResolveIPv6(host string) (ip net.IP, err error) {
 	return r.resolveIP(host, D.TypeAAAA)
 }
 
+// answerIPv6 reports whether AAAA questions should be answered
+func (r *Resolver) answerIPv6() bool {
+	switch r.ipv6 {
+	case IPv6Disable:
+		return false
+	case IPv6Auto, IPv6Prefer:
+		return defaultIPv6Prober.Reachable()
+	default:
+		return true
+	}
+}
+
 func (r *Resolver) shouldIPFallback(ip net.IP) bool {
+	if r.fallbackMode == FilterModeAnd {
+		for _, filter := range r.fallbackIPFilters {
+			if !filter.Match(ip) {
+				return false
+			}
+		}
+		return len(r.fallbackIPFilters) != 0
+	}
+
 	for _, filter := range r.fallbackIPFilters {
 		if filter.Match(ip) {
 			return true
@@ -89,73 +143,121 @@ func (r *Resolver) shouldIPFallback(ip net.IP) bool {
 	return false
 }
 
-// Exchange a batch of dns request, and it use cache
+// Exchange a batch of dns request, and it use cache. The rewrite rules are
+// applied before the cache.
 func (r *Resolver) Exchange(m *D.Msg) (msg *D.Msg, err error) {
+	if r.rewrites == nil || len(m.Question) == 0 {
+		return r.exchange(m, nil)
+	}
+
+	return withRewrite(r.rewrites)(func(trace *queryTrace, m *D.Msg) (*D.Msg, error) {
+		return r.exchange(m, trace)
+	})(nil, m)
+}
+
+// exchange is Exchange which records the cache status and the nameserver to trace
+func (r *Resolver) exchange(m *D.Msg, trace *queryTrace) (msg *D.Msg, err error) {
 	if len(m.Question) == 0 {
 		return nil, errors.New("should have one question at least")
 	}
 
-	q := m.Question[0]
-	cache, expireTime, hit := r.lruCache.GetWithExpire(q.String())
+	if r.ecs != nil {
+		m = m.Copy()
+		r.ecs.apply(m, nil)
+	}
+
+	key := cacheKey(m)
+	cache, expireTime, hit := r.lruCache.GetWithExpire(key)
 	if hit {
 		now := time.Now()
 		msg = cache.(*D.Msg).Copy()
+		msg.Id = m.Id
 		if expireTime.Before(now) {
 			setMsgTTL(msg, uint32(1)) // Continue fetch
 			go r.exchangeWithoutCache(m)
+			trace.setCache(cacheExpired, "")
 		} else {
 			setMsgTTL(msg, uint32(time.Until(expireTime).Seconds()))
+			r.prefetch(m, key, expireTime)
+			trace.setCache(cacheHit, "")
 		}
 		return
 	}
-	return r.exchangeWithoutCache(m)
-}
-
-// ExchangeWithoutCache a batch of dns request, and it do NOT GET from cache
-func (r *Resolver) exchangeWithoutCache(m *D.Msg) (msg *D.Msg, err error) {
-	q := m.Question[0]
-
-	ret, err, shared := r.group.Do(q.String(), func() (result interface{}, err error) {
-		defer func() {
-			if err != nil {
-				return
-			}
 
-			msg := result.(*D.Msg)
+	msg, server, err := r.exchangeWithoutCache(m)
+	trace.setCache(cacheMiss, server)
+	return msg, err
+}
 
-			putMsgToCache(r.lruCache, q.String(), msg)
-		}()
+// ExchangeWithoutCache a batch of dns request, and it do NOT GET from cache,
+// server is the nameserver which answers. The concurrent queries of the same
+// question and ECS subnet share one upstream exchange, its answer or error is
+// returned to all of them and the answer is cached once.
+func (r *Resolver) exchangeWithoutCache(m *D.Msg) (msg *D.Msg, server string, err error) {
+	key := cacheKey(m)
 
-		isIPReq := isIPRequest(q)
-		if isIPReq {
-			return r.ipExchange(m)
+	ret, err, shared := r.group.Do(key, func() (interface{}, error) {
+		msg, server, err := r.exchangeUpstream(m)
+		if err != nil {
+			return nil, err
 		}
 
-		return r.batchExchange(r.main, m)
+		emitDNSRecord(m, msg)
+		if ecsCacheable(m, msg) {
+			putMsgToCache(r.lruCache, key, msg, r.cachePolicy)
+		}
+		return &result{Msg: msg, Server: server}, nil
 	})
 
 	if err == nil {
-		msg = ret.(*D.Msg)
+		res := ret.(*result)
+		msg, server = res.Msg, res.Server
 		if shared {
 			msg = msg.Copy()
+			msg.Id = m.Id
 		}
 	}
 
 	return
 }
 
-func (r *Resolver) batchExchange(clients []dnsClient, m *D.Msg) (msg *D.Msg, err error) {
+func (r *Resolver) exchangeUpstream(m *D.Msg) (msg *D.Msg, server string, err error) {
+	if group := r.matchPolicy(m); group != nil {
+		return r.groupExchange(group, m)
+	}
+
+	if r.strategy == StrategyParallel {
+		return r.batchExchange(append(append([]dnsClient{}, r.main...), r.fallback...), m, r.upstreamTimeout)
+	}
+
+	isIPReq := isIPRequest(m.Question[0])
+	if isIPReq {
+		return r.ipExchange(m)
+	}
+
+	return r.batchExchange(r.main, m, r.upstreamTimeout)
+}
+
+// batchExchange races the clients, timeout limits each client if it isn't zero
+func (r *Resolver) batchExchange(clients []dnsClient, m *D.Msg, timeout time.Duration) (msg *D.Msg, server string, err error) {
 	fast, ctx := picker.WithTimeout(context.Background(), time.Second*5)
 	for _, client := range clients {
-		r := client
+		c := client
 		fast.Go(func() (interface{}, error) {
-			m, err := r.ExchangeContext(ctx, m)
+			ctx := ctx
+			if timeout != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			m, err := c.ExchangeContext(ctx, m)
 			if err != nil {
 				return nil, err
 			} else if m.Rcode == D.RcodeServerFailure || m.Rcode == D.RcodeRefused {
 				return nil, errors.New("server failure")
 			}
-			return m, nil
+			return &result{Msg: m, Server: c.Address()}, nil
 		})
 	}
 
@@ -165,11 +267,47 @@ func (r *Resolver) batchExchange(clients []dnsClient, m *D.Msg) (msg *D.Msg, err
 		if fErr := fast.Error(); fErr != nil {
 			err = fmt.Errorf("%w, first error: %s", err, fErr.Error())
 		}
-		return nil, err
+		return nil, "", err
 	}
 
-	msg = elm.(*D.Msg)
-	return
+	res := elm.(*result)
+	return res.Msg, res.Server, nil
+}
+
+// GeoSitePolicyPrefix is the prefix of a geosite category in Config.Policy
+const GeoSitePolicyPrefix = "geosite:"
+
+// geositePolicy pins the domains in a geosite category to a group
+type geositePolicy struct {
+	code  string
+	group *upstreamGroup
+}
+
+// matchPolicy matches the domain patterns before the geosite categories,
+// which are matched in the order of their codes
+func (r *Resolver) matchPolicy(m *D.Msg) *upstreamGroup {
+	if r.policy == nil && len(r.geositePolicy) == 0 {
+		return nil
+	}
+
+	domain := r.msgToDomain(m)
+	if domain == "" {
+		return nil
+	}
+	domain = strings.ToLower(domain)
+
+	if r.policy != nil {
+		if record := r.policy.Search(domain); record != nil {
+			return record.Data.(*upstreamGroup)
+		}
+	}
+
+	for _, p := range r.geositePolicy {
+		if geosite.Match(p.code, domain) {
+			return p.group
+		}
+	}
+	return nil
 }
 
 func (r *Resolver) shouldOnlyQueryFallback(m *D.Msg) bool {
@@ -177,6 +315,25 @@ func (r *Resolver) shouldOnlyQueryFallback(m *D.Msg) bool {
 		return false
 	}
 
+	// the answer has to match the ip filters as well
+	if r.fallbackMode == FilterModeAnd && len(r.fallbackIPFilters) != 0 {
+		return false
+	}
+
+	return r.matchDomainFallback(m)
+}
+
+// shouldSkipFallback reports whether the fallback servers are never used by m,
+// the domain filters have to match in the and mode
+func (r *Resolver) shouldSkipFallback(m *D.Msg) bool {
+	if r.fallbackMode != FilterModeAnd || len(r.fallbackDomainFilters) == 0 {
+		return false
+	}
+
+	return !r.matchDomainFallback(m)
+}
+
+func (r *Resolver) matchDomainFallback(m *D.Msg) bool {
 	domain := r.msgToDomain(m)
 
 	if domain == "" {
@@ -192,21 +349,22 @@ func (r *Resolver) shouldOnlyQueryFallback(m *D.Msg) bool {
 	return false
 }
 
-func (r *Resolver) ipExchange(m *D.Msg) (msg *D.Msg, err error) {
+func (r *Resolver) ipExchange(m *D.Msg) (msg *D.Msg, server string, err error) {
 
 	onlyFallback := r.shouldOnlyQueryFallback(m)
 
 	if onlyFallback {
 		res := <-r.asyncExchange(r.fallback, m)
-		return res.Msg, res.Error
+		return res.Msg, res.Server, res.Error
 	}
 
 	msgCh := r.asyncExchange(r.main, m)
 
-	if r.fallback == nil { // directly return if no fallback servers are available
+	// directly return if no fallback servers are available, or the domain
+	// filters of the and mode don't match
+	if r.fallback == nil || r.shouldSkipFallback(m) {
 		res := <-msgCh
-		msg, err = res.Msg, res.Error
-		return
+		return res.Msg, res.Server, res.Error
 	}
 
 	fallbackMsg := r.asyncExchange(r.fallback, m)
@@ -214,16 +372,14 @@ func (r *Resolver) ipExchange(m *D.Msg) (msg *D.Msg, err error) {
 	if res.Error == nil {
 		if ips := r.msgToIP(res.Msg); len(ips) != 0 {
 			if !r.shouldIPFallback(ips[0]) {
-				msg = res.Msg // no need to wait for fallback result
-				err = res.Error
-				return msg, err
+				// no need to wait for fallback result
+				return res.Msg, res.Server, res.Error
 			}
 		}
 	}
 
 	res = <-fallbackMsg
-	msg, err = res.Msg, res.Error
-	return
+	return res.Msg, res.Server, res.Error
 }
 
 func (r *Resolver) resolveIP(host string, dnsType uint16) (ip net.IP, err error) {
@@ -283,48 +439,153 @@ func (r *Resolver) msgToDomain(msg *D.Msg) string {
 func (r *Resolver) asyncExchange(client []dnsClient, msg *D.Msg) <-chan *result {
 	ch := make(chan *result, 1)
 	go func() {
-		res, err := r.batchExchange(client, msg)
-		ch <- &result{Msg: res, Error: err}
+		res, server, err := r.batchExchange(client, msg, r.upstreamTimeout)
+		ch <- &result{Msg: res, Server: server, Error: err}
 	}()
 	return ch
 }
 
+// FlushCache removes the cached answers of name and qtype and returns the
+// number of removed answers. Empty name means all names, and `+.` prefix
+// means the domain and its subdomains. Zero qtype means all types.
+func (r *Resolver) FlushCache(name string, qtype uint16) int {
+	match := newNameMatcher(name)
+	return r.lruCache.DeleteFunc(func(key interface{}, value interface{}) bool {
+		msg, ok := value.(*D.Msg)
+		if !ok || len(msg.Question) == 0 {
+			return false
+		}
+
+		q := msg.Question[0]
+		return (qtype == 0 || q.Qtype == qtype) && match(q.Name)
+	})
+}
+
+// newNameMatcher returns the matcher of the name syntax of FlushCache
+func newNameMatcher(name string) func(string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return func(string) bool { return true }
+	}
+
+	suffix := strings.HasPrefix(name, "+.")
+	name = strings.TrimPrefix(name, "+.")
+	return func(host string) bool {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		return host == name || (suffix && strings.HasSuffix(host, "."+name))
+	}
+}
+
 type NameServer struct {
 	Net  string
 	Addr string
+	// Method and Headers are the request options of DoH
+	Method  string
+	Headers http.Header
+	// Fingerprint and MinVersion are the TLS options of DoH and DoT
+	Fingerprint *tlsC.Fingerprint
+	MinVersion  uint16
+	// Padding is the EDNS0 padding block size of DoH and DoT, zero means
+	// no padding. DoQ isn't padded as there is no DoQ client.
+	Padding int
 }
 
 type FallbackFilter struct {
-	GeoIP  bool
-	IPCIDR []*net.IPNet
-	Domain []string
+	GeoIP   bool
+	IPCIDR  []*net.IPNet
+	Domain  []string
+	GeoSite []string
+	Mode    FilterMode
 }
 
 type Config struct {
 	Main, Fallback []NameServer
 	Default        []NameServer
-	IPv6           bool
+	IPv6           IPv6Mode
 	EnhancedMode   EnhancedMode
 	FallbackFilter FallbackFilter
 	Pool           *fakeip.Pool
 	Hosts          *trie.DomainTrie
+	Rewrites       []RewriteRule
+	CacheTTL       CacheTTL
+	ECS            *ECS
+	Strategy       Strategy
+	// UpstreamTimeout limits a single nameserver, zero means only the query deadline applies
+	UpstreamTimeout time.Duration
+	// Policy pins the domains to a group of Groups instead of the main
+	// nameservers, a "geosite:" prefixed key pins the geosite category
+	Policy   map[string]string
+	Groups   map[string]NameServerGroup
+	Prefetch Prefetch
+	QueryLog QueryLog
+	DoTPool  DoTPool
+}
+
+// CacheTTL clamps the ttl of cached answers, zero means no limit
+type CacheTTL struct {
+	Min         uint32
+	Max         uint32
+	NegativeMax uint32
 }
 
 func NewResolver(config Config) *Resolver {
+	policy := cachePolicy{
+		minTTL:         config.CacheTTL.Min,
+		maxTTL:         config.CacheTTL.Max,
+		negativeMaxTTL: config.CacheTTL.NegativeMax,
+	}
+
 	defaultResolver := &Resolver{
-		main:     transform(config.Default, nil),
-		lruCache: cache.NewLRUCache(cache.WithSize(4096), cache.WithStale(true)),
+		main:        transform(config.Default, nil, config.DoTPool),
+		lruCache:    cache.NewLRUCache(cache.WithSize(4096), cache.WithStale(true)),
+		cachePolicy: policy,
 	}
 
 	r := &Resolver{
-		ipv6:     config.IPv6,
-		main:     transform(config.Main, defaultResolver),
-		lruCache: cache.NewLRUCache(cache.WithSize(4096), cache.WithStale(true)),
-		hosts:    config.Hosts,
+		ipv6:            config.IPv6,
+		main:            transform(config.Main, defaultResolver, config.DoTPool),
+		lruCache:        cache.NewLRUCache(cache.WithSize(4096), cache.WithStale(true)),
+		hosts:           config.Hosts,
+		rewrites:        newRewriteTrie(config.Rewrites),
+		cachePolicy:     policy,
+		ecs:             config.ECS,
+		strategy:        config.Strategy,
+		upstreamTimeout: config.UpstreamTimeout,
+		prefetcher:      newPrefetcher(config.Prefetch),
+		queryLog:        newQueryLogger(config.QueryLog),
 	}
 
 	if len(config.Fallback) != 0 {
-		r.fallback = transform(config.Fallback, defaultResolver)
+		r.fallback = transform(config.Fallback, defaultResolver, config.DoTPool)
+	}
+
+	// the network may have changed since the last config, e.g. the interface
+	defaultIPv6Prober.invalidate()
+
+	if len(config.Policy) != 0 {
+		// the domains targeting a group share its clients
+		groups := map[string]*upstreamGroup{}
+		r.policy = trie.New()
+		for domain, name := range config.Policy {
+			group, ok := groups[name]
+			if !ok {
+				g, exist := config.Groups[name]
+				if !exist {
+					continue
+				}
+				group = newUpstreamGroup(g, defaultResolver, config.DoTPool)
+				groups[name] = group
+			}
+			if code := strings.TrimPrefix(domain, GeoSitePolicyPrefix); code != domain {
+				r.geositePolicy = append(r.geositePolicy, geositePolicy{code: code, group: group})
+				continue
+			}
+			r.policy.Insert(domain, group)
+		}
+		sort.Slice(r.geositePolicy, func(i, j int) bool {
+			return r.geositePolicy[i].code < r.geositePolicy[j].code
+		})
+		r.groups = groups
 	}
 
 	fallbackIPFilters := []fallbackIPFilter{}
@@ -336,10 +597,15 @@ func NewResolver(config Config) *Resolver {
 	}
 	r.fallbackIPFilters = fallbackIPFilters
 
+	fallbackDomainFilters := []fallbackDomainFilter{}
 	if len(config.FallbackFilter.Domain) != 0 {
-		fallbackDomainFilters := []fallbackDomainFilter{NewDomainFilter(config.FallbackFilter.Domain)}
-		r.fallbackDomainFilters = fallbackDomainFilters
+		fallbackDomainFilters = append(fallbackDomainFilters, NewDomainFilter(config.FallbackFilter.Domain))
+	}
+	if len(config.FallbackFilter.GeoSite) != 0 {
+		fallbackDomainFilters = append(fallbackDomainFilters, &geositeFilter{codes: config.FallbackFilter.GeoSite})
 	}
+	r.fallbackDomainFilters = fallbackDomainFilters
+	r.fallbackMode = config.FallbackFilter.Mode
 
 	return r
 }
@@ -0,0 +1,231 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Dreamacro/clash/component/trie"
+
+	D "github.com/miekg/dns"
+)
+
+// RewriteRule overrides the answer of the names matching Name, which is a
+// domain of the hosts syntax. Type limits the rule to a qtype, empty means
+// A and AAAA for Answer, or all qtypes for CNAME and Rcode.
+//
+// Answer is the IPs if Type is empty, or the RDATA of Type. CNAME redirects
+// the question to the target. Rcode returns an empty answer, e.g. NXDOMAIN to
+// block the name. Zero TTL means the default TTL.
+type RewriteRule struct {
+	Name   string
+	Type   string
+	Answer []string
+	CNAME  string
+	Rcode  string
+	TTL    uint32
+}
+
+// rewriteRule is a parsed RewriteRule
+type rewriteRule struct {
+	qtype  uint16
+	answer []string
+	cname  string
+	rcode  int
+	ttl    uint32
+}
+
+func parseRewriteRule(rule RewriteRule) (*rewriteRule, error) {
+	r := &rewriteRule{
+		answer: rule.Answer,
+		cname:  rule.CNAME,
+		ttl:    rule.TTL,
+	}
+	if r.ttl == 0 {
+		r.ttl = dnsDefaultTTL
+	}
+
+	actions := 0
+	for _, set := range []bool{len(rule.Answer) != 0, rule.CNAME != "", rule.Rcode != ""} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return nil, errors.New("one of answer, cname and rcode is required")
+	}
+
+	if rule.Type != "" {
+		qtype, ok := D.StringToType[strings.ToUpper(rule.Type)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported type: %s", rule.Type)
+		}
+		r.qtype = qtype
+	}
+
+	if rule.Rcode != "" {
+		rcode, ok := D.StringToRcode[strings.ToUpper(rule.Rcode)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported rcode: %s", rule.Rcode)
+		}
+		r.rcode = rcode
+	}
+
+	if r.qtype == 0 {
+		for _, value := range r.answer {
+			if net.ParseIP(value) == nil {
+				return nil, fmt.Errorf("%s isn't an IP, the type is required for the other answers", value)
+			}
+		}
+	} else if _, err := r.records(D.Question{Name: "rewrite.invalid.", Qtype: r.qtype}); err != nil {
+		return nil, fmt.Errorf("invalid answer: %w", err)
+	}
+
+	return r, nil
+}
+
+// VerifyRewriteRule returns the error of the type, answer or rcode of rule
+func VerifyRewriteRule(rule RewriteRule) error {
+	_, err := parseRewriteRule(rule)
+	return err
+}
+
+// match reports whether the rule answers qtype
+func (r *rewriteRule) match(qtype uint16) bool {
+	if r.qtype != 0 {
+		return r.qtype == qtype
+	}
+	if len(r.answer) != 0 {
+		return qtype == D.TypeA || qtype == D.TypeAAAA
+	}
+	return true
+}
+
+// records returns the answer of the rule for q, the IPs of the other family
+// are skipped
+func (r *rewriteRule) records(q D.Question) ([]D.RR, error) {
+	hdr := D.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: D.ClassINET, Ttl: r.ttl}
+
+	answer := []D.RR{}
+	for _, value := range r.answer {
+		if r.qtype != 0 {
+			rr, err := D.NewRR(fmt.Sprintf("%s %d IN %s %s", q.Name, r.ttl, D.TypeToString[r.qtype], value))
+			if err != nil {
+				return nil, err
+			}
+			answer = append(answer, rr)
+			continue
+		}
+
+		ip := net.ParseIP(value)
+		if v4 := ip.To4(); v4 != nil && q.Qtype == D.TypeA {
+			answer = append(answer, &D.A{Hdr: hdr, A: v4})
+		} else if v4 == nil && q.Qtype == D.TypeAAAA {
+			answer = append(answer, &D.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+	return answer, nil
+}
+
+// newRewriteTrie groups the rules by the name, the first rule of a name
+// matching the qtype is applied. The invalid rules are skipped.
+func newRewriteTrie(rules []RewriteRule) *trie.DomainTrie {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	names := map[string][]*rewriteRule{}
+	order := []string{}
+	for _, rule := range rules {
+		r, err := parseRewriteRule(rule)
+		if err != nil {
+			continue
+		}
+		if _, ok := names[rule.Name]; !ok {
+			order = append(order, rule.Name)
+		}
+		names[rule.Name] = append(names[rule.Name], r)
+	}
+
+	tree := trie.New()
+	for _, name := range order {
+		tree.Insert(name, names[name])
+	}
+	return tree
+}
+
+func withRewrite(rewrites *trie.DomainTrie) middleware {
+	return func(next handler) handler {
+		return func(trace *queryTrace, r *D.Msg) (*D.Msg, error) {
+			q := r.Question[0]
+
+			node := rewrites.Search(strings.TrimRight(q.Name, "."))
+			if node == nil {
+				return next(trace, r)
+			}
+
+			var rule *rewriteRule
+			for _, candidate := range node.Data.([]*rewriteRule) {
+				if candidate.match(q.Qtype) {
+					rule = candidate
+					break
+				}
+			}
+			if rule == nil {
+				return next(trace, r)
+			}
+
+			if rule.cname != "" {
+				return rewriteCNAME(trace, r, rule, next)
+			}
+
+			answer, err := rule.records(q)
+			if err != nil {
+				return nil, err
+			}
+
+			msg := r.Copy()
+			msg.Answer = answer
+			msg.SetRcode(r, rule.rcode)
+			msg.Authoritative = true
+			msg.RecursionAvailable = true
+
+			trace.setSource(sourceRewrite)
+			return msg, nil
+		}
+	}
+}
+
+// rewriteCNAME answers the CNAME of rule, and the answer of the target by next
+// unless the question is CNAME
+func rewriteCNAME(trace *queryTrace, r *D.Msg, rule *rewriteRule, next handler) (*D.Msg, error) {
+	q := r.Question[0]
+	cname := &D.CNAME{
+		Hdr:    D.RR_Header{Name: q.Name, Rrtype: D.TypeCNAME, Class: D.ClassINET, Ttl: rule.ttl},
+		Target: D.Fqdn(rule.cname),
+	}
+
+	if q.Qtype == D.TypeCNAME {
+		msg := r.Copy()
+		msg.Answer = []D.RR{cname}
+		msg.SetRcode(r, D.RcodeSuccess)
+		msg.Authoritative = true
+		msg.RecursionAvailable = true
+
+		trace.setSource(sourceRewrite)
+		return msg, nil
+	}
+
+	m := r.Copy()
+	m.Question[0].Name = cname.Target
+	msg, err := next(trace, m)
+	if err != nil {
+		return nil, err
+	}
+	msg = msg.Copy()
+	msg.Question = r.Question
+	msg.Answer = append([]D.RR{cname}, msg.Answer...)
+	msg.Id = r.Id
+	return msg, nil
+}
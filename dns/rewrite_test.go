@@ -0,0 +1,132 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRewriteRule(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		rule RewriteRule
+		err  bool
+	}{
+		{"ips", RewriteRule{Answer: []string{"1.1.1.1", "::1"}}, false},
+		{"typed answer", RewriteRule{Type: "txt", Answer: []string{`"hello"`}}, false},
+		{"cname", RewriteRule{CNAME: "example.org"}, false},
+		{"rcode", RewriteRule{Rcode: "nxdomain"}, false},
+		{"no action", RewriteRule{}, true},
+		{"two actions", RewriteRule{CNAME: "example.org", Rcode: "NXDOMAIN"}, true},
+		{"untyped non-ip", RewriteRule{Answer: []string{"example.org"}}, true},
+		{"unsupported type", RewriteRule{Type: "FOO", Answer: []string{"1.1.1.1"}}, true},
+		{"invalid typed answer", RewriteRule{Type: "A", Answer: []string{"example.org"}}, true},
+		{"unsupported rcode", RewriteRule{Rcode: "FOO"}, true},
+	} {
+		err := VerifyRewriteRule(tt.rule)
+		if tt.err {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestRewriteRule_Match(t *testing.T) {
+	ips, _ := parseRewriteRule(RewriteRule{Answer: []string{"1.1.1.1"}})
+	assert.True(t, ips.match(D.TypeA))
+	assert.True(t, ips.match(D.TypeAAAA))
+	assert.False(t, ips.match(D.TypeMX))
+
+	typed, _ := parseRewriteRule(RewriteRule{Type: "MX", Answer: []string{"10 mail.example.com."}})
+	assert.True(t, typed.match(D.TypeMX))
+	assert.False(t, typed.match(D.TypeA))
+
+	rcode, _ := parseRewriteRule(RewriteRule{Rcode: "NXDOMAIN"})
+	assert.True(t, rcode.match(D.TypeTXT))
+}
+
+func TestRewriteRule_Records(t *testing.T) {
+	rule, err := parseRewriteRule(RewriteRule{Answer: []string{"1.1.1.1", "2606:4700::1111"}, TTL: 60})
+	require.NoError(t, err)
+
+	// the IPs of the other family are skipped
+	answer, err := rule.records(D.Question{Name: "example.com.", Qtype: D.TypeA})
+	require.NoError(t, err)
+	require.Len(t, answer, 1)
+	assert.Equal(t, net.IPv4(1, 1, 1, 1).To4(), answer[0].(*D.A).A)
+	assert.Equal(t, uint32(60), answer[0].Header().Ttl)
+
+	answer, err = rule.records(D.Question{Name: "example.com.", Qtype: D.TypeAAAA})
+	require.NoError(t, err)
+	require.Len(t, answer, 1)
+	assert.Equal(t, net.ParseIP("2606:4700::1111"), answer[0].(*D.AAAA).AAAA)
+
+	// zero ttl is the default ttl
+	rule, err = parseRewriteRule(RewriteRule{Rcode: "NXDOMAIN"})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(dnsDefaultTTL), rule.ttl)
+}
+
+func TestWithRewrite(t *testing.T) {
+	rewrites := newRewriteTrie([]RewriteRule{
+		{Name: "fixed.example.com", Answer: []string{"1.1.1.1"}},
+		{Name: "fixed.example.com", Type: "TXT", Answer: []string{`"hello"`}},
+		{Name: "+.blocked.example.com", Rcode: "NXDOMAIN"},
+		{Name: "alias.example.com", CNAME: "target.example.com"},
+		// invalid rules are skipped
+		{Name: "invalid.example.com"},
+	})
+
+	upstream := func(trace *queryTrace, r *D.Msg) (*D.Msg, error) {
+		msg := &D.Msg{}
+		msg.SetReply(r)
+		rr, _ := D.NewRR(r.Question[0].Name + " 300 IN A 2.2.2.2")
+		msg.Answer = []D.RR{rr}
+		return msg, nil
+	}
+	h := withRewrite(rewrites)(upstream)
+
+	query := func(name string, qtype uint16) (*D.Msg, *queryTrace) {
+		r := &D.Msg{}
+		r.SetQuestion(name, qtype)
+		trace := &queryTrace{}
+		msg, err := h(trace, r)
+		require.NoError(t, err, name)
+		return msg, trace
+	}
+
+	msg, trace := query("fixed.example.com.", D.TypeA)
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, "1.1.1.1", msg.Answer[0].(*D.A).A.String())
+	assert.Equal(t, sourceRewrite, trace.source)
+
+	msg, _ = query("fixed.example.com.", D.TypeTXT)
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, []string{"hello"}, msg.Answer[0].(*D.TXT).Txt)
+
+	// no rule of the name matches the qtype
+	msg, trace = query("fixed.example.com.", D.TypeMX)
+	assert.Equal(t, "2.2.2.2", msg.Answer[0].(*D.A).A.String())
+	assert.Empty(t, trace.source)
+
+	msg, _ = query("a.blocked.example.com.", D.TypeA)
+	assert.Equal(t, D.RcodeNameError, msg.Rcode)
+	assert.Empty(t, msg.Answer)
+
+	msg, _ = query("alias.example.com.", D.TypeA)
+	assert.Equal(t, "alias.example.com.", msg.Question[0].Name)
+	require.Len(t, msg.Answer, 2)
+	assert.Equal(t, "target.example.com.", msg.Answer[0].(*D.CNAME).Target)
+	assert.Equal(t, "target.example.com.", msg.Answer[1].Header().Name)
+
+	msg, _ = query("alias.example.com.", D.TypeCNAME)
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, "target.example.com.", msg.Answer[0].(*D.CNAME).Target)
+
+	msg, _ = query("invalid.example.com.", D.TypeA)
+	assert.Equal(t, "2.2.2.2", msg.Answer[0].(*D.A).A.String())
+}
@@ -18,7 +18,9 @@ var (
 
 type Server struct {
 	*D.Server
-	handler handler
+	handler  handler
+	ecs      *ECS
+	queryLog *queryLogger
 }
 
 func (s *Server) ServeDNS(w D.ResponseWriter, r *D.Msg) {
@@ -27,23 +29,36 @@ func (s *Server) ServeDNS(w D.ResponseWriter, r *D.Msg) {
 		return
 	}
 
-	msg, err := s.handler(r)
+	// the answer doesn't carry the EDNS added to the query
+	hadOPT, hadECS := r.IsEdns0() != nil, getECS(r) != nil
+	if s.ecs != nil && s.ecs.Auto {
+		if addr, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+			s.ecs.apply(r, addr.IP)
+		}
+	}
+
+	trace := s.queryLog.trace()
+	msg, err := s.handler(trace, r)
+	s.queryLog.log(trace, w.RemoteAddr().String(), r, msg, err)
+	countQuery(r, msg, err)
 	if err != nil {
 		D.HandleFailed(w, r)
 		return
 	}
 
-	w.WriteMsg(msg)
+	w.WriteMsg(stripEDNS(msg, hadOPT, hadECS))
 }
 
-func (s *Server) setHandler(handler handler) {
+func (s *Server) setHandler(handler handler, resolver *Resolver) {
 	s.handler = handler
+	s.ecs = resolver.ecs
+	s.queryLog = resolver.queryLog
 }
 
 func ReCreateServer(addr string, resolver *Resolver, mapper *ResolverEnhancer) error {
 	if addr == address && resolver != nil {
-		handler := newHandler(resolver, mapper)
-		server.setHandler(handler)
+		handler := newHandler(resolver, mapper, false)
+		server.setHandler(handler, resolver)
 		return nil
 	}
 
@@ -74,8 +89,9 @@ func ReCreateServer(addr string, resolver *Resolver, mapper *ResolverEnhancer) e
 	}
 
 	address = addr
-	handler := newHandler(resolver, mapper)
-	server = &Server{handler: handler}
+	handler := newHandler(resolver, mapper, false)
+	server = &Server{}
+	server.setHandler(handler, resolver)
 	server.Server = &D.Server{Addr: addr, PacketConn: p, Handler: server}
 
 	go func() {
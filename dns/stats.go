@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"sort"
+	"sync"
+
+	D "github.com/miekg/dns"
+	"go.uber.org/atomic"
+)
+
+// resultFailed is the result of the queries which the server failed to answer
+const resultFailed = "FAILED"
+
+type queryStatKey struct {
+	qtype  string
+	result string
+}
+
+// queryStats counts the queries handled by the DNS server by type and result,
+// the keys are bounded by the known types and rcodes
+var queryStats sync.Map
+
+// QueryStat is the number of the queries of a type and a result, the result
+// is the rcode of the response, or FAILED if the server failed to answer
+type QueryStat struct {
+	Type   string `json:"type"`
+	Result string `json:"result"`
+	Count  int64  `json:"count"`
+}
+
+func countQuery(r *D.Msg, msg *D.Msg, err error) {
+	qtype, ok := D.TypeToString[r.Question[0].Qtype]
+	if !ok {
+		qtype = "OTHER"
+	}
+
+	result := resultFailed
+	if err == nil && msg != nil {
+		if result, ok = D.RcodeToString[msg.Rcode]; !ok {
+			result = "OTHER"
+		}
+	}
+
+	key := queryStatKey{qtype: qtype, result: result}
+	counter, ok := queryStats.Load(key)
+	if !ok {
+		counter, _ = queryStats.LoadOrStore(key, atomic.NewInt64(0))
+	}
+	counter.(*atomic.Int64).Inc()
+}
+
+// QueryStats returns the query counts sorted by type and result
+func QueryStats() []QueryStat {
+	stats := []QueryStat{}
+	queryStats.Range(func(key, value interface{}) bool {
+		k := key.(queryStatKey)
+		stats = append(stats, QueryStat{Type: k.qtype, Result: k.result, Count: value.(*atomic.Int64).Load()})
+		return true
+	})
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Type != stats[j].Type {
+			return stats[i].Type < stats[j].Type
+		}
+		return stats[i].Result < stats[j].Result
+	})
+	return stats
+}
@@ -1,10 +1,10 @@
 package dns
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/Dreamacro/clash/common/cache"
@@ -20,6 +20,18 @@ var (
 		FAKEIP.String():  FAKEIP,
 		MAPPING.String(): MAPPING,
 	}
+
+	// StrategyMapping is a mapping for Strategy enum
+	StrategyMapping = map[string]Strategy{
+		StrategyFallback.String(): StrategyFallback,
+		StrategyParallel.String(): StrategyParallel,
+	}
+
+	// FilterModeMapping is a mapping for FilterMode enum
+	FilterModeMapping = map[string]FilterMode{
+		FilterModeOr.String():  FilterModeOr,
+		FilterModeAnd.String(): FilterModeAnd,
+	}
 )
 
 const (
@@ -79,7 +91,236 @@ func (e EnhancedMode) String() string {
 	}
 }
 
-func putMsgToCache(c *cache.LruCache, key string, msg *D.Msg) {
+const (
+	// IPv6Disable answers AAAA questions with empty answer
+	IPv6Disable IPv6Mode = iota
+	// IPv6Enable answers AAAA questions and prefers IPv4 for the resolving of clash
+	IPv6Enable
+	// IPv6Auto answers AAAA questions only if IPv6 is reachable
+	IPv6Auto
+	// IPv6Prefer likes IPv6Auto, and prefers IPv6 for the resolving of clash if it is reachable
+	IPv6Prefer
+)
+
+// IPv6Mode decides how AAAA questions are handled, it is a bool or a mode in yaml
+type IPv6Mode int
+
+// IPv6ModeMapping is a mapping for IPv6Mode enum
+var IPv6ModeMapping = map[string]IPv6Mode{
+	IPv6Disable.String(): IPv6Disable,
+	IPv6Enable.String():  IPv6Enable,
+	IPv6Auto.String():    IPv6Auto,
+	IPv6Prefer.String():  IPv6Prefer,
+}
+
+// UnmarshalYAML unserialize IPv6Mode with yaml
+func (m *IPv6Mode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		*m = IPv6Disable
+		if v {
+			*m = IPv6Enable
+		}
+		return nil
+	case string:
+		mode, exist := IPv6ModeMapping[v]
+		if !exist {
+			return errors.New("invalid ipv6 mode")
+		}
+		*m = mode
+		return nil
+	default:
+		return errors.New("invalid ipv6 mode")
+	}
+}
+
+// MarshalYAML serialize IPv6Mode with yaml
+func (m IPv6Mode) MarshalYAML() (interface{}, error) {
+	switch m {
+	case IPv6Disable:
+		return false, nil
+	case IPv6Enable:
+		return true, nil
+	default:
+		return m.String(), nil
+	}
+}
+
+func (m IPv6Mode) String() string {
+	switch m {
+	case IPv6Disable:
+		return "false"
+	case IPv6Enable:
+		return "true"
+	case IPv6Auto:
+		return "auto"
+	case IPv6Prefer:
+		return "prefer"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// StrategyFallback queries fallback servers when the answer of nameservers is filtered
+	StrategyFallback Strategy = iota
+	// StrategyParallel races all nameservers and fallback servers, the first answer wins
+	StrategyParallel
+)
+
+type Strategy int
+
+// UnmarshalYAML unserialize Strategy with yaml
+func (s *Strategy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var tp string
+	if err := unmarshal(&tp); err != nil {
+		return err
+	}
+	strategy, exist := StrategyMapping[tp]
+	if !exist {
+		return errors.New("invalid strategy")
+	}
+	*s = strategy
+	return nil
+}
+
+// MarshalYAML serialize Strategy with yaml
+func (s Strategy) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// UnmarshalJSON unserialize Strategy with json
+func (s *Strategy) UnmarshalJSON(data []byte) error {
+	var tp string
+	if err := json.Unmarshal(data, &tp); err != nil {
+		return err
+	}
+	strategy, exist := StrategyMapping[tp]
+	if !exist {
+		return errors.New("invalid strategy")
+	}
+	*s = strategy
+	return nil
+}
+
+// MarshalJSON serialize Strategy with json
+func (s Strategy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Strategy) String() string {
+	switch s {
+	case StrategyFallback:
+		return "fallback"
+	case StrategyParallel:
+		return "parallel"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// FilterModeOr uses the fallback servers if any of the fallback filters matches
+	FilterModeOr FilterMode = iota
+	// FilterModeAnd uses the fallback servers only if the domain filters and all
+	// the ip filters match
+	FilterModeAnd
+)
+
+type FilterMode int
+
+// UnmarshalYAML unserialize FilterMode with yaml
+func (f *FilterMode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var tp string
+	if err := unmarshal(&tp); err != nil {
+		return err
+	}
+	mode, exist := FilterModeMapping[tp]
+	if !exist {
+		return errors.New("invalid fallback-filter mode")
+	}
+	*f = mode
+	return nil
+}
+
+// MarshalYAML serialize FilterMode with yaml
+func (f FilterMode) MarshalYAML() (interface{}, error) {
+	return f.String(), nil
+}
+
+// UnmarshalJSON unserialize FilterMode with json
+func (f *FilterMode) UnmarshalJSON(data []byte) error {
+	var tp string
+	if err := json.Unmarshal(data, &tp); err != nil {
+		return err
+	}
+	mode, exist := FilterModeMapping[tp]
+	if !exist {
+		return errors.New("invalid fallback-filter mode")
+	}
+	*f = mode
+	return nil
+}
+
+// MarshalJSON serialize FilterMode with json
+func (f FilterMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+func (f FilterMode) String() string {
+	switch f {
+	case FilterModeOr:
+		return "or"
+	case FilterModeAnd:
+		return "and"
+	default:
+		return "unknown"
+	}
+}
+
+// cachePolicy decides how long a message is kept in cache
+type cachePolicy struct {
+	// minTTL and maxTTL clamp the ttl of positive answers, zero means no limit
+	minTTL uint32
+	maxTTL uint32
+	// negativeMaxTTL caps the ttl of NXDOMAIN and NODATA answers
+	negativeMaxTTL uint32
+}
+
+// ttl returns the cache ttl of msg, negative answers use the SOA minimum
+// as described in RFC 2308. It returns false if msg should not be cached,
+// e.g. a SERVFAIL which is a failure of the server rather than an answer.
+func (p cachePolicy) ttl(msg *D.Msg) (uint32, bool) {
+	if msg.Rcode != D.RcodeSuccess && msg.Rcode != D.RcodeNameError {
+		return 0, false
+	}
+
+	if msg.Rcode == D.RcodeNameError || (msg.Rcode == D.RcodeSuccess && len(msg.Answer) == 0) {
+		for _, ns := range msg.Ns {
+			soa, ok := ns.(*D.SOA)
+			if !ok {
+				continue
+			}
+
+			ttl := soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+			if p.negativeMaxTTL != 0 && ttl > p.negativeMaxTTL {
+				ttl = p.negativeMaxTTL
+			}
+			return ttl, true
+		}
+
+		// negative answers without SOA should not be cached
+		return 0, false
+	}
+
 	var ttl uint32
 	switch {
 	case len(msg.Answer) != 0:
@@ -89,7 +330,22 @@ func putMsgToCache(c *cache.LruCache, key string, msg *D.Msg) {
 	case len(msg.Extra) != 0:
 		ttl = msg.Extra[0].Header().Ttl
 	default:
-		log.Debugln("[DNS] response msg empty: %#v", msg)
+		return 0, false
+	}
+
+	if ttl < p.minTTL {
+		ttl = p.minTTL
+	}
+	if p.maxTTL != 0 && ttl > p.maxTTL {
+		ttl = p.maxTTL
+	}
+	return ttl, true
+}
+
+func putMsgToCache(c *cache.LruCache, key string, msg *D.Msg, policy cachePolicy) {
+	ttl, ok := policy.ttl(msg)
+	if !ok {
+		log.Debugln("[DNS] response msg can't be cached: %#v", msg)
 		return
 	}
 
@@ -114,24 +370,27 @@ func isIPRequest(q D.Question) bool {
 	return q.Qclass == D.ClassINET && (q.Qtype == D.TypeA || q.Qtype == D.TypeAAAA)
 }
 
-func transform(servers []NameServer, resolver *Resolver) []dnsClient {
+func transform(servers []NameServer, resolver *Resolver, pool DoTPool) []dnsClient {
 	ret := []dnsClient{}
 	for _, s := range servers {
-		if s.Net == "https" {
-			ret = append(ret, newDoHClient(s.Addr, resolver))
+		switch s.Net {
+		case "https":
+			ret = append(ret, newDoHClient(s, resolver))
+			continue
+		case "h3":
+			ret = append(ret, newDoH3Client(s, resolver))
 			continue
 		}
 
 		host, port, _ := net.SplitHostPort(s.Addr)
+		if s.Net == "tcp-tls" {
+			ret = append(ret, newDoTClient(host, port, s, resolver, pool))
+			continue
+		}
+
 		ret = append(ret, &client{
 			Client: &D.Client{
-				Net: s.Net,
-				TLSConfig: &tls.Config{
-					ClientSessionCache: globalSessionCache,
-					// alpn identifier, see https://tools.ietf.org/html/draft-hoffman-dprive-dns-tls-alpn-00#page-6
-					NextProtos: []string{"dns"},
-					ServerName: host,
-				},
+				Net:     s.Net,
 				UDPSize: 4096,
 				Timeout: 5 * time.Second,
 			},
@@ -153,3 +412,46 @@ func handleMsgWithEmptyAnswer(r *D.Msg) *D.Msg {
 
 	return msg
 }
+
+type dnsRecord struct {
+	Host    string   `json:"host"`
+	Type    string   `json:"type"`
+	Rcode   string   `json:"rcode"`
+	Answers []string `json:"answers"`
+}
+
+// emitDNSRecord emits the answer of an upstream query
+func emitDNSRecord(m *D.Msg, msg *D.Msg) {
+	if !log.Enabled() || len(m.Question) == 0 {
+		return
+	}
+
+	q := m.Question[0]
+	answers := msgToAnswers(msg)
+
+	record := &dnsRecord{
+		Host:    strings.TrimRight(q.Name, "."),
+		Type:    D.TypeToString[q.Qtype],
+		Rcode:   D.RcodeToString[msg.Rcode],
+		Answers: answers,
+	}
+	log.Emit(log.RecordDNS, record, "%s %s --> %s", record.Type, record.Host, strings.Join(answers, ", "))
+}
+
+// msgToAnswers returns the answers of msg in short form
+func msgToAnswers(msg *D.Msg) []string {
+	answers := []string{}
+	for _, rr := range msg.Answer {
+		switch ans := rr.(type) {
+		case *D.A:
+			answers = append(answers, ans.A.String())
+		case *D.AAAA:
+			answers = append(answers, ans.AAAA.String())
+		case *D.CNAME:
+			answers = append(answers, ans.Target)
+		default:
+			answers = append(answers, rr.String())
+		}
+	}
+	return answers
+}
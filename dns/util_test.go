@@ -0,0 +1,107 @@
+package dns
+
+import (
+	"encoding/json"
+	"testing"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestCachePolicy_TTL(t *testing.T) {
+	policy := cachePolicy{minTTL: 60, maxTTL: 3600, negativeMaxTTL: 300}
+	soa := &D.SOA{Hdr: D.RR_Header{Name: "example.com.", Rrtype: D.TypeSOA, Ttl: 3600}, Minttl: 900}
+	a, _ := D.NewRR("example.com. 10 IN A 1.1.1.1")
+
+	for _, tt := range []struct {
+		name     string
+		msg      *D.Msg
+		ttl      uint32
+		cachable bool
+	}{
+		{"answer", &D.Msg{Answer: []D.RR{a}}, 60, true},
+		{"nxdomain", &D.Msg{MsgHdr: D.MsgHdr{Rcode: D.RcodeNameError}, Ns: []D.RR{soa}}, 300, true},
+		{"nodata", &D.Msg{Ns: []D.RR{soa}}, 300, true},
+		{"nxdomain without soa", &D.Msg{MsgHdr: D.MsgHdr{Rcode: D.RcodeNameError}}, 0, false},
+		{"servfail", &D.Msg{MsgHdr: D.MsgHdr{Rcode: D.RcodeServerFailure}, Ns: []D.RR{soa}}, 0, false},
+		{"servfail with records", &D.Msg{MsgHdr: D.MsgHdr{Rcode: D.RcodeServerFailure}, Answer: []D.RR{a}}, 0, false},
+		{"refused", &D.Msg{MsgHdr: D.MsgHdr{Rcode: D.RcodeRefused}, Answer: []D.RR{a}}, 0, false},
+	} {
+		ttl, ok := policy.ttl(tt.msg)
+		assert.Equal(t, tt.cachable, ok, tt.name)
+		assert.Equal(t, tt.ttl, ttl, tt.name)
+	}
+}
+
+func TestFilterMode_JSON(t *testing.T) {
+	var mode FilterMode
+	assert.NoError(t, json.Unmarshal([]byte(`"and"`), &mode))
+	assert.Equal(t, FilterModeAnd, mode)
+
+	data, err := json.Marshal(mode)
+	assert.NoError(t, err)
+	assert.Equal(t, `"and"`, string(data))
+
+	mode = FilterModeOr
+	assert.Error(t, json.Unmarshal([]byte(`"xor"`), &mode))
+	assert.Error(t, json.Unmarshal([]byte(`1`), &mode))
+	assert.Equal(t, FilterModeOr, mode)
+}
+
+func TestStrategy_JSON(t *testing.T) {
+	var strategy Strategy
+	assert.NoError(t, json.Unmarshal([]byte(`"parallel"`), &strategy))
+	assert.Equal(t, StrategyParallel, strategy)
+
+	data, err := json.Marshal(strategy)
+	assert.NoError(t, err)
+	assert.Equal(t, `"parallel"`, string(data))
+
+	err = json.Unmarshal([]byte(`1`), &strategy)
+	var typeErr *json.UnmarshalTypeError
+	assert.ErrorAs(t, err, &typeErr)
+	assert.Error(t, json.Unmarshal([]byte(`"random"`), &strategy))
+	assert.Equal(t, StrategyParallel, strategy)
+}
+
+func TestIPv6Mode_YAML(t *testing.T) {
+	tests := []struct {
+		value string
+		mode  IPv6Mode
+	}{
+		{"true", IPv6Enable},
+		{"false", IPv6Disable},
+		{"auto", IPv6Auto},
+		{"prefer", IPv6Prefer},
+		{`"true"`, IPv6Enable},
+		{`"false"`, IPv6Disable},
+	}
+
+	for _, tt := range tests {
+		config := struct {
+			IPv6 IPv6Mode `yaml:"ipv6"`
+		}{IPv6: IPv6Prefer}
+		require.NoError(t, yaml.Unmarshal([]byte("ipv6: "+tt.value), &config), tt.value)
+		assert.Equal(t, tt.mode, config.IPv6, tt.value)
+	}
+
+	for _, value := range []string{"maybe", "1", "[auto]", "AUTO"} {
+		config := struct {
+			IPv6 IPv6Mode `yaml:"ipv6"`
+		}{}
+		assert.Error(t, yaml.Unmarshal([]byte("ipv6: "+value), &config), value)
+	}
+
+	for mode, value := range map[IPv6Mode]string{
+		IPv6Disable: "ipv6: false\n",
+		IPv6Enable:  "ipv6: true\n",
+		IPv6Auto:    "ipv6: auto\n",
+		IPv6Prefer:  "ipv6: prefer\n",
+	} {
+		data, err := yaml.Marshal(map[string]IPv6Mode{"ipv6": mode})
+		require.NoError(t, err)
+		assert.Equal(t, value, string(data))
+	}
+}
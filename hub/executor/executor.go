@@ -2,13 +2,21 @@ package executor
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/Dreamacro/clash/adapters/outbound"
+	"github.com/Dreamacro/clash/adapters/outboundgroup"
 	"github.com/Dreamacro/clash/adapters/provider"
 	"github.com/Dreamacro/clash/component/auth"
 	"github.com/Dreamacro/clash/component/dialer"
+	"github.com/Dreamacro/clash/component/geosite"
+	"github.com/Dreamacro/clash/component/mmdb"
+	"github.com/Dreamacro/clash/component/profile"
+	"github.com/Dreamacro/clash/component/profile/cachefile"
 	"github.com/Dreamacro/clash/component/resolver"
 	"github.com/Dreamacro/clash/component/trie"
 	"github.com/Dreamacro/clash/config"
@@ -17,11 +25,15 @@ import (
 	"github.com/Dreamacro/clash/log"
 	P "github.com/Dreamacro/clash/proxy"
 	authStore "github.com/Dreamacro/clash/proxy/auth"
+	"github.com/Dreamacro/clash/proxy/tun"
 	"github.com/Dreamacro/clash/tunnel"
 )
 
 var (
 	mux sync.Mutex
+
+	// current is the applied config, it is the base of reloading
+	current *config.Config
 )
 
 func readConfig(path string) ([]byte, error) {
@@ -60,18 +72,59 @@ func ParseWithBytes(buf []byte) (*config.Config, error) {
 	return config.Parse(buf)
 }
 
-// ApplyConfig dispatch configure to all parts
+// ParseWithPathReused parses config with custom config path, the unchanged
+// proxies, proxy groups and providers of the applied config are reused
+func ParseWithPathReused(path string) (*config.Config, error) {
+	buf, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseWithBytesReused(buf)
+}
+
+// ParseWithBytesReused parses config with buffer, the unchanged proxies,
+// proxy groups and providers of the applied config are reused
+func ParseWithBytesReused(buf []byte) (*config.Config, error) {
+	mux.Lock()
+	base := current
+	mux.Unlock()
+
+	return config.ParseWithBase(buf, base)
+}
+
+// ApplyConfig dispatch configure to all parts, listeners are only restarted
+// if their address changed. Without force, the connections using a proxy
+// which is changed or removed are closed and the others are kept, and the
+// mode switched by the API is kept unless the mode of the config changes.
 func ApplyConfig(cfg *config.Config, force bool) {
 	mux.Lock()
 	defer mux.Unlock()
 
+	oldProxies := allProxies(tunnel.Proxies(), tunnel.Providers())
+
 	updateUsers(cfg.Users)
-	updateGeneral(cfg.General, force)
-	updateProxies(cfg.Proxies, cfg.Providers)
+	updateProfile(cfg)
+	updateGeneral(cfg.General, effectiveMode(cfg.General, force))
+	updateTun(cfg.Tun, cfg.General)
+	updateHappyEyeballs(cfg.HappyEyeballs)
+	updateProxies(oldProxies, cfg.Proxies, cfg.Providers)
+	restoreDelay(allProxies(cfg.Proxies, cfg.Providers))
+	restoreSelected(cfg.Proxies)
+	if !force {
+		inheritSelected(oldProxies, cfg.Proxies)
+		closeOutdatedConnections(oldProxies, allProxies(cfg.Proxies, cfg.Providers))
+	}
+	updateDatabase(cfg.Database)
+	updateGeoSite(cfg.GeoSite)
 	updateRules(cfg.Rules)
+	tunnel.UpdateSniffer(cfg.Sniffer)
 	updateDNS(cfg.DNS)
 	updateHosts(cfg.Hosts)
+	updateGeoIP(cfg.GeoIP)
 	updateExperimental(cfg)
+
+	current = cfg
 }
 
 func GetGeneral() *config.General {
@@ -83,14 +136,16 @@ func GetGeneral() *config.General {
 
 	general := &config.General{
 		Inbound: config.Inbound{
-			Port:           ports.Port,
-			SocksPort:      ports.SocksPort,
-			RedirPort:      ports.RedirPort,
-			TProxyPort:     ports.TProxyPort,
-			MixedPort:      ports.MixedPort,
-			Authentication: authenticator,
-			AllowLan:       P.AllowLan(),
-			BindAddress:    P.BindAddress(),
+			Port:               ports.Port,
+			SocksPort:          ports.SocksPort,
+			RedirPort:          ports.RedirPort,
+			TProxyPort:         ports.TProxyPort,
+			MixedPort:          ports.MixedPort,
+			Authentication:     authenticator,
+			AllowLan:           P.AllowLan(),
+			BindAddress:        P.BindAddress(),
+			InboundBindAddress: P.InboundBindAddress(),
+			TCPFastOpen:        P.TCPFastOpen(),
 		},
 		Mode:     tunnel.Mode(),
 		LogLevel: log.Level(),
@@ -101,9 +156,15 @@ func GetGeneral() *config.General {
 
 func updateExperimental(c *config.Config) {}
 
+func updateHappyEyeballs(c *config.HappyEyeballs) {
+	dialer.PreferIPv6.Store(c.PreferIPv6)
+	dialer.FallbackDelay.Store(time.Duration(c.FallbackDelay) * time.Millisecond)
+}
+
 func updateDNS(c *config.DNS) {
 	if !c.Enable {
 		resolver.DefaultResolver = nil
+		resolver.DirectResolver = nil
 		resolver.DefaultHostMapper = nil
 		dns.ReCreateServer("", nil, nil)
 		return
@@ -116,12 +177,24 @@ func updateDNS(c *config.DNS) {
 		EnhancedMode: c.EnhancedMode,
 		Pool:         c.FakeIPRange,
 		Hosts:        c.Hosts,
+		Rewrites:     c.Rewrites,
 		FallbackFilter: dns.FallbackFilter{
-			GeoIP:  c.FallbackFilter.GeoIP,
-			IPCIDR: c.FallbackFilter.IPCIDR,
-			Domain: c.FallbackFilter.Domain,
+			GeoIP:   c.FallbackFilter.GeoIP,
+			IPCIDR:  c.FallbackFilter.IPCIDR,
+			Domain:  c.FallbackFilter.Domain,
+			GeoSite: c.FallbackFilter.GeoSite,
+			Mode:    c.FallbackFilter.Mode,
 		},
-		Default: c.DefaultNameserver,
+		Default:         c.DefaultNameserver,
+		CacheTTL:        c.CacheTTL,
+		ECS:             c.ECS,
+		Strategy:        c.Strategy,
+		UpstreamTimeout: c.UpstreamTimeout,
+		Policy:          c.NameServerPolicy,
+		Groups:          c.NameServerGroup,
+		Prefetch:        c.Prefetch,
+		QueryLog:        c.QueryLog,
+		DoTPool:         c.DoTPool,
 	}
 
 	r := dns.NewResolver(cfg)
@@ -132,9 +205,26 @@ func updateDNS(c *config.DNS) {
 		m.PatchFrom(old.(*dns.ResolverEnhancer))
 	}
 
+	if c.FakeIPRange != nil && profile.StoreFakeIP.Load() {
+		c.FakeIPRange.Restore(cachefile.Cache().FakeIPStore())
+	}
+
 	resolver.DefaultResolver = r
 	resolver.DefaultHostMapper = m
 
+	if len(c.DirectNameServer) != 0 {
+		resolver.DirectResolver = dns.NewResolver(dns.Config{
+			Main:            c.DirectNameServer,
+			IPv6:            c.IPv6,
+			Default:         c.DefaultNameserver,
+			CacheTTL:        c.CacheTTL,
+			UpstreamTimeout: c.UpstreamTimeout,
+			DoTPool:         c.DoTPool,
+		})
+	} else {
+		resolver.DirectResolver = nil
+	}
+
 	if err := dns.ReCreateServer(c.Listen, r, m); err != nil {
 		log.Errorln("Start DNS server error: %s", err.Error())
 		return
@@ -149,18 +239,157 @@ func updateHosts(tree *trie.DomainTrie) {
 	resolver.DefaultHosts = tree
 }
 
-func updateProxies(proxies map[string]C.Proxy, providers map[string]provider.ProxyProvider) {
+// updateProxies closes the resources, e.g. WireGuard tunnels and mux
+// sessions, of the replaced or removed proxies in oldProxies
+func updateProxies(oldProxies map[string]C.Proxy, proxies map[string]C.Proxy, providers map[string]provider.ProxyProvider) {
 	tunnel.UpdateProxies(proxies, providers)
+
+	newProxies := allProxies(proxies, providers)
+	for name, old := range oldProxies {
+		if newProxies[name] == old {
+			continue
+		}
+
+		p, ok := old.(*outbound.Proxy)
+		if !ok {
+			continue
+		}
+		if closer, ok := p.ProxyAdapter.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// restoreSelected recovers the selected proxy of groups from cache file
+func restoreSelected(proxies map[string]C.Proxy) {
+	if !profile.StoreSelected.Load() {
+		return
+	}
+
+	mapping := cachefile.Cache().SelectedMap()
+	for name, proxy := range proxies {
+		selected, exist := mapping[name]
+		if !exist {
+			continue
+		}
+
+		outbound, ok := proxy.(*outbound.Proxy)
+		if !ok {
+			continue
+		}
+
+		switch group := outbound.ProxyAdapter.(type) {
+		case *outboundgroup.Selector:
+			group.Set(selected)
+		case *outboundgroup.URLTest:
+			group.Restore(selected)
+		}
+	}
+}
+
+// restoreDelay recovers the last delay of proxies from cache file, the proxies
+// which have been checked are skipped
+func restoreDelay(proxies map[string]C.Proxy) {
+	if !profile.StoreDelay.Load() {
+		return
+	}
+
+	mapping := cachefile.Cache().DelayMap()
+	for name, proxy := range proxies {
+		history, exist := mapping[name]
+		if !exist {
+			continue
+		}
+
+		if outbound, ok := proxy.(*outbound.Proxy); ok {
+			outbound.RestoreDelay(history)
+		}
+	}
+}
+
+// inheritSelected sets the selection of the rebuilt selectors to the old one
+func inheritSelected(oldProxies, proxies map[string]C.Proxy) {
+	for name, proxy := range proxies {
+		old, exist := oldProxies[name]
+		if !exist || old == proxy {
+			continue
+		}
+
+		oldOutbound, ok := old.(*outbound.Proxy)
+		if !ok {
+			continue
+		}
+		newOutbound, ok := proxy.(*outbound.Proxy)
+		if !ok {
+			continue
+		}
+
+		oldSelector, ok := oldOutbound.ProxyAdapter.(*outboundgroup.Selector)
+		if !ok {
+			continue
+		}
+		if selector, ok := newOutbound.ProxyAdapter.(*outboundgroup.Selector); ok {
+			selector.Set(oldSelector.Now())
+		}
+	}
+}
+
+// allProxies returns the proxies and the proxies of providers by name
+func allProxies(proxies map[string]C.Proxy, providers map[string]provider.ProxyProvider) map[string]C.Proxy {
+	result := map[string]C.Proxy{}
+	for _, pd := range providers {
+		for _, proxy := range pd.Proxies() {
+			result[proxy.Name()] = proxy
+		}
+	}
+	for name, proxy := range proxies {
+		result[name] = proxy
+	}
+	return result
+}
+
+// closeOutdatedConnections closes the connections whose proxy is changed or removed
+func closeOutdatedConnections(oldProxies, proxies map[string]C.Proxy) {
+	for _, c := range tunnel.DefaultManager.Snapshot().Connections {
+		conn, ok := c.(interface{ Chains() C.Chain })
+		if !ok || len(conn.Chains()) == 0 {
+			continue
+		}
+
+		name := conn.Chains()[0]
+		if proxy, exist := proxies[name]; exist && proxy == oldProxies[name] {
+			continue
+		}
+
+		log.Debugln("[Config] close connection %s using outdated proxy %s", c.ID(), name)
+		c.Close()
+	}
 }
 
 func updateRules(rules []C.Rule) {
 	tunnel.UpdateRules(rules)
 }
 
-func updateGeneral(general *config.General, force bool) {
+// effectiveMode returns the mode to apply with general, the mode switched by
+// the API is kept without force if the mode of the config isn't changed
+// since the applied config
+func effectiveMode(general *config.General, force bool) tunnel.TunnelMode {
+	if !force && current != nil && current.General.Mode == general.Mode {
+		return tunnel.Mode()
+	}
+	return general.Mode
+}
+
+func updateGeneral(general *config.General, mode tunnel.TunnelMode) {
 	log.SetLevel(general.LogLevel)
-	tunnel.SetMode(general.Mode)
+	tunnel.SetMode(mode)
 	resolver.DisableIPv6 = !general.IPv6
+	outbound.SetTCPOptions(
+		time.Duration(general.KeepAliveInterval)*time.Second,
+		time.Duration(general.IdleTimeout)*time.Second,
+	)
+	shutdownTimeout = time.Duration(general.ShutdownTimeout) * time.Second
+	tunnel.SetUDPTimeout(time.Duration(general.UDPTimeout) * time.Second)
 
 	if general.Interface != "" {
 		dialer.DialHook = dialer.DialerWithInterface(general.Interface)
@@ -169,16 +398,14 @@ func updateGeneral(general *config.General, force bool) {
 		dialer.DialHook = nil
 		dialer.ListenPacketHook = nil
 	}
-
-	if !force {
-		return
-	}
+	dialer.DefaultRoutingMark.Store(int64(general.RoutingMark))
 
 	allowLan := general.AllowLan
 	P.SetAllowLan(allowLan)
 
-	bindAddress := general.BindAddress
-	P.SetBindAddress(bindAddress)
+	P.SetBindAddress(general.BindAddress)
+	P.SetInboundBindAddress(general.InboundBindAddress)
+	P.SetTCPFastOpen(general.TCPFastOpen)
 
 	if err := P.ReCreateHTTP(general.Port); err != nil {
 		log.Errorln("Start HTTP server error: %s", err.Error())
@@ -201,6 +428,83 @@ func updateGeneral(general *config.General, force bool) {
 	}
 }
 
+// updateTun recreates the tun inbound, auto-detect-interface binds the
+// outbound connections to the interface of the default route
+func updateTun(cfg *config.Tun, general *config.General) {
+	if !cfg.Enable {
+		P.ReCreateTun(nil)
+		return
+	}
+
+	if general.Interface == "" {
+		if cfg.AutoDetectInterface {
+			if iface, err := tun.DefaultInterface(cfg.Device); err != nil {
+				log.Warnln("[TUN] detect default interface failed: %s", err.Error())
+			} else {
+				log.Infoln("[TUN] bind outbound connections to %s", iface)
+				dialer.DialHook = dialer.DialerWithInterface(iface)
+				dialer.ListenPacketHook = dialer.ListenPacketWithInterface(iface)
+			}
+		} else if cfg.AutoRoute {
+			log.Warnln("[TUN] auto-route without auto-detect-interface or interface-name routes the outbound connections back to the device")
+		}
+	}
+
+	err := P.ReCreateTun(&tun.Config{
+		Device:       cfg.Device,
+		Inet4Address: cfg.Inet4Address,
+		Inet6Address: cfg.Inet6Address,
+		MTU:          cfg.MTU,
+		AutoRoute:    cfg.AutoRoute,
+		Stack:        cfg.Stack,
+	})
+	if err != nil {
+		log.Errorln("Start Tun device error: %s", err.Error())
+	}
+}
+
+func updateGeoSite(cfg *config.GeoSite) {
+	geosite.SetSource(cfg.Path, cfg.URL)
+
+	if !cfg.AutoUpdate {
+		geosite.SetAutoUpdate(0)
+		return
+	}
+
+	geosite.SetAutoUpdate(time.Duration(cfg.UpdateInterval) * time.Hour)
+}
+
+func updateDatabase(cfg *config.Database) {
+	mmdb.SetASNPath(cfg.ASN)
+	mmdb.SetDestinationPath(cfg.GeoIP)
+	mmdb.SetSourcePath(cfg.SrcGeoIP)
+}
+
+func updateGeoIP(cfg *config.GeoIP) {
+	mmdb.SetSource(cfg.URL, cfg.SHA256, cfg.SHA256URL)
+
+	if cfg.SHA256 != "" {
+		go func() {
+			if err := mmdb.UpdatePinned(); err != nil {
+				log.Warnln("[MMDB] update to the pinned database failed: %s", err.Error())
+			}
+		}()
+	}
+
+	if !cfg.AutoUpdate {
+		mmdb.SetAutoUpdate(0)
+		return
+	}
+
+	mmdb.SetAutoUpdate(time.Duration(cfg.UpdateInterval) * time.Hour)
+}
+
+func updateProfile(cfg *config.Config) {
+	profile.StoreFakeIP.Store(cfg.Profile.StoreFakeIP)
+	profile.StoreSelected.Store(cfg.Profile.StoreSelected)
+	profile.StoreDelay.Store(cfg.Profile.StoreDelay)
+}
+
 func updateUsers(users []auth.AuthUser) {
 	authenticator := auth.NewAuthenticator(users)
 	authStore.SetAuthenticator(authenticator)
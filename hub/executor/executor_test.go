@@ -0,0 +1,35 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/Dreamacro/clash/config"
+	"github.com/Dreamacro/clash/tunnel"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectiveMode(t *testing.T) {
+	defer func(c *config.Config, mode tunnel.TunnelMode) {
+		current = c
+		tunnel.SetMode(mode)
+	}(current, tunnel.Mode())
+
+	general := func(mode tunnel.TunnelMode) *config.General {
+		return &config.General{Mode: mode}
+	}
+
+	// the first config is applied as it is
+	current = nil
+	tunnel.SetMode(tunnel.Global)
+	assert.Equal(t, tunnel.Rule, effectiveMode(general(tunnel.Rule), false))
+
+	// the mode switched by the API is kept by a reload of the same mode
+	current = &config.Config{General: general(tunnel.Rule)}
+	assert.Equal(t, tunnel.Global, effectiveMode(general(tunnel.Rule), false))
+
+	// a force reload or a new mode of the config replaces it
+	assert.Equal(t, tunnel.Rule, effectiveMode(general(tunnel.Rule), true))
+	assert.Equal(t, tunnel.Direct, effectiveMode(general(tunnel.Direct), false))
+	assert.Equal(t, tunnel.Direct, effectiveMode(general(tunnel.Direct), true))
+}
@@ -0,0 +1,67 @@
+package executor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/profile/cachefile"
+	"github.com/Dreamacro/clash/dns"
+	"github.com/Dreamacro/clash/log"
+	P "github.com/Dreamacro/clash/proxy"
+	"github.com/Dreamacro/clash/tunnel"
+)
+
+var (
+	shutdownOnce sync.Once
+
+	// shutdownTimeout is set by updateGeneral
+	shutdownTimeout time.Duration
+)
+
+// Shutdown stops accepting connections, waits up to shutdown-timeout for the
+// alive connections to finish and closes the rest, then flushes the cache
+// file. The concurrent callers return after it is done, the config can't be
+// applied afterwards.
+func Shutdown() {
+	shutdownOnce.Do(shutdown)
+}
+
+func shutdown() {
+	// hold the lock forever, so that the listeners aren't recreated by a reload
+	mux.Lock()
+
+	log.Infoln("Shutting down, waiting %s for the alive connections", shutdownTimeout)
+
+	P.ReCreateHTTP(0)
+	P.ReCreateSocks(0)
+	P.ReCreateRedir(0)
+	P.ReCreateTProxy(0)
+	P.ReCreateMixed(0)
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.Now().Add(shutdownTimeout)
+	for {
+		alive, _ := tunnel.DefaultManager.ConnectionCount()
+		if alive == 0 {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			log.Warnln("Shutdown timeout, close %d alive connections", alive)
+			for _, c := range tunnel.DefaultManager.Snapshot().Connections {
+				c.Close()
+			}
+			break
+		}
+		<-ticker.C
+	}
+
+	// the device is removed after the connections through it are done
+	P.ReCreateTun(nil)
+
+	dns.ReCreateServer("", nil, nil)
+
+	if err := cachefile.Cache().Close(); err != nil {
+		log.Warnln("[CacheFile] close cache file failed: %s", err.Error())
+	}
+}
@@ -45,6 +45,10 @@ func Parse(options ...Option) error {
 		go route.Start(cfg.General.ExternalController, cfg.General.Secret)
 	}
 
+	if cfg.General.ExternalMetrics != "" {
+		go route.StartMetrics(cfg.General.ExternalMetrics)
+	}
+
 	executor.ApplyConfig(cfg, true)
 	return nil
 }
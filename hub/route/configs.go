@@ -1,6 +1,7 @@
 package route
 
 import (
+	"encoding/json"
 	"net/http"
 	"path/filepath"
 
@@ -29,11 +30,24 @@ type configSchema struct {
 	TProxyPort  *int               `json:"tproxy-port"`
 	MixedPort   *int               `json:"mixed-port"`
 	AllowLan    *bool              `json:"allow-lan"`
-	BindAddress *string            `json:"bind-address"`
+	BindAddress *bindAddress       `json:"bind-address"`
 	Mode        *tunnel.TunnelMode `json:"mode"`
 	LogLevel    *log.LogLevel      `json:"log-level"`
 }
 
+// bindAddress is an address, or a list of addresses
+type bindAddress []string
+
+func (b *bindAddress) UnmarshalJSON(data []byte) error {
+	var addr string
+	if err := json.Unmarshal(data, &addr); err == nil {
+		*b = bindAddress{addr}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(b))
+}
+
 func getConfigs(w http.ResponseWriter, r *http.Request) {
 	general := executor.GetGeneral()
 	render.JSON(w, r, general)
@@ -55,12 +69,18 @@ func patchConfigs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if general.AllowLan != nil {
-		P.SetAllowLan(*general.AllowLan)
+	if general.BindAddress != nil {
+		addrs, err := P.ParseBindAddress(*general.BindAddress)
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, newError(err.Error()))
+			return
+		}
+		P.SetBindAddress(addrs)
 	}
 
-	if general.BindAddress != nil {
-		P.SetBindAddress(*general.BindAddress)
+	if general.AllowLan != nil {
+		P.SetAllowLan(*general.AllowLan)
 	}
 
 	ports := P.GetPorts()
@@ -94,12 +114,18 @@ func updateConfigs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// without force, the unchanged proxies, groups and providers are reused
 	force := r.URL.Query().Get("force") == "true"
+	parseWithBytes, parseWithPath := executor.ParseWithBytesReused, executor.ParseWithPathReused
+	if force {
+		parseWithBytes, parseWithPath = executor.ParseWithBytes, executor.ParseWithPath
+	}
+
 	var cfg *config.Config
 	var err error
 
 	if req.Payload != "" {
-		cfg, err = executor.ParseWithBytes([]byte(req.Payload))
+		cfg, err = parseWithBytes([]byte(req.Payload))
 		if err != nil {
 			render.Status(r, http.StatusBadRequest)
 			render.JSON(w, r, newError(err.Error()))
@@ -112,7 +138,7 @@ func updateConfigs(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		cfg, err = executor.ParseWithPath(req.Path)
+		cfg, err = parseWithPath(req.Path)
 		if err != nil {
 			render.Status(r, http.StatusBadRequest)
 			render.JSON(w, r, newError(err.Error()))
@@ -18,6 +18,8 @@ func connectionRouter() http.Handler {
 	r := chi.NewRouter()
 	r.Get("/", getConnections)
 	r.Delete("/", closeAllConnections)
+	r.Get("/stats", getStats)
+	r.Delete("/stats", resetStats)
 	r.Delete("/{id}", closeConnection)
 	return r
 }
@@ -90,3 +92,60 @@ func closeAllConnections(w http.ResponseWriter, r *http.Request) {
 	}
 	render.NoContent(w, r)
 }
+
+// getStats returns the traffic by proxy, rule and destination host. Totals are
+// cumulative since clash starts or the last reset, the current rates are of the
+// last second. Idle hosts are dropped after ten minutes.
+func getStats(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		render.JSON(w, r, T.DefaultManager.Stats())
+		return
+	}
+
+	intervalStr := r.URL.Query().Get("interval")
+	interval := 1000
+	if intervalStr != "" {
+		t, err := strconv.Atoi(intervalStr)
+		if err != nil || t <= 0 {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, ErrBadRequest)
+			return
+		}
+
+		interval = t
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	buf := &bytes.Buffer{}
+	sendStats := func() error {
+		buf.Reset()
+		if err := json.NewEncoder(buf).Encode(T.DefaultManager.Stats()); err != nil {
+			return err
+		}
+
+		return conn.WriteMessage(websocket.TextMessage, buf.Bytes())
+	}
+
+	if err := sendStats(); err != nil {
+		return
+	}
+
+	tick := time.NewTicker(time.Millisecond * time.Duration(interval))
+	defer tick.Stop()
+	for range tick.C {
+		if err := sendStats(); err != nil {
+			break
+		}
+	}
+}
+
+// resetStats sets the traffic by proxy, rule and host to zero
+func resetStats(w http.ResponseWriter, r *http.Request) {
+	T.DefaultManager.ResetStats()
+	render.NoContent(w, r)
+}
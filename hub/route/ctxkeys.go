@@ -5,6 +5,7 @@ var (
 	CtxKeyProviderName = contextKey("provider name")
 	CtxKeyProxy        = contextKey("proxy")
 	CtxKeyProvider     = contextKey("provider")
+	CtxKeyRuleIndex    = contextKey("rule index")
 )
 
 type contextKey string
@@ -0,0 +1,129 @@
+package route
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dreamacro/clash/component/resolver"
+	"github.com/Dreamacro/clash/dns"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	D "github.com/miekg/dns"
+)
+
+func dnsRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/cache/flush", flushDNSCache)
+	r.Get("/query", queryDNS)
+	r.Get("/upstreams/benchmark", benchmarkDNS)
+	return r
+}
+
+type FlushDNSCacheRequest struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	FakeIP bool   `json:"fakeip"`
+}
+
+// flushDNSCache removes the cached answers matching the name and type of the
+// request, and the fake ip of the name if requested. Empty body flushes all answers.
+func flushDNSCache(w http.ResponseWriter, r *http.Request) {
+	req := FlushDNSCacheRequest{}
+	if err := render.DecodeJSON(r.Body, &req); err != nil && err != io.EOF {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrBadRequest)
+		return
+	}
+
+	var qtype uint16
+	if req.Type != "" {
+		tp, ok := D.StringToType[strings.ToUpper(req.Type)]
+		if !ok {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, newError("invalid type: "+req.Type))
+			return
+		}
+		qtype = tp
+	}
+
+	cache, fakeip := 0, 0
+	if res, ok := resolver.DefaultResolver.(*dns.Resolver); ok {
+		cache = res.FlushCache(req.Name, qtype)
+	}
+	if m, ok := resolver.DefaultHostMapper.(*dns.ResolverEnhancer); ok && req.FakeIP {
+		fakeip = m.FlushFakeIP(req.Name)
+	}
+
+	render.JSON(w, r, render.M{
+		"cache":  cache,
+		"fakeip": fakeip,
+	})
+}
+
+// queryDNS answers the name and type of the query through the DNS resolver,
+// the result tells which upstream answered it
+func queryDNS(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError("name is required"))
+		return
+	}
+
+	qtype := D.TypeA
+	if tp := r.URL.Query().Get("type"); tp != "" {
+		t, ok := D.StringToType[strings.ToUpper(tp)]
+		if !ok {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, newError("invalid type: "+tp))
+			return
+		}
+		qtype = t
+	}
+
+	res, ok := resolver.DefaultResolver.(*dns.Resolver)
+	if !ok {
+		render.Status(r, http.StatusServiceUnavailable)
+		render.JSON(w, r, newError("DNS is not enabled"))
+		return
+	}
+	m, _ := resolver.DefaultHostMapper.(*dns.ResolverEnhancer)
+
+	render.JSON(w, r, dns.Query(res, m, name, qtype))
+}
+
+// benchmarkDNS probes each nameserver with the A query of name, default
+// to example.com, timeout is in milliseconds
+func benchmarkDNS(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("name")
+	if name == "" {
+		name = "example.com"
+	}
+
+	timeout := int64(5000)
+	if t := query.Get("timeout"); t != "" {
+		var err error
+		timeout, err = strconv.ParseInt(t, 10, 32)
+		if err != nil || timeout <= 0 {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, ErrBadRequest)
+			return
+		}
+	}
+
+	res, ok := resolver.DefaultResolver.(*dns.Resolver)
+	if !ok {
+		render.Status(r, http.StatusServiceUnavailable)
+		render.JSON(w, r, newError("DNS is not enabled"))
+		return
+	}
+
+	render.JSON(w, r, render.M{
+		"upstreams": res.Benchmark(name, time.Millisecond*time.Duration(timeout)),
+	})
+}
@@ -0,0 +1,155 @@
+package route
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/dns"
+	"github.com/Dreamacro/clash/log"
+	T "github.com/Dreamacro/clash/tunnel"
+)
+
+var metricsAddr = ""
+
+// StartMetrics serves the metrics on a separate address, it doesn't require the secret
+func StartMetrics(addr string) {
+	if metricsAddr != "" {
+		return
+	}
+	metricsAddr = addr
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metrics)
+
+	log.Infoln("Metrics listening at: %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Errorln("Metrics server error: %s", err.Error())
+	}
+}
+
+// metricsWriter writes metrics in the Prometheus text format
+type metricsWriter struct {
+	*bufio.Writer
+}
+
+func (w *metricsWriter) header(name, tp, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, tp)
+}
+
+func (w *metricsWriter) value(name string, value interface{}, labels ...string) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		w.WriteByte('}')
+	}
+	fmt.Fprintf(w, " %v\n", value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metrics exports the statistics in the Prometheus format, the traffic is
+// grouped by proxy and rule but not by host to keep the cardinality bounded
+func metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mw := &metricsWriter{bufio.NewWriter(w)}
+	defer mw.Flush()
+
+	alive, total := T.DefaultManager.ConnectionCount()
+	mw.header("clash_connections", "gauge", "The number of alive connections.")
+	mw.value("clash_connections", alive)
+	mw.header("clash_connections_total", "counter", "The number of connections.")
+	mw.value("clash_connections_total", total)
+
+	mw.header("clash_udp_sessions", "gauge", "The number of alive UDP sessions.")
+	mw.value("clash_udp_sessions", T.UDPSessionCount())
+
+	up, down := T.DefaultManager.Total()
+	mw.header("clash_upload_bytes_total", "counter", "The uploaded bytes of all connections.")
+	mw.value("clash_upload_bytes_total", up)
+	mw.header("clash_download_bytes_total", "counter", "The downloaded bytes of all connections.")
+	mw.value("clash_download_bytes_total", down)
+
+	stats := T.DefaultManager.Stats()
+	proxyNames := sortedKeys(stats.Proxies)
+	mw.header("clash_proxy_upload_bytes_total", "counter", "The uploaded bytes by proxy.")
+	for _, name := range proxyNames {
+		mw.value("clash_proxy_upload_bytes_total", stats.Proxies[name].UploadTotal, "proxy", name)
+	}
+	mw.header("clash_proxy_download_bytes_total", "counter", "The downloaded bytes by proxy.")
+	for _, name := range proxyNames {
+		mw.value("clash_proxy_download_bytes_total", stats.Proxies[name].DownloadTotal, "proxy", name)
+	}
+	mw.header("clash_proxy_connections_total", "counter", "The number of connections by proxy.")
+	for _, name := range proxyNames {
+		mw.value("clash_proxy_connections_total", stats.Proxies[name].Connections, "proxy", name)
+	}
+
+	mw.header("clash_rule_matches_total", "counter", "The number of connections by matched rule.")
+	for _, name := range sortedKeys(stats.Rules) {
+		mw.value("clash_rule_matches_total", stats.Rules[name].Connections, "rule", name)
+	}
+
+	mw.header("clash_dns_queries_total", "counter", "The number of queries of the DNS server by type and result.")
+	for _, stat := range dns.QueryStats() {
+		mw.value("clash_dns_queries_total", stat.Count, "type", stat.Type, "result", stat.Result)
+	}
+
+	proxies := allProxies()
+	mw.header("clash_proxy_alive", "gauge", "Whether the proxy is alive.")
+	for _, proxy := range proxies {
+		alive := 0
+		if proxy.Alive() {
+			alive = 1
+		}
+		mw.value("clash_proxy_alive", alive, "proxy", proxy.Name())
+	}
+	mw.header("clash_proxy_delay_milliseconds", "gauge", "The last health check delay of the proxy.")
+	for _, proxy := range proxies {
+		if delay := proxy.LastDelay(); delay != 0xffff {
+			mw.value("clash_proxy_delay_milliseconds", delay, "proxy", proxy.Name())
+		}
+	}
+}
+
+// allProxies returns the proxies of the config and the providers sorted by name
+func allProxies() []C.Proxy {
+	seen := map[string]bool{}
+	proxies := []C.Proxy{}
+	add := func(proxy C.Proxy) {
+		if !seen[proxy.Name()] {
+			seen[proxy.Name()] = true
+			proxies = append(proxies, proxy)
+		}
+	}
+
+	for _, proxy := range T.Proxies() {
+		add(proxy)
+	}
+	for _, p := range T.Providers() {
+		for _, proxy := range p.Proxies() {
+			add(proxy)
+		}
+	}
+
+	sort.Slice(proxies, func(i, j int) bool { return proxies[i].Name() < proxies[j].Name() })
+	return proxies
+}
+
+func sortedKeys(stats map[string]*T.TrafficStat) []string {
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
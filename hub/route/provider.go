@@ -20,6 +20,7 @@ func proxyProviderRouter() http.Handler {
 		r.Get("/", getProvider)
 		r.Put("/", updateProvider)
 		r.Get("/healthcheck", healthCheckProvider)
+		r.Put("/healthcheck", healthCheckProvider)
 	})
 	return r
 }
@@ -46,10 +47,11 @@ func updateProvider(w http.ResponseWriter, r *http.Request) {
 	render.NoContent(w, r)
 }
 
+// healthCheckProvider checks the proxies of the provider now and returns the provider with the updated delays
 func healthCheckProvider(w http.ResponseWriter, r *http.Request) {
 	provider := r.Context().Value(CtxKeyProvider).(provider.ProxyProvider)
 	provider.HealthCheck()
-	render.NoContent(w, r)
+	render.JSON(w, r, provider)
 }
 
 func parseProviderName(next http.Handler) http.Handler {
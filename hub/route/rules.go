@@ -1,8 +1,16 @@
 package route
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/Dreamacro/clash/config"
+	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/tunnel"
 
 	"github.com/go-chi/chi"
@@ -12,28 +20,252 @@ import (
 func ruleRouter() http.Handler {
 	r := chi.NewRouter()
 	r.Get("/", getRules)
+	r.Post("/", insertRule)
+	r.Get("/match", matchRule)
+
+	r.Route("/{index}", func(r chi.Router) {
+		r.Use(parseRuleIndex)
+		r.Delete("/", deleteRule)
+		r.Patch("/", moveRule)
+	})
 	return r
 }
 
 type Rule struct {
-	Type    string `json:"type"`
-	Payload string `json:"payload"`
-	Proxy   string `json:"proxy"`
+	Type        string `json:"type"`
+	Payload     string `json:"payload"`
+	Proxy       string `json:"proxy"`
+	RoutingMark int    `json:"routingMark,omitempty"`
+}
+
+func newRule(rule C.Rule) Rule {
+	r := Rule{
+		Type:    rule.RuleType().String(),
+		Payload: rule.Payload(),
+		Proxy:   rule.Adapter(),
+	}
+	if marked, ok := rule.(C.RoutingMarkRule); ok {
+		r.RoutingMark = marked.RoutingMark()
+	}
+	return r
 }
 
 func getRules(w http.ResponseWriter, r *http.Request) {
-	rawRules := tunnel.Rules()
+	renderRules(w, r, tunnel.Rules())
+}
 
+func renderRules(w http.ResponseWriter, r *http.Request, rawRules []C.Rule) {
 	rules := []Rule{}
 	for _, rule := range rawRules {
-		rules = append(rules, Rule{
-			Type:    rule.RuleType().String(),
-			Payload: rule.Payload(),
-			Proxy:   rule.Adapter(),
-		})
+		rules = append(rules, newRule(rule))
 	}
 
 	render.JSON(w, r, render.M{
 		"rules": rules,
 	})
 }
+
+type insertRuleRequest struct {
+	Rule  string `json:"rule"`
+	Index *int   `json:"index"`
+}
+
+// insertRule parses the rule and inserts it before index, or appends it
+// without index
+func insertRule(w http.ResponseWriter, r *http.Request) {
+	req := insertRuleRequest{}
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrBadRequest)
+		return
+	}
+
+	rule, err := config.ParseRule(req.Rule, tunnel.Proxies())
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+
+	rules, err := tunnel.EditRules(func(rules []C.Rule) ([]C.Rule, error) {
+		index := len(rules)
+		if req.Index != nil {
+			index = *req.Index
+		}
+		if index < 0 || index > len(rules) {
+			return nil, fmt.Errorf("index %d out of range", index)
+		}
+		return append(rules[:index], append([]C.Rule{rule}, rules[index:]...)...), nil
+	})
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+
+	renderRules(w, r, rules)
+}
+
+func deleteRule(w http.ResponseWriter, r *http.Request) {
+	index := r.Context().Value(CtxKeyRuleIndex).(int)
+
+	rules, err := tunnel.EditRules(func(rules []C.Rule) ([]C.Rule, error) {
+		if index >= len(rules) {
+			return nil, fmt.Errorf("index %d out of range", index)
+		}
+		return append(rules[:index], rules[index+1:]...), nil
+	})
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+
+	renderRules(w, r, rules)
+}
+
+type moveRuleRequest struct {
+	Index int `json:"index"`
+}
+
+// moveRule moves the rule at the index of the path to the index of the body
+func moveRule(w http.ResponseWriter, r *http.Request) {
+	from := r.Context().Value(CtxKeyRuleIndex).(int)
+
+	req := moveRuleRequest{}
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrBadRequest)
+		return
+	}
+
+	rules, err := tunnel.EditRules(func(rules []C.Rule) ([]C.Rule, error) {
+		if from >= len(rules) {
+			return nil, fmt.Errorf("index %d out of range", from)
+		}
+		if req.Index < 0 || req.Index >= len(rules) {
+			return nil, fmt.Errorf("index %d out of range", req.Index)
+		}
+		rule := rules[from]
+		rules = append(rules[:from], rules[from+1:]...)
+		return append(rules[:req.Index], append([]C.Rule{rule}, rules[req.Index:]...)...), nil
+	})
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+
+	renderRules(w, r, rules)
+}
+
+func parseRuleIndex(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		index, err := strconv.Atoi(chi.URLParam(r, "index"))
+		if err != nil || index < 0 {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, ErrBadRequest)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), CtxKeyRuleIndex, index)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type MatchResponse struct {
+	Rule     *Rule       `json:"rule"`
+	Proxy    string      `json:"proxy"`
+	Chains   []string    `json:"chains"`
+	Node     string      `json:"node"`
+	FakeIP   bool        `json:"fakeIP"`
+	Resolved bool        `json:"resolved"`
+	Metadata *C.Metadata `json:"metadata"`
+}
+
+// matchRule returns the rule and the proxy which a connection to host:port
+// would use, it doesn't connect
+func matchRule(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	metadata, err := parseMatchQuery(query.Get("host"), query.Get("port"), query.Get("network"), query.Get("srcIP"), query.Get("srcPort"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+
+	result, err := tunnel.Match(metadata)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+
+	resp := MatchResponse{
+		Proxy:    result.Proxy.Name(),
+		Chains:   result.Chain,
+		Node:     result.Chain[len(result.Chain)-1],
+		FakeIP:   result.FakeIP,
+		Resolved: result.Resolved,
+		Metadata: metadata,
+	}
+	if rule := result.Rule; rule != nil {
+		r := newRule(rule)
+		resp.Rule = &r
+	}
+
+	render.JSON(w, r, resp)
+}
+
+func parseMatchQuery(host, port, network, srcIP, srcPort string) (*C.Metadata, error) {
+	if host == "" {
+		return nil, errors.New("host is required")
+	}
+	if port == "" {
+		port = "443"
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return nil, fmt.Errorf("invalid port: %s", port)
+	}
+
+	metadata := &C.Metadata{
+		NetWork: C.TCP,
+		DstPort: port,
+		SrcPort: srcPort,
+	}
+
+	switch strings.ToLower(network) {
+	case "", "tcp":
+	case "udp":
+		metadata.NetWork = C.UDP
+	default:
+		return nil, fmt.Errorf("invalid network: %s", network)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			metadata.DstIP = ip4
+			metadata.AddrType = C.AtypIPv4
+		} else {
+			metadata.DstIP = ip
+			metadata.AddrType = C.AtypIPv6
+		}
+	} else {
+		metadata.Host = host
+		metadata.AddrType = C.AtypDomainName
+	}
+
+	if srcIP != "" {
+		if metadata.SrcIP = net.ParseIP(srcIP); metadata.SrcIP == nil {
+			return nil, fmt.Errorf("invalid srcIP: %s", srcIP)
+		}
+	}
+	if srcPort != "" {
+		if _, err := strconv.ParseUint(srcPort, 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid srcPort: %s", srcPort)
+		}
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,113 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapters/outbound"
+	"github.com/Dreamacro/clash/adapters/provider"
+	C "github.com/Dreamacro/clash/constant"
+	R "github.com/Dreamacro/clash/rules"
+	"github.com/Dreamacro/clash/tunnel"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRules(t *testing.T) {
+	tunnel.UpdateProxies(map[string]C.Proxy{"DIRECT": outbound.NewProxy(outbound.NewDirect())}, map[string]provider.ProxyProvider{})
+	tunnel.UpdateRules([]C.Rule{
+		R.NewDomain("a.com", "DIRECT"),
+		R.NewDomain("b.com", "DIRECT"),
+		R.NewDomain("c.com", "DIRECT"),
+	})
+	t.Cleanup(func() { tunnel.UpdateRules(nil) })
+}
+
+func doRuleRequest(t *testing.T, method, path, body string) (int, []string) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ruleRouter().ServeHTTP(w, req)
+
+	resp := struct {
+		Rules []Rule `json:"rules"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	payloads := []string{}
+	for _, rule := range resp.Rules {
+		payloads = append(payloads, rule.Payload)
+	}
+	return w.Code, payloads
+}
+
+func currentPayloads() []string {
+	payloads := []string{}
+	for _, rule := range tunnel.Rules() {
+		payloads = append(payloads, rule.Payload())
+	}
+	return payloads
+}
+
+func TestInsertRule(t *testing.T) {
+	setupRules(t)
+
+	code, payloads := doRuleRequest(t, http.MethodPost, "/", `{"rule": "DOMAIN,d.com,DIRECT", "index": 1}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"a.com", "d.com", "b.com", "c.com"}, payloads)
+	assert.Equal(t, payloads, currentPayloads())
+
+	// it's appended without index
+	_, payloads = doRuleRequest(t, http.MethodPost, "/", `{"rule": "DOMAIN,e.com,DIRECT"}`)
+	assert.Equal(t, []string{"a.com", "d.com", "b.com", "c.com", "e.com"}, payloads)
+
+	for _, body := range []string{
+		`{"rule": "DOMAIN,f.com,DIRECT", "index": 6}`,
+		`{"rule": "DOMAIN,f.com,DIRECT", "index": -1}`,
+		`{"rule": "DOMAIN,f.com,UNKNOWN"}`,
+		`{"rule": "SCRIPT,f,DIRECT"}`,
+		`{"rule":`,
+	} {
+		code, _ = doRuleRequest(t, http.MethodPost, "/", body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+	assert.Equal(t, []string{"a.com", "d.com", "b.com", "c.com", "e.com"}, currentPayloads())
+}
+
+func TestDeleteRule(t *testing.T) {
+	setupRules(t)
+
+	code, payloads := doRuleRequest(t, http.MethodDelete, "/1", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"a.com", "c.com"}, payloads)
+
+	code, _ = doRuleRequest(t, http.MethodDelete, "/2", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = doRuleRequest(t, http.MethodDelete, "/-1", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, []string{"a.com", "c.com"}, currentPayloads())
+}
+
+func TestMoveRule(t *testing.T) {
+	setupRules(t)
+
+	code, payloads := doRuleRequest(t, http.MethodPatch, "/0", `{"index": 2}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"b.com", "c.com", "a.com"}, payloads)
+
+	_, payloads = doRuleRequest(t, http.MethodPatch, "/2", `{"index": 0}`)
+	assert.Equal(t, []string{"a.com", "b.com", "c.com"}, payloads)
+
+	for _, tt := range []struct{ path, body string }{
+		{"/3", `{"index": 0}`},
+		{"/0", `{"index": 3}`},
+		{"/0", `{"index": -1}`},
+	} {
+		code, _ = doRuleRequest(t, http.MethodPatch, tt.path, tt.body)
+		assert.Equal(t, http.StatusBadRequest, code, tt.path+" "+tt.body)
+	}
+	assert.Equal(t, []string{"a.com", "b.com", "c.com"}, currentPayloads())
+}
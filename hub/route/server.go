@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/hub/executor"
 	"github.com/Dreamacro/clash/log"
 	T "github.com/Dreamacro/clash/tunnel"
 
@@ -64,11 +66,14 @@ func Start(addr string, secret string) {
 		r.Get("/logs", getLogs)
 		r.Get("/traffic", traffic)
 		r.Get("/version", version)
+		r.Get("/metrics", metrics)
+		r.Post("/shutdown", shutdown)
 		r.Mount("/configs", configRouter())
 		r.Mount("/proxies", proxyRouter())
 		r.Mount("/rules", ruleRouter())
 		r.Mount("/connections", connectionRouter())
 		r.Mount("/providers/proxies", proxyProviderRouter())
+		r.Mount("/dns", dnsRouter())
 	})
 
 	if uiPath != "" {
@@ -122,6 +127,22 @@ func authentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// shutdown drains the connections and exits, it responds before shutting down.
+// It's forbidden without a secret, so that any local process can't stop clash.
+func shutdown(w http.ResponseWriter, r *http.Request) {
+	if serverSecret == "" {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, newError("Shutdown requires a secret"))
+		return
+	}
+
+	go func() {
+		executor.Shutdown()
+		os.Exit(0)
+	}()
+	render.NoContent(w, r)
+}
+
 func hello(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, render.M{"hello": "clash"})
 }
@@ -170,8 +191,19 @@ func traffic(w http.ResponseWriter, r *http.Request) {
 }
 
 type Log struct {
-	Type    string `json:"type"`
-	Payload string `json:"payload"`
+	Type    string      `json:"type"`
+	Payload string      `json:"payload"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// logTypes is the types that can be subscribed by the type query of logs,
+// log means the log lines filtered by level
+var logTypes = map[string]bool{
+	"log":                true,
+	log.RecordConnection: true,
+	log.RecordRule:       true,
+	log.RecordProxy:      true,
+	log.RecordDNS:        true,
 }
 
 func getLogs(w http.ResponseWriter, r *http.Request) {
@@ -187,6 +219,23 @@ func getLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	types := map[string]bool{}
+	for _, tp := range strings.Split(r.URL.Query().Get("type"), ",") {
+		tp = strings.TrimSpace(tp)
+		if tp == "" {
+			continue
+		}
+		if !logTypes[tp] {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, ErrBadRequest)
+			return
+		}
+		types[tp] = true
+	}
+	if len(types) == 0 {
+		types["log"] = true
+	}
+
 	var wsConn *websocket.Conn
 	if websocket.IsWebSocketUpgrade(r) {
 		var err error
@@ -207,15 +256,24 @@ func getLogs(w http.ResponseWriter, r *http.Request) {
 	var err error
 	for elm := range sub {
 		buf.Reset()
-		log := elm.(*log.Event)
-		if log.LogLevel < level {
+
+		var item Log
+		switch e := elm.(type) {
+		case *log.Event:
+			if !types["log"] || e.LogLevel < level {
+				continue
+			}
+			item = Log{Type: e.Type(), Payload: e.Payload}
+		case *log.Record:
+			if !types[e.Type] {
+				continue
+			}
+			item = Log{Type: e.Type, Payload: e.Payload, Data: e.Data}
+		default:
 			continue
 		}
 
-		if err := json.NewEncoder(buf).Encode(Log{
-			Type:    log.Type(),
-			Payload: log.Payload,
-		}); err != nil {
+		if err := json.NewEncoder(buf).Encode(item); err != nil {
 			break
 		}
 
@@ -57,13 +57,17 @@ func Fatalln(format string, v ...interface{}) {
 	log.Fatalf(format, v...)
 }
 
+// Subscribe returns a subscription of log events and records, events are
+// dropped if the subscription is not consumed in time
 func Subscribe() observable.Subscription {
 	sub, _ := source.Subscribe()
+	subscribers.Inc()
 	return sub
 }
 
 func UnSubscribe(sub observable.Subscription) {
 	source.UnSubscribe(sub)
+	subscribers.Dec()
 }
 
 func Level() LogLevel {
@@ -0,0 +1,43 @@
+package log
+
+import (
+	"fmt"
+
+	"go.uber.org/atomic"
+)
+
+// types of structured records
+const (
+	RecordConnection = "connection"
+	RecordRule       = "rule"
+	RecordProxy      = "proxy"
+	RecordDNS        = "dns"
+)
+
+var subscribers = atomic.NewInt32(0)
+
+// Record is a structured event, it is only sent to subscribers and isn't printed
+type Record struct {
+	Type    string
+	Payload string
+	Data    interface{}
+}
+
+// Enabled reports whether there is any subscriber, producers should check it
+// before building the data of a record
+func Enabled() bool {
+	return subscribers.Load() > 0
+}
+
+// Emit sends a record to subscribers
+func Emit(tp string, data interface{}, format string, v ...interface{}) {
+	if !Enabled() {
+		return
+	}
+
+	logCh <- &Record{
+		Type:    tp,
+		Payload: fmt.Sprintf(format, v...),
+		Data:    data,
+	}
+}
@@ -74,7 +74,7 @@ func main() {
 
 	if testConfig {
 		if _, err := executor.Parse(); err != nil {
-			log.Errorln(err.Error())
+			log.Errorln("%s", err.Error())
 			fmt.Printf("configuration file %s test failed\n", C.Path.Config())
 			os.Exit(1)
 		}
@@ -100,4 +100,11 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	<-sigCh
+
+	// exit immediately on the second signal
+	go func() {
+		<-sigCh
+		os.Exit(1)
+	}()
+	executor.Shutdown()
 }
@@ -24,7 +24,7 @@ type HttpListener struct {
 }
 
 func NewHttpProxy(addr string) (*HttpListener, error) {
-	l, err := net.Listen("tcp", addr)
+	l, err := adapters.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
@@ -57,16 +57,25 @@ func (l *HttpListener) Address() string {
 	return l.address
 }
 
-func canActivate(loginStr string, authenticator auth.Authenticator, cache *cache.Cache) (ret bool) {
+type authResult struct {
+	user string
+	ok   bool
+}
+
+// canActivate verifies the Proxy-Authorization credential and returns the authenticated user
+func canActivate(loginStr string, authenticator auth.Authenticator, cache *cache.Cache) (user string, ret bool) {
 	if result := cache.Get(loginStr); result != nil {
-		ret = result.(bool)
-		return
+		r := result.(authResult)
+		return r.user, r.ok
 	}
 	loginData, err := base64.StdEncoding.DecodeString(loginStr)
-	login := strings.Split(string(loginData), ":")
+	login := strings.SplitN(string(loginData), ":", 2)
 	ret = err == nil && len(login) == 2 && authenticator.Verify(login[0], login[1])
+	if ret {
+		user = login[0]
+	}
 
-	cache.Put(loginStr, ret, time.Minute)
+	cache.Put(loginStr, authResult{user: user, ok: ret}, time.Minute)
 	return
 }
 
@@ -78,17 +87,20 @@ func HandleConn(conn net.Conn, cache *cache.Cache) {
 		return
 	}
 
+	user := ""
 	authenticator := authStore.Authenticator()
 	if authenticator != nil {
 		if authStrings := strings.Split(request.Header.Get("Proxy-Authorization"), " "); len(authStrings) != 2 {
 			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic\r\n\r\n"))
 			conn.Close()
 			return
-		} else if !canActivate(authStrings[1], authenticator, cache) {
+		} else if u, ok := canActivate(authStrings[1], authenticator, cache); !ok {
 			conn.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
 			log.Infoln("Auth failed from %s", conn.RemoteAddr().String())
 			conn.Close()
 			return
+		} else {
+			user = u
 		}
 	}
 
@@ -97,9 +109,13 @@ func HandleConn(conn net.Conn, cache *cache.Cache) {
 		if err != nil {
 			return
 		}
-		tunnel.Add(adapters.NewHTTPS(request, conn))
+		socket := adapters.NewHTTPS(request, conn)
+		socket.Metadata().InUser = user
+		tunnel.Add(socket)
 		return
 	}
 
-	tunnel.Add(adapters.NewHTTP(request, conn))
+	h := adapters.NewHTTP(request, conn)
+	h.Metadata().InUser = user
+	tunnel.Add(h)
 }
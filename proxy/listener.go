@@ -4,28 +4,39 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/Dreamacro/clash/adapters/inbound"
 	"github.com/Dreamacro/clash/log"
 	"github.com/Dreamacro/clash/proxy/http"
 	"github.com/Dreamacro/clash/proxy/mixed"
 	"github.com/Dreamacro/clash/proxy/redir"
 	"github.com/Dreamacro/clash/proxy/socks"
+	"github.com/Dreamacro/clash/proxy/tun"
+)
+
+// the inbound names of per inbound bind addresses
+const (
+	InboundHTTP   = "http"
+	InboundSocks  = "socks"
+	InboundRedir  = "redir"
+	InboundTProxy = "tproxy"
+	InboundMixed  = "mixed"
 )
 
 var (
-	allowLan    = false
-	bindAddress = "*"
-
-	socksListener     *socks.SockListener
-	socksUDPListener  *socks.SockUDPListener
-	httpListener      *http.HttpListener
-	redirListener     *redir.RedirListener
-	redirUDPListener  *redir.RedirUDPListener
-	tproxyListener    *redir.TProxyListener
-	tproxyUDPListener *redir.RedirUDPListener
-	mixedListener     *mixed.MixedListener
-	mixedUDPLister    *socks.SockUDPListener
+	allowLan           = false
+	bindAddress        = []string{"*"}
+	inboundBindAddress = map[string][]string{}
+	bindMux            sync.RWMutex
+
+	socksListeners  = &listeners{}
+	httpListeners   = &listeners{}
+	redirListeners  = &listeners{}
+	tproxyListeners = &listeners{}
+	mixedListeners  = &listeners{}
+	tunListener     *tun.Listener
 
 	// lock for recreate function
 	socksMux  sync.Mutex
@@ -33,6 +44,7 @@ var (
 	redirMux  sync.Mutex
 	tproxyMux sync.Mutex
 	mixedMux  sync.Mutex
+	tunMux    sync.Mutex
 )
 
 type Ports struct {
@@ -43,283 +55,410 @@ type Ports struct {
 	MixedPort  int `json:"mixed-port"`
 }
 
+// listeners are the listeners of an inbound, one (TCP and UDP) listener for each address
+type listeners struct {
+	addrs  []string
+	closes []func()
+	tfo    bool
+}
+
+func (l *listeners) equal(addrs []string) bool {
+	if len(l.addrs) != len(addrs) || l.tfo != inbound.TCPFastOpen() {
+		return false
+	}
+	for i := range addrs {
+		if l.addrs[i] != addrs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// listen starts a listener for each address by fn, the started listeners are
+// closed if any of them fails
+func (l *listeners) listen(addrs []string, fn func(addr string) (func(), error)) error {
+	l.tfo = inbound.TCPFastOpen()
+	for _, addr := range addrs {
+		closeFn, err := fn(addr)
+		if err != nil {
+			l.close()
+			return err
+		}
+		l.addrs = append(l.addrs, addr)
+		l.closes = append(l.closes, closeFn)
+	}
+	return nil
+}
+
+func (l *listeners) close() {
+	for _, closeFn := range l.closes {
+		closeFn()
+	}
+	l.addrs, l.closes = nil, nil
+}
+
+func (l *listeners) port() int {
+	if len(l.addrs) == 0 {
+		return 0
+	}
+	_, portStr, _ := net.SplitHostPort(l.addrs[0])
+	port, _ := strconv.Atoi(portStr)
+	return port
+}
+
 func AllowLan() bool {
 	return allowLan
 }
 
-func BindAddress() string {
+func BindAddress() []string {
+	bindMux.RLock()
+	defer bindMux.RUnlock()
 	return bindAddress
 }
 
+// InboundBindAddress returns the bind addresses overridden by each inbound
+func InboundBindAddress() map[string][]string {
+	bindMux.RLock()
+	defer bindMux.RUnlock()
+	return inboundBindAddress
+}
+
 func SetAllowLan(al bool) {
 	allowLan = al
 }
 
-func SetBindAddress(host string) {
-	bindAddress = host
+func TCPFastOpen() bool {
+	return inbound.TCPFastOpen()
 }
 
-func ReCreateHTTP(port int) error {
-	httpMux.Lock()
-	defer httpMux.Unlock()
+// SetTCPFastOpen sets whether the TCP listeners accept TCP Fast Open, the
+// listeners are recreated if it is changed
+func SetTCPFastOpen(enable bool) {
+	inbound.SetTCPFastOpen(enable)
+}
 
-	addr := genAddr(bindAddress, port, allowLan)
+// SetBindAddress sets the addresses which the inbounds listen on when allow-lan
+// is enabled, hosts should be validated by ParseBindAddress
+func SetBindAddress(hosts []string) {
+	bindMux.Lock()
+	defer bindMux.Unlock()
 
-	if httpListener != nil {
-		if httpListener.Address() == addr {
-			return nil
-		}
-		httpListener.Close()
-		httpListener = nil
+	if len(hosts) == 0 {
+		hosts = []string{"*"}
 	}
+	bindAddress = hosts
+}
 
-	if portIsZero(addr) {
-		return nil
-	}
+// SetInboundBindAddress sets the bind addresses of the inbounds by their
+// names, which override the addresses set by SetBindAddress
+func SetInboundBindAddress(m map[string][]string) {
+	bindMux.Lock()
+	defer bindMux.Unlock()
 
-	var err error
-	httpListener, err = http.NewHttpProxy(addr)
-	if err != nil {
-		return err
+	if m == nil {
+		m = map[string][]string{}
 	}
-
-	return nil
+	inboundBindAddress = m
 }
 
-func ReCreateSocks(port int) error {
-	socksMux.Lock()
-	defer socksMux.Unlock()
+// ParseBindAddress validates the bind addresses, a host is "*", an IP address
+// or the name of an interface which is replaced by the addresses of it. A
+// wildcard address can't be combined with others, as the port would be in use.
+func ParseBindAddress(hosts []string) ([]string, error) {
+	if len(hosts) == 0 {
+		return []string{"*"}, nil
+	}
+
+	addrs := []string{}
+	seen := map[string]bool{}
+	wildcard := ""
+	for _, host := range hosts {
+		ips, err := resolveBindHost(host)
+		if err != nil {
+			return nil, err
+		}
 
-	addr := genAddr(bindAddress, port, allowLan)
+		for _, ip := range ips {
+			if ip == "*" || net.ParseIP(ip).IsUnspecified() {
+				wildcard = host
+			}
+			if !seen[ip] {
+				seen[ip] = true
+				addrs = append(addrs, ip)
+			}
+		}
+	}
 
-	shouldTCPIgnore := false
-	shouldUDPIgnore := false
+	if wildcard != "" && len(addrs) > 1 {
+		return nil, fmt.Errorf("bind address %s can't be combined with other addresses", wildcard)
+	}
 
-	if socksListener != nil {
-		if socksListener.Address() != addr {
-			socksListener.Close()
-			socksListener = nil
-		} else {
-			shouldTCPIgnore = true
+	return addrs, nil
+}
+
+func resolveBindHost(host string) ([]string, error) {
+	if host == "*" {
+		return []string{host}, nil
+	}
+
+	// the zone of a link-local IPv6 address, e.g. fe80::1%eth0
+	ip, zone := host, ""
+	if idx := strings.IndexByte(host, '%'); idx != -1 {
+		ip, zone = host[:idx], host[idx+1:]
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		if zone != "" {
+			if parsed.To4() != nil {
+				return nil, fmt.Errorf("bind address %s: zone of IPv4 address", host)
+			}
+			if _, err := net.InterfaceByName(zone); err != nil {
+				return nil, fmt.Errorf("bind address %s: %w", host, err)
+			}
 		}
+		return []string{host}, nil
 	}
 
-	if socksUDPListener != nil {
-		if socksUDPListener.Address() != addr {
-			socksUDPListener.Close()
-			socksUDPListener = nil
+	iface, err := net.InterfaceByName(host)
+	if err != nil {
+		return nil, fmt.Errorf("bind address %s isn't an IP address or interface: %w", host, err)
+	}
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("bind address %s: %w", host, err)
+	}
+
+	ips := []string{}
+	for _, addr := range ifaceAddrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipNet.IP.String()+"%"+iface.Name)
 		} else {
-			shouldUDPIgnore = true
+			ips = append(ips, ipNet.IP.String())
 		}
 	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("bind address %s: interface has no address", host)
+	}
+	return ips, nil
+}
 
-	if shouldTCPIgnore && shouldUDPIgnore {
+func ReCreateHTTP(port int) error {
+	httpMux.Lock()
+	defer httpMux.Unlock()
+
+	addrs := genAddrs(InboundHTTP, port)
+	if httpListeners.equal(addrs) {
 		return nil
 	}
+	httpListeners.close()
 
-	if portIsZero(addr) {
+	if port == 0 {
 		return nil
 	}
 
-	tcpListener, err := socks.NewSocksProxy(addr)
-	if err != nil {
-		return err
+	return httpListeners.listen(addrs, func(addr string) (func(), error) {
+		l, err := http.NewHttpProxy(addr)
+		if err != nil {
+			return nil, err
+		}
+		return l.Close, nil
+	})
+}
+
+func ReCreateSocks(port int) error {
+	socksMux.Lock()
+	defer socksMux.Unlock()
+
+	addrs := genAddrs(InboundSocks, port)
+	if socksListeners.equal(addrs) {
+		return nil
 	}
+	socksListeners.close()
 
-	udpListener, err := socks.NewSocksUDPProxy(addr)
-	if err != nil {
-		tcpListener.Close()
-		return err
+	if port == 0 {
+		return nil
 	}
 
-	socksListener = tcpListener
-	socksUDPListener = udpListener
+	return socksListeners.listen(addrs, func(addr string) (func(), error) {
+		tcpListener, err := socks.NewSocksProxy(addr)
+		if err != nil {
+			return nil, err
+		}
 
-	return nil
+		udpListener, err := socks.NewSocksUDPProxy(addr)
+		if err != nil {
+			tcpListener.Close()
+			return nil, err
+		}
+
+		return func() {
+			tcpListener.Close()
+			udpListener.Close()
+		}, nil
+	})
 }
 
 func ReCreateRedir(port int) error {
 	redirMux.Lock()
 	defer redirMux.Unlock()
 
-	addr := genAddr(bindAddress, port, allowLan)
-
-	if redirListener != nil {
-		if redirListener.Address() == addr {
-			return nil
-		}
-		redirListener.Close()
-		redirListener = nil
-	}
-
-	if redirUDPListener != nil {
-		if redirUDPListener.Address() == addr {
-			return nil
-		}
-		redirUDPListener.Close()
-		redirUDPListener = nil
+	addrs := genAddrs(InboundRedir, port)
+	if redirListeners.equal(addrs) {
+		return nil
 	}
+	redirListeners.close()
 
-	if portIsZero(addr) {
+	if port == 0 {
 		return nil
 	}
 
-	var err error
-	redirListener, err = redir.NewRedirProxy(addr)
-	if err != nil {
-		return err
-	}
+	return redirListeners.listen(addrs, func(addr string) (func(), error) {
+		tcpListener, err := redir.NewRedirProxy(addr)
+		if err != nil {
+			return nil, err
+		}
 
-	redirUDPListener, err = redir.NewRedirUDPProxy(addr)
-	if err != nil {
-		log.Warnln("Failed to start Redir UDP Listener: %s", err)
-	}
+		udpListener, err := redir.NewRedirUDPProxy(addr)
+		if err != nil {
+			log.Warnln("Failed to start Redir UDP Listener: %s", err)
+			return tcpListener.Close, nil
+		}
 
-	return nil
+		return func() {
+			tcpListener.Close()
+			udpListener.Close()
+		}, nil
+	})
 }
 
 func ReCreateTProxy(port int) error {
 	tproxyMux.Lock()
 	defer tproxyMux.Unlock()
 
-	addr := genAddr(bindAddress, port, allowLan)
-
-	if tproxyListener != nil {
-		if tproxyListener.Address() == addr {
-			return nil
-		}
-		tproxyListener.Close()
-		tproxyListener = nil
-	}
-
-	if tproxyUDPListener != nil {
-		if tproxyUDPListener.Address() == addr {
-			return nil
-		}
-		tproxyUDPListener.Close()
-		tproxyUDPListener = nil
+	addrs := genAddrs(InboundTProxy, port)
+	if tproxyListeners.equal(addrs) {
+		return nil
 	}
+	tproxyListeners.close()
 
-	if portIsZero(addr) {
+	if port == 0 {
 		return nil
 	}
 
-	var err error
-	tproxyListener, err = redir.NewTProxy(addr)
-	if err != nil {
-		return err
-	}
+	return tproxyListeners.listen(addrs, func(addr string) (func(), error) {
+		tcpListener, err := redir.NewTProxy(addr)
+		if err != nil {
+			return nil, err
+		}
 
-	tproxyUDPListener, err = redir.NewRedirUDPProxy(addr)
-	if err != nil {
-		log.Warnln("Failed to start TProxy UDP Listener: %s", err)
-	}
+		udpListener, err := redir.NewRedirUDPProxy(addr)
+		if err != nil {
+			log.Warnln("Failed to start TProxy UDP Listener: %s", err)
+			return tcpListener.Close, nil
+		}
 
-	return nil
+		return func() {
+			tcpListener.Close()
+			udpListener.Close()
+		}, nil
+	})
 }
 
 func ReCreateMixed(port int) error {
 	mixedMux.Lock()
 	defer mixedMux.Unlock()
 
-	addr := genAddr(bindAddress, port, allowLan)
+	addrs := genAddrs(InboundMixed, port)
+	if mixedListeners.equal(addrs) {
+		return nil
+	}
+	mixedListeners.close()
 
-	shouldTCPIgnore := false
-	shouldUDPIgnore := false
+	if port == 0 {
+		return nil
+	}
 
-	if mixedListener != nil {
-		if mixedListener.Address() != addr {
-			mixedListener.Close()
-			mixedListener = nil
-		} else {
-			shouldTCPIgnore = true
+	return mixedListeners.listen(addrs, func(addr string) (func(), error) {
+		tcpListener, err := mixed.NewMixedProxy(addr)
+		if err != nil {
+			return nil, err
 		}
-	}
-	if mixedUDPLister != nil {
-		if mixedUDPLister.Address() != addr {
-			mixedUDPLister.Close()
-			mixedUDPLister = nil
-		} else {
-			shouldUDPIgnore = true
+
+		udpListener, err := socks.NewSocksUDPProxy(addr)
+		if err != nil {
+			tcpListener.Close()
+			return nil, err
 		}
-	}
 
-	if shouldTCPIgnore && shouldUDPIgnore {
-		return nil
-	}
+		return func() {
+			tcpListener.Close()
+			udpListener.Close()
+		}, nil
+	})
+}
 
-	if portIsZero(addr) {
-		return nil
+// ReCreateTun recreates the tun inbound if config is changed, nil config
+// removes the device
+func ReCreateTun(config *tun.Config) error {
+	tunMux.Lock()
+	defer tunMux.Unlock()
+
+	if tunListener != nil {
+		if config != nil && tunListener.Config() == *config {
+			return nil
+		}
+		tunListener.Close()
+		tunListener = nil
 	}
 
-	var err error
-	mixedListener, err = mixed.NewMixedProxy(addr)
-	if err != nil {
-		return err
+	if config == nil {
+		return nil
 	}
 
-	mixedUDPLister, err = socks.NewSocksUDPProxy(addr)
+	l, err := tun.New(*config)
 	if err != nil {
-		mixedListener.Close()
 		return err
 	}
-
+	tunListener = l
 	return nil
 }
 
 // GetPorts return the ports of proxy servers
 func GetPorts() *Ports {
-	ports := &Ports{}
-
-	if httpListener != nil {
-		_, portStr, _ := net.SplitHostPort(httpListener.Address())
-		port, _ := strconv.Atoi(portStr)
-		ports.Port = port
-	}
-
-	if socksListener != nil {
-		_, portStr, _ := net.SplitHostPort(socksListener.Address())
-		port, _ := strconv.Atoi(portStr)
-		ports.SocksPort = port
-	}
-
-	if redirListener != nil {
-		_, portStr, _ := net.SplitHostPort(redirListener.Address())
-		port, _ := strconv.Atoi(portStr)
-		ports.RedirPort = port
-	}
-
-	if tproxyListener != nil {
-		_, portStr, _ := net.SplitHostPort(tproxyListener.Address())
-		port, _ := strconv.Atoi(portStr)
-		ports.TProxyPort = port
+	return &Ports{
+		Port:       httpListeners.port(),
+		SocksPort:  socksListeners.port(),
+		RedirPort:  redirListeners.port(),
+		TProxyPort: tproxyListeners.port(),
+		MixedPort:  mixedListeners.port(),
 	}
+}
 
-	if mixedListener != nil {
-		_, portStr, _ := net.SplitHostPort(mixedListener.Address())
-		port, _ := strconv.Atoi(portStr)
-		ports.MixedPort = port
+// genAddrs returns the listen addresses of the inbound, they are the loopback
+// address unless allow-lan is enabled
+func genAddrs(inbound string, port int) []string {
+	if !allowLan {
+		return []string{fmt.Sprintf("127.0.0.1:%d", port)}
 	}
 
-	return ports
-}
-
-func portIsZero(addr string) bool {
-	_, port, err := net.SplitHostPort(addr)
-	if port == "0" || port == "" || err != nil {
-		return true
+	bindMux.RLock()
+	hosts, ok := inboundBindAddress[inbound]
+	if !ok || len(hosts) == 0 {
+		hosts = bindAddress
 	}
-	return false
-}
+	bindMux.RUnlock()
 
-func genAddr(host string, port int, allowLan bool) string {
-	if allowLan {
+	addrs := make([]string, 0, len(hosts))
+	for _, host := range hosts {
 		if host == "*" {
-			return fmt.Sprintf(":%d", port)
+			// listen on both IPv4 and IPv6
+			addrs = append(addrs, fmt.Sprintf(":%d", port))
 		} else {
-			return fmt.Sprintf("%s:%d", host, port)
+			addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(port)))
 		}
 	}
-
-	return fmt.Sprintf("127.0.0.1:%d", port)
+	return addrs
 }
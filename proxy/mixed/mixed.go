@@ -4,7 +4,10 @@ import (
 	"net"
 	"time"
 
+	"github.com/Dreamacro/clash/adapters/inbound"
 	"github.com/Dreamacro/clash/common/cache"
+	N "github.com/Dreamacro/clash/common/net"
+	"github.com/Dreamacro/clash/component/socks4"
 	"github.com/Dreamacro/clash/component/socks5"
 	"github.com/Dreamacro/clash/log"
 
@@ -20,14 +23,14 @@ type MixedListener struct {
 }
 
 func NewMixedProxy(addr string) (*MixedListener, error) {
-	l, err := net.Listen("tcp", addr)
+	l, err := inbound.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 
 	ml := &MixedListener{l, addr, false, cache.New(30 * time.Second)}
 	go func() {
-		log.Infoln("Mixed(http+socks5) proxy listening at: %s", addr)
+		log.Infoln("Mixed(http+socks) proxy listening at: %s", addr)
 
 		for {
 			c, err := ml.Accept()
@@ -54,14 +57,18 @@ func (l *MixedListener) Address() string {
 }
 
 func handleConn(conn net.Conn, cache *cache.Cache) {
-	bufConn := NewBufferedConn(conn)
+	bufConn := N.NewBufferedConn(conn)
 	head, err := bufConn.Peek(1)
 	if err != nil {
 		return
 	}
 
-	if head[0] == socks5.Version {
-		socks.HandleSocks(bufConn)
+	switch head[0] {
+	case socks4.Version:
+		socks.HandleSocks4(bufConn)
+		return
+	case socks5.Version:
+		socks.HandleSocks5(bufConn)
 		return
 	}
 
@@ -16,7 +16,7 @@ type RedirListener struct {
 }
 
 func NewRedirProxy(addr string) (*RedirListener, error) {
-	l, err := net.Listen("tcp", addr)
+	l, err := inbound.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
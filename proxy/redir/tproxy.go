@@ -17,7 +17,7 @@ type TProxyListener struct {
 }
 
 func NewTProxy(addr string) (*TProxyListener, error) {
-	l, err := net.Listen("tcp", addr)
+	l, err := inbound.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
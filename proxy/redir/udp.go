@@ -51,6 +51,7 @@ func NewRedirUDPProxy(addr string) (*RedirUDPListener, error) {
 
 			rAddr, err := getOrigDst(oob, oobn)
 			if err != nil {
+				pool.Put(buf)
 				continue
 			}
 			handleRedirUDP(l, buf[:n], lAddr, rAddr)
@@ -23,7 +23,8 @@ func dialUDP(network string, lAddr *net.UDPAddr, rAddr *net.UDPAddr) (*net.UDPCo
 		return nil, err
 	}
 
-	fd, err := syscall.Socket(udpAddrFamily(network, lAddr, rAddr), syscall.SOCK_DGRAM, 0)
+	family := udpAddrFamily(network, lAddr, rAddr)
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -38,6 +39,14 @@ func dialUDP(network string, lAddr *net.UDPAddr, rAddr *net.UDPAddr) (*net.UDPCo
 		return nil, err
 	}
 
+	// binding a non-local ipv6 address needs IPV6_TRANSPARENT as well
+	if family == syscall.AF_INET6 {
+		if err = syscall.SetsockoptInt(fd, syscall.SOL_IPV6, IPV6_TRANSPARENT, 1); err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+	}
+
 	if err = syscall.Bind(fd, lSockAddr); err != nil {
 		syscall.Close(fd)
 		return nil, err
@@ -89,7 +98,7 @@ func udpAddrFamily(net string, lAddr, rAddr *net.UDPAddr) int {
 		return syscall.AF_INET6
 	}
 
-	if (lAddr == nil || lAddr.IP.To4() != nil) && (rAddr == nil || lAddr.IP.To4() != nil) {
+	if (lAddr == nil || lAddr.IP.To4() != nil) && (rAddr == nil || rAddr.IP.To4() != nil) {
 		return syscall.AF_INET
 	}
 	return syscall.AF_INET6
@@ -6,6 +6,8 @@ import (
 	"net"
 
 	adapters "github.com/Dreamacro/clash/adapters/inbound"
+	N "github.com/Dreamacro/clash/common/net"
+	"github.com/Dreamacro/clash/component/socks4"
 	"github.com/Dreamacro/clash/component/socks5"
 	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/log"
@@ -20,7 +22,7 @@ type SockListener struct {
 }
 
 func NewSocksProxy(addr string) (*SockListener, error) {
-	l, err := net.Listen("tcp", addr)
+	l, err := adapters.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
@@ -52,19 +54,54 @@ func (l *SockListener) Address() string {
 	return l.address
 }
 
+// HandleSocks handles SOCKS4, SOCKS4a and SOCKS5 by the version in the first
+// byte, the handlers of each version get the buffered conn
 func HandleSocks(conn net.Conn) {
-	target, command, err := socks5.ServerHandshake(conn, authStore.Authenticator())
+	if c, ok := conn.(*net.TCPConn); ok {
+		c.SetKeepAlive(true)
+	}
+
+	bufConn := N.NewBufferedConn(conn)
+	head, err := bufConn.Peek(1)
 	if err != nil {
 		conn.Close()
 		return
 	}
-	if c, ok := conn.(*net.TCPConn); ok {
-		c.SetKeepAlive(true)
+
+	switch head[0] {
+	case socks4.Version:
+		HandleSocks4(bufConn)
+	case socks5.Version:
+		HandleSocks5(bufConn)
+	default:
+		conn.Close()
+	}
+}
+
+func HandleSocks4(conn net.Conn) {
+	target, _, userID, err := socks4.ServerHandshake(conn, authStore.Authenticator())
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if userID != "" {
+		log.Debugln("[SOCKS4] %s identified as %s", conn.RemoteAddr(), userID)
+	}
+	tunnel.Add(adapters.NewSocket(target, conn, C.SOCKS4))
+}
+
+func HandleSocks5(conn net.Conn) {
+	target, command, user, err := socks5.ServerHandshake(conn, authStore.Authenticator())
+	if err != nil {
+		conn.Close()
+		return
 	}
 	if command == socks5.CmdUDPAssociate {
 		defer conn.Close()
 		io.Copy(ioutil.Discard, conn)
 		return
 	}
-	tunnel.Add(adapters.NewSocket(target, conn, C.SOCKS))
+	socket := adapters.NewSocket(target, conn, C.SOCKS)
+	socket.Metadata().InUser = user
+	tunnel.Add(socket)
 }
@@ -0,0 +1,276 @@
+package tun
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ifreq is the struct ifreq of ioctl, the union is 24 bytes on 64 bits
+// platforms
+type ifreq struct {
+	name [unix.IFNAMSIZ]byte
+	data [24]byte
+}
+
+func newIfreq(name string) *ifreq {
+	ifr := &ifreq{}
+	copy(ifr.name[:unix.IFNAMSIZ-1], name)
+	return ifr
+}
+
+// setInet4Addr sets the union as a struct sockaddr_in
+func (ifr *ifreq) setInet4Addr(ip net.IP) {
+	*(*uint16)(unsafe.Pointer(&ifr.data[0])) = unix.AF_INET
+	copy(ifr.data[4:8], ip.To4())
+}
+
+// in6Ifreq is the struct in6_ifreq of ioctl
+type in6Ifreq struct {
+	addr      [16]byte
+	prefixLen uint32
+	ifindex   int32
+}
+
+func ioctl(fd int, req uint, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// openDevice creates the TUN device of name and brings it up with the
+// addresses, inet6 is nil without IPv6. The device is removed with its
+// routes when it is closed.
+func openDevice(name string, mtu int, inet4, inet6 *net.IPNet) (io.ReadWriteCloser, string, error) {
+	fd, err := unix.Open("/dev/net/tun", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ifr := newIfreq(name)
+	*(*uint16)(unsafe.Pointer(&ifr.data[0])) = unix.IFF_TUN | unix.IFF_NO_PI
+	if err := ioctl(fd, unix.TUNSETIFF, unsafe.Pointer(ifr)); err != nil {
+		unix.Close(fd)
+		return nil, "", err
+	}
+	name = string(ifr.name[:bytes.IndexByte(ifr.name[:], 0)])
+
+	// non-blocking, so that Read returns when the file is closed
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, "", err
+	}
+	file := os.NewFile(uintptr(fd), "/dev/net/tun")
+
+	if err := setupDevice(name, inet4, mtu); err != nil {
+		file.Close()
+		return nil, "", err
+	}
+	if inet6 != nil {
+		if err := setupInet6(name, inet6); err != nil {
+			file.Close()
+			return nil, "", err
+		}
+	}
+	return file, name, nil
+}
+
+func setupDevice(name string, ipnet *net.IPNet, mtu int) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr := newIfreq(name)
+	ifr.setInet4Addr(ipnet.IP)
+	if err := ioctl(fd, unix.SIOCSIFADDR, unsafe.Pointer(ifr)); err != nil {
+		return fmt.Errorf("set address error: %w", err)
+	}
+
+	ifr = newIfreq(name)
+	ifr.setInet4Addr(net.IP(ipnet.Mask))
+	if err := ioctl(fd, unix.SIOCSIFNETMASK, unsafe.Pointer(ifr)); err != nil {
+		return fmt.Errorf("set netmask error: %w", err)
+	}
+
+	ifr = newIfreq(name)
+	*(*int32)(unsafe.Pointer(&ifr.data[0])) = int32(mtu)
+	if err := ioctl(fd, unix.SIOCSIFMTU, unsafe.Pointer(ifr)); err != nil {
+		return fmt.Errorf("set mtu error: %w", err)
+	}
+
+	ifr = newIfreq(name)
+	if err := ioctl(fd, unix.SIOCGIFFLAGS, unsafe.Pointer(ifr)); err != nil {
+		return fmt.Errorf("get flags error: %w", err)
+	}
+	*(*uint16)(unsafe.Pointer(&ifr.data[0])) |= unix.IFF_UP | unix.IFF_RUNNING
+	if err := ioctl(fd, unix.SIOCSIFFLAGS, unsafe.Pointer(ifr)); err != nil {
+		return fmt.Errorf("set flags error: %w", err)
+	}
+	return nil
+}
+
+// setupInet6 adds the IPv6 address to the device, the duplicate address
+// detection is disabled so that the address can be listened on at once
+func setupInet6(name string, ipnet *net.IPNet) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile("/proc/sys/net/ipv6/conf/"+name+"/accept_dad", []byte("0"), 0644); err != nil {
+		return fmt.Errorf("disable ipv6 dad error: %w", err)
+	}
+
+	fd, err := unix.Socket(unix.AF_INET6, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ones, _ := ipnet.Mask.Size()
+	ifr := &in6Ifreq{prefixLen: uint32(ones), ifindex: int32(iface.Index)}
+	copy(ifr.addr[:], ipnet.IP.To16())
+	if err := ioctl(fd, unix.SIOCSIFADDR, unsafe.Pointer(ifr)); err != nil {
+		return fmt.Errorf("set ipv6 address error: %w", err)
+	}
+	return nil
+}
+
+// addDefaultRoutes routes 0.0.0.0/1 and 128.0.0.0/1 to the device, which
+// take precedence over the default route without replacing it, and ::/1 and
+// 8000::/1 with ipv6
+func addDefaultRoutes(name string, ipv6 bool) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+
+	dsts := []net.IP{net.IPv4(0, 0, 0, 0).To4(), net.IPv4(128, 0, 0, 0).To4()}
+	if ipv6 {
+		dsts = append(dsts, net.IPv6zero, net.ParseIP("8000::"))
+	}
+	for _, dst := range dsts {
+		if err := addRoute(dst, 1, iface.Index); err != nil {
+			return fmt.Errorf("add route %s/1 error: %w", dst, err)
+		}
+	}
+	return nil
+}
+
+// addRoute adds the route of dst/ones via the interface of index by netlink,
+// the family of the route is the one of the length of dst
+func addRoute(dst net.IP, ones int, index int) error {
+	family := unix.AF_INET
+	if len(dst) == net.IPv6len {
+		family = unix.AF_INET6
+	}
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	dstLen := unix.SizeofRtAttr + len(dst)
+	oifLen := unix.SizeofRtAttr + 4
+	msg := make([]byte, unix.SizeofNlMsghdr+unix.SizeofRtMsg+dstLen+oifLen)
+	*(*unix.NlMsghdr)(unsafe.Pointer(&msg[0])) = unix.NlMsghdr{
+		Len:   uint32(len(msg)),
+		Type:  unix.RTM_NEWROUTE,
+		Flags: unix.NLM_F_REQUEST | unix.NLM_F_ACK | unix.NLM_F_CREATE | unix.NLM_F_EXCL,
+		Seq:   1,
+	}
+	*(*unix.RtMsg)(unsafe.Pointer(&msg[unix.SizeofNlMsghdr])) = unix.RtMsg{
+		Family:   uint8(family),
+		Dst_len:  uint8(ones),
+		Table:    unix.RT_TABLE_MAIN,
+		Protocol: unix.RTPROT_BOOT,
+		Scope:    unix.RT_SCOPE_LINK,
+		Type:     unix.RTN_UNICAST,
+	}
+
+	offset := unix.SizeofNlMsghdr + unix.SizeofRtMsg
+	*(*unix.RtAttr)(unsafe.Pointer(&msg[offset])) = unix.RtAttr{Len: uint16(dstLen), Type: unix.RTA_DST}
+	copy(msg[offset+unix.SizeofRtAttr:], dst)
+	offset += dstLen
+	*(*unix.RtAttr)(unsafe.Pointer(&msg[offset])) = unix.RtAttr{Len: uint16(oifLen), Type: unix.RTA_OIF}
+	*(*uint32)(unsafe.Pointer(&msg[offset+unix.SizeofRtAttr])) = uint32(index)
+
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4096)
+	n, _, err := unix.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return err
+	}
+	if n < unix.SizeofNlMsghdr+4 {
+		return errors.New("invalid netlink response")
+	}
+
+	header := (*unix.NlMsghdr)(unsafe.Pointer(&buf[0]))
+	if header.Type != unix.NLMSG_ERROR {
+		return errors.New("invalid netlink response")
+	}
+	if errno := *(*int32)(unsafe.Pointer(&buf[unix.SizeofNlMsghdr])); errno != 0 {
+		return unix.Errno(-errno)
+	}
+	return nil
+}
+
+// DefaultInterface returns the interface of the default route with the
+// lowest metric, the interface of exclude is skipped
+func DefaultInterface(exclude string) (string, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	name, metric := "", -1
+	scanner := bufio.NewScanner(f)
+	// skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[0] == exclude || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+
+		m, err := strconv.Atoi(fields[6])
+		if err != nil {
+			continue
+		}
+		if metric == -1 || m < metric {
+			name, metric = fields[0], m
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		return "", errors.New("default route not found")
+	}
+	return name, nil
+}
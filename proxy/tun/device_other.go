@@ -0,0 +1,24 @@
+// +build !linux
+
+package tun
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+var errNotSupported = errors.New("tun is only supported on Linux")
+
+func openDevice(name string, mtu int, inet4, inet6 *net.IPNet) (io.ReadWriteCloser, string, error) {
+	return nil, "", errNotSupported
+}
+
+func addDefaultRoutes(name string, ipv6 bool) error {
+	return errNotSupported
+}
+
+// DefaultInterface returns the interface of the default route
+func DefaultInterface(exclude string) (string, error) {
+	return "", errNotSupported
+}
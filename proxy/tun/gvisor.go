@@ -0,0 +1,114 @@
+package tun
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	gstack "gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	gvisorNIC = 1
+
+	// gvisorMaxInFlight is the max number of the pending handshakes
+	gvisorMaxInFlight = 1024
+)
+
+// gvisorStack terminates the TCP connections of the device in the userspace
+// TCP/IP stack of gVisor. The stack accepts the connections to any address,
+// and the local address of an accepted connection is its original
+// destination.
+type gvisorStack struct {
+	ep     *channel.Endpoint
+	stack  *gstack.Stack
+	cancel context.CancelFunc
+}
+
+// newGVisorStack writes the packets of the stack to device, handle is
+// called with the accepted connections
+func newGVisorStack(device io.Writer, mtu int, handle func(net.Conn)) (*gvisorStack, error) {
+	s := gstack.New(gstack.Options{
+		NetworkProtocols:   []gstack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []gstack.TransportProtocolFactory{tcp.NewProtocol},
+	})
+
+	sack := tcpip.TCPSACKEnabled(true)
+	if err := s.SetTransportProtocolOption(tcp.ProtocolNumber, &sack); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("enable SACK error: %s", err)
+	}
+
+	ep := channel.New(gvisorMaxInFlight, uint32(mtu), "")
+	if err := s.CreateNIC(gvisorNIC, ep); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("create NIC error: %s", err)
+	}
+	// accept the packets to any address and reply from it
+	s.SetPromiscuousMode(gvisorNIC, true)
+	s.SetSpoofing(gvisorNIC, true)
+	s.SetRouteTable([]tcpip.Route{
+		{Destination: header.IPv4EmptySubnet, NIC: gvisorNIC},
+		{Destination: header.IPv6EmptySubnet, NIC: gvisorNIC},
+	})
+
+	forwarder := tcp.NewForwarder(s, 0, gvisorMaxInFlight, func(r *tcp.ForwarderRequest) {
+		var wq waiter.Queue
+		conn, err := r.CreateEndpoint(&wq)
+		if err != nil {
+			r.Complete(true)
+			return
+		}
+		r.Complete(false)
+		handle(gonet.NewTCPConn(&wq, conn))
+	})
+	s.SetTransportProtocolHandler(tcp.ProtocolNumber, forwarder.HandlePacket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			pkt := ep.ReadContext(ctx)
+			if pkt == nil {
+				return
+			}
+			view := pkt.ToView()
+			pkt.DecRef()
+			device.Write(view.AsSlice())
+			view.Release()
+		}
+	}()
+
+	return &gvisorStack{ep: ep, stack: s, cancel: cancel}, nil
+}
+
+// inject delivers a packet read from the device to the stack, the packet
+// is copied
+func (s *gvisorStack) inject(p ipPacket) {
+	proto := header.IPv4ProtocolNumber
+	if !p.isIPv4() {
+		proto = header.IPv6ProtocolNumber
+	}
+
+	pkt := gstack.NewPacketBuffer(gstack.PacketBufferOptions{Payload: buffer.MakeWithData(p.b)})
+	s.ep.InjectInbound(proto, pkt)
+	pkt.DecRef()
+}
+
+func (s *gvisorStack) close() {
+	if s == nil {
+		return
+	}
+	s.cancel()
+	s.ep.Close()
+	s.stack.Close()
+}
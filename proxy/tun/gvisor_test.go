@@ -0,0 +1,83 @@
+package tun
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	wgtun "golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+// netstackWriter writes the packets of the gvisor stack to the client
+type netstackWriter struct {
+	device wgtun.Device
+}
+
+func (w *netstackWriter) Write(b []byte) (int, error) {
+	if _, err := w.device.Write([][]byte{append([]byte{}, b...)}, 0); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func TestGVisorStack(t *testing.T) {
+	// the client is another userspace stack, its packets are the ones read
+	// from the device
+	device, client, err := netstack.CreateNetTUN([]netip.Addr{netip.MustParseAddr("172.19.0.1")}, nil, 1500)
+	require.NoError(t, err)
+	defer device.Close()
+
+	accepted := make(chan net.Conn, 1)
+	s, err := newGVisorStack(&netstackWriter{device}, 1500, func(c net.Conn) {
+		accepted <- c
+	})
+	require.NoError(t, err)
+	defer s.close()
+
+	go func() {
+		bufs, sizes := [][]byte{make([]byte, 2048)}, []int{0}
+		for {
+			if _, err := device.Read(bufs, sizes, 0); err != nil {
+				return
+			}
+			if p, err := parseIP(bufs[0][:sizes[0]]); err == nil && p.protocol() == protocolTCP {
+				s.inject(p)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := client.DialContextTCPAddrPort(ctx, netip.MustParseAddrPort("1.1.1.1:80"))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var c net.Conn
+	select {
+	case c = <-accepted:
+	case <-ctx.Done():
+		t.Fatal("no connection accepted")
+	}
+	defer c.Close()
+	assert.Equal(t, "1.1.1.1:80", c.LocalAddr().String())
+	assert.Equal(t, conn.LocalAddr().String(), c.RemoteAddr().String())
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = c.Write([]byte("pong"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+}
@@ -0,0 +1,215 @@
+package tun
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+const (
+	protocolTCP = 6
+	protocolUDP = 17
+
+	ipv4HeaderLen = 20
+	ipv6HeaderLen = 40
+	udpHeaderLen  = 8
+	tcpHeaderLen  = 20
+)
+
+var errInvalidPacket = errors.New("invalid packet")
+
+// ipPacket is an IPv4 or IPv6 packet read from the device, hl is the length
+// of the header before the TCP or UDP segment
+type ipPacket struct {
+	b  []byte
+	hl int
+}
+
+// parseIP returns the packet of b, the IPv4 fragments and the IPv6 packets
+// with extension headers are invalid since the transport headers can't be
+// rewritten
+func parseIP(b []byte) (ipPacket, error) {
+	if len(b) == 0 {
+		return ipPacket{}, errInvalidPacket
+	}
+
+	switch b[0] >> 4 {
+	case 4:
+		if len(b) < ipv4HeaderLen {
+			return ipPacket{}, errInvalidPacket
+		}
+
+		ihl := int(b[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(b[2:4]))
+		if ihl < ipv4HeaderLen || total < ihl || total > len(b) {
+			return ipPacket{}, errInvalidPacket
+		}
+
+		// more fragments flag or fragment offset
+		if binary.BigEndian.Uint16(b[6:8])&0x3fff != 0 {
+			return ipPacket{}, errInvalidPacket
+		}
+		return ipPacket{b: b[:total], hl: ihl}, nil
+	case 6:
+		if len(b) < ipv6HeaderLen {
+			return ipPacket{}, errInvalidPacket
+		}
+
+		total := ipv6HeaderLen + int(binary.BigEndian.Uint16(b[4:6]))
+		if total > len(b) {
+			return ipPacket{}, errInvalidPacket
+		}
+		return ipPacket{b: b[:total], hl: ipv6HeaderLen}, nil
+	default:
+		return ipPacket{}, errInvalidPacket
+	}
+}
+
+func (p ipPacket) isIPv4() bool { return p.b[0]>>4 == 4 }
+
+// protocol returns the next header of IPv6, it isn't TCP or UDP if the
+// packet has extension headers
+func (p ipPacket) protocol() byte {
+	if p.isIPv4() {
+		return p.b[9]
+	}
+	return p.b[6]
+}
+
+func (p ipPacket) srcIP() net.IP {
+	if p.isIPv4() {
+		return net.IP(p.b[12:16])
+	}
+	return net.IP(p.b[8:24])
+}
+
+func (p ipPacket) dstIP() net.IP {
+	if p.isIPv4() {
+		return net.IP(p.b[16:20])
+	}
+	return net.IP(p.b[24:40])
+}
+
+func (p ipPacket) setSrcIP(ip net.IP) { copy(p.srcIP(), p.ip(ip)) }
+func (p ipPacket) setDstIP(ip net.IP) { copy(p.dstIP(), p.ip(ip)) }
+
+// ip returns ip of the length of the packet version
+func (p ipPacket) ip(ip net.IP) net.IP {
+	if p.isIPv4() {
+		return ip.To4()
+	}
+	return ip.To16()
+}
+
+// transport returns the TCP or UDP header and payload
+func (p ipPacket) transport() []byte {
+	return p.b[p.hl:]
+}
+
+// setChecksums recomputes the checksums of the IPv4 header and the TCP or
+// UDP segment after the addresses or ports are rewritten
+func (p ipPacket) setChecksums() {
+	if p.isIPv4() {
+		p.b[10], p.b[11] = 0, 0
+		binary.BigEndian.PutUint16(p.b[10:12], ^fold(sum(0, p.b[:p.hl])))
+	}
+
+	segment := p.transport()
+	var offset int
+	switch p.protocol() {
+	case protocolTCP:
+		offset = 16
+	case protocolUDP:
+		offset = 6
+	default:
+		return
+	}
+
+	segment[offset], segment[offset+1] = 0, 0
+	checksum := ^fold(sum(pseudoHeaderSum(p.srcIP(), p.dstIP(), p.protocol(), len(segment)), segment))
+	// zero checksum means no checksum in UDP
+	if checksum == 0 && p.protocol() == protocolUDP {
+		checksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(segment[offset:offset+2], checksum)
+}
+
+// pseudoHeaderSum is the sum of the pseudo header of both versions, src and
+// dst are of the length of the packet version
+func pseudoHeaderSum(src, dst net.IP, protocol byte, length int) uint32 {
+	s := sum(0, src)
+	s = sum(s, dst)
+	return s + uint32(protocol) + uint32(length)
+}
+
+// sum adds b to s as big endian 16 bits words, the odd byte is padded by zero
+func sum(s uint32, b []byte) uint32 {
+	for len(b) >= 2 {
+		s += uint32(b[0])<<8 | uint32(b[1])
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		s += uint32(b[0]) << 8
+	}
+	return s
+}
+
+func fold(s uint32) uint16 {
+	for s > 0xffff {
+		s = s>>16 + s&0xffff
+	}
+	return uint16(s)
+}
+
+// ports returns the source and destination ports of a TCP or UDP segment
+func ports(segment []byte) (uint16, uint16) {
+	return binary.BigEndian.Uint16(segment[0:2]), binary.BigEndian.Uint16(segment[2:4])
+}
+
+func setPorts(segment []byte, src, dst uint16) {
+	binary.BigEndian.PutUint16(segment[0:2], src)
+	binary.BigEndian.PutUint16(segment[2:4], dst)
+}
+
+// buildUDP builds an UDP packet of payload from src to dst, the packet is
+// IPv4 if both addresses are IPv4
+func buildUDP(src, dst *net.UDPAddr, payload []byte) ([]byte, error) {
+	var p ipPacket
+	if src.IP.To4() != nil && dst.IP.To4() != nil {
+		p.hl = ipv4HeaderLen
+	} else if src.IP.To4() == nil && dst.IP.To4() == nil && src.IP.To16() != nil && dst.IP.To16() != nil {
+		p.hl = ipv6HeaderLen
+	} else {
+		return nil, errors.New("mismatched IP versions")
+	}
+
+	length := udpHeaderLen + len(payload)
+	if length > 0xffff || p.hl == ipv4HeaderLen && p.hl+length > 0xffff {
+		return nil, errors.New("packet too large")
+	}
+
+	p.b = make([]byte, p.hl+length)
+	if p.hl == ipv4HeaderLen {
+		p.b[0] = 0x45
+		binary.BigEndian.PutUint16(p.b[2:4], uint16(p.hl+length))
+		// don't fragment, the identification is unused
+		p.b[6] = 0x40
+		p.b[8] = 64
+		p.b[9] = protocolUDP
+	} else {
+		p.b[0] = 0x60
+		binary.BigEndian.PutUint16(p.b[4:6], uint16(length))
+		p.b[6] = protocolUDP
+		p.b[7] = 64
+	}
+	p.setSrcIP(src.IP)
+	p.setDstIP(dst.IP)
+
+	segment := p.transport()
+	setPorts(segment, uint16(src.Port), uint16(dst.Port))
+	binary.BigEndian.PutUint16(segment[4:6], uint16(length))
+	copy(segment[udpHeaderLen:], payload)
+
+	p.setChecksums()
+	return p.b, nil
+}
@@ -0,0 +1,119 @@
+package tun
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// verifyChecksums asserts the checksums of p are valid, a valid sum folds to
+// all ones
+func verifyChecksums(t *testing.T, p ipPacket) {
+	if p.isIPv4() {
+		assert.Equal(t, uint16(0xffff), fold(sum(0, p.b[:p.hl])))
+	}
+	segment := p.transport()
+	assert.Equal(t, uint16(0xffff), fold(sum(pseudoHeaderSum(p.srcIP(), p.dstIP(), p.protocol(), len(segment)), segment)))
+}
+
+func TestChecksum(t *testing.T) {
+	// the header checksum is zeroed
+	header, _ := hex.DecodeString("450000730000400040110000c0a80001c0a800c7")
+	assert.Equal(t, uint16(0xb861), ^fold(sum(0, header)))
+}
+
+func TestBuildUDP(t *testing.T) {
+	payload := []byte("hello")
+	for _, tt := range []struct {
+		name     string
+		src, dst string
+		hl       int
+	}{
+		{"ipv4", "1.1.1.1", "172.19.0.2", ipv4HeaderLen},
+		{"ipv6", "2001:db8::1", "fdfe:dcba:9876::2", ipv6HeaderLen},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &net.UDPAddr{IP: net.ParseIP(tt.src), Port: 53}
+			dst := &net.UDPAddr{IP: net.ParseIP(tt.dst), Port: 40000}
+
+			b, err := buildUDP(src, dst, payload)
+			assert.Nil(t, err)
+			assert.Len(t, b, tt.hl+udpHeaderLen+len(payload))
+
+			p, err := parseIP(b)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.hl, p.hl)
+			assert.Equal(t, byte(protocolUDP), p.protocol())
+			assert.True(t, p.srcIP().Equal(src.IP))
+			assert.True(t, p.dstIP().Equal(dst.IP))
+
+			segment := p.transport()
+			srcPort, dstPort := ports(segment)
+			assert.Equal(t, uint16(53), srcPort)
+			assert.Equal(t, uint16(40000), dstPort)
+			assert.Equal(t, payload, segment[udpHeaderLen:])
+			verifyChecksums(t, p)
+		})
+	}
+
+	_, err := buildUDP(&net.UDPAddr{IP: net.ParseIP("1.1.1.1")}, &net.UDPAddr{IP: net.ParseIP("::1")}, payload)
+	assert.NotNil(t, err)
+
+	_, err = buildUDP(&net.UDPAddr{IP: net.ParseIP("1.1.1.1")}, &net.UDPAddr{IP: net.ParseIP("1.1.1.2")}, make([]byte, 0xffff))
+	assert.NotNil(t, err)
+}
+
+func TestSetChecksums(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		src, dst string
+		natIP    string
+	}{
+		{"ipv4", "172.19.0.2", "1.1.1.1", "172.19.0.3"},
+		{"ipv6", "fdfe:dcba:9876::1", "2001:db8::1", "fdfe:dcba:9876::2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := buildUDP(
+				&net.UDPAddr{IP: net.ParseIP(tt.src), Port: 1234},
+				&net.UDPAddr{IP: net.ParseIP(tt.dst), Port: 443},
+				[]byte("odd"),
+			)
+			assert.Nil(t, err)
+
+			// rewrite as the NAT does
+			p, err := parseIP(b)
+			assert.Nil(t, err)
+			p.setSrcIP(net.ParseIP(tt.natIP))
+			setPorts(p.transport(), 5000, 7890)
+			p.setChecksums()
+
+			p, err = parseIP(b)
+			assert.Nil(t, err)
+			assert.True(t, p.srcIP().Equal(net.ParseIP(tt.natIP)))
+			verifyChecksums(t, p)
+		})
+	}
+}
+
+func TestParseIP(t *testing.T) {
+	b, err := buildUDP(&net.UDPAddr{IP: net.ParseIP("1.1.1.1")}, &net.UDPAddr{IP: net.ParseIP("1.1.1.2")}, []byte("payload"))
+	assert.Nil(t, err)
+
+	// the trailing bytes are trimmed
+	p, err := parseIP(append(b, 0, 0))
+	assert.Nil(t, err)
+	assert.Len(t, p.b, len(b))
+
+	_, err = parseIP(b[:len(b)-1])
+	assert.Equal(t, errInvalidPacket, err)
+
+	fragment := append([]byte{}, b...)
+	fragment[6] |= 0x20
+	_, err = parseIP(fragment)
+	assert.Equal(t, errInvalidPacket, err)
+
+	_, err = parseIP(nil)
+	assert.Equal(t, errInvalidPacket, err)
+}
@@ -0,0 +1,175 @@
+package tun
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	natPortStart = 1024
+	natPortCount = 0x10000 - natPortStart
+
+	// natPendingTimeout removes the mappings whose connection isn't accepted
+	natPendingTimeout = time.Minute
+	// natClosedTimeout keeps the mappings of the closed connections for the
+	// packets in flight and the TIME_WAIT of the listener
+	natClosedTimeout = 2 * time.Minute
+)
+
+// tuple is the addresses of a connection, the IPv4 addresses are stored in
+// the IPv6 form
+type tuple struct {
+	srcIP   [16]byte
+	dstIP   [16]byte
+	srcPort uint16
+	dstPort uint16
+}
+
+func newTuple(src, dst net.IP, srcPort, dstPort uint16) tuple {
+	t := tuple{srcPort: srcPort, dstPort: dstPort}
+	copy(t.srcIP[:], src.To16())
+	copy(t.dstIP[:], dst.To16())
+	return t
+}
+
+func (t tuple) srcAddr() *net.TCPAddr {
+	return &net.TCPAddr{IP: tupleIP(t.srcIP), Port: int(t.srcPort)}
+}
+
+func (t tuple) dstAddr() *net.TCPAddr {
+	return &net.TCPAddr{IP: tupleIP(t.dstIP), Port: int(t.dstPort)}
+}
+
+// tupleIP returns the IPv4 addresses in the 4 bytes form
+func tupleIP(b [16]byte) net.IP {
+	ip := net.IP(append([]byte{}, b[:]...))
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+type natEntry struct {
+	tuple
+	port       uint16
+	accepted   bool
+	closed     bool
+	lastActive time.Time
+}
+
+func (e *natEntry) expired(now time.Time) bool {
+	if e.closed {
+		return now.Sub(e.lastActive) > natClosedTimeout
+	}
+	return !e.accepted && now.Sub(e.lastActive) > natPendingTimeout
+}
+
+// tcpNat maps the TCP connections read from the device to the ports of the
+// NAT address, the connections are redirected to the local listener
+type tcpNat struct {
+	mux    sync.Mutex
+	next   int
+	tuples map[tuple]*natEntry
+	ports  map[uint16]*natEntry
+}
+
+func newTCPNat() *tcpNat {
+	return &tcpNat{
+		tuples: map[tuple]*natEntry{},
+		ports:  map[uint16]*natEntry{},
+	}
+}
+
+// portOf returns the port of t, a port is allocated for the new tuple or the
+// SYN of a closed one. It returns false if all the ports are in use.
+func (n *tcpNat) portOf(t tuple, syn bool) (uint16, bool) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	now := time.Now()
+	if e, ok := n.tuples[t]; ok {
+		if !e.closed {
+			e.lastActive = now
+			return e.port, true
+		}
+		if !syn {
+			return e.port, true
+		}
+		// the old port is kept for the packets in flight
+		delete(n.tuples, t)
+	}
+
+	for i := 0; i < natPortCount; i++ {
+		port := uint16(natPortStart + (n.next+i)%natPortCount)
+		if e, ok := n.ports[port]; ok {
+			if !e.expired(now) {
+				continue
+			}
+			n.remove(e)
+		}
+
+		n.next = (n.next + i + 1) % natPortCount
+		e := &natEntry{tuple: t, port: port, lastActive: now}
+		n.tuples[t] = e
+		n.ports[port] = e
+		return port, true
+	}
+	return 0, false
+}
+
+// lookup returns the tuple mapped to port
+func (n *tcpNat) lookup(port uint16) (tuple, bool) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	e, ok := n.ports[port]
+	if !ok {
+		return tuple{}, false
+	}
+	return e.tuple, true
+}
+
+// accept marks the mapping of port accepted, so it isn't removed until the
+// connection is closed
+func (n *tcpNat) accept(port uint16) (tuple, bool) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	e, ok := n.ports[port]
+	if !ok || e.accepted {
+		return tuple{}, false
+	}
+	e.accepted = true
+	return e.tuple, true
+}
+
+func (n *tcpNat) close(port uint16) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	if e, ok := n.ports[port]; ok {
+		e.closed = true
+		e.lastActive = time.Now()
+	}
+}
+
+// sweep removes the expired mappings
+func (n *tcpNat) sweep() {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	now := time.Now()
+	for _, e := range n.ports {
+		if e.expired(now) {
+			n.remove(e)
+		}
+	}
+}
+
+func (n *tcpNat) remove(e *natEntry) {
+	delete(n.ports, e.port)
+	if n.tuples[e.tuple] == e {
+		delete(n.tuples, e.tuple)
+	}
+}
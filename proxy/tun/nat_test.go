@@ -0,0 +1,119 @@
+package tun
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testTuple(srcPort uint16) tuple {
+	return newTuple(net.ParseIP("172.19.0.1"), net.ParseIP("1.1.1.1"), srcPort, 443)
+}
+
+func TestTCPNat_PortOf(t *testing.T) {
+	n := newTCPNat()
+
+	port, ok := n.portOf(testTuple(1000), true)
+	assert.True(t, ok)
+	same, ok := n.portOf(testTuple(1000), false)
+	assert.True(t, ok)
+	assert.Equal(t, port, same)
+
+	other, ok := n.portOf(testTuple(1001), true)
+	assert.True(t, ok)
+	assert.NotEqual(t, port, other)
+
+	tp, ok := n.lookup(port)
+	assert.True(t, ok)
+	assert.Equal(t, testTuple(1000), tp)
+	assert.Equal(t, "172.19.0.1:1000", tp.srcAddr().String())
+	assert.Equal(t, "1.1.1.1:443", tp.dstAddr().String())
+
+	_, ok = n.lookup(port + 100)
+	assert.False(t, ok)
+}
+
+func TestTCPNat_Tuple6(t *testing.T) {
+	tp := newTuple(net.ParseIP("fdfe:dcba:9876::1"), net.ParseIP("2001:db8::1"), 1000, 443)
+	assert.Equal(t, "[fdfe:dcba:9876::1]:1000", tp.srcAddr().String())
+	assert.Equal(t, "[2001:db8::1]:443", tp.dstAddr().String())
+	assert.NotEqual(t, testTuple(1000), tp)
+}
+
+func TestTCPNat_Accept(t *testing.T) {
+	n := newTCPNat()
+	port, _ := n.portOf(testTuple(1000), true)
+
+	tp, ok := n.accept(port)
+	assert.True(t, ok)
+	assert.Equal(t, testTuple(1000), tp)
+
+	// a port is accepted once
+	_, ok = n.accept(port)
+	assert.False(t, ok)
+
+	// the accepted mapping doesn't expire until closed
+	n.ports[port].lastActive = time.Now().Add(-2 * natPendingTimeout)
+	n.sweep()
+	_, ok = n.lookup(port)
+	assert.True(t, ok)
+}
+
+func TestTCPNat_Reuse(t *testing.T) {
+	n := newTCPNat()
+	port, _ := n.portOf(testTuple(1000), true)
+	n.accept(port)
+	n.close(port)
+
+	// the packets in flight of the closed connection keep the port
+	same, ok := n.portOf(testTuple(1000), false)
+	assert.True(t, ok)
+	assert.Equal(t, port, same)
+
+	// a new SYN of the tuple gets another port, the old one is kept
+	reused, ok := n.portOf(testTuple(1000), true)
+	assert.True(t, ok)
+	assert.NotEqual(t, port, reused)
+	_, ok = n.lookup(port)
+	assert.True(t, ok)
+}
+
+func TestTCPNat_Expire(t *testing.T) {
+	n := newTCPNat()
+	pending, _ := n.portOf(testTuple(1000), true)
+	closed, _ := n.portOf(testTuple(1001), true)
+	n.accept(closed)
+	n.close(closed)
+
+	n.ports[pending].lastActive = time.Now().Add(-natPendingTimeout - time.Second)
+	n.sweep()
+	_, ok := n.lookup(pending)
+	assert.False(t, ok)
+	_, ok = n.lookup(closed)
+	assert.True(t, ok)
+
+	n.ports[closed].lastActive = time.Now().Add(-natClosedTimeout - time.Second)
+	n.sweep()
+	_, ok = n.lookup(closed)
+	assert.False(t, ok)
+	assert.Empty(t, n.tuples)
+}
+
+func TestTCPNat_Exhausted(t *testing.T) {
+	n := newTCPNat()
+	for i := 0; i < natPortCount; i++ {
+		_, ok := n.portOf(testTuple(uint16(i)), true)
+		assert.True(t, ok)
+	}
+
+	_, ok := n.portOf(testTuple(0xffff), true)
+	assert.False(t, ok)
+
+	// an expired mapping is replaced
+	n.ports[natPortStart].lastActive = time.Now().Add(-natPendingTimeout - time.Second)
+	port, ok := n.portOf(testTuple(0xffff), true)
+	assert.True(t, ok)
+	assert.Equal(t, uint16(natPortStart), port)
+}
@@ -0,0 +1,451 @@
+// Package tun is the tun inbound, it reads the IP packets of a TUN device and
+// feeds the connections into the tunnel with the original destinations. The
+// TCP connections are terminated by the system stack by default: they are
+// redirected to a local listener by rewriting the addresses of the packets.
+// The gvisor stack terminates them in the userspace TCP/IP stack of gVisor
+// instead. The UDP packets are relayed directly with both stacks. IPv6 is
+// supported if the device has an IPv6 address.
+package tun
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Dreamacro/clash/adapters/inbound"
+	"github.com/Dreamacro/clash/common/pool"
+	"github.com/Dreamacro/clash/component/socks5"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+	"github.com/Dreamacro/clash/tunnel"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	DefaultDevice       = "clash0"
+	DefaultInet4Address = "172.19.0.1/30"
+	DefaultMTU          = 9000
+
+	StackSystem = "system"
+	StackGVisor = "gvisor"
+)
+
+// Config of the tun inbound, Inet4Address and Inet6Address are the addresses
+// of the device in CIDR notation, the next address of each subnet is used by
+// the NAT. Empty Inet6Address disables IPv6.
+type Config struct {
+	Device       string
+	Inet4Address string
+	Inet6Address string
+	MTU          int
+	// AutoRoute routes all the traffic of the enabled IP versions to the
+	// device
+	AutoRoute bool
+	// Stack is StackSystem or StackGVisor, empty is StackSystem
+	Stack string
+}
+
+// Listener is a started tun inbound
+type Listener struct {
+	config Config
+	device io.ReadWriteCloser
+	inet4  *stack
+	// inet6 is nil if IPv6 is disabled
+	inet6 *stack
+	nat   *tcpNat
+	// gvisor is nil with the system stack
+	gvisor *gvisorStack
+
+	closed *atomic.Bool
+	done   chan struct{}
+}
+
+// stack is the NAT addresses of an IP version, gateway is the address of the
+// device which the listener listens on, natIP is the source address of the
+// redirected connections
+type stack struct {
+	subnet   *net.IPNet
+	gateway  net.IP
+	natIP    net.IP
+	listener net.Listener
+	port     uint16
+}
+
+// parseAddress returns the stack of the address without the listener, the
+// address of ipv6 must be an IPv6 one
+func parseAddress(address string, ipv6 bool) (*stack, error) {
+	ip, ipnet, err := net.ParseCIDR(address)
+	if err != nil {
+		return nil, err
+	}
+
+	gateway := ip.To4()
+	if ipv6 {
+		if gateway != nil {
+			return nil, fmt.Errorf("%s isn't an IPv6 address", address)
+		}
+		gateway = ip
+	} else if gateway == nil {
+		return nil, fmt.Errorf("%s isn't an IPv4 address", address)
+	}
+
+	natIP := nextIP(gateway)
+
+	// the broadcast address of IPv4
+	last := make(net.IP, len(ipnet.IP))
+	for i := range last {
+		last[i] = ipnet.IP[i] | ^ipnet.Mask[i]
+	}
+	if gateway.Equal(ipnet.IP) || !ipnet.Contains(natIP) || !ipv6 && natIP.Equal(last) {
+		return nil, fmt.Errorf("%s should be followed by another host address in the subnet", address)
+	}
+
+	return &stack{
+		subnet:  &net.IPNet{IP: gateway, Mask: ipnet.Mask},
+		gateway: gateway,
+		natIP:   natIP,
+	}, nil
+}
+
+// nextIP returns ip + 1
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP{}, ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func (s *stack) listen() error {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: s.gateway})
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	s.port = uint16(l.Addr().(*net.TCPAddr).Port)
+	return nil
+}
+
+func (s *stack) close() {
+	if s != nil && s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+// New creates the device of config and starts relaying the packets
+func New(config Config) (*Listener, error) {
+	inet4, err := parseAddress(config.Inet4Address, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var inet6 *stack
+	var inet6Subnet *net.IPNet
+	if config.Inet6Address != "" {
+		if inet6, err = parseAddress(config.Inet6Address, true); err != nil {
+			return nil, err
+		}
+		inet6Subnet = inet6.subnet
+	}
+
+	device, name, err := openDevice(config.Device, config.MTU, inet4.subnet, inet6Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("open tun device %s error: %w", config.Device, err)
+	}
+
+	var gvisor *gvisorStack
+	switch config.Stack {
+	case "", StackSystem:
+		for _, s := range []*stack{inet4, inet6} {
+			if s == nil {
+				continue
+			}
+			if err := s.listen(); err != nil {
+				inet4.close()
+				inet6.close()
+				device.Close()
+				return nil, err
+			}
+		}
+	case StackGVisor:
+		if gvisor, err = newGVisorStack(device, config.MTU, handleGVisorConn); err != nil {
+			device.Close()
+			return nil, fmt.Errorf("tun gvisor stack error: %w", err)
+		}
+	default:
+		device.Close()
+		return nil, fmt.Errorf("unsupported tun stack: %s", config.Stack)
+	}
+
+	if config.AutoRoute {
+		if err := addDefaultRoutes(name, inet6 != nil); err != nil {
+			inet4.close()
+			inet6.close()
+			gvisor.close()
+			device.Close()
+			return nil, fmt.Errorf("tun auto-route error: %w", err)
+		}
+	}
+
+	tl := &Listener{
+		config: config,
+		device: device,
+		inet4:  inet4,
+		inet6:  inet6,
+		nat:    newTCPNat(),
+		gvisor: gvisor,
+		closed: atomic.NewBool(false),
+		done:   make(chan struct{}),
+	}
+
+	if gvisor == nil {
+		go tl.acceptLoop(inet4.listener)
+		if inet6 != nil {
+			go tl.acceptLoop(inet6.listener)
+		}
+	}
+	go tl.readLoop()
+	go tl.sweepLoop()
+
+	if inet6 != nil {
+		log.Infoln("Tun device %s is up at %s and %s", name, config.Inet4Address, config.Inet6Address)
+	} else {
+		log.Infoln("Tun device %s is up at %s", name, config.Inet4Address)
+	}
+	return tl, nil
+}
+
+// Config returns the config of the listener
+func (l *Listener) Config() Config {
+	return l.config
+}
+
+// Close removes the device with its routes and closes the listener, the
+// connections accepted are relayed until the packets stop
+func (l *Listener) Close() {
+	if l.closed.Swap(true) {
+		return
+	}
+	close(l.done)
+	l.inet4.close()
+	l.inet6.close()
+	l.gvisor.close()
+	l.device.Close()
+}
+
+func (l *Listener) acceptLoop(listener net.Listener) {
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			if l.closed.Load() {
+				return
+			}
+			continue
+		}
+
+		port := uint16(c.RemoteAddr().(*net.TCPAddr).Port)
+		t, ok := l.nat.accept(port)
+		if !ok {
+			c.Close()
+			continue
+		}
+
+		conn := &tunConn{Conn: c, remote: t.srcAddr(), nat: l.nat, port: port}
+		target := socks5.ParseAddrToSocksAddr(t.dstAddr())
+		tunnel.Add(inbound.NewSocket(target, conn, C.TUN))
+	}
+}
+
+// handleGVisorConn feeds a connection of the gvisor stack, its local address
+// is the original destination
+func handleGVisorConn(c net.Conn) {
+	target := socks5.ParseAddrToSocksAddr(c.LocalAddr())
+	tunnel.Add(inbound.NewSocket(target, c, C.TUN))
+}
+
+func (l *Listener) readLoop() {
+	buf := make([]byte, 0xffff)
+	for {
+		n, err := l.device.Read(buf)
+		if err != nil {
+			if !l.closed.Load() {
+				log.Errorln("[TUN] read device error: %s", err.Error())
+				l.Close()
+			}
+			return
+		}
+
+		p, err := parseIP(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		s := l.inet4
+		if !p.isIPv4() {
+			if s = l.inet6; s == nil {
+				continue
+			}
+		}
+
+		switch p.protocol() {
+		case protocolTCP:
+			if l.gvisor != nil {
+				l.gvisor.inject(p)
+			} else {
+				l.handleTCP(s, p)
+			}
+		case protocolUDP:
+			l.handleUDP(p)
+		}
+	}
+}
+
+func (l *Listener) sweepLoop() {
+	ticker := time.NewTicker(natPendingTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.nat.sweep()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// handleTCP redirects the packets of a connection to the listener, and
+// restores the addresses of the packets from the listener
+func (l *Listener) handleTCP(s *stack, p ipPacket) {
+	segment := p.transport()
+	if len(segment) < tcpHeaderLen {
+		return
+	}
+	srcPort, dstPort := ports(segment)
+
+	if p.srcIP().Equal(s.gateway) && srcPort == s.port {
+		if !p.dstIP().Equal(s.natIP) {
+			return
+		}
+		t, ok := l.nat.lookup(dstPort)
+		if !ok {
+			return
+		}
+
+		p.setSrcIP(net.IP(t.dstIP[:]))
+		p.setDstIP(net.IP(t.srcIP[:]))
+		setPorts(segment, t.dstPort, t.srcPort)
+	} else {
+		t := newTuple(p.srcIP(), p.dstIP(), srcPort, dstPort)
+
+		// SYN without ACK
+		syn := segment[13]&0x12 == 0x02
+		port, ok := l.nat.portOf(t, syn)
+		if !ok {
+			log.Warnln("[TUN] no NAT port available for %s --> %s", t.srcAddr(), t.dstAddr())
+			return
+		}
+
+		p.setSrcIP(s.natIP)
+		p.setDstIP(s.gateway)
+		setPorts(segment, port, s.port)
+	}
+
+	p.setChecksums()
+	l.device.Write(p.b)
+}
+
+func (l *Listener) handleUDP(p ipPacket) {
+	segment := p.transport()
+	if len(segment) < udpHeaderLen {
+		return
+	}
+	length := int(binary.BigEndian.Uint16(segment[4:6]))
+	if length < udpHeaderLen || length > len(segment) {
+		return
+	}
+	srcPort, dstPort := ports(segment)
+
+	payload := segment[udpHeaderLen:length]
+	buf := pool.Get(pool.RelayBufferSize)
+	if len(payload) > len(buf) {
+		pool.Put(buf)
+		return
+	}
+	n := copy(buf, payload)
+
+	pkt := &packet{
+		device: l.device,
+		lAddr:  &net.UDPAddr{IP: append(net.IP{}, p.srcIP()...), Port: int(srcPort)},
+		buf:    buf,
+		n:      n,
+	}
+	rAddr := &net.UDPAddr{IP: append(net.IP{}, p.dstIP()...), Port: int(dstPort)}
+	tunnel.AddPacket(inbound.NewPacket(socks5.ParseAddrToSocksAddr(rAddr), pkt, C.TUN))
+}
+
+// tunConn is a redirected connection, RemoteAddr is the original source
+type tunConn struct {
+	net.Conn
+	remote net.Addr
+	nat    *tcpNat
+	port   uint16
+}
+
+func (c *tunConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *tunConn) Close() error {
+	c.nat.close(c.port)
+	return c.Conn.Close()
+}
+
+type packet struct {
+	device io.Writer
+	lAddr  *net.UDPAddr
+	buf    []byte
+	n      int
+}
+
+func (c *packet) Data() []byte {
+	return c.buf[:c.n]
+}
+
+// WriteBack writes an UDP packet from addr to the source of the packet
+func (c *packet) WriteBack(b []byte, addr net.Addr) (n int, err error) {
+	from, ok := addr.(*net.UDPAddr)
+	if !ok {
+		host, port, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return 0, err
+		}
+		p, _ := strconv.Atoi(port)
+		from = &net.UDPAddr{IP: net.ParseIP(host), Port: p}
+	}
+
+	pkt, err := buildUDP(from, c.lAddr, b)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.device.Write(pkt); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// LocalAddr returns the source IP/Port of UDP Packet
+func (c *packet) LocalAddr() net.Addr {
+	return c.lAddr
+}
+
+func (c *packet) Drop() {
+	pool.Put(c.buf)
+}
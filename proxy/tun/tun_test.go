@@ -0,0 +1,23 @@
+package tun
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapters/inbound"
+	"github.com/Dreamacro/clash/component/socks5"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTunConn_SourceIP(t *testing.T) {
+	// the accepted connection comes from the NAT address, the metadata
+	// carries the original source
+	tp := testTuple(1000)
+	conn := &tunConn{Conn: &net.TCPConn{}, remote: tp.srcAddr()}
+	metadata := inbound.NewSocket(socks5.ParseAddrToSocksAddr(tp.dstAddr()), conn, C.TUN).Metadata()
+	assert.Equal(t, net.IP{172, 19, 0, 1}, metadata.SrcIP)
+	assert.Equal(t, "1000", metadata.SrcPort)
+	assert.Equal(t, "1.1.1.1", metadata.DstIP.String())
+}
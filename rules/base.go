@@ -12,6 +12,7 @@ var (
 	noResolve = "no-resolve"
 )
 
+// HasNoResolve reports whether the no-resolve param is set
 func HasNoResolve(params []string) bool {
 	for _, p := range params {
 		if p == noResolve {
@@ -1,6 +1,8 @@
 package rules
 
 import (
+	"net"
+
 	"github.com/Dreamacro/clash/component/mmdb"
 	C "github.com/Dreamacro/clash/constant"
 )
@@ -9,19 +11,31 @@ type GEOIP struct {
 	country     string
 	adapter     string
 	noResolveIP bool
+	isSourceIP  bool
 }
 
 func (g *GEOIP) RuleType() C.RuleType {
+	if g.isSourceIP {
+		return C.SrcGEOIP
+	}
 	return C.GEOIP
 }
 
 func (g *GEOIP) Match(metadata *C.Metadata) bool {
+	if g.isSourceIP {
+		return g.matchSource(metadata.SrcIP)
+	}
+
 	ip := metadata.DstIP
 	if ip == nil {
 		return false
 	}
-	record, _ := mmdb.Instance().Country(ip)
-	return record.Country.IsoCode == g.country
+
+	db, err := mmdb.DestinationInstance()
+	if err != nil {
+		return false
+	}
+	return db.Match(ip, g.country)
 }
 
 func (g *GEOIP) Adapter() string {
@@ -33,7 +47,7 @@ func (g *GEOIP) Payload() string {
 }
 
 func (g *GEOIP) ShouldResolveIP() bool {
-	return !g.noResolveIP
+	return !g.noResolveIP && !g.isSourceIP
 }
 
 func NewGEOIP(country string, adapter string, noResolveIP bool) *GEOIP {
@@ -45,3 +59,25 @@ func NewGEOIP(country string, adapter string, noResolveIP bool) *GEOIP {
 
 	return geoip
 }
+
+func (g *GEOIP) matchSource(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	db, err := mmdb.SourceInstance()
+	if err != nil {
+		return false
+	}
+	return db.Match(ip, g.country)
+}
+
+// NewSrcGEOIP returns a GEOIP rule matching the source IP by the source
+// database
+func NewSrcGEOIP(country string, adapter string) *GEOIP {
+	return &GEOIP{
+		country:    country,
+		adapter:    adapter,
+		isSourceIP: true,
+	}
+}
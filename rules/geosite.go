@@ -0,0 +1,65 @@
+package rules
+
+import (
+	"github.com/Dreamacro/clash/component/geosite"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+type GEOSITE struct {
+	code    string
+	adapter string
+}
+
+func (g *GEOSITE) RuleType() C.RuleType {
+	return C.GEOSITE
+}
+
+func (g *GEOSITE) Match(metadata *C.Metadata) bool {
+	if metadata.AddrType != C.AtypDomainName {
+		return false
+	}
+
+	return geosite.Match(g.code, metadata.Host)
+}
+
+func (g *GEOSITE) Adapter() string {
+	return g.adapter
+}
+
+func (g *GEOSITE) Payload() string {
+	return g.code
+}
+
+func (g *GEOSITE) ShouldResolveIP() bool {
+	return false
+}
+
+// NewGEOSITE doesn't verify the category, it should be verified against the
+// database with GeoSiteCodes
+func NewGEOSITE(code string, adapter string) (*GEOSITE, error) {
+	return &GEOSITE{
+		code:    code,
+		adapter: adapter,
+	}, nil
+}
+
+// GeoSiteCodes returns the geosite categories used by rule and its sub-rules
+func GeoSiteCodes(rule C.Rule) []string {
+	switch r := rule.(type) {
+	case *routingMarkRule:
+		return GeoSiteCodes(r.Rule)
+	case *routingMarkPolicyRule:
+		return GeoSiteCodes(r.PolicyRule)
+	case *Logic:
+		codes := []string{}
+		for _, sub := range r.rules {
+			codes = append(codes, GeoSiteCodes(sub)...)
+		}
+		return codes
+	case *GEOSITE:
+		return []string{r.code}
+	case *Script:
+		return r.GeoSiteCodes()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package rules
+
+import (
+	"strings"
+
+	C "github.com/Dreamacro/clash/constant"
+)
+
+// inboundTypes is the inbound types of the IN-TYPE payload
+var inboundTypes = map[string][]C.Type{
+	"http":   {C.HTTP, C.HTTPCONNECT},
+	"socks":  {C.SOCKS, C.SOCKS4},
+	"socks5": {C.SOCKS},
+	"socks4": {C.SOCKS4},
+	"redir":  {C.REDIR},
+	"tproxy": {C.TPROXY},
+	"tun":    {C.TUN},
+}
+
+type InType struct {
+	types   []C.Type
+	adapter string
+	payload string
+}
+
+func (i *InType) RuleType() C.RuleType {
+	return C.InType
+}
+
+func (i *InType) Match(metadata *C.Metadata) bool {
+	for _, tp := range i.types {
+		if metadata.Type == tp {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *InType) Adapter() string {
+	return i.adapter
+}
+
+func (i *InType) Payload() string {
+	return i.payload
+}
+
+func (i *InType) ShouldResolveIP() bool {
+	return false
+}
+
+// NewInType returns an IN-TYPE rule, payload is inbound types separated by `/`, e.g. `socks/http`
+func NewInType(payload string, adapter string) (*InType, error) {
+	types := []C.Type{}
+	for _, name := range strings.Split(payload, "/") {
+		tps, ok := inboundTypes[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, errPayload
+		}
+		types = append(types, tps...)
+	}
+
+	return &InType{
+		types:   types,
+		adapter: adapter,
+		payload: payload,
+	}, nil
+}
+
+type InUser struct {
+	users   []string
+	adapter string
+	payload string
+}
+
+func (i *InUser) RuleType() C.RuleType {
+	return C.InUser
+}
+
+func (i *InUser) Match(metadata *C.Metadata) bool {
+	if metadata.InUser == "" {
+		return false
+	}
+
+	for _, user := range i.users {
+		if metadata.InUser == user {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *InUser) Adapter() string {
+	return i.adapter
+}
+
+func (i *InUser) Payload() string {
+	return i.payload
+}
+
+func (i *InUser) ShouldResolveIP() bool {
+	return false
+}
+
+// NewInUser returns an IN-USER rule, payload is usernames separated by `/`
+func NewInUser(payload string, adapter string) (*InUser, error) {
+	users := []string{}
+	for _, user := range strings.Split(payload, "/") {
+		if user = strings.TrimSpace(user); user == "" {
+			return nil, errPayload
+		}
+		users = append(users, user)
+	}
+
+	return &InUser{
+		users:   users,
+		adapter: adapter,
+		payload: payload,
+	}, nil
+}
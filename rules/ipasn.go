@@ -0,0 +1,66 @@
+package rules
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Dreamacro/clash/component/mmdb"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+type ASN struct {
+	asn         uint
+	payload     string
+	adapter     string
+	noResolveIP bool
+}
+
+func (a *ASN) RuleType() C.RuleType {
+	return C.IPASN
+}
+
+func (a *ASN) Match(metadata *C.Metadata) bool {
+	ip := metadata.DstIP
+	if ip == nil {
+		return false
+	}
+
+	db, err := mmdb.ASNInstance()
+	if err != nil {
+		return false
+	}
+
+	record, err := db.ASN(ip)
+	if err != nil {
+		return false
+	}
+	return record.AutonomousSystemNumber == a.asn
+}
+
+func (a *ASN) Adapter() string {
+	return a.adapter
+}
+
+func (a *ASN) Payload() string {
+	return a.payload
+}
+
+func (a *ASN) ShouldResolveIP() bool {
+	return !a.noResolveIP
+}
+
+// NewASN accepts the payload like `13335` or `AS13335`
+func NewASN(payload string, adapter string, noResolveIP bool) (*ASN, error) {
+	number := strings.TrimPrefix(strings.ToUpper(payload), "AS")
+	asn, err := strconv.ParseUint(number, 10, 32)
+	if err != nil {
+		return nil, errPayload
+	}
+
+	return &ASN{
+		asn:         uint(asn),
+		payload:     payload,
+		adapter:     adapter,
+		noResolveIP: noResolveIP,
+	}, nil
+}
@@ -2,6 +2,7 @@ package rules
 
 import (
 	"net"
+	"strings"
 
 	C "github.com/Dreamacro/clash/constant"
 )
@@ -21,7 +22,8 @@ func WithIPCIDRNoResolve(noResolve bool) IPCIDROption {
 }
 
 type IPCIDR struct {
-	ipnet       *net.IPNet
+	payload     string
+	ipnets      []*net.IPNet
 	adapter     string
 	isSourceIP  bool
 	noResolveIP bool
@@ -39,7 +41,15 @@ func (i *IPCIDR) Match(metadata *C.Metadata) bool {
 	if i.isSourceIP {
 		ip = metadata.SrcIP
 	}
-	return ip != nil && i.ipnet.Contains(ip)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range i.ipnets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
 
 func (i *IPCIDR) Adapter() string {
@@ -47,21 +57,39 @@ func (i *IPCIDR) Adapter() string {
 }
 
 func (i *IPCIDR) Payload() string {
-	return i.ipnet.String()
+	return i.payload
 }
 
 func (i *IPCIDR) ShouldResolveIP() bool {
 	return !i.noResolveIP
 }
 
+// IsIPCIDRPayload reports whether s is a CIDR like `192.168.1.0/24`
+func IsIPCIDRPayload(s string) bool {
+	_, _, err := net.ParseCIDR(strings.TrimSpace(s))
+	return err == nil
+}
+
+// NewIPCIDR returns a CIDR rule, s is a list of CIDRs separated by `,`, e.g.
+// `192.168.1.0/24,10.0.0.0/8`
 func NewIPCIDR(s string, adapter string, opts ...IPCIDROption) (*IPCIDR, error) {
-	_, ipnet, err := net.ParseCIDR(s)
-	if err != nil {
-		return nil, errPayload
+	ipnets := []*net.IPNet{}
+	for _, cidr := range strings.Split(s, ",") {
+		_, ipnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, errPayload
+		}
+		ipnets = append(ipnets, ipnet)
+	}
+
+	payload := ipnets[0].String()
+	if len(ipnets) > 1 {
+		payload = s
 	}
 
 	ipcidr := &IPCIDR{
-		ipnet:   ipnet,
+		payload: payload,
+		ipnets:  ipnets,
 		adapter: adapter,
 	}
 
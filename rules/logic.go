@@ -0,0 +1,172 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	C "github.com/Dreamacro/clash/constant"
+)
+
+var errLogicPayload = errors.New("logic payload error")
+
+// HasRuleType reports whether rule or one of its sub-rules is of tp
+func HasRuleType(rule C.Rule, tp C.RuleType) bool {
+	switch r := rule.(type) {
+	case *routingMarkRule:
+		return HasRuleType(r.Rule, tp)
+	case *routingMarkPolicyRule:
+		return HasRuleType(r.PolicyRule, tp)
+	case *Logic:
+		for _, sub := range r.rules {
+			if HasRuleType(sub, tp) {
+				return true
+			}
+		}
+	}
+	return rule.RuleType() == tp
+}
+
+// Logic combines sub-rules, e.g. AND,((DOMAIN-SUFFIX,google.com),(DST-PORT,443)),Proxy
+type Logic struct {
+	tp          C.RuleType
+	adapter     string
+	payload     string
+	rules       []C.Rule
+	noResolveIP bool
+}
+
+func (l *Logic) RuleType() C.RuleType {
+	return l.tp
+}
+
+func (l *Logic) Match(metadata *C.Metadata) bool {
+	switch l.tp {
+	case C.AND:
+		for _, rule := range l.rules {
+			if !rule.Match(metadata) {
+				return false
+			}
+		}
+		return true
+	case C.OR:
+		for _, rule := range l.rules {
+			if rule.Match(metadata) {
+				return true
+			}
+		}
+		return false
+	default:
+		return !l.rules[0].Match(metadata)
+	}
+}
+
+func (l *Logic) Adapter() string {
+	return l.adapter
+}
+
+func (l *Logic) Payload() string {
+	return l.payload
+}
+
+func (l *Logic) ShouldResolveIP() bool {
+	if l.noResolveIP {
+		return false
+	}
+	for _, rule := range l.rules {
+		if rule.ShouldResolveIP() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLogic reports whether tp is a logic rule type, whose payload contains commas
+func IsLogic(tp string) bool {
+	switch tp {
+	case "AND", "OR", "NOT":
+		return true
+	default:
+		return false
+	}
+}
+
+// SplitLogic splits s on the commas which aren't enclosed in parentheses
+func SplitLogic(s string) ([]string, error) {
+	fields := []string{}
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errLogicPayload
+			}
+		case ',':
+			if depth == 0 {
+				fields = append(fields, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	if depth != 0 {
+		return nil, errLogicPayload
+	}
+	return append(fields, strings.TrimSpace(s[start:])), nil
+}
+
+func parseSubRule(s string) (C.Rule, error) {
+	if len(s) < 2 || s[0] != '(' || s[len(s)-1] != ')' {
+		return nil, errLogicPayload
+	}
+
+	fields, err := SplitLogic(s[1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	tp := fields[0]
+	if tp == "MATCH" || len(fields) < 2 {
+		return nil, fmt.Errorf("%w: %s", errLogicPayload, s)
+	}
+
+	return ParseRule(tp, fields[1], "", fields[2:])
+}
+
+// NewLogic parses the sub-rules of payload, no-resolve of the logic rule
+// covers the sub-rules, e.g. AND,((GEOIP,CN),(DST-PORT,443)),DIRECT,no-resolve
+func NewLogic(tp C.RuleType, payload string, adapter string, noResolveIP bool) (*Logic, error) {
+	payload = strings.TrimSpace(payload)
+	if len(payload) < 2 || payload[0] != '(' || payload[len(payload)-1] != ')' {
+		return nil, errLogicPayload
+	}
+
+	subs, err := SplitLogic(payload[1 : len(payload)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []C.Rule{}
+	for _, sub := range subs {
+		rule, err := parseSubRule(sub)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if (tp == C.NOT && len(rules) != 1) || len(rules) == 0 {
+		return nil, fmt.Errorf("%w: unexpected sub-rule count %d", errLogicPayload, len(rules))
+	}
+
+	return &Logic{
+		tp:          tp,
+		adapter:     adapter,
+		payload:     payload,
+		rules:       rules,
+		noResolveIP: noResolveIP,
+	}, nil
+}
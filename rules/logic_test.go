@@ -0,0 +1,95 @@
+package rules
+
+import (
+	"net"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogic_Match(t *testing.T) {
+	google443 := &C.Metadata{AddrType: C.AtypDomainName, Host: "www.google.com", DstPort: "443", SrcPort: "1234"}
+	google80 := &C.Metadata{AddrType: C.AtypDomainName, Host: "www.google.com", DstPort: "80", SrcPort: "80"}
+	other443 := &C.Metadata{AddrType: C.AtypDomainName, Host: "example.com", DstPort: "443", SrcPort: "1234"}
+
+	tests := []struct {
+		tp       string
+		payload  string
+		metadata *C.Metadata
+		match    bool
+	}{
+		{"AND", "((DOMAIN-SUFFIX,google.com),(DST-PORT,443))", google443, true},
+		{"AND", "((DOMAIN-SUFFIX,google.com),(DST-PORT,443))", google80, false},
+		{"AND", "((DOMAIN-SUFFIX,google.com),(DST-PORT,443))", other443, false},
+		{"OR", "((DOMAIN-SUFFIX,google.com),(DST-PORT,443))", other443, true},
+		{"OR", "((DOMAIN,example.com),(DST-PORT,22))", google80, false},
+		{"NOT", "((DOMAIN-SUFFIX,google.com))", other443, true},
+		{"NOT", "((DOMAIN-SUFFIX,google.com))", google443, false},
+		{"AND", "((DOMAIN-SUFFIX,google.com),(OR,((DST-PORT,443),(NOT,((SRC-PORT,80))))))", google443, true},
+		{"AND", "((DOMAIN-SUFFIX,google.com),(OR,((DST-PORT,443),(NOT,((SRC-PORT,80))))))", google80, false},
+		{"AND", "((DOMAIN-SUFFIX,google.com),(OR,((DST-PORT,443),(NOT,((SRC-PORT,80))))))", other443, false},
+		{"OR", " ( (DOMAIN,example.com) , (DST-PORT,22) ) ", other443, true},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseRule(tt.tp, tt.payload, "DIRECT", nil)
+		require.NoError(t, err, tt.payload)
+		assert.Equal(t, tt.match, rule.Match(tt.metadata), "%s,%s %s", tt.tp, tt.payload, tt.metadata.Host)
+		assert.Equal(t, "DIRECT", rule.Adapter())
+	}
+}
+
+func TestLogic_Malformed(t *testing.T) {
+	tests := []struct {
+		tp      string
+		payload string
+	}{
+		{"AND", ""},
+		{"AND", "()"},
+		{"AND", "(())"},
+		{"AND", "DOMAIN,google.com"},
+		{"AND", "(DOMAIN,google.com)"},
+		{"AND", "((DOMAIN,google.com)"},
+		{"AND", "((DOMAIN,google.com)))"},
+		{"AND", "((DOMAIN,google.com),DST-PORT,443)"},
+		{"AND", "((DOMAIN))"},
+		{"AND", "((MATCH,DIRECT))"},
+		{"OR", "((UNKNOWN,google.com))"},
+		{"OR", "((DST-PORT,http))"},
+		{"OR", "((AND,((DOMAIN,google.com)),(DST-PORT,443))"},
+		{"NOT", "((DOMAIN,google.com),(DST-PORT,443))"},
+		{"NOT", "((DOMAIN,google.com),(DST-PORT,443),(SRC-PORT,80))"},
+		{"AND", "((DOMAIN-SUFFIX,google.com),(NOT,((DST-PORT,443),(SRC-PORT,80))))"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseRule(tt.tp, tt.payload, "DIRECT", nil)
+		assert.Error(t, err, "%s,%s", tt.tp, tt.payload)
+	}
+}
+
+func TestLogic_ShouldResolveIP(t *testing.T) {
+	tests := []struct {
+		payload string
+		resolve bool
+	}{
+		{"((DOMAIN,google.com),(DST-PORT,443))", false},
+		{"((DOMAIN,google.com),(IP-CIDR,10.0.0.0/8))", true},
+		{"((DOMAIN,google.com),(IP-CIDR,10.0.0.0/8,no-resolve))", false},
+		{"((DOMAIN,google.com),(NOT,((IP-CIDR,10.0.0.0/8))))", true},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseRule("OR", tt.payload, "DIRECT", nil)
+		require.NoError(t, err, tt.payload)
+		assert.Equal(t, tt.resolve, rule.ShouldResolveIP(), tt.payload)
+	}
+
+	rule, err := ParseRule("AND", "((DST-PORT,443),(IP-CIDR,10.0.0.0/8))", "DIRECT", nil)
+	require.NoError(t, err)
+	assert.True(t, rule.Match(&C.Metadata{DstIP: net.ParseIP("10.1.2.3"), DstPort: "443"}))
+	assert.False(t, rule.Match(&C.Metadata{DstIP: net.ParseIP("192.168.1.1"), DstPort: "443"}))
+}
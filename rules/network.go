@@ -0,0 +1,52 @@
+package rules
+
+import (
+	"strings"
+
+	C "github.com/Dreamacro/clash/constant"
+)
+
+type Network struct {
+	network C.NetWork
+	adapter string
+	payload string
+}
+
+func (n *Network) RuleType() C.RuleType {
+	return C.Network
+}
+
+func (n *Network) Match(metadata *C.Metadata) bool {
+	return metadata.NetWork == n.network
+}
+
+func (n *Network) Adapter() string {
+	return n.adapter
+}
+
+func (n *Network) Payload() string {
+	return n.payload
+}
+
+func (n *Network) ShouldResolveIP() bool {
+	return false
+}
+
+// NewNetwork returns a NETWORK rule, payload is `tcp` or `udp`
+func NewNetwork(payload string, adapter string) (*Network, error) {
+	var network C.NetWork
+	switch strings.ToLower(strings.TrimSpace(payload)) {
+	case "tcp":
+		network = C.TCP
+	case "udp":
+		network = C.UDP
+	default:
+		return nil, errPayload
+	}
+
+	return &Network{
+		network: network,
+		adapter: adapter,
+		payload: payload,
+	}, nil
+}
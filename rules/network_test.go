@@ -0,0 +1,36 @@
+package rules
+
+import (
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetwork(t *testing.T) {
+	tests := []struct {
+		payload string
+		tcp     bool
+		udp     bool
+	}{
+		{payload: "tcp", tcp: true},
+		{payload: "UDP", udp: true},
+		{payload: " udp ", udp: true},
+	}
+
+	for _, tt := range tests {
+		rule, err := NewNetwork(tt.payload, "DIRECT")
+		require.NoError(t, err, tt.payload)
+		assert.Equal(t, tt.tcp, rule.Match(&C.Metadata{NetWork: C.TCP}), tt.payload)
+		assert.Equal(t, tt.udp, rule.Match(&C.Metadata{NetWork: C.UDP}), tt.payload)
+		assert.Equal(t, tt.payload, rule.Payload())
+		assert.False(t, rule.ShouldResolveIP())
+	}
+
+	for _, payload := range []string{"", "icmp", "tcp,udp"} {
+		_, err := NewNetwork(payload, "DIRECT")
+		assert.Error(t, err, payload)
+	}
+}
@@ -19,9 +19,16 @@ func ParseRule(tp, payload, target string, params []string) (C.Rule, error) {
 		parsed = NewDomainSuffix(payload, target)
 	case "DOMAIN-KEYWORD":
 		parsed = NewDomainKeyword(payload, target)
+	case "GEOSITE":
+		parsed, parseErr = NewGEOSITE(payload, target)
 	case "GEOIP":
 		noResolve := HasNoResolve(params)
 		parsed = NewGEOIP(payload, target, noResolve)
+	case "SRC-GEOIP":
+		parsed = NewSrcGEOIP(payload, target)
+	case "IP-ASN":
+		noResolve := HasNoResolve(params)
+		parsed, parseErr = NewASN(payload, target, noResolve)
 	case "IP-CIDR", "IP-CIDR6":
 		noResolve := HasNoResolve(params)
 		parsed, parseErr = NewIPCIDR(payload, target, WithIPCIDRNoResolve(noResolve))
@@ -32,12 +39,34 @@ func ParseRule(tp, payload, target string, params []string) (C.Rule, error) {
 	case "DST-PORT":
 		parsed, parseErr = NewPort(payload, target, false)
 	case "PROCESS-NAME":
-		parsed, parseErr = NewProcess(payload, target)
+		parsed, parseErr = NewProcess(payload, target, true)
+	case "PROCESS-PATH":
+		parsed, parseErr = NewProcess(payload, target, false)
+	case "IN-TYPE":
+		parsed, parseErr = NewInType(payload, target)
+	case "IN-USER":
+		parsed, parseErr = NewInUser(payload, target)
+	case "NETWORK":
+		parsed, parseErr = NewNetwork(payload, target)
+	case "AND":
+		parsed, parseErr = NewLogic(C.AND, payload, target, HasNoResolve(params))
+	case "OR":
+		parsed, parseErr = NewLogic(C.OR, payload, target, HasNoResolve(params))
+	case "NOT":
+		parsed, parseErr = NewLogic(C.NOT, payload, target, HasNoResolve(params))
 	case "MATCH":
 		parsed = NewMatch(target)
 	default:
 		parseErr = fmt.Errorf("unsupported rule type %s", tp)
 	}
 
-	return parsed, parseErr
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	mark, err := ParseRoutingMark(params)
+	if err != nil {
+		return nil, err
+	}
+	return WithRoutingMark(parsed, mark), nil
 }
@@ -1,14 +1,22 @@
 package rules
 
 import (
+	"sort"
 	"strconv"
+	"strings"
 
 	C "github.com/Dreamacro/clash/constant"
 )
 
+type portRange struct {
+	start uint16
+	end   uint16
+}
+
 type Port struct {
 	adapter  string
 	port     string
+	ranges   []portRange
 	isSource bool
 }
 
@@ -20,10 +28,24 @@ func (p *Port) RuleType() C.RuleType {
 }
 
 func (p *Port) Match(metadata *C.Metadata) bool {
+	port := metadata.DstPort
 	if p.isSource {
-		return metadata.SrcPort == p.port
+		port = metadata.SrcPort
 	}
-	return metadata.DstPort == p.port
+	return p.matchPort(port)
+}
+
+func (p *Port) matchPort(port string) bool {
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return false
+	}
+
+	// ranges are sorted and don't overlap
+	idx := sort.Search(len(p.ranges), func(i int) bool {
+		return p.ranges[i].end >= uint16(n)
+	})
+	return idx < len(p.ranges) && p.ranges[idx].start <= uint16(n)
 }
 
 func (p *Port) Adapter() string {
@@ -38,14 +60,63 @@ func (p *Port) ShouldResolveIP() bool {
 	return false
 }
 
-func NewPort(port string, adapter string, isSource bool) (*Port, error) {
-	_, err := strconv.Atoi(port)
+// IsPortPayload reports whether s is a port or a port range like `1000-2000`
+func IsPortPayload(s string) bool {
+	_, err := parsePortRange(s)
+	return err == nil
+}
+
+func parsePortRange(s string) (portRange, error) {
+	startStr, endStr := s, s
+	if idx := strings.IndexByte(s, '-'); idx != -1 {
+		startStr, endStr = s[:idx], s[idx+1:]
+	}
+
+	start, err := strconv.ParseUint(strings.TrimSpace(startStr), 10, 16)
 	if err != nil {
+		return portRange{}, errPayload
+	}
+	end, err := strconv.ParseUint(strings.TrimSpace(endStr), 10, 16)
+	if err != nil || end < start {
+		return portRange{}, errPayload
+	}
+
+	return portRange{start: uint16(start), end: uint16(end)}, nil
+}
+
+// NewPort returns a port rule, port is a list of ports and port ranges
+// separated by `,` or `/`, e.g. `80,443,6881-6889`
+func NewPort(port string, adapter string, isSource bool) (*Port, error) {
+	ranges := []portRange{}
+	for _, s := range strings.FieldsFunc(port, func(r rune) bool { return r == ',' || r == '/' }) {
+		r, err := parsePortRange(s)
+		if err != nil {
+			return nil, errPayload
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
 		return nil, errPayload
 	}
+
+	// merge the overlapping ranges
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if int(r.start) <= int(last.end)+1 {
+			if r.end > last.end {
+				last.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+
 	return &Port{
 		adapter:  adapter,
 		port:     port,
+		ranges:   merged,
 		isSource: isSource,
 	}, nil
 }
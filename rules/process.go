@@ -0,0 +1,25 @@
+package rules
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// matchProcess compares the executable path of a process with the payload of
+// PROCESS-NAME (the base name) or PROCESS-PATH (the full path)
+func matchProcess(path string, payload string, nameOnly bool) bool {
+	if path == "" {
+		return false
+	}
+
+	if nameOnly {
+		return strings.EqualFold(filepath.Base(path), payload)
+	}
+
+	// paths are case insensitive on windows
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Clean(path), filepath.Clean(payload))
+	}
+	return filepath.Clean(path) == filepath.Clean(payload)
+}
@@ -6,9 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"path/filepath"
 	"strconv"
-	"strings"
 	"syscall"
 	"unsafe"
 
@@ -21,15 +19,24 @@ import (
 var processCache = cache.NewLRUCache(cache.WithAge(2), cache.WithSize(64))
 
 type Process struct {
-	adapter string
-	process string
+	adapter  string
+	process  string
+	nameOnly bool
 }
 
 func (ps *Process) RuleType() C.RuleType {
-	return C.Process
+	if ps.nameOnly {
+		return C.Process
+	}
+	return C.ProcessPath
 }
 
 func (ps *Process) Match(metadata *C.Metadata) bool {
+	return matchProcess(processPath(metadata), ps.process, ps.nameOnly)
+}
+
+// processPath returns the executable path of the process of the connection, it is cached for a while
+func processPath(metadata *C.Metadata) string {
 	key := fmt.Sprintf("%s:%s:%s", metadata.NetWork.String(), metadata.SrcIP.String(), metadata.SrcPort)
 	cached, hit := processCache.Get(key)
 	if !hit {
@@ -43,7 +50,7 @@ func (ps *Process) Match(metadata *C.Metadata) bool {
 		cached = name
 	}
 
-	return strings.EqualFold(cached.(string), ps.process)
+	return cached.(string)
 }
 
 func (p *Process) Adapter() string {
@@ -58,10 +65,11 @@ func (p *Process) ShouldResolveIP() bool {
 	return false
 }
 
-func NewProcess(process string, adapter string) (*Process, error) {
+func NewProcess(process string, adapter string, nameOnly bool) (*Process, error) {
 	return &Process{
-		adapter: adapter,
-		process: process,
+		adapter:  adapter,
+		process:  process,
+		nameOnly: nameOnly,
 	}, nil
 }
 
@@ -89,7 +97,7 @@ func getExecPathFromPID(pid uint32) (string, error) {
 		return "", nil
 	}
 
-	return filepath.Base(string(buf[:firstZero])), nil
+	return string(buf[:firstZero]), nil
 }
 
 func getExecPathFromAddress(metadata *C.Metadata) (string, error) {
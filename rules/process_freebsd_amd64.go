@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,7 +20,9 @@ import (
 var (
 	processCache = cache.NewLRUCache(cache.WithAge(2), cache.WithSize(64))
 	errNotFound  = errors.New("process not found")
-	matchMeta    = func(p *Process, m *C.Metadata) bool { return false }
+	// processPath returns the executable path of the process of the connection,
+	// it is empty until the searcher is initialized
+	processPath = func(m *C.Metadata) string { return "" }
 
 	defaultSearcher *searcher
 
@@ -29,15 +30,19 @@ var (
 )
 
 type Process struct {
-	adapter string
-	process string
+	adapter  string
+	process  string
+	nameOnly bool
 }
 
 func (ps *Process) RuleType() C.RuleType {
-	return C.Process
+	if ps.nameOnly {
+		return C.Process
+	}
+	return C.ProcessPath
 }
 
-func match(ps *Process, metadata *C.Metadata) bool {
+func cachedProcessPath(metadata *C.Metadata) string {
 	key := fmt.Sprintf("%s:%s:%s", metadata.NetWork.String(), metadata.SrcIP.String(), metadata.SrcPort)
 	cached, hit := processCache.Get(key)
 	if !hit {
@@ -51,11 +56,11 @@ func match(ps *Process, metadata *C.Metadata) bool {
 		cached = name
 	}
 
-	return strings.EqualFold(cached.(string), ps.process)
+	return cached.(string)
 }
 
 func (ps *Process) Match(metadata *C.Metadata) bool {
-	return matchMeta(ps, metadata)
+	return matchProcess(processPath(metadata), ps.process, ps.nameOnly)
 }
 
 func (p *Process) Adapter() string {
@@ -70,7 +75,7 @@ func (p *Process) ShouldResolveIP() bool {
 	return false
 }
 
-func NewProcess(process string, adapter string) (*Process, error) {
+func NewProcess(process string, adapter string, nameOnly bool) (*Process, error) {
 	once.Do(func() {
 		err := initSearcher()
 		if err != nil {
@@ -78,11 +83,12 @@ func NewProcess(process string, adapter string) (*Process, error) {
 			log.Warnln("All PROCESS-NAME rules will be skipped")
 			return
 		}
-		matchMeta = match
+		processPath = cachedProcessPath
 	})
 	return &Process{
-		adapter: adapter,
-		process: process,
+		adapter:  adapter,
+		process:  process,
+		nameOnly: nameOnly,
 	}, nil
 }
 
@@ -104,7 +110,7 @@ func getExecPathFromPID(pid uint32) (string, error) {
 		return "", errno
 	}
 
-	return filepath.Base(string(buf[:size-1])), nil
+	return string(buf[:size-1]), nil
 }
 
 func getExecPathFromAddress(metadata *C.Metadata) (string, error) {
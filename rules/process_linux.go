@@ -7,10 +7,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net"
+	"os"
 	"path"
-	"path/filepath"
 	"strconv"
-	"strings"
 	"syscall"
 	"unsafe"
 
@@ -40,29 +39,20 @@ var (
 )
 
 type Process struct {
-	adapter string
-	process string
+	adapter  string
+	process  string
+	nameOnly bool
 }
 
 func (p *Process) RuleType() C.RuleType {
-	return C.Process
+	if p.nameOnly {
+		return C.Process
+	}
+	return C.ProcessPath
 }
 
 func (p *Process) Match(metadata *C.Metadata) bool {
-	key := fmt.Sprintf("%s:%s:%s", metadata.NetWork.String(), metadata.SrcIP.String(), metadata.SrcPort)
-	cached, hit := processCache.Get(key)
-	if !hit {
-		processName, err := resolveProcessName(metadata)
-		if err != nil {
-			log.Debugln("[%s] Resolve process of %s failure: %s", C.Process.String(), key, err.Error())
-		}
-
-		processCache.Set(key, processName)
-
-		cached = processName
-	}
-
-	return strings.EqualFold(cached.(string), p.process)
+	return matchProcess(processPath(metadata), p.process, p.nameOnly)
 }
 
 func (p *Process) Adapter() string {
@@ -77,10 +67,11 @@ func (p *Process) ShouldResolveIP() bool {
 	return false
 }
 
-func NewProcess(process string, adapter string) (*Process, error) {
+func NewProcess(process string, adapter string, nameOnly bool) (*Process, error) {
 	return &Process{
-		adapter: adapter,
-		process: process,
+		adapter:  adapter,
+		process:  process,
+		nameOnly: nameOnly,
 	}, nil
 }
 
@@ -94,6 +85,24 @@ var nativeEndian binary.ByteOrder = binary.LittleEndian
 
 var processCache = cache.NewLRUCache(cache.WithAge(2), cache.WithSize(64))
 
+// processPath returns the executable path of the process of the connection, it is cached for a while
+func processPath(metadata *C.Metadata) string {
+	key := fmt.Sprintf("%s:%s:%s", metadata.NetWork.String(), metadata.SrcIP.String(), metadata.SrcPort)
+	cached, hit := processCache.Get(key)
+	if !hit {
+		processName, err := resolveProcessName(metadata)
+		if err != nil {
+			log.Debugln("[%s] Resolve process of %s failure: %s", C.Process.String(), key, err.Error())
+		}
+
+		processCache.Set(key, processName)
+
+		cached = processName
+	}
+
+	return cached.(string)
+}
+
 func resolveProcessName(metadata *C.Metadata) (string, error) {
 	inode, uid, err := DefaultSocketResolver(metadata)
 	if err != nil {
@@ -258,6 +267,11 @@ func resolveProcessNameByProcSearch(inode, uid int) (string, error) {
 			}
 
 			if bytes.Equal(buffer[:n], socket) {
+				// exe is unreadable for processes of other users without privilege
+				if exe, err := os.Readlink(path.Join(processPath, "exe")); err == nil {
+					return exe, nil
+				}
+
 				cmdline, err := ioutil.ReadFile(path.Join(processPath, "cmdline"))
 				if err != nil {
 					return "", err
@@ -281,7 +295,7 @@ func splitCmdline(cmdline []byte) string {
 		}
 	}
 
-	return filepath.Base(string(cmdline[:indexOfEndOfString]))
+	return string(cmdline[:indexOfEndOfString])
 }
 
 func isPid(s string) bool {
@@ -7,6 +7,10 @@ import (
 	C "github.com/Dreamacro/clash/constant"
 )
 
-func NewProcess(process string, adapter string) (C.Rule, error) {
+func NewProcess(process string, adapter string, nameOnly bool) (C.Rule, error) {
 	return nil, ErrPlatformNotSupport
 }
+
+func processPath(metadata *C.Metadata) string {
+	return ""
+}
@@ -4,9 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 	"syscall"
 	"unsafe"
@@ -29,7 +27,9 @@ const (
 var (
 	processCache = cache.NewLRUCache(cache.WithAge(2), cache.WithSize(64))
 	errNotFound  = errors.New("process not found")
-	matchMeta    = func(p *Process, m *C.Metadata) bool { return false }
+	// processPath returns the executable path of the process of the connection,
+	// it is empty until the searcher is initialized
+	processPath = func(m *C.Metadata) string { return "" }
 
 	getExTcpTable uintptr
 	getExUdpTable uintptr
@@ -68,12 +68,16 @@ func initWin32API() error {
 }
 
 type Process struct {
-	adapter string
-	process string
+	adapter  string
+	process  string
+	nameOnly bool
 }
 
 func (p *Process) RuleType() C.RuleType {
-	return C.Process
+	if p.nameOnly {
+		return C.Process
+	}
+	return C.ProcessPath
 }
 
 func (p *Process) Adapter() string {
@@ -88,7 +92,7 @@ func (p *Process) ShouldResolveIP() bool {
 	return false
 }
 
-func match(p *Process, metadata *C.Metadata) bool {
+func cachedProcessPath(metadata *C.Metadata) string {
 	key := fmt.Sprintf("%s:%s:%s", metadata.NetWork.String(), metadata.SrcIP.String(), metadata.SrcPort)
 	cached, hit := processCache.Get(key)
 	if !hit {
@@ -100,14 +104,14 @@ func match(p *Process, metadata *C.Metadata) bool {
 		processCache.Set(key, processName)
 		cached = processName
 	}
-	return strings.EqualFold(cached.(string), p.process)
+	return cached.(string)
 }
 
 func (p *Process) Match(metadata *C.Metadata) bool {
-	return matchMeta(p, metadata)
+	return matchProcess(processPath(metadata), p.process, p.nameOnly)
 }
 
-func NewProcess(process string, adapter string) (*Process, error) {
+func NewProcess(process string, adapter string, nameOnly bool) (*Process, error) {
 	once.Do(func() {
 		err := initWin32API()
 		if err != nil {
@@ -115,11 +119,12 @@ func NewProcess(process string, adapter string) (*Process, error) {
 			log.Warnln("All PROCESS-NAMES rules will be skiped")
 			return
 		}
-		matchMeta = match
+		processPath = cachedProcessPath
 	})
 	return &Process{
-		adapter: adapter,
-		process: process,
+		adapter:  adapter,
+		process:  process,
+		nameOnly: nameOnly,
 	}, nil
 }
 
@@ -282,5 +287,5 @@ func getExecPathFromPID(pid uint32) (string, error) {
 	if r1 == 0 {
 		return "", err
 	}
-	return filepath.Base(syscall.UTF16ToString(buf[:size])), nil
+	return syscall.UTF16ToString(buf[:size]), nil
 }
@@ -0,0 +1,63 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Dreamacro/clash/component/dialer"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+const routingMarkPrefix = "routing-mark="
+
+// ParseRoutingMark returns the mark of the routing-mark param, e.g.
+// DOMAIN-SUFFIX,example.com,DIRECT,routing-mark=0x10, zero if it isn't set
+func ParseRoutingMark(params []string) (int, error) {
+	for _, p := range params {
+		if !strings.HasPrefix(p, routingMarkPrefix) {
+			continue
+		}
+
+		value := strings.TrimPrefix(p, routingMarkPrefix)
+		mark, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid routing mark: %s", value)
+		}
+		if err := dialer.CheckRoutingMark(mark); err != nil {
+			return 0, err
+		}
+		return int(mark), nil
+	}
+	return 0, nil
+}
+
+// WithRoutingMark returns rule which sets the routing mark of the connections
+// it matches, rule is returned if mark is zero
+func WithRoutingMark(rule C.Rule, mark int) C.Rule {
+	if mark == 0 {
+		return rule
+	}
+	if r, ok := rule.(C.PolicyRule); ok {
+		return &routingMarkPolicyRule{PolicyRule: r, mark: mark}
+	}
+	return &routingMarkRule{Rule: rule, mark: mark}
+}
+
+type routingMarkRule struct {
+	C.Rule
+	mark int
+}
+
+func (r *routingMarkRule) RoutingMark() int {
+	return r.mark
+}
+
+type routingMarkPolicyRule struct {
+	C.PolicyRule
+	mark int
+}
+
+func (r *routingMarkPolicyRule) RoutingMark() int {
+	return r.mark
+}
@@ -0,0 +1,59 @@
+package rules
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoutingMark(t *testing.T) {
+	tests := []struct {
+		params []string
+		mark   int
+		err    bool
+	}{
+		{params: nil},
+		{params: []string{"no-resolve"}},
+		{params: []string{"routing-mark=16"}, mark: 16},
+		{params: []string{"no-resolve", "routing-mark=0x10"}, mark: 16},
+		{params: []string{"routing-mark=" + strconv.FormatInt(math.MaxUint32, 10)}, mark: math.MaxUint32},
+		{params: []string{"routing-mark=0x100000000"}, err: true},
+		{params: []string{"routing-mark=-1"}, err: true},
+		{params: []string{"routing-mark=abc"}, err: true},
+		{params: []string{"routing-mark="}, err: true},
+	}
+
+	for _, tt := range tests {
+		mark, err := ParseRoutingMark(tt.params)
+		if tt.err {
+			assert.Error(t, err, tt.params)
+			continue
+		}
+		require.NoError(t, err, tt.params)
+		assert.Equal(t, tt.mark, mark, tt.params)
+	}
+}
+
+func TestWithRoutingMark(t *testing.T) {
+	rule := NewMatch("DIRECT")
+	assert.Same(t, rule, WithRoutingMark(rule, 0))
+
+	marked, ok := WithRoutingMark(rule, 16).(C.RoutingMarkRule)
+	require.True(t, ok)
+	assert.Equal(t, 16, marked.RoutingMark())
+	assert.Equal(t, "DIRECT", marked.Adapter())
+
+	script, err := NewScript("test", `"DIRECT"`)
+	require.NoError(t, err)
+	wrapped := WithRoutingMark(script, 16)
+	_, ok = wrapped.(C.PolicyRule)
+	assert.True(t, ok)
+	marked, ok = wrapped.(C.RoutingMarkRule)
+	require.True(t, ok)
+	assert.Equal(t, 16, marked.RoutingMark())
+}
@@ -0,0 +1,240 @@
+package rules
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Dreamacro/clash/common/cache"
+	"github.com/Dreamacro/clash/component/geosite"
+	"github.com/Dreamacro/clash/component/mmdb"
+	"github.com/Dreamacro/clash/component/script"
+	C "github.com/Dreamacro/clash/constant"
+
+	"go.uber.org/atomic"
+)
+
+// scriptEnv is the variables and functions of SCRIPT rules, the addresses
+// are strings which are empty if unknown
+var scriptEnv = &script.Env{
+	Vars: map[string]script.Type{
+		"network":      script.String,
+		"host":         script.String,
+		"dst_ip":       script.String,
+		"dst_port":     script.Int,
+		"src_ip":       script.String,
+		"src_port":     script.Int,
+		"in_type":      script.String,
+		"in_user":      script.String,
+		"process":      script.String,
+		"process_path": script.String,
+	},
+	Funcs: map[string]*script.Func{
+		// geoip(ip, code) reports whether ip belongs to the country code
+		"geoip": {
+			Args:   []script.Type{script.String, script.String},
+			Result: script.Bool,
+			Call: func(args []interface{}) interface{} {
+				ip := net.ParseIP(args[0].(string))
+				return ip != nil && mmdb.Instance().Match(ip, args[1].(string))
+			},
+		},
+		// geosite(domain, code) reports whether domain belongs to the geosite category code
+		"geosite": {
+			Args:   []script.Type{script.String, script.String},
+			Result: script.Bool,
+			Call: func(args []interface{}) interface{} {
+				return args[0] != "" && geosite.Match(args[1].(string), args[0].(string))
+			},
+		},
+		// suffix(domain, suffix) matches domain like DOMAIN-SUFFIX
+		"suffix": {
+			Args:   []script.Type{script.String, script.String},
+			Result: script.Bool,
+			Call: func(args []interface{}) interface{} {
+				domain, suffix := strings.ToLower(args[0].(string)), strings.ToLower(args[1].(string))
+				return strings.HasSuffix(domain, "."+suffix) || domain == suffix
+			},
+		},
+		// keyword(s, keyword) reports whether s contains keyword
+		"keyword": {
+			Args:   []script.Type{script.String, script.String},
+			Result: script.Bool,
+			Call: func(args []interface{}) interface{} {
+				return strings.Contains(strings.ToLower(args[0].(string)), strings.ToLower(args[1].(string)))
+			},
+		},
+		// cidr(ip, cidr) reports whether ip is in cidr
+		"cidr": {
+			Args:   []script.Type{script.String, script.String},
+			Result: script.Bool,
+			Call: func(args []interface{}) interface{} {
+				ip := net.ParseIP(args[0].(string))
+				_, ipnet, err := net.ParseCIDR(args[1].(string))
+				return ip != nil && err == nil && ipnet.Contains(ip)
+			},
+			Check: func(args []interface{}) error {
+				if s, ok := args[1].(string); ok {
+					if _, _, err := net.ParseCIDR(s); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	},
+}
+
+// Script is a SCRIPT rule, the script returns the policy name and an empty
+// name means no match, the results are cached by the values of the variables
+// used by the script
+type Script struct {
+	name        string
+	program     *script.Program
+	cache       *cache.LruCache
+	noResolveIP bool
+	// policy is the last matched policy
+	policy *atomic.String
+}
+
+func (s *Script) RuleType() C.RuleType {
+	return C.Script
+}
+
+func (s *Script) Match(metadata *C.Metadata) bool {
+	_, ok := s.MatchPolicy(metadata)
+	return ok
+}
+
+func (s *Script) MatchPolicy(metadata *C.Metadata) (string, bool) {
+	vars := s.program.Vars()
+	values := make(map[string]interface{}, len(vars))
+	// the results of geoip() and geosite() change with the databases
+	keys := make([]string, len(vars)+1)
+	keys[0] = fmt.Sprintf("%d:%d", mmdb.Generation(), geosite.Generation())
+	for i, name := range vars {
+		values[name] = scriptVar(metadata, name)
+		keys[i+1] = fmt.Sprint(values[name])
+	}
+	key := strings.Join(keys, "\x00")
+
+	policy, hit := s.cache.Get(key)
+	if !hit {
+		policy = s.program.Run(func(name string) interface{} { return values[name] })
+		s.cache.Set(key, policy)
+	}
+	name := policy.(string)
+	if name != "" {
+		s.policy.Store(name)
+	}
+	return name, name != ""
+}
+
+// Adapter returns the last matched policy, or the name of the script if it
+// hasn't matched
+func (s *Script) Adapter() string {
+	if policy := s.policy.Load(); policy != "" {
+		return policy
+	}
+	return s.name
+}
+
+func (s *Script) Payload() string {
+	return s.name
+}
+
+func (s *Script) ShouldResolveIP() bool {
+	return !s.noResolveIP && s.program.Uses("dst_ip")
+}
+
+// WithNoResolve returns a copy of s which doesn't resolve the host, dst_ip is
+// empty if the destination IP is unknown
+func (s *Script) WithNoResolve() *Script {
+	c := *s
+	c.noResolveIP = true
+	return &c
+}
+
+// Policies returns the constant policy names the script may return
+func (s *Script) Policies() []string {
+	policies := []string{}
+	for _, name := range s.program.Results() {
+		if name != "" {
+			policies = append(policies, name)
+		}
+	}
+	return policies
+}
+
+// GeoSiteCodes returns the constant geosite categories used by the script
+func (s *Script) GeoSiteCodes() []string {
+	codes := []string{}
+	for _, code := range s.program.Constants(scriptEnv.Funcs["geosite"], 1) {
+		codes = append(codes, code.(string))
+	}
+	return codes
+}
+
+func scriptVar(metadata *C.Metadata, name string) interface{} {
+	switch name {
+	case "network":
+		return metadata.NetWork.String()
+	case "host":
+		return metadata.Host
+	case "dst_ip":
+		return ipString(metadata.DstIP)
+	case "dst_port":
+		port, _ := strconv.ParseInt(metadata.DstPort, 10, 64)
+		return port
+	case "src_ip":
+		return ipString(metadata.SrcIP)
+	case "src_port":
+		port, _ := strconv.ParseInt(metadata.SrcPort, 10, 64)
+		return port
+	case "in_type":
+		return metadata.Type.String()
+	case "in_user":
+		return metadata.InUser
+	case "process":
+		if path := processPath(metadata); path != "" {
+			return filepath.Base(path)
+		}
+		return ""
+	default:
+		return processPath(metadata)
+	}
+}
+
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// NewScript compiles src of the script name, the script must return a string
+func NewScript(name string, src string) (*Script, error) {
+	program, err := script.Compile(src, scriptEnv)
+	if err != nil {
+		return nil, err
+	}
+	if program.Type() != script.String {
+		return nil, fmt.Errorf("script returns %s, not a policy name", program.Type())
+	}
+
+	if program.Uses("process") || program.Uses("process_path") {
+		// initialize the process searcher of the platform
+		if _, err := NewProcess("", "", true); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Script{
+		name:    name,
+		program: program,
+		cache:   cache.NewLRUCache(cache.WithSize(1024), cache.WithAge(60)),
+		policy:  atomic.NewString(""),
+	}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Dreamacro/clash/adapters/inbound"
@@ -15,35 +16,38 @@ import (
 	C "github.com/Dreamacro/clash/constant"
 )
 
-func handleHTTP(request *inbound.HTTPAdapter, outbound net.Conn) {
+// handleHTTP relays the requests of a HTTP proxy connection, it returns the
+// error which stops relaying, nil means the connection ends normally
+func handleHTTP(request *inbound.HTTPAdapter, outbound net.Conn) (err error) {
 	req := request.R
 	host := req.Host
 
 	inboundReader := bufio.NewReader(request)
 	outboundReader := bufio.NewReader(outbound)
 
+	var resp *http.Response
 	for {
 		keepAlive := strings.TrimSpace(strings.ToLower(req.Header.Get("Proxy-Connection"))) == "keep-alive"
 
 		req.Header.Set("Connection", "close")
 		req.RequestURI = ""
 		inbound.RemoveHopByHopHeaders(req.Header)
-		err := req.Write(outbound)
+		err = req.Write(outbound)
 		if err != nil {
-			break
+			return
 		}
 
 	handleResponse:
-		resp, err := http.ReadResponse(outboundReader, req)
+		resp, err = http.ReadResponse(outboundReader, req)
 		if err != nil {
-			break
+			return
 		}
 		inbound.RemoveHopByHopHeaders(resp.Header)
 
 		if resp.StatusCode == http.StatusContinue {
 			err = resp.Write(request)
 			if err != nil {
-				break
+				return
 			}
 			goto handleResponse
 		}
@@ -58,7 +62,7 @@ func handleHTTP(request *inbound.HTTPAdapter, outbound net.Conn) {
 		}
 		err = resp.Write(request)
 		if err != nil || resp.Close {
-			break
+			return
 		}
 
 		// even if resp.Write write body to the connection, but some http request have to Copy to close it
@@ -66,18 +70,18 @@ func handleHTTP(request *inbound.HTTPAdapter, outbound net.Conn) {
 		_, err = io.CopyBuffer(request, resp.Body, buf)
 		pool.Put(buf)
 		if err != nil && err != io.EOF {
-			break
+			return
 		}
 
 		req, err = http.ReadRequest(inboundReader)
 		if err != nil {
-			break
+			return
 		}
 
 		// Sometimes firefox just open a socket to process multiple domains in HTTP
 		// The temporary solution is close connection when encountering different HOST
 		if req.Host != host {
-			break
+			return nil
 		}
 	}
 }
@@ -87,7 +91,12 @@ func handleUDPToRemote(packet C.UDPPacket, pc C.PacketConn, metadata *C.Metadata
 
 	// local resolve UDP dns
 	if !metadata.Resolved() {
-		ip, err := resolver.ResolveIP(metadata.Host)
+		resolve := resolver.ResolveIP
+		if chains := pc.Chains(); len(chains) != 0 && chains[0] == "DIRECT" {
+			resolve = resolver.ResolveDirectIP
+		}
+
+		ip, err := resolve(metadata.Host)
 		if err != nil {
 			return err
 		}
@@ -99,6 +108,8 @@ func handleUDPToRemote(packet C.UDPPacket, pc C.PacketConn, metadata *C.Metadata
 		return errors.New("udp addr invalid")
 	}
 
+	// the session is alive as long as either side sends packets
+	pc.SetReadDeadline(time.Now().Add(udpTimeout.Load()))
 	_, err := pc.WriteTo(packet.Data(), addr)
 	return err
 }
@@ -110,9 +121,10 @@ func handleUDPToLocal(packet C.UDPPacket, pc net.PacketConn, key string, fAddr n
 	defer pc.Close()
 
 	for {
-		pc.SetReadDeadline(time.Now().Add(udpTimeout))
+		pc.SetReadDeadline(time.Now().Add(udpTimeout.Load()))
 		n, from, err := pc.ReadFrom(buf)
 		if err != nil {
+			setCloseReason(pc, err)
 			return
 		}
 
@@ -122,30 +134,37 @@ func handleUDPToLocal(packet C.UDPPacket, pc net.PacketConn, key string, fAddr n
 
 		_, err = packet.WriteBack(buf[:n], from)
 		if err != nil {
+			setCloseReason(pc, err)
 			return
 		}
 	}
 }
 
-func handleSocket(request C.ServerAdapter, outbound net.Conn) {
-	relay(request, outbound)
+func handleSocket(request C.ServerAdapter, outbound net.Conn) error {
+	return relay(request, outbound)
 }
 
-// relay copies between left and right bidirectionally.
-func relay(leftConn, rightConn net.Conn) {
+// relay copies between left and right bidirectionally, it returns the error
+// of the direction which stops first, nil means it reaches EOF
+func relay(leftConn, rightConn net.Conn) error {
 	ch := make(chan error)
+	var once sync.Once
+	var first error
 
 	go func() {
 		buf := pool.Get(pool.RelayBufferSize)
 		_, err := io.CopyBuffer(leftConn, rightConn, buf)
 		pool.Put(buf)
+		once.Do(func() { first = err })
 		leftConn.SetReadDeadline(time.Now())
 		ch <- err
 	}()
 
 	buf := pool.Get(pool.RelayBufferSize)
-	io.CopyBuffer(rightConn, leftConn, buf)
+	_, err := io.CopyBuffer(rightConn, leftConn, buf)
 	pool.Put(buf)
+	once.Do(func() { first = err })
 	rightConn.SetReadDeadline(time.Now())
 	<-ch
+	return first
 }
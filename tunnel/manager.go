@@ -4,11 +4,16 @@ import (
 	"sync"
 	"time"
 
+	C "github.com/Dreamacro/clash/constant"
+
 	"go.uber.org/atomic"
 )
 
 var DefaultManager *Manager
 
+// closedHistorySize is the number of the recently closed connections kept in snapshots
+const closedHistorySize = 64
+
 func init() {
 	DefaultManager = &Manager{
 		uploadTemp:    atomic.NewInt64(0),
@@ -17,6 +22,8 @@ func init() {
 		downloadBlip:  atomic.NewInt64(0),
 		uploadTotal:   atomic.NewInt64(0),
 		downloadTotal: atomic.NewInt64(0),
+
+		connectionsTotal: atomic.NewInt64(0),
 	}
 
 	go DefaultManager.handle()
@@ -24,20 +31,43 @@ func init() {
 
 type Manager struct {
 	connections   sync.Map
+	proxyStats    statGroup
+	ruleStats     statGroup
+	hostStats     statGroup
 	uploadTemp    *atomic.Int64
 	downloadTemp  *atomic.Int64
 	uploadBlip    *atomic.Int64
 	downloadBlip  *atomic.Int64
 	uploadTotal   *atomic.Int64
 	downloadTotal *atomic.Int64
+	// connectionsTotal is the number of connections ever joined
+	connectionsTotal *atomic.Int64
+
+	closedMux sync.Mutex
+	closed    []tracker
 }
 
 func (m *Manager) Join(c tracker) {
 	m.connections.Store(c.ID(), c)
+	m.connectionsTotal.Inc()
+	emitConnectionRecord("open", c)
 }
 
 func (m *Manager) Leave(c tracker) {
-	m.connections.Delete(c.ID())
+	if _, loaded := m.connections.LoadAndDelete(c.ID()); loaded {
+		m.closedMux.Lock()
+		if len(m.closed) == closedHistorySize {
+			m.closed = m.closed[1:]
+		}
+		m.closed = append(m.closed, c)
+		m.closedMux.Unlock()
+
+		if t, ok := c.(interface{ releaseStats() }); ok {
+			t.releaseStats()
+		}
+
+		emitConnectionRecord("close", c)
+	}
 }
 
 func (m *Manager) PushUploaded(size int64) {
@@ -50,10 +80,35 @@ func (m *Manager) PushDownloaded(size int64) {
 	m.downloadTotal.Add(size)
 }
 
+// trafficStats returns the statistics that traffic of a connection is attributed to
+func (m *Manager) trafficStats(metadata *C.Metadata, chain C.Chain, rule C.Rule) trafficStats {
+	stats := trafficStats{m.ruleStats.acquire(ruleKey(rule)), m.hostStats.acquire(metadata.String())}
+	if len(chain) > 0 {
+		stats = append(stats, m.proxyStats.acquire(chain[0]))
+	}
+	stats.pushConnection()
+	return stats
+}
+
 func (m *Manager) Now() (up int64, down int64) {
 	return m.uploadBlip.Load(), m.downloadBlip.Load()
 }
 
+// Total returns the cumulative traffic in bytes
+func (m *Manager) Total() (up int64, down int64) {
+	return m.uploadTotal.Load(), m.downloadTotal.Load()
+}
+
+// ConnectionCount returns the number of the alive connections and the
+// number of the connections ever joined
+func (m *Manager) ConnectionCount() (alive int64, total int64) {
+	m.connections.Range(func(key, value interface{}) bool {
+		alive++
+		return true
+	})
+	return alive, m.connectionsTotal.Load()
+}
+
 func (m *Manager) Snapshot() *Snapshot {
 	connections := []tracker{}
 	m.connections.Range(func(key, value interface{}) bool {
@@ -61,13 +116,37 @@ func (m *Manager) Snapshot() *Snapshot {
 		return true
 	})
 
+	m.closedMux.Lock()
+	closed := append([]tracker{}, m.closed...)
+	m.closedMux.Unlock()
+
 	return &Snapshot{
 		UploadTotal:   m.uploadTotal.Load(),
 		DownloadTotal: m.downloadTotal.Load(),
 		Connections:   connections,
+		Closed:        closed,
+		UDPSessions:   UDPSessionCount(),
 	}
 }
 
+// Stats returns the cumulative traffic and the rate of the last second by
+// proxy, rule and destination host
+func (m *Manager) Stats() *StatsSnapshot {
+	return &StatsSnapshot{
+		Proxies: m.proxyStats.snapshot(),
+		Rules:   m.ruleStats.snapshot(),
+		Hosts:   m.hostStats.snapshot(),
+	}
+}
+
+// ResetStats sets the statistics by proxy, rule and host to zero, alive
+// connections keep counting from zero. The global totals are not affected.
+func (m *Manager) ResetStats() {
+	m.proxyStats.reset()
+	m.ruleStats.reset()
+	m.hostStats.reset()
+}
+
 func (m *Manager) ResetStatistic() {
 	m.uploadTemp.Store(0)
 	m.uploadBlip.Store(0)
@@ -85,6 +164,10 @@ func (m *Manager) handle() {
 		m.uploadTemp.Store(0)
 		m.downloadBlip.Store(m.downloadTemp.Load())
 		m.downloadTemp.Store(0)
+
+		m.proxyStats.tick(0)
+		m.ruleStats.tick(0)
+		m.hostStats.tick(hostStatIdleTicks)
 	}
 }
 
@@ -92,4 +175,8 @@ type Snapshot struct {
 	DownloadTotal int64     `json:"downloadTotal"`
 	UploadTotal   int64     `json:"uploadTotal"`
 	Connections   []tracker `json:"connections"`
+	// Closed are the recently closed connections with their close reasons
+	Closed []tracker `json:"closed"`
+	// UDPSessions is the number of the alive UDP sessions
+	UDPSessions int `json:"udpSessions"`
 }
@@ -0,0 +1,45 @@
+package tunnel
+
+import (
+	"github.com/Dreamacro/clash/component/resolver"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+// MatchResult is how a connection would be dispatched
+type MatchResult struct {
+	Proxy C.Proxy
+	// Rule is nil if no rule matches or the mode isn't rule
+	Rule C.Rule
+	// Chain is the names from Proxy to the final node, groups are unwrapped
+	Chain []string
+	// FakeIP means the destination is a fake ip mapped back to the host
+	FakeIP bool
+	// Resolved means the host is resolved to match the IP rules
+	Resolved bool
+}
+
+// Match runs metadata through the rules without connecting, metadata is
+// updated as a connection would be
+func Match(metadata *C.Metadata) (*MatchResult, error) {
+	result := &MatchResult{
+		FakeIP: resolver.IsExistFakeIP(metadata.DstIP),
+	}
+
+	if err := preHandleMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	unresolved := metadata.Host != "" && metadata.DstIP == nil
+	proxy, rule, err := resolveMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	result.Resolved = unresolved && metadata.DstIP != nil
+	result.Proxy, result.Rule = proxy, rule
+
+	for p := C.Proxy(proxy); p != nil; p = p.Unwrap(metadata) {
+		result.Chain = append(result.Chain, p.Name())
+	}
+
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package tunnel
+
+import (
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+)
+
+type connectionRecord struct {
+	Action     string  `json:"action"`
+	Connection tracker `json:"connection"`
+	Reason     string  `json:"reason,omitempty"`
+}
+
+type ruleRecord struct {
+	Metadata    *C.Metadata `json:"metadata"`
+	Rule        string      `json:"rule"`
+	RulePayload string      `json:"rulePayload"`
+	Proxy       string      `json:"proxy"`
+}
+
+type proxyRecord struct {
+	Metadata *C.Metadata `json:"metadata"`
+	Chain    C.Chain     `json:"chains"`
+}
+
+// emitConnectionRecord emits a record when a connection is opened or closed
+func emitConnectionRecord(action string, c tracker) {
+	if !log.Enabled() {
+		return
+	}
+
+	if reason := c.CloseReason(); reason != "" {
+		log.Emit(log.RecordConnection, &connectionRecord{Action: action, Connection: c, Reason: reason}, "%s %s (%s)", action, c.ID(), reason)
+		return
+	}
+	log.Emit(log.RecordConnection, &connectionRecord{Action: action, Connection: c}, "%s %s", action, c.ID())
+}
+
+func emitRuleRecord(metadata *C.Metadata, proxy C.Proxy, rule C.Rule) {
+	if !log.Enabled() || rule == nil {
+		return
+	}
+
+	log.Emit(log.RecordRule, &ruleRecord{
+		Metadata:    metadata,
+		Rule:        rule.RuleType().String(),
+		RulePayload: rule.Payload(),
+		Proxy:       proxy.Name(),
+	}, "%s match %s(%s) using %s", metadata.String(), rule.RuleType().String(), rule.Payload(), proxy.Name())
+}
+
+func emitProxyRecord(metadata *C.Metadata, chain C.Chain) {
+	if !log.Enabled() {
+		return
+	}
+
+	log.Emit(log.RecordProxy, &proxyRecord{
+		Metadata: metadata,
+		Chain:    chain,
+	}, "%s using %s", metadata.String(), chain.String())
+}
@@ -0,0 +1,221 @@
+package tunnel
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/adapters/inbound"
+	"github.com/Dreamacro/clash/common/cache"
+	N "github.com/Dreamacro/clash/common/net"
+	"github.com/Dreamacro/clash/component/sniffer"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+)
+
+const (
+	// packetSniffTimeout is how long to wait for the next packets of a UDP
+	// session whose domain continues in them, e.g. a QUIC ClientHello in
+	// several Initial packets
+	packetSniffTimeout = 300 * time.Millisecond
+	maxSniffPackets    = 8
+)
+
+var (
+	connSniffer *sniffer.Sniffer
+
+	// sniffingSessions is the packet queues of the UDP sessions waiting for
+	// the next packets to sniff, by the key of natTable
+	sniffingSessions sync.Map
+
+	// blockedSessions is the UDP sessions whose QUIC is blocked, their
+	// packets are dropped until the session is idle for the UDP timeout
+	blockedSessions = cache.NewLRUCache(cache.WithSize(4096))
+)
+
+// packetQueue collects the packets of a UDP session while its first packets
+// are sniffed
+type packetQueue struct {
+	mux     sync.Mutex
+	packets []*inbound.PacketAdapter
+	closed  bool
+	notify  chan struct{}
+}
+
+func newPacketQueue() *packetQueue {
+	return &packetQueue{notify: make(chan struct{}, 1)}
+}
+
+// push returns false if the queue is closed
+func (q *packetQueue) push(packet *inbound.PacketAdapter) bool {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.closed || len(q.packets) >= maxSniffPackets {
+		return false
+	}
+	q.packets = append(q.packets, packet)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (q *packetQueue) snapshot() []*inbound.PacketAdapter {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return append([]*inbound.PacketAdapter{}, q.packets...)
+}
+
+// close returns the queued packets, the next pushes fail
+func (q *packetQueue) close() []*inbound.PacketAdapter {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	q.closed = true
+	return q.packets
+}
+
+// queuePacket queues packet if its session is being sniffed
+func queuePacket(key string, packet *inbound.PacketAdapter) bool {
+	q, ok := sniffingSessions.Load(key)
+	return ok && q.(*packetQueue).push(packet)
+}
+
+// isBlockedSession reports whether the packets of the session of key should
+// be dropped, the blocking is extended like the idle timeout of a session
+func isBlockedSession(key string) bool {
+	_, expires, ok := blockedSessions.GetWithExpire(key)
+	if !ok || time.Now().After(expires) {
+		return false
+	}
+
+	blockedSessions.SetWithExpire(key, true, time.Now().Add(udpTimeout.Load()))
+	return true
+}
+
+// UpdateSniffer sets the sniffer of connections, nil disables sniffing
+func UpdateSniffer(s *sniffer.Sniffer) {
+	configMux.Lock()
+	connSniffer = s
+	configMux.Unlock()
+}
+
+// sniffMetadata sets the host of metadata to the sniffed domain if the
+// connection is to an IP. The returned function restores the destination
+// unless the sniffer overrides it, it should be called after matching rules.
+func sniffMetadata(localConn C.ServerAdapter) (restore func()) {
+	restore = func() {}
+
+	configMux.RLock()
+	s := connSniffer
+	configMux.RUnlock()
+
+	adapter, ok := localConn.(*inbound.SocketAdapter)
+	if s == nil || !ok {
+		return
+	}
+
+	metadata := adapter.Metadata()
+	if metadata.Host != "" || metadata.DstIP == nil || !s.ShouldSniff(metadata.DstPort) {
+		return
+	}
+
+	conn := N.NewBufferedConn(adapter.Conn)
+	adapter.Conn = conn
+
+	host, protocol := s.Sniff(conn)
+	if host == "" {
+		return
+	}
+
+	return applySniffed(s, metadata, host, protocol)
+}
+
+// sniffPacketMetadata likes sniffMetadata for the first packet of the UDP
+// session of key. If the domain continues in the next packets, they're
+// queued until it's sniffed and returned in queued. blocked is true if the
+// packets of the session should be dropped.
+func sniffPacketMetadata(key string, packet *inbound.PacketAdapter) (restore func(), blocked bool, queued []*inbound.PacketAdapter) {
+	restore = func() {}
+
+	configMux.RLock()
+	s := connSniffer
+	configMux.RUnlock()
+
+	metadata := packet.Metadata()
+	if s == nil || metadata.Host != "" || metadata.DstIP == nil || !s.ShouldSniff(metadata.DstPort) {
+		return
+	}
+
+	packets := [][]byte{packet.Data()}
+	host, protocol, needMore := s.SniffPackets(packets)
+	var q *packetQueue
+	if host == "" && needMore {
+		q = newPacketQueue()
+		sniffingSessions.Store(key, q)
+		timer := time.NewTimer(packetSniffTimeout)
+
+	wait:
+		for host == "" && needMore && len(packets) < maxSniffPackets {
+			select {
+			case <-q.notify:
+			case <-timer.C:
+				break wait
+			}
+
+			packets = packets[:1]
+			for _, p := range q.snapshot() {
+				packets = append(packets, p.Data())
+			}
+			host, protocol, needMore = s.SniffPackets(packets)
+		}
+		timer.Stop()
+	}
+
+	// the session is marked before the queue is closed, so that the packets
+	// after it are dropped too
+	blocked = host != "" && s.ShouldBlockQUIC(host)
+	if blocked {
+		blockedSessions.SetWithExpire(key, true, time.Now().Add(udpTimeout.Load()))
+	}
+	if q != nil {
+		queued = q.close()
+		sniffingSessions.Delete(key)
+	}
+
+	if host == "" {
+		return
+	}
+
+	if blocked {
+		log.Debugln("[Sniffer] %s --> %s QUIC of %s blocked", metadata.SourceDetail(), metadata.RemoteAddress(), host)
+		return restore, true, queued
+	}
+
+	return applySniffed(s, metadata, host, protocol), false, queued
+}
+
+// applySniffed sets the sniffed host of metadata, the returned function
+// restores the destination unless the sniffer overrides it
+func applySniffed(s *sniffer.Sniffer, metadata *C.Metadata, host string, protocol string) (restore func()) {
+	destination := metadata.RemoteAddress()
+	addrType := metadata.AddrType
+	metadata.Host = host
+	metadata.AddrType = C.AtypDomainName
+	metadata.SniffHost = host
+	metadata.HostSource = "sniff-" + protocol
+
+	if s.Override {
+		log.Infoln("[Sniffer] %s --> %s overridden by sniffed %s of %s", metadata.SourceDetail(), destination, host, protocol)
+		return func() {}
+	}
+
+	log.Debugln("[Sniffer] %s --> %s sniffed %s of %s", metadata.SourceDetail(), destination, host, protocol)
+	return func() {
+		metadata.Host = ""
+		metadata.AddrType = addrType
+		metadata.HostSource = ""
+	}
+}
@@ -0,0 +1,201 @@
+package tunnel
+
+import (
+	"sync"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"go.uber.org/atomic"
+)
+
+// host statistics without traffic for hostStatIdleTicks seconds are dropped
+const hostStatIdleTicks = 10 * 60
+
+// trafficStat is the traffic attributed to a proxy, a rule or a destination host
+type trafficStat struct {
+	uploadTemp    *atomic.Int64
+	downloadTemp  *atomic.Int64
+	uploadBlip    *atomic.Int64
+	downloadBlip  *atomic.Int64
+	uploadTotal   *atomic.Int64
+	downloadTotal *atomic.Int64
+	connections   *atomic.Int64
+
+	// group, refs and idle are guarded by the mutex of group, refs is the
+	// number of the alive connections holding the statistic
+	group *statGroup
+	refs  int
+	idle  int
+}
+
+func newTrafficStat(group *statGroup) *trafficStat {
+	return &trafficStat{
+		group:         group,
+		uploadTemp:    atomic.NewInt64(0),
+		downloadTemp:  atomic.NewInt64(0),
+		uploadBlip:    atomic.NewInt64(0),
+		downloadBlip:  atomic.NewInt64(0),
+		uploadTotal:   atomic.NewInt64(0),
+		downloadTotal: atomic.NewInt64(0),
+		connections:   atomic.NewInt64(0),
+	}
+}
+
+// tick moves the traffic of the last second to the current rate, it returns false if no traffic
+func (s *trafficStat) tick() bool {
+	up, down := s.uploadTemp.Swap(0), s.downloadTemp.Swap(0)
+	s.uploadBlip.Store(up)
+	s.downloadBlip.Store(down)
+	if up == 0 && down == 0 {
+		s.idle++
+		return false
+	}
+	s.idle = 0
+	return true
+}
+
+func (s *trafficStat) reset() {
+	s.uploadTemp.Store(0)
+	s.downloadTemp.Store(0)
+	s.uploadBlip.Store(0)
+	s.downloadBlip.Store(0)
+	s.uploadTotal.Store(0)
+	s.downloadTotal.Store(0)
+	s.connections.Store(0)
+}
+
+func (s *trafficStat) snapshot() *TrafficStat {
+	return &TrafficStat{
+		UploadTotal:   s.uploadTotal.Load(),
+		DownloadTotal: s.downloadTotal.Load(),
+		Upload:        s.uploadBlip.Load(),
+		Download:      s.downloadBlip.Load(),
+		Connections:   s.connections.Load(),
+	}
+}
+
+type trafficStats []*trafficStat
+
+func (ts trafficStats) pushConnection() {
+	for _, s := range ts {
+		s.connections.Inc()
+	}
+}
+
+func (ts trafficStats) pushUploaded(size int64) {
+	for _, s := range ts {
+		s.uploadTemp.Add(size)
+		s.uploadTotal.Add(size)
+	}
+}
+
+func (ts trafficStats) pushDownloaded(size int64) {
+	for _, s := range ts {
+		s.downloadTemp.Add(size)
+		s.downloadTotal.Add(size)
+	}
+}
+
+// release is called once the connection is closed
+func (ts trafficStats) release() {
+	for _, s := range ts {
+		s.group.release(s)
+	}
+}
+
+// statGroup is a set of traffic statistics by key
+type statGroup struct {
+	mux   sync.Mutex
+	stats map[string]*trafficStat
+}
+
+// acquire returns the statistic of key for a connection, it isn't dropped
+// before the connection releases it
+func (g *statGroup) acquire(key string) *trafficStat {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	if g.stats == nil {
+		g.stats = map[string]*trafficStat{}
+	}
+	s, ok := g.stats[key]
+	if !ok {
+		s = newTrafficStat(g)
+		g.stats[key] = s
+	}
+	s.refs++
+	return s
+}
+
+func (g *statGroup) release(s *trafficStat) {
+	g.mux.Lock()
+	s.refs--
+	g.mux.Unlock()
+}
+
+// tick drops the statistics idle for more than maxIdle ticks without alive
+// connections, zero maxIdle keeps all of them
+func (g *statGroup) tick(maxIdle int) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	for key, s := range g.stats {
+		if !s.tick() && maxIdle > 0 && s.idle > maxIdle && s.refs == 0 {
+			delete(g.stats, key)
+		}
+	}
+}
+
+func (g *statGroup) snapshot() map[string]*TrafficStat {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	result := map[string]*TrafficStat{}
+	for key, s := range g.stats {
+		result[key] = s.snapshot()
+	}
+	return result
+}
+
+func (g *statGroup) reset() {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	for _, s := range g.stats {
+		s.reset()
+	}
+}
+
+// TrafficStat is the traffic of a proxy, a rule or a host. Totals are in bytes,
+// Upload and Download are the rate of the last second in bytes per second.
+// Connections is the number of connections attributed to it.
+type TrafficStat struct {
+	UploadTotal   int64 `json:"uploadTotal"`
+	DownloadTotal int64 `json:"downloadTotal"`
+	Upload        int64 `json:"up"`
+	Download      int64 `json:"down"`
+	Connections   int64 `json:"connections"`
+}
+
+// StatsSnapshot is the traffic statistics grouped by proxy, rule and destination host
+type StatsSnapshot struct {
+	Proxies map[string]*TrafficStat `json:"proxies"`
+	Rules   map[string]*TrafficStat `json:"rules"`
+	Hosts   map[string]*TrafficStat `json:"hosts"`
+}
+
+// ruleKey returns the key of rule statistics, connections without rule are
+// keyed by the policy they used
+func ruleKey(rule C.Rule) string {
+	if rule == nil {
+		if Mode() == Global {
+			return "GLOBAL"
+		}
+		return "DIRECT"
+	}
+
+	if rule.Payload() == "" {
+		return rule.RuleType().String()
+	}
+	return rule.RuleType().String() + "(" + rule.Payload() + ")"
+}
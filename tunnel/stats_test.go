@@ -0,0 +1,36 @@
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatGroup_KeepAlive(t *testing.T) {
+	g := &statGroup{}
+	stats := trafficStats{g.acquire("example.com:443")}
+
+	// an idle connection keeps its statistic
+	for i := 0; i < 5; i++ {
+		g.tick(2)
+	}
+	stats.pushDownloaded(100)
+	g.tick(2)
+	assert.Equal(t, int64(100), g.snapshot()["example.com:443"].Download)
+
+	stats.release()
+	for i := 0; i < 2; i++ {
+		g.tick(2)
+	}
+	assert.Contains(t, g.snapshot(), "example.com:443")
+
+	g.tick(2)
+	assert.NotContains(t, g.snapshot(), "example.com:443")
+
+	// zero maxIdle keeps the idle statistics
+	trafficStats{g.acquire("example.com:80")}.release()
+	for i := 0; i < 5; i++ {
+		g.tick(0)
+	}
+	assert.Contains(t, g.snapshot(), "example.com:80")
+}
@@ -1,7 +1,12 @@
 package tunnel
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net"
+	"sync"
+	"syscall"
 	"time"
 
 	C "github.com/Dreamacro/clash/constant"
@@ -10,20 +15,98 @@ import (
 	"go.uber.org/atomic"
 )
 
+// the reasons why a connection is closed
+const (
+	// CloseReasonEOF means either side closes the connection normally
+	CloseReasonEOF = "eof"
+	// CloseReasonTimeout means the connection is idle or reads/writes time out
+	CloseReasonTimeout = "timeout"
+	// CloseReasonReset means the connection is reset by either side
+	CloseReasonReset = "reset"
+	// CloseReasonBlocked means the connection is blocked by a REJECT rule
+	CloseReasonBlocked = "blocked"
+	// CloseReasonCanceled means the connection is closed by the API or a config reload
+	CloseReasonCanceled = "canceled"
+	// CloseReasonError means any other error
+	CloseReasonError = "error"
+)
+
 type tracker interface {
 	ID() string
 	Close() error
+	CloseReason() string
 }
 
 type trackerInfo struct {
-	UUID          uuid.UUID     `json:"id"`
-	Metadata      *C.Metadata   `json:"metadata"`
-	UploadTotal   *atomic.Int64 `json:"upload"`
-	DownloadTotal *atomic.Int64 `json:"download"`
-	Start         time.Time     `json:"start"`
-	Chain         C.Chain       `json:"chains"`
-	Rule          string        `json:"rule"`
-	RulePayload   string        `json:"rulePayload"`
+	UUID          uuid.UUID      `json:"id"`
+	Metadata      *C.Metadata    `json:"metadata"`
+	UploadTotal   *atomic.Int64  `json:"upload"`
+	DownloadTotal *atomic.Int64  `json:"download"`
+	Start         time.Time      `json:"start"`
+	Chain         C.Chain        `json:"chains"`
+	Rule          string         `json:"rule"`
+	RulePayload   string         `json:"rulePayload"`
+	Reason        *atomic.String `json:"closeReason"`
+
+	stats      trafficStats
+	reasonOnce sync.Once
+}
+
+// CloseReason returns why the connection is closed, it's empty if the
+// connection is alive
+func (t *trackerInfo) CloseReason() string {
+	return t.Reason.Load()
+}
+
+// releaseStats is called by the manager once the connection leaves
+func (t *trackerInfo) releaseStats() {
+	t.stats.release()
+}
+
+// setCloseReason sets the reason of closing, only the first one is kept
+func (t *trackerInfo) setCloseReason(reason string) {
+	t.reasonOnce.Do(func() {
+		t.Reason.Store(reason)
+	})
+}
+
+// setCloseReason sets the close reason of a tracked connection by the error
+// which ends it, nil error means EOF
+func setCloseReason(c interface{}, err error) {
+	t, ok := c.(interface {
+		setCloseReason(string)
+		Chains() C.Chain
+	})
+	if !ok {
+		return
+	}
+
+	if chains := t.Chains(); len(chains) != 0 && (chains[0] == "REJECT" || chains[0] == "REJECT-DROP") {
+		t.setCloseReason(CloseReasonBlocked)
+		return
+	}
+	t.setCloseReason(closeReason(err))
+}
+
+func closeReason(err error) string {
+	if err == nil || errors.Is(err, io.EOF) {
+		return CloseReasonEOF
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return CloseReasonCanceled
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return CloseReasonTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNABORTED) {
+		return CloseReasonReset
+	}
+
+	return CloseReasonError
 }
 
 type tcpTracker struct {
@@ -41,6 +124,7 @@ func (tt *tcpTracker) Read(b []byte) (int, error) {
 	download := int64(n)
 	tt.manager.PushDownloaded(download)
 	tt.DownloadTotal.Add(download)
+	tt.stats.pushDownloaded(download)
 	return n, err
 }
 
@@ -49,10 +133,13 @@ func (tt *tcpTracker) Write(b []byte) (int, error) {
 	upload := int64(n)
 	tt.manager.PushUploaded(upload)
 	tt.UploadTotal.Add(upload)
+	tt.stats.pushUploaded(upload)
 	return n, err
 }
 
 func (tt *tcpTracker) Close() error {
+	// the connections closed by the tunnel have the reason set already
+	tt.setCloseReason(CloseReasonCanceled)
 	tt.manager.Leave(tt)
 	return tt.Conn.Close()
 }
@@ -71,6 +158,8 @@ func newTCPTracker(conn C.Conn, manager *Manager, metadata *C.Metadata, rule C.R
 			Rule:          "",
 			UploadTotal:   atomic.NewInt64(0),
 			DownloadTotal: atomic.NewInt64(0),
+			Reason:        atomic.NewString(""),
+			stats:         manager.trafficStats(metadata, conn.Chains(), rule),
 		},
 	}
 
@@ -98,6 +187,7 @@ func (ut *udpTracker) ReadFrom(b []byte) (int, net.Addr, error) {
 	download := int64(n)
 	ut.manager.PushDownloaded(download)
 	ut.DownloadTotal.Add(download)
+	ut.stats.pushDownloaded(download)
 	return n, addr, err
 }
 
@@ -106,10 +196,12 @@ func (ut *udpTracker) WriteTo(b []byte, addr net.Addr) (int, error) {
 	upload := int64(n)
 	ut.manager.PushUploaded(upload)
 	ut.UploadTotal.Add(upload)
+	ut.stats.pushUploaded(upload)
 	return n, err
 }
 
 func (ut *udpTracker) Close() error {
+	ut.setCloseReason(CloseReasonCanceled)
 	ut.manager.Leave(ut)
 	return ut.PacketConn.Close()
 }
@@ -128,6 +220,8 @@ func newUDPTracker(conn C.PacketConn, manager *Manager, metadata *C.Metadata, ru
 			Rule:          "",
 			UploadTotal:   atomic.NewInt64(0),
 			DownloadTotal: atomic.NewInt64(0),
+			Reason:        atomic.NewString(""),
+			stats:         manager.trafficStats(metadata, conn.Chains(), rule),
 		},
 	}
 
@@ -13,6 +13,8 @@ import (
 	"github.com/Dreamacro/clash/component/resolver"
 	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/log"
+
+	"go.uber.org/atomic"
 )
 
 var (
@@ -27,10 +29,13 @@ var (
 	// Outbound Rule
 	mode = Rule
 
-	// default timeout for UDP session
-	udpTimeout = 60 * time.Second
+	// udpTimeout is the idle timeout of the UDP sessions
+	udpTimeout = atomic.NewDuration(DefaultUDPTimeout)
 )
 
+// DefaultUDPTimeout is the default idle timeout of the UDP sessions
+const DefaultUDPTimeout = 60 * time.Second
+
 func init() {
 	go process()
 }
@@ -50,9 +55,25 @@ func AddPacket(packet *inbound.PacketAdapter) {
 
 // Rules return all rules
 func Rules() []C.Rule {
+	configMux.RLock()
+	defer configMux.RUnlock()
 	return rules
 }
 
+// EditRules replaces the rules by the result of edit, which is called with a
+// copy of the rules. The rules are unchanged if edit returns an error.
+func EditRules(edit func(rules []C.Rule) ([]C.Rule, error)) ([]C.Rule, error) {
+	configMux.Lock()
+	defer configMux.Unlock()
+
+	newRules, err := edit(append([]C.Rule{}, rules...))
+	if err != nil {
+		return nil, err
+	}
+	rules = newRules
+	return rules, nil
+}
+
 // UpdateRules handle update rules
 func UpdateRules(newRules []C.Rule) {
 	configMux.Lock()
@@ -88,6 +109,21 @@ func SetMode(m TunnelMode) {
 	mode = m
 }
 
+// SetUDPTimeout sets the idle timeout of the UDP sessions, a session is closed
+// if no packet is sent or received for timeout. It applies to the alive
+// sessions after their next packet.
+func SetUDPTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultUDPTimeout
+	}
+	udpTimeout.Store(timeout)
+}
+
+// UDPSessionCount returns the number of the alive UDP sessions
+func UDPSessionCount() int {
+	return natTable.Count()
+}
+
 // processUDP starts a loop to handle udp packet
 func processUDP() {
 	queue := udpQueue
@@ -127,11 +163,15 @@ func preHandleMetadata(metadata *C.Metadata) error {
 		if exist {
 			metadata.Host = host
 			metadata.AddrType = C.AtypDomainName
+			metadata.HostSource = "dns"
+			if resolver.IsFakeIP(metadata.DstIP) {
+				metadata.HostSource = "fake-ip-reverse"
+			}
 			if resolver.FakeIPEnabled() {
 				metadata.DstIP = nil
-			} else if node := resolver.DefaultHosts.Search(host); node != nil {
+			} else if ip := resolver.HostsIP(host); ip != nil {
 				// redir-host should lookup the hosts
-				metadata.DstIP = node.Data.(net.IP)
+				metadata.DstIP = ip
 			}
 		} else if resolver.IsFakeIP(metadata.DstIP) {
 			return fmt.Errorf("fake DNS record %s missing", metadata.DstIP)
@@ -160,6 +200,12 @@ func resolveMetadata(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
 	return proxy, rule, nil
 }
 
+// natKey returns the key of the UDP session, the sessions are keyed by the
+// source and the destination
+func natKey(src net.Addr, metadata *C.Metadata) string {
+	return src.String() + "-" + metadata.RemoteAddress()
+}
+
 func handleUDPConn(packet *inbound.PacketAdapter) {
 	metadata := packet.Metadata()
 	if !metadata.Valid() {
@@ -178,12 +224,14 @@ func handleUDPConn(packet *inbound.PacketAdapter) {
 		return
 	}
 
-	key := packet.LocalAddr().String()
+	key := natKey(packet.LocalAddr(), metadata)
 
 	handle := func() bool {
 		pc := natTable.Get(key)
 		if pc != nil {
-			handleUDPToRemote(packet, pc, metadata)
+			if err := handleUDPToRemote(packet, pc, metadata); err != nil {
+				log.Debugln("[UDP] %s --> %s write error: %s", metadata.SourceDetail(), metadata.String(), err.Error())
+			}
 			return true
 		}
 		return false
@@ -193,6 +241,14 @@ func handleUDPConn(packet *inbound.PacketAdapter) {
 		return
 	}
 
+	if isBlockedSession(key) {
+		packet.Drop()
+		return
+	}
+	if queuePacket(key, packet) {
+		return
+	}
+
 	lockKey := key + "-lock"
 	cond, loaded := natTable.GetOrCreateLock(lockKey)
 
@@ -210,34 +266,58 @@ func handleUDPConn(packet *inbound.PacketAdapter) {
 			cond.Broadcast()
 		}()
 
+		restore, blocked, queued := sniffPacketMetadata(key, packet)
+		dropQueued := func() {
+			for _, p := range queued {
+				p.Drop()
+			}
+		}
+		if blocked {
+			packet.Drop()
+			dropQueued()
+			return
+		}
+
 		proxy, rule, err := resolveMetadata(metadata)
+		restore()
 		if err != nil {
 			log.Warnln("[UDP] Parse metadata failed: %s", err.Error())
+			dropQueued()
 			return
 		}
+		emitRuleRecord(metadata, proxy, rule)
 
 		rawPc, err := proxy.DialUDP(metadata)
 		if err != nil {
 			log.Warnln("[UDP] dial %s to %s error: %s", proxy.Name(), metadata.String(), err.Error())
+			dropQueued()
 			return
 		}
+		emitProxyRecord(metadata, rawPc.Chains())
 		pc := newUDPTracker(rawPc, DefaultManager, metadata, rule)
 
 		switch true {
 		case rule != nil:
-			log.Infoln("[UDP] %s --> %v match %s(%s) using %s", metadata.SourceAddress(), metadata.String(), rule.RuleType().String(), rule.Payload(), rawPc.Chains().String())
+			log.Infoln("[UDP] %s --> %v match %s(%s) using %s", metadata.SourceDetail(), metadata.String(), rule.RuleType().String(), rule.Payload(), rawPc.Chains().String())
 		case mode == Global:
-			log.Infoln("[UDP] %s --> %v using GLOBAL", metadata.SourceAddress(), metadata.String())
+			log.Infoln("[UDP] %s --> %v using GLOBAL", metadata.SourceDetail(), metadata.String())
 		case mode == Direct:
-			log.Infoln("[UDP] %s --> %v using DIRECT", metadata.SourceAddress(), metadata.String())
+			log.Infoln("[UDP] %s --> %v using DIRECT", metadata.SourceDetail(), metadata.String())
 		default:
-			log.Infoln("[UDP] %s --> %v doesn't match any rule using DIRECT", metadata.SourceAddress(), metadata.String())
+			log.Infoln("[UDP] %s --> %v doesn't match any rule using DIRECT", metadata.SourceDetail(), metadata.String())
 		}
 
 		go handleUDPToLocal(packet.UDPPacket, pc, key, fAddr)
 
 		natTable.Set(key, pc)
 		handle()
+
+		// the packets received while sniffing
+		for _, p := range queued {
+			if err := handleUDPToRemote(p, pc, p.Metadata()); err != nil {
+				log.Debugln("[UDP] %s --> %s write error: %s", metadata.SourceDetail(), metadata.String(), err.Error())
+			}
+		}
 	}()
 }
 
@@ -255,36 +335,45 @@ func handleTCPConn(localConn C.ServerAdapter) {
 		return
 	}
 
+	restore := sniffMetadata(localConn)
 	proxy, rule, err := resolveMetadata(metadata)
+	restore()
 	if err != nil {
 		log.Warnln("[Metadata] parse failed: %s", err.Error())
 		return
 	}
+	emitRuleRecord(metadata, proxy, rule)
 
 	remoteConn, err := proxy.Dial(metadata)
 	if err != nil {
 		log.Warnln("dial %s to %s error: %s", proxy.Name(), metadata.String(), err.Error())
 		return
 	}
+	emitProxyRecord(metadata, remoteConn.Chains())
 	remoteConn = newTCPTracker(remoteConn, DefaultManager, metadata, rule)
 	defer remoteConn.Close()
 
+	var relayErr error
+	defer func() {
+		setCloseReason(remoteConn, relayErr)
+	}()
+
 	switch true {
 	case rule != nil:
-		log.Infoln("[TCP] %s --> %v match %s(%s) using %s", metadata.SourceAddress(), metadata.String(), rule.RuleType().String(), rule.Payload(), remoteConn.Chains().String())
+		log.Infoln("[TCP] %s --> %v match %s(%s) using %s", metadata.SourceDetail(), metadata.String(), rule.RuleType().String(), rule.Payload(), remoteConn.Chains().String())
 	case mode == Global:
-		log.Infoln("[TCP] %s --> %v using GLOBAL", metadata.SourceAddress(), metadata.String())
+		log.Infoln("[TCP] %s --> %v using GLOBAL", metadata.SourceDetail(), metadata.String())
 	case mode == Direct:
-		log.Infoln("[TCP] %s --> %v using DIRECT", metadata.SourceAddress(), metadata.String())
+		log.Infoln("[TCP] %s --> %v using DIRECT", metadata.SourceDetail(), metadata.String())
 	default:
-		log.Infoln("[TCP] %s --> %v doesn't match any rule using DIRECT", metadata.SourceAddress(), metadata.String())
+		log.Infoln("[TCP] %s --> %v doesn't match any rule using DIRECT", metadata.SourceDetail(), metadata.String())
 	}
 
 	switch adapter := localConn.(type) {
 	case *inbound.HTTPAdapter:
-		handleHTTP(adapter, remoteConn)
+		relayErr = handleHTTP(adapter, remoteConn)
 	case *inbound.SocketAdapter:
-		handleSocket(adapter, remoteConn)
+		relayErr = handleSocket(adapter, remoteConn)
 	}
 }
 
@@ -298,8 +387,7 @@ func match(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
 
 	var resolved bool
 
-	if node := resolver.DefaultHosts.Search(metadata.Host); node != nil {
-		ip := node.Data.(net.IP)
+	if ip := resolver.HostsIP(metadata.Host); ip != nil {
 		metadata.DstIP = ip
 		resolved = true
 	}
@@ -309,6 +397,9 @@ func match(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
 			ip, err := resolver.ResolveIP(metadata.Host)
 			if err != nil {
 				log.Debugln("[DNS] resolve %s error: %s", metadata.Host, err.Error())
+			} else if resolver.IsFakeIP(ip) {
+				// the system resolver may be clash itself, a fake ip would loop back
+				log.Debugln("[DNS] resolve %s to fake ip %s, ignored", metadata.Host, ip.String())
 			} else {
 				log.Debugln("[DNS] %s --> %s", metadata.Host, ip.String())
 				metadata.DstIP = ip
@@ -316,8 +407,8 @@ func match(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
 			resolved = true
 		}
 
-		if rule.Match(metadata) {
-			adapter, ok := proxies[rule.Adapter()]
+		if policy, matched := matchRule(rule, metadata); matched {
+			adapter, ok := proxies[policy]
 			if !ok {
 				continue
 			}
@@ -326,9 +417,21 @@ func match(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
 				log.Debugln("%v UDP is not supported", adapter.Name())
 				continue
 			}
+
+			if r, ok := rule.(C.RoutingMarkRule); ok {
+				metadata.RoutingMark = r.RoutingMark()
+			}
 			return adapter, rule, nil
 		}
 	}
 
 	return proxies["DIRECT"], nil, nil
 }
+
+// matchRule returns the policy of rule if metadata matches
+func matchRule(rule C.Rule, metadata *C.Metadata) (string, bool) {
+	if r, ok := rule.(C.PolicyRule); ok {
+		return r.MatchPolicy(metadata)
+	}
+	return rule.Adapter(), rule.Match(metadata)
+}
@@ -0,0 +1,98 @@
+package tunnel
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	C "github.com/Dreamacro/clash/constant"
+	R "github.com/Dreamacro/clash/rules"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPacketConn struct {
+	net.PacketConn
+	C.Connection
+}
+
+type testUDPPacket struct {
+	C.UDPPacket
+}
+
+func TestNatKey(t *testing.T) {
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 50000}
+	dst := func(ip string, port string) *C.Metadata {
+		return &C.Metadata{NetWork: C.UDP, DstIP: net.ParseIP(ip), DstPort: port}
+	}
+
+	// the packets of a session share the key
+	assert.Equal(t, natKey(src, dst("1.1.1.1", "53")), natKey(src, dst("1.1.1.1", "53")))
+	// every destination of a source is a session
+	assert.NotEqual(t, natKey(src, dst("1.1.1.1", "53")), natKey(src, dst("8.8.8.8", "53")))
+	assert.NotEqual(t, natKey(src, dst("1.1.1.1", "53")), natKey(src, dst("1.1.1.1", "443")))
+	// and so is every source of a destination
+	other := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 50001}
+	assert.NotEqual(t, natKey(src, dst("1.1.1.1", "53")), natKey(other, dst("1.1.1.1", "53")))
+}
+
+func TestHandleUDPToLocal_Expire(t *testing.T) {
+	timeout := udpTimeout.Load()
+	SetUDPTimeout(50 * time.Millisecond)
+	defer SetUDPTimeout(timeout)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	pc := &testPacketConn{PacketConn: conn}
+
+	key := "expire"
+	natTable.Set(key, pc)
+	done := make(chan struct{})
+	go func() {
+		handleUDPToLocal(&testUDPPacket{}, pc, key, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the idle session isn't expired")
+	}
+	assert.Nil(t, natTable.Get(key))
+
+	// the socket of the session is closed
+	_, err = conn.WriteTo([]byte{0}, conn.LocalAddr())
+	assert.Error(t, err)
+}
+
+func TestSetUDPTimeout(t *testing.T) {
+	timeout := udpTimeout.Load()
+	defer SetUDPTimeout(timeout)
+
+	SetUDPTimeout(time.Second)
+	assert.Equal(t, time.Second, udpTimeout.Load())
+	SetUDPTimeout(0)
+	assert.Equal(t, DefaultUDPTimeout, udpTimeout.Load())
+}
+
+func TestEditRules(t *testing.T) {
+	UpdateRules([]C.Rule{R.NewDomain("a.com", "DIRECT"), R.NewDomain("b.com", "DIRECT")})
+	defer UpdateRules(nil)
+
+	// edit gets a copy, the rules are unchanged on error
+	_, err := EditRules(func(rules []C.Rule) ([]C.Rule, error) {
+		rules[0] = R.NewDomain("c.com", "DIRECT")
+		return nil, errors.New("failed")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "a.com", Rules()[0].Payload())
+
+	edited, err := EditRules(func(rules []C.Rule) ([]C.Rule, error) {
+		return rules[1:], nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, edited, 1)
+	assert.Equal(t, "b.com", Rules()[0].Payload())
+}